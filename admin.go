@@ -0,0 +1,240 @@
+package gosqlrwdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Admin is the operator API of a `DB` for small CLIs, so that SREs can adjust routing of a running process
+// without code changes: in-process, or over a local control socket served by `Serve()`.
+type Admin struct {
+	db *DB
+}
+
+// AdminHealth is the health of a `DB` reported by `Admin.Health()`
+type AdminHealth struct {
+	// PrimaryHealthy is true if primary DB passed the last health check or is in maintenance mode
+	PrimaryHealthy bool `json:"primary_healthy"`
+
+	// HealthyReplicas & Replicas are numbers of healthy read replicas and all read replicas, both excluding drained ones
+	HealthyReplicas int `json:"healthy_replicas"`
+	Replicas        int `json:"replicas"`
+
+	// Ready is the result of `Ready()`, with its error as Err if not ready
+	Ready bool   `json:"ready"`
+	Err   string `json:"error,omitempty"`
+}
+
+// Admin returns the operator API of db
+func (db *DB) Admin() *Admin {
+	return &Admin{db: db}
+}
+
+// ListTargets returns primary DB followed by read replicas, with their state as `Topology()` reports
+func (a *Admin) ListTargets() []TopologyNode {
+	t := a.db.Topology()
+	return append([]TopologyNode{t.Primary}, t.Replicas...)
+}
+
+// Evict stops routing reads to the read replica named name for d, as if it breached the `SLO`.
+// It returns an error wrapping `ErrInvalidConfig` if the target is unknown or primary DB, or d is not positive.
+func (a *Admin) Evict(name string, d time.Duration) error {
+	state, err := a.replicaState(name)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("%w: eviction duration %s is not positive", ErrInvalidConfig, d)
+	}
+	until := time.Now().Add(d)
+	state.mu.Lock()
+	state.evictedUntil = until
+	state.mu.Unlock()
+
+	a.db.configMutex.Lock()
+	if until.After(a.db.manualEvictionUntil) {
+		a.db.manualEvictionUntil = until
+	}
+	a.db.configMutex.Unlock()
+	a.db.debugf(DebugEvent, "[Admin] evict replica: %s until: %s", name, until)
+	return nil
+}
+
+// Restore routes reads to the read replica named name again, ending its eviction by `Evict()` or the `SLO`
+// and its exclusion by `ExcludeReplica()`, and dropping samples of the SLO. Read replicas drained by `DrainReplica()` are closed and never restored.
+// It returns an error wrapping `ErrInvalidConfig` if the target is unknown or primary DB.
+func (a *Admin) Restore(name string) error {
+	state, err := a.replicaState(name)
+	if err != nil {
+		return err
+	}
+	state.mu.Lock()
+	state.evictedUntil = time.Time{}
+	state.excludedUntil = time.Time{}
+	state.resetSLO()
+	state.mu.Unlock()
+	a.db.debugf(DebugEvent, "[Admin] restore replica: %s", name)
+	return nil
+}
+
+// SetReadPercentage changes `RuntimeConfig.ReadPercentage` by `Reconfigure()`
+func (a *Admin) SetReadPercentage(percentage int) error {
+	cfg := a.db.RuntimeConfig()
+	cfg.ReadPercentage = percentage
+	return a.db.Reconfigure(cfg)
+}
+
+// Health returns the health of db by results of the latest health checks, without checking by itself
+func (a *Admin) Health() AdminHealth {
+	primaryHealthy, _ := a.db.healthy()
+	healthy, total := a.db.healthyReplicas()
+	h := AdminHealth{PrimaryHealthy: primaryHealthy, HealthyReplicas: healthy, Replicas: total, Ready: true}
+	if err := a.db.Ready(); err != nil {
+		h.Ready, h.Err = false, err.Error()
+	}
+	return h
+}
+
+// replicaState returns the state of the read replica named name
+func (a *Admin) replicaState(name string) (*replicaState, error) {
+	handle, info := a.db.targetByName(name)
+	if handle == nil {
+		return nil, fmt.Errorf("%w: no target named %q", ErrInvalidConfig, name)
+	}
+	if info.Role != RoleReplica {
+		return nil, fmt.Errorf("%w: target %q is not a read replica", ErrInvalidConfig, name)
+	}
+	return a.db.replicaStates[handle], nil
+}
+
+// Exec runs a command line of the control socket and returns its result, one of:
+//
+//	targets                      -> []TopologyNode by ListTargets()
+//	health                       -> AdminHealth by Health()
+//	evict <name> <duration>      -> Evict(), e.g. `evict replica-1 5m`
+//	restore <name>               -> Restore()
+//	exclude <name> <duration>    -> ExcludeReplica() of DB, e.g. `exclude replica-1 30m`
+//	read-percentage <percentage> -> SetReadPercentage()
+//
+// Commands changing routing return nil.
+func (a *Admin) Exec(command string) (interface{}, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("empty command")
+	}
+	args := fields[1:]
+	switch name := fields[0]; {
+	case name == "targets" && len(args) == 0:
+		return a.ListTargets(), nil
+	case name == "health" && len(args) == 0:
+		return a.Health(), nil
+	case name == "evict" && len(args) == 2:
+		d, err := time.ParseDuration(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		return nil, a.Evict(args[0], d)
+	case name == "exclude" && len(args) == 2:
+		d, err := time.ParseDuration(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		return nil, a.db.ExcludeReplica(args[0], d)
+	case name == "restore" && len(args) == 1:
+		return nil, a.Restore(args[0])
+	case name == "read-percentage" && len(args) == 1:
+		percentage, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		return nil, a.SetReadPercentage(percentage)
+	}
+	return nil, fmt.Errorf("unknown command or wrong number of arguments: %q", command)
+}
+
+// adminResponse is a line of responses of the control socket
+type adminResponse struct {
+	Result interface{} `json:"result,omitempty"`
+	Err    string      `json:"error,omitempty"`
+}
+
+// Serve serves the control socket on l, e.g. a Unix socket only operators of the host can access,
+// until l is closed, returning the error of `Accept()`. Serve does not authenticate clients.
+// Each line sent by a client is a command of `Exec()`, answered by a line of JSON,
+// `{"result": ...}` or `{"error": "..."}`, e.g. by `echo targets | nc -U /run/app/gosqlrwdb.sock`.
+func (a *Admin) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go a.serveConn(conn)
+	}
+}
+
+// serveConn answers commands sent on conn until it is closed
+func (a *Admin) serveConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		command := strings.TrimSpace(scanner.Text())
+		if command == "" {
+			continue
+		}
+		var resp adminResponse
+		result, err := a.Exec(command)
+		if err != nil {
+			resp.Err = err.Error()
+		} else {
+			resp.Result = result
+		}
+		if err := encoder.Encode(resp); err != nil {
+			a.db.debugf(DebugError, "[Admin] write response err: %s", err)
+			return
+		}
+	}
+}
+
+// AdminCommand sends command to the control socket served by `Admin.Serve()` at address of network,
+// and returns the JSON of its result, for CLIs of operators.
+// Errors of the command are returned as errors.
+func AdminCommand(ctx context.Context, network, address, command string) (json.RawMessage, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := fmt.Fprintln(conn, strings.Replace(command, "\n", " ", -1)); err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Err    string          `json:"error"`
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Err != "" {
+		return nil, errors.New(resp.Err)
+	}
+	return resp.Result, nil
+}
+
+// evictionsEnabled returns true if read replicas may be evicted, by the `SLO` or `Admin.Evict()`
+func (db *DB) evictionsEnabled() bool {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.slo != nil || time.Now().Before(db.manualEvictionUntil)
+}
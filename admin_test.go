@@ -0,0 +1,126 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAdmin(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+	admin := db.Admin()
+	selectQuery := fmt.Sprintf(selectQueryTmpl, "*")
+
+	if err := admin.Evict("replica-0", 5*time.Minute); err != nil {
+		t.Fatalf("error %s when Evict", err)
+	}
+	for i := 0; i < 2; i++ {
+		if actual := db.SimulateRoute(context.Background(), selectQuery).Target.Name; actual != "replica-1" {
+			t.Errorf("actual target: %s, expected: replica-1 while replica-0 is evicted", actual)
+		}
+	}
+	if actual := admin.ListTargets()[1].State; actual != TopologyStateEvicted {
+		t.Errorf("actual state: %s, expected: %s", actual, TopologyStateEvicted)
+	}
+	if err := admin.Restore("replica-0"); err != nil {
+		t.Fatalf("error %s when Restore", err)
+	}
+	if actual := admin.ListTargets()[1].State; actual != TopologyStateAvailable {
+		t.Errorf("actual state: %s, expected: %s", actual, TopologyStateAvailable)
+	}
+
+	invalid := []func() error{
+		func() error { return admin.Evict("primary", time.Minute) },
+		func() error { return admin.Evict("replica-9", time.Minute) },
+		func() error { return admin.Evict("replica-1", 0) },
+		func() error { return admin.Restore("replica-9") },
+		func() error { return admin.SetReadPercentage(101) },
+	}
+	for i, f := range invalid {
+		if err := f(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("actual err: %v, expected: %s of test %d", err, ErrInvalidConfig, i)
+		}
+	}
+
+	if err := admin.SetReadPercentage(30); err != nil {
+		t.Fatalf("error %s when SetReadPercentage", err)
+	}
+	if actual := db.RuntimeConfig().ReadPercentage; actual != 30 {
+		t.Errorf("actual read percentage: %d, expected: 30", actual)
+	}
+	expected := AdminHealth{PrimaryHealthy: true, HealthyReplicas: 2, Replicas: 2, Ready: true}
+	if actual := admin.Health(); actual != expected {
+		t.Errorf("actual health: %+v, expected: %+v", actual, expected)
+	}
+
+	for _, m := range []*mydbMock{p, r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestAdminServe(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error %s when Listen", err)
+	}
+	defer l.Close()
+	go db.Admin().Serve(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := AdminCommand(ctx, "tcp", l.Addr().String(), "targets")
+	if err != nil {
+		t.Fatalf("error %s when AdminCommand", err)
+	}
+	var targets []TopologyNode
+	if err := json.Unmarshal(result, &targets); err != nil {
+		t.Fatalf("error %s when decoding targets", err)
+	}
+	if len(targets) != 2 || targets[0].Name != "primary" || targets[1].Name != "replica-0" {
+		t.Errorf("actual targets: %+v, expected: primary and replica-0", targets)
+	}
+
+	if _, err := AdminCommand(ctx, "tcp", l.Addr().String(), "read-percentage 40"); err != nil {
+		t.Errorf("error %s when AdminCommand", err)
+	}
+	if actual := db.RuntimeConfig().ReadPercentage; actual != 40 {
+		t.Errorf("actual read percentage: %d, expected: 40", actual)
+	}
+
+	tests := []string{"evict replica-0", "evict replica-0 soon", "restore primary", "scale-out"}
+	for _, command := range tests {
+		if _, err := AdminCommand(ctx, "tcp", l.Addr().String(), command); err == nil {
+			t.Errorf("actual no error, expected an error of %q", command)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencyWindow is the window of latency histograms used to calculate recent latency of read replica
+	latencyWindow = time.Minute
+
+	// latencyPercentile is the percentile used as recent latency of read replica
+	latencyPercentile = 0.9
+
+	// queueWaitRefreshInterval is the minimum interval to refresh queue wait from `sql.DBStats`
+	queueWaitRefreshInterval = time.Second
+)
+
+// ReplicaCandidate is a read replica eligible for a read, passed to `Balancer`
+type ReplicaCandidate struct {
+	// Target describes the read replica
+	Target TargetInfo
+
+	// Latency is the recent p90 latency of requests to the read replica, 0 if unknown
+	Latency time.Duration
+
+	// QueueWait is the recent average wait for a connection of the read replica, 0 if unknown
+	QueueWait time.Duration
+}
+
+// Balancer selects one of read replicas for a read.
+// Unavailable, not ready and evicted read replicas are never passed as candidates.
+type Balancer interface {
+	// Select returns index of selected one in candidates, which is never empty.
+	// Indexes out of range are replaced by Round-Robin selection.
+	Select(ctx context.Context, candidates []ReplicaCandidate) int
+}
+
+// RoundRobinBalancer selects read replica using Round-Robin algorithm.
+// Zero value is ready to use.
+type RoundRobinBalancer struct {
+	count uint64
+}
+
+// Select returns the next candidate
+func (b *RoundRobinBalancer) Select(_ context.Context, candidates []ReplicaCandidate) int {
+	return int((atomic.AddUint64(&b.count, 1) - 1) % uint64(len(candidates)))
+}
+
+// DeadlineAwareBalancer prefers read replicas whose recent latency plus queue wait
+// fits within the remaining time of the context deadline.
+//
+// Among candidates that fit, or all candidates when the context has no deadline,
+// `Fallback` is used to select one (Round-Robin if nil).
+// If no candidate fits, the one with least latency plus queue wait is selected.
+type DeadlineAwareBalancer struct {
+	Fallback Balancer
+
+	rr RoundRobinBalancer
+}
+
+// Select returns index of selected candidate
+func (b *DeadlineAwareBalancer) Select(ctx context.Context, candidates []ReplicaCandidate) int {
+	fallback := b.Fallback
+	if fallback == nil {
+		fallback = &b.rr
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return fallback.Select(ctx, candidates)
+	}
+
+	remaining := time.Until(deadline)
+	fits := make([]ReplicaCandidate, 0, len(candidates))
+	idxs := make([]int, 0, len(candidates))
+	best := 0
+	for i, c := range candidates {
+		cost := c.Latency + c.QueueWait
+		if cost < candidates[best].Latency+candidates[best].QueueWait {
+			best = i
+		}
+		if cost <= remaining {
+			fits = append(fits, c)
+			idxs = append(idxs, i)
+		}
+	}
+	if len(fits) == 0 {
+		return best
+	}
+	i := fallback.Select(ctx, fits)
+	if i < 0 || i >= len(fits) {
+		// out of range of fits, not of candidates, so that the caller falls back to Round-Robin
+		return -1
+	}
+	return idxs[i]
+}
+
+// WeightedBalancer selects read replica randomly in proportion to `TargetInfo.Weight`
+// set by `SetTargetInfo()`. Zero value is ready to use.
+type WeightedBalancer struct{}
+
+// Select returns index of a candidate chosen by weight
+func (WeightedBalancer) Select(_ context.Context, candidates []ReplicaCandidate) int {
+	total := 0
+	for _, c := range candidates {
+		total += weightOf(c.Target)
+	}
+	n := rand.Intn(total)
+	for i, c := range candidates {
+		if n -= weightOf(c.Target); n < 0 {
+			return i
+		}
+	}
+	return len(candidates) - 1
+}
+
+// weightOf returns weight of target, 1 if not set
+func weightOf(target TargetInfo) int {
+	if target.Weight <= 0 {
+		return 1
+	}
+	return target.Weight
+}
+
+// ConsistentHashBalancer selects read replica by the routing key set by `WithRoutingKey()`,
+// so that reads of the same key consistently land on the same read replica, warming its cache
+// for the working set of the key.
+//
+// It uses rendezvous hashing over indexes of read replicas: when a read replica becomes unavailable,
+// only keys on it move to other read replicas, and they move back when it recovers.
+// Reads without routing key are selected by `Fallback` (Round-Robin if nil).
+type ConsistentHashBalancer struct {
+	Fallback Balancer
+
+	rr RoundRobinBalancer
+}
+
+// Select returns index of the candidate with the highest hash of routing key and its index
+func (b *ConsistentHashBalancer) Select(ctx context.Context, candidates []ReplicaCandidate) int {
+	key, ok := RoutingKeyFromContext(ctx)
+	if !ok {
+		fallback := b.Fallback
+		if fallback == nil {
+			fallback = &b.rr
+		}
+		return fallback.Select(ctx, candidates)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	keyHash := h.Sum64()
+	best, bestScore := 0, uint64(0)
+	for i, c := range candidates {
+		if score := mix64(keyHash ^ (uint64(c.Target.Index)+1)*0x9e3779b97f4a7c15); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// mix64 is the finalizer of SplitMix64, spreading bits of x
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// SetBalancer sets the Balancer used to select read replica.
+// Passing nil restores the default Round-Robin selection.
+func (db *DB) SetBalancer(b Balancer) {
+	db.configMutex.Lock()
+	db.balancer = b
+	db.configMutex.Unlock()
+}
+
+// replicaBalancer returns current Balancer, nil if not set
+func (db *DB) replicaBalancer() Balancer {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.balancer
+}
+
+// selectReplica returns one of the read replicas.
+// It uses Balancer set by `SetBalancer()` if any; otherwise `readReplicaRoundRobin()`.
+// Read replicas excluded by `WithExcludeReplicas()` are skipped,
+// and read replicas in ramp-up by `SetRampUpPolicy()` or flapping by `SetHealthWeightPolicy()`
+// are skipped by chance of their current weight. Read replicas over `ReadBudget` are skipped as well.
+// The read replica of `TargetInfo.ReaderEndpoint` is selected without balancing unless skipped.
+func (db *DB) selectReplica(ctx context.Context, bypassAutoFailover bool) (*sql.DB, error) {
+	if db.single {
+		return db.readreplicas[0], nil
+	}
+	exclude := db.excludedReplicas(ctx)
+	budget := db.replicaReadBudget()
+	if budget == nil || bypassAutoFailover {
+		return db.selectReplicaExcept(ctx, exclude, bypassAutoFailover)
+	}
+	overBudget := map[*sql.DB]struct{}{}
+	for {
+		r, err := db.selectReplicaExcept(ctx, exclude, false)
+		if err != nil {
+			return nil, overBudgetSkips(err, db.replicaStates, overBudget)
+		}
+		if db.takeReadBudget(ctx, budget, r) {
+			return r, nil
+		}
+		if err := ctx.Err(); err != nil {
+			// the caller gave up, not taking budget of any read replica
+			return nil, err
+		}
+		if len(overBudget) == 0 {
+			copied := make(map[*sql.DB]struct{}, len(exclude)+1)
+			for e := range exclude {
+				copied[e] = empty
+			}
+			exclude = copied
+		}
+		exclude[r], overBudget[r] = empty, empty
+	}
+}
+
+// selectReplicaExcept is `selectReplica()` skipping read replicas in exclude instead of ones excluded by ctx
+func (db *DB) selectReplicaExcept(ctx context.Context, exclude map[*sql.DB]struct{}, bypassAutoFailover bool) (*sql.DB, error) {
+	b := db.replicaBalancer()
+	if b == nil || bypassAutoFailover {
+		return db.readReplicaRoundRobinExcept(exclude, bypassAutoFailover)
+	}
+	if !DoValidateNew && len(db.readreplicas) == 0 {
+		return nil, ErrNotProvidedReplicas
+	}
+	if r := db.readerEndpoint(exclude, false); r != nil {
+		return r, nil
+	}
+
+	candidates := make([]ReplicaCandidate, 0, len(db.readreplicas))
+	replicas := make([]*sql.DB, 0, len(db.readreplicas))
+	rampUp := db.replicaRampUpPolicy()
+	health := db.replicaHealthWeightPolicy()
+	throttled := map[int]struct{}{}
+	db.countMutex.RLock()
+	active := 0
+	for _, r := range db.readreplicas {
+		if _, drained := db.drainedReplicas[r]; drained {
+			continue
+		}
+		if _, excluded := exclude[r]; excluded {
+			continue
+		}
+		active++
+		if _, unavailable := db.unavailableReplicas[r]; db.needHeartbeat && (unavailable || !db.ready(r)) {
+			continue
+		}
+		if db.throttled(rampUp, health, r) {
+			throttled[db.replicaStates[r].index] = empty
+		}
+		replicas = append(replicas, r)
+	}
+	db.countMutex.RUnlock()
+	for _, r := range replicas {
+		if db.evicted(r) {
+			continue
+		}
+		state := db.replicaStates[r]
+		latency, queueWait := state.load(r)
+		candidates = append(candidates, ReplicaCandidate{
+			Target:    db.targetInfo(r),
+			Latency:   latency,
+			QueueWait: queueWait,
+		})
+	}
+	if len(candidates) == 0 {
+		return nil, db.noReplicaAvailable(exclude, false)
+	}
+	if len(candidates) < active {
+		db.countFailover()
+	}
+	if len(throttled) > 0 {
+		// replicas in ramp-up or flapping still serve reads if no other replica is available
+		rest := make([]ReplicaCandidate, 0, len(candidates))
+		for _, c := range candidates {
+			if _, ok := throttled[c.Target.Index]; !ok {
+				rest = append(rest, c)
+			}
+		}
+		if len(rest) > 0 {
+			candidates = rest
+		}
+	}
+
+	selected := candidates[db.balance(ctx, b, candidates)]
+	db.debugf(DebugRouting, "[selectReplica] replica idx: %d, latency: %s, queue wait: %s",
+		selected.Target.Index, selected.Latency, selected.QueueWait)
+	return db.readreplicas[selected.Target.Index], nil
+}
+
+// balance returns index of the candidate selected by b, or by Round-Robin if b returns an index out of range
+func (db *DB) balance(ctx context.Context, b Balancer, candidates []ReplicaCandidate) int {
+	i := b.Select(ctx, candidates)
+	if i < 0 || i >= len(candidates) {
+		db.debugf(DebugError, "[selectReplica] balancer selected index %d of %d candidates, fall back to round-robin", i, len(candidates))
+		return db.roundRobin.Select(ctx, candidates)
+	}
+	return i
+}
+
+// load returns recent latency and queue wait of r
+func (s *replicaState) load(r *sql.DB) (time.Duration, time.Duration) {
+	now := time.Now()
+	latency := s.latency.reads.percentile(now, latencyPercentile)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.queueWaitAt) >= queueWaitRefreshInterval {
+		stats := r.Stats()
+		waitCount := stats.WaitCount - s.waitCount
+		waitDuration := stats.WaitDuration - s.waitDuration
+		s.queueWait = 0
+		if waitCount > 0 {
+			s.queueWait = waitDuration / time.Duration(waitCount)
+		}
+		s.waitCount, s.waitDuration, s.queueWaitAt = stats.WaitCount, stats.WaitDuration, now
+	}
+	return latency, s.queueWait
+}
@@ -0,0 +1,195 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRoundRobinBalancer(t *testing.T) {
+	candidates := make([]ReplicaCandidate, 3)
+	b := &RoundRobinBalancer{}
+	for i, expected := range []int{0, 1, 2, 0, 1, 2} {
+		if actual := b.Select(context.Background(), candidates); actual != expected {
+			t.Errorf("call %d: actual = %d, expected = %d", i, actual, expected)
+		}
+	}
+}
+
+func TestDeadlineAwareBalancer(t *testing.T) {
+	candidates := []ReplicaCandidate{
+		{Target: TargetInfo{Role: RoleReplica, Index: 0}, Latency: time.Second},
+		{Target: TargetInfo{Role: RoleReplica, Index: 1}, Latency: 10 * time.Millisecond, QueueWait: 2 * time.Second},
+		{Target: TargetInfo{Role: RoleReplica, Index: 2}, Latency: 10 * time.Millisecond},
+		{Target: TargetInfo{Role: RoleReplica, Index: 3}, Latency: 20 * time.Millisecond},
+	}
+
+	b := &DeadlineAwareBalancer{}
+	for i, expected := range []int{0, 1, 2, 3} {
+		if actual := b.Select(context.Background(), candidates); actual != expected {
+			t.Errorf("no deadline, call %d: actual = %d, expected = %d", i, actual, expected)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	b = &DeadlineAwareBalancer{}
+	for i, expected := range []int{2, 3, 2, 3} {
+		if actual := b.Select(ctx, candidates); actual != expected {
+			t.Errorf("deadline, call %d: actual = %d, expected = %d", i, actual, expected)
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if actual := b.Select(ctx, candidates); actual != 2 {
+		t.Errorf("no candidate fits: actual = %d, expected = 2", actual)
+	}
+
+	// index of fits out of range but of candidates in range, e.g. 2 of 2 fits
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	b = &DeadlineAwareBalancer{Fallback: outOfRangeBalancer{}}
+	if actual := b.Select(ctx, candidates); actual != -1 {
+		t.Errorf("out of range fallback: actual = %d, expected = -1", actual)
+	}
+}
+
+func TestWeightedBalancer(t *testing.T) {
+	candidates := []ReplicaCandidate{
+		{Target: TargetInfo{Role: RoleReplica, Index: 0, Weight: 3}},
+		{Target: TargetInfo{Role: RoleReplica, Index: 1}},
+		{Target: TargetInfo{Role: RoleReplica, Index: 2, Weight: 1}},
+	}
+
+	selected := map[int]int{}
+	for i := 0; i < 5000; i++ {
+		selected[WeightedBalancer{}.Select(context.Background(), candidates)]++
+	}
+	// expected 3000, 1000, 1000
+	if selected[0] < 2700 || selected[0] > 3300 || selected[1] < 800 || selected[2] < 800 {
+		t.Errorf("actual selected = %v, expected in proportion to 3:1:1", selected)
+	}
+}
+
+func TestConsistentHashBalancer(t *testing.T) {
+	candidates := make([]ReplicaCandidate, 4)
+	for i := range candidates {
+		candidates[i].Target = TargetInfo{Role: RoleReplica, Index: i}
+	}
+
+	b := &ConsistentHashBalancer{}
+	for i, expected := range []int{0, 1, 2, 3} {
+		if actual := b.Select(context.Background(), candidates); actual != expected {
+			t.Errorf("no routing key, call %d: actual = %d, expected = %d", i, actual, expected)
+		}
+	}
+
+	selected := map[int]int{}
+	for k := 0; k < 1000; k++ {
+		ctx := WithRoutingKey(context.Background(), fmt.Sprintf("user-%d", k))
+		first := b.Select(ctx, candidates)
+		if actual := b.Select(ctx, candidates); actual != first {
+			t.Fatalf("key %d: actual = %d, expected the same as first = %d", k, actual, first)
+		}
+		selected[first]++
+
+		// keys move only from the removed candidate
+		rest := append(append([]ReplicaCandidate{}, candidates[:1]...), candidates[2:]...)
+		moved := rest[b.Select(ctx, rest)].Target.Index
+		if first != 1 && moved != first {
+			t.Errorf("key %d: actual = %d after removing replica 1, expected = %d", k, moved, first)
+		}
+	}
+	for i := range candidates {
+		if selected[i] < 150 {
+			t.Errorf("actual keys on replica %d: %d of 1000, expected evenly distributed", i, selected[i])
+		}
+	}
+}
+
+func TestSelectReplicaWithBalancer(t *testing.T) {
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r3, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	r3.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db, r3.db)
+	defer db.Close()
+	db.SetBalancer(&RoundRobinBalancer{})
+
+	for i, expected := range []int{0, 2, 0, 2} {
+		_, target, err := db.SelectReplica(context.Background())
+		if err != nil {
+			t.Fatalf("error %s when SelectReplica", err)
+		}
+		if target.Index != expected {
+			t.Errorf("call %d: actual = %d, expected = %d", i, target.Index, expected)
+		}
+	}
+	if actual := db.Metrics().Failovers; actual != 4 {
+		t.Errorf("actual failovers: %d, expected: 4", actual)
+	}
+
+	db.SetBalancer(nil)
+	if db.replicaBalancer() != nil {
+		t.Errorf("balancer should be reset to default")
+	}
+}
+
+// outOfRangeBalancer is a broken Balancer selecting a candidate that does not exist
+type outOfRangeBalancer struct{}
+
+func (outOfRangeBalancer) Select(_ context.Context, candidates []ReplicaCandidate) int {
+	return len(candidates)
+}
+
+func TestSelectReplicaWithOutOfRangeBalancer(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, b := range []Balancer{outOfRangeBalancer{}, &DeadlineAwareBalancer{Fallback: outOfRangeBalancer{}}} {
+		db.SetBalancer(b)
+		// Round-Robin selection instead of a panic
+		for i, expected := range []int{0, 1} {
+			_, target, err := db.SelectReplica(ctx)
+			if err != nil {
+				t.Fatalf("error %s when SelectReplica", err)
+			}
+			if target.Index != expected {
+				t.Errorf("call %d of %T: actual = %d, expected = %d", i, b, target.Index, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// budgetSampleCapacity is the maximum number of samples kept by sampleRing
+	budgetSampleCapacity = 1024
+
+	defaultWriteBudgetWindow      = time.Minute
+	defaultWriteBudgetMinRequests = 20
+	defaultWriteBudgetPercentile  = 0.99
+)
+
+// WriteLatencyBudget is the latency budget of writes on primary DB by `Exec()` and `ExecContext()`.
+// It is breached when the latency at `Percentile` in `Window` stays above `MaxLatency` for `Sustain`,
+// emitting `EventWriteBudgetBreached`, and recovers at the first write within budget, emitting `EventWriteBudgetRecovered`.
+// It is evaluated on each write, so that nothing changes without writes.
+//
+// Zero values of `Window`, `MinRequests` and `Percentile` mean defaults.
+type WriteLatencyBudget struct {
+	// MaxLatency is the maximum latency allowed at `Percentile` in `Window`, must be positive
+	MaxLatency time.Duration
+
+	// Percentile is the percentile (0.0 ~ 1.0) compared with `MaxLatency`. Default to 0.99.
+	Percentile float64
+
+	// Window is the rolling window used to calculate latency. Default to 1m.
+	Window time.Duration
+
+	// MinRequests is the minimum number of writes in `Window` before the budget is evaluated. Default to 20.
+	MinRequests int
+
+	// Sustain is how long the latency must stay above `MaxLatency` before the budget is breached,
+	// zero to breach at once
+	Sustain time.Duration
+
+	// ShiftReads routes all reads to read replicas while the budget is breached, ignoring `RuntimeConfig.ReadPercentage`,
+	// to take load off primary DB. Reads forced to primary DB (e.g. by `WithPrimary()`) are not shifted.
+	ShiftReads bool
+}
+
+// withDefaults returns a copy of b with zero values replaced by defaults
+func (b WriteLatencyBudget) withDefaults() WriteLatencyBudget {
+	if b.Window <= 0 {
+		b.Window = defaultWriteBudgetWindow
+	}
+	if b.MinRequests <= 0 {
+		b.MinRequests = defaultWriteBudgetMinRequests
+	}
+	if b.Percentile <= 0 || b.Percentile > 1 {
+		b.Percentile = defaultWriteBudgetPercentile
+	}
+	return b
+}
+
+// WriteLatencyStatus is the current state of `WriteLatencyBudget`
+type WriteLatencyStatus struct {
+	// Requests is the number of writes in `Window`
+	Requests int
+
+	// Latency is the latency at `Percentile` in `Window`
+	Latency time.Duration
+
+	// Breached is true while the budget is breached
+	Breached bool
+
+	// Since is when the latency went above `MaxLatency`, zero while within budget
+	Since time.Time
+}
+
+// writeBudget tracks latency of writes against a WriteLatencyBudget
+type writeBudget struct {
+	budget WriteLatencyBudget
+
+	mu             sync.Mutex
+	breached       bool
+	breachingSince time.Time
+	sampleRing
+}
+
+// SetWriteLatencyBudget sets the latency budget of writes on primary DB.
+// Passing nil disables it, emitting `EventWriteBudgetRecovered` if it was breached.
+// It returns an error wrapping `ErrInvalidConfig` if `MaxLatency` is not positive.
+func (db *DB) SetWriteLatencyBudget(b *WriteLatencyBudget) error {
+	var w *writeBudget
+	if b != nil {
+		if b.MaxLatency <= 0 {
+			return fmt.Errorf("%w: max latency %s of write latency budget is not positive", ErrInvalidConfig, b.MaxLatency)
+		}
+		w = &writeBudget{budget: b.withDefaults(), sampleRing: newSampleRing()}
+	}
+	db.configMutex.Lock()
+	previous := db.writeBudget
+	db.writeBudget = w
+	db.configMutex.Unlock()
+	if previous == nil {
+		return nil
+	}
+	previous.mu.Lock()
+	breached := previous.breached
+	previous.breached = false
+	previous.mu.Unlock()
+	if breached {
+		db.emit(Event{Type: EventWriteBudgetRecovered, Target: db.targetInfo(db.master)})
+	}
+	return nil
+}
+
+// primaryWriteBudget returns current writeBudget, nil if not set
+func (db *DB) primaryWriteBudget() *writeBudget {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.writeBudget
+}
+
+// WriteLatency returns the current state of the budget set by `SetWriteLatencyBudget()`, zero value if not set
+func (db *DB) WriteLatency() WriteLatencyStatus {
+	w := db.primaryWriteBudget()
+	if w == nil {
+		return WriteLatencyStatus{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, _, latency := w.stats(time.Now().Add(-w.budget.Window), w.budget.Percentile)
+	return WriteLatencyStatus{Requests: n, Latency: latency, Breached: w.breached, Since: w.breachingSince}
+}
+
+// observeWrite records the latency of a write on primary DB started at start,
+// and emits an event when the budget is breached or recovered
+func (db *DB) observeWrite(start time.Time) {
+	db.recordLatency(db.master, true, time.Since(start))
+	w := db.primaryWriteBudget()
+	if w == nil {
+		return
+	}
+	now := time.Now()
+	var event *Event
+
+	w.mu.Lock()
+	w.add(sample{at: now, latency: now.Sub(start)})
+	n, _, latency := w.stats(now.Add(-w.budget.Window), w.budget.Percentile)
+	switch over := n >= w.budget.MinRequests && latency > w.budget.MaxLatency; {
+	case over && w.breachingSince.IsZero():
+		w.breachingSince = now
+		fallthrough
+	case over:
+		if !w.breached && now.Sub(w.breachingSince) >= w.budget.Sustain {
+			w.breached = true
+			err := fmt.Errorf("%w: latency %s at p%g exceeds %s since %s",
+				ErrWriteLatencyBudget, latency, w.budget.Percentile*100, w.budget.MaxLatency, w.breachingSince.Format(time.RFC3339))
+			event = &Event{Type: EventWriteBudgetBreached, Err: err}
+		}
+	default:
+		w.breachingSince = time.Time{}
+		if w.breached {
+			w.breached = false
+			event = &Event{Type: EventWriteBudgetRecovered}
+		}
+	}
+	w.mu.Unlock()
+
+	if event != nil {
+		event.Target = db.targetInfo(db.master)
+		db.emit(*event)
+	}
+}
+
+// shiftReads returns true if reads should not be routed to primary DB by `RuntimeConfig.ReadPercentage`
+// as `WriteLatencyBudget` with `ShiftReads` is breached
+func (db *DB) shiftReads() bool {
+	w := db.primaryWriteBudget()
+	if w == nil || !w.budget.ShiftReads {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.breached
+}
+
+// sample is the outcome of one request to a target
+type sample struct {
+	at      time.Time
+	latency time.Duration
+	failed  bool
+}
+
+// sampleRing is a bounded ring buffer of recent samples, not safe for concurrent use
+type sampleRing struct {
+	samples []sample
+	next    int
+}
+
+func newSampleRing() sampleRing {
+	return sampleRing{samples: make([]sample, 0, budgetSampleCapacity)}
+}
+
+// add records smp, overwriting the oldest sample when full
+func (s *sampleRing) add(smp sample) {
+	if len(s.samples) < budgetSampleCapacity {
+		s.samples = append(s.samples, smp)
+		return
+	}
+	s.samples[s.next] = smp
+	s.next = (s.next + 1) % budgetSampleCapacity
+}
+
+// reset drops all samples
+func (s *sampleRing) reset() {
+	s.samples = s.samples[:0]
+	s.next = 0
+}
+
+// stats returns number of requests, error rate and latency at percentile p
+// of samples newer than since
+func (s *sampleRing) stats(since time.Time, p float64) (int, float64, time.Duration) {
+	var failed int
+	latencies := make([]time.Duration, 0, len(s.samples))
+	for _, smp := range s.samples {
+		if smp.at.Before(since) {
+			continue
+		}
+		if smp.failed {
+			failed++
+		}
+		latencies = append(latencies, smp.latency)
+	}
+	n := len(latencies)
+	if n == 0 {
+		return 0, 0, 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	idx := int(math.Ceil(p*float64(n))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return n, float64(failed) / float64(n), latencies[idx]
+}
@@ -0,0 +1,162 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetWriteLatencyBudget(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	if err = db.SetWriteLatencyBudget(&WriteLatencyBudget{}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrInvalidConfig)
+	}
+	if actual := db.WriteLatency(); actual != (WriteLatencyStatus{}) {
+		t.Errorf("actual status: %+v, expected zero value without budget", actual)
+	}
+
+	var mu sync.Mutex
+	var events []Event
+	db.OnEvent(func(e Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+	budget := &WriteLatencyBudget{MaxLatency: time.Millisecond, MinRequests: 2, Window: 100 * time.Millisecond, ShiftReads: true}
+	if err = db.SetWriteLatencyBudget(budget); err != nil {
+		t.Fatalf("error %s when SetWriteLatencyBudget", err)
+	}
+	cfg := db.RuntimeConfig()
+	cfg.ReadPercentage = 0
+	if err = db.Reconfigure(cfg); err != nil {
+		t.Fatalf("error %s when Reconfigure", err)
+	}
+
+	// slow writes breach the budget
+	for i := 0; i < 2; i++ {
+		p.mock.ExpectExec("insert into mytable").WillDelayFor(5 * time.Millisecond).WillReturnResult(sqlmock.NewResult(1, 1))
+		if _, err = db.ExecContext(context.Background(), fmt.Sprintf(insertQueryTmpl, "values (1, '1')")); err != nil {
+			t.Fatalf("error %s when ExecContext", err)
+		}
+	}
+	if actual := db.WriteLatency(); !actual.Breached || actual.Requests != 2 || actual.Latency < 5*time.Millisecond {
+		t.Errorf("actual status: %+v, expected breached by 2 slow writes", actual)
+	}
+
+	// reads are shifted to read replicas despite ReadPercentage
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	rows, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+
+	// a fast write after the window recovers
+	time.Sleep(budget.Window)
+	p.mock.ExpectExec("insert into mytable").WillReturnResult(sqlmock.NewResult(1, 1))
+	if _, err = db.ExecContext(context.Background(), fmt.Sprintf(insertQueryTmpl, "values (1, '1')")); err != nil {
+		t.Fatalf("error %s when ExecContext", err)
+	}
+	if actual := db.WriteLatency(); actual.Breached || !actual.Since.IsZero() {
+		t.Errorf("actual status: %+v, expected recovered", actual)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []EventType{EventConfigChanged, EventWriteBudgetBreached, EventWriteBudgetRecovered}
+	if len(events) != len(expected) {
+		t.Fatalf("actual events: %+v, expected: %v", events, expected)
+	}
+	for i, e := range events {
+		if e.Type != expected[i] {
+			t.Errorf("actual event: %s, expected: %s", e.Type, expected[i])
+		}
+	}
+	if !errors.Is(events[1].Err, ErrWriteLatencyBudget) || events[1].Target.Role != RolePrimary {
+		t.Errorf("actual event: %+v, expected primary with err %s", events[1], ErrWriteLatencyBudget)
+	}
+
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWriteLatencyBudgetSustain(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	if err = db.SetWriteLatencyBudget(&WriteLatencyBudget{MaxLatency: time.Millisecond, MinRequests: 1, Sustain: 20 * time.Millisecond}); err != nil {
+		t.Fatalf("error %s when SetWriteLatencyBudget", err)
+	}
+
+	start := time.Now().Add(-5 * time.Millisecond)
+	db.observeWrite(start)
+	if actual := db.WriteLatency(); actual.Breached || actual.Since.IsZero() {
+		t.Errorf("actual status: %+v, expected breaching but not breached within Sustain", actual)
+	}
+	time.Sleep(20 * time.Millisecond)
+	db.observeWrite(start)
+	if actual := db.WriteLatency(); !actual.Breached {
+		t.Errorf("actual status: %+v, expected breached after Sustain", actual)
+	}
+}
+
+func TestSampleRingStats(t *testing.T) {
+	now := time.Now()
+	ring := newSampleRing()
+	ring.add(sample{at: now.Add(-time.Hour), latency: time.Hour, failed: true})
+	for i := 1; i <= 100; i++ {
+		ring.add(sample{at: now, latency: time.Duration(i) * time.Millisecond, failed: i%4 == 0})
+	}
+
+	n, errorRate, latency := ring.stats(now.Add(-time.Minute), 0.99)
+	if n != 100 {
+		t.Errorf("actual n: %d, expected: 100", n)
+	}
+	if errorRate != 0.25 {
+		t.Errorf("actual error rate: %f, expected: 0.25", errorRate)
+	}
+	if latency != 99*time.Millisecond {
+		t.Errorf("actual latency: %s, expected: 99ms", latency)
+	}
+}
+
+func TestSampleRingBuffer(t *testing.T) {
+	ring := newSampleRing()
+	now := time.Now()
+	for i := 0; i < budgetSampleCapacity+10; i++ {
+		ring.add(sample{at: now})
+	}
+	if len(ring.samples) != budgetSampleCapacity {
+		t.Errorf("actual samples: %d, expected: %d", len(ring.samples), budgetSampleCapacity)
+	}
+	ring.reset()
+	if n, _, _ := ring.stats(time.Time{}, 0.99); n != 0 {
+		t.Errorf("actual n after reset: %d, expected: 0", n)
+	}
+}
@@ -0,0 +1,156 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// defaultQueryCaptureCapacity is the number of statements kept by `QueryCapture` by default
+const defaultQueryCaptureCapacity = 100
+
+// QueryCapture captures statements of interest with SQL and args into a bounded in-memory buffer,
+// read by `CapturedStatements()`, to debug production issues without logging all statements.
+// A statement is captured if its digest (see `QueryDigest()`) is in `Digests`, or it takes `MinDuration` or longer.
+// Each attempt of a statement is captured on its own, as hooks are called.
+//
+// Zero values of `SampleRate` and `Capacity` mean defaults.
+type QueryCapture struct {
+	// Digests are digests of statements to capture, or statements to take digests of
+	Digests []string
+
+	// MinDuration captures statements taking it or longer, none by duration if zero
+	MinDuration time.Duration
+
+	// SampleRate is the fraction (0.0 ~ 1.0) of matching statements captured. Default to 1.0.
+	SampleRate float64
+
+	// Capacity is the maximum number of statements kept, the oldest are dropped. Default to 100.
+	Capacity int
+
+	// Scrub returns args of query to be kept, e.g. with personal data redacted by `ArgRedactor.Redact`,
+	// after the Redactor set by `SetRedactor()` if any. Args must not be modified in place.
+	// If nil, args are kept as redacted by the Redactor, or not kept at all if no Redactor is set.
+	Scrub func(query string, args []interface{}) []interface{}
+}
+
+// CapturedStatement is a statement captured by `QueryCapture`
+type CapturedStatement struct {
+	// Time is when the statement returned
+	Time time.Time
+
+	// Digest is the digest of the query, see `QueryDigest()`
+	Digest string
+
+	// StatementInfo is the statement as `Hook.AfterStatement()` receives, with Args scrubbed by `QueryCapture.Scrub`
+	StatementInfo
+}
+
+// QueryDigest returns the digest of query used by `QueryCapture` and `CostGuard`: the query with literals and
+// placeholders replaced by `?`, lists of them collapsed, comments removed, spaces collapsed and words lower-cased,
+// e.g. `select * from users where id in (?)` of `SELECT * FROM users WHERE id IN (1, 2, 3)`
+func QueryDigest(query string) string {
+	return queryDigest(query)
+}
+
+// queryCapture holds a QueryCapture with its buffer of captured statements
+type queryCapture struct {
+	capture QueryCapture
+	digests map[string]struct{}
+
+	mu         sync.Mutex
+	statements []CapturedStatement
+	next       int
+}
+
+// SetQueryCapture starts capturing statements by c, discarding statements captured before.
+// Passing nil stops capturing, which is the default.
+// It returns an error wrapping `ErrInvalidConfig` if neither `Digests` nor `MinDuration` is set,
+// or `SampleRate` is out of 0.0 ~ 1.0.
+func (db *DB) SetQueryCapture(c *QueryCapture) error {
+	var qc *queryCapture
+	if c != nil {
+		copied := *c
+		if copied.SampleRate == 0 {
+			copied.SampleRate = 1
+		}
+		if copied.Capacity <= 0 {
+			copied.Capacity = defaultQueryCaptureCapacity
+		}
+		if len(copied.Digests) == 0 && copied.MinDuration <= 0 {
+			return fmt.Errorf("%w: query capture has neither digests nor min duration", ErrInvalidConfig)
+		}
+		if copied.SampleRate < 0 || copied.SampleRate > 1 {
+			return fmt.Errorf("%w: query capture sample rate %f is out of 0.0 ~ 1.0", ErrInvalidConfig, copied.SampleRate)
+		}
+		qc = &queryCapture{capture: copied, digests: make(map[string]struct{}, len(copied.Digests))}
+		for _, d := range copied.Digests {
+			qc.digests[queryDigest(d)] = empty
+		}
+	}
+	db.configMutex.Lock()
+	db.queryCapture = qc
+	db.configMutex.Unlock()
+	return nil
+}
+
+// CapturedStatements returns statements captured by `QueryCapture`, newest first, nil if not capturing
+func (db *DB) CapturedStatements() []CapturedStatement {
+	db.configMutex.RLock()
+	qc := db.queryCapture
+	db.configMutex.RUnlock()
+	if qc == nil {
+		return nil
+	}
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	n := len(qc.statements)
+	statements := make([]CapturedStatement, 0, n)
+	for i := 1; i <= n; i++ {
+		statements = append(statements, qc.statements[(qc.next-i+n)%n])
+	}
+	return statements
+}
+
+// captureStatement captures info returned from a statement if it matches `QueryCapture`
+func (db *DB) captureStatement(info StatementInfo) {
+	db.configMutex.RLock()
+	qc := db.queryCapture
+	db.configMutex.RUnlock()
+	if qc == nil || info.Query == "" {
+		return
+	}
+	c := qc.capture
+	slow := c.MinDuration > 0 && info.Duration >= c.MinDuration
+	if !slow && len(qc.digests) == 0 {
+		return
+	}
+	digest := queryDigest(info.Query)
+	if _, ok := qc.digests[digest]; !ok && !slow {
+		return
+	}
+	if c.SampleRate < 1 && rand.Float64() >= c.SampleRate {
+		return
+	}
+	switch {
+	case c.Scrub != nil && len(info.Args) > 0:
+		info.Args = c.Scrub(info.Query, info.Args)
+	case c.Scrub == nil && !db.redacting():
+		info.Args = nil
+	}
+	qc.add(CapturedStatement{Time: time.Now(), Digest: digest, StatementInfo: info})
+}
+
+// add keeps s, overwriting the oldest statement when full
+func (qc *queryCapture) add(s CapturedStatement) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	if len(qc.statements) < qc.capture.Capacity {
+		qc.statements = append(qc.statements, s)
+		qc.next = len(qc.statements) % qc.capture.Capacity
+		return
+	}
+	qc.statements[qc.next] = s
+	qc.next = (qc.next + 1) % qc.capture.Capacity
+}
@@ -0,0 +1,89 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetQueryCapture(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	invalid := []*QueryCapture{
+		{},
+		{MinDuration: time.Second, SampleRate: 1.5},
+	}
+	for _, c := range invalid {
+		if err = db.SetQueryCapture(c); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("actual err: %v, expected: %s of %+v", err, ErrInvalidConfig, c)
+		}
+	}
+	if actual := db.CapturedStatements(); actual != nil {
+		t.Errorf("actual captured: %+v, expected none before capturing", actual)
+	}
+
+	err = db.SetQueryCapture(&QueryCapture{
+		Digests:     []string{"SELECT name FROM users WHERE id = 1"},
+		MinDuration: 50 * time.Millisecond,
+		Capacity:    2,
+		Scrub: func(query string, args []interface{}) []interface{} {
+			return []interface{}{"redacted"}
+		},
+	})
+	if err != nil {
+		t.Fatalf("error %s when SetQueryCapture", err)
+	}
+	tests := []struct {
+		query    string
+		args     []interface{}
+		delay    time.Duration
+		captured bool
+	}{
+		{"SELECT name FROM users WHERE id = ?", []interface{}{1}, 0, true},
+		{"SELECT name FROM orders WHERE id = ?", []interface{}{2}, 0, false},
+		{"select name from users where id = ?", []interface{}{3}, 0, true},
+		{"SELECT name FROM orders", nil, 60 * time.Millisecond, true},
+	}
+	var expected []string
+	for _, test := range tests {
+		r1.mock.ExpectQuery("(?i)SELECT (.+)").WillDelayFor(test.delay).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("a"))
+		var name string
+		if err = db.QueryRowContext(context.Background(), test.query, test.args...).Scan(&name); err != nil {
+			t.Fatalf("error %s when QueryRowContext of %q", err, test.query)
+		}
+		if test.captured {
+			expected = append([]string{test.query}, expected...)
+		}
+	}
+
+	captured := db.CapturedStatements()
+	if len(captured) != 2 || captured[0].Query != expected[0] || captured[1].Query != expected[1] {
+		t.Fatalf("actual captured: %+v, expected newest 2 of %v", captured, expected)
+	}
+	if captured[0].Args != nil || captured[0].Duration < 50*time.Millisecond || captured[0].Target.Role != RoleReplica {
+		t.Errorf("actual captured: %+v, expected slow statement on read replica without args", captured[0])
+	}
+	if !reflect.DeepEqual(captured[1].Args, []interface{}{"redacted"}) || captured[1].Digest != "select name from users where id = ?" {
+		t.Errorf("actual args: %v, digest: %q, expected scrubbed args of the digest", captured[1].Args, captured[1].Digest)
+	}
+
+	if err = db.SetQueryCapture(nil); err != nil || db.CapturedStatements() != nil {
+		t.Errorf("actual err: %v, captured: %+v, expected none after stopping", err, db.CapturedStatements())
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,206 @@
+package gosqlrwdb
+
+// This file implements the default SQL classifier used by `IsQuerySqlFunc`.
+// It works on bytes and never panics on arbitrary input: multi-byte runes are treated as
+// identifier characters, and unterminated comments or literals simply run to the end of query.
+//
+// Where SQL flavors disagree (nested comments, `#` comments, MySQL `/*! */` executable comments),
+// the classifier takes the interpretation that routes to primary DB.
+
+// StripLeadingNoise returns query without leading whitespace, comments and opening parentheses,
+// the same normalized view of SQL as routing of this package sees, for custom classifiers, routers and guards.
+// MySQL `/*! */` executable comments are kept as they are executed.
+func StripLeadingNoise(query string) string {
+	i := 0
+	for i < len(query) {
+		switch c := query[i]; {
+		case isSpace(c) || c == '(':
+			i++
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			i = skipLineComment(query, i+2)
+		case c == '#':
+			i = skipLineComment(query, i+1)
+		case c == '/' && i+1 < len(query) && query[i+1] == '*' && !isExecutableComment(query, i):
+			i = skipBlockComment(query, i+2)
+		default:
+			return query[i:]
+		}
+	}
+	return ""
+}
+
+// isReadQuery returns true if query is a read-only statement:
+// a SELECT, or a WITH whose statements are all SELECT,
+// without locking clause (`FOR UPDATE` / `FOR SHARE` ...) and without `INTO`.
+// `EXPLAIN` statements are read-only by `ExplainPolicy`.
+func isReadQuery(query string) bool {
+	tokens := keywords(StripLeadingNoise(query))
+	if statement, analyze, ok := explainedStatement(tokens); ok {
+		return ExplainPolicy != ExplainToPrimary && (!analyze || isReadTokens(statement))
+	}
+	return isReadTokens(tokens)
+}
+
+// isReadTokens returns true if keywords of a statement in tokens are read-only, see `isReadQuery()`
+func isReadTokens(tokens []string) bool {
+	if len(tokens) == 0 || (tokens[0] != "select" && tokens[0] != "with") {
+		return false
+	}
+	for i, t := range tokens {
+		switch t {
+		case "insert", "update", "delete", "merge", "into", "truncate", "drop", "create", "alter":
+			// data-modifying CTE, `SELECT INTO`, or a locking clause ending with UPDATE
+			return false
+		case "for":
+			// `FOR UPDATE` / `FOR SHARE` / `FOR NO KEY UPDATE` / `FOR KEY SHARE` locks rows on primary
+			if i+1 < len(tokens) {
+				switch tokens[i+1] {
+				case "update", "share", "no", "key":
+					return false
+				}
+			}
+		case "lock":
+			// MySQL `LOCK IN SHARE MODE`
+			if i+1 < len(tokens) && tokens[i+1] == "in" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// keywords returns lower-cased words of query outside comments, literals and quoted identifiers
+func keywords(query string) []string {
+	var words []string
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == '-' && i+2 < len(query) && query[i+1] == '-' && isSpace(query[i+2]):
+			i = skipLineComment(query, i+2)
+		case c == '/' && i+1 < len(query) && query[i+1] == '*' && !isExecutableComment(query, i):
+			i = skipBlockComment(query, i+2)
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(query, i+1, c)
+		case c == '$':
+			i = skipDollarQuoted(query, i)
+		case (c == ':' || c == '@') && isNamedPlaceholder(query, i) && (i == 0 || query[i-1] != c):
+			// named placeholder such as `:update` is not a keyword
+			i = skipNamedPlaceholder(query, i)
+		case isWordByte(c):
+			start := i
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			words = append(words, toLowerASCII(query[start:i]))
+		default:
+			i++
+		}
+	}
+	return words
+}
+
+// skipLineComment returns index after the line comment whose body starts at i
+func skipLineComment(query string, i int) int {
+	for i < len(query) && query[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// skipBlockComment returns index after the block comment whose body starts at i.
+// Nested comments are not supported, so that a nested `*/` never hides following SQL.
+func skipBlockComment(query string, i int) int {
+	for i+1 < len(query) {
+		if query[i] == '*' && query[i+1] == '/' {
+			return i + 2
+		}
+		i++
+	}
+	return len(query)
+}
+
+// isExecutableComment returns true if the block comment starting at i is a MySQL `/*! */` comment,
+// whose body is executed by MySQL
+func isExecutableComment(query string, i int) bool {
+	return i+2 < len(query) && query[i+2] == '!'
+}
+
+// skipQuoted returns index after the literal or quoted identifier quoted by q whose body starts at i.
+// Both doubled quotes and backslash escapes are skipped.
+func skipQuoted(query string, i int, q byte) int {
+	for i < len(query) {
+		switch query[i] {
+		case '\\':
+			i += 2
+		case q:
+			if i+1 < len(query) && query[i+1] == q {
+				i += 2
+				continue
+			}
+			return i + 1
+		default:
+			i++
+		}
+	}
+	return len(query)
+}
+
+// skipDollarQuoted returns index after the Postgres dollar-quoted literal starting at i,
+// or i+1 if it is not a dollar quote (e.g. a `$1` placeholder)
+func skipDollarQuoted(query string, i int) int {
+	end := i + 1
+	for end < len(query) && query[end] != '$' {
+		if c := query[end]; !isWordByte(c) || (c >= '0' && c <= '9' && end == i+1) {
+			return i + 1
+		}
+		end++
+	}
+	if end >= len(query) {
+		return i + 1
+	}
+	tag := query[i : end+1]
+	for j := end + 1; j+len(tag) <= len(query); j++ {
+		if query[j:j+len(tag)] == tag {
+			return j + len(tag)
+		}
+	}
+	return len(query)
+}
+
+// isNamedPlaceholder returns true if query[i] (`:` or `@`) starts a named placeholder such as `:name` or `@name`
+func isNamedPlaceholder(query string, i int) bool {
+	if i+1 >= len(query) {
+		return false
+	}
+	c := query[i+1]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// skipNamedPlaceholder returns index after the named placeholder starting at i
+func skipNamedPlaceholder(query string, i int) int {
+	i++
+	for i < len(query) && isWordByte(query[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v' || c == 0
+}
+
+// isWordByte returns true for ASCII letters, digits, underscore and any byte of multi-byte runes
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
+
+func toLowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,41 @@
+//go:build go1.18
+// +build go1.18
+
+package gosqlrwdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzIsReadQuery(f *testing.F) {
+	seeds := []string{
+		"select * from mytable",
+		"/* c */ select 1",
+		"with t as (delete from x returning *) select * from t",
+		"select $a$ for update $a$",
+		"select 'it''s' from t for share",
+		"select 1 /*! for update */",
+		"-- c\n# c\nselect 1",
+		"sélect 1",
+		"select \x00 1",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, query string) {
+		read := isReadQuery(query)
+		if read != isReadQuery(query) {
+			t.Fatalf("classification is not deterministic, query = %q", query)
+		}
+
+		stripped := StripLeadingNoise(query)
+		if !strings.HasSuffix(query, stripped) {
+			t.Fatalf("stripped %q is not a suffix of query %q", stripped, query)
+		}
+		if actual := isReadQuery(" \n/* noise */ " + query); actual != read {
+			t.Fatalf("leading noise changes classification: %t, expected %t, query = %q", actual, read, query)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package gosqlrwdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripLeadingNoise(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"select 1", "select 1"},
+		{"  \t\n select 1", "select 1"},
+		{"-- comment\nselect 1", "select 1"},
+		{"# comment\nselect 1", "select 1"},
+		{"/* comment */ select 1", "select 1"},
+		{"/* a */ -- b\n ( (select 1))", "select 1))"},
+		{"/*!40101 select 1 */", "/*!40101 select 1 */"},
+		{"/* unterminated", ""},
+		{"-- only comment", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if actual := StripLeadingNoise(test.query); actual != test.expected {
+			t.Errorf("actual = %q, expected = %q, query = %q", actual, test.expected, test.query)
+		}
+	}
+}
+
+func TestIsReadQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{"select * from mytable", true},
+		{"SELECT * FROM mytable", true},
+		{"  /* hint */ select 1", true},
+		{"(select 1) union (select 2)", true},
+		{"with t as (select 1) select * from t", true},
+		{"select 'delete' from mytable", true},
+		{"select \"update\" from mytable", true},
+		{"select $tag$ insert into $tag$", true},
+		{"select * from mytable where id = $1", true},
+		{"select update_time from mytable", true},
+		{"select 1 -- for update", true},
+		{"select * from mytable where a = :update and b = @delete", true},
+		{"select id::text from mytable for update", false},
+		{"selecté from mytable", false},
+		{"select * from mytable for update", false},
+		{"select * from mytable for no key update", false},
+		{"select * from mytable for share", false},
+		{"select * from mytable lock in share mode", false},
+		{"select * into newtable from mytable", false},
+		{"with t as (delete from mytable returning *) select * from t", false},
+		{"select 1 /*! for update */", false},
+		{"select 1 /* /* */ for update */", false},
+		{"select 1 --1 for update", false},
+		{"insert into mytable values (1, 1)", false},
+		{"update mytable set column2 = 2 where column1 = 1", false},
+		{"delete from mytable where column1 = 1", false},
+		{"sel", false},
+		{"", false},
+		{"\x00select 1", true},
+		{"select '\\", true},
+	}
+
+	for _, test := range tests {
+		if actual := isReadQuery(test.query); actual != test.expected {
+			t.Errorf("actual = %t, expected = %t, query = %q", actual, test.expected, test.query)
+		}
+	}
+}
+
+func TestIsReadQueryGiganticComment(t *testing.T) {
+	query := "/*" + strings.Repeat("x", 1<<20) + "*/ select 1"
+	if !isReadQuery(query) {
+		t.Errorf("query after gigantic comment should be read")
+	}
+}
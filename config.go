@@ -0,0 +1,91 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// RuntimeConfig is the configuration of a `DB` that can be changed at runtime by `Reconfigure()`
+type RuntimeConfig struct {
+	// HeartbeatInterval is the interval of health checks, `DefaultReplicaAutoFailoverInterval` at `New()`.
+	// It is ignored if health checks are disabled by `DisableReplicaAutoFailover`.
+	HeartbeatInterval time.Duration
+
+	// Balancer is the Balancer used to select read replica, Round-Robin if nil
+	Balancer Balancer
+
+	// FallbackPolicy is the FallbackPolicy of reads on read replicas, errors are returned as-is if nil
+	FallbackPolicy *FallbackPolicy
+
+	// ReadPercentage is the percentage (0 ~ 100) of reads routed to read replicas,
+	// the rest are routed to primary DB. Default to 100.
+	// It is ignored while `WriteLatencyBudget` with `ShiftReads` is breached, and overridden by `FlagReadPercentage`.
+	ReadPercentage int
+}
+
+// RuntimeConfig returns current RuntimeConfig of db.
+// Change fields of the returned value and pass it to `Reconfigure()` to update some of them.
+func (db *DB) RuntimeConfig() RuntimeConfig {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return RuntimeConfig{
+		HeartbeatInterval: db.heartbeatInterval,
+		Balancer:          db.balancer,
+		FallbackPolicy:    db.fallbackPolicy,
+		ReadPercentage:    db.readPercentage,
+	}
+}
+
+// Reconfigure applies cfg at once, so that concurrent reads never see part of it,
+// and emits `EventConfigChanged`. The heartbeat is restarted if `HeartbeatInterval` is changed.
+// It returns an error wrapping `ErrInvalidConfig` without changing anything if cfg is invalid.
+func (db *DB) Reconfigure(cfg RuntimeConfig) error {
+	if cfg.HeartbeatInterval <= 0 {
+		return fmt.Errorf("%w: heartbeat interval %s is not positive", ErrInvalidConfig, cfg.HeartbeatInterval)
+	}
+	if cfg.ReadPercentage < 0 || cfg.ReadPercentage > 100 {
+		return fmt.Errorf("%w: read percentage %d is out of 0 ~ 100", ErrInvalidConfig, cfg.ReadPercentage)
+	}
+
+	// closeMutex serializes Reconfigure() and guards the heartbeater against Close()
+	db.closeMutex.Lock()
+	db.configMutex.Lock()
+	restart := cfg.HeartbeatInterval != db.heartbeatInterval
+	db.heartbeatInterval = cfg.HeartbeatInterval
+	db.balancer = cfg.Balancer
+	db.fallbackPolicy = cfg.FallbackPolicy
+	db.readPercentage = cfg.ReadPercentage
+	db.configMutex.Unlock()
+	if restart && db.heartbeater != nil && !db.closed {
+		db.heartbeater.Stop()
+		db.heartbeater = db.startHealthHeartbeater(cfg.HeartbeatInterval)
+	}
+	db.closeMutex.Unlock()
+
+	db.debugf(DebugEvent, "[Reconfigure] config: %+v", cfg)
+	db.emit(Event{Type: EventConfigChanged})
+	return nil
+}
+
+// replicaReadPercentage returns current percentage of reads routed to read replicas,
+// overridden by `FlagReadPercentage`
+func (db *DB) replicaReadPercentage() int {
+	db.configMutex.RLock()
+	percentage := db.readPercentage
+	db.configMutex.RUnlock()
+	percentage = db.intFlag(FlagReadPercentage, percentage)
+	switch {
+	case percentage < 0:
+		return 0
+	case percentage > 100:
+		return 100
+	}
+	return percentage
+}
+
+// readOnPrimary returns true if a read should be routed to primary DB by `RuntimeConfig.ReadPercentage`
+func (db *DB) readOnPrimary() bool {
+	percentage := db.replicaReadPercentage()
+	return percentage < 100 && db.primaryAvailable() && !db.shiftReads() && rand.Intn(100) >= percentage
+}
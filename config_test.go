@@ -0,0 +1,82 @@
+package gosqlrwdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReconfigure(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	p.mock.ExpectPing()
+	r.mock.ExpectPing()
+	db := New(p.db, r.db)
+	defer db.Close()
+
+	var events []Event
+	db.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+
+	cfg := db.RuntimeConfig()
+	if cfg.HeartbeatInterval != DefaultReplicaAutoFailoverInterval || cfg.Balancer != nil ||
+		cfg.FallbackPolicy != nil || cfg.ReadPercentage != 100 {
+		t.Errorf("actual default config: %+v", cfg)
+	}
+
+	invalids := []RuntimeConfig{
+		{HeartbeatInterval: 0, ReadPercentage: 100},
+		{HeartbeatInterval: time.Second, ReadPercentage: -1},
+		{HeartbeatInterval: time.Second, ReadPercentage: 101},
+	}
+	for _, invalid := range invalids {
+		if err = db.Reconfigure(invalid); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("actual err: %v, expected: %s, config: %+v", err, ErrInvalidConfig, invalid)
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("actual events: %+v, expected: none", events)
+	}
+
+	expected := RuntimeConfig{
+		HeartbeatInterval: time.Hour,
+		Balancer:          &RoundRobinBalancer{},
+		FallbackPolicy:    &FallbackPolicy{},
+		ReadPercentage:    0,
+	}
+	if err = db.Reconfigure(expected); err != nil {
+		t.Fatalf("error %s when Reconfigure", err)
+	}
+	if actual := db.RuntimeConfig(); actual != expected {
+		t.Errorf("actual config: %+v, expected: %+v", actual, expected)
+	}
+	if len(events) != 1 || events[0].Type != EventConfigChanged {
+		t.Errorf("actual events: %+v, expected: %s", events, EventConfigChanged)
+	}
+	if db.heartbeater.interval != time.Hour {
+		t.Errorf("actual heartbeat interval: %s, expected: %s", db.heartbeater.interval, time.Hour)
+	}
+
+	// all reads are routed to primary DB with ReadPercentage 0
+	p.mock.ExpectQuery("^select 1$").WillReturnRows(p.mock.NewRows([]string{"1"}).AddRow(1))
+	rows, err := db.Query("select 1")
+	if err != nil {
+		t.Fatalf("error %s when Query", err)
+	}
+	rows.Close()
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -2,51 +2,391 @@ package gosqlrwdb
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
+// Context keys of routing, each holding a single value.
+//
+// Deprecated: values set directly by these keys (except `ContextInTxKey`) are read only from contexts without `RoutingDirective`,
+// use `WithDirective()` or the helpers such as `WithPrimary()` instead.
 const (
 	// ContextUsePrimaryKey is the context key for using primary DB in below methods:
 	// `QueryContext()` / `QueryRowContext()` / `PrepareContext()`
 	ContextUsePrimaryKey contextKey = 0
 
-	// ContextUseReplicaKey is the context key for using read replica DB in below methods:
-	//
-	// Comment out as seems no use case for now
-	// ContextUseReplicaKey contextKey = 0
+	// ContextExactReplicaOrderKey is the context key for selecting read replica with pure Round-Robin,
+	// ignoring unavailable & evicted read replicas, in below methods:
+	// `QueryContext()` / `QueryRowContext()` / `PrepareContext()`
+	ContextExactReplicaOrderKey contextKey = 1
+
+	// ContextStatementIDKey is the context key for the statement ID propagated to hooks, logs, SQL comments & errors
+	ContextStatementIDKey contextKey = 2
+
+	// ContextExcludeReplicasKey is the context key for names of read replicas not to be used in below methods:
+	// `QueryContext()` / `QueryRowContext()` / `PrepareContext()` / `SelectReplica()`
+	ContextExcludeReplicasKey contextKey = 3
+
+	// ContextRoutingKeyKey is the context key for the routing key used by `ConsistentHashBalancer`
+	ContextRoutingKeyKey contextKey = 4
+
+	// ContextTxOptionsKey is the context key for default `*sql.TxOptions` of transactions begun by `BeginTx()`
+	ContextTxOptionsKey contextKey = 5
+
+	// ContextInTxKey is the context key marking contexts passed to closures of `RunInTx()`
+	ContextInTxKey contextKey = 6
+
+	// ContextWorkloadKey is the context key for the workload of statements limited by `WorkloadPolicy`
+	ContextWorkloadKey contextKey = 7
+
+	// ContextSingleflightKey is the context key for coalescing identical concurrent reads, see `WithSingleflight()`
+	ContextSingleflightKey contextKey = 8
+
+	// ContextMaxAttemptsKey is the context key for the maximum number of attempts of a statement,
+	// see `WithMaxAttempts()`
+	ContextMaxAttemptsKey contextKey = 9
 )
 
 var emptyContextValue = struct{}{}
 
-// WithPrimary return a copy of ctx with `ContextUsePrimaryKey` has value
+// directiveKey is the context key of RoutingDirective
+type directiveKey struct{}
+
+// RoutingDirective is how statements run with a context are routed, set by `WithDirective()` under a single context key,
+// so that it never collides with keys of other packages. Zero value routes as usual.
+// Helpers such as `WithPrimary()` change one field of the directive in ctx.
+type RoutingDirective struct {
+	// ForcePrimary routes reads to primary DB in `QueryContext()` / `QueryRowContext()` / `PrepareContext()`
+	ForcePrimary bool
+
+	// ForceReplica routes statements not classified as reads (e.g. vendor-specific read syntax or read-only
+	// stored procedures) to read replicas in `QueryContext()` / `QueryRowContext()` / `PrepareContext()` /
+	// `ScatterQuery()`, see `WithReplica()`
+	ForceReplica bool
+
+	// ExactReplicaOrder selects read replica with pure Round-Robin, ignoring unavailable & evicted read replicas,
+	// see `WithExactReplicaOrder()`
+	ExactReplicaOrder bool
+
+	// StatementID is the statement ID propagated to hooks, logs, SQL comments & errors, generated if empty
+	StatementID string
+
+	// ExcludeReplicas is names of read replicas not to be used, see `WithExcludeReplicas()`
+	ExcludeReplicas []string
+
+	// RoutingKey is the routing key used by `ConsistentHashBalancer`, none if empty
+	RoutingKey string
+
+	// Group is the group (see `TargetInfo.Group`) of read replicas to be used, all read replicas if empty.
+	// Read replicas of other groups are skipped as excluded.
+	Group string
+
+	// MaxStaleness skips read replicas whose replication lag measured by `DialectReadinessCheck` exceeds it,
+	// as excluded. Read replicas of unknown lag are used. No limit if zero.
+	MaxStaleness time.Duration
+
+	// TxOptions is the default options of transactions begun by `BeginTx()`, see `WithTxOptions()`
+	TxOptions *sql.TxOptions
+
+	// Workload is the workload of statements limited by `WorkloadPolicy`
+	Workload string
+
+	// Singleflight coalesces identical concurrent reads, see `WithSingleflight()`
+	Singleflight bool
+
+	// Schema is the database or schema of unqualified tables of statements, whose read replicas are used
+	// by `SetSchemaGroups()`, see `WithSchema()`
+	Schema string
+
+	// Partition is the partition (shard) of statements routed by `PartitionRouter`, see `WithPartition()`
+	Partition string
+
+	// MaxAttempts is the maximum number of attempts of a statement, see `WithMaxAttempts()`. No override if not positive.
+	MaxAttempts int
+
+	// FreshnessAssert runs reads on read replicas on primary DB as well to report mismatches,
+	// see `WithFreshnessAssert()`
+	FreshnessAssert bool
+
+	// SessionToken identifies the session (e.g. a user) whose single-row reads after its writes are retried
+	// on primary DB by `SetStaleReadRetry()` across contexts, see `WithSessionToken()`.
+	// Reads and writes are matched by their context if empty.
+	SessionToken string
+
+	// routingKeySet is true if RoutingKey is set by `WithRoutingKey()`, even if empty
+	routingKeySet bool
+
+	// pinned is true if ForcePrimary is set as the query reads a table set by `SetPrimaryTables()`
+	pinned bool
+
+	// tables are tables read by the query, set only if any read replica is of `ReplicationLogical`
+	tables []string
+
+	// schemaGroups are groups of read replicas of schemas read by the query, by `SetSchemaGroups()`
+	schemaGroups []string
+}
+
+// WithDirective return a copy of ctx with d, replacing the directive in ctx.
+// Change the directive of `DirectiveFromContext()` to keep other fields set before.
+func WithDirective(ctx context.Context, d RoutingDirective) context.Context {
+	// callers may append to their slice later
+	d.ExcludeReplicas = append([]string(nil), d.ExcludeReplicas...)
+	return context.WithValue(ctx, directiveKey{}, d)
+}
+
+// DirectiveFromContext returns the RoutingDirective set by `WithDirective()` or helpers such as `WithPrimary()`,
+// merged with values of deprecated `Context*Key` keys; otherwise returns zero value.
+// `ForcePrimary` and `ExactReplicaOrder` are set if set by either, and other fields of the directive
+// are filled by the keys only if zero, except `Singleflight` which may be cleared on purpose.
+func DirectiveFromContext(ctx context.Context) RoutingDirective {
+	legacy := legacyDirective(ctx)
+	d, ok := ctx.Value(directiveKey{}).(RoutingDirective)
+	if !ok {
+		return legacy
+	}
+	d.ForcePrimary = d.ForcePrimary || legacy.ForcePrimary
+	d.ExactReplicaOrder = d.ExactReplicaOrder || legacy.ExactReplicaOrder
+	if d.StatementID == "" {
+		d.StatementID = legacy.StatementID
+	}
+	if len(d.ExcludeReplicas) == 0 {
+		d.ExcludeReplicas = legacy.ExcludeReplicas
+	}
+	if !d.routingKeySet {
+		d.RoutingKey, d.routingKeySet = legacy.RoutingKey, legacy.routingKeySet
+	}
+	if d.TxOptions == nil {
+		d.TxOptions = legacy.TxOptions
+	}
+	if d.Workload == "" {
+		d.Workload = legacy.Workload
+	}
+	if d.MaxAttempts == 0 {
+		d.MaxAttempts = legacy.MaxAttempts
+	}
+	return d
+}
+
+// legacyDirective returns the RoutingDirective made of values of deprecated `Context*Key` keys
+func legacyDirective(ctx context.Context) RoutingDirective {
+	var d RoutingDirective
+	d.ForcePrimary = ctx.Value(ContextUsePrimaryKey) != nil
+	d.ExactReplicaOrder = ctx.Value(ContextExactReplicaOrderKey) != nil
+	d.StatementID, _ = ctx.Value(ContextStatementIDKey).(string)
+	d.ExcludeReplicas, _ = ctx.Value(ContextExcludeReplicasKey).([]string)
+	d.RoutingKey, d.routingKeySet = ctx.Value(ContextRoutingKeyKey).(string)
+	d.TxOptions, _ = ctx.Value(ContextTxOptionsKey).(*sql.TxOptions)
+	d.Workload, _ = ctx.Value(ContextWorkloadKey).(string)
+	d.Singleflight, _ = ctx.Value(ContextSingleflightKey).(bool)
+	d.MaxAttempts, _ = ctx.Value(ContextMaxAttemptsKey).(int)
+	return d
+}
+
+// withDirective return a copy of ctx with the directive in ctx changed by change
+func withDirective(ctx context.Context, change func(d *RoutingDirective)) context.Context {
+	d := DirectiveFromContext(ctx)
+	change(&d)
+	return context.WithValue(ctx, directiveKey{}, d)
+}
+
+// WithPrimary return a copy of ctx with `RoutingDirective.ForcePrimary`
 func WithPrimary(ctx context.Context) context.Context {
-	return context.WithValue(ctx, ContextUsePrimaryKey, emptyContextValue)
+	return withDirective(ctx, func(d *RoutingDirective) { d.ForcePrimary = true })
 }
 
-// context return a copy of ctx with `ContextUseReplicaKey` has value
-//
-// Comment out as seems no use case for now
-// func WithReplica(ctx context.Context) context.Context {
-// 	return context.WithValue(ctx, ContextUseReplicaKey, emptyContextValue)
-// }
+// WithExactReplicaOrder return a copy of ctx with `RoutingDirective.ExactReplicaOrder`,
+// so that read replica is selected with pure Round-Robin even if it is unavailable.
+// It is for operational tooling that needs to deliberately hit a "down" read replica.
+func WithExactReplicaOrder(ctx context.Context) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.ExactReplicaOrder = true })
+}
+
+// WithReplica return a copy of ctx with `RoutingDirective.ForceReplica`, so that statements the classifier
+// (`IsQuerySqlFunc` or `Dialect`) can't recognize as reads, e.g. `SHOW` or `CALL` of a read-only stored procedure,
+// are routed as reads to read replicas instead of failing with `ErrNotQuerySQL` or going to primary DB.
+// The statement must be read-only, as it is not checked. `WithPrimary()` takes precedence,
+// and `Exec()` / `ExecContext()` always use primary DB.
+func WithReplica(ctx context.Context) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.ForceReplica = true })
+}
 
-// UsePrimaryFromContext returns true if `ContextUsePrimaryKey` is set
-// (any non-nil value is ok, better to use struct{}{} as value as it does not use memory);
+// UsePrimaryFromContext returns true if `RoutingDirective.ForcePrimary` is set, e.g. by `WithPrimary()`;
 // otherwise returns false
 func UsePrimaryFromContext(ctx context.Context) bool {
-	if val := ctx.Value(ContextUsePrimaryKey); val != nil {
-		return true
-	}
-	return false
+	return DirectiveFromContext(ctx).ForcePrimary
 }
 
-// UseReplicaFromContext returns true if `ContextUseReplicaKey` is set
-// (any non-nil value is ok, better to use struct{}{} as value as it does not use memory);
+// UseReplicaFromContext returns true if `RoutingDirective.ForceReplica` is set, e.g. by `WithReplica()`;
 // otherwise returns false
-//
-// Comment out as seems no use case for now
-// func UseReplicaFromContext(ctx context.Context) bool {
-// 	if val := ctx.Value(ContextUseReplicaKey); val != nil {
-// 		return true
-// 	}
-// 	return false
-// }
+func UseReplicaFromContext(ctx context.Context) bool {
+	return DirectiveFromContext(ctx).ForceReplica
+}
+
+// ExactReplicaOrderFromContext returns true if `RoutingDirective.ExactReplicaOrder` is set,
+// e.g. by `WithExactReplicaOrder()`; otherwise returns false
+func ExactReplicaOrderFromContext(ctx context.Context) bool {
+	return DirectiveFromContext(ctx).ExactReplicaOrder
+}
+
+// WithStatementID return a copy of ctx with `RoutingDirective.StatementID` id,
+// so that statements are correlated by id instead of a generated one
+func WithStatementID(ctx context.Context, id string) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.StatementID = id })
+}
+
+// StatementIDFromContext returns the statement ID set by `WithStatementID()`; otherwise returns ""
+func StatementIDFromContext(ctx context.Context) string {
+	return DirectiveFromContext(ctx).StatementID
+}
+
+// WithExcludeReplicas return a copy of ctx with names added to `RoutingDirective.ExcludeReplicas`
+// (in addition to names already excluded in ctx), so that read replicas named as names
+// by `SetReplicaNames()` are not used, while the rest are selected as usual.
+// `ErrNoReplicaAvailable` is returned if no other read replica is available.
+func WithExcludeReplicas(ctx context.Context, names ...string) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) {
+		d.ExcludeReplicas = append(d.ExcludeReplicas[:len(d.ExcludeReplicas):len(d.ExcludeReplicas)], names...)
+	})
+}
+
+// ExcludeReplicasFromContext returns names of read replicas excluded by `WithExcludeReplicas()`; otherwise returns nil
+func ExcludeReplicasFromContext(ctx context.Context) []string {
+	return DirectiveFromContext(ctx).ExcludeReplicas
+}
+
+// WithRoutingKey return a copy of ctx with `RoutingDirective.RoutingKey` key,
+// so that reads with the same key (e.g. user ID) land on the same read replica with `ConsistentHashBalancer`
+func WithRoutingKey(ctx context.Context, key string) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) {
+		d.RoutingKey = key
+		d.routingKeySet = true
+	})
+}
+
+// RoutingKeyFromContext returns the routing key set by `WithRoutingKey()` and true; otherwise returns "" and false
+func RoutingKeyFromContext(ctx context.Context) (string, bool) {
+	d := DirectiveFromContext(ctx)
+	return d.RoutingKey, d.routingKeySet || d.RoutingKey != ""
+}
+
+// WithTxOptions return a copy of ctx with `RoutingDirective.TxOptions` opts,
+// so that transactions begun by `BeginTx()` with nil options use opts (isolation level & read-only flag).
+// It is for frameworks exposing only a context to code beginning transactions on their behalf.
+func WithTxOptions(ctx context.Context, opts *sql.TxOptions) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.TxOptions = opts })
+}
+
+// TxOptionsFromContext returns `*sql.TxOptions` set by `WithTxOptions()`; otherwise returns nil
+func TxOptionsFromContext(ctx context.Context) *sql.TxOptions {
+	return DirectiveFromContext(ctx).TxOptions
+}
+
+// WithWorkload return a copy of ctx with `RoutingDirective.Workload` name,
+// so that statements are limited by the pool of the workload in `WorkloadPolicy`
+func WithWorkload(ctx context.Context, name string) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.Workload = name })
+}
+
+// WorkloadFromContext returns the workload set by `WithWorkload()`; otherwise returns ""
+func WorkloadFromContext(ctx context.Context) string {
+	return DirectiveFromContext(ctx).Workload
+}
+
+// WithSingleflight return a copy of ctx with `RoutingDirective.Singleflight`,
+// so that identical concurrent reads (same query, args & routing directive) on read replicas are coalesced into a single execution
+// whose result is shared, in below methods:
+// `Query()` / `QueryContext()` / `QueryRow()` / `QueryRowContext()` / `QueryRows()` / `QueryRowsContext()`
+func WithSingleflight(ctx context.Context) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.Singleflight = true })
+}
+
+// SingleflightFromContext returns true if ctx is created by `WithSingleflight()`
+func SingleflightFromContext(ctx context.Context) bool {
+	return DirectiveFromContext(ctx).Singleflight
+}
+
+// WithSchema return a copy of ctx with `RoutingDirective.Schema` name, the database or schema of unqualified tables
+// (e.g. the current database of connections), so that reads are routed to read replicas of its group
+// set by `SetSchemaGroups()`
+func WithSchema(ctx context.Context, name string) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.Schema = name })
+}
+
+// SchemaFromContext returns the schema set by `WithSchema()`; otherwise returns ""
+func SchemaFromContext(ctx context.Context) string {
+	return DirectiveFromContext(ctx).Schema
+}
+
+// WithPartition return a copy of ctx with `RoutingDirective.Partition` key,
+// so that statements are routed to the cluster of the partition by `PartitionRouter` set by `SetPartitionRouter()`,
+// taking precedence over a `/* partition=<key> */` comment of SQL
+func WithPartition(ctx context.Context, key string) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.Partition = key })
+}
+
+// PartitionFromContext returns the partition set by `WithPartition()`; otherwise returns ""
+func PartitionFromContext(ctx context.Context) string {
+	return DirectiveFromContext(ctx).Partition
+}
+
+// WithMaxAttempts return a copy of ctx with `RoutingDirective.MaxAttempts` n,
+// so that each statement run with ctx is attempted at most n times in total, overriding retries of
+// `FallbackPolicy` (on another read replica or primary DB) and `SetStaleConnRetry()` for a single call.
+// Non-positive n means no override.
+func WithMaxAttempts(ctx context.Context, n int) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.MaxAttempts = n })
+}
+
+// WithNoRetry return a copy of ctx where statements are never retried, the same as `WithMaxAttempts(ctx, 1)`,
+// e.g. for reads with side effects via functions
+func WithNoRetry(ctx context.Context) context.Context {
+	return WithMaxAttempts(ctx, 1)
+}
+
+// MaxAttemptsFromContext returns the maximum number of attempts set by `WithMaxAttempts()` or `WithNoRetry()`;
+// otherwise returns 0
+func MaxAttemptsFromContext(ctx context.Context) int {
+	if n := DirectiveFromContext(ctx).MaxAttempts; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// WithFreshnessAssert return a copy of ctx with `RoutingDirective.FreshnessAssert`, so that reads on read replicas by
+// `QueryContext()` / `QueryRowContext()` (and the methods calling them) are also run on primary DB asynchronously,
+// and results of different rows are reported by `EventFreshnessMismatch`, not returned. It is meant for canary
+// deployments validating that a code path tolerates stale reads of read replicas.
+// Results of reads on read replicas are read into memory first, so avoid it for large results.
+func WithFreshnessAssert(ctx context.Context) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.FreshnessAssert = true })
+}
+
+// FreshnessAssertFromContext returns true if ctx is created by `WithFreshnessAssert()`
+func FreshnessAssertFromContext(ctx context.Context) bool {
+	return DirectiveFromContext(ctx).FreshnessAssert
+}
+
+// WithSessionToken return a copy of ctx with `RoutingDirective.SessionToken` token, so that reads with ctx
+// (or contexts derived from it, or any with the same token) follow writes with them by `SetStaleReadRetry()`
+func WithSessionToken(ctx context.Context, token string) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.SessionToken = token })
+}
+
+// SessionTokenFromContext returns the session token set by `WithSessionToken()`; otherwise returns ""
+func SessionTokenFromContext(ctx context.Context) string {
+	return DirectiveFromContext(ctx).SessionToken
+}
+
+// detachedContext is a context of values of its parent without its deadline and cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// detach returns ctx without its deadline and cancellation, keeping its values, for work not owned by one caller
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
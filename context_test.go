@@ -2,7 +2,10 @@ package gosqlrwdb
 
 import (
 	"context"
+	"database/sql"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestWithPrimary(t *testing.T) {
@@ -15,17 +18,53 @@ func TestWithPrimary(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		val := test.ctx.Value(ContextUsePrimaryKey)
-		actual := false
-		if val != nil {
-			actual = true
-		}
+		actual := DirectiveFromContext(test.ctx).ForcePrimary
 		if actual != test.expected {
-			t.Errorf("actual = %v, expected = %v, val = %v", actual, test.expected, val)
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
 		}
 	}
 }
 
+func TestWithDirective(t *testing.T) {
+	d := RoutingDirective{Group: "analytics", MaxStaleness: time.Second, ExcludeReplicas: []string{"a"}}
+	legacy := context.WithValue(context.WithValue(context.Background(), ContextUsePrimaryKey, emptyContextValue), ContextWorkloadKey, "batch")
+	tests := []struct {
+		ctx      context.Context
+		expected RoutingDirective
+	}{
+		{context.Background(), RoutingDirective{}},
+		{WithDirective(context.Background(), d), d},
+		{WithPrimary(WithDirective(context.Background(), d)),
+			RoutingDirective{ForcePrimary: true, Group: "analytics", MaxStaleness: time.Second, ExcludeReplicas: []string{"a"}}},
+		{WithDirective(WithPrimary(context.Background()), d), d},
+		{legacy, RoutingDirective{ForcePrimary: true, Workload: "batch"}},
+		{WithStatementID(legacy, "id-1"), RoutingDirective{ForcePrimary: true, Workload: "batch", StatementID: "id-1"}},
+		{WithDirective(legacy, d),
+			RoutingDirective{ForcePrimary: true, Workload: "batch", Group: "analytics", MaxStaleness: time.Second, ExcludeReplicas: []string{"a"}}},
+		// keys set after the directive are not ignored
+		{context.WithValue(WithStatementID(context.Background(), "id-1"), ContextUsePrimaryKey, emptyContextValue),
+			RoutingDirective{ForcePrimary: true, StatementID: "id-1"}},
+		{context.WithValue(WithWorkload(context.Background(), "batch"), ContextExactReplicaOrderKey, emptyContextValue),
+			RoutingDirective{ExactReplicaOrder: true, Workload: "batch"}},
+		{context.WithValue(WithWorkload(context.Background(), "batch"), ContextWorkloadKey, "online"),
+			RoutingDirective{Workload: "batch"}},
+	}
+
+	for i, test := range tests {
+		if actual := DirectiveFromContext(test.ctx); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("actual = %+v, expected = %+v of test %d", actual, test.expected, i)
+		}
+	}
+
+	// the directive in ctx is not changed by the slice passed
+	names := []string{"a"}
+	ctx := WithDirective(context.Background(), RoutingDirective{ExcludeReplicas: names})
+	names[0] = "b"
+	if actual := ExcludeReplicasFromContext(ctx); !reflect.DeepEqual(actual, []string{"a"}) {
+		t.Errorf("actual = %v, expected = [a]", actual)
+	}
+}
+
 func TestUsePrimaryFromContext(t *testing.T) {
 	tests := []struct {
 		ctx      context.Context
@@ -42,3 +81,170 @@ func TestUsePrimaryFromContext(t *testing.T) {
 		}
 	}
 }
+
+func TestUseReplicaFromContext(t *testing.T) {
+	tests := []struct {
+		ctx      context.Context
+		expected bool
+	}{
+		{context.Background(), false},
+		{WithPrimary(context.Background()), false},
+		{WithReplica(context.Background()), true},
+		{WithStatementID(WithReplica(context.Background()), "id-1"), true},
+	}
+
+	for _, test := range tests {
+		actual := UseReplicaFromContext(test.ctx)
+		if actual != test.expected {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+}
+
+func TestExactReplicaOrderFromContext(t *testing.T) {
+	tests := []struct {
+		ctx      context.Context
+		expected bool
+	}{
+		{context.Background(), false},
+		{WithPrimary(context.Background()), false},
+		{WithExactReplicaOrder(context.Background()), true},
+	}
+
+	for _, test := range tests {
+		actual := ExactReplicaOrderFromContext(test.ctx)
+		if actual != test.expected {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+}
+
+func TestStatementIDFromContext(t *testing.T) {
+	tests := []struct {
+		ctx      context.Context
+		expected string
+	}{
+		{context.Background(), ""},
+		{WithPrimary(context.Background()), ""},
+		{WithStatementID(context.Background(), "id-1"), "id-1"},
+		{WithPrimary(WithStatementID(context.Background(), "id-2")), "id-2"},
+	}
+
+	for _, test := range tests {
+		actual := StatementIDFromContext(test.ctx)
+		if actual != test.expected {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+}
+
+func TestExcludeReplicasFromContext(t *testing.T) {
+	base := WithExcludeReplicas(context.Background(), "a")
+	tests := []struct {
+		ctx      context.Context
+		expected []string
+	}{
+		{context.Background(), nil},
+		{WithPrimary(context.Background()), nil},
+		{base, []string{"a"}},
+		{WithExcludeReplicas(base, "b", "c"), []string{"a", "b", "c"}},
+		{WithExcludeReplicas(base, "d"), []string{"a", "d"}},
+	}
+
+	for _, test := range tests {
+		actual := ExcludeReplicasFromContext(test.ctx)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+}
+
+func TestRoutingKeyFromContext(t *testing.T) {
+	tests := []struct {
+		ctx         context.Context
+		expected    string
+		expectedSet bool
+	}{
+		{context.Background(), "", false},
+		{WithRoutingKey(context.Background(), ""), "", true},
+		{WithPrimary(WithRoutingKey(context.Background(), "user-1")), "user-1", true},
+	}
+
+	for _, test := range tests {
+		actual, set := RoutingKeyFromContext(test.ctx)
+		if actual != test.expected || set != test.expectedSet {
+			t.Errorf("actual = (%v, %v), expected = (%v, %v)", actual, set, test.expected, test.expectedSet)
+		}
+	}
+}
+
+func TestTxOptionsFromContext(t *testing.T) {
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}
+	tests := []struct {
+		ctx      context.Context
+		expected *sql.TxOptions
+	}{
+		{context.Background(), nil},
+		{WithTxOptions(context.Background(), opts), opts},
+		{WithPrimary(WithTxOptions(context.Background(), opts)), opts},
+	}
+
+	for _, test := range tests {
+		if actual := TxOptionsFromContext(test.ctx); actual != test.expected {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+}
+
+func TestWorkloadFromContext(t *testing.T) {
+	tests := []struct {
+		ctx      context.Context
+		expected string
+	}{
+		{context.Background(), ""},
+		{WithWorkload(context.Background(), "batch"), "batch"},
+		{WithPrimary(WithWorkload(context.Background(), "web")), "web"},
+	}
+
+	for _, test := range tests {
+		if actual := WorkloadFromContext(test.ctx); actual != test.expected {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+}
+
+func TestSingleflightFromContext(t *testing.T) {
+	tests := []struct {
+		ctx      context.Context
+		expected bool
+	}{
+		{context.Background(), false},
+		{WithSingleflight(context.Background()), true},
+		{WithPrimary(WithSingleflight(context.Background())), true},
+	}
+
+	for _, test := range tests {
+		if actual := SingleflightFromContext(test.ctx); actual != test.expected {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+}
+
+func TestMaxAttemptsFromContext(t *testing.T) {
+	tests := []struct {
+		ctx      context.Context
+		expected int
+	}{
+		{context.Background(), 0},
+		{WithNoRetry(context.Background()), 1},
+		{WithMaxAttempts(context.Background(), 3), 3},
+		{WithMaxAttempts(context.Background(), -1), 0},
+		{WithPrimary(WithMaxAttempts(context.Background(), 2)), 2},
+	}
+
+	for _, test := range tests {
+		if actual := MaxAttemptsFromContext(test.ctx); actual != test.expected {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+}
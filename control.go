@@ -0,0 +1,207 @@
+package gosqlrwdb
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ControlAction is the kind of a request to the control server of `ServeControl()`
+type ControlAction string
+
+const (
+	// ControlActionView is the action of requests reading health, topology, metrics and switches
+	ControlActionView ControlAction = "view"
+
+	// ControlActionChange is the action of requests changing switches
+	ControlActionChange ControlAction = "change"
+)
+
+// controlMaxBody is the maximum size of request bodies of the control server
+const controlMaxBody = 64 << 10
+
+// ControlAuthorizer authenticates and authorizes requests to the control server,
+// e.g. by bearer tokens, mTLS client certificates (`r.TLS`) or a central policy service.
+type ControlAuthorizer interface {
+	// Authorize returns an error if r may not do action, which is answered by `403 Forbidden`
+	Authorize(r *http.Request, action ControlAction) error
+}
+
+// ControlAuthorizerFunc is a ControlAuthorizer of a function
+type ControlAuthorizerFunc func(r *http.Request, action ControlAction) error
+
+// Authorize calls f
+func (f ControlAuthorizerFunc) Authorize(r *http.Request, action ControlAction) error {
+	return f(r, action)
+}
+
+// BearerTokenAuthorizer returns a ControlAuthorizer allowing all actions of requests with
+// `Authorization: Bearer <token>`. Empty token allows nothing.
+func BearerTokenAuthorizer(token string) ControlAuthorizer {
+	return ControlAuthorizerFunc(func(r *http.Request, action ControlAction) error {
+		auth := r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			return errors.New("invalid bearer token")
+		}
+		return nil
+	})
+}
+
+// ControlSwitches are kill switches and toggles of routing of the control server.
+// Responses have all fields with current values; in requests, nil fields are not changed.
+type ControlSwitches struct {
+	// ReplicaReads & PrimaryFallback are `FlagReplicaReads` and `FlagPrimaryFallback`, changed by `SetFlag()`
+	ReplicaReads    *bool `json:"replica_reads,omitempty"`
+	PrimaryFallback *bool `json:"primary_fallback,omitempty"`
+
+	// ReadPercentage is `RuntimeConfig.ReadPercentage`, overridden by `FlagReadPercentage` in responses
+	ReadPercentage *int `json:"read_percentage,omitempty"`
+
+	// PrimaryInMaintenance is maintenance mode of primary DB, changed by `SetPrimaryInMaintenance()`
+	PrimaryInMaintenance *bool `json:"primary_in_maintenance,omitempty"`
+
+	// ResetFlags unsets flags set by `SetFlag()` before applying the others, in requests only
+	ResetFlags bool `json:"reset_flags,omitempty"`
+}
+
+// ServeControl serves the control server of db on l until l is closed, returning the error of serving,
+// so that fleet tooling can manage routing across many instances. It is opt-in: nothing is served unless called.
+// Requests are authorized by auth; nil auth allows views only. Endpoints answer JSON:
+//
+//	GET  /health    -> AdminHealth, with `503 Service Unavailable` if not `Ready()`
+//	GET  /topology  -> Topology
+//	GET  /metrics   -> RoutingMetrics
+//	GET  /switches  -> ControlSwitches
+//	POST /switches  <- ControlSwitches to change, -> ControlSwitches after changes
+//
+// Errors are answered as `{"error": "..."}`. Serve on TLS by `tls.NewListener()` outside trusted networks.
+func (db *DB) ServeControl(l net.Listener, auth ControlAuthorizer) error {
+	s := &http.Server{Handler: db.ControlHandler(auth), ReadHeaderTimeout: 10 * time.Second}
+	return s.Serve(l)
+}
+
+// ControlHandler returns the http.Handler of `ServeControl()`, e.g. to mount it on a mux of the application
+func (db *DB) ControlHandler(auth ControlAuthorizer) http.Handler {
+	mux := http.NewServeMux()
+	view := func(f func() (int, interface{})) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				writeControl(w, http.StatusMethodNotAllowed, controlError("method %s is not allowed", r.Method))
+				return
+			}
+			if !db.authorizeControl(w, r, auth, ControlActionView) {
+				return
+			}
+			status, body := f()
+			writeControl(w, status, body)
+		}
+	}
+	mux.Handle("/health", view(func() (int, interface{}) {
+		h := db.Admin().Health()
+		if !h.Ready {
+			return http.StatusServiceUnavailable, h
+		}
+		return http.StatusOK, h
+	}))
+	mux.Handle("/topology", view(func() (int, interface{}) { return http.StatusOK, db.Topology() }))
+	mux.Handle("/metrics", view(func() (int, interface{}) { return http.StatusOK, db.Metrics() }))
+	mux.HandleFunc("/switches", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			view(func() (int, interface{}) { return http.StatusOK, db.controlSwitches() })(w, r)
+		case http.MethodPost:
+			if !db.authorizeControl(w, r, auth, ControlActionChange) {
+				return
+			}
+			var s ControlSwitches
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, controlMaxBody)).Decode(&s); err != nil {
+				writeControl(w, http.StatusBadRequest, controlError("invalid switches: %s", err))
+				return
+			}
+			db.debugf(DebugEvent, "[ServeControl] change switches from %s", r.RemoteAddr)
+			if err := db.applyControlSwitches(s); err != nil {
+				writeControl(w, http.StatusBadRequest, controlError("%s", err))
+				return
+			}
+			writeControl(w, http.StatusOK, db.controlSwitches())
+		default:
+			writeControl(w, http.StatusMethodNotAllowed, controlError("method %s is not allowed", r.Method))
+		}
+	})
+	return mux
+}
+
+// authorizeControl returns true if r may do action by auth, otherwise answers `403 Forbidden`
+func (db *DB) authorizeControl(w http.ResponseWriter, r *http.Request, auth ControlAuthorizer, action ControlAction) bool {
+	var err error
+	switch {
+	case auth != nil:
+		err = auth.Authorize(r, action)
+	case action != ControlActionView:
+		err = errors.New("changes are not allowed without ControlAuthorizer")
+	}
+	if err != nil {
+		db.debugf(DebugError, "[ServeControl] %s %s from %s forbidden: %s", r.Method, r.URL.Path, r.RemoteAddr, err)
+		writeControl(w, http.StatusForbidden, controlError("forbidden: %s", err))
+		return false
+	}
+	return true
+}
+
+// controlSwitches returns current switches
+func (db *DB) controlSwitches() ControlSwitches {
+	replicaReads := db.flag(FlagReplicaReads, true)
+	primaryFallback := db.flag(FlagPrimaryFallback, true)
+	readPercentage := db.replicaReadPercentage()
+	maintenance := db.PrimaryInMaintenance()
+	return ControlSwitches{
+		ReplicaReads:         &replicaReads,
+		PrimaryFallback:      &primaryFallback,
+		ReadPercentage:       &readPercentage,
+		PrimaryInMaintenance: &maintenance,
+	}
+}
+
+// applyControlSwitches applies non-nil switches of s, validating all of them first
+func (db *DB) applyControlSwitches(s ControlSwitches) error {
+	if s.ReadPercentage != nil && (*s.ReadPercentage < 0 || *s.ReadPercentage > 100) {
+		return fmt.Errorf("%w: read percentage %d is out of 0 ~ 100", ErrInvalidConfig, *s.ReadPercentage)
+	}
+	if s.ResetFlags {
+		db.UnsetFlag(FlagReplicaReads)
+		db.UnsetFlag(FlagPrimaryFallback)
+	}
+	if s.ReplicaReads != nil {
+		db.SetFlag(FlagReplicaReads, *s.ReplicaReads)
+	}
+	if s.PrimaryFallback != nil {
+		db.SetFlag(FlagPrimaryFallback, *s.PrimaryFallback)
+	}
+	if s.ReadPercentage != nil {
+		if err := db.Admin().SetReadPercentage(*s.ReadPercentage); err != nil {
+			return err
+		}
+	}
+	if s.PrimaryInMaintenance != nil {
+		db.SetPrimaryInMaintenance(*s.PrimaryInMaintenance)
+	}
+	return nil
+}
+
+// controlError returns the body of an error response
+func controlError(format string, args ...interface{}) interface{} {
+	return map[string]string{"error": fmt.Sprintf(format, args...)}
+}
+
+// writeControl writes body as JSON with status
+func writeControl(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,124 @@
+package gosqlrwdb
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestControlHandler(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	viewer := ControlAuthorizerFunc(func(r *http.Request, action ControlAction) error {
+		if action != ControlActionView {
+			return errors.New("viewer")
+		}
+		return nil
+	})
+	tests := []struct {
+		auth   ControlAuthorizer
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{nil, http.MethodGet, "/health", "", "", http.StatusOK},
+		{nil, http.MethodGet, "/topology", "", "", http.StatusOK},
+		{nil, http.MethodGet, "/metrics", "", "", http.StatusOK},
+		{nil, http.MethodGet, "/switches", "", "", http.StatusOK},
+		{nil, http.MethodPost, "/switches", "", `{"replica_reads": false}`, http.StatusForbidden},
+		{nil, http.MethodDelete, "/topology", "", "", http.StatusMethodNotAllowed},
+		{viewer, http.MethodPost, "/switches", "", `{"replica_reads": false}`, http.StatusForbidden},
+		{BearerTokenAuthorizer("secret"), http.MethodGet, "/health", "wrong", "", http.StatusForbidden},
+		{BearerTokenAuthorizer("secret"), http.MethodPost, "/switches", "secret", `{"read_percentage": 101}`, http.StatusBadRequest},
+		{BearerTokenAuthorizer("secret"), http.MethodPost, "/switches", "secret", `{"replica_reads"`, http.StatusBadRequest},
+		{BearerTokenAuthorizer("secret"), http.MethodPost, "/switches", "secret", `{"replica_reads": false, "read_percentage": 50}`, http.StatusOK},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		db.ControlHandler(test.auth).ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("actual status: %d, expected: %d of test %d (%s)", w.Code, test.status, i, w.Body)
+		}
+	}
+
+	var switches ControlSwitches
+	req := httptest.NewRequest(http.MethodGet, "/switches", nil)
+	w := httptest.NewRecorder()
+	db.ControlHandler(nil).ServeHTTP(w, req)
+	if err := json.Unmarshal(w.Body.Bytes(), &switches); err != nil {
+		t.Fatalf("error %s when decoding switches", err)
+	}
+	if *switches.ReplicaReads || !*switches.PrimaryFallback || *switches.ReadPercentage != 50 || *switches.PrimaryInMaintenance {
+		t.Errorf("actual switches: %s, expected: replica reads off and 50%% of reads", w.Body)
+	}
+	if db.flag(FlagReplicaReads, true) || db.RuntimeConfig().ReadPercentage != 50 {
+		t.Errorf("actual switches are not applied")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/switches", strings.NewReader(`{"reset_flags": true, "primary_in_maintenance": true}`))
+	w = httptest.NewRecorder()
+	db.ControlHandler(BearerTokenAuthorizer("secret")).ServeHTTP(w, withBearer(req, "secret"))
+	if w.Code != http.StatusOK {
+		t.Errorf("actual status: %d, expected: %d (%s)", w.Code, http.StatusOK, w.Body)
+	}
+	if !db.flag(FlagReplicaReads, true) || !db.PrimaryInMaintenance() {
+		t.Errorf("actual replica reads: %t, maintenance: %t, expected: both true", db.flag(FlagReplicaReads, true), db.PrimaryInMaintenance())
+	}
+}
+
+func TestServeControl(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error %s when Listen", err)
+	}
+	defer l.Close()
+	go db.ServeControl(l, nil)
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/topology")
+	if err != nil {
+		t.Fatalf("error %s when GET /topology", err)
+	}
+	defer resp.Body.Close()
+	var topology Topology
+	if err := json.NewDecoder(resp.Body).Decode(&topology); err != nil {
+		t.Fatalf("error %s when decoding topology", err)
+	}
+	if topology.Primary.Name != "primary" || len(topology.Replicas) != 1 {
+		t.Errorf("actual topology: %+v, expected: primary and a read replica", topology)
+	}
+}
+
+func withBearer(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
@@ -0,0 +1,356 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCostGuardSampleRate = 1.0
+	defaultCostGuardCacheSize  = 1000
+	defaultCostGuardTimeout    = time.Second
+)
+
+// CostGuardAction decides what happens to a query whose estimated cost exceeds `CostGuard`
+type CostGuardAction int
+
+const (
+	// CostGuardReject rejects the query with `ErrQueryTooExpensive`
+	CostGuardReject CostGuardAction = iota
+
+	// CostGuardPrimary routes the query to primary DB, as `WithPrimary()` does
+	CostGuardPrimary
+)
+
+// QueryCost is the estimation of a query by `EXPLAIN`
+type QueryCost struct {
+	// Cost is the estimated total cost in units of the planner of the DB
+	Cost float64
+
+	// Rows is the estimated number of rows, zero if not estimated
+	Rows float64
+}
+
+// CostGuard guards read replicas against runaway queries: for a sampled fraction of new query digests,
+// the query is explained on a read replica before it runs, and the verdict is cached per digest,
+// so that later queries of the same digest are routed by the cached verdict without `EXPLAIN`.
+// A digest is the query with literals and placeholders replaced by `?`, comments removed and spaces collapsed.
+// Queries not sampled and queries failed to explain are allowed.
+//
+// Only reads on read replicas by `Query()`, `QueryContext()`, `QueryRow()` and `QueryRowContext()` are guarded.
+//
+// Zero values of `SampleRate`, `CacheSize` and `Timeout` mean defaults.
+type CostGuard struct {
+	// MaxCost is the maximum estimated cost of a query, zero for no limit
+	MaxCost float64
+
+	// MaxRows is the maximum estimated number of rows of a query, zero for no limit
+	MaxRows float64
+
+	// Action is what happens to a query exceeding `MaxCost` or `MaxRows`. Default to `CostGuardReject`.
+	Action CostGuardAction
+
+	// SampleRate is the fraction (0.0 ~ 1.0) of new digests explained. Default to 1.0.
+	SampleRate float64
+
+	// CacheSize is the maximum number of digests whose verdicts are cached. Default to 1000.
+	CacheSize int
+
+	// Timeout is the timeout of an `EXPLAIN`. Default to 1s.
+	Timeout time.Duration
+
+	// Estimate explains query with args on read replica r.
+	// If nil, it is done by Dialect set by `SetDialect()`: `PostgresDialect` and `MySQLDialect` are supported;
+	// queries are not guarded by other dialects.
+	Estimate func(ctx context.Context, r *sql.DB, query string, args []interface{}) (QueryCost, error)
+}
+
+// withDefaults returns a copy of g with zero values replaced by defaults
+func (g CostGuard) withDefaults() CostGuard {
+	if g.SampleRate == 0 {
+		g.SampleRate = defaultCostGuardSampleRate
+	}
+	if g.CacheSize <= 0 {
+		g.CacheSize = defaultCostGuardCacheSize
+	}
+	if g.Timeout <= 0 {
+		g.Timeout = defaultCostGuardTimeout
+	}
+	return g
+}
+
+// exceeds returns true if cost exceeds limits of g
+func (g CostGuard) exceeds(cost QueryCost) bool {
+	return (g.MaxCost > 0 && cost.Cost > g.MaxCost) || (g.MaxRows > 0 && cost.Rows > g.MaxRows)
+}
+
+// costVerdict is the cached verdict of a digest by CostGuard
+type costVerdict struct {
+	exceeded bool
+	cost     QueryCost
+}
+
+// costGuard holds a CostGuard with its verdicts by digest
+type costGuard struct {
+	guard CostGuard
+
+	mu       sync.Mutex
+	verdicts map[string]costVerdict
+}
+
+// SetCostGuard sets the CostGuard of reads on read replicas, discarding cached verdicts.
+// Passing nil disables it, which is the default.
+// It returns an error wrapping `ErrInvalidConfig` if no limit is set, or `SampleRate` is out of 0.0 ~ 1.0.
+func (db *DB) SetCostGuard(g *CostGuard) error {
+	var c *costGuard
+	if g != nil {
+		copied := g.withDefaults()
+		if copied.MaxCost <= 0 && copied.MaxRows <= 0 {
+			return fmt.Errorf("%w: cost guard has neither max cost nor max rows", ErrInvalidConfig)
+		}
+		if copied.SampleRate < 0 || copied.SampleRate > 1 {
+			return fmt.Errorf("%w: cost guard sample rate %f is out of 0.0 ~ 1.0", ErrInvalidConfig, copied.SampleRate)
+		}
+		c = &costGuard{guard: copied, verdicts: map[string]costVerdict{}}
+	}
+	db.configMutex.Lock()
+	db.costGuard = c
+	db.configMutex.Unlock()
+	return nil
+}
+
+// queryCostGuard returns current costGuard, nil if not set
+func (db *DB) queryCostGuard() *costGuard {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.costGuard
+}
+
+// guardCost checks query by `CostGuard` before it is routed to read replicas.
+// It returns ctx of `WithPrimary()` if the query is routed to primary DB by `CostGuardPrimary`,
+// or an error wrapping `ErrQueryTooExpensive` if the query is rejected.
+func (db *DB) guardCost(ctx context.Context, query string, args []interface{}) (context.Context, error) {
+	c := db.queryCostGuard()
+	if c == nil || UsePrimaryFromContext(ctx) {
+		return ctx, nil
+	}
+	digest := queryDigest(query)
+	verdict, ok := c.verdict(digest)
+	if !ok {
+		verdict, ok = db.explainCost(ctx, c, query, args)
+		if !ok {
+			return ctx, nil
+		}
+		c.store(digest, verdict)
+	}
+	if !verdict.exceeded {
+		return ctx, nil
+	}
+	if c.guard.Action == CostGuardPrimary {
+		db.debugf(DebugRouting, "[guardCost] query routed to primary by estimated cost %+v: %s", verdict.cost, digest)
+		return WithPrimary(ctx), nil
+	}
+	return ctx, fmt.Errorf("%w: estimated cost %g and rows %g exceed limits for %s",
+		ErrQueryTooExpensive, verdict.cost.Cost, verdict.cost.Rows, digest)
+}
+
+// explainCost returns the verdict of query explained on a read replica,
+// ok is false if it cannot be explained, in which case the verdict is not cached
+func (db *DB) explainCost(ctx context.Context, c *costGuard, query string, args []interface{}) (verdict costVerdict, ok bool) {
+	if rand.Float64() >= c.guard.SampleRate {
+		return costVerdict{}, true
+	}
+	estimate := c.guard.Estimate
+	if estimate == nil {
+		d, supported := db.sqlDialect().(costDialect)
+		if !supported {
+			return costVerdict{}, true
+		}
+		estimate = d.EstimateCost
+	}
+	r, err := db.selectReplica(ctx, false)
+	if err != nil {
+		return costVerdict{}, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.guard.Timeout)
+	defer cancel()
+	cost, err := estimate(ctx, r, db.rebind(query), args)
+	if err != nil {
+		db.debugf(DebugError, "[guardCost] explain err: %s", err)
+		return costVerdict{}, false
+	}
+	return costVerdict{exceeded: c.guard.exceeds(cost), cost: cost}, true
+}
+
+// verdict returns the cached verdict of digest
+func (c *costGuard) verdict(digest string) (costVerdict, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.verdicts[digest]
+	return v, ok
+}
+
+// store caches the verdict of digest, evicting an arbitrary digest if the cache is full
+func (c *costGuard) store(digest string, verdict costVerdict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.verdicts[digest]; !ok && len(c.verdicts) >= c.guard.CacheSize {
+		for d := range c.verdicts {
+			delete(c.verdicts, d)
+			break
+		}
+	}
+	c.verdicts[digest] = verdict
+}
+
+// costDialect is a Dialect estimating cost of queries by `EXPLAIN`
+type costDialect interface {
+	EstimateCost(ctx context.Context, r *sql.DB, query string, args []interface{}) (QueryCost, error)
+}
+
+// EstimateCost returns `Total Cost` and `Plan Rows` of the top plan node by `EXPLAIN (FORMAT JSON)`
+func (postgresDialect) EstimateCost(ctx context.Context, r *sql.DB, query string, args []interface{}) (QueryCost, error) {
+	var plan []byte
+	if err := r.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&plan); err != nil {
+		return QueryCost{}, err
+	}
+	var explained []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+			PlanRows  float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return QueryCost{}, err
+	}
+	if len(explained) == 0 {
+		return QueryCost{}, fmt.Errorf("empty plan")
+	}
+	return QueryCost{Cost: explained[0].Plan.TotalCost, Rows: explained[0].Plan.PlanRows}, nil
+}
+
+// EstimateCost returns `query_cost` and the largest `rows_examined_per_scan` of any table by `EXPLAIN FORMAT=JSON`
+func (mysqlDialect) EstimateCost(ctx context.Context, r *sql.DB, query string, args []interface{}) (QueryCost, error) {
+	var plan []byte
+	if err := r.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+query, args...).Scan(&plan); err != nil {
+		return QueryCost{}, err
+	}
+	var explained struct {
+		QueryBlock map[string]interface{} `json:"query_block"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return QueryCost{}, err
+	}
+	var cost QueryCost
+	if info, ok := explained.QueryBlock["cost_info"].(map[string]interface{}); ok {
+		cost.Cost = jsonNumber(info["query_cost"])
+	}
+	cost.Rows = maxJSONNumber(explained.QueryBlock, "rows_examined_per_scan")
+	return cost, nil
+}
+
+// maxJSONNumber returns the largest number of key in v and its descendants
+func maxJSONNumber(v interface{}, key string) float64 {
+	max := 0.0
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			n := maxJSONNumber(child, key)
+			if k == key {
+				n = jsonNumber(child)
+			}
+			if n > max {
+				max = n
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if n := maxJSONNumber(child, key); n > max {
+				max = n
+			}
+		}
+	}
+	return max
+}
+
+// jsonNumber returns v as a number, which MySQL may give as a string
+func jsonNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case string:
+		n, _ := strconv.ParseFloat(v, 64)
+		return n
+	}
+	return 0
+}
+
+// queryDigest returns query with literals, numbers and placeholders replaced by `?`,
+// comments removed, spaces collapsed and words lower-cased. Lists of `?` such as `IN (?, ?, ?)` are collapsed to `?`.
+func queryDigest(query string) string {
+	var tokens []string
+	literal := func() {
+		// `?, ?` is collapsed into `?`
+		if n := len(tokens); n >= 2 && tokens[n-1] == "," && tokens[n-2] == "?" {
+			tokens = tokens[:n-1]
+			return
+		}
+		tokens = append(tokens, "?")
+	}
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == '-' && i+2 < len(query) && query[i+1] == '-' && isSpace(query[i+2]):
+			i = skipLineComment(query, i+2)
+		case c == '/' && i+1 < len(query) && query[i+1] == '*' && !isExecutableComment(query, i):
+			i = skipBlockComment(query, i+2)
+		case c == '\'':
+			i = skipQuoted(query, i+1, c)
+			literal()
+		case c == '"' || c == '`':
+			start := i
+			i = skipQuoted(query, i+1, c)
+			tokens = append(tokens, query[start:i])
+		case c == '$':
+			start := i
+			if i = skipDollarQuoted(query, i); i == start+1 {
+				// `$1` placeholder
+				for i < len(query) && query[i] >= '0' && query[i] <= '9' {
+					i++
+				}
+			}
+			literal()
+		case (c == ':' || c == '@') && isNamedPlaceholder(query, i) && (i == 0 || query[i-1] != c):
+			i = skipNamedPlaceholder(query, i)
+			literal()
+		case c == '?':
+			i++
+			literal()
+		case c >= '0' && c <= '9':
+			for i < len(query) && (isWordByte(query[i]) || query[i] == '.') {
+				i++
+			}
+			literal()
+		case isWordByte(c):
+			start := i
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			tokens = append(tokens, toLowerASCII(query[start:i]))
+		case isSpace(c):
+			i++
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return strings.Join(tokens, " ")
+}
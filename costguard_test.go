@@ -0,0 +1,169 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestQueryDigest(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT * FROM users WHERE id = 1", "select * from users where id = ?"},
+		{"select *  from users\n where id = 42 -- by id", "select * from users where id = ?"},
+		{"SELECT * FROM users WHERE name = 'O''Brien' AND id IN (1, 2, 3)", "select * from users where name = ? and id in ( ? )"},
+		{"SELECT * FROM users WHERE id = $1 AND name = :name", "select * from users where id = ? and name = ?"},
+		{"SELECT * FROM \"Users\" /* hint */ WHERE id = ?", "select * from \"Users\" where id = ?"},
+		{"SELECT price * 1.5 FROM items", "select price * ? from items"},
+	}
+	for _, test := range tests {
+		if actual := queryDigest(test.query); actual != test.expected {
+			t.Errorf("actual digest = %s, expected = %s for %s", actual, test.expected, test.query)
+		}
+	}
+}
+
+func TestSetCostGuard(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	tests := []struct {
+		guard *CostGuard
+		valid bool
+	}{
+		{nil, true},
+		{&CostGuard{}, false},
+		{&CostGuard{MaxCost: 100}, true},
+		{&CostGuard{MaxRows: 100, SampleRate: 1.5}, false},
+	}
+	for _, test := range tests {
+		if err = db.SetCostGuard(test.guard); (err == nil) != test.valid || (err != nil && !errors.Is(err, ErrInvalidConfig)) {
+			t.Errorf("actual err: %v, expected valid: %t for %+v", err, test.valid, test.guard)
+		}
+	}
+}
+
+func TestCostGuard(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	explained := map[string]int{}
+	estimate := func(ctx context.Context, r *sql.DB, query string, args []interface{}) (QueryCost, error) {
+		if r != r1.db {
+			t.Errorf("actual explained on %v, expected read replica", r)
+		}
+		explained[queryDigest(query)]++
+		if len(args) > 0 && args[0] == "all" {
+			return QueryCost{Cost: 10000, Rows: 1000000}, nil
+		}
+		return QueryCost{Cost: 10, Rows: 1}, nil
+	}
+
+	tests := []struct {
+		action   CostGuardAction
+		arg      string
+		rejected bool
+		primary  bool
+	}{
+		{CostGuardReject, "one", false, false},
+		{CostGuardReject, "all", true, false},
+		{CostGuardPrimary, "one", false, false},
+		{CostGuardPrimary, "all", false, true},
+	}
+	for _, test := range tests {
+		if err = db.SetCostGuard(&CostGuard{MaxRows: 1000, Action: test.action, Estimate: estimate}); err != nil {
+			t.Fatalf("error %s when SetCostGuard", err)
+		}
+		query := "SELECT * FROM mytable WHERE name = ? -- " + test.arg
+		for i := 0; i < 2; i++ {
+			target := r1
+			if test.primary {
+				target = p
+			}
+			if !test.rejected {
+				target.mock.ExpectQuery("SELECT (.+) FROM mytable").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+			}
+			rows, err := db.QueryContext(context.Background(), query, test.arg)
+			if test.rejected {
+				if !errors.Is(err, ErrQueryTooExpensive) {
+					t.Errorf("actual err: %v, expected: %s", err, ErrQueryTooExpensive)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("error %s when QueryContext", err)
+			}
+			rows.Close()
+		}
+	}
+
+	// verdicts are cached per digest until the guard is set again
+	if actual := explained[queryDigest("SELECT * FROM mytable WHERE name = ?")]; actual != len(tests) {
+		t.Errorf("actual explained %d times, expected %d", actual, len(tests))
+	}
+	if actual := db.Metrics().Errors[ErrorTypeQueryTooExpensive]; actual != 2 {
+		t.Errorf("actual errors of %s = %d, expected = 2", ErrorTypeQueryTooExpensive, actual)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	defer r1.db.Close()
+
+	tests := []struct {
+		dialect  Dialect
+		explain  string
+		plan     string
+		expected QueryCost
+	}{
+		{PostgresDialect, "EXPLAIN \\(FORMAT JSON\\) select",
+			`[{"Plan": {"Node Type": "Seq Scan", "Total Cost": 1234.5, "Plan Rows": 50000}}]`, QueryCost{Cost: 1234.5, Rows: 50000}},
+		{MySQLDialect, "EXPLAIN FORMAT=JSON select",
+			`{"query_block": {"cost_info": {"query_cost": "20.50"}, "nested_loop": [{"table": {"rows_examined_per_scan": 10}}, {"table": {"rows_examined_per_scan": 200}}]}}`,
+			QueryCost{Cost: 20.5, Rows: 200}},
+	}
+	for _, test := range tests {
+		r1.mock.ExpectQuery(test.explain).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"plan"}).AddRow(test.plan))
+		actual, err := test.dialect.(costDialect).EstimateCost(context.Background(), r1.db, fmt.Sprintf(selectQueryTmpl, "*")+" WHERE id = ?", []interface{}{1})
+		if err != nil {
+			t.Fatalf("error %s when EstimateCost of %s", err, test.dialect.Name())
+		}
+		if actual != test.expected {
+			t.Errorf("actual cost: %+v, expected: %+v by %s", actual, test.expected, test.dialect.Name())
+		}
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
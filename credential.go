@@ -0,0 +1,240 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectorFactory returns a driver.Connector connecting to a target with current credentials,
+// e.g. with a fresh IAM auth token or a renewed TLS certificate, such as `mysql.NewConnector(cfg)` of go-sql-driver
+// or `stdlib.GetConnector(cfg)` of pgx
+type ConnectorFactory func(ctx context.Context) (driver.Connector, error)
+
+// OpenRotating opens a `*sql.DB` connecting by the driver.Connector returned by factory,
+// which is recreated by `RotateCredentials()` of `DB` the handle is passed to by `New()`, so that credentials
+// expiring hourly are rotated without restarts while the handle stays the same. It returns the error of factory.
+//
+// Connections implement optional interfaces of `database/sql/driver` used by `database/sql`,
+// but not driver-specific ones.
+func OpenRotating(ctx context.Context, factory ConnectorFactory) (*sql.DB, error) {
+	connector, err := factory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &rotatingConnector{factory: factory}
+	c.current.Store(&connectorGeneration{connector: connector, id: 1})
+	return sql.OpenDB(c), nil
+}
+
+// RotateCredentials recreates the connector of the target named name by its ConnectorFactory, e.g. as credentials
+// rotate, emitting `EventCredentialsRotated`. New connections are made by the new connector at once,
+// and connections made by old ones are closed instead of being reused once they are idle,
+// draining them without failing statements in flight. It keeps the current connector if the factory fails.
+// It returns an error wrapping `ErrInvalidConfig` if the target is unknown or not opened by `OpenRotating()`.
+func (db *DB) RotateCredentials(ctx context.Context, name string) error {
+	handle, info := db.targetByName(name)
+	if handle == nil {
+		return fmt.Errorf("%w: no target named %q", ErrInvalidConfig, name)
+	}
+	c, ok := rotatingConnectorOf(handle)
+	if !ok {
+		return fmt.Errorf("%w: target %q is not opened by OpenRotating", ErrInvalidConfig, name)
+	}
+	if err := c.rotate(ctx); err != nil {
+		db.debugf(DebugError, "[RotateCredentials] target: %s err: %s", name, err)
+		return err
+	}
+	db.emit(Event{Type: EventCredentialsRotated, Target: info})
+	return nil
+}
+
+// SetCredentialRotation rotates credentials of all targets opened by `OpenRotating()` by `RotateCredentials()`
+// every interval in background, e.g. shorter than the lifetime of IAM auth tokens. Failures are printed as debug output
+// and retried in the next interval. Passing non-positive interval stops rotation, which is the default.
+func (db *DB) SetCredentialRotation(interval time.Duration) {
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+	if db.credentialRotation != nil {
+		db.credentialRotation.Stop()
+		db.credentialRotation = nil
+	}
+	if interval <= 0 || db.closed {
+		return
+	}
+	db.credentialRotation = startHeartbeater(interval, func() {
+		primary, replicas := db.Targets()
+		for _, info := range append([]TargetInfo{primary}, replicas...) {
+			handle, _ := db.targetByName(info.Name)
+			if _, ok := rotatingConnectorOf(handle); !ok {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			db.RotateCredentials(ctx, info.Name)
+			cancel()
+		}
+	})
+}
+
+// targetByName returns the handle and TargetInfo of the target named name, nil if none
+func (db *DB) targetByName(name string) (*sql.DB, TargetInfo) {
+	primary, replicas := db.Targets()
+	if primary.Name == name && db.master != nil {
+		return db.master, primary
+	}
+	for i, info := range replicas {
+		if info.Name == name {
+			return db.readreplicas[i], info
+		}
+	}
+	return nil, TargetInfo{}
+}
+
+// rotatingConnectorOf returns the connector of handle if it is opened by `OpenRotating()`
+func rotatingConnectorOf(handle *sql.DB) (*rotatingConnector, bool) {
+	if handle == nil {
+		return nil, false
+	}
+	d, ok := handle.Driver().(rotatingDriver)
+	return d.connector, ok
+}
+
+// rotatingConnector is a driver.Connector connecting by the connector of the current generation
+type rotatingConnector struct {
+	factory ConnectorFactory
+
+	// rotateMutex serializes rotations, and current holds *connectorGeneration
+	rotateMutex sync.Mutex
+	current     atomic.Value
+}
+
+// connectorGeneration is a connector made by ConnectorFactory, identified by id increasing on each rotation
+type connectorGeneration struct {
+	connector driver.Connector
+	id        uint64
+}
+
+func (c *rotatingConnector) generation() *connectorGeneration {
+	return c.current.Load().(*connectorGeneration)
+}
+
+// Connect connects by the connector of the current generation
+func (c *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	g := c.generation()
+	conn, err := g.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingConn{Conn: conn, connector: c, generation: g.id}, nil
+}
+
+// Driver returns rotatingDriver of c, so that c can be found from `*sql.DB`
+func (c *rotatingConnector) Driver() driver.Driver {
+	return rotatingDriver{connector: c}
+}
+
+// rotate replaces the connector by a new one of the factory, keeping the current one on errors
+func (c *rotatingConnector) rotate(ctx context.Context) error {
+	c.rotateMutex.Lock()
+	defer c.rotateMutex.Unlock()
+	connector, err := c.factory(ctx)
+	if err != nil {
+		return err
+	}
+	c.current.Store(&connectorGeneration{connector: connector, id: c.generation().id + 1})
+	return nil
+}
+
+// rotatingDriver is the driver.Driver of rotatingConnector, opening by the driver of the current connector
+type rotatingDriver struct {
+	connector *rotatingConnector
+}
+
+// Open opens a connection by the driver of the current connector
+func (d rotatingDriver) Open(name string) (driver.Conn, error) {
+	return d.connector.generation().connector.Driver().Open(name)
+}
+
+// rotatingConn is a connection of a generation of rotatingConnector, invalid once rotated
+type rotatingConn struct {
+	driver.Conn
+	connector  *rotatingConnector
+	generation uint64
+}
+
+// stale returns true if c is made by a connector of old credentials
+func (c *rotatingConn) stale() bool {
+	return c.connector.generation().id != c.generation
+}
+
+// IsValid returns false for stale connections, so that `database/sql` closes them instead of returning to the pool
+func (c *rotatingConn) IsValid() bool {
+	if c.stale() {
+		return false
+	}
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// ResetSession returns `driver.ErrBadConn` for stale connections, so that `database/sql` never reuses them
+func (c *rotatingConn) ResetSession(ctx context.Context) error {
+	if c.stale() {
+		return driver.ErrBadConn
+	}
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *rotatingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *rotatingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support non-default isolation level or read-only transactions")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *rotatingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rotatingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rotatingConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *rotatingConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
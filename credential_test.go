@@ -0,0 +1,83 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRotateCredentials(t *testing.T) {
+	var mocks []sqlmock.Sqlmock
+	var connectors []driver.Connector
+	for i := 1; i <= 2; i++ {
+		dsn := uniqueDSN(fmt.Sprintf("credential_%d", i))
+		mockdb, mock, err := sqlmock.NewWithDSN(dsn)
+		if err != nil {
+			t.Fatalf("error %s when creating mock databasen", err)
+		}
+		mocks = append(mocks, mock)
+		connectors = append(connectors, dsnConnector{dsn, mockdb.Driver()})
+	}
+	generation := 0
+	factoryErr := errors.New("token expired")
+	factory := func(context.Context) (driver.Connector, error) {
+		if generation >= len(connectors) {
+			return nil, factoryErr
+		}
+		generation++
+		return connectors[generation-1], nil
+	}
+	background := context.Background()
+	r1, err := OpenRotating(background, factory)
+	if err != nil {
+		t.Fatalf("error %s when OpenRotating", err)
+	}
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1)
+	defer db.Close()
+	var events []Event
+	db.OnEvent(func(e Event) { events = append(events, e) })
+
+	query := fmt.Sprintf(selectQueryTmpl, "*")
+	for i, mock := range mocks {
+		mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(i))
+		var n int
+		if err = db.QueryRowContext(background, query).Scan(&n); err != nil || n != i {
+			t.Errorf("actual %d, %v, expected %d of generation %d", n, err, i, i+1)
+		}
+		if i == 0 {
+			if err = db.RotateCredentials(background, "replica-0"); err != nil {
+				t.Errorf("error %s when RotateCredentials", err)
+			}
+		}
+	}
+	if err = db.RotateCredentials(background, "replica-0"); !errors.Is(err, factoryErr) {
+		t.Errorf("actual err: %v, expected: %s", err, factoryErr)
+	}
+	mocks[1].ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	if err = db.QueryRowContext(background, query).Scan(new(int)); err != nil {
+		t.Errorf("error %s when QueryRowContext after failed rotation", err)
+	}
+
+	if err = db.RotateCredentials(background, "primary"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrInvalidConfig)
+	}
+	if err = db.RotateCredentials(background, "replica-9"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrInvalidConfig)
+	}
+	if len(events) != 1 || events[0].Type != EventCredentialsRotated || events[0].Target.Name != "replica-0" {
+		t.Errorf("actual events: %+v, expected: one %s of replica-0", events, EventCredentialsRotated)
+	}
+	for _, mock := range mocks {
+		if err = mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
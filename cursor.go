@@ -0,0 +1,278 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// errCursorClosed is the error of fetches of a closed Cursor
+var errCursorClosed = errors.New("cursor is closed")
+
+// cursorSeq numbers names of cursors
+var cursorSeq uint64
+
+// Cursor is a server-side cursor declared by `DeclareCursor()` (`DECLARE CURSOR` / `FETCH` of PostgreSQL).
+// A cursor only exists in the transaction and on the connection it is declared on, so all its operations
+// run on the same connection of the same target, holding it until `Close()`.
+type Cursor struct {
+	db     *DB
+	name   string
+	target *sql.DB
+	conn   *sql.Conn
+	tx     *sql.Tx
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+}
+
+// DeclareCursor declares a server-side cursor of query, a read routed as `QueryContext()` is,
+// and returns it to fetch rows of large results in batches by `Cursor.Fetch()`.
+// The cursor is declared in a read-only transaction on a connection dedicated to it, so that
+// fetches are never sent to other connections or targets of the round-robin.
+// It lives until `Cursor.Close()` or until ctx is done, when the transaction is rolled back,
+// which closes the cursor on the server, and the connection is returned to the pool.
+// Only PostgreSQL (and compatible DBs) supports the syntax.
+func (db *DB) DeclareCursor(ctx context.Context, query string, args ...interface{}) (*Cursor, error) {
+	cluster, err := db.partitionCluster(ctx, query)
+	if err != nil {
+		db.debugf(DebugError, "[DeclareCursor] partition err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if cluster != nil {
+		return cluster.DeclareCursor(ctx, query, args...)
+	}
+	c, err := db.declareCursor(ctx, query, args)
+	if err != nil {
+		db.debugf(DebugError, "[DeclareCursor] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	go c.watch(ctx)
+	return c, nil
+}
+
+// declareCursor declares the cursor of query on the target routed by ctx
+func (db *DB) declareCursor(ctx context.Context, query string, args []interface{}) (*Cursor, error) {
+	if err := checkNotInTx(ctx, "DeclareCursor"); err != nil {
+		return nil, err
+	}
+	if err := db.checkDirectives(ctx, "DeclareCursor", query, false); err != nil {
+		return nil, err
+	}
+	if err := db.validateQueryContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+	if forcePrimary, _ := checkExplain(query); forcePrimary {
+		// EXPLAIN ANALYZE of writes is not a cursor
+		return nil, ErrNotQuerySQL
+	}
+	ctx = db.withQueryTables(db.withPinnedTables(ctx, query), query)
+	name := "gosqlrwdb_cursor_" + strconv.FormatUint(atomic.AddUint64(&cursorSeq, 1), 10)
+	query = "DECLARE " + name + " NO SCROLL CURSOR FOR " + db.rebind(query)
+	ctx, stmt := db.beginStatement(ctx, "DeclareCursor", query, args)
+
+	var c *Cursor
+	declare := func(tgtdb *sql.DB) error {
+		var err error
+		c, err = db.declareCursorOn(ctx, stmt, tgtdb, name, query, args)
+		return err
+	}
+	if UsePrimaryFromContext(ctx) && !db.PrimaryInMaintenance() && !db.redirectPrimaryReads() {
+		if !DoValidateNew && db.master == nil {
+			return nil, ErrNotProvidedPrimary
+		}
+		db.countRead(db.master)
+		err := declare(db.master)
+		return c, err
+	}
+	if UsePrimaryFromContext(ctx) {
+		db.countFallback()
+	}
+	err := db.readReplica(ctx, ExactReplicaOrderFromContext(ctx), declare)
+	return c, err
+}
+
+// declareCursorOn declares the cursor named name by query on a connection of tgtdb
+func (db *DB) declareCursorOn(ctx context.Context, stmt StatementInfo, tgtdb *sql.DB, name, query string, args []interface{}) (*Cursor, error) {
+	conn, err := tgtdb.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	err = db.runStatement(ctx, stmt, tgtdb, func(query string) error {
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		tx.Rollback()
+		conn.Close()
+		return nil, err
+	}
+	db.debugf(DebugRouting, "[DeclareCursor] cursor: %s target: %s", name, db.targetInfo(tgtdb).Name)
+	return &Cursor{db: db, name: name, target: tgtdb, conn: conn, tx: tx, done: make(chan struct{})}, nil
+}
+
+// watch closes c when ctx of its declaration is done
+func (c *Cursor) watch(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		c.db.debugf(DebugEvent, "[DeclareCursor] close cursor: %s err: %s", c.name, ctx.Err())
+		c.Close()
+	case <-c.done:
+	}
+}
+
+// Name returns the name of the cursor on the server
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+// Target returns the DB the cursor is declared on
+func (c *Cursor) Target() TargetInfo {
+	return c.db.targetInfo(c.target)
+}
+
+// Fetch fetches the next n rows of the cursor on its connection, no rows after the last one
+func (c *Cursor) Fetch(ctx context.Context, n int) (*sql.Rows, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: number of rows to fetch %d is not positive", ErrInvalidConfig, n)
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, errCursorClosed
+	}
+	c.db.countRead(c.target)
+	query := "FETCH FORWARD " + strconv.Itoa(n) + " FROM " + c.name
+	ctx, stmt := c.db.beginStatement(ctx, "Cursor.Fetch", query, nil)
+	var rows *sql.Rows
+	err := c.db.runStatement(ctx, stmt, c.target, func(query string) error {
+		var err error
+		rows, err = c.tx.QueryContext(ctx, query)
+		return err
+	})
+	if err != nil {
+		c.db.debugf(DebugError, "[Cursor.Fetch] cursor: %s err: %s", c.name, err)
+		c.db.metrics.countError(err)
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Close closes the cursor by rolling back its transaction and returns its connection to the pool.
+// Rows fetched must be closed before.
+func (c *Cursor) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	err := c.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		// rolled back by the context of the declaration
+		err = nil
+	}
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Keyset is a read paged by keyset pagination ("seek method") by `QueryKeyset()`: each page selects rows
+// after the key of the last row of the previous page, which stays fast on deep pages unlike `OFFSET`.
+type Keyset struct {
+	// Query selects a page of rows ordered by the key, with placeholders of Args, followed by the key values of
+	// the last row of the previous page (Start for the first page), followed by the page size, e.g.
+	// `SELECT id, name FROM users WHERE org_id = ? AND id > ? ORDER BY id LIMIT ?`
+	Query string
+	Args  []interface{}
+
+	// Start is the key values before the first row, e.g. 0 for positive ids
+	Start []interface{}
+
+	// PageSize is the maximum number of rows of a page, must be positive
+	PageSize int
+}
+
+// QueryKeyset reads all pages of k, calling fn for each row as `QueryEach()` does, and fn returns the key values
+// of the row. The first page is routed as `QueryContext()` is, and the following pages are read from the same target,
+// so that pages are not mixed up by replication lag of different read replicas; they fail if the target fails.
+// Reading stops after a page with fewer rows than `PageSize`, or at the first error returned by fn.
+func (db *DB) QueryKeyset(ctx context.Context, k Keyset, fn func(scan func(dest ...interface{}) error) ([]interface{}, error)) error {
+	if k.PageSize <= 0 {
+		return fmt.Errorf("%w: page size %d is not positive", ErrInvalidConfig, k.PageSize)
+	}
+	cluster, err := db.partitionCluster(ctx, k.Query)
+	if err != nil {
+		db.debugf(DebugError, "[QueryKeyset] partition err: %s", err)
+		db.metrics.countError(err)
+		return err
+	}
+	if cluster != nil {
+		return cluster.QueryKeyset(ctx, k, fn)
+	}
+
+	key := k.Start
+	rows, target, err := db.queryContext(ctx, k.Query, keysetArgs(k, key)...)
+	query := db.rebind(k.Query)
+	for page := 1; ; page++ {
+		if err != nil {
+			return err
+		}
+		n := 0
+		err = func() error {
+			defer rows.Close()
+			for rows.Next() {
+				n++
+				if key, err = fn(rows.Scan); err != nil {
+					return err
+				}
+			}
+			return rows.Err()
+		}()
+		if err != nil || n < k.PageSize {
+			return err
+		}
+		db.debugf(DebugRouting, "[QueryKeyset] page: %d target: %s", page+1, db.targetInfo(target).Name)
+		rows, err = db.queryKeysetPage(ctx, target, query, keysetArgs(k, key))
+	}
+}
+
+// queryKeysetPage reads a page of `QueryKeyset()` from tgtdb
+func (db *DB) queryKeysetPage(ctx context.Context, tgtdb *sql.DB, query string, args []interface{}) (*sql.Rows, error) {
+	ctx, stmt := db.beginStatement(ctx, "QueryKeyset", query, args)
+	db.countRead(tgtdb)
+	var rows *sql.Rows
+	err := db.runStatement(ctx, stmt, tgtdb, func(query string) error {
+		var err error
+		rows, err = tgtdb.QueryContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		db.debugf(DebugError, "[QueryKeyset] err: %s", err)
+		db.metrics.countError(err)
+	}
+	return rows, err
+}
+
+// keysetArgs returns args of a page of k after key
+func keysetArgs(k Keyset, key []interface{}) []interface{} {
+	args := make([]interface{}, 0, len(k.Args)+len(key)+1)
+	args = append(args, k.Args...)
+	args = append(args, key...)
+	return append(args, k.PageSize)
+}
@@ -0,0 +1,157 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDeclareCursor(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+
+	// declared and fetched on the same read replica
+	r0.mock.ExpectBegin()
+	r0.mock.ExpectExec("DECLARE gosqlrwdb_cursor_[0-9]+ NO SCROLL CURSOR FOR select id from mytable").
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	r0.mock.ExpectQuery("FETCH FORWARD 2 FROM gosqlrwdb_cursor_").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	r0.mock.ExpectQuery("FETCH FORWARD 2 FROM gosqlrwdb_cursor_").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	r0.mock.ExpectRollback()
+	c, err := db.DeclareCursor(context.Background(), "select id from mytable where id > ?", 1)
+	if err != nil {
+		t.Fatalf("error %s when DeclareCursor", err)
+	}
+	if actual := c.Target().Name; actual != "replica-0" {
+		t.Errorf("actual target: %s, expected: replica-0", actual)
+	}
+	var ids []int
+	for i := 0; i < 2; i++ {
+		rows, err := c.Fetch(context.Background(), 2)
+		if err != nil {
+			t.Fatalf("error %s when Fetch", err)
+		}
+		for rows.Next() {
+			var id int
+			rows.Scan(&id)
+			ids = append(ids, id)
+		}
+		rows.Close()
+	}
+	if expected := []int{1, 2, 3}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("actual ids: %v, expected: %v", ids, expected)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("error %s when Close", err)
+	}
+	if _, err := c.Fetch(context.Background(), 2); !errors.Is(err, errCursorClosed) {
+		t.Errorf("actual err: %v, expected: %s", err, errCursorClosed)
+	}
+
+	// closed when the context of the declaration is done
+	r1.mock.ExpectBegin()
+	r1.mock.ExpectExec("DECLARE gosqlrwdb_cursor_[0-9]+ NO SCROLL CURSOR FOR select id from mytable").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	r1.mock.ExpectRollback()
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err = db.DeclareCursor(ctx, "select id from mytable")
+	if err != nil {
+		t.Fatalf("error %s when DeclareCursor", err)
+	}
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := c.Fetch(context.Background(), 1); errors.Is(err, errCursorClosed) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("actual cursor open, expected closed by the context")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// writes are never cursors
+	if _, err := db.DeclareCursor(context.Background(), "update mytable set id = 1"); !errors.Is(err, ErrNotQuerySQL) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrNotQuerySQL)
+	}
+
+	for _, m := range []*mydbMock{p, r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestQueryKeyset(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+
+	// all pages on the read replica of the first page
+	query := "select id from mytable where org_id = ? and id > ? order by id limit ?"
+	r0.mock.ExpectQuery("select id from mytable").WithArgs(7, 0, 2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	r0.mock.ExpectQuery("select id from mytable").WithArgs(7, 2, 2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(4))
+	r0.mock.ExpectQuery("select id from mytable").WithArgs(7, 4, 2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	var ids []int
+	err = db.QueryKeyset(context.Background(), Keyset{Query: query, Args: []interface{}{7}, Start: []interface{}{0}, PageSize: 2},
+		func(scan func(dest ...interface{}) error) ([]interface{}, error) {
+			var id int
+			if err := scan(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+			return []interface{}{id}, nil
+		})
+	if err != nil {
+		t.Errorf("error %s when QueryKeyset", err)
+	}
+	if expected := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("actual ids: %v, expected: %v", ids, expected)
+	}
+
+	// stops at errors of fn
+	fnErr := errors.New("stop")
+	r1.mock.ExpectQuery("select id from mytable").WithArgs(7, 0, 2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	err = db.QueryKeyset(context.Background(), Keyset{Query: query, Args: []interface{}{7}, Start: []interface{}{0}, PageSize: 2},
+		func(scan func(dest ...interface{}) error) ([]interface{}, error) {
+			return nil, fnErr
+		})
+	if !errors.Is(err, fnErr) {
+		t.Errorf("actual err: %v, expected: %s", err, fnErr)
+	}
+	if err := db.QueryKeyset(context.Background(), Keyset{Query: query}, nil); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrInvalidConfig)
+	}
+
+	for _, m := range []*mydbMock{p, r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
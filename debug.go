@@ -0,0 +1,66 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+)
+
+// DebugLevel is the level of debug output of a `DB`. Each level includes output of lower levels.
+type DebugLevel int
+
+const (
+	// DebugOff prints nothing
+	DebugOff DebugLevel = iota
+
+	// DebugError prints errors returned to callers
+	DebugError
+
+	// DebugEvent prints failovers, fallbacks, evictions and changes of health or configuration, never sampled
+	DebugEvent
+
+	// DebugRouting prints every routing decision, sampled by `DebugConfig.SampleRate`
+	DebugRouting
+)
+
+// DebugConfig is the configuration of debug output of a `DB`
+type DebugConfig struct {
+	Level DebugLevel
+
+	// SampleRate is the fraction of routing decisions printed at `DebugRouting` level, e.g. 0.01 for 1%.
+	// All routing decisions are printed if zero.
+	SampleRate float64
+
+	// Printf prints debug output, `fmt.Printf` if nil
+	Printf func(format string, a ...interface{})
+}
+
+// SetDebug sets debug output of db, overriding the package-level `Debug` for db.
+// It is safe to call concurrently with other methods.
+func (db *DB) SetDebug(c DebugConfig) {
+	if c.Printf == nil {
+		c.Printf = func(format string, a ...interface{}) {
+			fmt.Printf(format, a...)
+		}
+	}
+	db.debugConfig.Store(&c)
+}
+
+// debugf prints debug information of level if enabled by `SetDebug()`,
+// or by package-level `Debug` as of creating db if `SetDebug()` is not called
+func (db *DB) debugf(level DebugLevel, format string, a ...interface{}) {
+	c, _ := db.debugConfig.Load().(*DebugConfig)
+	if c == nil {
+		if atomic.LoadUint32(&db.debugDefault) == 1 {
+			fmt.Printf("[mydb] "+format+"\n", a...)
+		}
+		return
+	}
+	if level > c.Level {
+		return
+	}
+	if level == DebugRouting && c.SampleRate > 0 && c.SampleRate < 1 && rand.Float64() >= c.SampleRate {
+		return
+	}
+	c.Printf("[mydb] "+format+"\n", a...)
+}
@@ -0,0 +1,81 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetDebug(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   DebugConfig
+		expected []string
+	}{
+		{"off", DebugConfig{Level: DebugOff}, nil},
+		{"error", DebugConfig{Level: DebugError}, []string{"error"}},
+		{"event", DebugConfig{Level: DebugEvent}, []string{"error", "event"}},
+		{"routing", DebugConfig{Level: DebugRouting}, []string{"error", "event", "routing", "routing"}},
+		{"sampled", DebugConfig{Level: DebugRouting, SampleRate: 1e-12}, []string{"error", "event"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newMydbMock()
+			if err != nil {
+				t.Fatalf("error %s when creating mock databasen", err)
+			}
+			db := New(p.db)
+			defer db.Close()
+
+			var actual []string
+			tt.config.Printf = func(format string, a ...interface{}) {
+				if !strings.HasPrefix(format, "[mydb] ") {
+					t.Errorf("actual format: %q, expected prefix: [mydb]", format)
+				}
+				actual = append(actual, fmt.Sprintf(strings.TrimPrefix(format, "[mydb] "), a...))
+			}
+			db.SetDebug(tt.config)
+			db.debugf(DebugError, "error")
+			db.debugf(DebugEvent, "event")
+			db.debugf(DebugRouting, "routing")
+			db.debugf(DebugRouting, "routing")
+
+			if len(actual) != len(tt.expected) {
+				t.Fatalf("actual output: %q, expected: %q", actual, tt.expected)
+			}
+			for i := range actual {
+				if actual[i] != tt.expected[i]+"\n" {
+					t.Errorf("actual output: %q, expected: %q", actual, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugReadOnCreate(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	original := Debug
+	defer func() { Debug = original }()
+
+	Debug = true
+	db := New(p.db)
+	defer db.Close()
+	Debug = false
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		db.debugf(DebugRouting, "routing")
+	}()
+	Debug = true
+	<-done
+
+	if actual := atomic.LoadUint32(&db.debugDefault); actual != 1 {
+		t.Errorf("actual debugDefault: %d, expected: 1", actual)
+	}
+}
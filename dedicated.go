@@ -0,0 +1,196 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Reconnections of `DedicatedConn.Do()`
+const (
+	defaultDedicatedReconnects = 3
+	dedicatedReconnectBackoff  = 100 * time.Millisecond
+)
+
+// errDedicatedConnClosed is the error of `Do()` of a closed DedicatedConn
+var errDedicatedConnClosed = errors.New("dedicated connection is closed")
+
+// DedicatedConn is a long-lived connection of `WithDedicatedConn()`, e.g. for `LISTEN` / `NOTIFY`
+// or consumers of replication slots, which reconnects by itself when the connection breaks.
+type DedicatedConn struct {
+	db   *DB
+	role Role
+
+	mu     sync.Mutex
+	target *sql.DB
+	conn   *sql.Conn
+	closed bool
+}
+
+// WithDedicatedConn returns a connection dedicated to the caller on a target of role: primary DB,
+// or a read replica selected as reads are. The connection is held until `DedicatedConn.Close()`,
+// and is excluded from connections in use of the target in `StatsReport` and `SpilloverPolicy`,
+// as a connection idle in `LISTEN` is not load; it still counts in `MaxOpenConns` of the target.
+// It returns an error wrapping `ErrInvalidConfig` if role is unknown.
+func (db *DB) WithDedicatedConn(ctx context.Context, role Role) (*DedicatedConn, error) {
+	if role != RolePrimary && role != RoleReplica {
+		return nil, fmt.Errorf("%w: role %s of dedicated connection is unknown", ErrInvalidConfig, role)
+	}
+	c := &DedicatedConn{db: db, role: role}
+	c.mu.Lock()
+	err := c.connect(ctx, nil)
+	c.mu.Unlock()
+	if err != nil {
+		db.debugf(DebugError, "[WithDedicatedConn] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	return c, nil
+}
+
+// Target returns the DB of the current connection
+func (c *DedicatedConn) Target() TargetInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.db.targetInfo(c.target)
+}
+
+// Do calls fn with the connection. If fn fails by a broken connection (`ErrorClassConnection`),
+// the connection is dropped and fn is called again on a new one, on another read replica if any,
+// up to 3 times with backoff (or as limited by `WithMaxAttempts()`), so fn must set up the session
+// (e.g. `LISTEN channel`) by itself each time. The error returned by fn is returned as it is otherwise.
+// Do must not be called concurrently, and ctx of a running Do should be canceled before `Close()`.
+func (c *DedicatedConn) Do(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	reconnects := defaultDedicatedReconnects
+	if n := MaxAttemptsFromContext(ctx); n > 0 {
+		reconnects = n - 1
+	}
+	for attempt := 0; ; attempt++ {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return errDedicatedConnClosed
+		}
+		var err error
+		if c.conn == nil {
+			err = c.connect(ctx, nil)
+		}
+		conn, target := c.conn, c.target
+		c.mu.Unlock()
+		if err == nil {
+			err = fn(conn)
+		}
+		if err == nil || attempt >= reconnects || ctx.Err() != nil || ClassifyError(err) != ErrorClassConnection {
+			if err != nil {
+				c.db.debugf(DebugError, "[DedicatedConn.Do] err: %s", err)
+			}
+			c.db.metrics.countError(err)
+			return err
+		}
+
+		c.db.debugf(DebugEvent, "[DedicatedConn.Do] reconnect, target: %s err: %s", c.db.targetInfo(target).Name, err)
+		c.mu.Lock()
+		if c.conn == conn {
+			c.release()
+		}
+		if !c.closed && c.conn == nil {
+			err = c.connect(ctx, target)
+		}
+		c.mu.Unlock()
+		if err != nil {
+			c.db.debugf(DebugError, "[DedicatedConn.Do] reconnect err: %s", err)
+		}
+		if attempt > 0 {
+			timer := time.NewTimer(dedicatedReconnectBackoff << uint(attempt-1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// Close returns the connection to the pool
+func (c *DedicatedConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	return c.release()
+}
+
+// connect connects to a target of the role of c, another read replica than failed if any, with c.mu locked
+func (c *DedicatedConn) connect(ctx context.Context, failed *sql.DB) error {
+	db := c.db
+	target := db.master
+	if c.role == RolePrimary {
+		if db.PrimaryInMaintenance() {
+			return ErrPrimaryInMaintenance
+		}
+		if !DoValidateNew && db.master == nil {
+			return ErrNotProvidedPrimary
+		}
+	} else {
+		target = nil
+		if failed != nil {
+			target = db.untriedReplica(ctx, false, map[*sql.DB]struct{}{failed: empty})
+		}
+		if target == nil {
+			var err error
+			if target, err = db.selectReplica(ctx, false); err != nil {
+				return err
+			}
+		}
+	}
+	conn, err := target.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	db.countMutex.Lock()
+	db.dedicatedConns[target]++
+	db.countMutex.Unlock()
+	db.debugf(DebugRouting, "[WithDedicatedConn] target: %s", db.targetInfo(target).Name)
+	c.target, c.conn = target, conn
+	return nil
+}
+
+// release returns the connection to the pool, with c.mu locked
+func (c *DedicatedConn) release() error {
+	c.db.countMutex.Lock()
+	if c.db.dedicatedConns[c.target]--; c.db.dedicatedConns[c.target] <= 0 {
+		delete(c.db.dedicatedConns, c.target)
+	}
+	c.db.countMutex.Unlock()
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// inUse returns the number of connections in use of target, excluding dedicated ones of `WithDedicatedConn()`
+func (db *DB) inUse(target *sql.DB) int {
+	inUse := target.Stats().InUse
+	db.countMutex.RLock()
+	inUse -= db.dedicatedConns[target]
+	db.countMutex.RUnlock()
+	if inUse < 0 {
+		return 0
+	}
+	return inUse
+}
+
+// dedicated returns the number of dedicated connections of `WithDedicatedConn()` of target
+func (db *DB) dedicated(target *sql.DB) int {
+	db.countMutex.RLock()
+	defer db.countMutex.RUnlock()
+	return db.dedicatedConns[target]
+}
@@ -0,0 +1,95 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWithDedicatedConn(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+
+	c, err := db.WithDedicatedConn(context.Background(), RoleReplica)
+	if err != nil {
+		t.Fatalf("error %s when WithDedicatedConn", err)
+	}
+	if actual := c.Target().Name; actual != "replica-0" {
+		t.Errorf("actual target: %s, expected: replica-0", actual)
+	}
+	report := db.statsReport(db.Metrics(), db.Metrics(), time.Second, time.Now())
+	if report.ReplicasInUse != 0 || report.DedicatedConns != 1 {
+		t.Errorf("actual in use: %d, dedicated: %d, expected: 0 in use, 1 dedicated", report.ReplicasInUse, report.DedicatedConns)
+	}
+
+	// reconnected on another read replica by broken connections, calling fn again
+	connErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection refused")}
+	r0.mock.ExpectExec("LISTEN mychannel").WillReturnError(connErr)
+	r1.mock.ExpectExec("LISTEN mychannel").WillReturnResult(sqlmock.NewResult(0, 0))
+	calls := 0
+	err = c.Do(context.Background(), func(conn *sql.Conn) error {
+		calls++
+		_, err := conn.ExecContext(context.Background(), "LISTEN mychannel")
+		return err
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("actual err: %v, calls: %d, expected: no error by 2 calls", err, calls)
+	}
+	if actual := c.Target().Name; actual != "replica-1" {
+		t.Errorf("actual target: %s, expected: replica-1", actual)
+	}
+	if r0.db.Stats().InUse != 0 || db.dedicated(r0.db) != 0 || db.dedicated(r1.db) != 1 {
+		t.Errorf("actual dedicated: %d & %d, expected: 0 & 1", db.dedicated(r0.db), db.dedicated(r1.db))
+	}
+
+	// other errors as they are
+	fnErr := errors.New("invalid notification")
+	if err := c.Do(context.Background(), func(*sql.Conn) error { return fnErr }); err != fnErr {
+		t.Errorf("actual err: %v, expected: %s", err, fnErr)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("error %s when Close", err)
+	}
+	if r1.db.Stats().InUse != 0 || db.dedicated(r1.db) != 0 {
+		t.Errorf("actual in use: %d, dedicated: %d, expected: 0 after Close", r1.db.Stats().InUse, db.dedicated(r1.db))
+	}
+	if err := c.Do(context.Background(), func(*sql.Conn) error { return nil }); !errors.Is(err, errDedicatedConnClosed) {
+		t.Errorf("actual err: %v, expected: %s", err, errDedicatedConnClosed)
+	}
+
+	c, err = db.WithDedicatedConn(context.Background(), RolePrimary)
+	if err != nil {
+		t.Fatalf("error %s when WithDedicatedConn", err)
+	}
+	if actual := c.Target().Name; actual != "primary" {
+		t.Errorf("actual target: %s, expected: primary", actual)
+	}
+	c.Close()
+	if _, err := db.WithDedicatedConn(context.Background(), Role(9)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrInvalidConfig)
+	}
+
+	for _, m := range []*mydbMock{p, r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Dialect supplies what differs among SQL flavors: statement classification quirks, placeholders,
+// replication lag and read-only role probes, and retryable errors.
+// Set it by `SetDialect()`; `PostgresDialect`, `MySQLDialect`, `SQLiteDialect` and `SQLServerDialect` are provided.
+type Dialect interface {
+	// Name returns the name of the dialect, e.g. `postgres`
+	Name() string
+
+	// IsQuery returns true if query is read-only and can be routed to read replicas
+	IsQuery(query string) bool
+
+	// BindType returns the placeholder style of the dialect
+	BindType() BindType
+
+	// LagQuery returns SQL selecting replication lag of a read replica in seconds as a single number,
+	// empty if not supported
+	LagQuery() string
+
+	// ReadOnlyQuery returns SQL selecting true if connected DB is read-only (i.e. a read replica) as a single boolean,
+	// empty if not supported
+	ReadOnlyQuery() string
+
+	// IsRetryable returns true if err is transient and the statement is worth retrying,
+	// e.g. deadlocks, serialization failures and lost connections
+	IsRetryable(err error) bool
+}
+
+var (
+	// PostgresDialect is the Dialect of PostgreSQL.
+	// `SHOW` and `TABLE` statements are reads; SQLSTATE of errors is taken from `SQLState() string` method
+	// (lib/pq and pgx errors have it).
+	PostgresDialect Dialect = postgresDialect{}
+
+	// MySQLDialect is the Dialect of MySQL / MariaDB.
+	// `SHOW`, `DESCRIBE` and `DESC` statements are reads; error numbers are taken from `Number` field
+	// (go-sql-driver/mysql errors have it).
+	MySQLDialect Dialect = mysqlDialect{}
+
+	// SQLiteDialect is the Dialect of SQLite, which has no replication.
+	// Error codes are taken from `Code` field (mattn/go-sqlite3 errors have it).
+	SQLiteDialect Dialect = sqliteDialect{}
+
+	// SQLServerDialect is the Dialect of Microsoft SQL Server.
+	// Locking table hints (`UPDLOCK`, `XLOCK`, `HOLDLOCK` ...) make reads go to primary DB;
+	// error numbers are taken from `SQLErrorNumber() int32` method (go-mssqldb errors have it).
+	SQLServerDialect Dialect = sqlServerDialect{}
+)
+
+// SetDialect sets the Dialect of db, which classifies statements instead of `IsQuerySqlFunc`,
+// sets placeholders as `SetBindType()` does, and classifies retryable errors as `ErrorClassRetryable`.
+// Passing nil restores the defaults.
+func (db *DB) SetDialect(d Dialect) {
+	bindType := BindQuestion
+	if d != nil {
+		bindType = d.BindType()
+	}
+	db.configMutex.Lock()
+	db.dialect = d
+	db.bindType = bindType
+	db.configMutex.Unlock()
+}
+
+// sqlDialect returns current Dialect, nil if not set
+func (db *DB) sqlDialect() Dialect {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.dialect
+}
+
+// isQuery returns true if query can be routed to read replicas, by Dialect if set or `IsQuerySqlFunc`
+func (db *DB) isQuery(query string) bool {
+	if d := db.sqlDialect(); d != nil {
+		return d.IsQuery(query)
+	}
+	return IsQuerySqlFunc(query)
+}
+
+// classifyError returns the ErrorClass of err by policy, or by `ClassifyError` and Dialect if policy does not classify
+func (db *DB) classifyError(policy *FallbackPolicy, err error) ErrorClass {
+	if policy.Classify != nil {
+		return policy.Classify(err)
+	}
+	class := ClassifyError(err)
+	if d := db.sqlDialect(); class == ErrorClassOther && d != nil && d.IsRetryable(err) {
+		return ErrorClassRetryable
+	}
+	return class
+}
+
+// DialectReadinessCheck returns a ReadinessCheck by d: a read replica is ready
+// if it is read-only and its replication lag is at most maxLag, as far as d supports the probes.
+// Zero maxLag skips the lag probe.
+func DialectReadinessCheck(d Dialect, maxLag time.Duration) *ReadinessCheck {
+	return &ReadinessCheck{Check: func(ctx context.Context, r *sql.DB) error {
+		if q := d.ReadOnlyQuery(); q != "" {
+			var readOnly bool
+			if err := r.QueryRowContext(ctx, q).Scan(&readOnly); err != nil {
+				return err
+			}
+			if !readOnly {
+				return fmt.Errorf("%w: read replica is not read-only", ErrNotReady)
+			}
+		}
+		if q := d.LagQuery(); q != "" && maxLag > 0 {
+			var lag sql.NullFloat64
+			if err := r.QueryRowContext(ctx, q).Scan(&lag); err != nil {
+				return err
+			}
+			seconds := time.Duration(lag.Float64 * float64(time.Second))
+			recordLag(ctx, seconds)
+			if seconds > maxLag {
+				return fmt.Errorf("%w: replication lag %s exceeds %s", ErrNotReady, seconds, maxLag)
+			}
+		}
+		return nil
+	}}
+}
+
+// firstKeyword returns the first keyword of query
+func firstKeyword(query string) string {
+	tokens := keywords(StripLeadingNoise(query))
+	if len(tokens) == 0 {
+		return ""
+	}
+	return tokens[0]
+}
+
+// errorCode returns the integer field or method result named name of err or any error it wraps,
+// so that driver errors are inspected without depending on drivers
+func errorCode(err error, name string) (int64, bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.ValueOf(err)
+		if m := v.MethodByName(name); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+			if out := m.Call(nil)[0]; isInt(out) {
+				return toInt64(out), true
+			}
+		}
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Struct {
+			if f := v.FieldByName(name); f.IsValid() && isInt(f) {
+				return toInt64(f), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func toInt64(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	default:
+		return v.Int()
+	}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) IsQuery(query string) bool {
+	switch firstKeyword(query) {
+	case "show", "table":
+		return true
+	}
+	return isReadQuery(query)
+}
+
+func (postgresDialect) BindType() BindType { return BindDollar }
+
+func (postgresDialect) LagQuery() string {
+	return "SELECT COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)"
+}
+
+func (postgresDialect) ReadOnlyQuery() string { return "SELECT pg_is_in_recovery()" }
+
+func (postgresDialect) IsRetryable(err error) bool {
+	var e interface{ SQLState() string }
+	if !errors.As(err, &e) {
+		return false
+	}
+	state := e.SQLState()
+	switch {
+	case state == "40001", state == "40P01": // serialization_failure, deadlock_detected
+		return true
+	case state == "53300", state == "57P01": // too_many_connections, admin_shutdown
+		return true
+	case len(state) == 5 && state[:2] == "08": // connection_exception
+		return true
+	}
+	return false
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) IsQuery(query string) bool {
+	switch firstKeyword(query) {
+	case "show", "describe", "desc":
+		return true
+	}
+	return isReadQuery(query)
+}
+
+func (mysqlDialect) BindType() BindType { return BindQuestion }
+
+func (mysqlDialect) LagQuery() string {
+	return "SELECT TIMESTAMPDIFF(MICROSECOND, MAX(LAST_APPLIED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP), NOW(6)) / 1000000 " +
+		"FROM performance_schema.replication_applier_status_by_worker"
+}
+
+func (mysqlDialect) ReadOnlyQuery() string {
+	return "SELECT @@global.read_only OR @@global.super_read_only"
+}
+
+func (mysqlDialect) IsRetryable(err error) bool {
+	number, ok := errorCode(err, "Number")
+	if !ok {
+		return false
+	}
+	switch number {
+	case 1205, 1213: // lock wait timeout, deadlock
+		return true
+	case 1040, 2006, 2013: // too many connections, server has gone away, lost connection
+		return true
+	}
+	return false
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) IsQuery(query string) bool { return isReadQuery(query) }
+
+func (sqliteDialect) BindType() BindType { return BindQuestion }
+
+func (sqliteDialect) LagQuery() string { return "" }
+
+func (sqliteDialect) ReadOnlyQuery() string { return "" }
+
+func (sqliteDialect) IsRetryable(err error) bool {
+	code, ok := errorCode(err, "Code")
+	return ok && (code == 5 || code == 6) // SQLITE_BUSY, SQLITE_LOCKED
+}
+
+type sqlServerDialect struct{}
+
+func (sqlServerDialect) Name() string { return "sqlserver" }
+
+func (sqlServerDialect) IsQuery(query string) bool {
+	if !isReadQuery(query) {
+		return false
+	}
+	for _, t := range keywords(StripLeadingNoise(query)) {
+		switch t {
+		case "updlock", "xlock", "holdlock", "tablockx", "serializable":
+			return false
+		}
+	}
+	return true
+}
+
+func (sqlServerDialect) BindType() BindType { return BindAt }
+
+func (sqlServerDialect) LagQuery() string {
+	return "SELECT ISNULL(MAX(secondary_lag_seconds), 0) FROM sys.dm_hadr_database_replica_states WHERE is_local = 1"
+}
+
+func (sqlServerDialect) ReadOnlyQuery() string {
+	return "SELECT CAST(CASE WHEN DATABASEPROPERTYEX(DB_NAME(), 'Updateability') = 'READ_ONLY' THEN 1 ELSE 0 END AS BIT)"
+}
+
+func (sqlServerDialect) IsRetryable(err error) bool {
+	number, ok := errorCode(err, "SQLErrorNumber")
+	if !ok {
+		return false
+	}
+	switch number {
+	case 1205: // deadlock victim
+		return true
+	case 40197, 40501, 40613, 49918, 49919, 49920: // transient errors of Azure SQL
+		return true
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+type pqError struct{ Code string }
+
+func (e *pqError) Error() string    { return "pq: " + e.Code }
+func (e *pqError) SQLState() string { return e.Code }
+
+type mysqlError struct{ Number uint16 }
+
+func (e *mysqlError) Error() string { return fmt.Sprintf("Error %d", e.Number) }
+
+type sqliteError struct{ Code int }
+
+func (e sqliteError) Error() string { return fmt.Sprintf("sqlite error %d", e.Code) }
+
+type mssqlError struct{ Number int32 }
+
+func (e mssqlError) Error() string         { return fmt.Sprintf("mssql: error %d", e.Number) }
+func (e mssqlError) SQLErrorNumber() int32 { return e.Number }
+
+func TestDialectIsQuery(t *testing.T) {
+	tests := []struct {
+		dialect  Dialect
+		query    string
+		expected bool
+	}{
+		{PostgresDialect, "select * from mytable", true},
+		{PostgresDialect, "SHOW server_version", true},
+		{PostgresDialect, "TABLE mytable", true},
+		{PostgresDialect, "select * from mytable for update", false},
+		{MySQLDialect, "SHOW TABLES", true},
+		{MySQLDialect, "describe mytable", true},
+		{MySQLDialect, "DESC mytable", true},
+		{MySQLDialect, "delete from mytable", false},
+		{SQLiteDialect, "select 1", true},
+		{SQLiteDialect, "show tables", false},
+		{SQLServerDialect, "select * from mytable", true},
+		{SQLServerDialect, "select * from mytable with (updlock, rowlock) where id = @p1", false},
+		{SQLServerDialect, "select * from mytable with (nolock)", true},
+	}
+	for _, test := range tests {
+		if actual := test.dialect.IsQuery(test.query); actual != test.expected {
+			t.Errorf("actual = %t, expected = %t, dialect = %s, query = %s", actual, test.expected, test.dialect.Name(), test.query)
+		}
+	}
+}
+
+func TestDialectIsRetryable(t *testing.T) {
+	tests := []struct {
+		dialect  Dialect
+		err      error
+		expected bool
+	}{
+		{PostgresDialect, &pqError{"40001"}, true},
+		{PostgresDialect, fmt.Errorf("wrapped: %w", &pqError{"40P01"}), true},
+		{PostgresDialect, &pqError{"08006"}, true},
+		{PostgresDialect, &pqError{"42601"}, false},
+		{PostgresDialect, fmt.Errorf("syntax error"), false},
+		{MySQLDialect, &mysqlError{1213}, true},
+		{MySQLDialect, &mysqlError{2006}, true},
+		{MySQLDialect, &mysqlError{1064}, false},
+		{SQLiteDialect, sqliteError{5}, true},
+		{SQLiteDialect, sqliteError{19}, false},
+		{SQLServerDialect, mssqlError{1205}, true},
+		{SQLServerDialect, mssqlError{40613}, true},
+		{SQLServerDialect, mssqlError{102}, false},
+	}
+	for _, test := range tests {
+		if actual := test.dialect.IsRetryable(test.err); actual != test.expected {
+			t.Errorf("actual = %t, expected = %t, dialect = %s, err = %s", actual, test.expected, test.dialect.Name(), test.err)
+		}
+	}
+}
+
+func TestSetDialect(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	if _, err = db.Query("SHOW TABLES"); !errors.Is(err, ErrNotQuerySQL) {
+		t.Errorf("actual err: %v, expected: %s without Dialect", err, ErrNotQuerySQL)
+	}
+
+	db.SetDialect(MySQLDialect)
+	r1.mock.ExpectQuery("^SHOW TABLES$").WillReturnRows(sqlmock.NewRows([]string{"table"}).AddRow("mytable"))
+	if _, err = db.Query("SHOW TABLES"); err != nil {
+		t.Errorf("error %s when Query", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	db.SetDialect(PostgresDialect)
+	if actual := db.rebind("select * from mytable where id = ?"); actual != "select * from mytable where id = $1" {
+		t.Errorf("actual = %s, expected placeholders of Postgres", actual)
+	}
+	policy := &FallbackPolicy{Actions: map[ErrorClass]FallbackAction{ErrorClassRetryable: FallbackRetryReplica}}
+	if actual := db.decide(policy, &pqError{"40001"}); actual != FallbackRetryReplica {
+		t.Errorf("actual = %d, expected = %d for retryable error", actual, FallbackRetryReplica)
+	}
+	if actual := db.decide(policy, &pqError{"42601"}); actual != FallbackReturn {
+		t.Errorf("actual = %d, expected = %d for other error", actual, FallbackReturn)
+	}
+
+	db.SetDialect(nil)
+	if actual := db.rebind("select * from mytable where id = ?"); actual != "select * from mytable where id = ?" {
+		t.Errorf("actual = %s, expected placeholders restored", actual)
+	}
+	if actual := db.decide(policy, &pqError{"40001"}); actual != FallbackReturn {
+		t.Errorf("actual = %d, expected = %d without Dialect", actual, FallbackReturn)
+	}
+}
+
+func TestDialectReadinessCheck(t *testing.T) {
+	r, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	defer r.db.Close()
+	check := DialectReadinessCheck(PostgresDialect, 5*time.Second)
+
+	tests := []struct {
+		readOnly bool
+		lag      float64
+		ready    bool
+	}{
+		{true, 1, true},
+		{false, 0, false},
+		{true, 10, false},
+	}
+	for _, test := range tests {
+		r.mock.ExpectQuery("pg_is_in_recovery").WillReturnRows(sqlmock.NewRows([]string{"ro"}).AddRow(test.readOnly))
+		if test.readOnly {
+			r.mock.ExpectQuery("pg_last_xact_replay_timestamp").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(test.lag))
+		}
+		err := check.Check(context.Background(), r.db)
+		if actual := err == nil; actual != test.ready {
+			t.Errorf("actual ready = %t, expected = %t, err = %v", actual, test.ready, err)
+		}
+		if err != nil && !errors.Is(err, ErrNotReady) {
+			t.Errorf("actual err: %s, expected: %s", err, ErrNotReady)
+		}
+	}
+	if err = r.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
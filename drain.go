@@ -0,0 +1,79 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// drainPollInterval is the interval to check whether in-flight reads on a draining replica finished
+var drainPollInterval = 10 * time.Millisecond
+
+// DrainReplica stops routing new reads to the read replica of index i (as passed to `New()`),
+// waits for in-flight reads on it to finish (including open `*sql.Rows`), and then closes it,
+// for graceful node decommissioning during scale-in events.
+//
+// Index of other read replicas is not changed by draining.
+// If ctx is done before in-flight reads finish, ctx.Err() is returned and the replica stays
+// drained (no new reads are routed to it) but not closed, so that `DrainReplica()` can be retried.
+// It does nothing for a read replica which is primary DB as well, e.g. the handle of `NewSingle()`.
+func (db *DB) DrainReplica(ctx context.Context, i int) error {
+	if i < 0 || i >= len(db.readreplicas) {
+		return ErrInvalidReplicaIndex
+	}
+	r := db.readreplicas[i]
+	if r == db.master {
+		db.debugf(DebugEvent, "[DrainReplica] replica idx: %d is primary, not drained", i)
+		return nil
+	}
+
+	db.countMutex.Lock()
+	db.drainedReplicas[r] = empty
+	db.countMutex.Unlock()
+	db.updateQuorum()
+	db.debugf(DebugEvent, "[DrainReplica] replica idx: %d draining", i)
+
+	state := db.replicaStates[r]
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		// wait at least one interval, so that reads which selected r just before draining start on it
+		select {
+		case <-ctx.Done():
+			db.debugf(DebugEvent, "[DrainReplica] replica idx: %d err: %s", i, ctx.Err())
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if atomic.LoadInt64(&state.inflight) == 0 && db.inUse(r) == 0 {
+			break
+		}
+	}
+
+	db.debugf(DebugEvent, "[DrainReplica] replica idx: %d drained", i)
+	return r.Close()
+}
+
+// drained returns true if r is drained by `DrainReplica()`
+func (db *DB) drained(r *sql.DB) bool {
+	db.countMutex.RLock()
+	defer db.countMutex.RUnlock()
+	_, ok := db.drainedReplicas[r]
+	return ok
+}
+
+// activeReplicas returns read replicas not drained by `DrainReplica()`
+func (db *DB) activeReplicas() []*sql.DB {
+	db.countMutex.RLock()
+	defer db.countMutex.RUnlock()
+	if len(db.drainedReplicas) == 0 {
+		return db.readreplicas
+	}
+	replicas := make([]*sql.DB, 0, len(db.readreplicas))
+	for _, r := range db.readreplicas {
+		if _, ok := db.drainedReplicas[r]; !ok {
+			replicas = append(replicas, r)
+		}
+	}
+	return replicas
+}
@@ -0,0 +1,135 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDrainReplica(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	// rows on r2 is open while draining
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	r2.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	rows1, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows1.Close()
+	rows2, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = db.DrainReplica(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("actual err = %v, expected = %s", err, context.DeadlineExceeded)
+	}
+
+	// new reads are not routed to draining r2
+	for i := 0; i < 2; i++ {
+		r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+		rows, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+		if err != nil {
+			t.Fatalf("error %s when QueryContext", err)
+		}
+		rows.Close()
+	}
+
+	rows2.Close()
+	r2.mock.ExpectClose()
+	if err = db.DrainReplica(context.Background(), 1); err != nil {
+		t.Errorf("error %s when DrainReplica", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = db.PingContext(context.Background()); err != nil {
+		t.Errorf("error %s when PingContext after draining", err)
+	}
+	expected := []uint64{3, 1}
+	if actual := db.Metrics().ReadsReplica; actual[0] != expected[0] || actual[1] != expected[1] {
+		t.Errorf("actual reads = %v, expected = %v", actual, expected)
+	}
+
+	r1.mock.ExpectClose()
+	if err = db.DrainReplica(context.Background(), 0); err != nil {
+		t.Errorf("error %s when DrainReplica", err)
+	}
+	if _, err = db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*")); !errors.Is(err, ErrNoReplicaAvailable) {
+		t.Errorf("actual err = %v, expected = %s", err, ErrNoReplicaAvailable)
+	}
+	if _, err = db.QueryContext(WithExactReplicaOrder(context.Background()), fmt.Sprintf(selectQueryTmpl, "*")); !errors.Is(err, ErrNoReplicaAvailable) {
+		t.Errorf("actual err = %v, expected = %s", err, ErrNoReplicaAvailable)
+	}
+}
+
+func TestDrainReplicaInvalidIndex(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	for _, i := range []int{-1, 1} {
+		if err = db.DrainReplica(context.Background(), i); err != ErrInvalidReplicaIndex {
+			t.Errorf("index %d: actual err = %v, expected = %s", i, err, ErrInvalidReplicaIndex)
+		}
+	}
+}
+
+func TestDrainReplicaSingle(t *testing.T) {
+	var err error
+	s, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := NewSingle(s.db)
+
+	if err = db.DrainReplica(context.Background(), 0); err != nil {
+		t.Errorf("error %s when DrainReplica", err)
+	}
+	if db.drained(s.db) {
+		t.Errorf("primary DB should not be drained")
+	}
+	s.mock.ExpectExec("^delete from mytable$").WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err = db.Exec("delete from mytable"); err != nil {
+		t.Errorf("error %s when Exec after DrainReplica", err)
+	}
+	s.mock.ExpectClose()
+	if err = db.Close(); err != nil {
+		t.Errorf("error %s when Close", err)
+	}
+	if err = s.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
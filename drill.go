@@ -0,0 +1,57 @@
+package gosqlrwdb
+
+import "time"
+
+// StartDrill starts a failover drill, pretending primary DB is down so that failover handling can be rehearsed
+// (e.g. in staging) through the same code paths as a real outage:
+// writes are handled by `PrimaryPolicy` as if primary DB failed health checks, returning `*PrimaryUnavailableError`
+// wrapping `ErrDrill` (and counted in metrics), being queued or sent as usual by the default `PrimaryPolicy`,
+// and `EventPrimaryDown` is emitted with `Drill` true.
+// Routing of reads is not affected, e.g. `PrimaryPolicy.RedirectReads` is not applied, nor are health checks.
+// It returns false if a drill is already running.
+func (db *DB) StartDrill() bool {
+	db.countMutex.Lock()
+	if db.drillDown != nil {
+		db.countMutex.Unlock()
+		return false
+	}
+	db.debugf(DebugEvent, "[StartDrill] primary unavailable in drill")
+	db.drillDown = &PrimaryUnavailableError{Since: time.Now(), Err: ErrDrill}
+	db.drillRecovered = make(chan struct{})
+	db.countMutex.Unlock()
+	db.emit(Event{Type: EventPrimaryDown, Target: db.targetInfo(db.master), Err: ErrDrill, Drill: true})
+	return true
+}
+
+// StopDrill stops the failover drill started by `StartDrill()`, releasing queued writes,
+// and emits `EventPrimaryUp` with `Drill` true. It returns false if no drill is running.
+func (db *DB) StopDrill() bool {
+	db.countMutex.Lock()
+	if db.drillDown == nil {
+		db.countMutex.Unlock()
+		return false
+	}
+	db.debugf(DebugEvent, "[StopDrill] primary recovered in drill")
+	db.drillDown = nil
+	close(db.drillRecovered)
+	db.countMutex.Unlock()
+	db.emit(Event{Type: EventPrimaryUp, Target: db.targetInfo(db.master), Drill: true})
+	return true
+}
+
+// InDrill returns true while a failover drill started by `StartDrill()` is running
+func (db *DB) InDrill() bool {
+	db.countMutex.RLock()
+	defer db.countMutex.RUnlock()
+	return db.drillDown != nil
+}
+
+// primaryWriteHealth is `primaryHealth()` for writes, which pretends primary DB is down during a drill
+func (db *DB) primaryWriteHealth() (*PrimaryUnavailableError, <-chan struct{}) {
+	db.countMutex.RLock()
+	defer db.countMutex.RUnlock()
+	if db.drillDown != nil {
+		return db.drillDown, db.drillRecovered
+	}
+	return db.primaryDown, db.primaryRecovered
+}
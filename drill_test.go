@@ -0,0 +1,79 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDrill(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	db.SetPrimaryPolicy(&PrimaryPolicy{Writes: PrimaryWriteFailFast, RedirectReads: true})
+	if err = db.SetTargetInfo(TargetInfo{Role: RolePrimary, Name: "writer"}); err != nil {
+		t.Fatalf("error %s when SetTargetInfo", err)
+	}
+
+	var events []Event
+	db.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+	if !db.StartDrill() || db.StartDrill() || !db.InDrill() {
+		t.Fatalf("drill should start once")
+	}
+
+	_, err = db.Exec(fmt.Sprintf(deleteQuueryTmpl, ""))
+	var pe *PrimaryUnavailableError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrPrimaryUnavailable) || !errors.Is(err, ErrDrill) {
+		t.Errorf("actual err = %v, expected = %s in drill", err, ErrDrill)
+	}
+	if actual := db.Metrics().Errors[ErrorTypePrimaryUnavailable]; actual != 1 {
+		t.Errorf("actual errors = %d, expected = 1", actual)
+	}
+	// reads forced to primary DB are not redirected in drill
+	p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	if _, err := db.QueryContext(WithPrimary(context.Background()), fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when QueryContext", err)
+	}
+
+	db.SetPrimaryPolicy(&PrimaryPolicy{Writes: PrimaryWriteQueue})
+	p.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "")).WillReturnResult(sqlmock.NewResult(0, 1))
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		time.Sleep(20 * time.Millisecond)
+		db.StopDrill()
+	}()
+	if _, err := db.Exec(fmt.Sprintf(deleteQuueryTmpl, "")); err != nil {
+		t.Errorf("error %s when Exec queued until drill stopped", err)
+	}
+	<-stopped
+	if db.StopDrill() || db.InDrill() {
+		t.Errorf("drill should stop once")
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("actual events = %+v, expected 2 events", events)
+	}
+	if events[0].Type != EventPrimaryDown || !events[0].Drill || !errors.Is(events[0].Err, ErrDrill) || events[0].Target.Name != "writer" {
+		t.Errorf("actual event = %+v, expected %s of drill", events[0], EventPrimaryDown)
+	}
+	if events[1].Type != EventPrimaryUp || !events[1].Drill || events[1].Target.Name != "writer" {
+		t.Errorf("actual event = %+v, expected %s of drill", events[1], EventPrimaryUp)
+	}
+	if err := p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,68 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"time"
+)
+
+// duplicate is a handle passed to `New()` more than once
+type duplicate struct {
+	handle *sql.DB
+	err    *DuplicateHandleError
+}
+
+// findDuplicates returns later occurrences of handles passed as primary DB or an earlier read replica,
+// with TargetInfo indexed as passed to `New()`. Nil handles are ignored.
+func findDuplicates(master *sql.DB, readreplicas []*sql.DB) []duplicate {
+	primary, replicas := defaultTargets(len(readreplicas))
+	seen := map[*sql.DB]TargetInfo{}
+	if master != nil {
+		seen[master] = primary
+	}
+	var duplicates []duplicate
+	for i, r := range readreplicas {
+		if r == nil {
+			continue
+		}
+		if first, ok := seen[r]; ok {
+			duplicates = append(duplicates, duplicate{handle: r, err: &DuplicateHandleError{Target: first, Duplicate: replicas[i]}})
+			continue
+		}
+		seen[r] = replicas[i]
+	}
+	return duplicates
+}
+
+// collapseDuplicates returns readreplicas without duplicates and the collapsed duplicates if `DeduplicateHandles` is true.
+// Otherwise, or if no read replica would remain, it returns readreplicas as they are.
+func collapseDuplicates(master *sql.DB, readreplicas []*sql.DB) ([]*sql.DB, []duplicate) {
+	if !DeduplicateHandles {
+		return readreplicas, nil
+	}
+	duplicates := findDuplicates(master, readreplicas)
+	if len(duplicates) == 0 {
+		return readreplicas, nil
+	}
+	collapsed := make(map[int]struct{}, len(duplicates))
+	for _, d := range duplicates {
+		collapsed[d.err.Duplicate.Index] = empty
+	}
+	remaining := make([]*sql.DB, 0, len(readreplicas)-len(duplicates))
+	for i, r := range readreplicas {
+		if _, ok := collapsed[i]; !ok {
+			remaining = append(remaining, r)
+		}
+	}
+	if len(remaining) == 0 {
+		return readreplicas, nil
+	}
+	debug("[collapseDuplicates] collapsed %d duplicate handles", len(duplicates))
+	return remaining, duplicates
+}
+
+// deferDuplicateEvents keeps `EventDuplicateHandle` of duplicates to deliver to handlers registered by `OnEvent()`
+func (db *DB) deferDuplicateEvents(duplicates []duplicate) {
+	for _, d := range duplicates {
+		db.initEvents = append(db.initEvents, Event{Type: EventDuplicateHandle, Target: db.targetInfo(d.handle), Err: d.err, Time: time.Now()})
+	}
+}
@@ -0,0 +1,290 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suffixes of environment variable keys read by `ConfigFromEnv()`, following the prefix
+const (
+	EnvSuffixDriver                     = "DRIVER"
+	EnvSuffixPrimaryDSN                 = "PRIMARY_DSN"
+	EnvSuffixReplicaDSNs                = "REPLICA_DSNS"
+	EnvSuffixReplicaNames               = "REPLICA_NAMES"
+	EnvSuffixReplicaZones               = "REPLICA_ZONES"
+	EnvSuffixReplicaWeights             = "REPLICA_WEIGHTS"
+	EnvSuffixDialect                    = "DIALECT"
+	EnvSuffixPrimaryInMaintenance       = "PRIMARY_IN_MAINTENANCE"
+	EnvSuffixDebug                      = "DEBUG"
+	EnvSuffixDisableReplicaAutoFailover = "DISABLE_REPLICA_AUTO_FAILOVER"
+	EnvSuffixDoValidateParamCount       = "DO_VALIDATE_PARAM_COUNT"
+	EnvSuffixHeartbeatInterval          = "HEARTBEAT_INTERVAL"
+	EnvSuffixReadPercentage             = "READ_PERCENTAGE"
+	EnvSuffixFailoverGracePeriod        = "FAILOVER_GRACE_PERIOD"
+	EnvSuffixInitialHealthCheckTimeout  = "INITIAL_HEALTH_CHECK_TIMEOUT"
+	EnvSuffixProxyTransactionPooling    = "PROXY_TRANSACTION_POOLING"
+	EnvSuffixTokenRefreshInterval       = "TOKEN_REFRESH_INTERVAL"
+)
+
+// dialects are Dialect by name, for `Config.Dialect`
+var dialects = map[string]Dialect{
+	PostgresDialect.Name():  PostgresDialect,
+	MySQLDialect.Name():     MySQLDialect,
+	SQLiteDialect.Name():    SQLiteDialect,
+	SQLServerDialect.Name(): SQLServerDialect,
+}
+
+// Config is the configuration of one `DB`, loaded at once by `ConfigFromEnv()` and opened by `NewFromConfig()`.
+// Unlike package-level variables, it applies to the opened DB only, so that DBs in a process can be configured differently.
+type Config struct {
+	// Driver is the name of the SQL driver to open DSNs with, e.g. `postgres`
+	Driver string
+
+	// PrimaryDSN & ReplicaDSNs are the DSNs of primary DB and read replicas
+	PrimaryDSN  string
+	ReplicaDSNs []string
+
+	// ReplicaNames, ReplicaZones & ReplicaWeights set `TargetInfo` of read replicas in order of ReplicaDSNs,
+	// defaults are kept for missing or empty ones
+	ReplicaNames   []string
+	ReplicaZones   []string
+	ReplicaWeights []int
+
+	// Dialect is the name of the Dialect, one of `postgres`, `mysql`, `sqlite` or `sqlserver`; none if empty
+	Dialect string
+
+	// PrimaryInMaintenance is the same as `EnvVarPrimaryInMaintenanceKey`
+	PrimaryInMaintenance bool
+
+	// Debug prints all debug output as `SetDebug()` with `DebugRouting` does
+	Debug bool
+
+	// DisableReplicaAutoFailover is the same as package-level `DisableReplicaAutoFailover` for the DB
+	DisableReplicaAutoFailover bool
+
+	// DoValidateParamCount is the same as package-level `DoValidateParamCount` for the DB
+	DoValidateParamCount bool
+
+	// HeartbeatInterval is the interval of health checks. Default to `DefaultReplicaAutoFailoverInterval`.
+	HeartbeatInterval time.Duration
+
+	// ReadPercentage is the same as `RuntimeConfig.ReadPercentage`. Zero means the default, 100.
+	ReadPercentage int
+
+	// FailoverGracePeriod is the same as `SetFailoverGracePeriod()`
+	FailoverGracePeriod time.Duration
+
+	// InitialHealthCheckTimeout is the same as package-level `InitialHealthCheckTimeout` for the DB
+	InitialHealthCheckTimeout time.Duration
+
+	// ProxyTransactionPooling sets `TargetInfo.Proxy` of all DBs to `ProxyTransactionPooling`,
+	// for DSNs pointing to a transaction-pooling proxy such as PgBouncer
+	ProxyTransactionPooling bool
+
+	// TokenSource, if set, provides passwords of all DSNs for managed authentication (e.g. AWS RDS IAM auth),
+	// opening them by `OpenRotating()` with `TokenConnectorFactory()`. It is not read from environment variables.
+	TokenSource TokenSource
+
+	// TokenRefreshInterval is the interval of refreshing tokens of TokenSource by `SetCredentialRotation()`.
+	// Default to `DefaultTokenRefreshInterval`.
+	TokenRefreshInterval time.Duration
+}
+
+// ConfigFromEnv returns Config read from environment variables whose keys are prefix followed by `EnvSuffix*`,
+// e.g. `ORDERS_DB_PRIMARY_DSN` for prefix `ORDERS_DB_`. Prefix `MYDB_` reads the same keys as package-level variables.
+// Lists (DSNs, names, zones and weights) are comma-separated, and durations are parsed by `time.ParseDuration()`.
+// It returns an error wrapping `ErrInvalidConfig` if any value cannot be parsed.
+func ConfigFromEnv(prefix string) (Config, error) {
+	env := func(suffix string) string {
+		return strings.TrimSpace(os.Getenv(prefix + suffix))
+	}
+	cfg := Config{
+		Driver:                     env(EnvSuffixDriver),
+		PrimaryDSN:                 env(EnvSuffixPrimaryDSN),
+		ReplicaDSNs:                splitList(env(EnvSuffixReplicaDSNs)),
+		ReplicaNames:               splitList(env(EnvSuffixReplicaNames)),
+		ReplicaZones:               splitList(env(EnvSuffixReplicaZones)),
+		Dialect:                    strings.ToLower(env(EnvSuffixDialect)),
+		PrimaryInMaintenance:       isTrue(env(EnvSuffixPrimaryInMaintenance)),
+		Debug:                      isTrue(env(EnvSuffixDebug)),
+		DisableReplicaAutoFailover: isTrue(env(EnvSuffixDisableReplicaAutoFailover)),
+		DoValidateParamCount:       isTrue(env(EnvSuffixDoValidateParamCount)),
+		ProxyTransactionPooling:    isTrue(env(EnvSuffixProxyTransactionPooling)),
+	}
+	for _, w := range splitList(env(EnvSuffixReplicaWeights)) {
+		weight, err := strconv.Atoi(w)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: %s%s: %s", ErrInvalidConfig, prefix, EnvSuffixReplicaWeights, err)
+		}
+		cfg.ReplicaWeights = append(cfg.ReplicaWeights, weight)
+	}
+	if v := env(EnvSuffixReadPercentage); v != "" {
+		percentage, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: %s%s: %s", ErrInvalidConfig, prefix, EnvSuffixReadPercentage, err)
+		}
+		cfg.ReadPercentage = percentage
+	}
+	for suffix, d := range map[string]*time.Duration{
+		EnvSuffixHeartbeatInterval:         &cfg.HeartbeatInterval,
+		EnvSuffixFailoverGracePeriod:       &cfg.FailoverGracePeriod,
+		EnvSuffixInitialHealthCheckTimeout: &cfg.InitialHealthCheckTimeout,
+		EnvSuffixTokenRefreshInterval:      &cfg.TokenRefreshInterval,
+	} {
+		if v := env(suffix); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return Config{}, fmt.Errorf("%w: %s%s: %s", ErrInvalidConfig, prefix, suffix, err)
+			}
+			*d = parsed
+		}
+	}
+	return cfg, nil
+}
+
+// NewFromConfig opens primary DB and read replicas by cfg and returns new instance of DB configured by cfg.
+// Unlike `New()`, it never panics: it returns `ErrNotProvidedPrimary` or `ErrNotProvidedReplicas` if DSNs are missing,
+// an error wrapping `ErrInvalidConfig` if cfg is invalid, or the error of `sql.Open()` or `Config.TokenSource`.
+func NewFromConfig(cfg Config) (*DB, error) {
+	if cfg.PrimaryDSN == "" {
+		return nil, ErrNotProvidedPrimary
+	}
+	if len(cfg.ReplicaDSNs) == 0 {
+		return nil, ErrNotProvidedReplicas
+	}
+	dialect, ok := dialects[cfg.Dialect]
+	if !ok && cfg.Dialect != "" {
+		return nil, fmt.Errorf("%w: unknown dialect %q", ErrInvalidConfig, cfg.Dialect)
+	}
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = DefaultReplicaAutoFailoverInterval
+	}
+	if cfg.ReadPercentage == 0 {
+		cfg.ReadPercentage = 100
+	}
+	if cfg.TokenRefreshInterval == 0 {
+		cfg.TokenRefreshInterval = DefaultTokenRefreshInterval
+	}
+	if cfg.HeartbeatInterval < 0 || cfg.ReadPercentage < 0 || cfg.ReadPercentage > 100 || cfg.TokenRefreshInterval < 0 {
+		return nil, fmt.Errorf("%w: heartbeat interval %s, read percentage %d or token refresh interval %s is out of range",
+			ErrInvalidConfig, cfg.HeartbeatInterval, cfg.ReadPercentage, cfg.TokenRefreshInterval)
+	}
+
+	ctx := context.Background()
+	if cfg.InitialHealthCheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.InitialHealthCheckTimeout)
+		defer cancel()
+	}
+	open := func(dsn string) (*sql.DB, error) {
+		if cfg.TokenSource != nil {
+			return OpenRotating(ctx, TokenConnectorFactory(cfg.Driver, dsn, cfg.TokenSource))
+		}
+		return sql.Open(cfg.Driver, dsn)
+	}
+	master, err := open(cfg.PrimaryDSN)
+	if err != nil {
+		return nil, err
+	}
+	readreplicas := make([]*sql.DB, 0, len(cfg.ReplicaDSNs))
+	for _, dsn := range cfg.ReplicaDSNs {
+		r, err := open(dsn)
+		if err != nil {
+			master.Close()
+			for _, opened := range readreplicas {
+				opened.Close()
+			}
+			return nil, err
+		}
+		readreplicas = append(readreplicas, r)
+	}
+
+	db := newDB(ctx, master, readreplicas, !cfg.DisableReplicaAutoFailover)
+	if cfg.PrimaryInMaintenance {
+		db.primaryInMaintence = 1
+	}
+	db.SetValidateParamCount(cfg.DoValidateParamCount)
+	db.SetFailoverGracePeriod(cfg.FailoverGracePeriod)
+	if dialect != nil {
+		db.SetDialect(dialect)
+	}
+	if cfg.Debug {
+		db.SetDebug(DebugConfig{Level: DebugRouting})
+	}
+	runtime := db.RuntimeConfig()
+	runtime.HeartbeatInterval = cfg.HeartbeatInterval
+	runtime.ReadPercentage = cfg.ReadPercentage
+	err = db.Reconfigure(runtime)
+	var proxy ProxyCompat
+	if cfg.ProxyTransactionPooling {
+		proxy = ProxyTransactionPooling
+	}
+	if err == nil && proxy != 0 {
+		primary, _ := db.Targets()
+		primary.Proxy = proxy
+		err = db.SetTargetInfo(primary)
+	}
+	for i := 0; err == nil && i < len(readreplicas); i++ {
+		_, replicas := db.Targets()
+		info := replicas[i]
+		if i < len(cfg.ReplicaNames) && cfg.ReplicaNames[i] != "" {
+			info.Name = cfg.ReplicaNames[i]
+		}
+		if i < len(cfg.ReplicaZones) {
+			info.Zone = cfg.ReplicaZones[i]
+		}
+		if i < len(cfg.ReplicaWeights) {
+			info.Weight = cfg.ReplicaWeights[i]
+		}
+		info.Proxy = proxy
+		err = db.SetTargetInfo(info)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if cfg.TokenSource != nil {
+		db.SetCredentialRotation(cfg.TokenRefreshInterval)
+	}
+	return db, nil
+}
+
+// SetValidateParamCount sets whether db validates number of placeholders as `DoValidateParamCount` does,
+// overriding the package-level `DoValidateParamCount` for db
+func (db *DB) SetValidateParamCount(enabled bool) {
+	db.configMutex.Lock()
+	db.validateParamCount = &enabled
+	db.configMutex.Unlock()
+}
+
+// doValidateParamCount returns true if db validates number of placeholders
+func (db *DB) doValidateParamCount() bool {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	if db.validateParamCount == nil {
+		return DoValidateParamCount
+	}
+	return *db.validateParamCount
+}
+
+// isTrue returns true if v is "true" in any case, as environment variables of boolean are parsed
+func isTrue(v string) bool {
+	return strings.ToLower(v) == "true"
+}
+
+// splitList returns comma-separated values of v with spaces trimmed, nil if v is empty
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	values := strings.Split(v, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values
+}
@@ -0,0 +1,140 @@
+package gosqlrwdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"ORDERS_DB_DRIVER":                        "sqlmock",
+		"ORDERS_DB_PRIMARY_DSN":                   "primary",
+		"ORDERS_DB_REPLICA_DSNS":                  "replica1, replica2",
+		"ORDERS_DB_REPLICA_ZONES":                 "zone-a,zone-b",
+		"ORDERS_DB_REPLICA_WEIGHTS":               "1,3",
+		"ORDERS_DB_DIALECT":                       "Postgres",
+		"ORDERS_DB_DISABLE_REPLICA_AUTO_FAILOVER": "TRUE",
+		"ORDERS_DB_HEARTBEAT_INTERVAL":            "5s",
+		"ORDERS_DB_READ_PERCENTAGE":               "80",
+		"ORDERS_DB_INITIAL_HEALTH_CHECK_TIMEOUT":  "2s",
+		"ORDERS_DB_PROXY_TRANSACTION_POOLING":     "true",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	defer func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	}()
+
+	cfg, err := ConfigFromEnv("ORDERS_DB_")
+	if err != nil {
+		t.Fatalf("error %s when ConfigFromEnv", err)
+	}
+	expected := Config{
+		Driver:                     "sqlmock",
+		PrimaryDSN:                 "primary",
+		ReplicaDSNs:                []string{"replica1", "replica2"},
+		ReplicaZones:               []string{"zone-a", "zone-b"},
+		ReplicaWeights:             []int{1, 3},
+		Dialect:                    "postgres",
+		DisableReplicaAutoFailover: true,
+		HeartbeatInterval:          5 * time.Second,
+		InitialHealthCheckTimeout:  2 * time.Second,
+		ReadPercentage:             80,
+		ProxyTransactionPooling:    true,
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("actual = %+v, expected = %+v", cfg, expected)
+	}
+
+	if cfg, err = ConfigFromEnv("OTHER_DB_"); err != nil || !reflect.DeepEqual(cfg, Config{}) {
+		t.Errorf("actual = %+v, err = %v, expected empty Config of another prefix", cfg, err)
+	}
+
+	os.Setenv("ORDERS_DB_HEARTBEAT_INTERVAL", "5")
+	if _, err = ConfigFromEnv("ORDERS_DB_"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrInvalidConfig)
+	}
+}
+
+// dsnSeq numbers DSNs of sqlmock by `uniqueDSN()`
+var dsnSeq uint64
+
+// uniqueDSN returns a DSN of sqlmock starting with name, unique in the test binary,
+// as sqlmock fails to create a mock database of a DSN used before, e.g. by `go test -count=2`
+func uniqueDSN(name string) string {
+	return fmt.Sprintf("%s-%d", name, atomic.AddUint64(&dsnSeq, 1))
+}
+
+func TestNewFromConfig(t *testing.T) {
+	primaryDSN, replicaDSNs := uniqueDSN("cfg-primary"), []string{uniqueDSN("cfg-replica1"), uniqueDSN("cfg-replica2")}
+	for _, dsn := range append([]string{primaryDSN}, replicaDSNs...) {
+		_, mock, err := sqlmock.NewWithDSN(dsn)
+		if err != nil {
+			t.Fatalf("error %s when creating mock databasen", err)
+		}
+		mock.ExpectClose()
+	}
+
+	cfg := Config{
+		Driver:                     "sqlmock",
+		PrimaryDSN:                 primaryDSN,
+		ReplicaDSNs:                replicaDSNs,
+		ReplicaNames:               []string{"", "reporting"},
+		ReplicaZones:               []string{"zone-a"},
+		Dialect:                    "postgres",
+		DisableReplicaAutoFailover: true,
+		DoValidateParamCount:       true,
+		ReadPercentage:             50,
+	}
+	db, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("error %s when NewFromConfig", err)
+	}
+	defer db.Close()
+
+	_, replicas := db.Targets()
+	expected := []TargetInfo{
+		{Role: RoleReplica, Index: 0, Name: "replica-0", Zone: "zone-a", Weight: 1},
+		{Role: RoleReplica, Index: 1, Name: "reporting", Weight: 1},
+	}
+	if !reflect.DeepEqual(replicas, expected) {
+		t.Errorf("actual = %+v, expected = %+v", replicas, expected)
+	}
+	if actual := db.RuntimeConfig(); actual.ReadPercentage != 50 || actual.HeartbeatInterval != DefaultReplicaAutoFailoverInterval {
+		t.Errorf("actual runtime config = %+v, expected read percentage 50 and default heartbeat interval", actual)
+	}
+	if db.sqlDialect() != PostgresDialect || db.needHeartbeat {
+		t.Errorf("actual dialect = %v, needHeartbeat = %t, expected postgres without heartbeat", db.sqlDialect(), db.needHeartbeat)
+	}
+	if _, err = db.Query("select * from mytable where id = ?"); !errors.Is(err, ErrParamCountMismatch) {
+		t.Errorf("actual err: %v, expected: %s for the DB only", err, ErrParamCountMismatch)
+	}
+	if DoValidateParamCount {
+		t.Errorf("actual package-level DoValidateParamCount: true, expected unchanged")
+	}
+
+	tests := []struct {
+		cfg      Config
+		expected error
+	}{
+		{Config{}, ErrNotProvidedPrimary},
+		{Config{PrimaryDSN: "p"}, ErrNotProvidedReplicas},
+		{Config{PrimaryDSN: "p", ReplicaDSNs: []string{"r"}, Dialect: "oracle"}, ErrInvalidConfig},
+		{Config{PrimaryDSN: "p", ReplicaDSNs: []string{"r"}, ReadPercentage: 101}, ErrInvalidConfig},
+	}
+	for _, test := range tests {
+		if _, err := NewFromConfig(test.cfg); !errors.Is(err, test.expected) {
+			t.Errorf("actual err: %v, expected: %s, cfg = %+v", err, test.expected, test.cfg)
+		}
+	}
+}
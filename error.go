@@ -2,6 +2,8 @@ package gosqlrwdb
 
 import (
 	"fmt"
+	"strings"
+	"time"
 )
 
 var (
@@ -9,6 +11,9 @@ var (
 	// but trying to use primary to do query/execution
 	ErrPrimaryInMaintenance = fmt.Errorf("Primary DB is in maintenance mode")
 
+	// ErrDrill is the cause of `*PrimaryUnavailableError` returned during a failover drill started by `StartDrill()`
+	ErrDrill = fmt.Errorf("Primary DB is down in drill")
+
 	// ErrNotProvidedPrimary is returned when primary DB is not provided in `New()` method
 	ErrNotProvidedPrimary = fmt.Errorf("Primary DB is not provided")
 
@@ -18,9 +23,251 @@ var (
 	// ErrNotQuerySQL is returned when the provided sql is not Query SQL but used in `Query` method
 	ErrNotQuerySQL = fmt.Errorf("Provided sql is not a Query SQL")
 
-	// ErrNoReplicaAvailable is returned when no replicas is available but replica is used for query.
+	// ErrNoReplicaAvailable is returned (wrapped in `*NoReplicaAvailableError`) when no replicas is available
+	// but replica is used for query.
 	//
 	// Note that it WILL BE RETURNED even master is available, as we determine to fail-fast,
 	// instead of defer the error until whole DB cluster overloads
 	ErrNoReplicaAvailable = fmt.Errorf("No replica DB is available now")
+
+	// ErrPrimaryUnavailable is returned (wrapped in `*PrimaryUnavailableError`) when primary DB fails health checks
+	// and `PrimaryPolicy` decides not to send writes to primary DB
+	ErrPrimaryUnavailable = fmt.Errorf("Primary DB is unavailable now")
+
+	// ErrRestoredUnavailable is the cause of `EventReplicaDown` of read replicas restored by `SetUnavailableStore()`
+	ErrRestoredUnavailable = fmt.Errorf("Replica DB was unavailable before restart")
+
+	// ErrWriteLatencyBudget is the cause (wrapped) of `EventWriteBudgetBreached`
+	ErrWriteLatencyBudget = fmt.Errorf("Write latency of primary DB exceeds budget")
+
+	// ErrNotHealthy is returned by `WaitForHealthy()` when DB does not become healthy before ctx is done
+	ErrNotHealthy = fmt.Errorf("DB is not healthy")
+
+	// ErrBelowQuorum is returned by `Ready()` when healthy read replicas are below `QuorumPolicy`
+	ErrBelowQuorum = fmt.Errorf("Healthy replica DBs are below quorum")
+
+	// ErrInvalidReplicaIndex is returned when index of read replica is out of range of read replicas passed to `New()`
+	ErrInvalidReplicaIndex = fmt.Errorf("Replica index is out of range")
+
+	// ErrInvalidConfig is returned (wrapped) by `Reconfigure()` when `RuntimeConfig` is invalid
+	ErrInvalidConfig = fmt.Errorf("Invalid configuration")
+
+	// ErrNotReady is returned (wrapped) by `ReadinessCheck` of `DialectReadinessCheck()` when a read replica is not ready
+	ErrNotReady = fmt.Errorf("Replica DB is not ready")
+
+	// ErrExplainAnalyzeWrite is returned when `EXPLAIN ANALYZE` of a write statement is rejected by `ExplainPolicy`
+	ErrExplainAnalyzeWrite = fmt.Errorf("EXPLAIN ANALYZE of write statement is rejected")
+
+	// ErrCalledInTx is returned (wrapped) when a method of `DB` is called with ctx of a `RunInTx()` closure,
+	// which would run outside the transaction
+	ErrCalledInTx = fmt.Errorf("DB method is called inside RunInTx, use Tx instead")
+
+	// ErrWorkloadLimit is returned (wrapped) when no slot of the workload by `WorkloadPolicy` is available in time
+	ErrWorkloadLimit = fmt.Errorf("Concurrency limit of workload is reached")
+
+	// ErrDuplicateHandle is returned (wrapped in `*DuplicateHandleError`) by validation of `New()`
+	// when the same handle is passed more than once
+	ErrDuplicateHandle = fmt.Errorf("Same DB handle is passed more than once")
+
+	// ErrParamCountMismatch is returned when number of placeholders in query does not match number of args,
+	// wrapped in `*ParamCountError`
+	ErrParamCountMismatch = fmt.Errorf("Number of placeholders does not match number of args")
+
+	// ErrQueryTooExpensive is returned (wrapped) when a query is rejected by `CostGuard` as its estimated cost exceeds limits
+	ErrQueryTooExpensive = fmt.Errorf("Estimated cost of query exceeds limits")
+
+	// ErrProxyIncompatible is returned (wrapped) when a statement uses a feature avoided by `TargetInfo.Proxy` of its target
+	ErrProxyIncompatible = fmt.Errorf("Statement is incompatible with the connection pooling proxy")
+
+	// ErrConflictingDirectives is returned (wrapped in `*ConflictingDirectivesError`) in strict mode of
+	// `SetStrictDirectives()` when routing directives in context conflict
+	ErrConflictingDirectives = fmt.Errorf("Routing directives in context conflict")
+
+	// ErrUnknownPartition is returned (wrapped) by `PartitionMap` when a statement hints a partition not in the map
+	ErrUnknownPartition = fmt.Errorf("Partition is unknown")
+
+	// ErrQueryBudgetExceeded is returned (wrapped in `*QueryBudgetError`) when a statement is run
+	// with ctx of `WithQueryBudget()` beyond its budget
+	ErrQueryBudgetExceeded = fmt.Errorf("Query budget of context is exceeded")
+)
+
+// ParamCountError is returned when `DoValidateParamCount` is true and
+// placeholders in query do not match args
+type ParamCountError struct {
+	Query string
+
+	// Expected & Actual are numbers of positional placeholders and positional args
+	Expected int
+	Actual   int
+
+	// MissingNames are names of named placeholders without `sql.NamedArg`,
+	// and UnusedNames are names of `sql.NamedArg` without named placeholders
+	MissingNames []string
+	UnusedNames  []string
+}
+
+func (e *ParamCountError) Error() string {
+	msg := fmt.Sprintf("%s: expected %d args but got %d", ErrParamCountMismatch, e.Expected, e.Actual)
+	if len(e.MissingNames) > 0 {
+		msg += fmt.Sprintf(", missing named args %v", e.MissingNames)
+	}
+	if len(e.UnusedNames) > 0 {
+		msg += fmt.Sprintf(", unused named args %v", e.UnusedNames)
+	}
+	return msg + ", query: " + e.Query
+}
+
+// Unwrap returns `ErrParamCountMismatch`, so that `errors.Is(err, ErrParamCountMismatch)` holds
+func (e *ParamCountError) Unwrap() error {
+	return ErrParamCountMismatch
+}
+
+// DuplicateHandleError is returned by validation of `New()` when the same `*sql.DB` is passed
+// as both primary DB and a read replica, or as two read replicas, which skews Round-Robin distribution.
+// `errors.Is(err, ErrDuplicateHandle)` holds for it.
+type DuplicateHandleError struct {
+	// Target is the first occurrence of the handle, and Duplicate is the later one,
+	// indexed as passed to `New()`
+	Target    TargetInfo
+	Duplicate TargetInfo
+}
+
+func (e *DuplicateHandleError) Error() string {
+	return fmt.Sprintf("%s: %s is the same as %s", ErrDuplicateHandle, e.Duplicate.Name, e.Target.Name)
+}
+
+// Unwrap returns `ErrDuplicateHandle`, so that `errors.Is(err, ErrDuplicateHandle)` holds
+func (e *DuplicateHandleError) Unwrap() error {
+	return ErrDuplicateHandle
+}
+
+// ConflictingDirectivesError is returned in strict mode of `SetStrictDirectives()` when `RoutingDirective`
+// in context of a method conflicts, e.g. both `WithPrimary()` and `WithReplica()` are set.
+// `errors.Is(err, ErrConflictingDirectives)` holds for it.
+type ConflictingDirectivesError struct {
+	// Method is the method of `DB` called with the directive, e.g. `QueryContext`
+	Method string
+
+	// Directive is the conflicting directive, and Reason describes the conflict
+	Directive RoutingDirective
+	Reason    string
+}
+
+func (e *ConflictingDirectivesError) Error() string {
+	return fmt.Sprintf("%s: %s in %s", ErrConflictingDirectives, e.Reason, e.Method)
+}
+
+// Unwrap returns `ErrConflictingDirectives`, so that `errors.Is(err, ErrConflictingDirectives)` holds
+func (e *ConflictingDirectivesError) Unwrap() error {
+	return ErrConflictingDirectives
+}
+
+// PrimaryUnavailableError is returned when primary DB fails health checks
+// and `PrimaryPolicy` decides not to send writes to primary DB.
+// `errors.Is(err, ErrPrimaryUnavailable)` holds for it.
+type PrimaryUnavailableError struct {
+	// Since is when primary DB started failing health checks
+	Since time.Time
+
+	// Err is the error of the health check
+	Err error
+}
+
+func (e *PrimaryUnavailableError) Error() string {
+	return fmt.Sprintf("%s since %s: %s", ErrPrimaryUnavailable, e.Since.Format(time.RFC3339), e.Err)
+}
+
+// Is returns true for `ErrPrimaryUnavailable`
+func (e *PrimaryUnavailableError) Is(target error) bool {
+	return target == ErrPrimaryUnavailable
+}
+
+// Unwrap returns the error of the health check
+func (e *PrimaryUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Reasons of `ReplicaSkip`
+const (
+	// SkipReasonDrained means the read replica is drained by `DrainReplica()`
+	SkipReasonDrained = "drained"
+
+	// SkipReasonExcluded means the read replica is excluded by `WithExcludeReplicas()` in ctx
+	SkipReasonExcluded = "excluded"
+
+	// SkipReasonUnavailable means the read replica failed health checks
+	SkipReasonUnavailable = "unavailable"
+
+	// SkipReasonNotReady means the read replica is alive but failed `ReadinessCheck`, e.g. by replication lag
+	SkipReasonNotReady = "not_ready"
+
+	// SkipReasonEvicted means the read replica is evicted for breaching the `SLO`
+	SkipReasonEvicted = "evicted"
+
+	// SkipReasonOutOfRotation means the read replica is excluded by `ExcludeReplica()` for a while
+	SkipReasonOutOfRotation = "out_of_rotation"
+
+	// SkipReasonOverBudget means the read replica is over `ReadBudget` in the current second
+	SkipReasonOverBudget = "over_budget"
 )
+
+// ReplicaSkip describes why a read replica was not used for a read
+type ReplicaSkip struct {
+	Target TargetInfo
+
+	// Reason is one of `SkipReason*`
+	Reason string
+
+	// Since is when the read replica became unavailable or not ready, zero if unknown or for other reasons
+	Since time.Time
+
+	// Until is when the read replica evicted for breaching the `SLO` gets reads again, zero for other reasons
+	Until time.Time
+
+	// Lag is the replication lag measured by the last `DialectReadinessCheck`, negative if unknown
+	Lag time.Duration
+
+	// Err is the last error of the health check or `ReadinessCheck` of unavailable or not ready read replica, if any
+	Err error
+}
+
+func (s ReplicaSkip) String() string {
+	msg := s.Target.Name + " " + s.Reason
+	if !s.Since.IsZero() {
+		msg += " since " + s.Since.Format(time.RFC3339)
+	}
+	if !s.Until.IsZero() {
+		msg += " until " + s.Until.Format(time.RFC3339)
+	}
+	if s.Lag >= 0 {
+		msg += fmt.Sprintf(" with lag %s", s.Lag)
+	}
+	if s.Err != nil {
+		msg += fmt.Sprintf(" (%s)", s.Err)
+	}
+	return msg
+}
+
+// NoReplicaAvailableError is returned when no read replica is available for a read,
+// describing why each read replica was skipped.
+// `errors.Is(err, ErrNoReplicaAvailable)` holds for it.
+type NoReplicaAvailableError struct {
+	// Replicas are read replicas skipped in order as passed to `New()`
+	Replicas []ReplicaSkip
+}
+
+func (e *NoReplicaAvailableError) Error() string {
+	if len(e.Replicas) == 0 {
+		return ErrNoReplicaAvailable.Error()
+	}
+	reasons := make([]string, len(e.Replicas))
+	for i, s := range e.Replicas {
+		reasons[i] = s.String()
+	}
+	return fmt.Sprintf("%s: %s", ErrNoReplicaAvailable, strings.Join(reasons, "; "))
+}
+
+// Is returns true for `ErrNoReplicaAvailable`
+func (e *NoReplicaAvailableError) Is(target error) bool {
+	return target == ErrNoReplicaAvailable
+}
@@ -0,0 +1,120 @@
+package gosqlrwdb
+
+import (
+	"time"
+)
+
+// EventType is the type of Event
+type EventType string
+
+// Event types
+const (
+	// EventPrimaryDown is emitted when primary DB starts failing health checks
+	EventPrimaryDown EventType = "primary_down"
+
+	// EventPrimaryUp is emitted when primary DB passes health checks again
+	EventPrimaryUp EventType = "primary_up"
+
+	// EventReplicaDown is emitted when a read replica starts failing health checks
+	EventReplicaDown EventType = "replica_down"
+
+	// EventReplicaSuspect is emitted when a read replica fails a health check
+	// but is kept available in the grace period set by `SetFailoverGracePeriod()`
+	EventReplicaSuspect EventType = "replica_suspect"
+
+	// EventReplicaSuspectCleared is emitted when a suspected read replica passes health checks again
+	// before becoming unavailable
+	EventReplicaSuspectCleared EventType = "replica_suspect_cleared"
+
+	// EventReplicaUp is emitted when a read replica passes health checks again
+	EventReplicaUp EventType = "replica_up"
+
+	// EventReplicaNotReady is emitted when an alive read replica fails `ReadinessCheck`
+	EventReplicaNotReady EventType = "replica_not_ready"
+
+	// EventReplicaReady is emitted when a read replica passes `ReadinessCheck` again
+	EventReplicaReady EventType = "replica_ready"
+
+	// EventQuorumLost is emitted when healthy read replicas fall below `QuorumPolicy`
+	EventQuorumLost EventType = "quorum_lost"
+
+	// EventQuorumRegained is emitted when healthy read replicas reach `QuorumPolicy` again
+	EventQuorumRegained EventType = "quorum_regained"
+
+	// EventConfigChanged is emitted when `Reconfigure()` applied a new `RuntimeConfig`
+	EventConfigChanged EventType = "config_changed"
+
+	// EventDuplicateHandle is emitted when a duplicate handle passed to `New()` is collapsed by `DeduplicateHandles`,
+	// with `Target` of the remaining one and `*DuplicateHandleError` as `Err`
+	EventDuplicateHandle EventType = "duplicate_handle"
+
+	// EventWriteBudgetBreached is emitted when `WriteLatencyBudget` is breached,
+	// with `Target` of primary DB and an error wrapping `ErrWriteLatencyBudget` as `Err`
+	EventWriteBudgetBreached EventType = "write_budget_breached"
+
+	// EventWriteBudgetRecovered is emitted when latency of writes is within `WriteLatencyBudget` again
+	EventWriteBudgetRecovered EventType = "write_budget_recovered"
+
+	// EventMaintenanceStarted is emitted when primary DB enters maintenance mode after `New()`,
+	// e.g. by `SetPrimaryInMaintenance()` or `MaintenanceStore`
+	EventMaintenanceStarted EventType = "maintenance_started"
+
+	// EventMaintenanceEnded is emitted when primary DB leaves maintenance mode
+	EventMaintenanceEnded EventType = "maintenance_ended"
+
+	// EventCredentialsRotated is emitted when the connector of a target opened by `OpenRotating()` is recreated
+	// by `RotateCredentials()` or `SetCredentialRotation()`
+	EventCredentialsRotated EventType = "credentials_rotated"
+
+	// EventFreshnessMismatch is emitted when a read on a read replica with ctx of `WithFreshnessAssert()` differs from
+	// the same read on primary DB, with `Target` of the read replica and `*FreshnessMismatchError` as `Err`
+	EventFreshnessMismatch EventType = "freshness_mismatch"
+
+	// EventQueryBudgetExceeded is emitted when the first statement beyond the budget of a context of `WithQueryBudget()`
+	// is run, with `*QueryBudgetError` as `Err`
+	EventQueryBudgetExceeded EventType = "query_budget_exceeded"
+)
+
+// Event is a notable change of state of `DB`
+type Event struct {
+	Type EventType
+
+	// Target is the DB the event is about
+	Target TargetInfo
+
+	// Err is the cause of the event if any, e.g. the error of failed health check
+	Err error
+
+	// Drill is true for events of a failover drill started by `StartDrill()`
+	Drill bool
+
+	Time time.Time
+}
+
+// OnEvent registers f to be called on each Event.
+// f is called synchronously in the goroutine causing the event (e.g. the heartbeat goroutine),
+// so it should return quickly and must not call methods of `DB` that emit events.
+// Events of `New()` (i.e. `EventDuplicateHandle`) are delivered to f at registration, as no handler can be registered before.
+func (db *DB) OnEvent(f func(Event)) {
+	db.configMutex.Lock()
+	db.eventHandlers = append(db.eventHandlers, f)
+	initEvents := db.initEvents
+	db.configMutex.Unlock()
+	for _, e := range initEvents {
+		f(e)
+	}
+}
+
+// emit calls event handlers registered by `OnEvent()` with e
+func (db *DB) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	db.debugf(DebugEvent, "[emit] event: %s, target: %+v, err: %v", e.Type, e.Target, e.Err)
+	db.configMutex.RLock()
+	handlers := db.eventHandlers
+	db.configMutex.RUnlock()
+	for _, f := range handlers {
+		f(e)
+	}
+}
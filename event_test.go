@@ -0,0 +1,207 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReplicaEvents(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	var events []Event
+	db.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db.refreshUnavailableReplicas()
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db.refreshUnavailableReplicas()
+
+	expected := []Event{
+		{Type: EventReplicaDown, Target: TargetInfo{Role: RoleReplica, Index: 1, Name: "replica-1", Weight: 1}},
+		{Type: EventReplicaUp, Target: TargetInfo{Role: RoleReplica, Index: 1, Name: "replica-1", Weight: 1}},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("actual events = %+v, expected = %+v", events, expected)
+	}
+	for i := range expected {
+		if events[i].Type != expected[i].Type || events[i].Target != expected[i].Target {
+			t.Errorf("actual event = %+v, expected = %+v", events[i], expected[i])
+		}
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFailoverGracePeriod(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	db.SetFailoverGracePeriod(time.Hour)
+
+	var events []EventType
+	db.OnEvent(func(e Event) {
+		events = append(events, e.Type)
+	})
+	expectEvents := func(expected ...EventType) {
+		t.Helper()
+		if fmt.Sprint(events) != fmt.Sprint(expected) {
+			t.Errorf("actual events = %v, expected = %v", events, expected)
+		}
+		events = nil
+	}
+	unavailable := func(r *sql.DB) bool {
+		db.countMutex.RLock()
+		defer db.countMutex.RUnlock()
+		_, ok := db.unavailableReplicas[r]
+		return ok
+	}
+
+	// one-off ping failure is only suspected
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db.refreshUnavailableReplicas()
+	expectEvents(EventReplicaSuspect)
+	if unavailable(r2.db) {
+		t.Errorf("suspected replica is unavailable in grace period")
+	}
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db.refreshUnavailableReplicas()
+	expectEvents(EventReplicaSuspectCleared)
+
+	// failing after the grace period makes it unavailable
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db.refreshUnavailableReplicas()
+	db.countMutex.Lock()
+	db.suspectReplicas[r2.db] = time.Now().Add(-time.Hour)
+	db.countMutex.Unlock()
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db.refreshUnavailableReplicas()
+	expectEvents(EventReplicaSuspect, EventReplicaDown)
+	if !unavailable(r2.db) {
+		t.Errorf("replica is available after the grace period")
+	}
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db.refreshUnavailableReplicas()
+	expectEvents(EventReplicaUp)
+
+	// connection error of a read confirms the suspicion at once
+	r1.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	r2.mock.ExpectPing()
+	db.refreshUnavailableReplicas()
+	r1.mock.ExpectQuery("^select 1$").WillReturnError(&net.OpError{Op: "read", Err: fmt.Errorf("connection reset")})
+	db.count = -1
+	if _, err = db.Query("select 1"); err == nil {
+		t.Errorf("actual err: nil, expected connection error")
+	}
+	expectEvents(EventReplicaSuspect, EventReplicaDown)
+	if !unavailable(r1.db) {
+		t.Errorf("replica is available after connection error")
+	}
+
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeduplicateHandles(t *testing.T) {
+	DeduplicateHandles = true
+	defer func() { DeduplicateHandles = false }()
+
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db, err := TryNew(p.db, r1.db, p.db, r1.db, r2.db)
+	if err != nil {
+		t.Fatalf("error %s when TryNew", err)
+	}
+	defer db.Close()
+
+	if actual := len(db.readreplicas); actual != 2 {
+		t.Errorf("actual replicas: %d, expected: 2", actual)
+	}
+	var events []Event
+	db.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+	if len(events) != 2 {
+		t.Fatalf("actual events = %+v, expected 2 %s", events, EventDuplicateHandle)
+	}
+	expected := []struct {
+		target    string
+		duplicate string
+	}{
+		{"primary", "replica-1"},
+		{"replica-0", "replica-2"},
+	}
+	for i, e := range events {
+		var dup *DuplicateHandleError
+		if e.Type != EventDuplicateHandle || e.Target.Name != expected[i].target || !errors.As(e.Err, &dup) || dup.Duplicate.Name != expected[i].duplicate {
+			t.Errorf("actual event = %+v, expected %s of %s collapsed into %s", e, EventDuplicateHandle, expected[i].duplicate, expected[i].target)
+		}
+	}
+
+	// nothing is collapsed if no read replica would remain
+	if _, err = TryNew(p.db, p.db); !errors.Is(err, ErrDuplicateHandle) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrDuplicateHandle)
+	}
+}
@@ -0,0 +1,51 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ExcludeReplica takes the read replica named name out of rotation for d, e.g. during known maintenance of it,
+// and restores it automatically after d without changing configuration. Excluded read replicas are skipped like
+// ones evicted by the `SLO`, and reported as `SkipReasonOutOfRotation` and `TopologyStateOutOfRotation`;
+// reads bypassing auto failover (e.g. by `WithExactReplicaOrder()`) still reach them.
+// Calling it again replaces the end of the exclusion, and non-positive d restores the read replica now.
+// Evictions by the SLO or `Admin.Evict()` are kept as they are.
+// It returns an error wrapping `ErrInvalidConfig` if the target is unknown or primary DB.
+func (db *DB) ExcludeReplica(name string, d time.Duration) error {
+	state, err := db.Admin().replicaState(name)
+	if err != nil {
+		db.debugf(DebugError, "[ExcludeReplica] err: %s", err)
+		return err
+	}
+	var until time.Time
+	if d > 0 {
+		until = time.Now().Add(d)
+	}
+	state.mu.Lock()
+	state.excludedUntil = until
+	state.mu.Unlock()
+
+	if d > 0 {
+		db.configMutex.Lock()
+		if until.After(db.manualEvictionUntil) {
+			db.manualEvictionUntil = until
+		}
+		db.configMutex.Unlock()
+		db.debugf(DebugEvent, "[ExcludeReplica] exclude replica: %s until: %s", name, until)
+		return nil
+	}
+	db.debugf(DebugEvent, "[ExcludeReplica] restore replica: %s", name)
+	return nil
+}
+
+// excludedUntil returns when the exclusion of r by `ExcludeReplica()` ends, and false if r is not excluded
+func (db *DB) excludedUntil(r *sql.DB) (time.Time, bool) {
+	state, ok := db.replicaStates[r]
+	if !ok {
+		return time.Time{}, false
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.excludedUntil, time.Now().Before(state.excludedUntil)
+}
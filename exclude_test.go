@@ -0,0 +1,75 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExcludeReplica(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+	selectQuery := fmt.Sprintf(selectQueryTmpl, "*")
+
+	if err := db.ExcludeReplica("replica-0", 50*time.Millisecond); err != nil {
+		t.Fatalf("error %s when ExcludeReplica", err)
+	}
+	for i := 0; i < 2; i++ {
+		if actual := db.SimulateRoute(context.Background(), selectQuery).Target.Name; actual != "replica-1" {
+			t.Errorf("actual target: %s, expected: replica-1 while replica-0 is excluded", actual)
+		}
+	}
+	if actual := db.Topology().Replicas[0].State; actual != TopologyStateOutOfRotation {
+		t.Errorf("actual state: %s, expected: %s", actual, TopologyStateOutOfRotation)
+	}
+	var noReplica *NoReplicaAvailableError
+	if err := db.noReplicaAvailable(nil, false); !errors.As(err, &noReplica) || len(noReplica.Replicas) != 1 ||
+		noReplica.Replicas[0].Reason != SkipReasonOutOfRotation || noReplica.Replicas[0].Until.IsZero() {
+		t.Errorf("actual err: %v, expected: replica-0 skipped by %s until the end", err, SkipReasonOutOfRotation)
+	}
+
+	// restored automatically after the duration
+	time.Sleep(60 * time.Millisecond)
+	if actual := db.Topology().Replicas[0].State; actual != TopologyStateAvailable {
+		t.Errorf("actual state: %s, expected: %s after the duration", actual, TopologyStateAvailable)
+	}
+
+	// restored now by non-positive duration, or by the admin command
+	if _, err := db.Admin().Exec("exclude replica-1 30m"); err != nil {
+		t.Fatalf("error %s when exclude command", err)
+	}
+	if actual := db.Topology().Replicas[1].State; actual != TopologyStateOutOfRotation {
+		t.Errorf("actual state: %s, expected: %s", actual, TopologyStateOutOfRotation)
+	}
+	if err := db.ExcludeReplica("replica-1", 0); err != nil {
+		t.Fatalf("error %s when ExcludeReplica", err)
+	}
+	if actual := db.Topology().Replicas[1].State; actual != TopologyStateAvailable {
+		t.Errorf("actual state: %s, expected: %s", actual, TopologyStateAvailable)
+	}
+
+	for _, name := range []string{"primary", "replica-9"} {
+		if err := db.ExcludeReplica(name, time.Minute); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("actual err: %v, expected: %s for %s", err, ErrInvalidConfig, name)
+		}
+	}
+	for _, m := range []*mydbMock{p, r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
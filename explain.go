@@ -0,0 +1,94 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+// ExplainPolicyType decides how `EXPLAIN` statements are routed, see `ExplainPolicy`
+type ExplainPolicyType int
+
+const (
+	// ExplainToPrimary treats all `EXPLAIN` statements as non Query SQL, routing them to primary DB
+	ExplainToPrimary ExplainPolicyType = iota
+
+	// ExplainToReplica treats plain `EXPLAIN` and `EXPLAIN ANALYZE` of reads as Query SQL, routing them to read replicas,
+	// while `EXPLAIN ANALYZE` of writes, which actually executes the write, is always routed to primary DB,
+	// even by `Query()` / `QueryContext()` / `QueryRow()` / `QueryRowContext()`
+	ExplainToReplica
+
+	// ExplainRejectAnalyzeWrites is `ExplainToReplica` but rejects `EXPLAIN ANALYZE` of writes with `ErrExplainAnalyzeWrite`
+	ExplainRejectAnalyzeWrites
+)
+
+// EnvVarExplainPolicyKey is to determine `ExplainPolicy`.
+// Deploy the application using package gosqlrwdb with this
+// environment variable to `replica` means `ExplainToReplica`, `reject` means `ExplainRejectAnalyzeWrites`;
+// otherwise `ExplainToPrimary`.
+const EnvVarExplainPolicyKey = "MYDB_EXPLAIN_POLICY"
+
+// ExplainPolicy decides how `EXPLAIN` statements are routed by the default `IsQuerySqlFunc`.
+// It is initialized from environment variable with key `EnvVarExplainPolicyKey`.
+// Also can update it programatically using `mydb.ExplainPolicy = mydb.ExplainToReplica`
+var ExplainPolicy = parseExplainPolicy(os.Getenv(EnvVarExplainPolicyKey))
+
+func parseExplainPolicy(s string) ExplainPolicyType {
+	switch strings.ToLower(s) {
+	case "replica":
+		return ExplainToReplica
+	case "reject":
+		return ExplainRejectAnalyzeWrites
+	default:
+		return ExplainToPrimary
+	}
+}
+
+// explainedStatement returns keywords of the statement explained by `EXPLAIN` in tokens
+// and whether it is explained with `ANALYZE`, which executes the statement.
+// ok is false if tokens are not an `EXPLAIN` statement.
+func explainedStatement(tokens []string) (statement []string, analyze bool, ok bool) {
+	if len(tokens) == 0 || tokens[0] != "explain" {
+		return nil, false, false
+	}
+	for i := 1; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "analyze", "analyse":
+			// Postgres `EXPLAIN (ANALYZE false)` / `EXPLAIN (ANALYZE off)` does not execute the statement
+			analyze = i+1 >= len(tokens) || (tokens[i+1] != "false" && tokens[i+1] != "off" && tokens[i+1] != "0")
+		case "select", "with", "insert", "update", "delete", "merge", "replace", "table", "values",
+			"create", "execute", "declare":
+			return tokens[i:], analyze, true
+		}
+	}
+	return nil, analyze, true
+}
+
+// isExplainAnalyzeWrite returns true if query is `EXPLAIN ANALYZE` of a statement other than a read
+func isExplainAnalyzeWrite(query string) bool {
+	statement, analyze, ok := explainedStatement(keywords(StripLeadingNoise(query)))
+	return ok && analyze && !isReadTokens(statement)
+}
+
+// checkExplain returns true if query must be routed to primary DB by `ExplainPolicy`,
+// or `ErrExplainAnalyzeWrite` if query is rejected by `ExplainPolicy`
+func checkExplain(query string) (bool, error) {
+	if ExplainPolicy == ExplainToPrimary || !isExplainAnalyzeWrite(query) {
+		return false, nil
+	}
+	if ExplainPolicy == ExplainRejectAnalyzeWrites {
+		return false, ErrExplainAnalyzeWrite
+	}
+	return true, nil
+}
+
+// primaryWritable returns an error if writes cannot be routed to primary DB now
+func (db *DB) primaryWritable(ctx context.Context) error {
+	if db.PrimaryInMaintenance() {
+		return ErrPrimaryInMaintenance
+	}
+	if !DoValidateNew && db.master == nil {
+		return ErrNotProvidedPrimary
+	}
+	return db.checkPrimaryWrite(ctx)
+}
@@ -0,0 +1,131 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIsReadQueryExplain(t *testing.T) {
+	defer func(p ExplainPolicyType) { ExplainPolicy = p }(ExplainPolicy)
+
+	tests := []struct {
+		query    string
+		primary  bool
+		replica  bool
+		analyzes bool
+	}{
+		{"explain select * from mytable", false, true, false},
+		{"EXPLAIN FORMAT=JSON SELECT * FROM mytable", false, true, false},
+		{"explain delete from mytable", false, true, false},
+		{"explain analyze select * from mytable", false, true, false},
+		{"explain analyze delete from mytable", false, false, true},
+		{"EXPLAIN (ANALYZE, BUFFERS) UPDATE mytable SET a = 1", false, false, true},
+		{"explain (analyze false) update mytable set a = 1", false, true, false},
+		{"explain analyse insert into mytable values (1)", false, false, true},
+		{"/* c */ explain analyze with t as (delete from mytable returning *) select * from t", false, false, true},
+		{"select explain from mytable", true, true, false},
+	}
+
+	for _, test := range tests {
+		ExplainPolicy = ExplainToPrimary
+		if actual := isReadQuery(test.query); actual != test.primary {
+			t.Errorf("ExplainToPrimary, %q: actual = %v, expected = %v", test.query, actual, test.primary)
+		}
+		ExplainPolicy = ExplainToReplica
+		if actual := isReadQuery(test.query); actual != test.replica {
+			t.Errorf("ExplainToReplica, %q: actual = %v, expected = %v", test.query, actual, test.replica)
+		}
+		if actual := isExplainAnalyzeWrite(test.query); actual != test.analyzes {
+			t.Errorf("isExplainAnalyzeWrite(%q): actual = %v, expected = %v", test.query, actual, test.analyzes)
+		}
+	}
+}
+
+func TestExplainPolicyRouting(t *testing.T) {
+	defer func(p ExplainPolicyType) { ExplainPolicy = p }(ExplainPolicy)
+
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r.db)
+	defer db.Close()
+
+	explain := "explain select * from mytable"
+	analyzeWrite := "explain analyze delete from mytable"
+
+	ExplainPolicy = ExplainToPrimary
+	if _, err = db.Query(explain); err != ErrNotQuerySQL {
+		t.Errorf("actual err: %v, expected: %s", err, ErrNotQuerySQL)
+	}
+
+	ExplainPolicy = ExplainToReplica
+	r.mock.ExpectQuery(regexp.QuoteMeta(explain)).WillReturnRows(sqlmock.NewRows([]string{"plan"}))
+	if _, err = db.Query(explain); err != nil {
+		t.Errorf("error %s when Query", err)
+	}
+	p.mock.ExpectQuery(regexp.QuoteMeta(analyzeWrite)).WillReturnRows(sqlmock.NewRows([]string{"plan"}))
+	if _, err = db.Query(analyzeWrite); err != nil {
+		t.Errorf("error %s when Query", err)
+	}
+	p.mock.ExpectQuery(regexp.QuoteMeta(analyzeWrite)).WillReturnRows(sqlmock.NewRows([]string{"plan"}).AddRow("plan"))
+	var plan string
+	if err = db.QueryRow(analyzeWrite).Scan(&plan); err != nil {
+		t.Errorf("error %s when QueryRow", err)
+	}
+	if actual := db.Metrics().Writes; actual != 2 {
+		t.Errorf("actual writes: %d, expected: 2", actual)
+	}
+
+	ExplainPolicy = ExplainRejectAnalyzeWrites
+	if _, err = db.QueryContext(context.Background(), analyzeWrite); err != ErrExplainAnalyzeWrite {
+		t.Errorf("actual err: %v, expected: %s", err, ErrExplainAnalyzeWrite)
+	}
+	if _, err = db.Exec(analyzeWrite); err != ErrExplainAnalyzeWrite {
+		t.Errorf("actual err: %v, expected: %s", err, ErrExplainAnalyzeWrite)
+	}
+	if _, err = db.PrepareContext(context.Background(), analyzeWrite); err != ErrExplainAnalyzeWrite {
+		t.Errorf("actual err: %v, expected: %s", err, ErrExplainAnalyzeWrite)
+	}
+	func() {
+		defer func() {
+			if actual := recover(); actual != ErrExplainAnalyzeWrite {
+				t.Errorf("actual panic: %v, expected: %s", actual, ErrExplainAnalyzeWrite)
+			}
+		}()
+		db.QueryRow(analyzeWrite)
+	}()
+
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestParseExplainPolicy(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected ExplainPolicyType
+	}{
+		{"", ExplainToPrimary},
+		{"primary", ExplainToPrimary},
+		{"Replica", ExplainToReplica},
+		{"reject", ExplainRejectAnalyzeWrites},
+	}
+
+	for _, test := range tests {
+		if actual := parseExplainPolicy(test.s); actual != test.expected {
+			t.Errorf("%q: actual = %v, expected = %v", test.s, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ErrorClass is the class of an error returned by a read replica, used by `FallbackPolicy`
+type ErrorClass string
+
+const (
+	// ErrorClassNoReplicaAvailable is the class of `ErrNoReplicaAvailable`
+	ErrorClassNoReplicaAvailable ErrorClass = "no_replica_available"
+
+	// ErrorClassConnection is the class of broken connection errors
+	ErrorClassConnection ErrorClass = "connection"
+
+	// ErrorClassTimeout is the class of timeout errors
+	ErrorClassTimeout ErrorClass = "timeout"
+
+	// ErrorClassRetryable is the class of transient errors by `Dialect.IsRetryable()`, e.g. deadlocks
+	ErrorClassRetryable ErrorClass = "retryable"
+
+	// ErrorClassOther is the class of all other errors, typically returned by the query itself
+	ErrorClassOther ErrorClass = "other"
+)
+
+// FallbackAction is what to do when a read on a read replica failed
+type FallbackAction int
+
+const (
+	// FallbackReturn returns the error as-is
+	FallbackReturn FallbackAction = iota
+
+	// FallbackRetryReplica retries the read on another read replica
+	FallbackRetryReplica
+
+	// FallbackRetryPrimary retries the read on primary DB
+	FallbackRetryPrimary
+)
+
+// ClassifyError returns the ErrorClass of err
+func ClassifyError(err error) ErrorClass {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrNoReplicaAvailable):
+		return ErrorClassNoReplicaAvailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.As(err, &netErr):
+		return ErrorClassConnection
+	default:
+		return ErrorClassOther
+	}
+}
+
+// FallbackPolicy decides, per ErrorClass, what to do when a read on a read replica failed.
+// It applies to `Query()` / `QueryContext()` / `Prepare()` / `PrepareContext()` routed to read replicas.
+// Reads are never retried once the context is done, nor beyond `WithMaxAttempts()` of the context.
+type FallbackPolicy struct {
+	// Actions is the action of each ErrorClass, `FallbackReturn` if absent
+	Actions map[ErrorClass]FallbackAction
+
+	// Classify returns the ErrorClass of an error, `ClassifyError` if nil
+	Classify func(err error) ErrorClass
+}
+
+// Decide returns the FallbackAction for err
+func (p *FallbackPolicy) Decide(err error) FallbackAction {
+	classify := p.Classify
+	if classify == nil {
+		classify = ClassifyError
+	}
+	return p.Actions[classify(err)]
+}
+
+// decide returns the FallbackAction of policy for err, classifying err with Dialect of db if policy does not classify
+func (db *DB) decide(policy *FallbackPolicy, err error) FallbackAction {
+	return policy.Actions[db.classifyError(policy, err)]
+}
+
+// SetFallbackPolicy sets the FallbackPolicy of reads on read replicas.
+// Passing nil means errors are always returned as-is, which is the default.
+func (db *DB) SetFallbackPolicy(p *FallbackPolicy) {
+	db.configMutex.Lock()
+	db.fallbackPolicy = p
+	db.configMutex.Unlock()
+}
+
+// replicaFallbackPolicy returns current FallbackPolicy, nil if not set
+func (db *DB) replicaFallbackPolicy() *FallbackPolicy {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.fallbackPolicy
+}
+
+// primaryAvailable returns true if reads can fall back to primary DB
+func (db *DB) primaryAvailable() bool {
+	return !db.PrimaryInMaintenance() && db.master != nil
+}
+
+// readReplica runs read on one of the read replicas, applying FallbackPolicy on errors.
+// Reads are routed to primary DB instead while below `QuorumPolicy` with `SpillToPrimary`,
+// for reads beyond `RuntimeConfig.ReadPercentage`, for reads spilled by `SpilloverPolicy`,
+// and for all reads while `FlagReplicaReads` is false.
+func (db *DB) readReplica(ctx context.Context, bypassAutoFailover bool, read func(tgtdb *sql.DB) error) error {
+	policy := db.replicaFallbackPolicy()
+	if !bypassAutoFailover && db.primaryAvailable() && !db.flag(FlagReplicaReads, true) {
+		db.debugf(DebugRouting, "[readReplica] read on primary as replica reads are switched off by flag")
+		db.auditOverride(ctx, OverrideReplicaReadsOff)
+		db.countRead(db.master)
+		return read(db.master)
+	}
+	if db.spillToPrimary(ctx) {
+		db.debugf(DebugEvent, "[readReplica] below quorum, spill to primary")
+		db.countFallback()
+		db.countRead(db.master)
+		return read(db.master)
+	}
+	if !bypassAutoFailover && db.readOnPrimary() {
+		db.debugf(DebugRouting, "[readReplica] read on primary by read percentage")
+		db.countRead(db.master)
+		return read(db.master)
+	}
+	if !bypassAutoFailover && db.spillover(ctx) {
+		db.debugf(DebugRouting, "[readReplica] spill to primary as replicas are saturated")
+		db.countSpillover()
+		db.countRead(db.master)
+		return read(db.master)
+	}
+	tgtdb, err := db.selectReplica(ctx, bypassAutoFailover)
+	if err != nil {
+		if policy == nil || db.decide(policy, err) != FallbackRetryPrimary || !db.fallbackToPrimary(ctx) {
+			return err
+		}
+		db.debugf(DebugEvent, "[readReplica] fallback to primary, err: %s", err)
+		db.countFallback()
+		tgtdb = db.master
+	}
+
+	tried := map[*sql.DB]struct{}{}
+	for {
+		db.countRead(tgtdb)
+		start := time.Now()
+		err = db.readInflight(tgtdb, read)
+		db.observe(ctx, tgtdb, start, err)
+		db.confirmSuspect(ctx, tgtdb, err)
+		if err == nil || policy == nil || tgtdb == db.master || ctx.Err() != nil || !retryAllowed(ctx) {
+			return err
+		}
+		tried[tgtdb] = empty
+
+		switch db.decide(policy, err) {
+		case FallbackRetryReplica:
+			next := db.untriedReplica(ctx, bypassAutoFailover, tried)
+			if next == nil {
+				return err
+			}
+			db.debugf(DebugEvent, "[readReplica] retry on another replica, err: %s", err)
+			db.countFailover()
+			tgtdb = next
+		case FallbackRetryPrimary:
+			if !db.fallbackToPrimary(ctx) {
+				return err
+			}
+			db.debugf(DebugEvent, "[readReplica] retry on primary, err: %s", err)
+			db.countFallback()
+			tgtdb = db.master
+		default:
+			return err
+		}
+	}
+}
+
+// readInflight runs read on tgtdb, counting it as in-flight while running
+func (db *DB) readInflight(tgtdb *sql.DB, read func(tgtdb *sql.DB) error) error {
+	state, ok := db.replicaStates[tgtdb]
+	if !ok {
+		return read(tgtdb)
+	}
+	atomic.AddInt64(&state.inflight, 1)
+	defer atomic.AddInt64(&state.inflight, -1)
+	return read(tgtdb)
+}
+
+// untriedReplica returns one of the read replicas not in tried, nil if none
+func (db *DB) untriedReplica(ctx context.Context, bypassAutoFailover bool, tried map[*sql.DB]struct{}) *sql.DB {
+	for i := 0; i < len(db.readreplicas); i++ {
+		r, err := db.selectReplica(ctx, bypassAutoFailover)
+		if err != nil {
+			return nil
+		}
+		if _, ok := tried[r]; !ok {
+			return r
+		}
+	}
+	return nil
+}
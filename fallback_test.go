@@ -0,0 +1,194 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected ErrorClass
+	}{
+		{ErrNoReplicaAvailable, ErrorClassNoReplicaAvailable},
+		{driver.ErrBadConn, ErrorClassConnection},
+		{sql.ErrConnDone, ErrorClassConnection},
+		{&net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}, ErrorClassConnection},
+		{timeoutError{}, ErrorClassTimeout},
+		{context.DeadlineExceeded, ErrorClassTimeout},
+		{fmt.Errorf("syntax error"), ErrorClassOther},
+	}
+
+	for _, test := range tests {
+		if actual := ClassifyError(test.err); actual != test.expected {
+			t.Errorf("actual = %s, expected = %s, err = %s", actual, test.expected, test.err)
+		}
+	}
+}
+
+func TestFallbackPolicyDecide(t *testing.T) {
+	p := &FallbackPolicy{
+		Actions: map[ErrorClass]FallbackAction{
+			ErrorClassConnection:         FallbackRetryReplica,
+			ErrorClassNoReplicaAvailable: FallbackRetryPrimary,
+		},
+	}
+	tests := []struct {
+		err      error
+		expected FallbackAction
+	}{
+		{driver.ErrBadConn, FallbackRetryReplica},
+		{ErrNoReplicaAvailable, FallbackRetryPrimary},
+		{fmt.Errorf("syntax error"), FallbackReturn},
+	}
+	for _, test := range tests {
+		if actual := p.Decide(test.err); actual != test.expected {
+			t.Errorf("actual = %d, expected = %d, err = %s", actual, test.expected, test.err)
+		}
+	}
+
+	p.Classify = func(error) ErrorClass { return ErrorClassConnection }
+	if actual := p.Decide(fmt.Errorf("syntax error")); actual != FallbackRetryReplica {
+		t.Errorf("actual = %d, expected = %d with custom Classify", actual, FallbackRetryReplica)
+	}
+}
+
+func TestQueryFallbackRetryReplica(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	db.SetFallbackPolicy(&FallbackPolicy{
+		Actions: map[ErrorClass]FallbackAction{ErrorClassConnection: FallbackRetryReplica},
+	})
+
+	mrows := sqlmock.NewRows([]string{"column1", "column2"}).AddRow(1, "1")
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(&net.OpError{Op: "read", Err: fmt.Errorf("connection reset")})
+	r2.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(mrows)
+	if _, err = db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when QueryContext", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if actual := db.Metrics().Failovers; actual != 1 {
+		t.Errorf("actual failovers: %d, expected: 1", actual)
+	}
+
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(fmt.Errorf("syntax error"))
+	if _, err = db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*")); err == nil {
+		t.Errorf("error should be returned as-is for other errors")
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestQueryFallbackMaxAttempts(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r3, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db, r3.db)
+	defer db.Close()
+	db.SetFallbackPolicy(&FallbackPolicy{
+		Actions: map[ErrorClass]FallbackAction{ErrorClassConnection: FallbackRetryReplica},
+	})
+	connErr := &net.OpError{Op: "read", Err: fmt.Errorf("connection lost")}
+
+	// not retried on r2
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(connErr)
+	if _, err = db.QueryContext(WithNoRetry(context.Background()), fmt.Sprintf(selectQueryTmpl, "*")); err == nil {
+		t.Errorf("error should be returned without retry")
+	}
+
+	// retried on r3 but not on r1
+	r2.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(connErr)
+	r3.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(connErr)
+	if _, err = db.QueryContext(WithMaxAttempts(context.Background(), 2), fmt.Sprintf(selectQueryTmpl, "*")); err == nil {
+		t.Errorf("error should be returned after 2 attempts")
+	}
+	if actual := db.Metrics().Failovers; actual != 1 {
+		t.Errorf("actual failovers: %d, expected: 1", actual)
+	}
+
+	for _, r := range []*mydbMock{r1, r2, r3} {
+		if err = r.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestQueryFallbackRetryPrimary(t *testing.T) {
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	if _, err = db.Query(fmt.Sprintf(selectQueryTmpl, "*")); !errors.Is(err, ErrNoReplicaAvailable) {
+		t.Errorf("actual err: %v, expected: %s without FallbackPolicy", err, ErrNoReplicaAvailable)
+	}
+
+	db.SetFallbackPolicy(&FallbackPolicy{
+		Actions: map[ErrorClass]FallbackAction{ErrorClassNoReplicaAvailable: FallbackRetryPrimary},
+	})
+	mrows := sqlmock.NewRows([]string{"column1", "column2"}).AddRow(1, "1")
+	p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(mrows)
+	if _, err = db.Query(fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when Query", err)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if actual := db.Metrics(); actual.Fallbacks != 1 || actual.ReadsPrimary != 1 {
+		t.Errorf("actual fallbacks: %d, reads primary: %d, expected: 1, 1", actual.Fallbacks, actual.ReadsPrimary)
+	}
+}
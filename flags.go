@@ -0,0 +1,160 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Names of flags consulted by `FlagProvider` on each read, so that routing can be changed from a flag dashboard
+const (
+	// FlagReplicaReads is the kill switch of read replicas: false routes reads on read replicas to primary DB,
+	// as far as primary DB is available. Default to true.
+	FlagReplicaReads = "gosqlrwdb.replica_reads"
+
+	// FlagPrimaryFallback is the kill switch of reads falling back to primary DB: false keeps reads on read replicas
+	// when `FallbackPolicy` retries on primary DB, below `QuorumPolicy` with `SpillToPrimary`, and by `SpilloverPolicy`.
+	// Default to true.
+	FlagPrimaryFallback = "gosqlrwdb.primary_fallback"
+
+	// FlagReadPercentage overrides `RuntimeConfig.ReadPercentage` if FlagProvider is an `IntFlagProvider`,
+	// values out of 0 ~ 100 are clamped. Default to `RuntimeConfig.ReadPercentage`.
+	FlagReadPercentage = "gosqlrwdb.read_percentage"
+)
+
+// FlagProvider provides values of flags by `Flag*` names, typically backed by a feature flag system.
+// It is called on each read, so that it must be fast (e.g. served from the SDK's local cache) and safe for concurrent use.
+// Adapt the client of a flag system by `FlagProviderFunc`, e.g. for LaunchDarkly:
+//
+//	db.SetFlagProvider(gosqlrwdb.FlagProviderFunc(func(name string, defaultValue bool) bool {
+//		v, _ := ldClient.BoolVariation(name, serviceContext, defaultValue)
+//		return v
+//	}))
+//
+// or for OpenFeature, `v, _ := client.BooleanValue(context.Background(), name, defaultValue, evalCtx)`.
+type FlagProvider interface {
+	// Bool returns the value of the flag of name, defaultValue if unknown
+	Bool(name string, defaultValue bool) bool
+}
+
+// IntFlagProvider is a FlagProvider of integer flags as well, e.g. for `FlagReadPercentage`
+type IntFlagProvider interface {
+	FlagProvider
+
+	// Int returns the value of the flag of name, defaultValue if unknown
+	Int(name string, defaultValue int) int
+}
+
+// FlagProviderFunc is a FlagProvider of a function
+type FlagProviderFunc func(name string, defaultValue bool) bool
+
+// Bool calls f
+func (f FlagProviderFunc) Bool(name string, defaultValue bool) bool {
+	return f(name, defaultValue)
+}
+
+// EnvFlagProvider is an IntFlagProvider of environment variables, read on each call.
+// The key of a flag is Prefix followed by its name upper-cased with `.` replaced by `_`,
+// e.g. `GOSQLRWDB_REPLICA_READS` for `FlagReplicaReads` and empty Prefix.
+// Values not parsed by `strconv.ParseBool()` or `strconv.Atoi()` are unknown.
+type EnvFlagProvider struct {
+	Prefix string
+}
+
+// Bool returns the value of the environment variable of name
+func (p EnvFlagProvider) Bool(name string, defaultValue bool) bool {
+	v, err := strconv.ParseBool(p.lookup(name))
+	if err != nil {
+		return defaultValue
+	}
+	return v
+}
+
+// Int returns the value of the environment variable of name
+func (p EnvFlagProvider) Int(name string, defaultValue int) int {
+	v, err := strconv.Atoi(p.lookup(name))
+	if err != nil {
+		return defaultValue
+	}
+	return v
+}
+
+func (p EnvFlagProvider) lookup(name string) string {
+	return strings.TrimSpace(os.Getenv(p.Prefix + strings.ToUpper(strings.Replace(name, ".", "_", -1))))
+}
+
+// SetFlagProvider sets the FlagProvider consulted for `Flag*` toggles of routing.
+// Passing nil restores the defaults of all flags, which is the default.
+func (db *DB) SetFlagProvider(p FlagProvider) {
+	db.configMutex.Lock()
+	db.flagProvider = p
+	db.configMutex.Unlock()
+}
+
+// SetFlag sets the flag of name to value in db, taking precedence over FlagProvider,
+// e.g. to flip a kill switch of a single process by `ServeControl()` while the flag system is unreachable.
+func (db *DB) SetFlag(name string, value bool) {
+	db.configMutex.Lock()
+	if db.localFlags == nil {
+		db.localFlags = map[string]bool{}
+	}
+	db.localFlags[name] = value
+	db.configMutex.Unlock()
+}
+
+// UnsetFlag removes the flag of name set by `SetFlag()`, so that FlagProvider decides it again
+func (db *DB) UnsetFlag(name string) {
+	db.configMutex.Lock()
+	delete(db.localFlags, name)
+	db.configMutex.Unlock()
+}
+
+// localFlag returns the flag of name set by `SetFlag()`
+func (db *DB) localFlag(name string) (bool, bool) {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	v, ok := db.localFlags[name]
+	return v, ok
+}
+
+// routingFlagProvider returns current FlagProvider, nil if not set
+func (db *DB) routingFlagProvider() FlagProvider {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.flagProvider
+}
+
+// flag returns the value of the flag of name by `SetFlag()` or FlagProvider, defaultValue if not set
+func (db *DB) flag(name string, defaultValue bool) bool {
+	if v, ok := db.localFlag(name); ok {
+		return v
+	}
+	p := db.routingFlagProvider()
+	if p == nil {
+		return defaultValue
+	}
+	return p.Bool(name, defaultValue)
+}
+
+// intFlag returns the value of the flag of name by IntFlagProvider, defaultValue if not set
+func (db *DB) intFlag(name string, defaultValue int) int {
+	p, ok := db.routingFlagProvider().(IntFlagProvider)
+	if !ok {
+		return defaultValue
+	}
+	return p.Int(name, defaultValue)
+}
+
+// fallbackToPrimary returns true if the read of ctx can fall back to primary DB, by `FlagPrimaryFallback` as well.
+// It is called only when the read is to fall back, so that a fallback switched off is audited as an override.
+func (db *DB) fallbackToPrimary(ctx context.Context) bool {
+	if !db.primaryAvailable() {
+		return false
+	}
+	if db.flag(FlagPrimaryFallback, true) {
+		return true
+	}
+	db.auditOverride(ctx, OverridePrimaryFallbackOff)
+	return false
+}
@@ -0,0 +1,147 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+// flagsMock is an IntFlagProvider of fixed values
+type flagsMock map[string]interface{}
+
+func (m flagsMock) Bool(name string, defaultValue bool) bool {
+	if v, ok := m[name].(bool); ok {
+		return v
+	}
+	return defaultValue
+}
+
+func (m flagsMock) Int(name string, defaultValue int) int {
+	if v, ok := m[name].(int); ok {
+		return v
+	}
+	return defaultValue
+}
+
+func TestEnvFlagProvider(t *testing.T) {
+	os.Setenv("ORDERS_GOSQLRWDB_REPLICA_READS", "false")
+	os.Setenv("ORDERS_GOSQLRWDB_READ_PERCENTAGE", "x")
+	defer os.Unsetenv("ORDERS_GOSQLRWDB_REPLICA_READS")
+	defer os.Unsetenv("ORDERS_GOSQLRWDB_READ_PERCENTAGE")
+
+	p := EnvFlagProvider{Prefix: "ORDERS_"}
+	if p.Bool(FlagReplicaReads, true) {
+		t.Errorf("actual %s = true, expected = false", FlagReplicaReads)
+	}
+	if !p.Bool(FlagPrimaryFallback, true) {
+		t.Errorf("actual %s = false, expected default true", FlagPrimaryFallback)
+	}
+	if actual := p.Int(FlagReadPercentage, 80); actual != 80 {
+		t.Errorf("actual %s = %d, expected default 80 of invalid value", FlagReadPercentage, actual)
+	}
+}
+
+func TestFlagProvider(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	db.SetFallbackPolicy(&FallbackPolicy{
+		Actions: map[ErrorClass]FallbackAction{ErrorClassConnection: FallbackRetryPrimary},
+	})
+	connErr := &net.OpError{Op: "read", Err: fmt.Errorf("connection reset")}
+
+	tests := []struct {
+		flags   flagsMock
+		replica bool
+		failed  bool
+	}{
+		{nil, true, false},
+		{flagsMock{FlagReplicaReads: false}, false, false},
+		{flagsMock{FlagReadPercentage: 0}, false, false},
+		{flagsMock{FlagReadPercentage: -10, FlagReplicaReads: true}, false, false},
+		{flagsMock{FlagReadPercentage: 100}, true, true},
+		{flagsMock{FlagPrimaryFallback: false}, true, true},
+	}
+	for i, test := range tests {
+		if test.flags == nil {
+			db.SetFlagProvider(nil)
+		} else {
+			db.SetFlagProvider(test.flags)
+		}
+		fallback := test.failed && test.flags[FlagPrimaryFallback] != false
+		if test.replica {
+			expectation := r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)"))
+			if test.failed {
+				expectation.WillReturnError(connErr)
+			} else {
+				expectation.WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+			}
+		}
+		if !test.replica || fallback {
+			p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+		}
+		rows, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+		if test.failed && !fallback {
+			if err == nil {
+				t.Errorf("actual no err, expected the error of read replica by flags %+v", test.flags)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("error %s when QueryContext of test %d", err, i)
+		}
+		rows.Close()
+	}
+
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetFlag(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	tests := []struct {
+		provider FlagProvider
+		local    *bool
+		expected bool
+	}{
+		{nil, nil, true},
+		{flagsMock{FlagReplicaReads: false}, nil, false},
+		{flagsMock{FlagReplicaReads: false}, &[]bool{true}[0], true},
+		{nil, &[]bool{false}[0], false},
+	}
+	for i, test := range tests {
+		db.SetFlagProvider(test.provider)
+		db.UnsetFlag(FlagReplicaReads)
+		if test.local != nil {
+			db.SetFlag(FlagReplicaReads, *test.local)
+		}
+		if actual := db.flag(FlagReplicaReads, true); actual != test.expected {
+			t.Errorf("actual: %t, expected: %t of test %d", actual, test.expected, i)
+		}
+	}
+}
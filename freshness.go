@@ -0,0 +1,97 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// freshnessAssertTimeout is the timeout of reads on primary DB by `WithFreshnessAssert()`,
+// which outlive contexts of the reads on read replicas
+const freshnessAssertTimeout = 30 * time.Second
+
+// FreshnessMismatchError reports that a read on a read replica differs from the same read on primary DB,
+// by `EventFreshnessMismatch` of `WithFreshnessAssert()`
+type FreshnessMismatchError struct {
+	// StatementID & Query are the ID and the query of the read
+	StatementID string
+	Query       string
+
+	// Replica is the read replica the read was routed to
+	Replica TargetInfo
+
+	// ReplicaRows & PrimaryRows are numbers of rows read, up to the first row for `QueryRowContext()`
+	ReplicaRows int
+	PrimaryRows int
+}
+
+func (e *FreshnessMismatchError) Error() string {
+	return fmt.Sprintf("rows of statement %s on %s differ from primary DB: %d rows vs %d rows",
+		e.StatementID, e.Replica.Name, e.ReplicaRows, e.PrimaryRows)
+}
+
+// assertFreshness reads rows of the read of stmt on read replica tgtdb into memory, up to limit rows if positive,
+// and returns them to be served from memory, comparing them with the same read on primary DB in background
+func (db *DB) assertFreshness(stmt StatementInfo, tgtdb *sql.DB, rows *sql.Rows, args []interface{}, limit int) (*flightResult, error) {
+	result, err := readFlightResult(tgtdb, rows, limit)
+	if err != nil || db.master == nil || db.PrimaryInMaintenance() {
+		return result, err
+	}
+	go db.compareWithPrimary(stmt, result, args, limit)
+	return result, nil
+}
+
+// compareWithPrimary runs the read of stmt on primary DB and reports by `EventFreshnessMismatch` if it differs from replica
+func (db *DB) compareWithPrimary(stmt StatementInfo, replica *flightResult, args []interface{}, limit int) {
+	ctx, cancel := context.WithTimeout(WithStatementID(context.Background(), stmt.ID), freshnessAssertTimeout)
+	defer cancel()
+	ctx, info := db.newStatement(ctx, "FreshnessAssert", stmt.Query, args)
+	db.countRead(db.master)
+	var primary *flightResult
+	err := db.runStatement(ctx, info, db.master, func(query string) error {
+		rows, err := db.master.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		primary, err = readFlightResult(db.master, rows, limit)
+		return err
+	})
+	if err != nil {
+		db.debugf(DebugError, "[FreshnessAssert] statement: %s err: %s", stmt.ID, err)
+		return
+	}
+	if reflect.DeepEqual(replica.columns, primary.columns) && reflect.DeepEqual(replica.values, primary.values) {
+		return
+	}
+	atomic.AddUint64(&db.metrics.freshnessMismatches, 1)
+	target := db.targetInfo(replica.tgtdb)
+	db.emit(Event{Type: EventFreshnessMismatch, Target: target, Err: &FreshnessMismatchError{
+		StatementID: stmt.ID,
+		Query:       stmt.Query,
+		Replica:     target,
+		ReplicaRows: len(replica.values),
+		PrimaryRows: len(primary.values),
+	}})
+}
+
+// queryRowAsserted is `QueryRowContext()` on read replica tgtdb with ctx of `WithFreshnessAssert()`
+func (db *DB) queryRowAsserted(ctx context.Context, stmt StatementInfo, tgtdb *sql.DB, args []interface{}) *sql.Row {
+	var rows *sql.Rows
+	err := db.runStatement(ctx, stmt, tgtdb, func(query string) error {
+		var err error
+		rows, err = tgtdb.QueryContext(ctx, query, args...)
+		return err
+	})
+	var result *flightResult
+	if err == nil {
+		result, err = db.assertFreshness(stmt, tgtdb, rows, args, 1)
+	}
+	if err != nil {
+		db.metrics.countError(err)
+		return errRow(err)
+	}
+	return memDB.QueryRowContext(ctx, "", result)
+}
@@ -0,0 +1,82 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWithFreshnessAssert(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+	events := make(chan Event, 10)
+	db.OnEvent(func(e Event) {
+		if e.Type == EventFreshnessMismatch {
+			events <- e
+		}
+	})
+	// reads on primary DB run in background in any order
+	p.mock.MatchExpectationsInOrder(false)
+	ctx := WithFreshnessAssert(context.Background())
+	query := "select id from mytable where org_id = ?"
+
+	// expected before any read, as reads on primary DB run in background
+	r0.mock.ExpectQuery("select id from mytable").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	p.mock.ExpectQuery("select id from mytable").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	r0.mock.ExpectQuery("select id from mytable").WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	p.mock.ExpectQuery("select id from mytable").WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+
+	// the same row
+	var id int
+	if err := db.QueryRowContext(ctx, query, 1).Scan(&id); err != nil || id != 5 {
+		t.Errorf("actual id: %d, err: %v, expected: 5", id, err)
+	}
+
+	// a row missing on the read replica is reported, rows of the read replica are returned
+	rows, err := db.QueryContext(ctx, query, 2)
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	var count int
+	for rows.Next() {
+		count++
+	}
+	rows.Close()
+	if count != 2 {
+		t.Errorf("actual rows: %d, expected: 2 of read replica", count)
+	}
+
+	select {
+	case e := <-events:
+		var mismatch *FreshnessMismatchError
+		if !errors.As(e.Err, &mismatch) || mismatch.ReplicaRows != 2 || mismatch.PrimaryRows != 3 || e.Target.Name != "replica-0" {
+			t.Errorf("actual event: %+v, expected: mismatch of 2 rows vs 3 rows on replica-0", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("actual no event, expected: %s", EventFreshnessMismatch)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for p.mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if actual := db.Metrics().FreshnessMismatches; actual != 1 || len(events) != 0 {
+		t.Errorf("actual mismatches: %d, events: %d, expected: 1 mismatch", actual, len(events)+1)
+	}
+
+	for _, m := range []*mydbMock{p, r0} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
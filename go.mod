@@ -5,4 +5,5 @@ go 1.14
 require (
 	github.com/DATA-DOG/go-sqlmock v1.5.0
 	go.uber.org/multierr v1.6.0
+	golang.org/x/sync v0.0.0-20220907140024-f12130a52804
 )
@@ -0,0 +1,189 @@
+package gosqlrwdbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/lisuizhe/gosqlrwdb"
+)
+
+// driverName is the name of the SQL driver backing targets of fake DB
+const driverName = "gosqlrwdbtest"
+
+// fakes holds all fake DB by id, so that connections can find their fake DB from the DSN
+var fakes sync.Map
+
+func init() {
+	sql.Register(driverName, fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+// Open opens a connection to the target in dsn formatted as "<fake id>/<role>/<index>"
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	var id string
+	var role, index int
+	if _, err := fmt.Sscanf(strings.Replace(dsn, "/", " ", -1), "%s %d %d", &id, &role, &index); err != nil {
+		return nil, fmt.Errorf("gosqlrwdbtest: invalid dsn %q: %w", dsn, err)
+	}
+	f, ok := fakes.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("gosqlrwdbtest: fake DB %s is closed", id)
+	}
+	return &conn{
+		fake:   f.(*DB),
+		target: targetInfo(gosqlrwdb.Role(role), index),
+	}, nil
+}
+
+type conn struct {
+	fake   *DB
+	target gosqlrwdb.TargetInfo
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return tx{}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return tx{}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.query(query, namedValues(args))
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.exec(query, namedValues(args))
+}
+
+func (c *conn) query(query string, args []interface{}) (driver.Rows, error) {
+	resp := c.fake.respond(Call{Method: "Query", Query: query, Args: args, Target: c.target})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	values := make([][]driver.Value, len(resp.Rows))
+	for i, row := range resp.Rows {
+		values[i] = make([]driver.Value, len(row))
+		for j, v := range row {
+			dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				return nil, err
+			}
+			values[i][j] = dv
+		}
+	}
+	return &rows{columns: resp.Columns, values: values}, nil
+}
+
+func (c *conn) exec(query string, args []interface{}) (driver.Result, error) {
+	resp := c.fake.respond(Call{Method: "Exec", Query: query, Args: args, Target: c.target})
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return result{lastInsertID: resp.LastInsertId, rowsAffected: resp.RowsAffected}, nil
+}
+
+func namedValues(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			values[i] = sql.Named(arg.Name, arg.Value)
+			continue
+		}
+		values[i] = arg.Value
+	}
+	return values
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.exec(s.query, values(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.query(s.query, values(args))
+}
+
+func values(args []driver.Value) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return values
+}
+
+type tx struct{}
+
+func (tx) Commit() error {
+	return nil
+}
+
+func (tx) Rollback() error {
+	return nil
+}
+
+type result struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
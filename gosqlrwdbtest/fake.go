@@ -0,0 +1,298 @@
+// Package gosqlrwdbtest provides a test double of `gosqlrwdb.DB`,
+// so that unit tests of code depending on `gosqlrwdb.Interface` can program routing outcomes
+// and responses, and assert which DB each call was routed to, without sqlmock choreography.
+package gosqlrwdbtest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lisuizhe/gosqlrwdb"
+)
+
+// Call is one call made to the fake DB, or one statement received by one of its targets
+type Call struct {
+	// Method is the name of the called method, e.g. `QueryContext`.
+	// For statements received by targets (see `DB.Respond`), it is `Query` or `Exec`.
+	Method string
+
+	Query  string
+	Args   []interface{}
+	Target gosqlrwdb.TargetInfo
+}
+
+// Response is the programmed response to a statement
+type Response struct {
+	// Columns & Rows are returned by queries
+	Columns []string
+	Rows    [][]interface{}
+
+	// LastInsertId & RowsAffected are returned by executions
+	LastInsertId int64
+	RowsAffected int64
+
+	// Err is returned by both queries and executions if non-nil
+	Err error
+}
+
+// RouteFunc decides the target of a call to method with query
+type RouteFunc func(ctx context.Context, method, query string) (gosqlrwdb.TargetInfo, error)
+
+// DB is a fake of `gosqlrwdb.DB` implementing `gosqlrwdb.Interface`.
+// It routes calls with `Route`, records them, and answers statements with `Respond`.
+// Set `Route` and `Respond` before use; they must be safe for concurrent use.
+type DB struct {
+	// Route decides the target of each call, `DefaultRoute()` of the fake if nil
+	Route RouteFunc
+
+	// Respond returns the response of each statement received by a target, empty response if nil
+	Respond func(call Call) Response
+
+	id       string
+	primary  *sql.DB
+	replicas []*sql.DB
+	count    uint64
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ gosqlrwdb.Interface = (*DB)(nil)
+
+var nextID uint64
+
+// New returns a fake DB with a primary and numReplicas read replicas
+func New(numReplicas int) *DB {
+	f := &DB{id: fmt.Sprintf("%d", atomic.AddUint64(&nextID, 1))}
+	fakes.Store(f.id, f)
+	f.primary = f.open(targetInfo(gosqlrwdb.RolePrimary, 0))
+	for i := 0; i < numReplicas; i++ {
+		f.replicas = append(f.replicas, f.open(targetInfo(gosqlrwdb.RoleReplica, i)))
+	}
+	return f
+}
+
+func (f *DB) open(target gosqlrwdb.TargetInfo) *sql.DB {
+	db, err := sql.Open(driverName, fmt.Sprintf("%s/%d/%d", f.id, target.Role, target.Index))
+	if err != nil {
+		// never happens as the driver is registered in init()
+		panic(err)
+	}
+	return db
+}
+
+// targetInfo returns TargetInfo of a target with default name & weight, as `gosqlrwdb.DB` does
+func targetInfo(role gosqlrwdb.Role, index int) gosqlrwdb.TargetInfo {
+	if role == gosqlrwdb.RolePrimary {
+		return gosqlrwdb.TargetInfo{Role: role, Name: "primary", Weight: 1}
+	}
+	return gosqlrwdb.TargetInfo{Role: role, Index: index, Name: fmt.Sprintf("replica-%d", index), Weight: 1}
+}
+
+// DefaultRoute routes like `gosqlrwdb.DB` does: queries to read replicas with Round-Robin
+// unless ctx is created from `gosqlrwdb.WithPrimary()`, and everything else to primary DB.
+func (f *DB) DefaultRoute(ctx context.Context, method, query string) (gosqlrwdb.TargetInfo, error) {
+	isRead := (method == "Query" || method == "QueryContext" || method == "QueryRow" || method == "QueryRowContext" ||
+		method == "Prepare" || method == "PrepareContext") && gosqlrwdb.IsQuerySqlFunc(query)
+	if !isRead || gosqlrwdb.UsePrimaryFromContext(ctx) {
+		return targetInfo(gosqlrwdb.RolePrimary, 0), nil
+	}
+	if len(f.replicas) == 0 {
+		return gosqlrwdb.TargetInfo{}, gosqlrwdb.ErrNotProvidedReplicas
+	}
+	idx := (atomic.AddUint64(&f.count, 1) - 1) % uint64(len(f.replicas))
+	return targetInfo(gosqlrwdb.RoleReplica, int(idx)), nil
+}
+
+// Calls returns calls made to the fake so far, in order
+func (f *DB) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := make([]Call, len(f.calls))
+	copy(calls, f.calls)
+	return calls
+}
+
+// Reset forgets recorded calls
+func (f *DB) Reset() {
+	f.mu.Lock()
+	f.calls = nil
+	f.mu.Unlock()
+}
+
+// route decides & records the target of a call, returning the handle of the target
+func (f *DB) route(ctx context.Context, method, query string, args []interface{}) (*sql.DB, gosqlrwdb.TargetInfo, error) {
+	route := f.Route
+	if route == nil {
+		route = f.DefaultRoute
+	}
+	target, err := route(ctx, method, query)
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Method: method, Query: query, Args: args, Target: target})
+	f.mu.Unlock()
+	if err != nil {
+		return nil, target, err
+	}
+	if target.Role == gosqlrwdb.RolePrimary {
+		return f.primary, target, nil
+	}
+	if target.Index < 0 || target.Index >= len(f.replicas) {
+		return nil, target, fmt.Errorf("gosqlrwdbtest: replica index %d out of range", target.Index)
+	}
+	return f.replicas[target.Index], target, nil
+}
+
+// respond returns the programmed response of a statement received by a target
+func (f *DB) respond(call Call) Response {
+	if f.Respond == nil {
+		return Response{}
+	}
+	return f.Respond(call)
+}
+
+// all returns handles of all targets
+func (f *DB) all() []*sql.DB {
+	return append([]*sql.DB{f.primary}, f.replicas...)
+}
+
+// Ping records the call and always succeeds
+func (f *DB) Ping() error {
+	return f.PingContext(context.Background())
+}
+
+// PingContext records the call and always succeeds
+func (f *DB) PingContext(ctx context.Context) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Method: "PingContext"})
+	f.mu.Unlock()
+	return nil
+}
+
+// Query routes and records the call
+func (f *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	tgtdb, _, err := f.route(context.Background(), "Query", query, args)
+	if err != nil {
+		return nil, err
+	}
+	return tgtdb.Query(query, args...)
+}
+
+// QueryContext routes and records the call
+func (f *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	tgtdb, _, err := f.route(ctx, "QueryContext", query, args)
+	if err != nil {
+		return nil, err
+	}
+	return tgtdb.QueryContext(ctx, query, args...)
+}
+
+// QueryRow routes and records the call. It panics if routing fails, like `gosqlrwdb.DB` does.
+func (f *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	tgtdb, _, err := f.route(context.Background(), "QueryRow", query, args)
+	if err != nil {
+		panic(err)
+	}
+	return tgtdb.QueryRow(query, args...)
+}
+
+// QueryRowContext routes and records the call. It panics if routing fails, like `gosqlrwdb.DB` does.
+func (f *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	tgtdb, _, err := f.route(ctx, "QueryRowContext", query, args)
+	if err != nil {
+		panic(err)
+	}
+	return tgtdb.QueryRowContext(ctx, query, args...)
+}
+
+// Begin routes and records the call
+func (f *DB) Begin() (*sql.Tx, error) {
+	tgtdb, _, err := f.route(context.Background(), "Begin", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return tgtdb.Begin()
+}
+
+// BeginTx routes and records the call
+func (f *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	tgtdb, _, err := f.route(ctx, "BeginTx", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return tgtdb.BeginTx(ctx, opts)
+}
+
+// Close closes all targets and unregisters the fake
+func (f *DB) Close() error {
+	for _, db := range f.all() {
+		db.Close()
+	}
+	fakes.Delete(f.id)
+	return nil
+}
+
+// Exec routes and records the call. The returned `sql.Result` is a `*gosqlrwdb.Result` like `gosqlrwdb.DB` returns.
+func (f *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return f.exec(context.Background(), "Exec", query, args)
+}
+
+// ExecContext routes and records the call. The returned `sql.Result` is a `*gosqlrwdb.Result` like `gosqlrwdb.DB` returns.
+func (f *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return f.exec(ctx, "ExecContext", query, args)
+}
+
+func (f *DB) exec(ctx context.Context, method, query string, args []interface{}) (sql.Result, error) {
+	tgtdb, target, err := f.route(ctx, method, query, args)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := tgtdb.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &gosqlrwdb.Result{Result: res, Target: target, Attempts: 1, Duration: time.Since(start)}, nil
+}
+
+// Prepare routes and records the call
+func (f *DB) Prepare(query string) (*sql.Stmt, error) {
+	tgtdb, _, err := f.route(context.Background(), "Prepare", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return tgtdb.Prepare(query)
+}
+
+// PrepareContext routes and records the call
+func (f *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	tgtdb, _, err := f.route(ctx, "PrepareContext", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return tgtdb.PrepareContext(ctx, query)
+}
+
+// SetConnMaxLifetime sets d to all targets
+func (f *DB) SetConnMaxLifetime(d time.Duration) {
+	for _, db := range f.all() {
+		db.SetConnMaxLifetime(d)
+	}
+}
+
+// SetMaxIdleConns sets n to all targets
+func (f *DB) SetMaxIdleConns(n int) {
+	for _, db := range f.all() {
+		db.SetMaxIdleConns(n)
+	}
+}
+
+// SetMaxOpenConns sets n to all targets
+func (f *DB) SetMaxOpenConns(n int) {
+	for _, db := range f.all() {
+		db.SetMaxOpenConns(n)
+	}
+}
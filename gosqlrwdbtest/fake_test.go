@@ -0,0 +1,104 @@
+package gosqlrwdbtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/lisuizhe/gosqlrwdb"
+)
+
+var (
+	primary  = gosqlrwdb.TargetInfo{Role: gosqlrwdb.RolePrimary, Name: "primary", Weight: 1}
+	replica0 = gosqlrwdb.TargetInfo{Role: gosqlrwdb.RoleReplica, Index: 0, Name: "replica-0", Weight: 1}
+	replica1 = gosqlrwdb.TargetInfo{Role: gosqlrwdb.RoleReplica, Index: 1, Name: "replica-1", Weight: 1}
+)
+
+func TestDefaultRoute(t *testing.T) {
+	f := New(2)
+	defer f.Close()
+
+	ctx := context.Background()
+	f.QueryContext(ctx, "select * from mytable")
+	f.QueryContext(ctx, "select * from mytable where id = ?", 1)
+	f.QueryContext(gosqlrwdb.WithPrimary(ctx), "select * from mytable")
+	f.ExecContext(ctx, "delete from mytable")
+	f.BeginTx(ctx, nil)
+
+	expected := []Call{
+		{Method: "QueryContext", Query: "select * from mytable", Target: replica0},
+		{Method: "QueryContext", Query: "select * from mytable where id = ?", Args: []interface{}{1}, Target: replica1},
+		{Method: "QueryContext", Query: "select * from mytable", Target: primary},
+		{Method: "ExecContext", Query: "delete from mytable", Target: primary},
+		{Method: "BeginTx", Target: primary},
+	}
+	if actual := f.Calls(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual = %+v, expected = %+v", actual, expected)
+	}
+
+	f.Reset()
+	if actual := f.Calls(); len(actual) != 0 {
+		t.Errorf("actual calls after Reset: %d, expected: 0", len(actual))
+	}
+}
+
+func TestRespond(t *testing.T) {
+	f := New(1)
+	defer f.Close()
+
+	var received []Call
+	f.Respond = func(call Call) Response {
+		received = append(received, call)
+		if call.Method == "Exec" {
+			return Response{RowsAffected: 3}
+		}
+		return Response{Columns: []string{"id", "name"}, Rows: [][]interface{}{{1, "a"}, {2, "b"}}}
+	}
+
+	var id int
+	var name string
+	if err := f.QueryRow("select id, name from mytable").Scan(&id, &name); err != nil {
+		t.Fatalf("error %s when QueryRow", err)
+	}
+	if id != 1 || name != "a" {
+		t.Errorf("actual = (%d, %s), expected = (1, a)", id, name)
+	}
+
+	res, err := f.Exec("delete from mytable")
+	if err != nil {
+		t.Fatalf("error %s when Exec", err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Errorf("actual rows affected: %d, expected: 3", n)
+	}
+	if r, ok := res.(*gosqlrwdb.Result); !ok || r.Target != primary || r.Attempts != 1 {
+		t.Errorf("actual result: %+v, expected *gosqlrwdb.Result routed to primary", res)
+	}
+
+	if len(received) != 2 || received[0].Target != replica0 || received[1].Target != primary {
+		t.Errorf("actual received: %+v", received)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	f := New(2)
+	defer f.Close()
+
+	errRoute := fmt.Errorf("no replica")
+	f.Route = func(ctx context.Context, method, query string) (gosqlrwdb.TargetInfo, error) {
+		if method == "Query" {
+			return gosqlrwdb.TargetInfo{}, errRoute
+		}
+		return replica1, nil
+	}
+	if _, err := f.Query("select 1"); err != errRoute {
+		t.Errorf("actual err: %v, expected: %s", err, errRoute)
+	}
+	if _, err := f.Exec("select 1"); err != nil {
+		t.Errorf("error %s when Exec", err)
+	}
+	if actual := f.Calls()[1].Target; actual != replica1 {
+		t.Errorf("actual target = %+v, expected = %+v", actual, replica1)
+	}
+}
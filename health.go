@@ -0,0 +1,87 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultHealthCheckInterval is the default of `HealthPolicy.Interval`
+const defaultHealthCheckInterval = time.Second
+
+// HealthPolicy is the condition `WaitForHealthy()` waits for
+type HealthPolicy struct {
+	// MinReplicas is the minimum number of read replicas passing health checks, default to 1
+	MinReplicas int
+
+	// SkipPrimary does not require primary DB to pass health checks, e.g. for read-only services.
+	// Primary DB in maintenance mode is never required.
+	SkipPrimary bool
+
+	// Interval is the interval of health checks while waiting, default to 1s
+	Interval time.Duration
+}
+
+func (p HealthPolicy) withDefaults() HealthPolicy {
+	if p.MinReplicas <= 0 {
+		p.MinReplicas = 1
+	}
+	if p.Interval <= 0 {
+		p.Interval = defaultHealthCheckInterval
+	}
+	return p
+}
+
+// WaitForHealthy blocks until primary DB and at least `policy.MinReplicas` read replicas pass health checks,
+// for use during service startup before accepting traffic, as `New()` returns even if everything is unreachable.
+//
+// Health checks are done every `policy.Interval` and their results are used for routing as heartbeats are.
+// It returns an error satisfying `errors.Is(err, ErrNotHealthy)` if ctx is done before that.
+func (db *DB) WaitForHealthy(ctx context.Context, policy HealthPolicy) error {
+	policy = policy.withDefaults()
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+	for {
+		db.refreshHealth()
+		primaryHealthy, healthyReplicas := db.healthy()
+		if (primaryHealthy || policy.SkipPrimary) && healthyReplicas >= policy.MinReplicas {
+			return nil
+		}
+		db.debugf(DebugEvent, "[WaitForHealthy] primary healthy: %t, healthy replicas: %d", primaryHealthy, healthyReplicas)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: primary healthy: %t, healthy replicas: %d (%d required): %s",
+				ErrNotHealthy, primaryHealthy, healthyReplicas, policy.MinReplicas, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthy returns whether primary DB passed the last health check (or is in maintenance mode),
+// and number of read replicas passing the last health check, excluding drained ones
+func (db *DB) healthy() (bool, int) {
+	db.countMutex.RLock()
+	primaryHealthy := db.PrimaryInMaintenance() || (db.master != nil && db.primaryDown == nil)
+	db.countMutex.RUnlock()
+	healthyReplicas, _ := db.healthyReplicas()
+	return primaryHealthy, healthyReplicas
+}
+
+// healthyReplicas returns number of read replicas passing the last health check (including `ReadinessCheck`) and
+// number of all read replicas, both excluding drained ones
+func (db *DB) healthyReplicas() (int, int) {
+	db.countMutex.RLock()
+	defer db.countMutex.RUnlock()
+	healthy, total := 0, 0
+	for _, r := range db.readreplicas {
+		if _, drained := db.drainedReplicas[r]; drained {
+			continue
+		}
+		total++
+		if _, unavailable := db.unavailableReplicas[r]; !unavailable && db.ready(r) {
+			healthy++
+		}
+	}
+	return healthy, total
+}
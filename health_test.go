@@ -0,0 +1,82 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWaitForHealthy(t *testing.T) {
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	// everything is unreachable at startup, and unexpected pings fail
+	p.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	r1.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	err = db.WaitForHealthy(ctx, HealthPolicy{Interval: 10 * time.Millisecond})
+	if !errors.Is(err, ErrNotHealthy) {
+		t.Errorf("actual err = %v, expected = %s", err, ErrNotHealthy)
+	}
+
+	// primary & 1 replica become reachable
+	p.mock.ExpectPing()
+	r1.mock.ExpectPing()
+	if err = db.WaitForHealthy(context.Background(), HealthPolicy{}); err != nil {
+		t.Errorf("error %s when WaitForHealthy", err)
+	}
+	testReplicaIndexMatch(t, db, 0)
+	testReplicaIndexMatch(t, db, 0)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	p.mock.ExpectPing()
+	r1.mock.ExpectPing()
+	err = db.WaitForHealthy(ctx, HealthPolicy{MinReplicas: 2, Interval: 10 * time.Millisecond})
+	if !errors.Is(err, ErrNotHealthy) {
+		t.Errorf("actual err = %v, expected = %s for 2 replicas", err, ErrNotHealthy)
+	}
+}
+
+func TestWaitForHealthySkipPrimary(t *testing.T) {
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	p.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	r1.mock.ExpectPing()
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	r1.mock.ExpectPing()
+	if err = db.WaitForHealthy(context.Background(), HealthPolicy{SkipPrimary: true}); err != nil {
+		t.Errorf("error %s when WaitForHealthy", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,92 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"math/bits"
+)
+
+// Defaults of HealthWeightPolicy
+const (
+	defaultHealthWeightWindow    = 10
+	defaultHealthWeightMinWeight = 0.1
+
+	// maxHealthWeightWindow is the number of probe results kept per read replica
+	maxHealthWeightWindow = 64
+)
+
+// HealthWeightPolicy reduces traffic share of a flapping read replica to its probe success ratio
+// over the last `Window` health checks, instead of all-or-nothing load shifts between healthy and unhealthy.
+// A probe succeeds if the read replica passes both ping and `ReadinessCheck`.
+// Read replicas failing the current health check are still excluded.
+type HealthWeightPolicy struct {
+	// Window is the number of recent health checks (up to 64) to calculate success ratio over. Default to 10.
+	Window int
+
+	// MinWeight is the lowest share (0.0 ~ 1.0) of traffic of a healthy read replica. Default to 0.1.
+	MinWeight float64
+}
+
+// SetHealthWeightPolicy sets the HealthWeightPolicy of read replicas.
+// Passing nil makes healthy read replicas get full traffic regardless of past health checks, which is the default.
+// It has no effect if health checks are disabled by `DisableReplicaAutoFailover`.
+func (db *DB) SetHealthWeightPolicy(p *HealthWeightPolicy) {
+	if p != nil {
+		copied := *p
+		if copied.Window <= 0 {
+			copied.Window = defaultHealthWeightWindow
+		}
+		if copied.Window > maxHealthWeightWindow {
+			copied.Window = maxHealthWeightWindow
+		}
+		if copied.MinWeight <= 0 || copied.MinWeight > 1 {
+			copied.MinWeight = defaultHealthWeightMinWeight
+		}
+		p = &copied
+	}
+	db.configMutex.Lock()
+	db.healthWeightPolicy = p
+	db.configMutex.Unlock()
+}
+
+// replicaHealthWeightPolicy returns current HealthWeightPolicy, nil if not set
+func (db *DB) replicaHealthWeightPolicy() *HealthWeightPolicy {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.healthWeightPolicy
+}
+
+// recordProbe records the result of a health check of r, caller must hold countMutex
+func (db *DB) recordProbe(r *sql.DB, ok bool) {
+	state := db.replicaStates[r]
+	state.probes <<= 1
+	if ok {
+		state.probes |= 1
+	}
+	if state.probeCount < maxHealthWeightWindow {
+		state.probeCount++
+	}
+}
+
+// healthWeight returns share of traffic of r by policy, 1 if policy is nil. Caller must hold countMutex.
+func (db *DB) healthWeight(policy *HealthWeightPolicy, r *sql.DB) float64 {
+	if policy == nil {
+		return 1
+	}
+	state := db.replicaStates[r]
+	n := state.probeCount
+	if n > policy.Window {
+		n = policy.Window
+	}
+	if n == 0 {
+		return 1
+	}
+	mask := uint64(1)<<uint(n) - 1
+	if n == maxHealthWeightWindow {
+		mask = ^uint64(0)
+	}
+	weight := float64(bits.OnesCount64(state.probes&mask)) / float64(n)
+	if weight < policy.MinWeight {
+		return policy.MinWeight
+	}
+	return weight
+}
@@ -0,0 +1,94 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestHealthWeight(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	db.SetHealthWeightPolicy(&HealthWeightPolicy{Window: 4, MinWeight: 1e-9})
+
+	// replica 1 is flapping: 2 successes of last 4 probes
+	for _, fails := range []bool{true, false, true, true} {
+		r1.mock.ExpectPing()
+		if fails {
+			r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+		} else {
+			r2.mock.ExpectPing()
+		}
+		db.refreshUnavailableReplicas()
+	}
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db.refreshUnavailableReplicas()
+
+	policy := db.replicaHealthWeightPolicy()
+	db.countMutex.RLock()
+	weights := []float64{db.healthWeight(policy, r1.db), db.healthWeight(policy, r2.db)}
+	db.countMutex.RUnlock()
+	if weights[0] != 1 || weights[1] != 0.5 {
+		t.Errorf("actual weights = %v, expected = [1 0.5]", weights)
+	}
+
+	// the floor applies to a healthy replica
+	db.SetHealthWeightPolicy(&HealthWeightPolicy{Window: 4, MinWeight: 0.75})
+	policy = db.replicaHealthWeightPolicy()
+	db.countMutex.RLock()
+	actual := db.healthWeight(policy, r2.db)
+	db.countMutex.RUnlock()
+	if actual != 0.75 {
+		t.Errorf("actual weight = %f, expected = 0.75", actual)
+	}
+
+	// flapping replica gets fewer reads, with or without Balancer
+	db.SetHealthWeightPolicy(&HealthWeightPolicy{Window: 4, MinWeight: 1e-9})
+	db.countMutex.Lock()
+	db.replicaStates[r2.db].probes = 0x10 // only the 5th last probe succeeded
+	db.countMutex.Unlock()
+	for _, balancer := range []Balancer{nil, &RoundRobinBalancer{}} {
+		db.SetBalancer(balancer)
+		for i := 0; i < 4; i++ {
+			_, target, err := db.SelectReplica(context.Background())
+			if err != nil {
+				t.Fatalf("error %s when SelectReplica", err)
+			}
+			if target.Index != 0 {
+				t.Errorf("actual = %+v, expected replica 0 as replica 1 is flapping, balancer: %T", target, balancer)
+			}
+		}
+	}
+
+	// full traffic without HealthWeightPolicy
+	db.SetHealthWeightPolicy(nil)
+	db.SetBalancer(nil)
+	selected := map[int]int{}
+	for i := 0; i < 4; i++ {
+		_, target, err := db.SelectReplica(context.Background())
+		if err != nil {
+			t.Fatalf("error %s when SelectReplica", err)
+		}
+		selected[target.Index]++
+	}
+	if selected[0] != 2 || selected[1] != 2 {
+		t.Errorf("actual selected = %v, expected evenly distributed", selected)
+	}
+}
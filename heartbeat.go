@@ -0,0 +1,248 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// heartbeater runs a function every interval in its own goroutine until `Stop()` is called.
+// The goroutine and its ticker are owned by heartbeater and released by `Stop()`.
+// The context passed to the function is cancelled by `Stop()`, so that a hung ping does not block it.
+type heartbeater struct {
+	interval time.Duration
+	jitter   float64
+	fn       func(ctx context.Context)
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// startHeartbeater returns a started heartbeater calling fn every interval
+func startHeartbeater(interval time.Duration, fn func()) *heartbeater {
+	return startJitteredHeartbeater(interval, 0, fn)
+}
+
+// startJitteredHeartbeater returns a started heartbeater calling fn every interval,
+// each randomly delayed or advanced by up to jitter (0.0 ~ 1.0) of interval after fn returns
+func startJitteredHeartbeater(interval time.Duration, jitter float64, fn func()) *heartbeater {
+	return startJitteredHeartbeaterContext(interval, jitter, func(context.Context) {
+		fn()
+	})
+}
+
+// startJitteredHeartbeaterContext is `startJitteredHeartbeater()` calling fn with a context cancelled by `Stop()`
+func startJitteredHeartbeaterContext(interval time.Duration, jitter float64, fn func(ctx context.Context)) *heartbeater {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &heartbeater{
+		interval: interval,
+		jitter:   jitter,
+		fn:       fn,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	if jitter > 0 {
+		go h.runJittered()
+	} else {
+		go h.run()
+	}
+	return h
+}
+
+// jitteredInterval returns interval delayed or advanced by jitter of it, by r in [0.0, 1.0)
+func jitteredInterval(interval time.Duration, jitter, r float64) time.Duration {
+	return interval + time.Duration((2*r-1)*jitter*float64(interval))
+}
+
+func (h *heartbeater) runJittered() {
+	defer close(h.done)
+	for {
+		timer := time.NewTimer(jitteredInterval(h.interval, h.jitter, rand.Float64()))
+		select {
+		case <-timer.C:
+			h.fn(h.ctx)
+		case <-h.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (h *heartbeater) run() {
+	ticker := time.NewTicker(h.interval)
+	defer func() {
+		ticker.Stop()
+		close(h.done)
+	}()
+	for {
+		select {
+		case <-ticker.C:
+			h.fn(h.ctx)
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the goroutine, cancelling the context of a running call, and waits until it exits.
+// It is safe to call Stop more than once.
+func (h *heartbeater) Stop() {
+	h.cancel()
+	<-h.done
+}
+
+// heartbeat returns map that holds unavailable(Ping has error) readreplica and its error
+func heartbeat(readreplicas []*sql.DB) map[*sql.DB]error {
+	return heartbeatContext(context.Background(), readreplicas)
+}
+
+// heartbeatContext is `heartbeat()` pinging with ctx
+func heartbeatContext(ctx context.Context, readreplicas []*sql.DB) map[*sql.DB]error {
+	unavailableReplicas := map[*sql.DB]error{}
+	var err error
+	for _, r := range readreplicas {
+		if err = r.PingContext(ctx); err != nil {
+			unavailableReplicas[r] = err
+		}
+	}
+	return unavailableReplicas
+}
+
+// refreshUnavailableReplicas pings all read replicas (except drained ones) and replaces the unavailable set,
+// emitting `EventReplicaDown` / `EventReplicaUp` on change.
+// Failing read replicas are suspected first while in the grace period set by `SetFailoverGracePeriod()`.
+// Alive read replicas are checked by `ReadinessCheck` as well, emitting `EventReplicaNotReady` / `EventReplicaReady` on change.
+// Pings are done without holding the lock so that routing is not blocked by slow replicas.
+// It does nothing while health checks are paused by `PauseHealthChecks()`.
+func (db *DB) refreshUnavailableReplicas() {
+	db.refreshUnavailableReplicasContext(context.Background())
+}
+
+// refreshUnavailableReplicasContext is `refreshUnavailableReplicas()` pinging with ctx.
+// Nothing is updated if ctx is done while pinging, e.g. by the heartbeater stopped.
+func (db *DB) refreshUnavailableReplicasContext(ctx context.Context) {
+	if db.healthChecksPaused() {
+		db.debugf(DebugEvent, "[refreshUnavailableReplicas] paused")
+		return
+	}
+	replicas := db.activeReplicas()
+	failing := db.probeReplicas(ctx, replicas)
+	notReady := db.checkReadiness(ctx, replicas, failing)
+	if db.healthChecksPaused() || ctx.Err() != nil {
+		// paused or stopped while pinging
+		return
+	}
+	grace := db.replicaFailoverGracePeriod()
+	rampUp := db.replicaRampUpPolicy()
+	now := time.Now()
+	unavailableReplicas := map[*sql.DB]struct{}{}
+	var events []Event
+
+	for r, err := range failing {
+		db.recordError(db.targetInfo(r), OperationHealthCheck, "", err)
+	}
+	for r, err := range notReady {
+		db.recordError(db.targetInfo(r), OperationReadinessCheck, "", err)
+	}
+
+	db.countMutex.Lock()
+	previous := db.unavailableReplicas
+	for _, r := range replicas {
+		_, was := previous[r]
+		err, fails := failing[r]
+		since, suspected := db.suspectReplicas[r]
+		switch {
+		case fails && (was || grace <= 0 || (suspected && now.Sub(since) >= grace)):
+			unavailableReplicas[r] = empty
+			delete(db.suspectReplicas, r)
+			if !was {
+				db.replicaStates[r].downSince = now
+				if suspected {
+					db.replicaStates[r].downSince = since
+				}
+				events = append(events, Event{Type: EventReplicaDown, Target: db.targetInfo(r), Err: err})
+			}
+		case fails && !suspected:
+			db.suspectReplicas[r] = now
+			events = append(events, Event{Type: EventReplicaSuspect, Target: db.targetInfo(r), Err: err})
+		case fails:
+			// still in the grace period
+		case was:
+			db.startRampUp(r, now)
+			events = append(events, Event{Type: EventReplicaUp, Target: db.targetInfo(r)})
+		case suspected:
+			delete(db.suspectReplicas, r)
+			events = append(events, Event{Type: EventReplicaSuspectCleared, Target: db.targetInfo(r)})
+		}
+	}
+	for _, r := range replicas {
+		err, isNotReady := notReady[r]
+		_, fails := failing[r]
+		db.recordProbe(r, !fails && !isNotReady)
+		if fails {
+			continue
+		}
+		if _, wasNotReady := db.notReadyReplicas[r]; isNotReady && !wasNotReady {
+			db.replicaStates[r].notReadySince = now
+			events = append(events, Event{Type: EventReplicaNotReady, Target: db.targetInfo(r), Err: err})
+		} else if !isNotReady && wasNotReady {
+			db.startRampUp(r, now)
+			events = append(events, Event{Type: EventReplicaReady, Target: db.targetInfo(r)})
+		}
+	}
+	db.unavailableReplicas = unavailableReplicas
+	notReadyReplicas := make(map[*sql.DB]struct{}, len(notReady))
+	for r := range notReady {
+		notReadyReplicas[r] = empty
+	}
+	db.notReadyReplicas = notReadyReplicas
+	for r, since := range db.rampingSince {
+		if rampUp == nil || now.Sub(since) >= rampUp.Window {
+			delete(db.rampingSince, r)
+		}
+	}
+	db.countMutex.Unlock()
+
+	for _, e := range events {
+		db.emit(e)
+	}
+	db.updateQuorum()
+}
+
+// refreshHealth checks health of primary DB and read replicas, saving unavailable ones by `SetUnavailableStore()`
+func (db *DB) refreshHealth() {
+	db.refreshHealthContext(context.Background())
+}
+
+// refreshHealthContext is `refreshHealth()` pinging with ctx
+func (db *DB) refreshHealthContext(ctx context.Context) {
+	db.refreshPrimaryContext(ctx)
+	db.refreshUnavailableReplicasContext(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	db.saveUnavailable(time.Now())
+}
+
+// PauseHealthChecks freezes failover decisions, e.g. during planned network maintenance to prevent flapping:
+// the set of unavailable read replicas is kept as it is, and no read replica is newly evicted for breaching the SLO,
+// until `ResumeHealthChecks()` is called.
+func (db *DB) PauseHealthChecks() {
+	atomic.StoreUint32(&db.pauseHealthChecks, 1)
+	db.debugf(DebugEvent, "[PauseHealthChecks] paused")
+}
+
+// ResumeHealthChecks re-enables failover decisions paused by `PauseHealthChecks()`.
+// Unavailable read replicas are refreshed by the next heartbeat.
+func (db *DB) ResumeHealthChecks() {
+	atomic.StoreUint32(&db.pauseHealthChecks, 0)
+	db.debugf(DebugEvent, "[ResumeHealthChecks] resumed")
+}
+
+// healthChecksPaused returns true if health checks are paused by `PauseHealthChecks()`
+func (db *DB) healthChecksPaused() bool {
+	return atomic.LoadUint32(&db.pauseHealthChecks) == 1
+}
@@ -0,0 +1,286 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHeartbeater(t *testing.T) {
+	var calls int32
+	h := startHeartbeater(10*time.Millisecond, func() {
+		atomic.AddInt32(&calls, 1)
+	})
+	time.Sleep(55 * time.Millisecond)
+	h.Stop()
+	h.Stop()
+
+	stopped := atomic.LoadInt32(&calls)
+	if stopped == 0 {
+		t.Errorf("heartbeater did not call fn")
+	}
+	select {
+	case <-h.done:
+	default:
+		t.Errorf("heartbeater goroutine did not exit after Stop")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if actual := atomic.LoadInt32(&calls); actual != stopped {
+		t.Errorf("actual calls: %d, expected: %d after Stop", actual, stopped)
+	}
+}
+
+func TestHeartbeaterStopCancelsCall(t *testing.T) {
+	entered := make(chan struct{})
+	h := startJitteredHeartbeaterContext(time.Millisecond, 0, func(ctx context.Context) {
+		select {
+		case entered <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+	})
+	<-entered
+
+	stopped := make(chan struct{})
+	go func() {
+		h.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("Stop should not wait for a call blocked until its context is done")
+	}
+}
+
+func TestNewWhenDisableReplicaAutoFailover(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	DisableReplicaAutoFailover = true
+	defer func() {
+		DisableReplicaAutoFailover = false
+	}()
+	db := New(p.db, r1.db)
+	if db.heartbeater != nil {
+		t.Errorf("heartbeater should not be started when auto failover is disabled")
+	}
+	p.mock.ExpectClose()
+	r1.mock.ExpectClose()
+	if err = db.Close(); err != nil {
+		t.Errorf("error %s when Close", err)
+	}
+}
+
+func TestCloseStopsHeartbeater(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	db := New(p.db, r1.db)
+	if db.heartbeater == nil {
+		t.Fatalf("heartbeater should be started when auto failover is enabled")
+	}
+	db.Close()
+	db.Close()
+	select {
+	case <-db.heartbeater.done:
+	default:
+		t.Errorf("heartbeater goroutine did not exit after Close")
+	}
+}
+
+func TestPauseHealthChecks(t *testing.T) {
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	db.SetReplicaSLO(&SLO{MinRequests: 1, MaxErrorRate: 0.5})
+
+	db.PauseHealthChecks()
+	// no ping while paused
+	db.refreshUnavailableReplicas()
+	db.observe(context.Background(), r1.db, time.Now(), fmt.Errorf("replica error"))
+	if db.evicted(r1.db) {
+		t.Errorf("replica 1 should not be evicted while health checks are paused")
+	}
+	testReplicaIndexMatch(t, db, 0)
+	testReplicaIndexMatch(t, db, 1)
+
+	db.ResumeHealthChecks()
+	r1.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	r2.mock.ExpectPing()
+	db.refreshUnavailableReplicas()
+	testReplicaIndexMatch(t, db, 1)
+	testReplicaIndexMatch(t, db, 1)
+
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestJitteredInterval(t *testing.T) {
+	tests := []struct {
+		jitter   float64
+		r        float64
+		expected time.Duration
+	}{
+		{0, 0.9, 10 * time.Second},
+		{0.1, 0, 9 * time.Second},
+		{0.1, 0.5, 10 * time.Second},
+		{0.2, 0.75, 11 * time.Second},
+	}
+	for _, test := range tests {
+		if actual := jitteredInterval(10*time.Second, test.jitter, test.r); actual != test.expected {
+			t.Errorf("jitter: %.1f, r: %.2f, actual: %s, expected: %s", test.jitter, test.r, actual, test.expected)
+		}
+	}
+
+	var calls int32
+	h := startJitteredHeartbeater(10*time.Millisecond, 0.5, func() {
+		atomic.AddInt32(&calls, 1)
+	})
+	time.Sleep(55 * time.Millisecond)
+	h.Stop()
+	if atomic.LoadInt32(&calls) == 0 {
+		t.Errorf("jittered heartbeater did not call fn")
+	}
+}
+
+func TestSetProbeSchedule(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	DisableReplicaAutoFailover = true
+	db := New(p.db, r1.db, r2.db)
+	DisableReplicaAutoFailover = false
+
+	for _, s := range []ProbeSchedule{{Jitter: -0.1}, {Jitter: 1.1}, {Spread: 2}} {
+		if err := db.SetProbeSchedule(s); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("actual err: %v, expected: %s, schedule: %+v", err, ErrInvalidConfig, s)
+		}
+	}
+	cfg := db.RuntimeConfig()
+	cfg.HeartbeatInterval = 40 * time.Millisecond
+	if err := db.Reconfigure(cfg); err != nil {
+		t.Fatalf("error %s when Reconfigure", err)
+	}
+	if err := db.SetProbeSchedule(ProbeSchedule{Jitter: 0.1, Spread: 0.5}); err != nil {
+		t.Fatalf("error %s when SetProbeSchedule", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	start := time.Now()
+	failing := db.probeReplicas(context.Background(), []*sql.DB{r1.db, r2.db})
+	if _, ok := failing[r2.db]; !ok || len(failing) != 1 {
+		t.Errorf("actual failing: %v, expected replica 1", failing)
+	}
+	if elapsed := time.Since(start); elapsed >= 40*time.Millisecond {
+		t.Errorf("actual elapsed: %s, expected within the spread", elapsed)
+	}
+	if err := r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err := r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// the heartbeat is restarted with the schedule
+	p2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r3, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db2 := New(p2.db, r3.db)
+	defer db2.Close()
+	h := db2.heartbeater
+	if err := db2.SetProbeSchedule(ProbeSchedule{Jitter: 0.2}); err != nil {
+		t.Fatalf("error %s when SetProbeSchedule", err)
+	}
+	if db2.heartbeater == h || db2.heartbeater.jitter != 0.2 {
+		t.Errorf("heartbeater should be restarted with jitter")
+	}
+}
+
+func TestProbeReplicasCancelled(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	DisableReplicaAutoFailover = true
+	db := New(p.db, r1.db, r2.db)
+	DisableReplicaAutoFailover = false
+	defer db.Close()
+
+	cfg := db.RuntimeConfig()
+	cfg.HeartbeatInterval = time.Minute
+	if err := db.Reconfigure(cfg); err != nil {
+		t.Fatalf("error %s when Reconfigure", err)
+	}
+	if err := db.SetProbeSchedule(ProbeSchedule{Spread: 1}); err != nil {
+		t.Fatalf("error %s when SetProbeSchedule", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	db.probeReplicas(ctx, []*sql.DB{r1.db, r2.db})
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("actual elapsed: %s, expected pings spread to be skipped once ctx is done", elapsed)
+	}
+}
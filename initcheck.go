@@ -0,0 +1,62 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// InitialHealthCheckResult is the result of the synchronous health check of read replicas when `DB` is created,
+// so that the first requests never hit read replicas already down at startup
+type InitialHealthCheckResult struct {
+	// Done is false if the health check was not run, i.e. health checks are disabled by `DisableReplicaAutoFailover`
+	Done bool
+
+	// Duration is how long the health check took
+	Duration time.Duration
+
+	// Unavailable is the error of each failing read replica by index as passed to `New()`
+	Unavailable map[int]error
+
+	// TimedOut is true if the health check was cut short by `InitialHealthCheckTimeout` or ctx of `NewContext()`,
+	// failing read replicas not answering in time
+	TimedOut bool
+}
+
+// InitialHealthCheck returns the result of the health check of read replicas run by `New()` / `TryNew()` / `NewContext()`
+func (db *DB) InitialHealthCheck() InitialHealthCheckResult {
+	return db.initialHealthCheck
+}
+
+// initialHeartbeat pings all read replicas in parallel bounded by ctx and `InitialHealthCheckTimeout`,
+// returning the failing ones and the result
+func initialHeartbeat(ctx context.Context, readreplicas []*sql.DB) (map[*sql.DB]error, InitialHealthCheckResult) {
+	if InitialHealthCheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, InitialHealthCheckTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	errs := make([]error, len(readreplicas))
+	var wg sync.WaitGroup
+	for i, r := range readreplicas {
+		wg.Add(1)
+		go func(i int, r *sql.DB) {
+			defer wg.Done()
+			errs[i] = r.PingContext(ctx)
+		}(i, r)
+	}
+	wg.Wait()
+
+	failing := map[*sql.DB]error{}
+	result := InitialHealthCheckResult{Done: true, Duration: time.Since(start), Unavailable: map[int]error{}, TimedOut: ctx.Err() != nil}
+	for i, err := range errs {
+		if err != nil {
+			failing[readreplicas[i]] = err
+			result.Unavailable[i] = err
+		}
+	}
+	debug("[initialHeartbeat] duration: %s, unavailable: %d, timed out: %t", result.Duration, len(failing), result.TimedOut)
+	return failing, result
+}
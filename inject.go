@@ -0,0 +1,50 @@
+package gosqlrwdb
+
+// QueryInjector rewrites SQL sent to a target, e.g. adding optimizer hints to work around a plan regression of the target
+// without changing SQL of the application
+type QueryInjector func(query string) string
+
+// SetQueryInjector sets the QueryInjector of the target named name (see `TargetInfo.Name`), replacing the current one.
+// It applies to SQL sent to the target only, after `StatementIDOptions.Comment`. Passing nil removes it.
+func (db *DB) SetQueryInjector(name string, f QueryInjector) {
+	db.configMutex.Lock()
+	defer db.configMutex.Unlock()
+	// copied on write, as statements read the map without lock
+	injectors := make(map[string]QueryInjector, len(db.queryInjectors)+1)
+	for n, injector := range db.queryInjectors {
+		injectors[n] = injector
+	}
+	if f == nil {
+		delete(injectors, name)
+	} else {
+		injectors[name] = f
+	}
+	db.queryInjectors = injectors
+}
+
+// HintComment returns a QueryInjector prepending `/*+ hint */` to SQL, e.g. for pg_hint_plan
+// which reads hints from the comment at the head of the query
+func HintComment(hint string) QueryInjector {
+	return func(query string) string {
+		return "/*+ " + hint + " */ " + query
+	}
+}
+
+// MySQLHint returns a QueryInjector inserting `/*+ hint */` right after the leading keyword
+// of SELECT / INSERT / UPDATE / DELETE / REPLACE statements, where MySQL reads optimizer hints.
+// Other statements are not changed.
+func MySQLHint(hint string) QueryInjector {
+	return func(query string) string {
+		rest := StripLeadingNoise(query)
+		switch firstKeyword(rest) {
+		case "select", "insert", "update", "delete", "replace":
+		default:
+			return query
+		}
+		i := len(query) - len(rest)
+		for i < len(query) && isWordByte(query[i]) {
+			i++
+		}
+		return query[:i] + " /*+ " + hint + " */" + query[i:]
+	}
+}
@@ -0,0 +1,78 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMySQLHint(t *testing.T) {
+	inject := MySQLHint("NO_INDEX_MERGE(t)")
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"select * from t", "select /*+ NO_INDEX_MERGE(t) */ * from t"},
+		{"/* stmt_id=1 */ SELECT * FROM t", "/* stmt_id=1 */ SELECT /*+ NO_INDEX_MERGE(t) */ * FROM t"},
+		{"  update t set a = 1", "  update /*+ NO_INDEX_MERGE(t) */ t set a = 1"},
+		{"show tables", "show tables"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if actual := inject(test.query); actual != test.expected {
+			t.Errorf("MySQLHint(%q): actual %q, expected %q", test.query, actual, test.expected)
+		}
+	}
+}
+
+func TestQueryInjector(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	db.SetQueryInjector("replica-1", HintComment("SeqScan(mytable)"))
+	db.SetQueryInjector("primary", MySQLHint("MAX_EXECUTION_TIME(1000)"))
+
+	query := fmt.Sprintf(selectQueryTmpl, "*")
+	r1.mock.ExpectQuery(regexp.QuoteMeta(query)).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	r2.mock.ExpectQuery(regexp.QuoteMeta("/*+ SeqScan(mytable) */ " + query)).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	p.mock.ExpectQuery(regexp.QuoteMeta("select /*+ MAX_EXECUTION_TIME(1000) */ * from mytable")).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	p.mock.ExpectExec(regexp.QuoteMeta("delete /*+ MAX_EXECUTION_TIME(1000) */ from mytable")).WillReturnResult(sqlmock.NewResult(0, 1))
+	r1.mock.ExpectQuery(regexp.QuoteMeta(query)).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	r2.mock.ExpectQuery(regexp.QuoteMeta(query)).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+
+	for _, ctx := range []context.Context{context.Background(), context.Background(), WithPrimary(context.Background())} {
+		if _, err := db.QueryContext(ctx, query); err != nil {
+			t.Errorf("error %s when QueryContext", err)
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf(deleteQuueryTmpl, "")); err != nil {
+		t.Errorf("error %s when Exec", err)
+	}
+
+	db.SetQueryInjector("replica-1", nil)
+	db.SetQueryInjector("primary", nil)
+	for i := 0; i < 2; i++ {
+		if _, err := db.QueryContext(context.Background(), query); err != nil {
+			t.Errorf("error %s when QueryContext", err)
+		}
+	}
+	for _, mock := range []*mydbMock{p, r1, r2} {
+		if err := mock.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of `InsertBatching`
+const (
+	defaultInsertBatchWindow  = 2 * time.Millisecond
+	defaultInsertBatchMaxRows = 100
+	defaultInsertBatchTimeout = 10 * time.Second
+)
+
+// InsertBatching coalesces single-row inserts of hot insert paths into multi-row inserts on primary DB:
+// inserts by `ExecContext()` of `Digests` arriving within `Window` of the first one are combined into one
+// `INSERT ... VALUES (...), (...)`, trading a few milliseconds of latency for throughput.
+// Only inserts whose row is the last part of the query with `?` placeholders only (e.g. not `ON DUPLICATE KEY UPDATE`
+// or `RETURNING`) and identical SQL are combined; others run as usual.
+//
+// Callers of a batch share its `sql.Result`: `RowsAffected()` is of the whole batch and `LastInsertId()` is as the
+// driver reports for a multi-row insert (e.g. the ID of the first row on MySQL), with `Result.Batch` set, so do not
+// batch inserts whose IDs are needed. If the batch fails by an error other than a broken connection, each insert is
+// run again alone, so that each caller gets the error of its own row. Batches run with a context of their own,
+// so a caller giving up may still have its row inserted, until the latest deadline of their callers,
+// or for `Timeout` if any caller has no deadline. Pending batches run as `Close()` is called.
+//
+// Zero values of `Window`, `MaxRows` and `Timeout` mean defaults.
+type InsertBatching struct {
+	// Digests are `QueryDigest()` (or SQL) of inserts to batch, e.g. `insert into events (a, b) values (?)`
+	Digests []string
+
+	// Window is how long the first insert of a batch waits for others. Default to 2ms.
+	Window time.Duration
+
+	// MaxRows is the maximum number of rows of a batch, run as soon as it is reached. Default to 100.
+	MaxRows int
+
+	// Timeout bounds a batch of which any caller has no deadline. Default to 10s.
+	Timeout time.Duration
+}
+
+// insertBatcher holds pending batches of InsertBatching by SQL
+type insertBatcher struct {
+	batching InsertBatching
+	digests  map[string]struct{}
+
+	mu      sync.Mutex
+	pending map[string]*insertBatch
+	closed  bool
+
+	// running is the number of batches pending or running, waited for on `Close()`
+	running sync.WaitGroup
+}
+
+// insertBatch is a batch of inserts of the same SQL
+type insertBatch struct {
+	query   string
+	prefix  string
+	row     string
+	inserts []*batchedInsert
+	timer   *time.Timer
+}
+
+// batchedInsert is an insert of a caller waiting for its batch
+type batchedInsert struct {
+	ctx   context.Context
+	stmt  StatementInfo
+	query string
+	args  []interface{}
+
+	done chan struct{}
+	res  sql.Result
+	err  error
+}
+
+// SetInsertBatching enables batching of inserts by b, replacing the current one; pending batches still run.
+// Passing nil disables batching, which is the default.
+// It returns an error wrapping `ErrInvalidConfig` if `Digests` is empty.
+func (db *DB) SetInsertBatching(b *InsertBatching) error {
+	var batcher *insertBatcher
+	if b != nil {
+		copied := *b
+		if len(copied.Digests) == 0 {
+			return fmt.Errorf("%w: no digests of inserts to batch", ErrInvalidConfig)
+		}
+		if copied.Window <= 0 {
+			copied.Window = defaultInsertBatchWindow
+		}
+		if copied.MaxRows <= 0 {
+			copied.MaxRows = defaultInsertBatchMaxRows
+		}
+		if copied.Timeout <= 0 {
+			copied.Timeout = defaultInsertBatchTimeout
+		}
+		batcher = &insertBatcher{batching: copied, digests: map[string]struct{}{}, pending: map[string]*insertBatch{}}
+		for _, d := range copied.Digests {
+			batcher.digests[queryDigest(d)] = empty
+		}
+		// run pending batches before primary DB is closed
+		db.OnClose(func() { batcher.close(db) })
+	}
+	db.configMutex.Lock()
+	db.insertBatcher = batcher
+	db.configMutex.Unlock()
+	return nil
+}
+
+// primaryInsertBatcher returns current insertBatcher, nil if not set
+func (db *DB) primaryInsertBatcher() *insertBatcher {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.insertBatcher
+}
+
+// batchable returns true if query with args is an insert of Digests which can be combined with others
+func (b *insertBatcher) batchable(query string, args []interface{}) bool {
+	if _, ok := b.digests[queryDigest(query)]; !ok {
+		return false
+	}
+	for _, arg := range args {
+		if _, named := arg.(sql.NamedArg); named {
+			return false
+		}
+	}
+	_, row, ok := splitInsertRow(query)
+	questions, numbered, names := placeholders(query)
+	return ok && numbered == 0 && len(names) == 0 && len(questions) == len(args) && strings.Count(row, "?") == len(args)
+}
+
+// splitInsertRow returns the part of a single-row `INSERT ... VALUES (...)` before its row, and the row,
+// false if query is not an insert ending with a row of `?` placeholders only
+func splitInsertRow(query string) (string, string, bool) {
+	if firstKeyword(StripLeadingNoise(query)) != "insert" {
+		return "", "", false
+	}
+	q := strings.TrimRight(query, " \t\r\n;")
+	open := strings.LastIndexByte(q, '(')
+	if open < 0 || !strings.HasSuffix(q, ")") {
+		return "", "", false
+	}
+	row := q[open:]
+	for i := 1; i < len(row)-1; i++ {
+		if c := row[i]; c != '?' && c != ',' && !isSpace(c) {
+			return "", "", false
+		}
+	}
+	prefix := strings.TrimRight(q[:open], " \t\r\n")
+	if n := len(prefix) - len("values"); n < 1 || !strings.EqualFold(prefix[n:], "values") || isWordByte(prefix[n-1]) {
+		return "", "", false
+	}
+	return prefix, row, true
+}
+
+// execBatched runs the insert of stmt, whose SQL before rebinding is query, in a batch of b, waiting for the batch or ctx
+func (db *DB) execBatched(ctx context.Context, b *insertBatcher, stmt StatementInfo, query string, args []interface{}) (sql.Result, error) {
+	if err := queryBudgetExceeded(ctx); err != nil {
+		db.debugf(DebugError, "[ExecContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	insert := &batchedInsert{ctx: ctx, stmt: stmt, query: query, args: args, done: make(chan struct{})}
+	b.add(db, insert)
+	select {
+	case <-insert.done:
+		db.metrics.countError(insert.err)
+		return insert.res, insert.err
+	case <-ctx.Done():
+		db.metrics.countError(ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+// add adds insert to the pending batch of its SQL, running the batch when it is full or after the window.
+// Inserts after `close()` run alone.
+func (b *insertBatcher) add(db *DB, insert *batchedInsert) {
+	query := insert.query
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		go db.runInsert(insert)
+		return
+	}
+	batch, ok := b.pending[query]
+	if !ok {
+		prefix, row, _ := splitInsertRow(query)
+		batch = &insertBatch{query: query, prefix: prefix, row: row}
+		b.pending[query] = batch
+		b.running.Add(1)
+		batch.timer = time.AfterFunc(b.batching.Window, func() { b.flush(db, batch) })
+	}
+	batch.inserts = append(batch.inserts, insert)
+	if len(batch.inserts) >= b.batching.MaxRows {
+		batch.timer.Stop()
+		delete(b.pending, query)
+		go b.run(db, batch)
+	}
+}
+
+// flush runs batch after the window, unless it was run as full or by `close()`
+func (b *insertBatcher) flush(db *DB, batch *insertBatch) {
+	b.mu.Lock()
+	if b.pending[batch.query] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, batch.query)
+	b.mu.Unlock()
+	b.run(db, batch)
+}
+
+// close runs pending batches now and waits for running ones, so that none runs on closed primary DB
+func (b *insertBatcher) close(db *DB) {
+	b.mu.Lock()
+	b.closed = true
+	pending := b.pending
+	b.pending = map[string]*insertBatch{}
+	b.mu.Unlock()
+	for _, batch := range pending {
+		// taken out of pending batches, so that the timer does not run it
+		batch.timer.Stop()
+		b.run(db, batch)
+	}
+	b.running.Wait()
+}
+
+// run runs batch, taken out of pending batches exactly once
+func (b *insertBatcher) run(db *DB, batch *insertBatch) {
+	defer b.running.Done()
+	db.runBatch(batch, b.batching.Timeout)
+}
+
+// batchContext returns the context of a batch of inserts, until the latest deadline of their contexts,
+// or for timeout if any has no deadline
+func batchContext(inserts []*batchedInsert, timeout time.Duration) (context.Context, context.CancelFunc) {
+	var latest time.Time
+	for _, insert := range inserts {
+		deadline, ok := insert.ctx.Deadline()
+		if !ok {
+			return context.WithTimeout(context.Background(), timeout)
+		}
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+	return context.WithDeadline(context.Background(), latest)
+}
+
+// runBatch runs inserts of batch as a multi-row insert on primary DB, or alone if the multi-row insert fails,
+// bounded by `batchContext()`
+func (db *DB) runBatch(batch *insertBatch, timeout time.Duration) {
+	inserts := batch.inserts
+	if len(inserts) == 1 {
+		db.runInsert(inserts[0])
+		return
+	}
+	rows := make([]string, len(inserts))
+	var args []interface{}
+	for i, insert := range inserts {
+		rows[i] = batch.row
+		args = append(args, insert.args...)
+	}
+	query := db.rebind(batch.prefix + " " + strings.Join(rows, ", "))
+	ctx, cancel := batchContext(inserts, timeout)
+	defer cancel()
+	ctx, stmt := db.newStatement(ctx, "ExecContext", query, args)
+	db.debugf(DebugRouting, "[ExecContext] stmt_id: %s, batch of %d inserts", stmt.ID, len(inserts))
+	start := time.Now()
+	var res sql.Result
+	tries := 0
+	err := db.runStatement(ctx, stmt, db.master, func(query string) error {
+		var err error
+		tries++
+		res, err = db.master.ExecContext(ctx, query, args...)
+		return err
+	})
+	db.observeWrite(start)
+	if err != nil && ClassifyError(err) != ErrorClassConnection {
+		db.debugf(DebugEvent, "[ExecContext] stmt_id: %s, run %d inserts alone, err: %s", stmt.ID, len(inserts), err)
+		for _, insert := range inserts {
+			db.runInsert(insert)
+		}
+		return
+	}
+	for _, insert := range inserts {
+		insert.res = newResult(res, db.targetInfo(db.master), tries, start)
+		if insert.res != nil {
+			insert.res.(*Result).Batch = len(inserts)
+		}
+		insert.err = err
+		close(insert.done)
+	}
+}
+
+// runInsert runs insert alone on primary DB
+func (db *DB) runInsert(insert *batchedInsert) {
+	start := time.Now()
+	var res sql.Result
+	tries := 0
+	err := db.runStatement(insert.ctx, insert.stmt, db.master, func(query string) error {
+		var err error
+		tries++
+		res, err = db.master.ExecContext(insert.ctx, query, insert.args...)
+		return err
+	})
+	db.observeWrite(start)
+	insert.res, insert.err = newResult(res, db.targetInfo(db.master), tries, start), err
+	close(insert.done)
+}
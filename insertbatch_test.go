@@ -0,0 +1,185 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSplitInsertRow(t *testing.T) {
+	tests := []struct {
+		query  string
+		prefix string
+		row    string
+		ok     bool
+	}{
+		{"insert into events (a, b) values (?, ?)", "insert into events (a, b) values", "(?, ?)", true},
+		{"INSERT INTO events VALUES(?,?);", "INSERT INTO events VALUES", "(?,?)", true},
+		{"insert into events (a, b) values (?, 1)", "", "", false},
+		{"insert into events (a) values (?) on duplicate key update a = values(a)", "", "", false},
+		{"insert into events (a) values (?) returning id", "", "", false},
+		{"insert into events (a) select (?)", "", "", false},
+		{"update events set a = (?)", "", "", false},
+	}
+	for _, test := range tests {
+		prefix, row, ok := splitInsertRow(test.query)
+		if prefix != test.prefix || row != test.row || ok != test.ok {
+			t.Errorf("actual %q, %q, %t, expected %q, %q, %t of %q", prefix, row, ok, test.prefix, test.row, test.ok, test.query)
+		}
+	}
+}
+
+func TestInsertBatching(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+	if err := db.SetInsertBatching(&InsertBatching{}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrInvalidConfig)
+	}
+	if err := db.SetInsertBatching(&InsertBatching{
+		Digests: []string{"insert into events (a, b) values (?, ?)"},
+		Window:  100 * time.Millisecond,
+	}); err != nil {
+		t.Fatalf("error %s when SetInsertBatching", err)
+	}
+	// concurrent inserts arrive in any order
+	p.mock.MatchExpectationsInOrder(false)
+	query := "insert into events (a, b) values (?, ?)"
+	batched := "insert into events (a, b) values (?, ?), (?, ?)"
+	dupErr := errors.New("Duplicate entry '2' for key 'PRIMARY'")
+
+	p.mock.ExpectExec(regexp.QuoteMeta(batched)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(10, 2))
+	results := runInserts(db, query, 1, 2)
+	for i, r := range results {
+		res, ok := r.res.(*Result)
+		if r.err != nil || !ok || res.Batch != 2 {
+			t.Errorf("actual result: %+v, err: %v, expected: batch of 2 of insert %d", r.res, r.err, i)
+		}
+	}
+
+	// inserts of a failed batch run alone
+	p.mock.ExpectExec(regexp.QuoteMeta(batched)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnError(dupErr)
+	p.mock.ExpectExec(regexp.QuoteMeta(query)).WithArgs(3, "3").WillReturnResult(sqlmock.NewResult(12, 1))
+	p.mock.ExpectExec(regexp.QuoteMeta(query)).WithArgs(2, "2").WillReturnError(dupErr)
+	results = runInserts(db, query, 3, 2)
+	if results[0].err != nil || results[1].err != dupErr {
+		t.Errorf("actual errs: %v & %v, expected: none & %s", results[0].err, results[1].err, dupErr)
+	}
+	if res, ok := results[0].res.(*Result); !ok || res.Batch != 0 {
+		t.Errorf("actual result: %+v, expected: not batched", results[0].res)
+	}
+
+	// others run as usual
+	p.mock.ExpectExec(regexp.QuoteMeta("insert into logs (a) values (?)")).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	if _, err := db.ExecContext(context.Background(), "insert into logs (a) values (?)", 1); err != nil {
+		t.Errorf("error %s when ExecContext", err)
+	}
+
+	for _, m := range []*mydbMock{p, r0} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+type insertResult struct {
+	res sql.Result
+	err error
+}
+
+// runInserts runs inserts of query concurrently, one for each of ids
+func runInserts(db *DB, query string, ids ...int) []insertResult {
+	results := make([]insertResult, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i, id int) {
+			defer wg.Done()
+			res, err := db.ExecContext(context.Background(), query, id, string(rune('0'+id)))
+			results[i] = insertResult{res: res, err: err}
+		}(i, id)
+	}
+	wg.Wait()
+	return results
+}
+
+func TestInsertBatchingClose(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	query := "insert into events (a, b) values (?, ?)"
+	if err := db.SetInsertBatching(&InsertBatching{Digests: []string{query}, Window: time.Hour}); err != nil {
+		t.Fatalf("error %s when SetInsertBatching", err)
+	}
+	batcher := db.primaryInsertBatcher()
+	p.mock.ExpectExec(regexp.QuoteMeta("insert into events (a, b) values (?, ?), (?, ?)")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(10, 2))
+
+	// pending batches run on Close() rather than after the window
+	done := make(chan []insertResult)
+	go func() { done <- runInserts(db, query, 1, 2) }()
+	for pending := 0; pending < 2; time.Sleep(time.Millisecond) {
+		batcher.mu.Lock()
+		if batch := batcher.pending[query]; batch != nil {
+			pending = len(batch.inserts)
+		}
+		batcher.mu.Unlock()
+	}
+	db.Close()
+	for i, r := range <-done {
+		if res, ok := r.res.(*Result); r.err != nil || !ok || res.Batch != 2 {
+			t.Errorf("actual result: %+v, err: %v, expected: batch of 2 of insert %d", r.res, r.err, i)
+		}
+	}
+	if err := p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestBatchContext(t *testing.T) {
+	now := time.Now()
+	withDeadline := func(d time.Duration) *batchedInsert {
+		ctx, cancel := context.WithDeadline(context.Background(), now.Add(d))
+		defer cancel()
+		return &batchedInsert{ctx: ctx}
+	}
+	tests := []struct {
+		inserts  []*batchedInsert
+		expected time.Time
+	}{
+		{[]*batchedInsert{withDeadline(time.Second), withDeadline(3 * time.Second)}, now.Add(3 * time.Second)},
+		{[]*batchedInsert{withDeadline(time.Second), {ctx: context.Background()}}, now.Add(time.Minute)},
+	}
+	for _, test := range tests {
+		ctx, cancel := batchContext(test.inserts, time.Minute)
+		actual, _ := ctx.Deadline()
+		cancel()
+		if actual.Before(test.expected) || actual.After(test.expected.Add(time.Second)) {
+			t.Errorf("actual deadline: %s, expected: %s", actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+// Package integrationtest provides helpers to run a real primary DB with streaming read replicas
+// (Postgres or MySQL) in docker containers, and scenarios exercising package gosqlrwdb
+// against them end-to-end.
+//
+// Containers are managed with the docker CLI, which must be available in PATH.
+// SQL drivers are not imported by this package; the test binary must import the driver
+// registered as `ClusterOptions.Driver` (e.g. `_ "github.com/lib/pq"` or `_ "github.com/go-sql-driver/mysql"`).
+//
+// The package is a module of its own, so that the drivers of its tests are not dependencies of package gosqlrwdb.
+// Its own tests are behind the `integration` build tag, run in this directory:
+//
+//	go test -tags integration ./...
+package integrationtest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/lisuizhe/gosqlrwdb"
+	"go.uber.org/multierr"
+)
+
+// Engine is the database engine of a Cluster
+type Engine string
+
+const (
+	// Postgres runs a Postgres primary with physical streaming replicas
+	Postgres Engine = "postgres"
+
+	// MySQL runs a MySQL primary with GTID based replicas
+	MySQL Engine = "mysql"
+)
+
+const (
+	defaultPassword     = "gosqlrwdb"
+	defaultDatabase     = "gosqlrwdb"
+	defaultStartTimeout = 2 * time.Minute
+)
+
+// ClusterOptions configures `StartCluster()`
+type ClusterOptions struct {
+	// Engine is the database engine. Default to Postgres.
+	Engine Engine
+
+	// Replicas is the number of read replicas. Default to 2.
+	Replicas int
+
+	// Image is the docker image. Default to `postgres:16` or `mysql:8.0`.
+	Image string
+
+	// Driver is the name of the registered SQL driver. Default to `postgres` or `mysql`.
+	Driver string
+
+	// StartTimeout bounds how long to wait until all DB accept connections. Default to 2m.
+	StartTimeout time.Duration
+}
+
+func (o ClusterOptions) withDefaults() ClusterOptions {
+	if o.Engine == "" {
+		o.Engine = Postgres
+	}
+	if o.Replicas <= 0 {
+		o.Replicas = 2
+	}
+	if o.Image == "" {
+		o.Image = map[Engine]string{Postgres: "postgres:16", MySQL: "mysql:8.0"}[o.Engine]
+	}
+	if o.Driver == "" {
+		o.Driver = string(o.Engine)
+	}
+	if o.StartTimeout <= 0 {
+		o.StartTimeout = defaultStartTimeout
+	}
+	return o
+}
+
+// Cluster is a running primary DB with streaming read replicas
+type Cluster struct {
+	Options ClusterOptions
+
+	// Primary & Replicas are opened with `Options.Driver`, ready to be passed to `gosqlrwdb.New()`
+	Primary  *sql.DB
+	Replicas []*sql.DB
+
+	PrimaryDSN  string
+	ReplicaDSNs []string
+
+	network           string
+	primaryContainer  string
+	replicaContainers []string
+}
+
+// StartCluster starts a primary DB and read replicas streaming from it.
+// Call `Close()` to remove all containers.
+func StartCluster(ctx context.Context, opts ClusterOptions) (c *Cluster, err error) {
+	opts = opts.withDefaults()
+	if _, err = exec.LookPath("docker"); err != nil {
+		return nil, fmt.Errorf("docker CLI is not available: %w", err)
+	}
+	if !driverRegistered(opts.Driver) {
+		return nil, fmt.Errorf("SQL driver %q is not registered, import it in the test binary", opts.Driver)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.StartTimeout)
+	defer cancel()
+
+	c = &Cluster{
+		Options: opts,
+		network: fmt.Sprintf("gosqlrwdb-%d", time.Now().UnixNano()),
+	}
+	defer func() {
+		if err != nil {
+			err = multierr.Append(err, c.Close())
+			c = nil
+		}
+	}()
+
+	if _, err = docker(ctx, "network", "create", c.network); err != nil {
+		return c, err
+	}
+	switch opts.Engine {
+	case Postgres:
+		err = c.startPostgres(ctx)
+	case MySQL:
+		err = c.startMySQL(ctx)
+	default:
+		err = fmt.Errorf("unsupported engine %q", opts.Engine)
+	}
+	return c, err
+}
+
+// NewDB opens new handles to the primary DB & read replicas of the cluster
+// and returns `gosqlrwdb.DB` using them. Closing it does not affect handles of the cluster.
+func (c *Cluster) NewDB(ctx context.Context) (*gosqlrwdb.DB, error) {
+	primary, err := c.open(ctx, c.PrimaryDSN)
+	if err != nil {
+		return nil, err
+	}
+	replicas := make([]*sql.DB, 0, len(c.ReplicaDSNs))
+	for _, dsn := range c.ReplicaDSNs {
+		r, err := sql.Open(c.Options.Driver, dsn)
+		if err != nil {
+			primary.Close()
+			for _, r := range replicas {
+				r.Close()
+			}
+			return nil, err
+		}
+		replicas = append(replicas, r)
+	}
+	return gosqlrwdb.New(primary, replicas...), nil
+}
+
+// StopReplica stops the container of read replica i, to simulate a replica outage
+func (c *Cluster) StopReplica(ctx context.Context, i int) error {
+	_, err := docker(ctx, "stop", c.replicaContainers[i])
+	return err
+}
+
+// StartReplica starts the container of read replica i stopped by `StopReplica()`,
+// and waits until it accepts connections
+func (c *Cluster) StartReplica(ctx context.Context, i int) error {
+	if _, err := docker(ctx, "start", c.replicaContainers[i]); err != nil {
+		return err
+	}
+	dsn, err := c.dsn(ctx, c.replicaContainers[i])
+	if err != nil {
+		return err
+	}
+	c.ReplicaDSNs[i] = dsn
+	c.Replicas[i].Close()
+	c.Replicas[i], err = c.open(ctx, dsn)
+	return err
+}
+
+// PauseReplica pauses the container of read replica i, so that replication lag grows
+// and connections hang, until `UnpauseReplica()` is called
+func (c *Cluster) PauseReplica(ctx context.Context, i int) error {
+	_, err := docker(ctx, "pause", c.replicaContainers[i])
+	return err
+}
+
+// UnpauseReplica unpauses the container of read replica i paused by `PauseReplica()`
+func (c *Cluster) UnpauseReplica(ctx context.Context, i int) error {
+	_, err := docker(ctx, "unpause", c.replicaContainers[i])
+	return err
+}
+
+// Close closes all DB handles and removes all containers and the network
+func (c *Cluster) Close() error {
+	var errs error
+	if c.Primary != nil {
+		errs = multierr.Append(errs, c.Primary.Close())
+	}
+	for _, r := range c.Replicas {
+		if r != nil {
+			errs = multierr.Append(errs, r.Close())
+		}
+	}
+	ctx := context.Background()
+	containers := append([]string{c.primaryContainer}, c.replicaContainers...)
+	for _, name := range containers {
+		if name == "" {
+			continue
+		}
+		if _, err := docker(ctx, "rm", "-f", "-v", name); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+	if _, err := docker(ctx, "network", "rm", c.network); err != nil {
+		errs = multierr.Append(errs, err)
+	}
+	return errs
+}
+
+func (c *Cluster) startPostgres(ctx context.Context) error {
+	c.primaryContainer = c.network + "-primary"
+	_, err := docker(ctx, "run", "-d", "--name", c.primaryContainer, "--network", c.network,
+		"-p", "127.0.0.1::5432",
+		"-e", "POSTGRES_PASSWORD="+defaultPassword,
+		"-e", "POSTGRES_DB="+defaultDatabase,
+		"-e", "POSTGRES_HOST_AUTH_METHOD=trust",
+		c.Options.Image,
+		"-c", "wal_level=replica", "-c", "max_wal_senders=16", "-c", "hot_standby=on")
+	if err != nil {
+		return err
+	}
+	if c.Primary, c.PrimaryDSN, err = c.openContainer(ctx, c.primaryContainer); err != nil {
+		return err
+	}
+	// allow replication connections from other containers
+	if _, err = docker(ctx, "exec", "-u", "postgres", c.primaryContainer, "bash", "-c",
+		`echo "host replication all all trust" >> "$PGDATA/pg_hba.conf" && psql -c "select pg_reload_conf()"`); err != nil {
+		return err
+	}
+
+	for i := 0; i < c.Options.Replicas; i++ {
+		name := fmt.Sprintf("%s-replica%d", c.network, i)
+		c.replicaContainers = append(c.replicaContainers, name)
+		script := fmt.Sprintf(`until pg_basebackup -h %s -U postgres -D /tmp/data -X stream -R; do rm -rf /tmp/data; sleep 1; done;`+
+			` chmod 700 /tmp/data && exec postgres -D /tmp/data -c hot_standby=on`, c.primaryContainer)
+		if _, err = docker(ctx, "run", "-d", "--name", name, "--network", c.network,
+			"-p", "127.0.0.1::5432", "-u", "postgres", "--entrypoint", "bash",
+			c.Options.Image, "-c", script); err != nil {
+			return err
+		}
+		r, dsn, err := c.openContainer(ctx, name)
+		if err != nil {
+			return err
+		}
+		c.Replicas = append(c.Replicas, r)
+		c.ReplicaDSNs = append(c.ReplicaDSNs, dsn)
+	}
+	return nil
+}
+
+func (c *Cluster) startMySQL(ctx context.Context) error {
+	args := func(name string, serverID int, extra ...string) []string {
+		a := []string{"run", "-d", "--name", name, "--network", c.network,
+			"-p", "127.0.0.1::3306",
+			"-e", "MYSQL_ROOT_PASSWORD=" + defaultPassword,
+			"-e", "MYSQL_DATABASE=" + defaultDatabase,
+			c.Options.Image,
+			fmt.Sprintf("--server-id=%d", serverID), "--log-bin", "--gtid-mode=ON", "--enforce-gtid-consistency=ON"}
+		return append(a, extra...)
+	}
+
+	c.primaryContainer = c.network + "-primary"
+	var err error
+	if _, err = docker(ctx, args(c.primaryContainer, 1)...); err != nil {
+		return err
+	}
+	if c.Primary, c.PrimaryDSN, err = c.openContainer(ctx, c.primaryContainer); err != nil {
+		return err
+	}
+
+	for i := 0; i < c.Options.Replicas; i++ {
+		name := fmt.Sprintf("%s-replica%d", c.network, i)
+		c.replicaContainers = append(c.replicaContainers, name)
+		if _, err = docker(ctx, args(name, i+2, "--read-only")...); err != nil {
+			return err
+		}
+		r, dsn, err := c.openContainer(ctx, name)
+		if err != nil {
+			return err
+		}
+		c.Replicas = append(c.Replicas, r)
+		c.ReplicaDSNs = append(c.ReplicaDSNs, dsn)
+		stmt := fmt.Sprintf("CHANGE REPLICATION SOURCE TO SOURCE_HOST='%s', SOURCE_USER='root', SOURCE_PASSWORD='%s',"+
+			" SOURCE_AUTO_POSITION=1, GET_SOURCE_PUBLIC_KEY=1", c.primaryContainer, defaultPassword)
+		if _, err = r.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+		if _, err = r.ExecContext(ctx, "START REPLICA"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openContainer opens the DB in container name and waits until it accepts connections
+func (c *Cluster) openContainer(ctx context.Context, name string) (*sql.DB, string, error) {
+	dsn, err := c.dsn(ctx, name)
+	if err != nil {
+		return nil, "", err
+	}
+	db, err := c.open(ctx, dsn)
+	return db, dsn, err
+}
+
+// dsn returns DSN of the DB in container name via its published port
+func (c *Cluster) dsn(ctx context.Context, name string) (string, error) {
+	port := map[Engine]string{Postgres: "5432/tcp", MySQL: "3306/tcp"}[c.Options.Engine]
+	out, err := docker(ctx, "port", name, port)
+	if err != nil {
+		return "", err
+	}
+	// output is like "127.0.0.1:49153", possibly with more lines for IPv6
+	hostPort := strings.TrimSpace(strings.SplitN(out, "\n", 2)[0])
+	switch c.Options.Engine {
+	case MySQL:
+		return fmt.Sprintf("root:%s@tcp(%s)/%s", defaultPassword, hostPort, defaultDatabase), nil
+	default:
+		return fmt.Sprintf("postgres://postgres:%s@%s/%s?sslmode=disable", defaultPassword, hostPort, defaultDatabase), nil
+	}
+}
+
+// open opens dsn and waits until it accepts connections or ctx is done
+func (c *Cluster) open(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(c.Options.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if err = db.PingContext(ctx); err == nil {
+			return db, nil
+		}
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, fmt.Errorf("waiting for %s: %w", dsn, multierr.Append(err, ctx.Err()))
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// docker runs docker CLI with args and returns its stdout
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func driverRegistered(name string) bool {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
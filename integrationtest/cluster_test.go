@@ -0,0 +1,39 @@
+//go:build integration
+// +build integration
+
+package integrationtest
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestCluster runs all scenarios against the engine in env `GOSQLRWDB_IT_ENGINE` (default postgres),
+// with SQL drivers imported by drivers_test.go
+func TestCluster(t *testing.T) {
+	opts := ClusterOptions{Engine: Engine(os.Getenv("GOSQLRWDB_IT_ENGINE"))}.withDefaults()
+	c, err := StartCluster(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("error %s when StartCluster", err)
+	}
+	defer c.Close()
+
+	RunScenarios(t, c)
+}
+
+func TestClusterOptionsWithDefaults(t *testing.T) {
+	tests := []struct {
+		opts     ClusterOptions
+		expected ClusterOptions
+	}{
+		{ClusterOptions{}, ClusterOptions{Engine: Postgres, Replicas: 2, Image: "postgres:16", Driver: "postgres", StartTimeout: defaultStartTimeout}},
+		{ClusterOptions{Engine: MySQL, Replicas: 1}, ClusterOptions{Engine: MySQL, Replicas: 1, Image: "mysql:8.0", Driver: "mysql", StartTimeout: defaultStartTimeout}},
+	}
+
+	for _, test := range tests {
+		if actual := test.opts.withDefaults(); actual != test.expected {
+			t.Errorf("actual = %+v, expected = %+v", actual, test.expected)
+		}
+	}
+}
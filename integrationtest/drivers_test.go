@@ -0,0 +1,10 @@
+//go:build integration
+// +build integration
+
+package integrationtest
+
+import (
+	// SQL drivers of `ClusterOptions.Driver` of each Engine
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
@@ -0,0 +1,12 @@
+module github.com/lisuizhe/gosqlrwdb/integrationtest
+
+go 1.14
+
+require (
+	github.com/go-sql-driver/mysql v1.7.1
+	github.com/lib/pq v1.10.9
+	github.com/lisuizhe/gosqlrwdb v0.0.0
+	go.uber.org/multierr v1.6.0
+)
+
+replace github.com/lisuizhe/gosqlrwdb => ../
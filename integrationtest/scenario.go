@@ -0,0 +1,157 @@
+package integrationtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lisuizhe/gosqlrwdb"
+)
+
+const (
+	scenarioTable = "gosqlrwdb_it"
+
+	// replicationTimeout bounds how long a write may take to be visible on read replicas
+	replicationTimeout = 30 * time.Second
+)
+
+// RunScenarios runs all scenarios against c as subtests
+func RunScenarios(t *testing.T, c *Cluster) {
+	t.Run("Routing", func(t *testing.T) { ScenarioRouting(t, c) })
+	t.Run("Lag", func(t *testing.T) { ScenarioLag(t, c) })
+	t.Run("Failover", func(t *testing.T) { ScenarioFailover(t, c) })
+}
+
+// ScenarioRouting verifies writes go to the primary DB and reads are spread over read replicas
+func ScenarioRouting(t *testing.T, c *Cluster) {
+	ctx := context.Background()
+	db := newDB(ctx, t, c)
+	defer db.Close()
+
+	setupTable(ctx, t, db)
+	id := time.Now().UnixNano()
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("insert into %s (id) values (%d)", scenarioTable, id)); err != nil {
+		t.Fatalf("error %s when insert", err)
+	}
+	waitReplicated(ctx, t, c, id)
+
+	for i := 0; i < 2*len(c.Replicas); i++ {
+		var count int
+		if err := db.QueryRowContext(ctx, fmt.Sprintf("select count(*) from %s where id = %d", scenarioTable, id)).Scan(&count); err != nil {
+			t.Fatalf("error %s when select", err)
+		}
+		if count != 1 {
+			t.Errorf("actual count: %d, expected: 1", count)
+		}
+	}
+
+	m := db.Metrics()
+	if m.Writes == 0 {
+		t.Errorf("writes should be routed to primary")
+	}
+	for i, reads := range m.ReadsReplica {
+		if reads == 0 {
+			t.Errorf("replica %d did not receive reads", i)
+		}
+	}
+}
+
+// ScenarioLag verifies a write becomes visible on every read replica and reports the observed lag
+func ScenarioLag(t *testing.T, c *Cluster) {
+	ctx := context.Background()
+	db := newDB(ctx, t, c)
+	defer db.Close()
+	setupTable(ctx, t, db)
+
+	id := time.Now().UnixNano()
+	start := time.Now()
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("insert into %s (id) values (%d)", scenarioTable, id)); err != nil {
+		t.Fatalf("error %s when insert", err)
+	}
+	waitReplicated(ctx, t, c, id)
+	t.Logf("write visible on all %d replicas after %s", len(c.Replicas), time.Since(start))
+}
+
+// ScenarioFailover verifies reads keep succeeding while a read replica is down,
+// and the read replica receives reads again after it is back.
+// It requires at least 2 read replicas.
+func ScenarioFailover(t *testing.T, c *Cluster) {
+	if len(c.Replicas) < 2 {
+		t.Skip("failover scenario requires at least 2 read replicas")
+	}
+	ctx := context.Background()
+
+	interval := gosqlrwdb.DefaultReplicaAutoFailoverInterval
+	gosqlrwdb.DefaultReplicaAutoFailoverInterval = time.Second
+	defer func() {
+		gosqlrwdb.DefaultReplicaAutoFailoverInterval = interval
+	}()
+
+	if err := c.StopReplica(ctx, 0); err != nil {
+		t.Fatalf("error %s when stop replica", err)
+	}
+	db := newDB(ctx, t, c)
+	defer db.Close()
+	for i := 0; i < 2*len(c.Replicas); i++ {
+		rows, err := db.QueryContext(ctx, "select 1")
+		if err != nil {
+			t.Fatalf("error %s when select while replica 0 is down", err)
+		}
+		rows.Close()
+	}
+	if reads := db.Metrics().ReadsReplica[0]; reads != 0 {
+		t.Errorf("actual reads of stopped replica: %d, expected: 0", reads)
+	}
+
+	if err := c.StartReplica(ctx, 0); err != nil {
+		t.Fatalf("error %s when start replica", err)
+	}
+	db.Close()
+	db = newDB(ctx, t, c)
+	defer db.Close()
+	for i := 0; i < 2*len(c.Replicas); i++ {
+		rows, err := db.QueryContext(ctx, "select 1")
+		if err != nil {
+			t.Fatalf("error %s when select after replica 0 is back", err)
+		}
+		rows.Close()
+	}
+	if reads := db.Metrics().ReadsReplica[0]; reads == 0 {
+		t.Errorf("replica 0 did not receive reads after it is back")
+	}
+}
+
+func newDB(ctx context.Context, t *testing.T, c *Cluster) *gosqlrwdb.DB {
+	db, err := c.NewDB(ctx)
+	if err != nil {
+		t.Fatalf("error %s when NewDB", err)
+	}
+	return db
+}
+
+func setupTable(ctx context.Context, t *testing.T, db *gosqlrwdb.DB) {
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("create table if not exists %s (id bigint primary key)", scenarioTable)); err != nil {
+		t.Fatalf("error %s when create table", err)
+	}
+}
+
+// waitReplicated waits until row id is visible on every read replica
+func waitReplicated(ctx context.Context, t *testing.T, c *Cluster, id int64) {
+	ctx, cancel := context.WithTimeout(ctx, replicationTimeout)
+	defer cancel()
+	for i, r := range c.Replicas {
+		for {
+			var count int
+			err := r.QueryRowContext(ctx, fmt.Sprintf("select count(*) from %s where id = %d", scenarioTable, id)).Scan(&count)
+			if err == nil && count == 1 {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("row %d is not replicated to replica %d: %v", id, i, err)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+}
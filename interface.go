@@ -0,0 +1,30 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Interface is the set of methods DB provides as a drop-in replacement of `*sql.DB`.
+// Depend on it instead of `*DB` to substitute test doubles such as package gosqlrwdbtest.
+type Interface interface {
+	Ping() error
+	PingContext(ctx context.Context) error
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	Begin() (*sql.Tx, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	Close() error
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	SetConnMaxLifetime(d time.Duration)
+	SetMaxIdleConns(n int)
+	SetMaxOpenConns(n int)
+}
+
+var _ Interface = (*DB)(nil)
@@ -0,0 +1,82 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultKeepAliveTimeout is the default timeout of each keep-alive ping
+const defaultKeepAliveTimeout = time.Second
+
+// KeepAlivePolicy pings read replicas without reads for `Idle`, so that their pooled connections are kept warm
+// behind NAT or load balancers closing idle connections. Unlike health checks, keep-alive pings never mark
+// read replicas unavailable; failures are only printed as debug output.
+type KeepAlivePolicy struct {
+	// Idle is the duration without reads after which a read replica is pinged, and the interval of pings while idle
+	Idle time.Duration
+
+	// Timeout is the timeout of each ping. Default to 1s.
+	Timeout time.Duration
+}
+
+// SetKeepAlive sets the KeepAlivePolicy of read replicas, replacing the current one.
+// Each idle connection of an idle read replica is pinged, up to the number of idle connections in its pool.
+// Passing nil stops keep-alive pings, which is the default.
+func (db *DB) SetKeepAlive(p *KeepAlivePolicy) {
+	if p != nil && p.Timeout <= 0 {
+		copied := *p
+		copied.Timeout = defaultKeepAliveTimeout
+		p = &copied
+	}
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+	if db.keepAliver != nil {
+		db.keepAliver.Stop()
+		db.keepAliver = nil
+	}
+	if p == nil || p.Idle <= 0 || db.closed {
+		return
+	}
+	db.keepAliver = startHeartbeater(p.Idle, func() {
+		db.keepAlive(p, time.Now())
+	})
+}
+
+// keepAlive pings idle connections of read replicas without reads for `Idle` at now, except unavailable or drained ones
+func (db *DB) keepAlive(p *KeepAlivePolicy, now time.Time) {
+	var idle []*sql.DB
+	db.countMutex.RLock()
+	for _, r := range db.readreplicas {
+		_, unavailable := db.unavailableReplicas[r]
+		_, drained := db.drainedReplicas[r]
+		lastRead := time.Unix(0, atomic.LoadInt64(&db.replicaStates[r].lastRead))
+		if !unavailable && !drained && now.Sub(lastRead) >= p.Idle {
+			idle = append(idle, r)
+		}
+	}
+	db.countMutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, r := range idle {
+		conns := r.Stats().Idle
+		if conns < 1 {
+			conns = 1
+		}
+		db.debugf(DebugRouting, "[keepAlive] replica idx: %d, conns: %d", db.replicaStates[r].index, conns)
+		for i := 0; i < conns; i++ {
+			wg.Add(1)
+			go func(r *sql.DB) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+				defer cancel()
+				if err := r.PingContext(ctx); err != nil {
+					db.debugf(DebugError, "[keepAlive] replica idx: %d, err: %s", db.replicaStates[r].index, err)
+				}
+			}(r)
+		}
+	}
+	wg.Wait()
+}
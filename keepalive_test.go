@@ -0,0 +1,77 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestKeepAlive(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	// only replica 1 is idle as replica 0 has just served a read
+	atomic.StoreInt64(&db.replicaStates[r2.db].lastRead, time.Now().Add(-time.Hour).UnixNano())
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	rows, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+	r2.mock.ExpectPing()
+	db.keepAlive(&KeepAlivePolicy{Idle: time.Minute, Timeout: time.Second}, time.Now())
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// both are idle later; failed pings are not health checks
+	r1.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	r2.mock.ExpectPing()
+	db.keepAlive(&KeepAlivePolicy{Idle: time.Minute, Timeout: time.Second}, time.Now().Add(2*time.Minute))
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if healthy, total := db.healthyReplicas(); healthy != 2 || total != 2 {
+		t.Errorf("actual healthy replicas: %d of %d, expected: 2 of 2", healthy, total)
+	}
+
+	// pings run in background until stopped
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db.SetKeepAlive(&KeepAlivePolicy{Idle: 10 * time.Millisecond})
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if r1.mock.ExpectationsWereMet() == nil && r2.mock.ExpectationsWereMet() == nil {
+			break
+		}
+	}
+	db.SetKeepAlive(nil)
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,169 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OperationLagProbe is the operation of errors of `LagProbe`
+const OperationLagProbe = "lag_probe"
+
+// Defaults of `LagProbe`
+const (
+	defaultLagProbeInterval = time.Second
+	defaultLagProbeID       = "gosqlrwdb"
+)
+
+// lagProbeWrites is the number of recent writes of LagProbe remembered to measure lag
+const lagProbeWrites = 64
+
+// LagProbe measures end-to-end replication lag of read replicas by writing the current time to a heartbeat table
+// on primary DB every `Interval` and reading it back from each read replica, which is more accurate than lag reported
+// by servers on some engines. Lag is measured on the clock of the process alone, as the time since the oldest write
+// the read replica has not applied yet, so it is at most about `Interval` apart from true lag.
+// The table must have a row of `ID` made in advance, e.g.
+//
+//	CREATE TABLE gosqlrwdb_heartbeat (id VARCHAR(64) PRIMARY KEY, ts BIGINT NOT NULL);
+//	INSERT INTO gosqlrwdb_heartbeat VALUES ('gosqlrwdb', 0);
+//
+// Measured lag is used by `RoutingDirective.MaxStaleness`, and reported by `Topology()` and `RoutingMetrics.ReplicaLags`,
+// replacing lag measured by `DialectReadinessCheck`. Errors are recorded with `OperationLagProbe` for `LastErrors()`.
+//
+// Zero values of `ID`, `Interval` and `Timeout` mean defaults.
+type LagProbe struct {
+	// Table is the name of the heartbeat table, with columns `id` and `ts` (Unix nanoseconds)
+	Table string
+
+	// ID is the id of the row updated by the probe. Default to `gosqlrwdb`.
+	// Processes may share the row, as writes of other processes are only seen as newer or older than own ones.
+	ID string
+
+	// Interval is the interval of writes. Default to 1s.
+	Interval time.Duration
+
+	// Timeout is the timeout of the write and of each read. Default to Interval.
+	Timeout time.Duration
+}
+
+// plainTableName matches table names accepted by `LagProbe`, optionally schema-qualified
+var plainTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// lagProbe holds a LagProbe with its recent writes
+type lagProbe struct {
+	probe LagProbe
+
+	mu sync.Mutex
+	// writes are Unix nanoseconds written to the table in order, at most lagProbeWrites
+	writes []int64
+}
+
+// SetLagProbe starts measuring replication lag of read replicas by p in background, replacing the current probe.
+// Passing nil stops it, which is the default; lag measured until then is kept until measured otherwise.
+// It returns an error wrapping `ErrInvalidConfig` if `Table` is not a plain (optionally schema-qualified) name.
+func (db *DB) SetLagProbe(p *LagProbe) error {
+	var lp *lagProbe
+	if p != nil {
+		copied := *p
+		if !plainTableName.MatchString(copied.Table) {
+			return fmt.Errorf("%w: lag probe table %q is not a plain name", ErrInvalidConfig, copied.Table)
+		}
+		if copied.ID == "" {
+			copied.ID = defaultLagProbeID
+		}
+		if copied.Interval <= 0 {
+			copied.Interval = defaultLagProbeInterval
+		}
+		if copied.Timeout <= 0 {
+			copied.Timeout = copied.Interval
+		}
+		lp = &lagProbe{probe: copied}
+	}
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+	if db.lagProber != nil {
+		db.lagProber.Stop()
+		db.lagProber = nil
+	}
+	if db.closed {
+		return nil
+	}
+	db.configMutex.Lock()
+	db.lagProbe = lp
+	db.configMutex.Unlock()
+	if lp != nil {
+		db.lagProber = startHeartbeater(lp.probe.Interval, func() { db.probeLag(lp) })
+	}
+	return nil
+}
+
+// probingLag returns true if lag is measured by LagProbe
+func (db *DB) probingLag() bool {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.lagProbe != nil
+}
+
+// probeLag writes the current time by lp on primary DB, then measures lag of each read replica
+func (db *DB) probeLag(lp *lagProbe) {
+	if !db.primaryAvailable() {
+		return
+	}
+	p := lp.probe
+	primary, replicas := db.Targets()
+	now := time.Now().UnixNano()
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	_, err := db.master.ExecContext(ctx, db.rebind(fmt.Sprintf("UPDATE %s SET ts = ? WHERE id = ?", p.Table)), now, p.ID)
+	cancel()
+	if err != nil {
+		db.debugf(DebugError, "[probeLag] write err: %s", err)
+		db.recordError(primary, OperationLagProbe, "", err)
+		return
+	}
+	lp.wrote(now)
+
+	query := db.rebind(fmt.Sprintf("SELECT ts FROM %s WHERE id = ?", p.Table))
+	for i, r := range db.readreplicas {
+		var ts int64
+		ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+		err := r.QueryRowContext(ctx, query, p.ID).Scan(&ts)
+		cancel()
+		if err != nil {
+			db.debugf(DebugError, "[probeLag] replica idx: %d read err: %s", i, err)
+			db.recordError(replicas[i], OperationLagProbe, "", err)
+			continue
+		}
+		lag := lp.lag(ts, time.Now().UnixNano())
+		atomic.StoreInt64(&db.replicaStates[r].lag, int64(lag))
+		db.debugf(DebugRouting, "[probeLag] replica idx: %d lag: %s", i, lag)
+	}
+}
+
+// wrote remembers ts written to the table
+func (lp *lagProbe) wrote(ts int64) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	if len(lp.writes) == lagProbeWrites {
+		lp.writes = lp.writes[1:]
+	}
+	lp.writes = append(lp.writes, ts)
+}
+
+// lag returns lag at now of a read replica reading ts: the time since the oldest write after ts,
+// or since ts itself if such writes are forgotten
+func (lp *lagProbe) lag(ts, now int64) time.Duration {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	if len(lp.writes) == 0 || ts < lp.writes[0] {
+		return time.Duration(now - ts)
+	}
+	for _, w := range lp.writes {
+		if w > ts {
+			return time.Duration(now - w)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package gosqlrwdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLagProbeLag(t *testing.T) {
+	lp := &lagProbe{}
+	if actual := lp.lag(100, 150); actual != 50 {
+		t.Errorf("actual = %d, expected = 50 without writes", actual)
+	}
+	for ts := int64(1000); ts <= 1000+int64(lagProbeWrites)*10; ts += 10 {
+		lp.wrote(ts)
+	}
+	tests := []struct {
+		ts       int64
+		expected time.Duration
+	}{
+		{1000 + int64(lagProbeWrites)*10, 0},
+		{1100, 2000 - 1110},
+		{1105, 2000 - 1110},
+		{1000, 2000 - 1000},
+	}
+	for _, test := range tests {
+		if actual := lp.lag(test.ts, 2000); actual != test.expected {
+			t.Errorf("actual = %d, expected = %d of ts %d", actual, test.expected, test.ts)
+		}
+	}
+	if len(lp.writes) != lagProbeWrites || lp.writes[0] != 1010 {
+		t.Errorf("actual writes = %d from %d, expected %d from 1010", len(lp.writes), lp.writes[0], lagProbeWrites)
+	}
+}
+
+func TestSetLagProbe(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	for _, table := range []string{"", "heartbeat; DROP TABLE users", "a.b.c"} {
+		if err = db.SetLagProbe(&LagProbe{Table: table}); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("actual err: %v, expected: %s of table %q", err, ErrInvalidConfig, table)
+		}
+	}
+	if err = db.SetLagProbe(&LagProbe{Table: "ops.heartbeat", Interval: time.Hour}); err != nil {
+		t.Fatalf("error %s when SetLagProbe", err)
+	}
+	defer db.SetLagProbe(nil)
+	if !db.probingLag() {
+		t.Errorf("actual not probing, expected probing")
+	}
+
+	p.mock.ExpectExec("UPDATE ops.heartbeat SET ts = (.+) WHERE id = (.+)").WithArgs(sqlmock.AnyArg(), defaultLagProbeID).WillReturnResult(sqlmock.NewResult(0, 1))
+	r1.mock.ExpectQuery("SELECT ts FROM ops.heartbeat WHERE id = (.+)").WithArgs(defaultLagProbeID).WillReturnRows(sqlmock.NewRows([]string{"ts"}).AddRow(time.Now().Add(-time.Minute).UnixNano()))
+	r2.mock.ExpectQuery("SELECT ts FROM ops.heartbeat WHERE id = (.+)").WillReturnError(fmt.Errorf("no such table"))
+	db.probeLag(db.lagProbe)
+
+	lags := db.Metrics().ReplicaLags
+	if lags[0] < time.Minute || lags[0] > 2*time.Minute || lags[1] != -1 {
+		t.Errorf("actual lags = %v, expected about 1m and unknown", lags)
+	}
+	_, replicas := db.Targets()
+	if errs := db.LastErrors(replicas[1], 1); len(errs) != 1 || errs[0].Operation != OperationLagProbe {
+		t.Errorf("actual errors = %+v, expected the error of %s", errs, OperationLagProbe)
+	}
+	for _, m := range []*mydbMock{p, r1, r2} {
+		if err = m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
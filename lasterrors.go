@@ -0,0 +1,115 @@
+package gosqlrwdb
+
+import (
+	"sync"
+	"time"
+)
+
+// lastErrorsCapacity is the number of recent errors kept per target
+const lastErrorsCapacity = 64
+
+// Operations of `TargetError` other than method names of `DB`
+const (
+	// OperationHealthCheck is the operation of errors of health checks
+	OperationHealthCheck = "health_check"
+
+	// OperationReadinessCheck is the operation of errors of `ReadinessCheck`
+	OperationReadinessCheck = "readiness_check"
+)
+
+// TargetError is an error returned by a target, kept for `LastErrors()`
+type TargetError struct {
+	Time time.Time
+
+	// Operation is the method of `DB` (e.g. `QueryContext`), or one of `Operation*`
+	Operation string
+
+	// StatementID is the ID of the statement, empty for health checks
+	StatementID string
+
+	Err error
+}
+
+// errorRing is a bounded ring buffer of recent errors of a target, safe for concurrent use
+type errorRing struct {
+	mu   sync.Mutex
+	errs []TargetError
+	next int
+}
+
+// add records e, overwriting the oldest error when full
+func (r *errorRing) add(e TargetError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errs) < lastErrorsCapacity {
+		r.errs = append(r.errs, e)
+		return
+	}
+	r.errs[r.next] = e
+	r.next = (r.next + 1) % lastErrorsCapacity
+}
+
+// last returns at most n recent errors, newest first
+func (r *errorRing) last(n int) []TargetError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n > len(r.errs) {
+		n = len(r.errs)
+	}
+	if n <= 0 {
+		return nil
+	}
+	errs := make([]TargetError, 0, n)
+	// the newest is right before next once full, otherwise the last one
+	newest := len(r.errs) - 1
+	if len(r.errs) == lastErrorsCapacity {
+		newest = (r.next + lastErrorsCapacity - 1) % lastErrorsCapacity
+	}
+	for i := 0; i < n; i++ {
+		errs = append(errs, r.errs[(newest-i+len(r.errs))%len(r.errs)])
+	}
+	return errs
+}
+
+// lastOf returns the newest error of operation, nil if none is kept
+func (r *errorRing) lastOf(operation string) error {
+	for _, e := range r.last(lastErrorsCapacity) {
+		if e.Operation == operation {
+			return e.Err
+		}
+	}
+	return nil
+}
+
+// errorRing returns the errorRing of target, nil if target does not exist
+func (db *DB) errorRing(target TargetInfo) *errorRing {
+	switch {
+	case target.Role == RolePrimary:
+		return db.primaryErrors
+	case target.Role == RoleReplica && target.Index >= 0 && target.Index < len(db.readreplicas):
+		return db.replicaStates[db.readreplicas[target.Index]].errors
+	default:
+		return nil
+	}
+}
+
+// recordError records err of operation on target for `LastErrors()`, do nothing if err is nil
+func (db *DB) recordError(target TargetInfo, operation, statementID string, err error) {
+	if err == nil {
+		return
+	}
+	if r := db.errorRing(target); r != nil {
+		r.add(TargetError{Time: time.Now(), Operation: operation, StatementID: statementID, Err: err})
+	}
+}
+
+// LastErrors returns at most n recent errors returned by target, newest first,
+// including errors of statements and health checks. At most 64 errors are kept per target.
+// It returns nil if target does not exist.
+func (db *DB) LastErrors(target TargetInfo, n int) []TargetError {
+	r := db.errorRing(target)
+	if r == nil {
+		return nil
+	}
+	return r.last(n)
+}
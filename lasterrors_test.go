@@ -0,0 +1,85 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestErrorRing(t *testing.T) {
+	r := &errorRing{}
+	if actual := r.last(3); actual != nil {
+		t.Errorf("actual = %v, expected = nil", actual)
+	}
+
+	tests := []struct {
+		added    int
+		n        int
+		expected []int
+	}{
+		{1, 3, []int{0}},
+		{3, 2, []int{2, 1}},
+		{lastErrorsCapacity + 2, 3, []int{lastErrorsCapacity + 1, lastErrorsCapacity, lastErrorsCapacity - 1}},
+		{lastErrorsCapacity + 2, lastErrorsCapacity + 10, nil},
+	}
+
+	for _, test := range tests {
+		r := &errorRing{}
+		for i := 0; i < test.added; i++ {
+			r.add(TargetError{Operation: fmt.Sprint(i)})
+		}
+		actual := r.last(test.n)
+		if test.expected == nil {
+			if len(actual) != lastErrorsCapacity || actual[lastErrorsCapacity-1].Operation != "2" {
+				t.Errorf("added %d, n %d: actual = %v, expected all %d kept", test.added, test.n, actual, lastErrorsCapacity)
+			}
+			continue
+		}
+		if len(actual) != len(test.expected) {
+			t.Fatalf("added %d, n %d: actual = %v, expected = %v", test.added, test.n, actual, test.expected)
+		}
+		for i, e := range test.expected {
+			if actual[i].Operation != fmt.Sprint(e) {
+				t.Errorf("added %d, n %d: actual = %v, expected = %v", test.added, test.n, actual, test.expected)
+			}
+		}
+	}
+}
+
+func TestLastErrors(t *testing.T) {
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	p.mock.ExpectPing()
+	r.mock.ExpectPing()
+	db := New(p.db, r.db)
+	defer db.Close()
+
+	errQuery := fmt.Errorf("syntax error")
+	errPing := fmt.Errorf("Not available")
+	r.mock.ExpectQuery("^select 1$").WillReturnError(errQuery)
+	if _, err = db.Query("select 1"); err != errQuery {
+		t.Errorf("actual err: %v, expected: %s", err, errQuery)
+	}
+	p.mock.ExpectPing().WillReturnError(errPing)
+	r.mock.ExpectPing()
+	db.refreshHealth()
+
+	replica := db.LastErrors(TargetInfo{Role: RoleReplica, Index: 0}, 10)
+	if len(replica) != 1 || replica[0].Operation != "Query" || replica[0].StatementID == "" || replica[0].Err != errQuery {
+		t.Errorf("actual replica errors = %+v, expected error of Query", replica)
+	}
+	primary := db.LastErrors(TargetInfo{Role: RolePrimary}, 10)
+	if len(primary) != 1 || primary[0].Operation != OperationHealthCheck || primary[0].Err != errPing {
+		t.Errorf("actual primary errors = %+v, expected error of health check", primary)
+	}
+	if actual := db.LastErrors(TargetInfo{Role: RoleReplica, Index: 1}, 10); actual != nil {
+		t.Errorf("actual errors of unknown target = %+v, expected = nil", actual)
+	}
+}
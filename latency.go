@@ -0,0 +1,277 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencyBucketCount is the number of buckets of latency histograms
+	latencyBucketCount = 128
+
+	// latencyBucketsPerDoubling is the number of buckets per doubling of latency,
+	// so that percentiles are within ~19% of exact latencies
+	latencyBucketsPerDoubling = 4
+
+	// latencyMinBound is the upper bound of the first bucket of latency histograms
+	latencyMinBound = time.Microsecond
+)
+
+// latencyBounds are the upper bounds of buckets of latency histograms, from 1µs to ~1h.
+// The last bucket also counts latencies above its bound.
+var latencyBounds = func() (bounds [latencyBucketCount]time.Duration) {
+	for i := range bounds {
+		bounds[i] = time.Duration(float64(latencyMinBound) * math.Pow(2, float64(i)/latencyBucketsPerDoubling))
+	}
+	return bounds
+}()
+
+// latencyBucket returns the index of the bucket of d
+func latencyBucket(d time.Duration) int {
+	i := sort.Search(latencyBucketCount, func(i int) bool { return d <= latencyBounds[i] })
+	if i == latencyBucketCount {
+		return latencyBucketCount - 1
+	}
+	return i
+}
+
+// LatencyBucket is a bucket of LatencyHistogram
+type LatencyBucket struct {
+	// UpperBound is the inclusive upper bound of latencies counted in the bucket
+	UpperBound time.Duration
+
+	// Count is the number of latencies in the bucket
+	Count uint64
+}
+
+// LatencyHistogram is an exponential histogram of latencies of requests to a target
+type LatencyHistogram struct {
+	// Count is the number of requests
+	Count uint64
+
+	// Sum is the total latency of requests
+	Sum time.Duration
+
+	// Max is the maximum latency of requests
+	Max time.Duration
+
+	// Buckets are the buckets with any requests in ascending order of UpperBound.
+	// Bounds grow by 2^(1/4) from 1µs, and the last one (~1h) also counts latencies above it.
+	Buckets []LatencyBucket
+}
+
+// Mean returns the average latency, 0 if no requests
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Percentile returns the latency at percentile p (0.0 ~ 1.0) as the upper bound of its bucket
+// capped by Max, 0 if no requests
+func (h LatencyHistogram) Percentile(p float64) time.Duration {
+	rank := percentileRank(h.Count, p)
+	var n uint64
+	for _, b := range h.Buckets {
+		if n += b.Count; n >= rank && rank > 0 {
+			return minDuration(b.UpperBound, h.Max)
+		}
+	}
+	return 0
+}
+
+// TargetLatency is the latency histograms of a target of `LatencySnapshot()`
+type TargetLatency struct {
+	// Target is the target of the histograms
+	Target TargetInfo
+
+	// Reads are latencies of reads on the target until rows are returned, excluding reading rows
+	Reads LatencyHistogram
+
+	// Writes are latencies of writes on the target, empty for read replicas
+	Writes LatencyHistogram
+}
+
+// LatencySnapshot returns histograms of latencies of reads and writes of primary DB (if provided) and
+// read replicas in order as passed to `New()`, since `New()` or the last `ResetMetrics()`.
+// Reads routed to read replicas or primary DB (including fallbacks and failovers) and writes by `Exec()`,
+// `ExecContext()`, `QueryContext()` of writes and prepared statements are recorded, without locks.
+// The latency-aware `DeadlineAwareBalancer` gets `ReplicaCandidate.Latency` from the same histograms
+// of the last minute, as does `SLO.MaxLatency`; they are not reset by `ResetMetrics()` but by evictions by the SLO.
+func (db *DB) LatencySnapshot() []TargetLatency {
+	primary, replicas := db.Targets()
+	snapshot := make([]TargetLatency, 0, len(replicas)+1)
+	if db.master != nil {
+		snapshot = append(snapshot, db.metrics.latencyPrimary.snapshot(primary))
+	}
+	for i := range replicas {
+		snapshot = append(snapshot, db.metrics.latencyReplica[i].snapshot(replicas[i]))
+	}
+	return snapshot
+}
+
+// recordLatency records latency d of a read or write on tgtdb
+func (db *DB) recordLatency(tgtdb *sql.DB, write bool, d time.Duration) {
+	latency := &db.metrics.latencyPrimary
+	if state, ok := db.replicaStates[tgtdb]; ok {
+		latency = state.latency
+	} else if tgtdb != db.master {
+		return
+	}
+	if write {
+		latency.writes.record(d)
+		return
+	}
+	latency.reads.record(d, time.Now())
+}
+
+// targetLatency holds latency histograms of a target
+type targetLatency struct {
+	reads  rollingHistogram
+	writes histogram
+}
+
+func (l *targetLatency) snapshot(target TargetInfo) TargetLatency {
+	return TargetLatency{Target: target, Reads: l.reads.total.snapshot(), Writes: l.writes.snapshot()}
+}
+
+func (l *targetLatency) reset() {
+	l.reads.total.reset()
+	l.writes.reset()
+}
+
+// histogram is an exponential histogram of latencies, accessed atomically
+type histogram struct {
+	counts [latencyBucketCount]uint64
+	count  uint64
+	sum    int64
+	max    int64
+}
+
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddUint64(&h.counts[latencyBucket(d)], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&h.max, max, int64(d)) {
+			return
+		}
+	}
+}
+
+func (h *histogram) snapshot() LatencyHistogram {
+	s := LatencyHistogram{
+		Count: atomic.LoadUint64(&h.count),
+		Sum:   time.Duration(atomic.LoadInt64(&h.sum)),
+		Max:   time.Duration(atomic.LoadInt64(&h.max)),
+	}
+	for i := range h.counts {
+		if n := atomic.LoadUint64(&h.counts[i]); n > 0 {
+			s.Buckets = append(s.Buckets, LatencyBucket{UpperBound: latencyBounds[i], Count: n})
+		}
+	}
+	return s
+}
+
+func (h *histogram) reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreUint64(&h.count, 0)
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.max, 0)
+}
+
+// rollingHistogram is a histogram of all latencies, plus ones of the recent latencyWindow
+// in two generations of half the window each, the older one dropped as a new one starts.
+// Latencies recorded while a generation is dropped may be lost, which is fine for recent latency.
+type rollingHistogram struct {
+	total  histogram
+	recent [2]histogram
+
+	// epochs are the epochs of generations in recent, accessed atomically
+	epochs [2]int64
+}
+
+// latencyEpoch returns the epoch of the generation of now
+func latencyEpoch(now time.Time) int64 {
+	return now.UnixNano() / int64(latencyWindow/2)
+}
+
+func (h *rollingHistogram) record(d time.Duration, now time.Time) {
+	h.total.record(d)
+	epoch := latencyEpoch(now)
+	gen := epoch & 1
+	if old := atomic.LoadInt64(&h.epochs[gen]); old != epoch && atomic.CompareAndSwapInt64(&h.epochs[gen], old, epoch) {
+		h.recent[gen].reset()
+	}
+	h.recent[gen].record(d)
+}
+
+// resetRecent drops recent latencies, keeping all latencies of total
+func (h *rollingHistogram) resetRecent() {
+	for gen := range h.recent {
+		atomic.StoreInt64(&h.epochs[gen], 0)
+		h.recent[gen].reset()
+	}
+}
+
+// percentile returns the recent latency at percentile p, 0 if unknown
+func (h *rollingHistogram) percentile(now time.Time, p float64) time.Duration {
+	epoch := latencyEpoch(now)
+	var counts [latencyBucketCount]uint64
+	var count uint64
+	var max time.Duration
+	for gen := range h.recent {
+		if e := atomic.LoadInt64(&h.epochs[gen]); e != epoch && e != epoch-1 {
+			continue
+		}
+		g := &h.recent[gen]
+		for i := range counts {
+			n := atomic.LoadUint64(&g.counts[i])
+			counts[i] += n
+			count += n
+		}
+		if m := time.Duration(atomic.LoadInt64(&g.max)); m > max {
+			max = m
+		}
+	}
+	rank := percentileRank(count, p)
+	var n uint64
+	for i := range counts {
+		if n += counts[i]; n >= rank && rank > 0 {
+			return minDuration(latencyBounds[i], max)
+		}
+	}
+	return 0
+}
+
+// percentileRank returns the rank (1-based) of percentile p of count latencies, 0 if none
+func percentileRank(count uint64, p float64) uint64 {
+	if count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p * float64(count)))
+	if rank < 1 {
+		return 1
+	}
+	if rank > count {
+		return count
+	}
+	return rank
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
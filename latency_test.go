@@ -0,0 +1,145 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	s := h.snapshot()
+	if s.Count != 100 || s.Max != 100*time.Millisecond || s.Mean() != 50500*time.Microsecond {
+		t.Errorf("actual count: %d, max: %s, mean: %s, expected: 100, 100ms, 50.5ms", s.Count, s.Max, s.Mean())
+	}
+
+	tests := []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0, time.Millisecond},
+		{0.5, 50 * time.Millisecond},
+		{0.9, 90 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	}
+	for _, test := range tests {
+		actual := s.Percentile(test.p)
+		// upper bounds of buckets are within 2^(1/4) of latencies
+		if actual < test.expected || float64(actual) > float64(test.expected)*1.19 {
+			t.Errorf("actual p%g: %s, expected: %s ~ +19%%", test.p*100, actual, test.expected)
+		}
+	}
+
+	if actual := (LatencyHistogram{}).Percentile(0.9); actual != 0 {
+		t.Errorf("actual p90 of empty: %s, expected: 0", actual)
+	}
+	if actual := latencyBucket(24 * time.Hour); actual != latencyBucketCount-1 {
+		t.Errorf("actual bucket of 24h: %d, expected: %d", actual, latencyBucketCount-1)
+	}
+	h.reset()
+	if s := h.snapshot(); s.Count != 0 || len(s.Buckets) != 0 {
+		t.Errorf("actual count: %d, buckets: %d, expected: 0 after reset", s.Count, len(s.Buckets))
+	}
+}
+
+func TestRollingHistogram(t *testing.T) {
+	var h rollingHistogram
+	now := time.Now()
+	h.record(time.Second, now.Add(-2*latencyWindow))
+	h.record(10*time.Millisecond, now)
+	// latencies older than the window are dropped from recent ones only
+	if actual := h.percentile(now, 0.9); actual != 10*time.Millisecond {
+		t.Errorf("actual recent p90: %s, expected: 10ms", actual)
+	}
+	if actual := h.total.snapshot().Count; actual != 2 {
+		t.Errorf("actual total count: %d, expected: 2", actual)
+	}
+	if actual := h.percentile(now.Add(2*latencyWindow), 0.9); actual != 0 {
+		t.Errorf("actual p90 after window: %s, expected: 0", actual)
+	}
+}
+
+func TestLatencySnapshot(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+
+	r0.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	p.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "(.+)")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rows, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "1"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+	rows, err = db.QueryContext(WithPrimary(context.Background()), fmt.Sprintf(selectQueryTmpl, "1"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext with primary", err)
+	}
+	rows.Close()
+	if _, err := db.ExecContext(context.Background(), fmt.Sprintf(deleteQuueryTmpl, "1")); err != nil {
+		t.Fatalf("error %s when ExecContext", err)
+	}
+
+	snapshot := db.LatencySnapshot()
+	if len(snapshot) != 3 {
+		t.Fatalf("actual targets: %d, expected: 3", len(snapshot))
+	}
+	tests := []struct {
+		target        string
+		reads, writes uint64
+	}{
+		{"primary", 1, 1},
+		{"replica-0", 1, 0},
+		{"replica-1", 0, 0},
+	}
+	for i, test := range tests {
+		actual := snapshot[i]
+		if actual.Target.Name != test.target || actual.Reads.Count != test.reads || actual.Writes.Count != test.writes {
+			t.Errorf("actual target: %s, reads: %d, writes: %d, expected: %s, %d, %d",
+				actual.Target.Name, actual.Reads.Count, actual.Writes.Count, test.target, test.reads, test.writes)
+		}
+	}
+	if actual := snapshot[1].Reads.Percentile(0.9); actual < 20*time.Millisecond {
+		t.Errorf("actual p90 of replica-0: %s, expected: 20ms or more", actual)
+	}
+	// recent latency is passed to Balancer
+	if latency, _ := db.replicaStates[r0.db].load(r0.db); latency != snapshot[1].Reads.Max {
+		t.Errorf("actual latency of candidate: %s, expected: %s", latency, snapshot[1].Reads.Max)
+	}
+
+	db.ResetMetrics()
+	if actual := db.LatencySnapshot()[1].Reads.Count; actual != 0 {
+		t.Errorf("actual reads after ResetMetrics: %d, expected: 0", actual)
+	}
+	if latency, _ := db.replicaStates[r0.db].load(r0.db); latency == 0 {
+		t.Errorf("actual latency of candidate after ResetMetrics: 0, expected: kept")
+	}
+
+	for _, m := range []*mydbMock{p, r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
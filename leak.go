@@ -0,0 +1,128 @@
+package gosqlrwdb
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LeakedRows describes `*Rows` not closed within `LeakPolicy.Threshold`
+type LeakedRows struct {
+	// Target is the DB the query was routed to, whose connection is held by the rows
+	Target TargetInfo
+
+	Query string
+
+	// OpenFor is how long the rows have been open when detected
+	OpenFor time.Duration
+
+	// Stack is the stack trace of the goroutine which queried, only captured if `LeakPolicy.CaptureStack` is true
+	Stack []byte
+}
+
+// LeakPolicy reports `*Rows` returned by `QueryRows()` / `QueryRowsContext()` (and used by `QueryEach()`)
+// not closed within `Threshold`, which hold connections of the target until closed.
+// Each leaked rows is reported once: counted in `RoutingMetrics.LeakedRows`, printed as debug output at `DebugError` level,
+// and passed to `OnLeak` if set. `*sql.Rows` returned by `Query()` / `QueryContext()` are not tracked.
+type LeakPolicy struct {
+	// Threshold is the duration after which rows not closed are reported, also the interval of checks
+	Threshold time.Duration
+
+	// CaptureStack captures the stack trace of each query, which is costly and meant for debug builds
+	CaptureStack bool
+
+	// OnLeak is called for each leaked rows if set, so it should return quickly
+	OnLeak func(LeakedRows)
+}
+
+// rowsTracker tracks open `*Rows`
+type rowsTracker struct {
+	mutex sync.Mutex
+	open  map[*Rows]*trackedRows
+}
+
+// trackedRows is the state of an open `*Rows`
+type trackedRows struct {
+	query    string
+	stack    []byte
+	reported bool
+}
+
+// SetLeakPolicy sets the LeakPolicy, replacing the current one. Only rows queried after it are tracked.
+// Passing nil stops tracking, which is the default.
+func (db *DB) SetLeakPolicy(p *LeakPolicy) {
+	if p != nil && p.Threshold <= 0 {
+		p = nil
+	}
+	db.configMutex.Lock()
+	db.leakPolicy = p
+	db.configMutex.Unlock()
+
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+	if db.leakChecker != nil {
+		db.leakChecker.Stop()
+		db.leakChecker = nil
+	}
+	if p == nil || db.closed {
+		return
+	}
+	db.leakChecker = startHeartbeater(p.Threshold, func() {
+		db.checkLeaks(p, time.Now())
+	})
+}
+
+// rowsLeakPolicy returns current LeakPolicy, nil if not set
+func (db *DB) rowsLeakPolicy() *LeakPolicy {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.leakPolicy
+}
+
+// trackRows starts tracking rs of query if LeakPolicy is set
+func (db *DB) trackRows(rs *Rows, query string) {
+	p := db.rowsLeakPolicy()
+	if p == nil {
+		return
+	}
+	tracked := &trackedRows{query: query}
+	if p.CaptureStack {
+		buf := make([]byte, 4096)
+		tracked.stack = buf[:runtime.Stack(buf, false)]
+	}
+	db.openRows.mutex.Lock()
+	if db.openRows.open == nil {
+		db.openRows.open = map[*Rows]*trackedRows{}
+	}
+	db.openRows.open[rs] = tracked
+	db.openRows.mutex.Unlock()
+}
+
+// untrackRows stops tracking rs as it is closed
+func (db *DB) untrackRows(rs *Rows) {
+	db.openRows.mutex.Lock()
+	delete(db.openRows.open, rs)
+	db.openRows.mutex.Unlock()
+}
+
+// checkLeaks reports rows open for `Threshold` of p at now, which are not reported yet
+func (db *DB) checkLeaks(p *LeakPolicy, now time.Time) {
+	var leaked []LeakedRows
+	db.openRows.mutex.Lock()
+	for rs, tracked := range db.openRows.open {
+		if openFor := now.Sub(rs.start); !tracked.reported && openFor >= p.Threshold {
+			tracked.reported = true
+			leaked = append(leaked, LeakedRows{Target: rs.target, Query: tracked.query, OpenFor: openFor, Stack: tracked.stack})
+		}
+	}
+	db.openRows.mutex.Unlock()
+
+	for _, l := range leaked {
+		atomic.AddUint64(&db.metrics.leakedRows, 1)
+		db.debugf(DebugError, "[checkLeaks] rows not closed for %s, target: %+v, query: %s, stack: %s", l.OpenFor, l.Target, l.Query, l.Stack)
+		if p.OnLeak != nil {
+			p.OnLeak(l)
+		}
+	}
+}
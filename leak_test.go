@@ -0,0 +1,81 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLeakPolicy(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	var leaked []LeakedRows
+	policy := &LeakPolicy{Threshold: time.Hour, CaptureStack: true, OnLeak: func(l LeakedRows) {
+		leaked = append(leaked, l)
+	}}
+	db.SetLeakPolicy(policy)
+
+	query := fmt.Sprintf(selectQueryTmpl, "*")
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	leakedRows, err := db.QueryRowsContext(context.Background(), query)
+	if err != nil {
+		t.Fatalf("error %s when QueryRowsContext", err)
+	}
+	closedRows, err := db.QueryRowsContext(context.Background(), query)
+	if err != nil {
+		t.Fatalf("error %s when QueryRowsContext", err)
+	}
+	closedRows.Close()
+
+	db.checkLeaks(policy, time.Now())
+	if len(leaked) != 0 {
+		t.Errorf("actual leaked = %+v, expected none within threshold", leaked)
+	}
+	for i := 0; i < 2; i++ {
+		db.checkLeaks(policy, time.Now().Add(2*time.Hour))
+	}
+	if len(leaked) != 1 {
+		t.Fatalf("actual leaked = %+v, expected 1 reported once", leaked)
+	}
+	l := leaked[0]
+	if l.Target.Name != "replica-0" || l.Query != query || l.OpenFor < time.Hour || !strings.Contains(string(l.Stack), "TestLeakPolicy") {
+		t.Errorf("actual leaked = %+v", l)
+	}
+	if actual := db.Metrics().LeakedRows; actual != 1 {
+		t.Errorf("actual leaked rows = %d, expected = 1", actual)
+	}
+
+	leakedRows.Close()
+	db.openRows.mutex.Lock()
+	open := len(db.openRows.open)
+	db.openRows.mutex.Unlock()
+	if open != 0 {
+		t.Errorf("actual open rows = %d, expected = 0 after Close", open)
+	}
+
+	db.SetLeakPolicy(nil)
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	untrackedRows, err := db.QueryRowsContext(context.Background(), query)
+	if err != nil {
+		t.Fatalf("error %s when QueryRowsContext", err)
+	}
+	defer untrackedRows.Close()
+	db.checkLeaks(policy, time.Now().Add(2*time.Hour))
+	if len(leaked) != 1 {
+		t.Errorf("actual leaked = %+v, expected no more without LeakPolicy", leaked)
+	}
+}
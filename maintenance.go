@@ -0,0 +1,150 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaintenancePollInterval is the default interval of polling `MaintenanceStore`
+const DefaultMaintenancePollInterval = 5 * time.Second
+
+// MaintenanceStore is a store of maintenance mode of primary DB shared by all application instances,
+// e.g. a Redis key, an etcd key or a DynamoDB item, so that flipping one flag updates all instances within seconds.
+// Implement `MaintenanceWatcher` as well to be notified of changes instead of waiting for the next poll.
+type MaintenanceStore interface {
+	// PrimaryInMaintenance returns true if primary DB is in maintenance mode
+	PrimaryInMaintenance(ctx context.Context) (bool, error)
+}
+
+// MaintenanceWatcher is a MaintenanceStore which can watch changes, e.g. by etcd watch or Redis keyspace notifications
+type MaintenanceWatcher interface {
+	MaintenanceStore
+
+	// WatchMaintenance calls changed with the state on each change until ctx is done,
+	// returning the error when the watch fails
+	WatchMaintenance(ctx context.Context, changed func(inMaintenance bool)) error
+}
+
+// MaintenanceStoreFunc is a MaintenanceStore of a function, e.g. reading a Redis key
+type MaintenanceStoreFunc func(ctx context.Context) (bool, error)
+
+// PrimaryInMaintenance calls f
+func (f MaintenanceStoreFunc) PrimaryInMaintenance(ctx context.Context) (bool, error) {
+	return f(ctx)
+}
+
+// maintenanceSync polls and watches a MaintenanceStore
+type maintenanceSync struct {
+	poller      *heartbeater
+	cancelWatch context.CancelFunc
+}
+
+// stop stops polling and cancels the watch, without waiting for the watch to return
+func (m *maintenanceSync) stop() {
+	m.poller.Stop()
+	if m.cancelWatch != nil {
+		m.cancelWatch()
+	}
+}
+
+// PrimaryInMaintenance returns true if primary DB is in maintenance mode, set by `EnvVarPrimaryInMaintenanceKey`,
+// `Config.PrimaryInMaintenance`, `SetPrimaryInMaintenance()` or `MaintenanceStore`
+func (db *DB) PrimaryInMaintenance() bool {
+	return atomic.LoadUint32(&db.primaryInMaintence) == 1
+}
+
+// SetPrimaryInMaintenance sets whether primary DB is in maintenance mode,
+// emitting `EventMaintenanceStarted` or `EventMaintenanceEnded` if changed.
+// In maintenance mode, writes fail with `ErrPrimaryInMaintenance` and reads for primary DB go to read replicas.
+func (db *DB) SetPrimaryInMaintenance(enabled bool) {
+	var from, to uint32 = 1, 0
+	if enabled {
+		from, to = 0, 1
+	}
+	if !atomic.CompareAndSwapUint32(&db.primaryInMaintence, from, to) {
+		return
+	}
+	e := Event{Type: EventMaintenanceEnded, Target: db.targetInfo(db.master)}
+	if enabled {
+		e.Type = EventMaintenanceStarted
+	}
+	db.emit(e)
+}
+
+// SetMaintenanceStore syncs maintenance mode of primary DB with s: it is loaded at once, then polled every interval
+// (`DefaultMaintenancePollInterval` if not positive) and watched if s is a `MaintenanceWatcher`,
+// replacing the current store. Errors of polls and watches keep the current mode, printed as debug output;
+// a failed watch is restarted after interval. Passing nil stops syncing, keeping the current mode.
+// It returns the error of loading s, without changing anything.
+func (db *DB) SetMaintenanceStore(s MaintenanceStore, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultMaintenancePollInterval
+	}
+	var m *maintenanceSync
+	if s != nil {
+		if err := db.loadMaintenance(s, interval); err != nil {
+			db.debugf(DebugError, "[SetMaintenanceStore] err: %s", err)
+			return err
+		}
+		m = &maintenanceSync{}
+	}
+
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+	if db.maintenanceSync != nil {
+		db.maintenanceSync.stop()
+		db.maintenanceSync = nil
+	}
+	if m == nil || db.closed {
+		return nil
+	}
+	m.poller = startHeartbeater(interval, func() {
+		if err := db.loadMaintenance(s, interval); err != nil {
+			db.debugf(DebugError, "[SetMaintenanceStore] poll err: %s", err)
+		}
+	})
+	if w, ok := s.(MaintenanceWatcher); ok {
+		var ctx context.Context
+		ctx, m.cancelWatch = context.WithCancel(context.Background())
+		go db.watchMaintenance(ctx, w, interval)
+	}
+	db.maintenanceSync = m
+	return nil
+}
+
+// loadMaintenance sets maintenance mode of primary DB by s, timed out in timeout
+func (db *DB) loadMaintenance(s MaintenanceStore, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	enabled, err := s.PrimaryInMaintenance(ctx)
+	if err != nil {
+		return err
+	}
+	db.SetPrimaryInMaintenance(enabled)
+	return nil
+}
+
+// watchMaintenance watches w until ctx is done, restarting a failed watch after interval
+func (db *DB) watchMaintenance(ctx context.Context, w MaintenanceWatcher, interval time.Duration) {
+	changed := func(enabled bool) {
+		// changes after the store is replaced are ignored
+		if ctx.Err() == nil {
+			db.SetPrimaryInMaintenance(enabled)
+		}
+	}
+	for {
+		err := w.WatchMaintenance(ctx, changed)
+		if ctx.Err() != nil {
+			return
+		}
+		db.debugf(DebugError, "[SetMaintenanceStore] watch err: %v", err)
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// maintenanceWatcherMock is a MaintenanceWatcher notifying states sent to changes
+type maintenanceWatcherMock struct {
+	changes chan bool
+}
+
+func (m maintenanceWatcherMock) PrimaryInMaintenance(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+func (m maintenanceWatcherMock) WatchMaintenance(ctx context.Context, changed func(bool)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case enabled := <-m.changes:
+			changed(enabled)
+		}
+	}
+}
+
+func TestSetPrimaryInMaintenance(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	var events []Event
+	db.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+	db.SetPrimaryInMaintenance(true)
+	db.SetPrimaryInMaintenance(true)
+	if _, err = db.Exec(fmt.Sprintf(deleteQuueryTmpl, "where column1 = 1")); !errors.Is(err, ErrPrimaryInMaintenance) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrPrimaryInMaintenance)
+	}
+	db.SetPrimaryInMaintenance(false)
+
+	expected := []EventType{EventMaintenanceStarted, EventMaintenanceEnded}
+	if len(events) != len(expected) {
+		t.Fatalf("actual events: %+v, expected: %v", events, expected)
+	}
+	for i, e := range events {
+		if e.Type != expected[i] || e.Target.Role != RolePrimary {
+			t.Errorf("actual event: %+v, expected: %s of primary", e, expected[i])
+		}
+	}
+}
+
+func TestSetMaintenanceStore(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	failing := MaintenanceStoreFunc(func(context.Context) (bool, error) {
+		return true, fmt.Errorf("store is down")
+	})
+	if err = db.SetMaintenanceStore(failing, time.Millisecond); err == nil || db.PrimaryInMaintenance() {
+		t.Errorf("actual err: %v, in maintenance: %t, expected the error without change", err, db.PrimaryInMaintenance())
+	}
+
+	// polled
+	var flag int32 = 1
+	store := MaintenanceStoreFunc(func(context.Context) (bool, error) {
+		return atomic.LoadInt32(&flag) == 1, nil
+	})
+	if err = db.SetMaintenanceStore(store, 5*time.Millisecond); err != nil {
+		t.Fatalf("error %s when SetMaintenanceStore", err)
+	}
+	if !db.PrimaryInMaintenance() {
+		t.Errorf("actual not in maintenance, expected loaded at once")
+	}
+	atomic.StoreInt32(&flag, 0)
+	time.Sleep(30 * time.Millisecond)
+	if db.PrimaryInMaintenance() {
+		t.Errorf("actual in maintenance, expected polled")
+	}
+
+	// watched
+	started := make(chan struct{}, 1)
+	db.OnEvent(func(e Event) {
+		if e.Type == EventMaintenanceStarted {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+		}
+	})
+	watcher := maintenanceWatcherMock{changes: make(chan bool)}
+	if err = db.SetMaintenanceStore(watcher, time.Hour); err != nil {
+		t.Fatalf("error %s when SetMaintenanceStore", err)
+	}
+	watcher.changes <- true
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("actual no EventMaintenanceStarted, expected watched")
+	}
+	if !db.PrimaryInMaintenance() {
+		t.Errorf("actual not in maintenance, expected watched")
+	}
+
+	// stopped, keeping the current mode and ignoring changes
+	if err = db.SetMaintenanceStore(nil, 0); err != nil {
+		t.Fatalf("error %s when SetMaintenanceStore", err)
+	}
+	select {
+	case watcher.changes <- false:
+	case <-time.After(20 * time.Millisecond):
+	}
+	if !db.PrimaryInMaintenance() {
+		t.Errorf("actual not in maintenance, expected kept after stopped")
+	}
+}
@@ -0,0 +1,338 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Error types used as keys of `RoutingMetrics.Errors`
+const (
+	ErrorTypePrimaryInMaintenance  = "primary_in_maintenance"
+	ErrorTypePrimaryUnavailable    = "primary_unavailable"
+	ErrorTypeNotProvidedPrimary    = "not_provided_primary"
+	ErrorTypeNotProvidedReplicas   = "not_provided_replicas"
+	ErrorTypeNotQuerySQL           = "not_query_sql"
+	ErrorTypeParamCountMismatch    = "param_count_mismatch"
+	ErrorTypeExplainAnalyzeWrite   = "explain_analyze_write"
+	ErrorTypeQueryTooExpensive     = "query_too_expensive"
+	ErrorTypeProxyIncompatible     = "proxy_incompatible"
+	ErrorTypeCalledInTx            = "called_in_tx"
+	ErrorTypeConflictingDirectives = "conflicting_directives"
+	ErrorTypeUnknownPartition      = "unknown_partition"
+	ErrorTypeWorkloadLimit         = "workload_limit"
+	ErrorTypeQueryBudgetExceeded   = "query_budget_exceeded"
+	ErrorTypeNoReplicaAvailable    = "no_replica_available"
+	ErrorTypeCanceled              = "canceled"
+	ErrorTypeDeadlineExceeded      = "deadline_exceeded"
+	ErrorTypeDriver                = "driver"
+)
+
+// RoutingMetrics is a snapshot of routing counters of a `DB`
+type RoutingMetrics struct {
+	// ReadsPrimary is the number of reads routed to primary DB
+	ReadsPrimary uint64
+
+	// ReadsReplica is the number of reads routed to each read replica, indexed as passed to `New()`
+	ReadsReplica []uint64
+
+	// Writes is the number of writes (including transactions) routed to primary DB
+	Writes uint64
+
+	// Failovers is the number of reads routed to another read replica
+	// because the selected one was unavailable, evicted or failed
+	Failovers uint64
+
+	// Fallbacks is the number of reads routed to a DB of the other role than intended:
+	// reads requested for primary DB but routed to a read replica as primary DB is in maintenance mode,
+	// reads on read replicas falling back to primary DB by `FallbackPolicy`,
+	// or reads spilled to primary DB below `QuorumPolicy`
+	Fallbacks uint64
+
+	// StaleConnRetries is the number of statements retried on the same target by a stale connection error,
+	// see `SetStaleConnRetry()`
+	StaleConnRetries uint64
+
+	// LeakedRows is the number of `*Rows` not closed within `LeakPolicy.Threshold`
+	LeakedRows uint64
+
+	// Spillovers is the number of reads spilled to primary DB by `SpilloverPolicy` as read replicas are saturated,
+	// also counted in `ReadsPrimary`
+	Spillovers uint64
+
+	// StaleReadsAvoided is the number of reads without rows on read replicas retried on primary DB
+	// after writes of the same context, see `SetStaleReadRetry()`
+	StaleReadsAvoided uint64
+
+	// FreshnessMismatches is the number of reads on read replicas differing from primary DB,
+	// see `WithFreshnessAssert()`
+	FreshnessMismatches uint64
+
+	// QueryBudgetsExceeded is the number of statements beyond the budget of `WithQueryBudget()`,
+	// including ones run in audit-only mode of `SetQueryBudgetAuditOnly()`
+	QueryBudgetsExceeded uint64
+
+	// Errors is the number of errors by type, see `ErrorType*` for keys
+	Errors map[string]uint64
+
+	// Overrides is the number of uses of routing overrides by kind, see `Override*` for keys
+	Overrides map[string]uint64
+
+	// RowsPrimary & RowsReplica are statistics of `*Rows` of primary DB and each read replica,
+	// indexed as passed to `New()`
+	RowsPrimary RowsMetrics
+	RowsReplica []RowsMetrics
+
+	// ReplicaLags is the replication lag of each read replica measured by `LagProbe` or `DialectReadinessCheck`,
+	// indexed as passed to `New()`, negative if unknown. It is a gauge, not reset by `ResetMetrics()`.
+	ReplicaLags []time.Duration
+
+	// Primary & Replicas describe primary DB and each read replica, indexed as passed to `New()`,
+	// e.g. to label exported metrics by `TargetInfo.Name` and `TargetInfo.Zone`
+	Primary  TargetInfo
+	Replicas []TargetInfo
+}
+
+// RowsMetrics is statistics of `*Rows` returned by `QueryRows()` and `QueryRowsContext()` of a target
+type RowsMetrics struct {
+	// Count is the number of closed `*Rows`
+	Count uint64
+
+	// Rows is the number of rows read
+	Rows uint64
+
+	// TimeToClose is the total time from start of queries to close of `*Rows`
+	TimeToClose time.Duration
+}
+
+// metrics holds routing counters, safe for concurrent use
+type metrics struct {
+	readsPrimary         uint64
+	readsReplica         []uint64
+	writes               uint64
+	failovers            uint64
+	fallbacks            uint64
+	staleConnRetries     uint64
+	leakedRows           uint64
+	spillovers           uint64
+	staleReadsAvoided    uint64
+	freshnessMismatches  uint64
+	queryBudgetsExceeded uint64
+	errorsMutex          sync.Mutex
+	errors               map[string]uint64
+	overridesMutex       sync.Mutex
+	overrides            map[string]uint64
+	rowsPrimary          rowsCounter
+	rowsReplica          []rowsCounter
+	latencyPrimary       targetLatency
+	latencyReplica       []targetLatency
+}
+
+// rowsCounter holds counters of RowsMetrics, accessed atomically
+type rowsCounter struct {
+	count       uint64
+	rows        uint64
+	timeToClose int64
+}
+
+func (c *rowsCounter) add(rows uint64, timeToClose time.Duration) {
+	atomic.AddUint64(&c.count, 1)
+	atomic.AddUint64(&c.rows, rows)
+	atomic.AddInt64(&c.timeToClose, int64(timeToClose))
+}
+
+func (c *rowsCounter) snapshot() RowsMetrics {
+	return RowsMetrics{
+		Count:       atomic.LoadUint64(&c.count),
+		Rows:        atomic.LoadUint64(&c.rows),
+		TimeToClose: time.Duration(atomic.LoadInt64(&c.timeToClose)),
+	}
+}
+
+func (c *rowsCounter) reset() {
+	atomic.StoreUint64(&c.count, 0)
+	atomic.StoreUint64(&c.rows, 0)
+	atomic.StoreInt64(&c.timeToClose, 0)
+}
+
+func newMetrics(numReplicas int) *metrics {
+	return &metrics{
+		readsReplica:   make([]uint64, numReplicas),
+		errors:         map[string]uint64{},
+		overrides:      map[string]uint64{},
+		rowsReplica:    make([]rowsCounter, numReplicas),
+		latencyReplica: make([]targetLatency, numReplicas),
+	}
+}
+
+// errorType returns the key of err in `RoutingMetrics.Errors`
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, ErrPrimaryInMaintenance):
+		return ErrorTypePrimaryInMaintenance
+	case errors.Is(err, ErrPrimaryUnavailable):
+		return ErrorTypePrimaryUnavailable
+	case errors.Is(err, ErrNotProvidedPrimary):
+		return ErrorTypeNotProvidedPrimary
+	case errors.Is(err, ErrNotProvidedReplicas):
+		return ErrorTypeNotProvidedReplicas
+	case errors.Is(err, ErrNotQuerySQL):
+		return ErrorTypeNotQuerySQL
+	case errors.Is(err, ErrParamCountMismatch):
+		return ErrorTypeParamCountMismatch
+	case errors.Is(err, ErrExplainAnalyzeWrite):
+		return ErrorTypeExplainAnalyzeWrite
+	case errors.Is(err, ErrQueryTooExpensive):
+		return ErrorTypeQueryTooExpensive
+	case errors.Is(err, ErrProxyIncompatible):
+		return ErrorTypeProxyIncompatible
+	case errors.Is(err, ErrCalledInTx):
+		return ErrorTypeCalledInTx
+	case errors.Is(err, ErrConflictingDirectives):
+		return ErrorTypeConflictingDirectives
+	case errors.Is(err, ErrUnknownPartition):
+		return ErrorTypeUnknownPartition
+	case errors.Is(err, ErrWorkloadLimit):
+		return ErrorTypeWorkloadLimit
+	case errors.Is(err, ErrQueryBudgetExceeded):
+		return ErrorTypeQueryBudgetExceeded
+	case errors.Is(err, ErrNoReplicaAvailable):
+		return ErrorTypeNoReplicaAvailable
+	case errors.Is(err, context.Canceled):
+		return ErrorTypeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTypeDeadlineExceeded
+	default:
+		return ErrorTypeDriver
+	}
+}
+
+// countError increments error counter of err's type, do nothing if err is nil
+func (m *metrics) countError(err error) {
+	if err == nil {
+		return
+	}
+	m.errorsMutex.Lock()
+	m.errors[errorType(err)]++
+	m.errorsMutex.Unlock()
+}
+
+// countOverride increments the counter of routing overrides of kind
+func (m *metrics) countOverride(kind string) {
+	m.overridesMutex.Lock()
+	m.overrides[kind]++
+	m.overridesMutex.Unlock()
+}
+
+// Metrics returns a snapshot of routing counters since `New()` or last `ResetMetrics()`
+func (db *DB) Metrics() RoutingMetrics {
+	m := db.metrics
+	snapshot := RoutingMetrics{
+		ReadsPrimary:         atomic.LoadUint64(&m.readsPrimary),
+		ReadsReplica:         make([]uint64, len(m.readsReplica)),
+		Writes:               atomic.LoadUint64(&m.writes),
+		Failovers:            atomic.LoadUint64(&m.failovers),
+		Fallbacks:            atomic.LoadUint64(&m.fallbacks),
+		StaleConnRetries:     atomic.LoadUint64(&m.staleConnRetries),
+		LeakedRows:           atomic.LoadUint64(&m.leakedRows),
+		Spillovers:           atomic.LoadUint64(&m.spillovers),
+		StaleReadsAvoided:    atomic.LoadUint64(&m.staleReadsAvoided),
+		FreshnessMismatches:  atomic.LoadUint64(&m.freshnessMismatches),
+		QueryBudgetsExceeded: atomic.LoadUint64(&m.queryBudgetsExceeded),
+		Errors:               map[string]uint64{},
+		Overrides:            map[string]uint64{},
+	}
+	for i := range m.readsReplica {
+		snapshot.ReadsReplica[i] = atomic.LoadUint64(&m.readsReplica[i])
+	}
+	snapshot.RowsPrimary = m.rowsPrimary.snapshot()
+	snapshot.RowsReplica = make([]RowsMetrics, len(m.rowsReplica))
+	for i := range m.rowsReplica {
+		snapshot.RowsReplica[i] = m.rowsReplica[i].snapshot()
+	}
+	m.errorsMutex.Lock()
+	for k, v := range m.errors {
+		snapshot.Errors[k] = v
+	}
+	m.errorsMutex.Unlock()
+	m.overridesMutex.Lock()
+	for k, v := range m.overrides {
+		snapshot.Overrides[k] = v
+	}
+	m.overridesMutex.Unlock()
+	snapshot.ReplicaLags = make([]time.Duration, len(db.readreplicas))
+	for i, r := range db.readreplicas {
+		snapshot.ReplicaLags[i] = time.Duration(atomic.LoadInt64(&db.replicaStates[r].lag))
+	}
+	snapshot.Primary, snapshot.Replicas = db.Targets()
+	return snapshot
+}
+
+// ResetMetrics resets all routing counters to zero
+func (db *DB) ResetMetrics() {
+	m := db.metrics
+	atomic.StoreUint64(&m.readsPrimary, 0)
+	for i := range m.readsReplica {
+		atomic.StoreUint64(&m.readsReplica[i], 0)
+	}
+	atomic.StoreUint64(&m.writes, 0)
+	atomic.StoreUint64(&m.failovers, 0)
+	atomic.StoreUint64(&m.fallbacks, 0)
+	atomic.StoreUint64(&m.staleConnRetries, 0)
+	atomic.StoreUint64(&m.leakedRows, 0)
+	atomic.StoreUint64(&m.spillovers, 0)
+	atomic.StoreUint64(&m.staleReadsAvoided, 0)
+	atomic.StoreUint64(&m.freshnessMismatches, 0)
+	atomic.StoreUint64(&m.queryBudgetsExceeded, 0)
+	m.rowsPrimary.reset()
+	for i := range m.rowsReplica {
+		m.rowsReplica[i].reset()
+	}
+	m.latencyPrimary.reset()
+	for i := range m.latencyReplica {
+		m.latencyReplica[i].reset()
+	}
+	m.errorsMutex.Lock()
+	m.errors = map[string]uint64{}
+	m.errorsMutex.Unlock()
+	m.overridesMutex.Lock()
+	m.overrides = map[string]uint64{}
+	m.overridesMutex.Unlock()
+}
+
+// countRows records statistics of a `*Rows` of target
+func (m *metrics) countRows(target TargetInfo, rows uint64, timeToClose time.Duration) {
+	if target.Role == RoleReplica {
+		m.rowsReplica[target.Index].add(rows, timeToClose)
+		return
+	}
+	m.rowsPrimary.add(rows, timeToClose)
+}
+
+// countRead increments read counter of tgtdb
+func (db *DB) countRead(tgtdb *sql.DB) {
+	if state, ok := db.replicaStates[tgtdb]; ok {
+		atomic.AddUint64(&db.metrics.readsReplica[state.index], 1)
+		atomic.StoreInt64(&state.lastRead, time.Now().UnixNano())
+		return
+	}
+	atomic.AddUint64(&db.metrics.readsPrimary, 1)
+}
+
+// countWrite increments write counter
+func (db *DB) countWrite() {
+	atomic.AddUint64(&db.metrics.writes, 1)
+}
+
+// countFailover increments failover counter
+func (db *DB) countFailover() {
+	atomic.AddUint64(&db.metrics.failovers, 1)
+}
+
+// countFallback increments fallback counter
+func (db *DB) countFallback() {
+	atomic.AddUint64(&db.metrics.fallbacks, 1)
+}
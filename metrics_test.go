@@ -0,0 +1,136 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{ErrPrimaryInMaintenance, ErrorTypePrimaryInMaintenance},
+		{&PrimaryUnavailableError{Err: fmt.Errorf("dial error")}, ErrorTypePrimaryUnavailable},
+		{ErrNotProvidedPrimary, ErrorTypeNotProvidedPrimary},
+		{ErrNotProvidedReplicas, ErrorTypeNotProvidedReplicas},
+		{ErrNotQuerySQL, ErrorTypeNotQuerySQL},
+		{&ParamCountError{Expected: 2, Actual: 1}, ErrorTypeParamCountMismatch},
+		{&QueryBudgetError{Budget: 1, Statements: 2}, ErrorTypeQueryBudgetExceeded},
+		{ErrNoReplicaAvailable, ErrorTypeNoReplicaAvailable},
+		{context.Canceled, ErrorTypeCanceled},
+		{context.DeadlineExceeded, ErrorTypeDeadlineExceeded},
+		{fmt.Errorf("driver error"), ErrorTypeDriver},
+	}
+
+	for _, test := range tests {
+		actual := errorType(test.err)
+		if actual != test.expected {
+			t.Errorf("actual = %s, expected = %s, err = %s", actual, test.expected, test.err)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	mrows := sqlmock.NewRows([]string{"column1", "column2"}).AddRow(1, "1")
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(mrows)
+	r2.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(fmt.Errorf("replica error"))
+	p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(mrows)
+	p.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "(.+)")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	db.Query(fmt.Sprintf(selectQueryTmpl, "*"))
+	db.Query(fmt.Sprintf(selectQueryTmpl, "*"))
+	db.QueryContext(WithPrimary(context.Background()), fmt.Sprintf(selectQueryTmpl, "*"))
+	db.Query(fmt.Sprintf(deleteQuueryTmpl, "where column1 = 1"))
+	db.Exec(fmt.Sprintf(deleteQuueryTmpl, "where column1 = 1"))
+
+	expected := RoutingMetrics{
+		ReadsPrimary: 1,
+		ReadsReplica: []uint64{1, 1},
+		Writes:       1,
+		Errors: map[string]uint64{
+			ErrorTypeDriver:      1,
+			ErrorTypeNotQuerySQL: 1,
+		},
+		Overrides:   map[string]uint64{OverrideForcePrimary: 1},
+		RowsReplica: make([]RowsMetrics, 2),
+		ReplicaLags: []time.Duration{-1, -1},
+		Primary:     TargetInfo{Role: RolePrimary, Name: "primary", Weight: 1},
+		Replicas: []TargetInfo{
+			{Role: RoleReplica, Index: 0, Name: "replica-0", Weight: 1},
+			{Role: RoleReplica, Index: 1, Name: "replica-1", Weight: 1},
+		},
+	}
+	if actual := db.Metrics(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual = %+v, expected = %+v", actual, expected)
+	}
+
+	db.ResetMetrics()
+	expected = RoutingMetrics{
+		ReadsReplica: []uint64{0, 0},
+		Errors:       map[string]uint64{},
+		Overrides:    map[string]uint64{},
+		RowsReplica:  make([]RowsMetrics, 2),
+		ReplicaLags:  []time.Duration{-1, -1},
+		Primary:      TargetInfo{Role: RolePrimary, Name: "primary", Weight: 1},
+		Replicas: []TargetInfo{
+			{Role: RoleReplica, Index: 0, Name: "replica-0", Weight: 1},
+			{Role: RoleReplica, Index: 1, Name: "replica-1", Weight: 1},
+		},
+	}
+	if actual := db.Metrics(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual = %+v, expected = %+v", actual, expected)
+	}
+}
+
+func TestMetricsFallback(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	db.SetPrimaryInMaintenance(true)
+
+	mrows := sqlmock.NewRows([]string{"column1", "column2"}).AddRow(1, "1")
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(mrows)
+	db.QueryContext(WithPrimary(context.Background()), fmt.Sprintf(selectQueryTmpl, "*"))
+	db.Exec(fmt.Sprintf(deleteQuueryTmpl, "where column1 = 1"))
+
+	actual := db.Metrics()
+	if actual.Fallbacks != 1 {
+		t.Errorf("actual fallbacks: %d, expected: 1", actual.Fallbacks)
+	}
+	if actual.ReadsReplica[0] != 1 {
+		t.Errorf("actual reads of replica: %d, expected: 1", actual.ReadsReplica[0])
+	}
+	if actual.Errors[ErrorTypePrimaryInMaintenance] != 1 {
+		t.Errorf("actual primary in maintenance errors: %d, expected: 1", actual.Errors[ErrorTypePrimaryInMaintenance])
+	}
+}
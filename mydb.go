@@ -9,13 +9,15 @@ package gosqlrwdb
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/multierr"
+	"golang.org/x/sync/singleflight"
 )
 
 type contextKey int
@@ -24,6 +26,7 @@ const (
 	// EnvVarPrimaryInMaintenanceKey is to determine whether primary DB in in maintenance mode
 	// when `DB` is initialized. Deploy the application using package gosqlrwdb with this
 	// environment variable to `True`/`true` means master is in mainenance mode; otherwise not.
+	// Use `SetPrimaryInMaintenance()` or `SetMaintenanceStore()` to change it after `DB` is initialized.
 	EnvVarPrimaryInMaintenanceKey = "MYDB_PRIMARY_IN_MAINTENANCE"
 
 	// EnvVarDebugKey is to determine whether debug information is print.
@@ -41,13 +44,28 @@ const (
 	// Deploy the application using package gosqlrwdb with this
 	// environment variable to `True`/`true` means auto failover for read replica; otherwise not.
 	EnvVarDisableReplicaAutoFailoverKey = "MYDB_DISABLE_REPLICA_AUTO_FAILOVER"
+
+	// EnvVarDoValidateParamCountKey is to determine whether do validation of number of placeholders
+	// against number of args when `Query()` is called.
+	// Deploy the application using package gosqlrwdb with this
+	// environment variable to `True`/`true` means do validation; otherwise not.
+	EnvVarDoValidateParamCountKey = "MYDB_DO_VALIDATE_PARAM_COUNT"
+
+	// EnvVarDeduplicateHandlesKey is to determine whether duplicate handles passed to `New()` are collapsed.
+	// Deploy the application using package gosqlrwdb with this
+	// environment variable to `True`/`true` means collapse duplicates; otherwise not.
+	EnvVarDeduplicateHandlesKey = "MYDB_DEDUPLICATE_HANDLES"
 )
 
 var (
 	// Debug is to determine whether print debug information.
 	// It is initialized from environment variable with key `EnvVarDebugKey`.
-	// Also can update it programatically using `mydb.Debug = true`
-	Debug = strings.ToLower(os.Getenv(EnvVarDebugKey)) == "true"
+	// Also can update it programatically using `mydb.Debug = true` before creating DBs:
+	// each DB reads it once when created, and updating it later has no effect on existing DBs.
+	//
+	// Deprecated: Debug is not safe to update while DBs are in use and prints everything.
+	// Use `db.SetDebug()` for leveled, sampled debug output per DB.
+	Debug = isTrue(os.Getenv(EnvVarDebugKey))
 
 	// DefaultReplicaAutoFailoverInterval is used when New() to determine interval of heartbeat
 	// to read replicas. Default to 30s.
@@ -56,20 +74,39 @@ var (
 	// DisableReplicaAutoFailover is to determine whether auto failover happen for read replica automatically
 	// It is initialized from environment variable with key `EnvVarDisableReplicaAutoFailoverKey`.
 	// Also can update it programatically using `mydb.DisableReplicaAutoFailover = true`
-	DisableReplicaAutoFailover = strings.ToLower(os.Getenv(EnvVarDisableReplicaAutoFailoverKey)) == "true"
+	DisableReplicaAutoFailover = isTrue(os.Getenv(EnvVarDisableReplicaAutoFailoverKey))
+
+	// InitialHealthCheckTimeout bounds the synchronous health check of read replicas in `New()` / `TryNew()` / `NewContext()`,
+	// failing read replicas not answering in time until the next heartbeat. No bound if zero(default).
+	// See `db.InitialHealthCheck()` for the result.
+	InitialHealthCheckTimeout time.Duration
 
 	// DoValidateNew is to determine whether do validation when `New()` is called.
 	// It is initialized from environment variable with key `EnvVarDoValidateNewKey`.
 	// Also can update it programatically using `mydb.DoValidateNew = true`
-	DoValidateNew = strings.ToLower(os.Getenv(EnvVarDoValidateNewKey)) == "true"
+	DoValidateNew = isTrue(os.Getenv(EnvVarDoValidateNewKey))
+
+	// DoValidateParamCount is to determine whether verify number of placeholders (`?` or `$n`)
+	// in query matches number of args, and names of named placeholders (`:name` or `@name`)
+	// match names of `sql.NamedArg` args when `Query()` is called, returning `*ParamCountError` if not.
+	// It is initialized from environment variable with key `EnvVarDoValidateParamCountKey`.
+	// Also can update it programatically using `mydb.DoValidateParamCount = true`
+	DoValidateParamCount = isTrue(os.Getenv(EnvVarDoValidateParamCountKey))
+
+	// DeduplicateHandles is to determine whether `New()`, `TryNew()` and `NewContext()` collapse duplicate handles
+	// (see `DuplicateHandleError`) instead of failing validation, emitting `EventDuplicateHandle` for each.
+	// It is initialized from environment variable with key `EnvVarDeduplicateHandlesKey`.
+	// Also can update it programatically using `mydb.DeduplicateHandles = true`
+	DeduplicateHandles = isTrue(os.Getenv(EnvVarDeduplicateHandlesKey))
 
 	// IsQuerySqlFunc is used to determine whether `query` in is a Query SQL
 	// Overwrite IsQuerySqlFunc only when necessary
+	//
+	// By default, leading whitespace, comments and parentheses are skipped, and
+	// a SELECT or WITH statement without data-modifying, `INTO` or locking clause is a Query SQL.
+	// `EXPLAIN` statements are Query SQL or not by `ExplainPolicy`.
 	IsQuerySqlFunc = func(query string) bool {
-		if len(query) >= 6 && strings.ToLower(query[:6]) == "select" {
-			return true
-		}
-		return false
+		return isReadQuery(query)
 	}
 )
 
@@ -88,9 +125,88 @@ type DB struct {
 	count               int
 	countMutex          sync.RWMutex
 	needHeartbeat       bool
+	single              bool
 	unavailableReplicas map[*sql.DB]struct{}
-	stopHeartbeat       chan struct{}
-	primaryInMaintence  bool
+	suspectReplicas     map[*sql.DB]time.Time
+	notReadyReplicas    map[*sql.DB]struct{}
+	rampingSince        map[*sql.DB]time.Time
+	drainedReplicas     map[*sql.DB]struct{}
+	dedicatedConns      map[*sql.DB]int
+	unavailableStore    *unavailablePersister
+	heartbeater         *heartbeater
+	keepAliver          *heartbeater
+	maintenanceSync     *maintenanceSync
+	statsReporter       *heartbeater
+	credentialRotation  *heartbeater
+	lagProber           *heartbeater
+	leakChecker         *heartbeater
+	poolTuner           *heartbeater
+	leakPolicy          *LeakPolicy
+	openRows            rowsTracker
+	pauseHealthChecks   uint32
+	primaryInMaintence  uint32
+	replicaStates       map[*sql.DB]*replicaState
+	slo                 *SLO
+	manualEvictionUntil time.Time
+	balancer            Balancer
+	roundRobin          RoundRobinBalancer
+	fallbackPolicy      *FallbackPolicy
+	primaryPolicy       *PrimaryPolicy
+	quorumPolicy        *QuorumPolicy
+	belowQuorum         bool
+	primaryDown         *PrimaryUnavailableError
+	primaryRecovered    chan struct{}
+	drillDown           *PrimaryUnavailableError
+	drillRecovered      chan struct{}
+	eventHandlers       []func(Event)
+	initEvents          []Event
+	initialHealthCheck  InitialHealthCheckResult
+	hooks               []Hook
+	queryInjectors      map[string]QueryInjector
+	transportHint       TransportHintEncoder
+	insertBatcher       *insertBatcher
+	budgetAuditOnly     bool
+	primaryTables       map[string]struct{}
+	writeBudget         *writeBudget
+	spilloverPolicy     *SpilloverPolicy
+	costGuard           *costGuard
+	flagProvider        FlagProvider
+	localFlags          map[string]bool
+	strictDirectives    bool
+	overrideAudit       *OverrideAudit
+	partitionRouter     PartitionRouter
+	replicatedTables    map[int]map[string]struct{}
+	schemaGroups        map[string]string
+	queryCapture        *queryCapture
+	redactor            Redactor
+	readBudget          *readBudget
+	lagProbe            *lagProbe
+	statementIDOptions  StatementIDOptions
+	debugConfig         atomic.Value
+	debugDefault        uint32 // package-level Debug when db is created, 1 if true
+	bindType            BindType
+	dialect             Dialect
+	validateParamCount  *bool
+	noStaleConnRetry    bool
+	wrapNoRows          bool
+	writeTracker        *writeTracker
+	heartbeatInterval   time.Duration
+	probeSchedule       ProbeSchedule
+	readPercentage      int
+	failoverGracePeriod time.Duration
+	readinessCheck      *ReadinessCheck
+	rampUpPolicy        *RampUpPolicy
+	healthWeightPolicy  *HealthWeightPolicy
+	workloadLimiter     *workloadLimiter
+	flights             singleflight.Group
+	primaryTarget       TargetInfo
+	replicaTargets      []TargetInfo
+	configMutex         sync.RWMutex
+	metrics             *metrics
+	primaryErrors       *errorRing
+	closeMutex          sync.Mutex
+	onClose             []func()
+	closed              bool
 }
 
 // New returns new instance of DB.
@@ -98,6 +214,7 @@ type DB struct {
 // and `DoValidateNew` is true(default is false),
 // this package cannot be used correctly and will panic
 func New(master *sql.DB, readreplicas ...*sql.DB) *DB {
+	readreplicas, duplicates := collapseDuplicates(master, readreplicas)
 	if DoValidateNew {
 		if err := validateNew(master, readreplicas...); err != nil {
 			debug("[New] err: %s", err)
@@ -105,13 +222,80 @@ func New(master *sql.DB, readreplicas ...*sql.DB) *DB {
 		}
 	}
 
-	needHeartbeat := !DisableReplicaAutoFailover
-	stop := make(chan struct{})
+	db := newDB(context.Background(), master, readreplicas, !DisableReplicaAutoFailover)
+	db.deferDuplicateEvents(duplicates)
+	return db
+}
+
+// TryNew returns new instance of DB like `New()`, but always validates the invocation regardless of `DoValidateNew`
+// and returns the error instead of panicking: `ErrNotProvidedPrimary` if master is nil,
+// an error wrapping `ErrNotProvidedReplicas` telling which read replica is nil if any,
+// or `*DuplicateHandleError` if a handle is passed more than once.
+func TryNew(master *sql.DB, readreplicas ...*sql.DB) (*DB, error) {
+	readreplicas, duplicates := collapseDuplicates(master, readreplicas)
+	if err := validateNew(master, readreplicas...); err != nil {
+		debug("[TryNew] err: %s", err)
+		return nil, err
+	}
+	db := newDB(context.Background(), master, readreplicas, !DisableReplicaAutoFailover)
+	db.deferDuplicateEvents(duplicates)
+	return db, nil
+}
+
+// NewContext returns new instance of DB like `New()`, but returns errors instead of panicking.
+// If `DoValidateNew` is true, it returns the error of `validateNew()`, or pings primary DB and all read replicas
+// bounded by ctx and returns errors of all failing ones, each prefixed by the name of the DB (e.g. `replica-1: ...`).
+// The initial health check of read replicas is bounded by ctx as well.
+func NewContext(ctx context.Context, master *sql.DB, readreplicas ...*sql.DB) (*DB, error) {
+	readreplicas, duplicates := collapseDuplicates(master, readreplicas)
+	if DoValidateNew {
+		if err := validateNew(master, readreplicas...); err != nil {
+			debug("[NewContext] err: %s", err)
+			return nil, err
+		}
+		if err := pingAll(ctx, master, readreplicas); err != nil {
+			debug("[NewContext] err: %s", err)
+			return nil, err
+		}
+	}
+	db := newDB(ctx, master, readreplicas, !DisableReplicaAutoFailover)
+	db.deferDuplicateEvents(duplicates)
+	return db, nil
+}
+
+// pingAll pings primary DB and read replicas with ctx, returning errors of all failing ones
+func pingAll(ctx context.Context, master *sql.DB, readreplicas []*sql.DB) error {
+	primary, replicas := defaultTargets(len(readreplicas))
+	var errs error
+	if err := master.PingContext(ctx); err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("%s: %w", primary.Name, err))
+	}
+	for i, r := range readreplicas {
+		if err := r.PingContext(ctx); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", replicas[i].Name, err))
+		}
+	}
+	return errs
+}
+
+// newDB returns new instance of DB, running health checks if needHeartbeat.
+// The initial health check of read replicas is bounded by ctx.
+func newDB(ctx context.Context, master *sql.DB, readreplicas []*sql.DB, needHeartbeat bool) *DB {
 	var unavailableReplicas = map[*sql.DB]struct{}{}
-	var ticker *time.Ticker
+	var initialHealthCheck InitialHealthCheckResult
+	var failing map[*sql.DB]error
 	if needHeartbeat {
-		unavailableReplicas = heartbeat(readreplicas)
-		ticker = time.NewTicker(DefaultReplicaAutoFailoverInterval)
+		failing, initialHealthCheck = initialHeartbeat(ctx, readreplicas)
+		for r := range failing {
+			unavailableReplicas[r] = empty
+		}
+	}
+	replicaStates := make(map[*sql.DB]*replicaState, len(readreplicas))
+	for i, r := range readreplicas {
+		replicaStates[r] = newReplicaState(i)
+	}
+	for r := range unavailableReplicas {
+		replicaStates[r].downSince = time.Now()
 	}
 	db := &DB{
 		master:              master,
@@ -119,38 +303,39 @@ func New(master *sql.DB, readreplicas ...*sql.DB) *DB {
 		count:               -1, // so that start from the first read replica
 		needHeartbeat:       needHeartbeat,
 		unavailableReplicas: unavailableReplicas,
-		stopHeartbeat:       stop,
-		primaryInMaintence:  strings.ToLower(os.Getenv(EnvVarPrimaryInMaintenanceKey)) == "true",
-	}
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				db.countMutex.Lock()
-				db.unavailableReplicas = heartbeat(db.readreplicas)
-				db.countMutex.Unlock()
-			case <-stop:
-				ticker.Stop()
-				return
-			}
-		}
-	}()
+		suspectReplicas:     map[*sql.DB]time.Time{},
+		notReadyReplicas:    map[*sql.DB]struct{}{},
+		rampingSince:        map[*sql.DB]time.Time{},
+		drainedReplicas:     map[*sql.DB]struct{}{},
+		dedicatedConns:      map[*sql.DB]int{},
+		replicaStates:       replicaStates,
+		heartbeatInterval:   DefaultReplicaAutoFailoverInterval,
+		readPercentage:      100,
+		metrics:             newMetrics(len(readreplicas)),
+		primaryErrors:       &errorRing{},
+		initialHealthCheck:  initialHealthCheck,
+	}
+	if Debug {
+		db.debugDefault = 1
+	}
+	if isTrue(os.Getenv(EnvVarPrimaryInMaintenanceKey)) {
+		db.primaryInMaintence = 1
+	}
+	for i, r := range readreplicas {
+		replicaStates[r].latency = &db.metrics.latencyReplica[i]
+	}
+	db.primaryTarget, db.replicaTargets = defaultTargets(len(readreplicas))
+	for r, err := range failing {
+		db.recordError(db.targetInfo(r), OperationHealthCheck, "", err)
+	}
+	if needHeartbeat {
+		db.refreshPrimary()
+		db.heartbeater = db.startHealthHeartbeater(DefaultReplicaAutoFailoverInterval)
+	}
 
 	return db
 }
 
-// heartbeat returns map that holds unavailable(Ping has error) readreplica
-func heartbeat(readreplicas []*sql.DB) map[*sql.DB]struct{} {
-	unavailableReplicas := map[*sql.DB]struct{}{}
-	var err error
-	for _, r := range readreplicas {
-		if err = r.Ping(); err != nil {
-			unavailableReplicas[r] = empty
-		}
-	}
-	return unavailableReplicas
-}
-
 // readReplicaRoundRobin returns pointer of sql.DB to one of the read replicas,
 // using Round-Robin algorithm
 //
@@ -160,28 +345,69 @@ func heartbeat(readreplicas []*sql.DB) map[*sql.DB]struct{} {
 //
 // If DisableReplicaAutoFailover is true:
 // replica is selected using Round-Robin algorithm and without error returned
+//
+// Replicas evicted for breaching the SLO set by `SetReplicaSLO()` or by `Admin.Evict()`, and replicas excluded by
+// `ExcludeReplica()` are skipped as well.
+// Replicas drained by `DrainReplica()` are always skipped.
+// Replicas in ramp-up by `SetRampUpPolicy()` or flapping by `SetHealthWeightPolicy()`
+// are skipped by chance of their current weight.
+// The replica of `TargetInfo.ReaderEndpoint` is always selected unless skipped.
 func (db *DB) readReplicaRoundRobin(bypassAutoFailover ...bool) (*sql.DB, error) {
+	return db.readReplicaRoundRobinExcept(nil, len(bypassAutoFailover) > 0 && bypassAutoFailover[0])
+}
+
+// readReplicaRoundRobinExcept is `readReplicaRoundRobin()` skipping read replicas in exclude as well
+func (db *DB) readReplicaRoundRobinExcept(exclude map[*sql.DB]struct{}, bypassAutoFailover bool) (*sql.DB, error) {
 	if !DoValidateNew && len(db.readreplicas) == 0 {
 		return nil, ErrNotProvidedReplicas
 	}
 
-	if !db.needHeartbeat || (len(bypassAutoFailover) > 0 && bypassAutoFailover[0]) {
-		return db.readReplicaRoundRobinHelper(), nil
+	if db.single {
+		return db.readreplicas[0], nil
+	}
+	if r := db.readerEndpoint(exclude, bypassAutoFailover); r != nil {
+		return r, nil
+	}
+
+	if (!db.needHeartbeat && !db.evictionsEnabled()) || bypassAutoFailover {
+		if r := db.readReplicaRoundRobinHelperExcept(exclude); r != nil {
+			return r, nil
+		}
+		return nil, db.noReplicaAvailable(exclude, true)
 	}
 
 	// var errs, err error
+	rampUp := db.replicaRampUpPolicy()
+	health := db.replicaHealthWeightPolicy()
+	var throttled *sql.DB
+	failedOver := false
 	for try := 1; try <= len(db.readreplicas); try++ {
-		r := db.readReplicaRoundRobinHelper()
+		r := db.readReplicaRoundRobinHelperExcept(exclude)
+		if r == nil {
+			break
+		}
 		if db.needHeartbeat {
 			db.countMutex.RLock()
-			if _, unavailable := db.unavailableReplicas[r]; unavailable {
-				debug("[readReplicaRoundRobin] unavailable, try: %d", try)
+			if _, unavailable := db.unavailableReplicas[r]; unavailable || !db.ready(r) {
+				db.debugf(DebugEvent, "[readReplicaRoundRobin] unavailable, try: %d", try)
 				db.countMutex.RUnlock()
+				failedOver = true
+				continue
+			} else if db.throttled(rampUp, health, r) {
+				db.countMutex.RUnlock()
+				if throttled == nil {
+					throttled = r
+				}
 				continue
 			} else {
 				db.countMutex.RUnlock()
 			}
 		}
+		if db.evicted(r) {
+			db.debugf(DebugEvent, "[readReplicaRoundRobin] evicted, try: %d", try)
+			failedOver = true
+			continue
+		}
 		// Comment out as we will do heartbeat every DefaultReplicaAutoFailoverInterval
 		//
 		// if err = r.Ping(); err != nil {
@@ -189,22 +415,43 @@ func (db *DB) readReplicaRoundRobin(bypassAutoFailover ...bool) (*sql.DB, error)
 		// 	errs = multierr.Append(errs, err)
 		// 	continue
 		// }
+		if failedOver {
+			db.countFailover()
+		}
 		return r, nil
 	}
+	if throttled != nil {
+		// replicas in ramp-up or flapping still serve reads if no other replica is available
+		return throttled, nil
+	}
 
-	return nil, ErrNoReplicaAvailable
+	return nil, db.noReplicaAvailable(exclude, false)
 }
 
 // readReplicaRoundRobinHelper returns pointer of sql.DB to one of the read replicas,
-// using Round-Robin algorithm
+// using Round-Robin algorithm and skipping drained replicas. It returns nil if all replicas are drained.
 func (db *DB) readReplicaRoundRobinHelper() *sql.DB {
+	return db.readReplicaRoundRobinHelperExcept(nil)
+}
+
+// readReplicaRoundRobinHelperExcept is `readReplicaRoundRobinHelper()` skipping read replicas in exclude as well
+func (db *DB) readReplicaRoundRobinHelperExcept(exclude map[*sql.DB]struct{}) *sql.DB {
 	var idx int
 	db.countMutex.Lock()
-	db.count++
-	idx = db.count % len(db.readreplicas)
-	db.countMutex.Unlock()
-	debug("[readReplicaRoundRobinHelper] replica idx: %d", idx)
-	return db.readreplicas[idx]
+	defer db.countMutex.Unlock()
+	for try := 0; try < len(db.readreplicas); try++ {
+		db.count++
+		idx = db.count % len(db.readreplicas)
+		if _, drained := db.drainedReplicas[db.readreplicas[idx]]; drained {
+			continue
+		}
+		if _, excluded := exclude[db.readreplicas[idx]]; excluded {
+			continue
+		}
+		db.debugf(DebugRouting, "[readReplicaRoundRobinHelper] replica idx: %d", idx)
+		return db.readreplicas[idx]
+	}
+	return nil
 }
 
 // Ping verifies the connections to the primary &read replicas are still alive,
@@ -219,16 +466,19 @@ func (db *DB) Ping() error {
 		}
 	}
 
-	if !db.primaryInMaintence {
+	if !db.PrimaryInMaintenance() {
 		if err := db.master.Ping(); err != nil {
-			debug("[Ping] master err: %s", err)
+			db.debugf(DebugError, "[Ping] master err: %s", err)
 			return err
 		}
 	}
 
 	for i := range db.readreplicas {
+		if db.drained(db.readreplicas[i]) {
+			continue
+		}
 		if err := db.readreplicas[i].Ping(); err != nil {
-			debug("[Ping] readreplicas[%d] err: %s", i, err)
+			db.debugf(DebugError, "[Ping] readreplicas[%d] err: %s", i, err)
 			return err
 		}
 	}
@@ -248,16 +498,19 @@ func (db *DB) PingContext(ctx context.Context) error {
 		}
 	}
 
-	if !db.primaryInMaintence {
+	if !db.PrimaryInMaintenance() {
 		if err := db.master.PingContext(ctx); err != nil {
-			debug("[PingContext] master err: %s", err)
+			db.debugf(DebugError, "[PingContext] master err: %s", err)
 			return err
 		}
 	}
 
 	for i := range db.readreplicas {
+		if db.drained(db.readreplicas[i]) {
+			continue
+		}
 		if err := db.readreplicas[i].PingContext(ctx); err != nil {
-			debug("[PingContext] readreplicas[%d] err: %s", i, err)
+			db.debugf(DebugError, "[PingContext] readreplicas[%d] err: %s", i, err)
 			return err
 		}
 	}
@@ -271,16 +524,30 @@ func (db *DB) PingContext(ctx context.Context) error {
 // Internally it uses one of read replica DB.
 func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	var err error
-	if err = validateQuery(query, args...); err != nil {
-		debug("[Query] validate err: %s", err)
+	if err = db.validateQuery(query, args...); err != nil {
+		db.debugf(DebugError, "[Query] validate err: %s", err)
+		db.metrics.countError(err)
 		return nil, err
 	}
-	var tgtdb *sql.DB
-	if tgtdb, err = db.readReplicaRoundRobin(); err != nil {
-		debug("[Query] readReplicaRoundRobin err: %s", err)
+	if forcePrimary, _ := checkExplain(query); forcePrimary || db.pinnedToPrimary(query) || db.queryCostGuard() != nil || db.routingPartitionRouter() != nil {
+		rows, _, err := db.queryContext(context.Background(), query, args...)
+		return rows, err
+	}
+	query = db.rebind(query)
+	ctx, stmt := db.beginStatement(db.withQueryTables(context.Background(), query), "Query", query, args)
+	var rows *sql.Rows
+	err = db.readReplica(ctx, false, func(tgtdb *sql.DB) error {
+		return db.runStatement(ctx, stmt, tgtdb, func(query string) error {
+			rows, err = tgtdb.Query(query, args...)
+			return err
+		})
+	})
+	if err != nil {
+		db.debugf(DebugError, "[Query] err: %s", err)
+		db.metrics.countError(err)
 		return nil, err
 	}
-	return tgtdb.Query(query, args...)
+	return rows, nil
 }
 
 // QueryContext executes a query that returns rows, typically a SELECT.
@@ -288,28 +555,115 @@ func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
 //
 // Internally it uses one of read replica DB normally;
 // in case that `ctx` is created from `mydb.WithPrimary(ctx)`,
-// or have `ContextUsePrimaryKey` in context value, it will use primary DB
+// or has `RoutingDirective.ForcePrimary`, or query reads a table set by `SetPrimaryTables()`,
+// it will use primary DB.
+// In case that `ctx` is created from `mydb.WithExactReplicaOrder(ctx)`,
+// read replica is selected ignoring auto failover.
+// In case that `ctx` is created from `mydb.WithReplica(ctx)`, query is routed as a read even if not classified as a read.
+// Queries estimated too expensive by `CostGuard` are rejected with `ErrQueryTooExpensive` or routed to primary DB.
 func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	var err error
-	if err := validateQuery(query, args...); err != nil {
-		debug("[QueryContext] validate err: %s", err)
-		return nil, err
+	rows, _, err := db.queryContext(ctx, query, args...)
+	return rows, err
+}
+
+// queryContext is `QueryContext()` also returning the DB the query was routed to
+func (db *DB) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, *sql.DB, error) {
+	cluster, err := db.partitionCluster(ctx, query)
+	if err != nil {
+		db.debugf(DebugError, "[QueryContext] partition err: %s", err)
+		db.metrics.countError(err)
+		return nil, nil, err
+	}
+	if cluster != nil {
+		return cluster.queryContext(ctx, query, args...)
 	}
+	if err := checkNotInTx(ctx, "QueryContext"); err != nil {
+		db.debugf(DebugError, "[QueryContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, nil, err
+	}
+	if err := db.checkDirectives(ctx, "QueryContext", query, false); err != nil {
+		db.debugf(DebugError, "[QueryContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, nil, err
+	}
+	if err := db.validateQueryContext(ctx, query, args...); err != nil {
+		db.debugf(DebugError, "[QueryContext] validate err: %s", err)
+		db.metrics.countError(err)
+		return nil, nil, err
+	}
+	ctx = db.withQueryTables(db.withPinnedTables(ctx, query), query)
+	forcePrimary, _ := checkExplain(query)
+	if !forcePrimary {
+		if ctx, err = db.guardCost(ctx, query, args); err != nil {
+			db.debugf(DebugError, "[QueryContext] cost guard err: %s", err)
+			db.metrics.countError(err)
+			return nil, nil, err
+		}
+	}
+	if forcePrimary {
+		if err := db.primaryWritable(ctx); err != nil {
+			db.debugf(DebugError, "[QueryContext] primary err: %s", err)
+			db.metrics.countError(err)
+			return nil, nil, err
+		}
+	} else if !UsePrimaryFromContext(ctx) && SingleflightFromContext(ctx) {
+		return db.singleflightQuery(ctx, query, args)
+	}
+	query = db.rebind(query)
+	ctx, stmt := db.beginStatement(ctx, "QueryContext", query, args)
 
-	var tgtdb *sql.DB
-	if usePrimary := UsePrimaryFromContext(ctx); usePrimary && !db.primaryInMaintence {
+	usePrimary := UsePrimaryFromContext(ctx) || forcePrimary
+	if usePrimary && !db.PrimaryInMaintenance() && (forcePrimary || !db.redirectPrimaryReads()) {
 		if !DoValidateNew && db.master == nil {
-			debug("[QueryContext] primary err: %s", ErrNotProvidedPrimary)
-			return nil, ErrNotProvidedPrimary
+			db.debugf(DebugError, "[QueryContext] primary err: %s", ErrNotProvidedPrimary)
+			db.metrics.countError(ErrNotProvidedPrimary)
+			return nil, nil, ErrNotProvidedPrimary
 		}
-		tgtdb = db.master
-	} else {
-		if tgtdb, err = db.readReplicaRoundRobin(); err != nil {
-			debug("[QueryContext] readReplicaRoundRobin err: %s", err)
-			return nil, err
+		if forcePrimary {
+			db.countWrite()
+		} else {
+			db.countRead(db.master)
 		}
+		start := time.Now()
+		var rows *sql.Rows
+		err := db.runStatement(ctx, stmt, db.master, func(query string) error {
+			var err error
+			rows, err = db.master.QueryContext(ctx, query, args...)
+			return err
+		})
+		db.recordLatency(db.master, forcePrimary, time.Since(start))
+		db.metrics.countError(err)
+		return rows, db.master, err
+	}
+
+	if usePrimary {
+		db.countFallback()
 	}
-	return tgtdb.QueryContext(ctx, query, args...)
+	var rows *sql.Rows
+	var target *sql.DB
+	err = db.readReplica(ctx, ExactReplicaOrderFromContext(ctx), func(tgtdb *sql.DB) error {
+		target = tgtdb
+		return db.runStatement(ctx, stmt, tgtdb, func(query string) error {
+			rows, err = tgtdb.QueryContext(ctx, query, args...)
+			return err
+		})
+	})
+	if err != nil {
+		db.debugf(DebugError, "[QueryContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, nil, err
+	}
+	if FreshnessAssertFromContext(ctx) && target != db.master {
+		result, err := db.assertFreshness(stmt, target, rows, args, 0)
+		if err != nil {
+			db.metrics.countError(err)
+			return nil, nil, err
+		}
+		rows, err = memDB.QueryContext(ctx, "", result)
+		return rows, target, err
+	}
+	return rows, target, nil
 }
 
 // QueryRow executes a prepared query statement with the given arguments.
@@ -320,13 +674,28 @@ func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{
 //
 // Internally it uses one of read replica DB.
 func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	if forcePrimary, err := checkExplain(query); err != nil || forcePrimary || db.pinnedToPrimary(query) || db.queryCostGuard() != nil ||
+		db.routingPartitionRouter() != nil || db.routesByTables() {
+		return db.QueryRowContext(context.Background(), query, args...)
+	}
 	var err error
 	tgtdb, err := db.readReplicaRoundRobin(true)
 	if err != nil {
-		debug("[QueryContext] readReplicaRoundRobin err: %s", err)
+		db.debugf(DebugError, "[QueryContext] readReplicaRoundRobin err: %s", err)
+		db.metrics.countError(err)
 		panic(err)
 	}
-	return tgtdb.QueryRow(query, args...)
+	db.countRead(tgtdb)
+	ctx, stmt := db.beginStatement(context.Background(), "QueryRow", db.rebind(query), args)
+	var row *sql.Row
+	if err := db.runStatement(ctx, stmt, tgtdb, func(query string) error {
+		row = tgtdb.QueryRow(query, args...)
+		return nil
+	}); err != nil {
+		db.metrics.countError(err)
+		panic(err)
+	}
+	return row
 }
 
 // QueryRowContext executes a prepared query statement with the given arguments.
@@ -334,27 +703,109 @@ func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
 // will be returned by a call to Scan on the returned *Row, which is always non-nil.
 // If the query selects no rows, the *Row's Scan will return ErrNoRows.
 // Otherwise, the *Row's Scan scans the first selected row and discards the rest.
+// If ctx is done before the query is sent, including while routing waited (e.g. for a slot of `WorkloadPolicy`),
+// the *Row's Scan returns the error of ctx, i.e. `context.Canceled` or `context.DeadlineExceeded`.
 //
 // Internally it uses one of read replica DB normally;
 // in case that `ctx` is created from `mydb.WithPrimary(ctx)`,
-// or have `ContextUsePrimaryKey` in context value, it will use primary DB
+// or has `RoutingDirective.ForcePrimary`, or query reads a table set by `SetPrimaryTables()`,
+// it will use primary DB
 func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	row, _ := db.queryRowContext(ctx, query, args...)
+	return row
+}
+
+// queryRowContext is `QueryRowContext()` also returning the DB the query was routed to, nil if not routed
+func (db *DB) queryRowContext(ctx context.Context, query string, args ...interface{}) (*sql.Row, *sql.DB) {
+	wrote := db.wroteRecently(ctx)
+	if err := ctx.Err(); err != nil {
+		db.debugf(DebugError, "[QueryRowContext] err: %s", err)
+		db.metrics.countError(err)
+		return errRow(err), nil
+	}
+	cluster, err := db.partitionCluster(ctx, query)
+	if cluster != nil {
+		return cluster.queryRowContext(ctx, query, args...)
+	}
+	if err == nil {
+		err = checkNotInTx(ctx, "QueryRowContext")
+	}
+	if err == nil {
+		err = db.checkDirectives(ctx, "QueryRowContext", query, false)
+	}
+	ctx = db.withQueryTables(db.withPinnedTables(ctx, query), query)
 	var tgtdb *sql.DB
-	if usePrimary := UsePrimaryFromContext(ctx); usePrimary && !db.primaryInMaintence {
+	var forcePrimary bool
+	if err == nil {
+		forcePrimary, err = checkExplain(query)
+	}
+	if err == nil && forcePrimary {
+		err = db.primaryWritable(ctx)
+	} else if err == nil {
+		ctx, err = db.guardCost(ctx, query, args)
+	}
+	if err != nil {
+		db.debugf(DebugError, "[QueryRowContext] err: %s", err)
+		db.metrics.countError(err)
+		return failRow(ctx, err), nil
+	}
+	usePrimary := UsePrimaryFromContext(ctx) || forcePrimary
+	if !usePrimary && SingleflightFromContext(ctx) {
+		return db.singleflightQueryRow(ctx, query, args)
+	}
+	if usePrimary && !db.PrimaryInMaintenance() && (forcePrimary || !db.redirectPrimaryReads()) {
 		if !DoValidateNew && db.master == nil {
-			debug("[QueryRowContext] primary err: %s", ErrNotProvidedPrimary)
+			db.debugf(DebugError, "[QueryRowContext] primary err: %s", ErrNotProvidedPrimary)
+			db.metrics.countError(ErrNotProvidedPrimary)
 			panic(ErrNotProvidedPrimary)
 		}
 		tgtdb = db.master
 	} else {
 		var err error
-		tgtdb, err = db.readReplicaRoundRobin(true)
+		tgtdb, err = db.readReplicaRoundRobinExcept(db.excludedReplicas(ctx), true)
 		if err != nil {
-			debug("[QueryRowContext] readReplicaRoundRobin err: %s", err)
-			panic(err)
+			db.debugf(DebugError, "[QueryRowContext] readReplicaRoundRobin err: %s", err)
+			db.metrics.countError(err)
+			return failRow(ctx, err), nil
+		}
+		if usePrimary {
+			db.countFallback()
 		}
 	}
-	return tgtdb.QueryRowContext(ctx, query, args...)
+	if forcePrimary {
+		db.countWrite()
+	} else {
+		db.countRead(tgtdb)
+	}
+	ctx, stmt := db.beginStatement(ctx, "QueryRowContext", db.rebind(query), args)
+	if wrote && !forcePrimary && tgtdb != db.master {
+		return db.queryRowAfterWrite(ctx, stmt, tgtdb, args)
+	}
+	if FreshnessAssertFromContext(ctx) && !forcePrimary && tgtdb != db.master {
+		return db.queryRowAsserted(ctx, stmt, tgtdb, args), tgtdb
+	}
+	var row *sql.Row
+	if err := db.runStatement(ctx, stmt, tgtdb, func(query string) error {
+		row = tgtdb.QueryRowContext(ctx, query, args...)
+		return nil
+	}); err != nil {
+		db.metrics.countError(err)
+		return failRow(ctx, err), nil
+	}
+	return row, tgtdb
+}
+
+// failRow returns `*sql.Row` whose `Scan()` returns the error of ctx if it is done,
+// so that cancellation is surfaced consistently even if routing failed by it, or err beyond `WithQueryBudget()`,
+// otherwise panics with err
+func failRow(ctx context.Context, err error) *sql.Row {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return errRow(ctxErr)
+	}
+	if errors.Is(err, ErrQueryBudgetExceeded) {
+		return errRow(err)
+	}
+	panic(err)
 }
 
 // Begin starts a transaction.
@@ -362,15 +813,34 @@ func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interfa
 //
 // Internally it uses primary DB.
 func (db *DB) Begin() (*sql.Tx, error) {
-	if db.primaryInMaintence {
-		debug("[Begin] err: %s", ErrPrimaryInMaintenance)
+	if db.routingPartitionRouter() != nil {
+		return db.BeginTx(context.Background(), nil)
+	}
+	if db.PrimaryInMaintenance() {
+		db.debugf(DebugError, "[Begin] err: %s", ErrPrimaryInMaintenance)
+		db.metrics.countError(ErrPrimaryInMaintenance)
 		return nil, ErrPrimaryInMaintenance
 	}
 	if !DoValidateNew && db.master == nil {
-		debug("[Begin] err: %s", ErrNotProvidedPrimary)
+		db.debugf(DebugError, "[Begin] err: %s", ErrNotProvidedPrimary)
+		db.metrics.countError(ErrNotProvidedPrimary)
 		return nil, ErrNotProvidedPrimary
 	}
-	return db.master.Begin()
+	if err := db.checkPrimaryWrite(context.Background()); err != nil {
+		db.debugf(DebugError, "[Begin] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	db.countWrite()
+	ctx, stmt := db.beginStatement(context.Background(), "Begin", "", nil)
+	var tx *sql.Tx
+	err := db.runStatement(ctx, stmt, db.master, func(string) error {
+		var err error
+		tx, err = db.master.Begin()
+		return err
+	})
+	db.metrics.countError(err)
+	return tx, err
 }
 
 // BeginTx starts a transaction.
@@ -379,145 +849,418 @@ func (db *DB) Begin() (*sql.Tx, error) {
 // If the context is canceled, the sql package will roll back the transaction.
 // Tx.Commit will return an error if the context provided to BeginTx is canceled.
 //
-// The provided TxOptions is optional and may be nil if defaults should be used.
+// The provided TxOptions is optional and may be nil if defaults should be used,
+// in which case TxOptions set by `WithTxOptions()` in ctx are used if any.
 // If a non-default isolation level is used that the driver doesn't support, an error will be returned.
 //
 // Internally it uses primary DB.
 func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
-	if db.primaryInMaintence {
-		debug("[BeginTx] err: %s", ErrPrimaryInMaintenance)
+	cluster, err := db.partitionCluster(ctx, "")
+	if err != nil {
+		db.debugf(DebugError, "[BeginTx] partition err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if cluster != nil {
+		return cluster.BeginTx(ctx, opts)
+	}
+	if err := checkNotInTx(ctx, "BeginTx"); err != nil {
+		db.debugf(DebugError, "[BeginTx] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if err := db.checkDirectives(ctx, "BeginTx", "", true); err != nil {
+		db.debugf(DebugError, "[BeginTx] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if db.PrimaryInMaintenance() {
+		db.debugf(DebugError, "[BeginTx] err: %s", ErrPrimaryInMaintenance)
+		db.metrics.countError(ErrPrimaryInMaintenance)
 		return nil, ErrPrimaryInMaintenance
 	}
 	if !DoValidateNew && db.master == nil {
-		debug("[BeginTx] err: %s", ErrNotProvidedPrimary)
+		db.debugf(DebugError, "[BeginTx] err: %s", ErrNotProvidedPrimary)
+		db.metrics.countError(ErrNotProvidedPrimary)
 		return nil, ErrNotProvidedPrimary
 	}
-	return db.master.BeginTx(ctx, opts)
+	if err := db.checkPrimaryWrite(ctx); err != nil {
+		db.debugf(DebugError, "[BeginTx] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if opts == nil {
+		opts = TxOptionsFromContext(ctx)
+	}
+	db.countWrite()
+	if opts == nil || !opts.ReadOnly {
+		db.markWrite(ctx)
+	}
+	ctx, stmt := db.beginStatement(ctx, "BeginTx", "", nil)
+	var tx *sql.Tx
+	err = db.runStatement(ctx, stmt, db.master, func(string) error {
+		var err error
+		tx, err = db.master.BeginTx(ctx, opts)
+		return err
+	})
+	db.metrics.countError(err)
+	return tx, err
+}
+
+// OnClose registers f to be called when `Close()` is called,
+// so that components built on top of DB are torn down together with it.
+// Registered functions are called once in reverse order of registration,
+// before the primary & read replicas DB are closed.
+// If DB is already closed, f is called immediately.
+func (db *DB) OnClose(f func()) {
+	db.closeMutex.Lock()
+	if db.closed {
+		db.closeMutex.Unlock()
+		f()
+		return
+	}
+	db.onClose = append(db.onClose, f)
+	db.closeMutex.Unlock()
 }
 
 // Close closes the primary & read replicas DB
 func (db *DB) Close() error {
-	close(db.stopHeartbeat)
+	db.closeMutex.Lock()
+	if db.heartbeater != nil {
+		db.heartbeater.Stop()
+	}
+	if db.keepAliver != nil {
+		db.keepAliver.Stop()
+	}
+	if db.maintenanceSync != nil {
+		db.maintenanceSync.stop()
+	}
+	if db.statsReporter != nil {
+		db.statsReporter.Stop()
+	}
+	if db.credentialRotation != nil {
+		db.credentialRotation.Stop()
+	}
+	if db.lagProber != nil {
+		db.lagProber.Stop()
+	}
+	if db.leakChecker != nil {
+		db.leakChecker.Stop()
+	}
+	if db.poolTuner != nil {
+		db.poolTuner.Stop()
+	}
+	onClose := db.onClose
+	db.onClose = nil
+	db.closed = true
+	db.closeMutex.Unlock()
+	for i := len(onClose) - 1; i >= 0; i-- {
+		onClose[i]()
+	}
+
 	var errs, err error
-	if !db.primaryInMaintence {
+	if !db.PrimaryInMaintenance() {
 		if err = db.master.Close(); err != nil {
 			errs = multierr.Append(errs, err)
 		}
 	}
 
 	for i := range db.readreplicas {
+		if db.single {
+			break
+		}
 		if err = db.readreplicas[i].Close(); err != nil {
 			errs = multierr.Append(errs, err)
 		}
 	}
 	if errs != nil {
-		debug("[Close] err: %s", errs)
+		db.debugf(DebugError, "[Close] err: %s", errs)
 	}
 	return errs
 }
 
 // Exec executes a query without returning any rows. The args are for any placeholder parameters in the query.
+// The returned `sql.Result` is a `*Result` exposing routing context.
 //
 // Internally it uses primary DB.
 func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	if db.primaryInMaintence {
-		debug("[Exec] err: %s", ErrPrimaryInMaintenance)
+	if db.routingPartitionRouter() != nil {
+		return db.ExecContext(context.Background(), query, args...)
+	}
+	if _, err := checkExplain(query); err != nil {
+		db.debugf(DebugError, "[Exec] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if db.PrimaryInMaintenance() {
+		db.debugf(DebugError, "[Exec] err: %s", ErrPrimaryInMaintenance)
+		db.metrics.countError(ErrPrimaryInMaintenance)
 		return nil, ErrPrimaryInMaintenance
 	}
 	if !DoValidateNew && db.master == nil {
-		debug("[Exec] err: %s", ErrNotProvidedPrimary)
+		db.debugf(DebugError, "[Exec] err: %s", ErrNotProvidedPrimary)
+		db.metrics.countError(ErrNotProvidedPrimary)
 		return nil, ErrNotProvidedPrimary
 	}
-	return db.master.Exec(query, args...)
+	if err := db.checkPrimaryWrite(context.Background()); err != nil {
+		db.debugf(DebugError, "[Exec] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	db.countWrite()
+	ctx, stmt := db.beginStatement(context.Background(), "Exec", db.rebind(query), args)
+	start := time.Now()
+	var res sql.Result
+	tries := 0
+	err := db.runStatement(ctx, stmt, db.master, func(query string) error {
+		var err error
+		tries++
+		res, err = db.master.Exec(query, args...)
+		return err
+	})
+	db.observeWrite(start)
+	db.metrics.countError(err)
+	return newResult(res, db.targetInfo(db.master), tries, start), err
 }
 
 // ExecContext executes a query without returning any rows. The args are for any placeholder parameters in the query.
+// The returned `sql.Result` is a `*Result` exposing routing context.
 //
 // Internally it uses primary DB.
 func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	if db.primaryInMaintence {
-		debug("[ExecContext] err: %s", ErrPrimaryInMaintenance)
+	cluster, err := db.partitionCluster(ctx, query)
+	if err != nil {
+		db.debugf(DebugError, "[ExecContext] partition err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if cluster != nil {
+		return cluster.ExecContext(ctx, query, args...)
+	}
+	if err := checkNotInTx(ctx, "ExecContext"); err != nil {
+		db.debugf(DebugError, "[ExecContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if err := db.checkDirectives(ctx, "ExecContext", query, true); err != nil {
+		db.debugf(DebugError, "[ExecContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if _, err := checkExplain(query); err != nil {
+		db.debugf(DebugError, "[ExecContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if db.PrimaryInMaintenance() {
+		db.debugf(DebugError, "[ExecContext] err: %s", ErrPrimaryInMaintenance)
+		db.metrics.countError(ErrPrimaryInMaintenance)
 		return nil, ErrPrimaryInMaintenance
 	}
 	if !DoValidateNew && db.master == nil {
-		debug("[ExecContext] err: %s", ErrNotProvidedPrimary)
+		db.debugf(DebugError, "[ExecContext] err: %s", ErrNotProvidedPrimary)
+		db.metrics.countError(ErrNotProvidedPrimary)
 		return nil, ErrNotProvidedPrimary
 	}
-	return db.master.ExecContext(ctx, query, args...)
+	if err := db.checkPrimaryWrite(ctx); err != nil {
+		db.debugf(DebugError, "[ExecContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	db.countWrite()
+	db.markWrite(ctx)
+	ctx, stmt := db.beginStatement(ctx, "ExecContext", db.rebind(query), args)
+	if b := db.primaryInsertBatcher(); b != nil && b.batchable(query, args) {
+		return db.execBatched(ctx, b, stmt, query, args)
+	}
+	start := time.Now()
+	var res sql.Result
+	tries := 0
+	err = db.runStatement(ctx, stmt, db.master, func(query string) error {
+		var err error
+		tries++
+		res, err = db.master.ExecContext(ctx, query, args...)
+		return err
+	})
+	db.observeWrite(start)
+	db.metrics.countError(err)
+	return newResult(res, db.targetInfo(db.master), tries, start), err
 }
 
 // Prepare creates a prepared statement for later queries or executions.
 // Multiple queries or executions may be run concurrently from the returned statement.
 // The caller must call the statement's Close method when the statement is no longer needed.
 func (db *DB) Prepare(query string) (*sql.Stmt, error) {
+	if db.routingPartitionRouter() != nil {
+		return db.PrepareContext(context.Background(), query)
+	}
 	var err error
-	var tgtdb *sql.DB
-	if isQuery := IsQuerySqlFunc(query); isQuery {
-		if tgtdb, err = db.readReplicaRoundRobin(); err != nil {
-			debug("[Prepare] err: %s", err)
+	if _, err = checkExplain(query); err != nil {
+		db.debugf(DebugError, "[Prepare] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	isQuery := db.isQuery(query)
+	if isQuery && db.pinnedToPrimary(query) {
+		return db.PrepareContext(context.Background(), query)
+	}
+	query = db.rebind(query)
+	// prepared statements outlive the statement ID, so that it is not commented in SQL
+	ctx, info := db.beginStatement(db.withQueryTables(context.Background(), query), "Prepare", query, nil)
+	if isQuery {
+		var stmt *sql.Stmt
+		err = db.readReplica(ctx, false, func(tgtdb *sql.DB) error {
+			return db.runStatement(ctx, info, tgtdb, func(string) error {
+				stmt, err = tgtdb.Prepare(query)
+				return err
+			})
+		})
+		if err != nil {
+			db.debugf(DebugError, "[Prepare] err: %s", err)
+			db.metrics.countError(err)
 			return nil, err
 		}
-	} else {
-		if db.primaryInMaintence {
-			debug("[Prepare] err: %s", ErrPrimaryInMaintenance)
-			return nil, ErrPrimaryInMaintenance
-		}
-		if !DoValidateNew && db.master == nil {
-			debug("[Prepare] err: %s", ErrNotProvidedPrimary)
-			return nil, ErrNotProvidedPrimary
-		}
-		tgtdb = db.master
+		return stmt, nil
+	}
+
+	if db.PrimaryInMaintenance() {
+		db.debugf(DebugError, "[Prepare] err: %s", ErrPrimaryInMaintenance)
+		db.metrics.countError(ErrPrimaryInMaintenance)
+		return nil, ErrPrimaryInMaintenance
 	}
-	return tgtdb.Prepare(query)
+	if !DoValidateNew && db.master == nil {
+		db.debugf(DebugError, "[Prepare] err: %s", ErrNotProvidedPrimary)
+		db.metrics.countError(ErrNotProvidedPrimary)
+		return nil, ErrNotProvidedPrimary
+	}
+	if err = db.checkPrimaryWrite(ctx); err != nil {
+		db.debugf(DebugError, "[Prepare] err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	db.countWrite()
+	var stmt *sql.Stmt
+	err = db.runStatement(ctx, info, db.master, func(string) error {
+		stmt, err = db.master.Prepare(query)
+		return err
+	})
+	db.metrics.countError(err)
+	return stmt, err
 }
 
 // PrepareContext creates a prepared statement for later queries or executions.
 // Multiple queries or executions may be run concurrently from the returned statement.
 // The caller must call the statement's Close method when the statement is no longer needed.
+// The statement stays on the target it is prepared on; use `PrepareStmt()` for statements routed on each execution.
 func (db *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	var err error
-	isQuery := IsQuerySqlFunc(query)
+	stmt, _, err := db.prepareContext(ctx, query)
+	return stmt, err
+}
+
+// prepareContext is `PrepareContext()` also returning the DB the statement was prepared on
+func (db *DB) prepareContext(ctx context.Context, query string) (*sql.Stmt, *sql.DB, error) {
+	cluster, err := db.partitionCluster(ctx, query)
+	if err != nil {
+		db.debugf(DebugError, "[PrepareContext] partition err: %s", err)
+		db.metrics.countError(err)
+		return nil, nil, err
+	}
+	if cluster != nil {
+		return cluster.prepareContext(ctx, query)
+	}
+	if err = checkNotInTx(ctx, "PrepareContext"); err != nil {
+		db.debugf(DebugError, "[PrepareContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, nil, err
+	}
+	if err = db.checkDirectives(ctx, "PrepareContext", query, false); err != nil {
+		db.debugf(DebugError, "[PrepareContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, nil, err
+	}
+	if _, err = checkExplain(query); err != nil {
+		db.debugf(DebugError, "[PrepareContext] err: %s", err)
+		db.metrics.countError(err)
+		return nil, nil, err
+	}
+	isQuery := db.isQuery(query) || UseReplicaFromContext(ctx)
+	if isQuery {
+		ctx = db.withQueryTables(db.withPinnedTables(ctx, query), query)
+	}
+	query = db.rebind(query)
+	// prepared statements outlive the statement ID, so that it is not commented in SQL
+	ctx, info := db.beginStatement(ctx, "PrepareContext", query, nil)
 	usePrimary := UsePrimaryFromContext(ctx)
-	var tgtdb *sql.DB
-	if isQuery && !usePrimary {
-		if tgtdb, err = db.readReplicaRoundRobin(); err != nil {
-			debug("[PrepareContext] err: %s", ErrNotProvidedPrimary)
-			return nil, err
+	if isQuery && (!usePrimary || db.redirectPrimaryReads()) {
+		if usePrimary {
+			db.countFallback()
 		}
-	} else {
-		if db.primaryInMaintence {
-			debug("[PrepareContext] err: %s", ErrPrimaryInMaintenance)
-			return nil, ErrPrimaryInMaintenance
+		var stmt *sql.Stmt
+		var target *sql.DB
+		err = db.readReplica(ctx, ExactReplicaOrderFromContext(ctx), func(tgtdb *sql.DB) error {
+			target = tgtdb
+			return db.runStatement(ctx, info, tgtdb, func(string) error {
+				stmt, err = tgtdb.PrepareContext(ctx, query)
+				return err
+			})
+		})
+		if err != nil {
+			db.debugf(DebugError, "[PrepareContext] err: %s", err)
+			db.metrics.countError(err)
+			return nil, nil, err
 		}
-		if !DoValidateNew && db.master == nil {
-			debug("[PrepareContext] err: %s", ErrNotProvidedPrimary)
-			return nil, ErrNotProvidedPrimary
+		return stmt, target, nil
+	}
+
+	if db.PrimaryInMaintenance() {
+		db.debugf(DebugError, "[PrepareContext] err: %s", ErrPrimaryInMaintenance)
+		db.metrics.countError(ErrPrimaryInMaintenance)
+		return nil, nil, ErrPrimaryInMaintenance
+	}
+	if !DoValidateNew && db.master == nil {
+		db.debugf(DebugError, "[PrepareContext] err: %s", ErrNotProvidedPrimary)
+		db.metrics.countError(ErrNotProvidedPrimary)
+		return nil, nil, ErrNotProvidedPrimary
+	}
+	if isQuery {
+		db.countRead(db.master)
+	} else {
+		if err = db.checkPrimaryWrite(ctx); err != nil {
+			db.debugf(DebugError, "[PrepareContext] err: %s", err)
+			db.metrics.countError(err)
+			return nil, nil, err
 		}
-		tgtdb = db.master
+		db.countWrite()
 	}
-	return tgtdb.PrepareContext(ctx, query)
+	var stmt *sql.Stmt
+	err = db.runStatement(ctx, info, db.master, func(string) error {
+		stmt, err = db.master.PrepareContext(ctx, query)
+		return err
+	})
+	db.metrics.countError(err)
+	return stmt, db.master, err
 }
 
 // SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
 func (db *DB) SetConnMaxLifetime(d time.Duration) {
 	if !DoValidateNew {
 		if db.master == nil {
-			debug("[SetConnMaxLifetime] err: %s", ErrNotProvidedPrimary)
+			db.debugf(DebugError, "[SetConnMaxLifetime] err: %s", ErrNotProvidedPrimary)
 			panic(ErrNotProvidedPrimary)
 		}
 		if len(db.readreplicas) == 0 {
-			debug("[SetConnMaxLifetime] err: %s", ErrNotProvidedReplicas)
+			db.debugf(DebugError, "[SetConnMaxLifetime] err: %s", ErrNotProvidedReplicas)
 			panic(ErrNotProvidedReplicas)
 		}
 	}
 
-	if !db.primaryInMaintence {
-		debug("[SetConnMaxLifetime] master: %s", d)
+	if !db.PrimaryInMaintenance() {
+		db.debugf(DebugEvent, "[SetConnMaxLifetime] master: %s", d)
 		db.master.SetConnMaxLifetime(d)
 	}
 
 	for i := range db.readreplicas {
-		debug("[SetConnMaxLifetime] replica[%d]: %s", i, d)
+		db.debugf(DebugEvent, "[SetConnMaxLifetime] replica[%d]: %s", i, d)
 		db.readreplicas[i].SetConnMaxLifetime(d)
 	}
 }
@@ -526,22 +1269,22 @@ func (db *DB) SetConnMaxLifetime(d time.Duration) {
 func (db *DB) SetMaxIdleConns(n int) {
 	if !DoValidateNew {
 		if db.master == nil {
-			debug("[SetMaxIdleConns] err: %s", ErrNotProvidedPrimary)
+			db.debugf(DebugError, "[SetMaxIdleConns] err: %s", ErrNotProvidedPrimary)
 			panic(ErrNotProvidedPrimary)
 		}
 		if len(db.readreplicas) == 0 {
-			debug("[SetMaxIdleConns] err: %s", ErrNotProvidedReplicas)
+			db.debugf(DebugError, "[SetMaxIdleConns] err: %s", ErrNotProvidedReplicas)
 			panic(ErrNotProvidedReplicas)
 		}
 	}
 
-	if !db.primaryInMaintence {
-		debug("[SetMaxIdleConns] master: %d", n)
+	if !db.PrimaryInMaintenance() {
+		db.debugf(DebugEvent, "[SetMaxIdleConns] master: %d", n)
 		db.master.SetMaxIdleConns(n)
 	}
 
 	for i := range db.readreplicas {
-		debug("[SetMaxIdleConns] replica[%d]: %d", i, n)
+		db.debugf(DebugEvent, "[SetMaxIdleConns] replica[%d]: %d", i, n)
 		db.readreplicas[i].SetMaxIdleConns(n)
 	}
 }
@@ -550,22 +1293,22 @@ func (db *DB) SetMaxIdleConns(n int) {
 func (db *DB) SetMaxOpenConns(n int) {
 	if !DoValidateNew {
 		if db.master == nil {
-			debug("[SetMaxOpenConns] err: %s", ErrNotProvidedPrimary)
+			db.debugf(DebugError, "[SetMaxOpenConns] err: %s", ErrNotProvidedPrimary)
 			panic(ErrNotProvidedPrimary)
 		}
 		if len(db.readreplicas) == 0 {
-			debug("[SetMaxOpenConns] err: %s", ErrNotProvidedReplicas)
+			db.debugf(DebugError, "[SetMaxOpenConns] err: %s", ErrNotProvidedReplicas)
 			panic(ErrNotProvidedReplicas)
 		}
 	}
 
-	if !db.primaryInMaintence {
-		debug("[SetMaxOpenConns] master: %d", n)
+	if !db.PrimaryInMaintenance() {
+		db.debugf(DebugEvent, "[SetMaxOpenConns] master: %d", n)
 		db.master.SetMaxOpenConns(n)
 	}
 
 	for i := range db.readreplicas {
-		debug("[SetMaxOpenConns] replica[%d]: %d", i, n)
+		db.debugf(DebugEvent, "[SetMaxOpenConns] replica[%d]: %d", i, n)
 		db.readreplicas[i].SetMaxOpenConns(n)
 	}
 }
@@ -3,8 +3,11 @@ package gosqlrwdb
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -101,6 +104,135 @@ func TestNewPanicWhenNoReplica(t *testing.T) {
 	db.Close()
 }
 
+func TestTryNew(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	// validated even if DoValidateNew is false
+	tests := []struct {
+		master       *sql.DB
+		readreplicas []*sql.DB
+		expected     error
+	}{
+		{(*sql.DB)(nil), []*sql.DB{r1.db}, ErrNotProvidedPrimary},
+		{p.db, []*sql.DB{}, ErrNotProvidedReplicas},
+		{p.db, []*sql.DB{r1.db, nil}, ErrNotProvidedReplicas},
+	}
+	for _, test := range tests {
+		db, err := TryNew(test.master, test.readreplicas...)
+		if db != nil || !errors.Is(err, test.expected) {
+			t.Errorf("actual db: %v, err: %v, expected: %s", db, err, test.expected)
+		}
+	}
+
+	db, err := TryNew(p.db, r1.db)
+	if err != nil {
+		t.Fatalf("error %s when TryNew", err)
+	}
+	db.Close()
+}
+
+func TestNewContext(t *testing.T) {
+	DoValidateNew = true
+	defer func() { DoValidateNew = false }()
+
+	if _, err := NewContext(context.Background(), (*sql.DB)(nil)); err != ErrNotProvidedPrimary {
+		t.Errorf("actual err: %v, expected: %s", err, ErrNotProvidedPrimary)
+	}
+
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	errRefused := fmt.Errorf("connection refused")
+	p.mock.ExpectPing()
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillReturnError(errRefused)
+	db, err := NewContext(context.Background(), p.db, r1.db, r2.db)
+	if db != nil || !errors.Is(err, errRefused) || !strings.Contains(err.Error(), "replica-1: connection refused") {
+		t.Errorf("actual db: %v, err: %v, expected error of replica-1", db, err)
+	}
+
+	// pings are bounded by ctx
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if db, err = NewContext(ctx, p.db, r1.db, r2.db); db != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("actual db: %v, err: %v, expected: %s", db, err, context.DeadlineExceeded)
+	}
+
+	p.mock.ExpectPing()
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db, err = NewContext(context.Background(), p.db, r1.db, r2.db)
+	if err != nil {
+		t.Fatalf("error %s when NewContext", err)
+	}
+	defer db.Close()
+	if healthy, total := db.healthyReplicas(); healthy != 2 || total != 2 {
+		t.Errorf("actual healthy replicas: %d of %d, expected: 2 of 2", healthy, total)
+	}
+}
+
+func TestInitialHealthCheck(t *testing.T) {
+	InitialHealthCheckTimeout = 20 * time.Millisecond
+	defer func() { InitialHealthCheckTimeout = 0 }()
+
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillDelayFor(time.Second)
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	result := db.InitialHealthCheck()
+	if !result.Done || !result.TimedOut || result.Duration >= 500*time.Millisecond {
+		t.Errorf("actual result: %+v, expected done and timed out", result)
+	}
+	if _, ok := result.Unavailable[1]; !ok || len(result.Unavailable) != 1 {
+		t.Errorf("actual unavailable: %v, expected replica 1", result.Unavailable)
+	}
+	if healthy, total := db.healthyReplicas(); healthy != 1 || total != 2 {
+		t.Errorf("actual healthy replicas: %d of %d, expected: 1 of 2", healthy, total)
+	}
+
+	DisableReplicaAutoFailover = true
+	defer func() { DisableReplicaAutoFailover = false }()
+	db2 := New(p.db, r1.db, r2.db)
+	if result := db2.InitialHealthCheck(); result.Done {
+		t.Errorf("actual result: %+v, expected not done without health checks", result)
+	}
+}
+
 func TestNewDefaultPrimaryInMaintence(t *testing.T) {
 	var err error
 	p, err := newMydbMock()
@@ -118,8 +250,8 @@ func TestNewDefaultPrimaryInMaintence(t *testing.T) {
 
 	db := New(p.db, r1.db, r2.db)
 	defer db.Close()
-	if db.primaryInMaintence {
-		t.Errorf("actual primaryInMaintence: %t, expected false", db.primaryInMaintence)
+	if db.PrimaryInMaintenance() {
+		t.Errorf("actual primaryInMaintence: %t, expected false", db.PrimaryInMaintenance())
 	}
 }
 
@@ -141,8 +273,8 @@ func TestNewConfigurePrimaryInMaintence(t *testing.T) {
 	os.Setenv(EnvVarPrimaryInMaintenanceKey, "true")
 	db := New(p.db, r1.db, r2.db)
 	defer db.Close()
-	if !db.primaryInMaintence {
-		t.Errorf("actual primaryInMaintence: %t, expected true", db.primaryInMaintence)
+	if !db.PrimaryInMaintenance() {
+		t.Errorf("actual primaryInMaintence: %t, expected true", db.PrimaryInMaintenance())
 	}
 	os.Setenv(EnvVarPrimaryInMaintenanceKey, "")
 }
@@ -609,6 +741,39 @@ func TestQueryContext(t *testing.T) {
 	}
 }
 
+func TestQueryContextExactReplicaOrder(t *testing.T) {
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	r2.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	mrows := sqlmock.NewRows([]string{"column1", "column2"}).AddRow(1, "1")
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(mrows)
+	if _, err = db.QueryContext(WithExactReplicaOrder(context.Background()), fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when QueryContext", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestQueryContextInvalid(t *testing.T) {
 	var err error
 	p, err := newMydbMock()
@@ -680,6 +845,53 @@ func TestQueryContextUsePrimary(t *testing.T) {
 	}
 }
 
+func TestQueryContextUseReplica(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	if _, err = db.QueryContext(context.Background(), "SHOW TABLES"); err != ErrNotQuerySQL {
+		t.Errorf("error [%s] when QueryContext, expected [%s]", err, ErrNotQuerySQL)
+	}
+
+	r1.mock.ExpectQuery("SHOW TABLES").WillReturnRows(sqlmock.NewRows([]string{"table"}).AddRow("t1"))
+	rows, err := db.QueryContext(WithReplica(context.Background()), "SHOW TABLES")
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+
+	r1.mock.ExpectPrepare(`CALL read_orders\(\?\)`)
+	stmt, err := db.PrepareContext(WithReplica(context.Background()), "CALL read_orders(?)")
+	if err != nil {
+		t.Fatalf("error %s when PrepareContext", err)
+	}
+	stmt.Close()
+
+	// WithPrimary takes precedence
+	p.mock.ExpectQuery("SHOW TABLES").WillReturnRows(sqlmock.NewRows([]string{"table"}).AddRow("t1"))
+	rows, err = db.QueryContext(WithPrimary(WithReplica(context.Background())), "SHOW TABLES")
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestQueryRow1(t *testing.T) {
 	var err error
 	p, err := newMydbMock()
@@ -843,6 +1055,53 @@ func TestQueryRowContextUsePrimary(t *testing.T) {
 	}
 }
 
+func TestQueryRowContextCanceled(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	if err = db.SetWorkloadPolicy(&WorkloadPolicy{Capacity: 1, Shares: map[string]float64{"batch": 1}}); err != nil {
+		t.Fatalf("error %s when SetWorkloadPolicy", err)
+	}
+	batch := WithWorkload(context.Background(), "batch")
+	release, err := db.acquireWorkload(batch, r1.db)
+	if err != nil {
+		t.Fatalf("error %s when acquireWorkload", err)
+	}
+	defer release()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	blocked, cancel := context.WithTimeout(batch, 10*time.Millisecond)
+	defer cancel()
+	tests := []struct {
+		ctx      context.Context
+		expected error
+	}{
+		{canceled, context.Canceled},
+		{WithPrimary(canceled), context.Canceled},
+		{blocked, context.DeadlineExceeded},
+	}
+	for i, test := range tests {
+		var col1 int
+		if err := db.QueryRowContext(test.ctx, fmt.Sprintf(selectQueryTmpl, "*")).Scan(&col1); err != test.expected {
+			t.Errorf("%d: actual err = %v, expected = %s", i, err, test.expected)
+		}
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestBegin1(t *testing.T) {
 	var err error
 	p, err := newMydbMock()
@@ -1026,6 +1285,38 @@ func TestClose(t *testing.T) {
 	}
 }
 
+func TestOnClose(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+
+	var calls []int
+	db.OnClose(func() { calls = append(calls, 1) })
+	db.OnClose(func() { calls = append(calls, 2) })
+
+	p.mock.ExpectClose()
+	r1.mock.ExpectClose()
+	db.Close()
+	if !reflect.DeepEqual(calls, []int{2, 1}) {
+		t.Errorf("actual calls: %v, expected: [2 1]", calls)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	db.OnClose(func() { calls = append(calls, 3) })
+	if !reflect.DeepEqual(calls, []int{2, 1, 3}) {
+		t.Errorf("actual calls: %v, expected: [2 1 3] when registered after Close", calls)
+	}
+}
+
 func TestExec(t *testing.T) {
 	var err error
 	p, err := newMydbMock()
@@ -0,0 +1,22 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// NamedArgs converts m to `sql.NamedArg` args sorted by name,
+// to be passed to `Query()`, `Exec()` etc. as `db.Query(query, mydb.NamedArgs(m)...)`
+func NamedArgs(m map[string]interface{}) []interface{} {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = sql.Named(name, m[name])
+	}
+	return args
+}
@@ -0,0 +1,56 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNamedArgs(t *testing.T) {
+	actual := NamedArgs(map[string]interface{}{"name": "a", "id": 1})
+	expected := []interface{}{sql.Named("id", 1), sql.Named("name", "a")}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual = %v, expected = %v", actual, expected)
+	}
+	if actual := NamedArgs(nil); len(actual) != 0 {
+		t.Errorf("actual = %v, expected = []", actual)
+	}
+}
+
+func TestQueryContextNamedArgs(t *testing.T) {
+	DoValidateParamCount = true
+	defer func() { DoValidateParamCount = false }()
+
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	query := "select * from mytable where id = :id"
+	r1.mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(sql.Named("id", 1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rows, err := db.QueryContext(context.Background(), query, NamedArgs(map[string]interface{}{"id": 1})...)
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+
+	_, err = db.QueryContext(context.Background(), query, NamedArgs(map[string]interface{}{"ID": 1})...)
+	if _, ok := err.(*ParamCountError); !ok {
+		t.Errorf("actual err = %v, expected *ParamCountError", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,79 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// NoRowsError is `sql.ErrNoRows` with the target the read was routed to, returned by `Scan()` of `Row`
+// if enabled by `SetWrapNoRows()`, so that "not found on a lagging read replica" is told from
+// "not found on primary DB" in logs. `errors.Is(err, sql.ErrNoRows)` stays true, see `IsNoRows()`.
+type NoRowsError struct {
+	// Target is the DB the read was routed to
+	Target TargetInfo
+}
+
+func (e *NoRowsError) Error() string {
+	return fmt.Sprintf("%s (on %s)", sql.ErrNoRows, e.Target.Name)
+}
+
+// Unwrap returns `sql.ErrNoRows`
+func (e *NoRowsError) Unwrap() error {
+	return sql.ErrNoRows
+}
+
+// IsNoRows returns true if err is or wraps `sql.ErrNoRows`, including `*NoRowsError`
+func IsNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+// SetWrapNoRows sets whether `Scan()` of `Row` returns `*NoRowsError` instead of `sql.ErrNoRows`.
+// It is disabled by default, for callers comparing errors by `==`.
+func (db *DB) SetWrapNoRows(enabled bool) {
+	db.configMutex.Lock()
+	db.wrapNoRows = enabled
+	db.configMutex.Unlock()
+}
+
+// wrapsNoRows returns true if `sql.ErrNoRows` is wrapped by `*NoRowsError`
+func (db *DB) wrapsNoRows() bool {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.wrapNoRows
+}
+
+// Row wraps `*sql.Row` returned by `QueryRowTarget()`, exposing the target it was routed to
+type Row struct {
+	*sql.Row
+
+	db     *DB
+	target *sql.DB
+}
+
+// Target returns the DB the query was routed to, and false if it was not routed, e.g. failed by its context
+func (r *Row) Target() (TargetInfo, bool) {
+	if r.target == nil {
+		return TargetInfo{}, false
+	}
+	return r.db.targetInfo(r.target), true
+}
+
+// Scan is `sql.Row.Scan()` returning `*NoRowsError` if enabled by `SetWrapNoRows()`
+func (r *Row) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	if err == sql.ErrNoRows && r.target != nil && r.db.wrapsNoRows() {
+		return &NoRowsError{Target: r.db.targetInfo(r.target)}
+	}
+	return err
+}
+
+// QueryRowTarget is `QueryRowContext()` returning `*Row`
+func (db *DB) QueryRowTarget(ctx context.Context, query string, args ...interface{}) *Row {
+	if cluster, err := db.partitionCluster(ctx, query); err == nil && cluster != nil {
+		return cluster.QueryRowTarget(ctx, query, args...)
+	}
+	row, tgtdb := db.queryRowContext(ctx, query, args...)
+	return &Row{Row: row, db: db, target: tgtdb}
+}
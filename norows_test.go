@@ -0,0 +1,93 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIsNoRows(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{sql.ErrNoRows, true},
+		{&NoRowsError{Target: TargetInfo{Role: RoleReplica, Name: "replica-0"}}, true},
+		{fmt.Errorf("find user: %w", sql.ErrNoRows), true},
+		{nil, false},
+		{sql.ErrConnDone, false},
+	}
+	for i, test := range tests {
+		if actual := IsNoRows(test.err); actual != test.expected {
+			t.Errorf("actual: %t, expected: %t of test %d", actual, test.expected, i)
+		}
+	}
+}
+
+func TestQueryRowTarget(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+	selectQuery := fmt.Sprintf(selectQueryTmpl, "id")
+
+	// sql.ErrNoRows as it is by default
+	r0.mock.ExpectQuery(selectQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	var id int
+	row := db.QueryRowTarget(context.Background(), selectQuery)
+	if err := row.Scan(&id); err != sql.ErrNoRows {
+		t.Errorf("actual err: %v, expected: %s", err, sql.ErrNoRows)
+	}
+	if target, ok := row.Target(); !ok || target.Name != "replica-0" {
+		t.Errorf("actual target: %+v, expected: replica-0", target)
+	}
+
+	db.SetWrapNoRows(true)
+	r0.mock.ExpectQuery(selectQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	p.mock.ExpectQuery(selectQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	p.mock.ExpectQuery(selectQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	tests := []struct {
+		ctx      context.Context
+		expected string
+	}{
+		{context.Background(), "replica-0"},
+		{WithPrimary(context.Background()), "primary"},
+	}
+	for _, test := range tests {
+		err := db.QueryRowTarget(test.ctx, selectQuery).Scan(&id)
+		var noRows *NoRowsError
+		if !errors.As(err, &noRows) || noRows.Target.Name != test.expected || !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("actual err: %v, expected: no rows on %s", err, test.expected)
+		}
+	}
+	if err := db.QueryRowTarget(WithPrimary(context.Background()), selectQuery).Scan(&id); err != nil || id != 1 {
+		t.Errorf("actual id: %d, err: %v, expected: 1", id, err)
+	}
+
+	// not routed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	row = db.QueryRowTarget(ctx, selectQuery)
+	if err := row.Scan(&id); !errors.Is(err, context.Canceled) {
+		t.Errorf("actual err: %v, expected: %s", err, context.Canceled)
+	}
+	if _, ok := row.Target(); ok {
+		t.Errorf("actual routed, expected not routed")
+	}
+
+	for _, m := range []*mydbMock{p, r0} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Kinds of routing overrides, the keys of `RoutingMetrics.Overrides` and `OverrideRecord.Kind`
+const (
+	// OverrideForcePrimary is `RoutingDirective.ForcePrimary`, e.g. by `WithPrimary()`
+	OverrideForcePrimary = "force_primary"
+
+	// OverrideForceReplica is `RoutingDirective.ForceReplica`, e.g. by `WithReplica()`
+	OverrideForceReplica = "force_replica"
+
+	// OverrideExactReplicaOrder is `RoutingDirective.ExactReplicaOrder`, e.g. by `WithExactReplicaOrder()`
+	OverrideExactReplicaOrder = "exact_replica_order"
+
+	// OverrideExcludeReplicas is `RoutingDirective.ExcludeReplicas`, e.g. by `WithExcludeReplicas()`
+	OverrideExcludeReplicas = "exclude_replicas"
+
+	// OverrideGroup is `RoutingDirective.Group`
+	OverrideGroup = "group"
+
+	// OverrideMaxStaleness is `RoutingDirective.MaxStaleness`
+	OverrideMaxStaleness = "max_staleness"
+
+	// OverridePinnedTable is a query routed to primary DB as it reads a table set by `SetPrimaryTables()`
+	OverridePinnedTable = "pinned_table"
+
+	// OverrideReplicaReadsOff is a read routed to primary DB by the kill switch `FlagReplicaReads`
+	OverrideReplicaReadsOff = "replica_reads_off"
+
+	// OverridePrimaryFallbackOff is a read kept from falling back to primary DB by the kill switch `FlagPrimaryFallback`
+	OverridePrimaryFallbackOff = "primary_fallback_off"
+)
+
+// OverrideRecord is a use of a routing override by a statement
+type OverrideRecord struct {
+	// Kind is the kind of the override, see `Override*`
+	Kind string
+
+	// Method & StatementID are of the statement, see `StatementInfo`. Method is empty for kill switches.
+	Method      string
+	StatementID string
+
+	// Caller is the call site of the statement, `function file:line` of the first caller outside this package,
+	// empty unless `OverrideAudit.CaptureCaller`
+	Caller string
+}
+
+// String returns the record in one line, e.g. `force_primary by QueryContext (id: 1a2b) at main.listOrders /app/main.go:42`
+func (r OverrideRecord) String() string {
+	s := r.Kind
+	if r.Method != "" {
+		s += " by " + r.Method
+	}
+	if r.StatementID != "" {
+		s += " (id: " + r.StatementID + ")"
+	}
+	if r.Caller != "" {
+		s += " at " + r.Caller
+	}
+	return s
+}
+
+// OverrideAudit logs every use of routing overrides, so that teams can track and burn down reads forced to
+// primary DB. Uses are counted in `RoutingMetrics.Overrides` whether audited or not.
+type OverrideAudit struct {
+	// Log is called with each record. If nil, the record is printed by debug output of `DebugRouting` level
+	Log func(OverrideRecord)
+
+	// CaptureCaller captures `OverrideRecord.Caller`, as a debug option since it walks the stack on each use
+	CaptureCaller bool
+}
+
+// SetOverrideAudit sets the OverrideAudit of routing overrides. Passing nil stops logging, which is the default.
+func (db *DB) SetOverrideAudit(a *OverrideAudit) {
+	db.configMutex.Lock()
+	db.overrideAudit = a
+	db.configMutex.Unlock()
+}
+
+// routingOverrideAudit returns current OverrideAudit, nil if not set
+func (db *DB) routingOverrideAudit() *OverrideAudit {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.overrideAudit
+}
+
+// auditOverrides counts and logs routing overrides of RoutingDirective in ctx of the statement of info
+func (db *DB) auditOverrides(ctx context.Context, info StatementInfo) {
+	d := DirectiveFromContext(ctx)
+	var kinds []string
+	if d.pinned {
+		kinds = append(kinds, OverridePinnedTable)
+	} else if d.ForcePrimary {
+		kinds = append(kinds, OverrideForcePrimary)
+	}
+	if d.ForceReplica {
+		kinds = append(kinds, OverrideForceReplica)
+	}
+	if d.ExactReplicaOrder {
+		kinds = append(kinds, OverrideExactReplicaOrder)
+	}
+	if len(d.ExcludeReplicas) > 0 {
+		kinds = append(kinds, OverrideExcludeReplicas)
+	}
+	if d.Group != "" {
+		kinds = append(kinds, OverrideGroup)
+	}
+	if d.MaxStaleness > 0 {
+		kinds = append(kinds, OverrideMaxStaleness)
+	}
+	if len(kinds) == 0 {
+		return
+	}
+	audit := db.routingOverrideAudit()
+	var caller string
+	if audit != nil && audit.CaptureCaller {
+		caller = callSite()
+	}
+	for _, kind := range kinds {
+		db.recordOverride(audit, OverrideRecord{Kind: kind, Method: info.Method, StatementID: info.ID, Caller: caller})
+	}
+}
+
+// auditOverride counts and logs the routing override of kind, e.g. a kill switch, used by the statement of ctx
+func (db *DB) auditOverride(ctx context.Context, kind string) {
+	audit := db.routingOverrideAudit()
+	r := OverrideRecord{Kind: kind, StatementID: StatementIDFromContext(ctx)}
+	if audit != nil && audit.CaptureCaller {
+		r.Caller = callSite()
+	}
+	db.recordOverride(audit, r)
+}
+
+// recordOverride counts r and logs it by audit if not nil
+func (db *DB) recordOverride(audit *OverrideAudit, r OverrideRecord) {
+	db.metrics.countOverride(r.Kind)
+	if audit == nil {
+		return
+	}
+	if audit.Log != nil {
+		audit.Log(r)
+		return
+	}
+	db.debugf(DebugRouting, "[override] %s", r)
+}
+
+// packagePath is the import path of this package, to tell callers outside it
+var packagePath = reflect.TypeOf((*DB)(nil)).Elem().PkgPath()
+
+// callSite returns `function file:line` of the first caller outside this package (or in its tests), "" if none
+func callSite() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && (!strings.HasPrefix(f.Function, packagePath+".") || strings.HasSuffix(f.File, "_test.go")) {
+			return fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
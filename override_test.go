@@ -0,0 +1,88 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestOverrideAudit(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	db.SetPrimaryTables("sessions")
+
+	var records []OverrideRecord
+	db.SetOverrideAudit(&OverrideAudit{Log: func(r OverrideRecord) {
+		records = append(records, r)
+	}, CaptureCaller: true})
+
+	tests := []struct {
+		ctx      context.Context
+		query    string
+		flags    flagsMock
+		primary  bool
+		expected []string
+	}{
+		{context.Background(), fmt.Sprintf(selectQueryTmpl, "*"), nil, false, nil},
+		{WithPrimary(context.Background()), fmt.Sprintf(selectQueryTmpl, "*"), nil, true, []string{OverrideForcePrimary}},
+		{context.Background(), "select * from sessions", nil, true, []string{OverridePinnedTable}},
+		{WithExcludeReplicas(WithExactReplicaOrder(context.Background()), "replica-9"), fmt.Sprintf(selectQueryTmpl, "*"), nil, false,
+			[]string{OverrideExactReplicaOrder, OverrideExcludeReplicas}},
+		{context.Background(), fmt.Sprintf(selectQueryTmpl, "*"), flagsMock{FlagReplicaReads: false}, true, []string{OverrideReplicaReadsOff}},
+	}
+	for i, test := range tests {
+		records = nil
+		db.SetFlagProvider(test.flags)
+		if test.primary {
+			p.mock.ExpectQuery("select (.+)").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+		} else {
+			r1.mock.ExpectQuery("select (.+)").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+		}
+		rows, err := db.QueryContext(test.ctx, test.query)
+		if err != nil {
+			t.Fatalf("error %s when QueryContext of test %d", err, i)
+		}
+		rows.Close()
+
+		actual := make([]string, 0, len(records))
+		for _, r := range records {
+			actual = append(actual, r.Kind)
+			if r.StatementID == "" || !strings.Contains(r.Caller, "TestOverrideAudit") || !strings.Contains(r.Caller, "override_test.go") {
+				t.Errorf("actual record: %+v, expected statement ID and caller of test %d", r, i)
+			}
+		}
+		if len(actual) != len(test.expected) || (len(actual) > 0 && !reflect.DeepEqual(actual, test.expected)) {
+			t.Errorf("actual overrides: %v, expected: %v of test %d", actual, test.expected, i)
+		}
+	}
+
+	expected := map[string]uint64{
+		OverrideForcePrimary:      1,
+		OverridePinnedTable:       1,
+		OverrideExactReplicaOrder: 1,
+		OverrideExcludeReplicas:   1,
+		OverrideReplicaReadsOff:   1,
+	}
+	if actual := db.Metrics().Overrides; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual overrides: %v, expected: %v", actual, expected)
+	}
+
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,103 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// partitionHintPrefix is the prefix of the body of a leading SQL comment hinting the partition, e.g. `/* partition=42 */`
+const partitionHintPrefix = "partition="
+
+// PartitionRouter routes statements to clusters by partition (shard), so that DB can sit in front of
+// coordinator + worker topologies such as Citus or Vitess: DB the router is set to is the coordinator
+// (or the default cluster), and each cluster of workers is another DB with its own primary DB and read replicas.
+type PartitionRouter interface {
+	// Route returns DB of the cluster of a statement of query, or nil to run it on DB the router is set to.
+	// partition is set by `WithPartition()` in ctx, or by a leading `/* partition=<key> */` comment of query,
+	// empty if neither; it may be ignored to route by query itself (e.g. by a distribution column).
+	Route(ctx context.Context, partition, query string) (*DB, error)
+}
+
+// PartitionRouterFunc is a PartitionRouter of a function
+type PartitionRouterFunc func(ctx context.Context, partition, query string) (*DB, error)
+
+// Route calls f
+func (f PartitionRouterFunc) Route(ctx context.Context, partition, query string) (*DB, error) {
+	return f(ctx, partition, query)
+}
+
+// PartitionMap is a PartitionRouter of fixed clusters by partition.
+// Statements without partition run on DB the router is set to,
+// and ones of unknown partitions fail with an error wrapping `ErrUnknownPartition`.
+type PartitionMap map[string]*DB
+
+// Route returns DB of partition
+func (m PartitionMap) Route(ctx context.Context, partition, query string) (*DB, error) {
+	if partition == "" {
+		return nil, nil
+	}
+	if cluster, ok := m[partition]; ok {
+		return cluster, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownPartition, partition)
+}
+
+// SetPartitionRouter sets the PartitionRouter of statements of below methods, replacing the current one:
+// `Query()` / `QueryContext()` / `QueryRow()` / `QueryRowContext()` / `QueryRows()` / `QueryRowsContext()` /
+// `Exec()` / `ExecContext()` / `Prepare()` / `PrepareContext()` / `Begin()` / `BeginTx()` / `RunInTx()`.
+// Statements routed to another cluster are run by the same method of its DB, so that they are counted, hooked and
+// routed between its primary DB and read replicas there. Transactions are routed by `WithPartition()` only.
+// Passing nil runs all statements on db, which is the default.
+func (db *DB) SetPartitionRouter(r PartitionRouter) {
+	db.configMutex.Lock()
+	db.partitionRouter = r
+	db.configMutex.Unlock()
+}
+
+// routingPartitionRouter returns current PartitionRouter, nil if not set
+func (db *DB) routingPartitionRouter() PartitionRouter {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.partitionRouter
+}
+
+// partitionCluster returns DB of the cluster of the statement of query with ctx by PartitionRouter,
+// nil if it runs on db
+func (db *DB) partitionCluster(ctx context.Context, query string) (*DB, error) {
+	r := db.routingPartitionRouter()
+	if r == nil {
+		return nil, nil
+	}
+	partition := PartitionFromContext(ctx)
+	if partition == "" {
+		partition = PartitionHint(query)
+	}
+	cluster, err := r.Route(ctx, partition, query)
+	if err != nil || cluster == db {
+		return nil, err
+	}
+	if cluster != nil {
+		db.debugf(DebugRouting, "[partitionCluster] partition %q routed to another cluster", partition)
+	}
+	return cluster, nil
+}
+
+// PartitionHint returns the partition hinted by a leading `/* partition=<key> */` comment of query, "" if none
+func PartitionHint(query string) string {
+	i := 0
+	for {
+		for i < len(query) && isSpace(query[i]) {
+			i++
+		}
+		if !strings.HasPrefix(query[i:], "/*") || isExecutableComment(query, i) {
+			return ""
+		}
+		end := skipBlockComment(query, i+2)
+		body := strings.TrimSpace(strings.TrimSuffix(query[i+2:end], "*/"))
+		if strings.HasPrefix(body, partitionHintPrefix) {
+			return strings.TrimSpace(body[len(partitionHintPrefix):])
+		}
+		i = end
+	}
+}
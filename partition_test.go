@@ -0,0 +1,97 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPartitionHint(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT 1", ""},
+		{"/* partition=42 */ SELECT 1", "42"},
+		{" /* app=orders */ /*partition= eu-1 */ SELECT 1", "eu-1"},
+		{"SELECT 1 /* partition=42 */", ""},
+		{"/*! partition=42 */ SELECT 1", ""},
+		{"/* partition=42", "42"},
+	}
+
+	for _, test := range tests {
+		if actual := PartitionHint(test.query); actual != test.expected {
+			t.Errorf("actual = %q, expected = %q of query %q", actual, test.expected, test.query)
+		}
+	}
+}
+
+func TestSetPartitionRouter(t *testing.T) {
+	coordinator, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	cr1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	worker, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	wr1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(coordinator.db, cr1.db)
+	defer db.Close()
+	workers := New(worker.db, wr1.db)
+	defer workers.Close()
+	db.SetPartitionRouter(PartitionMap{"1": workers})
+
+	cr1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	wr1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	wr1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	worker.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "(.+)")).WillReturnResult(sqlmock.NewResult(0, 1))
+	worker.mock.ExpectBegin()
+	worker.mock.ExpectCommit()
+
+	tests := []struct {
+		ctx   context.Context
+		query string
+	}{
+		{context.Background(), fmt.Sprintf(selectQueryTmpl, "*")},
+		{WithPartition(context.Background(), "1"), fmt.Sprintf(selectQueryTmpl, "*")},
+		{context.Background(), "/* partition=1 */ " + fmt.Sprintf(selectQueryTmpl, "*")},
+	}
+	for i, test := range tests {
+		rows, err := db.QueryContext(test.ctx, test.query)
+		if err != nil {
+			t.Fatalf("error %s when QueryContext of test %d", err, i)
+		}
+		rows.Close()
+	}
+	if _, err = db.Exec("/* partition=1 */ " + fmt.Sprintf(deleteQuueryTmpl, "where column1 = 1")); err != nil {
+		t.Errorf("error %s when Exec", err)
+	}
+	if err = db.RunInTx(WithPartition(context.Background(), "1"), nil, func(ctx context.Context, tx *Tx) error {
+		return nil
+	}); err != nil {
+		t.Errorf("error %s when RunInTx", err)
+	}
+	if _, err = db.QueryContext(WithPartition(context.Background(), "2"), fmt.Sprintf(selectQueryTmpl, "*")); !errors.Is(err, ErrUnknownPartition) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrUnknownPartition)
+	}
+
+	if actual := workers.Metrics(); actual.ReadsReplica[0] != 2 || actual.Writes != 2 {
+		t.Errorf("actual metrics of workers: %+v, expected 2 reads and 2 writes", actual)
+	}
+	for _, m := range []*mydbMock{coordinator, cr1, worker, wr1} {
+		if err = m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// UnavailableStore persists names (see `TargetInfo.Name`) of unavailable read replicas with their expiry across restarts
+type UnavailableStore interface {
+	// Load returns names of read replicas unavailable until each time
+	Load() (map[string]time.Time, error)
+
+	// Save replaces names of read replicas unavailable until each time
+	Save(unavailable map[string]time.Time) error
+}
+
+// FileUnavailableStore is an UnavailableStore of a JSON file at Path, which is replaced atomically on save.
+// The file not existing means no read replica is unavailable.
+type FileUnavailableStore struct {
+	Path string
+}
+
+// Load reads the file
+func (s FileUnavailableStore) Load() (map[string]time.Time, error) {
+	b, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return map[string]time.Time{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	unavailable := map[string]time.Time{}
+	if err := json.Unmarshal(b, &unavailable); err != nil {
+		return nil, err
+	}
+	return unavailable, nil
+}
+
+// Save writes a temporary file in the same directory and renames it to the file
+func (s FileUnavailableStore) Save(unavailable map[string]time.Time) error {
+	b, err := json.Marshal(unavailable)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.Path)
+}
+
+// unavailablePersister saves unavailable read replicas to an UnavailableStore
+type unavailablePersister struct {
+	store   UnavailableStore
+	ttl     time.Duration
+	mutex   sync.Mutex
+	saved   map[string]struct{}
+	savedAt time.Time
+}
+
+// SetUnavailableStore restores unavailable read replicas from s and keeps saving them to s after each heartbeat,
+// so that a restarting process does not route to a read replica known to be unavailable before the first heartbeat.
+// Each read replica is saved as unavailable until ttl later, refreshed while it stays unavailable.
+// Restored read replicas are unavailable until a heartbeat finds them available, emitting `EventReplicaDown`
+// with `ErrRestoredUnavailable`; expired entries and unknown names are ignored. Passing nil stops saving.
+// It returns the error of loading s, without changing anything.
+func (db *DB) SetUnavailableStore(s UnavailableStore, ttl time.Duration) error {
+	if s == nil {
+		db.configMutex.Lock()
+		db.unavailableStore = nil
+		db.configMutex.Unlock()
+		return nil
+	}
+	unavailable, err := s.Load()
+	if err != nil {
+		db.debugf(DebugError, "[SetUnavailableStore] err: %s", err)
+		return err
+	}
+
+	now := time.Now()
+	_, targets := db.Targets()
+	var events []Event
+	db.countMutex.Lock()
+	restored := make(map[*sql.DB]struct{}, len(db.unavailableReplicas)+len(unavailable))
+	for r := range db.unavailableReplicas {
+		restored[r] = empty
+	}
+	for i, r := range db.readreplicas {
+		until, ok := unavailable[targets[i].Name]
+		if _, was := restored[r]; !ok || was || !until.After(now) {
+			continue
+		}
+		if _, drained := db.drainedReplicas[r]; drained {
+			continue
+		}
+		restored[r] = empty
+		db.replicaStates[r].downSince = now
+		events = append(events, Event{Type: EventReplicaDown, Target: targets[i], Err: ErrRestoredUnavailable})
+	}
+	db.unavailableReplicas = restored
+	db.countMutex.Unlock()
+
+	db.configMutex.Lock()
+	db.unavailableStore = &unavailablePersister{store: s, ttl: ttl}
+	db.configMutex.Unlock()
+	for _, e := range events {
+		db.emit(e)
+	}
+	db.updateQuorum()
+	return nil
+}
+
+// saveUnavailable saves unavailable read replicas at now if changed since the last save,
+// or if the last save is older than half of the ttl
+func (db *DB) saveUnavailable(now time.Time) {
+	db.configMutex.RLock()
+	p := db.unavailableStore
+	targets := db.replicaTargets
+	db.configMutex.RUnlock()
+	if p == nil {
+		return
+	}
+
+	names := map[string]struct{}{}
+	db.countMutex.RLock()
+	for r := range db.unavailableReplicas {
+		names[targets[db.replicaStates[r].index].Name] = empty
+	}
+	db.countMutex.RUnlock()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if sameNames(names, p.saved) && now.Sub(p.savedAt) < p.ttl/2 {
+		return
+	}
+	unavailable := make(map[string]time.Time, len(names))
+	for name := range names {
+		unavailable[name] = now.Add(p.ttl)
+	}
+	if err := p.store.Save(unavailable); err != nil {
+		db.debugf(DebugError, "[saveUnavailable] err: %s", err)
+		return
+	}
+	p.saved, p.savedAt = names, now
+}
+
+func sameNames(a, b map[string]struct{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
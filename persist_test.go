@@ -0,0 +1,119 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type memoryUnavailableStore struct {
+	unavailable map[string]time.Time
+	saves       int
+}
+
+func (s *memoryUnavailableStore) Load() (map[string]time.Time, error) {
+	return s.unavailable, nil
+}
+
+func (s *memoryUnavailableStore) Save(unavailable map[string]time.Time) error {
+	s.unavailable = unavailable
+	s.saves++
+	return nil
+}
+
+func TestSetUnavailableStore(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	var events []Event
+	db.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+	now := time.Now()
+	store := &memoryUnavailableStore{unavailable: map[string]time.Time{
+		"replica-0": now.Add(-time.Minute),
+		"replica-1": now.Add(time.Minute),
+		"unknown":   now.Add(time.Minute),
+	}}
+	if err := db.SetUnavailableStore(store, time.Hour); err != nil {
+		t.Fatalf("error %s when SetUnavailableStore", err)
+	}
+	if healthy, total := db.healthyReplicas(); healthy != 1 || total != 2 {
+		t.Errorf("actual healthy replicas = %d / %d, expected = 1 / 2", healthy, total)
+	}
+	if len(events) != 1 || events[0].Type != EventReplicaDown || events[0].Target.Name != "replica-1" || events[0].Err != ErrRestoredUnavailable {
+		t.Errorf("actual events = %+v, expected %s of replica-1", events, EventReplicaDown)
+	}
+
+	// the heartbeat finds replica-1 available
+	db.refreshHealth()
+	if healthy, _ := db.healthyReplicas(); healthy != 2 {
+		t.Errorf("actual healthy replicas = %d, expected = 2", healthy)
+	}
+	if store.saves != 1 || len(store.unavailable) != 0 {
+		t.Errorf("actual saves = %d, unavailable = %v, expected saved once with none", store.saves, store.unavailable)
+	}
+
+	db.countMutex.Lock()
+	db.unavailableReplicas = map[*sql.DB]struct{}{r1.db: empty}
+	db.countMutex.Unlock()
+	for _, at := range []time.Time{now, now.Add(time.Minute), now.Add(time.Hour)} {
+		db.saveUnavailable(at)
+	}
+	if store.saves != 3 || !store.unavailable["replica-0"].Equal(now.Add(2*time.Hour)) {
+		t.Errorf("actual saves = %d, unavailable = %v, expected saved on change and refreshed", store.saves, store.unavailable)
+	}
+
+	db.SetUnavailableStore(nil, 0)
+	db.saveUnavailable(now.Add(24 * time.Hour))
+	if store.saves != 3 {
+		t.Errorf("actual saves = %d, expected = 3 after removing store", store.saves)
+	}
+}
+
+func TestFileUnavailableStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosqlrwdb")
+	if err != nil {
+		t.Fatalf("error %s when creating temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+	store := FileUnavailableStore{Path: filepath.Join(dir, "unavailable.json")}
+
+	unavailable, err := store.Load()
+	if err != nil || len(unavailable) != 0 {
+		t.Errorf("actual = %v, %v, expected empty without file", unavailable, err)
+	}
+	expected := map[string]time.Time{"replica-1": time.Now().Add(time.Minute).Round(0).UTC()}
+	if err := store.Save(expected); err != nil {
+		t.Fatalf("error %s when Save", err)
+	}
+	if unavailable, err = store.Load(); err != nil || !reflect.DeepEqual(unavailable, expected) {
+		t.Errorf("actual = %v, %v, expected = %v", unavailable, err, expected)
+	}
+
+	if err := ioutil.WriteFile(store.Path, []byte("{"), 0600); err != nil {
+		t.Fatalf("error %s when writing file", err)
+	}
+	var syntaxErr *json.SyntaxError
+	if _, err := store.Load(); !errors.As(err, &syntaxErr) {
+		t.Errorf("actual err = %v, expected *json.SyntaxError", err)
+	}
+}
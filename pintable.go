@@ -0,0 +1,151 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"strings"
+)
+
+// SetPrimaryTables sets tables whose reads are always routed to primary DB, as if by `WithPrimary()`,
+// e.g. tables which can never tolerate stale reads such as `sessions` or `payments_ledger`.
+// Table names are taken from `FROM` and `JOIN` clauses of read statements, including subqueries and CTEs.
+// Names are matched case-insensitively, either as written (e.g. `billing.payments_ledger`)
+// or by the last part of a schema-qualified name (e.g. `payments_ledger`).
+// Like `WithPrimary()`, pinned reads are routed to a read replica while primary DB is in maintenance mode.
+// Calling it without tables unpins all tables.
+func (db *DB) SetPrimaryTables(tables ...string) {
+	var pinned map[string]struct{}
+	if len(tables) > 0 {
+		pinned = make(map[string]struct{}, len(tables))
+		for _, t := range tables {
+			pinned[toLowerASCII(t)] = empty
+		}
+	}
+	db.configMutex.Lock()
+	db.primaryTables = pinned
+	db.configMutex.Unlock()
+}
+
+// pinnedToPrimary returns true if query reads any table set by `SetPrimaryTables()`
+func (db *DB) pinnedToPrimary(query string) bool {
+	db.configMutex.RLock()
+	pinned := db.primaryTables
+	db.configMutex.RUnlock()
+	if len(pinned) == 0 {
+		return false
+	}
+	for _, table := range queryTables(query) {
+		if _, ok := pinned[table]; ok {
+			return true
+		}
+		if i := strings.LastIndexByte(table, '.'); i >= 0 {
+			if _, ok := pinned[table[i+1:]]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withPinnedTables returns ctx of `WithPrimary()` if query reads any table set by `SetPrimaryTables()`,
+// otherwise ctx as it is
+func (db *DB) withPinnedTables(ctx context.Context, query string) context.Context {
+	if UsePrimaryFromContext(ctx) || !db.pinnedToPrimary(query) {
+		return ctx
+	}
+	db.debugf(DebugRouting, "[withPinnedTables] query pinned to primary: %s", query)
+	return withDirective(ctx, func(d *RoutingDirective) {
+		d.ForcePrimary = true
+		d.pinned = true
+	})
+}
+
+// queryTables returns lower-cased names of tables in `FROM` and `JOIN` clauses of query,
+// schema-qualified names joined by `.`
+func queryTables(query string) []string {
+	tokens := identifierTokens(query)
+	var tables []string
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] != "from" && tokens[i] != "join" {
+			continue
+		}
+		// `FROM a x, b AS y` lists tables separated by commas
+		for i+1 < len(tokens) && isIdentifierToken(tokens[i+1]) {
+			name := tokens[i+1]
+			i++
+			for i+2 < len(tokens) && tokens[i+1] == "." && isIdentifierToken(tokens[i+2]) {
+				name += "." + tokens[i+2]
+				i += 2
+			}
+			tables = append(tables, name)
+			if i+1 < len(tokens) && tokens[i+1] == "as" {
+				i++
+			}
+			if i+2 < len(tokens) && isIdentifierToken(tokens[i+1]) && tokens[i+2] == "," {
+				i++
+			}
+			if i+1 >= len(tokens) || tokens[i+1] != "," {
+				break
+			}
+			i++
+		}
+	}
+	return tables
+}
+
+// identifierTokens returns lower-cased words of query outside comments and literals, with quoted identifiers unquoted,
+// and `.`, `,`, `(` and `)` as tokens of their own
+func identifierTokens(query string) []string {
+	var tokens []string
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			i = skipLineComment(query, i+2)
+		case c == '/' && i+1 < len(query) && query[i+1] == '*' && !isExecutableComment(query, i):
+			i = skipBlockComment(query, i+2)
+		case c == '"' || c == '`':
+			end := skipQuoted(query, i+1, c)
+			if end > len(query) {
+				end = len(query)
+			}
+			name := query[i+1 : end]
+			if len(name) > 0 && name[len(name)-1] == c {
+				name = name[:len(name)-1]
+			}
+			tokens = append(tokens, toLowerASCII(name))
+			i = end
+		case c == '[':
+			// SQL Server quoted identifier
+			end := strings.IndexByte(query[i:], ']')
+			if end < 0 {
+				return tokens
+			}
+			tokens = append(tokens, toLowerASCII(query[i+1:i+end]))
+			i += end + 1
+		case c == '\'':
+			i = skipQuoted(query, i+1, c)
+		case c == '$':
+			i = skipDollarQuoted(query, i)
+		case (c == ':' || c == '@') && isNamedPlaceholder(query, i):
+			i = skipNamedPlaceholder(query, i)
+		case isWordByte(c):
+			start := i
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			tokens = append(tokens, toLowerASCII(query[start:i]))
+		case c == '.' || c == ',' || c == '(' || c == ')':
+			tokens = append(tokens, query[i:i+1])
+			i++
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// isIdentifierToken returns true if token of `identifierTokens()` is a word, not punctuation
+func isIdentifierToken(token string) bool {
+	return token != "." && token != "," && token != "(" && token != ")"
+}
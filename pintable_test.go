@@ -0,0 +1,95 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestQueryTables(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"SELECT * FROM users", []string{"users"}},
+		{"select * from users u, orders as o where u.id = o.user_id", []string{"users", "orders"}},
+		{"SELECT * FROM public.Sessions s JOIN \"Payments_Ledger\" p ON s.id = p.sid", []string{"public.sessions", "payments_ledger"}},
+		{"SELECT * FROM `db`.`t1` LEFT JOIN [dbo].[t2] ON 1 = 1", []string{"db.t1", "dbo.t2"}},
+		{"SELECT * FROM (SELECT id FROM sessions) x", []string{"sessions"}},
+		{"WITH s AS (SELECT * FROM sessions) SELECT * FROM s", []string{"sessions", "s"}},
+		{"SELECT 'from sessions' FROM users -- join sessions", []string{"users"}},
+		{"SELECT 1", nil},
+	}
+	for _, test := range tests {
+		if actual := queryTables(test.query); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("actual tables = %v, expected = %v for %s", actual, test.expected, test.query)
+		}
+	}
+}
+
+func TestSetPrimaryTables(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	db.SetPrimaryTables("Sessions", "billing.payments_ledger")
+
+	tests := []struct {
+		query   string
+		primary bool
+	}{
+		{"SELECT * FROM users", false},
+		{"SELECT * FROM sessions WHERE id = 1", true},
+		{"SELECT * FROM auth.sessions", true},
+		{"SELECT * FROM payments_ledger", false},
+		{"SELECT * FROM billing.payments_ledger", true},
+		{"SELECT * FROM users u JOIN sessions s ON u.id = s.uid", true},
+	}
+	for _, test := range tests {
+		if actual := db.pinnedToPrimary(test.query); actual != test.primary {
+			t.Errorf("actual pinned = %t, expected = %t for %s", actual, test.primary, test.query)
+		}
+	}
+
+	p.mock.ExpectQuery("FROM sessions").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	p.mock.ExpectQuery("FROM sessions").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	r1.mock.ExpectQuery("FROM users").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	rows, err := db.QueryContext(context.Background(), "SELECT * FROM sessions")
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+	var id int
+	if err = db.QueryRow("SELECT id FROM sessions").Scan(&id); err != nil {
+		t.Fatalf("error %s when QueryRow", err)
+	}
+	rows, err = db.QueryContext(context.Background(), "SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+	if actual := db.Metrics().ReadsPrimary; actual != 2 {
+		t.Errorf("actual reads of primary = %d, expected = 2", actual)
+	}
+
+	db.SetPrimaryTables()
+	if db.pinnedToPrimary("SELECT * FROM sessions") {
+		t.Errorf("actual pinned after unpinning all tables, expected not pinned")
+	}
+
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,202 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// defaultPoolInterval is the default interval of tuning by PoolPolicy
+const defaultPoolInterval = 10 * time.Second
+
+// PoolPolicy tunes `MaxOpenConns` & `MaxIdleConns` of each target within bounds, instead of identical static limits:
+//
+// - a target whose callers waited for connections since the last tuning grows by 25% (at least 1)
+//
+// - read replicas share `ReplicaOpen` by their share of reads since the last tuning, shrinking gradually
+//
+// Primary DB only grows by waits, as it has no traffic share among read replicas.
+type PoolPolicy struct {
+	// MinOpen & MaxOpen bound `MaxOpenConns` of each target
+	MinOpen int
+	MaxOpen int
+
+	// ReplicaOpen is the number of open connections of all read replicas shared by traffic share,
+	// `MaxOpen` times number of read replicas if zero
+	ReplicaOpen int
+
+	// IdleRatio is the ratio (0.0 ~ 1.0) of `MaxIdleConns` to `MaxOpenConns` of each target, at least 1 connection.
+	// Default to 0.5.
+	IdleRatio float64
+
+	// Interval is the interval of tuning. Default to 10s.
+	Interval time.Duration
+}
+
+// poolSample is counters of a target at the last tuning
+type poolSample struct {
+	waitCount int64
+	reads     uint64
+}
+
+// poolTuner tunes pools by PoolPolicy, holding counters of the last tuning
+type poolTuner struct {
+	policy PoolPolicy
+	last   map[*sql.DB]poolSample
+}
+
+// SetPoolPolicy sets the PoolPolicy, replacing the current one, and starts tuning every `Interval`.
+// Passing nil stops tuning, which is the default; limits are left as last tuned.
+// It returns an error wrapping `ErrInvalidConfig` if bounds are not 1 <= MinOpen <= MaxOpen or IdleRatio is out of 0.0 ~ 1.0.
+func (db *DB) SetPoolPolicy(p *PoolPolicy) error {
+	var tuner *poolTuner
+	if p != nil {
+		if p.MinOpen < 1 || p.MaxOpen < p.MinOpen {
+			return fmt.Errorf("%w: pool bounds %d ~ %d are invalid", ErrInvalidConfig, p.MinOpen, p.MaxOpen)
+		}
+		if p.IdleRatio < 0 || p.IdleRatio > 1 {
+			return fmt.Errorf("%w: idle ratio %f is out of 0.0 ~ 1.0", ErrInvalidConfig, p.IdleRatio)
+		}
+		policy := *p
+		if policy.ReplicaOpen <= 0 {
+			policy.ReplicaOpen = policy.MaxOpen * len(db.readreplicas)
+		}
+		if policy.IdleRatio == 0 {
+			policy.IdleRatio = 0.5
+		}
+		if policy.Interval <= 0 {
+			policy.Interval = defaultPoolInterval
+		}
+		tuner = db.newPoolTuner(policy)
+	}
+
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+	if db.poolTuner != nil {
+		db.poolTuner.Stop()
+		db.poolTuner = nil
+	}
+	if tuner == nil || db.closed {
+		return nil
+	}
+	db.poolTuner = startHeartbeater(tuner.policy.Interval, func() {
+		db.tunePools(tuner)
+	})
+	return nil
+}
+
+// newPoolTuner returns a poolTuner of policy, sampling counters of all targets as of now
+func (db *DB) newPoolTuner(policy PoolPolicy) *poolTuner {
+	t := &poolTuner{policy: policy, last: map[*sql.DB]poolSample{}}
+	for _, target := range db.poolTargets() {
+		t.last[target] = db.poolSample(target)
+	}
+	return t
+}
+
+// poolTargets returns primary DB (unless in maintenance mode) and read replicas, each once
+func (db *DB) poolTargets() []*sql.DB {
+	var targets []*sql.DB
+	if !db.PrimaryInMaintenance() && db.master != nil {
+		targets = append(targets, db.master)
+	}
+	if !db.single {
+		targets = append(targets, db.readreplicas...)
+	}
+	return targets
+}
+
+// poolSample returns current counters of target
+func (db *DB) poolSample(target *sql.DB) poolSample {
+	sample := poolSample{waitCount: target.Stats().WaitCount}
+	if state, ok := db.replicaStates[target]; ok && !db.single {
+		sample.reads = atomic.LoadUint64(&db.metrics.readsReplica[state.index])
+	}
+	return sample
+}
+
+// tunePools tunes `MaxOpenConns` & `MaxIdleConns` of each target by counters since the last tuning
+func (db *DB) tunePools(t *poolTuner) {
+	targets := db.poolTargets()
+	samples := make(map[*sql.DB]poolSample, len(targets))
+	reads := make(map[*sql.DB]uint64, len(targets))
+	var totalReads uint64
+	for _, target := range targets {
+		sample := db.poolSample(target)
+		samples[target] = sample
+		last := t.last[target]
+		if sample.reads >= last.reads {
+			reads[target] = sample.reads - last.reads
+		} else {
+			// reset by `ResetMetrics()`
+			reads[target] = sample.reads
+		}
+		totalReads += reads[target]
+	}
+
+	for _, target := range targets {
+		_, isReplica := db.replicaStates[target]
+		share := -1.0
+		if isReplica && !db.single && totalReads > 0 {
+			share = float64(reads[target]) / float64(totalReads)
+		}
+		waits := samples[target].waitCount - t.last[target].waitCount
+		open := target.Stats().MaxOpenConnections
+		next := t.nextOpen(open, waits, share)
+		if next != open {
+			idle := int(float64(next) * t.policy.IdleRatio)
+			if idle < 1 {
+				idle = 1
+			}
+			db.debugf(DebugEvent, "[tunePools] target: %+v, waits: %d, share: %.2f, max open: %d -> %d, max idle: %d",
+				db.targetInfo(target), waits, share, open, next, idle)
+			target.SetMaxOpenConns(next)
+			target.SetMaxIdleConns(idle)
+		}
+	}
+	t.last = samples
+}
+
+// nextOpen returns `MaxOpenConns` of a target after open (0 for unlimited) by waits and share of reads (negative if unknown)
+func (t *poolTuner) nextOpen(open int, waits int64, share float64) int {
+	p := t.policy
+	if open <= 0 {
+		open = p.MaxOpen
+	}
+	fair := open
+	if share >= 0 {
+		fair = int(math.Ceil(share * float64(p.ReplicaOpen)))
+	}
+	fair = clampInt(fair, p.MinOpen, p.MaxOpen)
+
+	next := fair
+	switch {
+	case waits > 0:
+		grown := open + open/4
+		if grown == open {
+			grown++
+		}
+		if grown > next {
+			next = grown
+		}
+	case fair < open:
+		step := (open - fair) / 2
+		if step < 1 {
+			step = 1
+		}
+		next = open - step
+	}
+	return clampInt(next, p.MinOpen, p.MaxOpen)
+}
+
+func clampInt(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
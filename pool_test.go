@@ -0,0 +1,105 @@
+package gosqlrwdb
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetPoolPolicy(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	tests := []struct {
+		policy   *PoolPolicy
+		expected error
+	}{
+		{nil, nil},
+		{&PoolPolicy{MinOpen: 1, MaxOpen: 10}, nil},
+		{&PoolPolicy{MinOpen: 0, MaxOpen: 10}, ErrInvalidConfig},
+		{&PoolPolicy{MinOpen: 5, MaxOpen: 4}, ErrInvalidConfig},
+		{&PoolPolicy{MinOpen: 1, MaxOpen: 10, IdleRatio: 1.5}, ErrInvalidConfig},
+		{nil, nil},
+	}
+	for i, test := range tests {
+		if err := db.SetPoolPolicy(test.policy); !errors.Is(err, test.expected) {
+			t.Errorf("%d: actual err = %v, expected = %v", i, err, test.expected)
+		}
+	}
+}
+
+func TestPoolTunerNextOpen(t *testing.T) {
+	tuner := &poolTuner{policy: PoolPolicy{MinOpen: 2, MaxOpen: 20, ReplicaOpen: 30}}
+	tests := []struct {
+		open     int
+		waits    int64
+		share    float64
+		expected int
+	}{
+		{10, 0, -1, 10},
+		{0, 0, -1, 20},
+		{10, 3, -1, 12},
+		{3, 3, -1, 4},
+		{20, 3, -1, 20},
+		{10, 0, 0.5, 15},
+		{10, 0, 0.1, 7},
+		{3, 0, 0.05, 2},
+		{10, 5, 0.1, 12},
+		{10, 5, 0.9, 20},
+	}
+	for _, test := range tests {
+		if actual := tuner.nextOpen(test.open, test.waits, test.share); actual != test.expected {
+			t.Errorf("nextOpen(%d, %d, %.2f): actual %d, expected %d", test.open, test.waits, test.share, actual, test.expected)
+		}
+	}
+}
+
+func TestTunePools(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	tuner := db.newPoolTuner(PoolPolicy{MinOpen: 2, MaxOpen: 10, ReplicaOpen: 12, IdleRatio: 0.5})
+	atomic.AddUint64(&db.metrics.readsReplica[0], 3)
+	atomic.AddUint64(&db.metrics.readsReplica[1], 1)
+	db.tunePools(tuner)
+
+	tests := []struct {
+		mock     *mydbMock
+		expected int
+	}{
+		{p, 10},
+		{r1, 9},
+		{r2, 7},
+	}
+	for i, test := range tests {
+		if actual := test.mock.db.Stats().MaxOpenConnections; actual != test.expected {
+			t.Errorf("%d: actual max open conns = %d, expected = %d", i, actual, test.expected)
+		}
+	}
+
+	// no reads since the last tuning
+	db.tunePools(tuner)
+	if actual := r2.db.Stats().MaxOpenConnections; actual != 7 {
+		t.Errorf("actual max open conns = %d, expected = 7 without reads", actual)
+	}
+}
@@ -0,0 +1,154 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"time"
+)
+
+// PrimaryWriteAction is what writes do while primary DB fails health checks
+type PrimaryWriteAction int
+
+const (
+	// PrimaryWriteProceed sends writes to primary DB as usual, which is the default
+	PrimaryWriteProceed PrimaryWriteAction = iota
+
+	// PrimaryWriteFailFast returns `*PrimaryUnavailableError` without sending writes to primary DB,
+	// rather than waiting for driver-level dial timeouts on every call during an outage
+	PrimaryWriteFailFast
+
+	// PrimaryWriteQueue blocks writes until primary DB passes health checks again,
+	// `PrimaryPolicy.QueueTimeout` elapses or ctx is done, then returns `*PrimaryUnavailableError`
+	PrimaryWriteQueue
+)
+
+// PrimaryPolicy decides what happens while primary DB fails health checks.
+// Health of primary DB is checked together with read replicas every `DefaultReplicaAutoFailoverInterval`,
+// unless `DisableReplicaAutoFailover` is true.
+type PrimaryPolicy struct {
+	// Writes is what writes (`Exec`, `Begin`, `Prepare` of non-query etc.) do
+	Writes PrimaryWriteAction
+
+	// QueueTimeout is the max duration a write is queued for `PrimaryWriteQueue`, no limit if zero
+	QueueTimeout time.Duration
+
+	// RedirectReads routes reads forced to primary DB by `WithPrimary()` back to read replicas
+	RedirectReads bool
+}
+
+// defaultPrimaryPolicy is used when PrimaryPolicy is not set:
+// writes are sent to primary DB regardless of its health, as a single failed health check may be transient
+var defaultPrimaryPolicy = PrimaryPolicy{Writes: PrimaryWriteProceed}
+
+// SetPrimaryPolicy sets the PrimaryPolicy.
+// Passing nil means the default: writes are sent to primary DB as usual, and forced reads are not redirected.
+// Use `PrimaryWriteFailFast` to fail writes fast with `ErrPrimaryUnavailable` while primary DB fails health checks.
+func (db *DB) SetPrimaryPolicy(p *PrimaryPolicy) {
+	db.configMutex.Lock()
+	db.primaryPolicy = p
+	db.configMutex.Unlock()
+}
+
+// unhealthyPrimaryPolicy returns current PrimaryPolicy, nil if not set
+func (db *DB) unhealthyPrimaryPolicy() *PrimaryPolicy {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.primaryPolicy
+}
+
+// refreshPrimary pings primary DB and updates its health, emitting `EventPrimaryDown` / `EventPrimaryUp` on change.
+// Primary DB in maintenance mode is not pinged.
+func (db *DB) refreshPrimary() {
+	db.refreshPrimaryContext(context.Background())
+}
+
+// refreshPrimaryContext is `refreshPrimary()` pinging with ctx, updating nothing if ctx is done while pinging
+func (db *DB) refreshPrimaryContext(ctx context.Context) {
+	if db.master == nil || db.PrimaryInMaintenance() || db.healthChecksPaused() {
+		return
+	}
+	err := db.master.PingContext(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	db.recordError(db.targetInfo(db.master), OperationHealthCheck, "", err)
+	db.countMutex.Lock()
+	if err != nil {
+		changed := db.primaryDown == nil
+		if changed {
+			db.debugf(DebugEvent, "[refreshPrimary] primary unavailable, err: %s", err)
+			db.primaryDown = &PrimaryUnavailableError{Since: time.Now(), Err: err}
+			db.primaryRecovered = make(chan struct{})
+		}
+		db.countMutex.Unlock()
+		if changed {
+			db.emit(Event{Type: EventPrimaryDown, Target: db.targetInfo(db.master), Err: err})
+		}
+		return
+	}
+	changed := db.primaryDown != nil
+	if changed {
+		db.debugf(DebugEvent, "[refreshPrimary] primary recovered")
+		db.primaryDown = nil
+		close(db.primaryRecovered)
+	}
+	db.countMutex.Unlock()
+	if changed {
+		db.emit(Event{Type: EventPrimaryUp, Target: db.targetInfo(db.master)})
+	}
+}
+
+// primaryHealth returns `*PrimaryUnavailableError` if primary DB failed the last health check, otherwise nil,
+// and a channel closed when it recovers
+func (db *DB) primaryHealth() (*PrimaryUnavailableError, <-chan struct{}) {
+	db.countMutex.RLock()
+	defer db.countMutex.RUnlock()
+	return db.primaryDown, db.primaryRecovered
+}
+
+// checkPrimaryWrite applies PrimaryPolicy to a write, returning `*PrimaryUnavailableError`
+// if the write must not be sent to primary DB
+func (db *DB) checkPrimaryWrite(ctx context.Context) error {
+	policy := db.unhealthyPrimaryPolicy()
+	if policy == nil {
+		policy = &defaultPrimaryPolicy
+	}
+	if policy.Writes == PrimaryWriteProceed {
+		return nil
+	}
+	down, recovered := db.primaryWriteHealth()
+	if down == nil {
+		return nil
+	}
+	if policy.Writes == PrimaryWriteFailFast {
+		return down
+	}
+
+	var timeout <-chan time.Time
+	if policy.QueueTimeout > 0 {
+		timer := time.NewTimer(policy.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-recovered:
+		if down.Err == ErrDrill {
+			// the real health of primary DB is checked once the drill stops
+			return db.checkPrimaryWrite(ctx)
+		}
+		return nil
+	case <-timeout:
+		return down
+	case <-ctx.Done():
+		return down
+	}
+}
+
+// redirectPrimaryReads returns true if reads forced to primary DB should be routed to read replicas
+func (db *DB) redirectPrimaryReads() bool {
+	policy := db.unhealthyPrimaryPolicy()
+	if policy == nil || !policy.RedirectReads {
+		return false
+	}
+	down, _ := db.primaryHealth()
+	return down != nil
+}
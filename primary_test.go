@@ -0,0 +1,161 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+// newUnhealthyPrimaryDB returns DB whose primary DB failed the health check in `New()`
+func newUnhealthyPrimaryDB(t *testing.T) (*DB, *mydbMock, *mydbMock) {
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	p.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db := New(p.db, r1.db)
+	if down, _ := db.primaryHealth(); down == nil {
+		t.Fatalf("primary should be unavailable")
+	}
+	return db, p, r1
+}
+
+func TestPrimaryPolicyProceed(t *testing.T) {
+	db, p, _ := newUnhealthyPrimaryDB(t)
+	defer db.Close()
+
+	// the default
+	p.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "")).WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err := db.Exec(fmt.Sprintf(deleteQuueryTmpl, "")); err != nil {
+		t.Errorf("error %s when Exec by default", err)
+	}
+
+	db.SetPrimaryPolicy(&PrimaryPolicy{Writes: PrimaryWriteProceed})
+	p.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "")).WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err := db.Exec(fmt.Sprintf(deleteQuueryTmpl, "")); err != nil {
+		t.Errorf("error %s when Exec", err)
+	}
+	if err := p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPrimaryPolicyFailFast(t *testing.T) {
+	db, p, _ := newUnhealthyPrimaryDB(t)
+	defer db.Close()
+	db.SetPrimaryPolicy(&PrimaryPolicy{Writes: PrimaryWriteFailFast})
+
+	_, err := db.Exec(fmt.Sprintf(deleteQuueryTmpl, ""))
+	var pe *PrimaryUnavailableError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrPrimaryUnavailable) {
+		t.Fatalf("Exec: actual err = %v, expected = %s", err, ErrPrimaryUnavailable)
+	}
+	if pe.Err == nil || pe.Err.Error() != "Not available" || pe.Since.IsZero() {
+		t.Errorf("actual err = %+v, expected health check error", pe)
+	}
+	if _, err = db.BeginTx(context.Background(), nil); !errors.Is(err, ErrPrimaryUnavailable) {
+		t.Errorf("BeginTx: actual err = %v, expected = %s", err, ErrPrimaryUnavailable)
+	}
+	if _, err = db.PrepareContext(context.Background(), fmt.Sprintf(deleteQuueryTmpl, "")); !errors.Is(err, ErrPrimaryUnavailable) {
+		t.Errorf("PrepareContext: actual err = %v, expected = %s", err, ErrPrimaryUnavailable)
+	}
+	if actual := db.Metrics().Errors[ErrorTypePrimaryUnavailable]; actual != 3 {
+		t.Errorf("actual errors = %d, expected = 3", actual)
+	}
+
+	p.mock.ExpectPing()
+	db.refreshPrimary()
+	p.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "")).WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err := db.Exec(fmt.Sprintf(deleteQuueryTmpl, "")); err != nil {
+		t.Errorf("error %s when Exec after primary recovered", err)
+	}
+	if err := p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPrimaryPolicyQueue(t *testing.T) {
+	db, p, _ := newUnhealthyPrimaryDB(t)
+	defer db.Close()
+	db.SetPrimaryPolicy(&PrimaryPolicy{Writes: PrimaryWriteQueue, QueueTimeout: 20 * time.Millisecond})
+
+	if _, err := db.Exec(fmt.Sprintf(deleteQuueryTmpl, "")); !errors.Is(err, ErrPrimaryUnavailable) {
+		t.Errorf("actual err = %v, expected = %s after QueueTimeout", err, ErrPrimaryUnavailable)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	db.SetPrimaryPolicy(&PrimaryPolicy{Writes: PrimaryWriteQueue})
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(deleteQuueryTmpl, "")); !errors.Is(err, ErrPrimaryUnavailable) {
+		t.Errorf("actual err = %v, expected = %s after ctx done", err, ErrPrimaryUnavailable)
+	}
+
+	p.mock.ExpectPing()
+	p.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "")).WillReturnResult(sqlmock.NewResult(0, 1))
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		db.refreshPrimary()
+	}()
+	if _, err := db.ExecContext(context.Background(), fmt.Sprintf(deleteQuueryTmpl, "")); err != nil {
+		t.Errorf("error %s when ExecContext queued until primary recovered", err)
+	}
+	if err := p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPrimaryPolicyRedirectReads(t *testing.T) {
+	db, p, r1 := newUnhealthyPrimaryDB(t)
+	defer db.Close()
+	db.SetPrimaryPolicy(&PrimaryPolicy{RedirectReads: true})
+
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	if _, err := db.QueryContext(WithPrimary(context.Background()), fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when QueryContext", err)
+	}
+	if actual := db.Metrics().Fallbacks; actual != 1 {
+		t.Errorf("actual fallbacks = %d, expected = 1", actual)
+	}
+	if err := p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err := r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPrimaryEvents(t *testing.T) {
+	db, p, _ := newUnhealthyPrimaryDB(t)
+	defer db.Close()
+
+	var events []Event
+	db.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+	p.mock.ExpectPing()
+	db.refreshPrimary()
+	p.mock.ExpectPing()
+	db.refreshPrimary()
+	p.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db.refreshPrimary()
+
+	if len(events) != 2 {
+		t.Fatalf("actual events = %+v, expected 2 events", events)
+	}
+	if events[0].Type != EventPrimaryUp || events[0].Target.Role != RolePrimary || events[0].Time.IsZero() {
+		t.Errorf("actual event = %+v, expected %s", events[0], EventPrimaryUp)
+	}
+	if events[1].Type != EventPrimaryDown || events[1].Err == nil {
+		t.Errorf("actual event = %+v, expected %s", events[1], EventPrimaryDown)
+	}
+	if err := p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,51 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// WithPrimaryConn calls fn with a raw connection of primary DB, for `COPY`, `LOAD DATA` and other bulk paths
+// specific to drivers (e.g. `conn.Raw()` to reach the driver connection), so that they share the pool of db and
+// are subject to maintenance mode, drills and the write latency budget instead of using a separate unmanaged handle.
+// The connection is returned to the pool when fn returns (or panics), and must not be used after.
+// Statements run by fn on the connection are counted as a single write, and are not observed by hooks.
+// The cluster of `PartitionRouter` is decided by ctx. The error returned by fn is returned as it is.
+func (db *DB) WithPrimaryConn(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	cluster, err := db.partitionCluster(ctx, "")
+	if err != nil {
+		db.debugf(DebugError, "[WithPrimaryConn] partition err: %s", err)
+		db.metrics.countError(err)
+		return err
+	}
+	if cluster != nil {
+		return cluster.WithPrimaryConn(ctx, fn)
+	}
+	err = db.withPrimaryConn(ctx, fn)
+	if err != nil {
+		db.debugf(DebugError, "[WithPrimaryConn] err: %s", err)
+	}
+	db.metrics.countError(err)
+	return err
+}
+
+// withPrimaryConn calls fn with a connection of primary DB, if primary DB accepts writes
+func (db *DB) withPrimaryConn(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	if err := checkNotInTx(ctx, "WithPrimaryConn"); err != nil {
+		return err
+	}
+	if err := db.checkDirectives(ctx, "WithPrimaryConn", "", true); err != nil {
+		return err
+	}
+	if err := db.primaryWritable(ctx); err != nil {
+		return err
+	}
+	conn, err := db.master.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	db.countWrite()
+	db.markWrite(ctx)
+	return fn(conn)
+}
@@ -0,0 +1,64 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWithPrimaryConn(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+
+	p.mock.ExpectExec("COPY mytable FROM STDIN").WillReturnResult(sqlmock.NewResult(0, 3))
+	err = db.WithPrimaryConn(context.Background(), func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(context.Background(), "COPY mytable FROM STDIN")
+		return err
+	})
+	if err != nil {
+		t.Errorf("error %s when WithPrimaryConn", err)
+	}
+	if actual := db.Metrics().Writes; actual != 1 {
+		t.Errorf("actual writes: %d, expected: 1", actual)
+	}
+
+	// errors of fn as they are, connections returned to the pool even on panics
+	fnErr := errors.New("bulk load failed")
+	if err := db.WithPrimaryConn(context.Background(), func(*sql.Conn) error { return fnErr }); err != fnErr {
+		t.Errorf("actual err: %v, expected: %s", err, fnErr)
+	}
+	func() {
+		defer func() { recover() }()
+		db.WithPrimaryConn(context.Background(), func(*sql.Conn) error { panic("bulk load panicked") })
+	}()
+	if actual := p.db.Stats().InUse; actual != 0 {
+		t.Errorf("actual connections in use: %d, expected: 0", actual)
+	}
+
+	db.SetPrimaryInMaintenance(true)
+	called := false
+	err = db.WithPrimaryConn(context.Background(), func(*sql.Conn) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrPrimaryInMaintenance) || called {
+		t.Errorf("actual err: %v, called: %t, expected: %s without calling fn", err, called, ErrPrimaryInMaintenance)
+	}
+
+	for _, m := range []*mydbMock{p, r0} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
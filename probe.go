@@ -0,0 +1,89 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ProbeSchedule randomizes health checks, so that fleets of application instances started together
+// do not send synchronized storms of pings to databases at every heartbeat
+type ProbeSchedule struct {
+	// Jitter is the fraction (0.0 ~ 1.0) of the heartbeat interval by which each heartbeat is randomly delayed or advanced
+	Jitter float64
+
+	// Spread is the fraction (0.0 ~ 1.0) of the heartbeat interval over which pings of read replicas are randomly spread,
+	// instead of all at the tick. Health of read replicas is updated once all of them are pinged.
+	Spread float64
+}
+
+// SetProbeSchedule sets the ProbeSchedule of health checks, restarting the heartbeat if it is running.
+// Zero value means pinging all read replicas at every exact interval, which is the default.
+// It returns an error wrapping `ErrInvalidConfig` if a fraction is out of 0.0 ~ 1.0.
+func (db *DB) SetProbeSchedule(s ProbeSchedule) error {
+	if s.Jitter < 0 || s.Jitter > 1 || s.Spread < 0 || s.Spread > 1 {
+		return fmt.Errorf("%w: jitter %f or spread %f is out of 0.0 ~ 1.0", ErrInvalidConfig, s.Jitter, s.Spread)
+	}
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+	db.configMutex.Lock()
+	db.probeSchedule = s
+	interval := db.heartbeatInterval
+	db.configMutex.Unlock()
+	if db.heartbeater != nil && !db.closed {
+		db.heartbeater.Stop()
+		db.heartbeater = db.startHealthHeartbeater(interval)
+	}
+	db.debugf(DebugEvent, "[SetProbeSchedule] schedule: %+v", s)
+	return nil
+}
+
+// replicaProbeSchedule returns current ProbeSchedule and heartbeat interval
+func (db *DB) replicaProbeSchedule() (ProbeSchedule, time.Duration) {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.probeSchedule, db.heartbeatInterval
+}
+
+// startHealthHeartbeater returns a started heartbeater checking health every interval by ProbeSchedule
+func (db *DB) startHealthHeartbeater(interval time.Duration) *heartbeater {
+	schedule, _ := db.replicaProbeSchedule()
+	return startJitteredHeartbeaterContext(interval, schedule.Jitter, db.refreshHealthContext)
+}
+
+// probeReplicas returns failing read replicas of replicas and their errors like `heartbeat()`,
+// spreading pings over `ProbeSchedule.Spread` of the heartbeat interval.
+// Pings not sent yet are skipped once ctx is done.
+func (db *DB) probeReplicas(ctx context.Context, replicas []*sql.DB) map[*sql.DB]error {
+	schedule, interval := db.replicaProbeSchedule()
+	window := time.Duration(schedule.Spread * float64(interval))
+	if window <= 0 || len(replicas) < 2 {
+		return heartbeatContext(ctx, replicas)
+	}
+	failing := map[*sql.DB]error{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		wg.Add(1)
+		go func(r *sql.DB, delay time.Duration) {
+			defer wg.Done()
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return
+			}
+			if err := r.PingContext(ctx); err != nil {
+				mutex.Lock()
+				failing[r] = err
+				mutex.Unlock()
+			}
+		}(r, time.Duration(rand.Int63n(int64(window))))
+	}
+	wg.Wait()
+	return failing
+}
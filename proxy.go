@@ -0,0 +1,61 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+)
+
+// ProxyCompat is a set of flags of `TargetInfo.Proxy`, avoiding features incompatible with a connection pooling proxy
+// in front of the DB, such as PgBouncer with `pool_mode = transaction` or ProxySQL with multiplexing,
+// which hand each transaction (or each statement outside transactions) to any server connection.
+// Statements using such features are rejected with `ErrProxyIncompatible` before they are sent,
+// instead of failing or leaking session state to other clients at random.
+//
+// `NewStatementTimeoutConnector()` sets session variables on its connections; do not open such DBs with it.
+type ProxyCompat int
+
+const (
+	// ProxyNoPrepare rejects `Prepare()` and `PrepareContext()` of `DB` routed to the DB,
+	// as statements prepared on a server connection are not found on the next one.
+	// Statements prepared by `Tx` are kept, as they live within the transaction.
+	ProxyNoPrepare ProxyCompat = 1 << iota
+
+	// ProxyNoSessionState rejects statements changing state of the session:
+	// `SET` except `SET LOCAL` and `SET TRANSACTION`, `RESET`, `USE`, `PREPARE`, `DEALLOCATE`,
+	// `LISTEN`, `UNLISTEN` and `CREATE TEMPORARY TABLE`, as the state is not replayed on other server connections.
+	ProxyNoSessionState
+
+	// ProxyTransactionPooling is all the flags, for transaction-pooling proxies
+	ProxyTransactionPooling = ProxyNoPrepare | ProxyNoSessionState
+)
+
+// checkProxyCompat returns an error wrapping `ErrProxyIncompatible` if the statement of info
+// uses a feature avoided by `TargetInfo.Proxy` of its target
+func checkProxyCompat(info StatementInfo, inTx bool) error {
+	proxy := info.Target.Proxy
+	if proxy == 0 {
+		return nil
+	}
+	if proxy&ProxyNoPrepare != 0 && !inTx && (info.Method == "Prepare" || info.Method == "PrepareContext") {
+		return fmt.Errorf("%w: %s on %s", ErrProxyIncompatible, info.Method, info.Target.Name)
+	}
+	if proxy&ProxyNoSessionState != 0 && isSessionStatement(keywords(StripLeadingNoise(info.Query))) {
+		return fmt.Errorf("%w: session state changed by %s on %s", ErrProxyIncompatible, info.Method, info.Target.Name)
+	}
+	return nil
+}
+
+// isSessionStatement returns true if tokens are keywords of a statement changing state of the session
+func isSessionStatement(tokens []string) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	switch tokens[0] {
+	case "set":
+		return len(tokens) < 2 || (tokens[1] != "local" && tokens[1] != "transaction")
+	case "reset", "use", "prepare", "deallocate", "listen", "unlisten":
+		return true
+	case "create":
+		return len(tokens) > 2 && (tokens[1] == "temporary" || tokens[1] == "temp") && tokens[2] == "table"
+	}
+	return false
+}
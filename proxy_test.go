@@ -0,0 +1,119 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIsSessionStatement(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{"SET search_path = app", true},
+		{"SET SESSION max_execution_time = 100", true},
+		{"SET LOCAL statement_timeout = 100", false},
+		{"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE", false},
+		{"RESET ALL", true},
+		{"USE orders", true},
+		{"PREPARE q AS SELECT 1", true},
+		{"DEALLOCATE q", true},
+		{"LISTEN orders", true},
+		{"CREATE TEMP TABLE t (id int)", true},
+		{"CREATE TABLE t (id int)", false},
+		{"/* set */ SELECT * FROM settings", false},
+		{"UPDATE users SET name = 'a'", false},
+	}
+	for _, test := range tests {
+		if actual := isSessionStatement(keywords(StripLeadingNoise(test.query))); actual != test.expected {
+			t.Errorf("actual = %t, expected = %t for %s", actual, test.expected, test.query)
+		}
+	}
+}
+
+func TestProxyCompat(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	primary, replicas := db.Targets()
+	for _, info := range append(replicas, primary) {
+		info.Proxy = ProxyTransactionPooling
+		if err = db.SetTargetInfo(info); err != nil {
+			t.Fatalf("error %s when SetTargetInfo", err)
+		}
+	}
+
+	if _, err = db.Exec("SET search_path = app"); !errors.Is(err, ErrProxyIncompatible) {
+		t.Errorf("Exec: actual err = %v, expected = %s", err, ErrProxyIncompatible)
+	}
+	if _, err = db.PrepareContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*")); !errors.Is(err, ErrProxyIncompatible) {
+		t.Errorf("PrepareContext: actual err = %v, expected = %s", err, ErrProxyIncompatible)
+	}
+	if _, err = db.Prepare(fmt.Sprintf(insertQueryTmpl, "values (?, ?)")); !errors.Is(err, ErrProxyIncompatible) {
+		t.Errorf("Prepare: actual err = %v, expected = %s", err, ErrProxyIncompatible)
+	}
+
+	// statements prepared in a transaction live within it, but session state must not leak out of it
+	p.mock.ExpectBegin()
+	p.mock.ExpectPrepare("insert into mytable")
+	p.mock.ExpectRollback()
+	err = db.RunInTx(context.Background(), nil, func(ctx context.Context, tx *Tx) error {
+		stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(insertQueryTmpl, "values (?, ?)"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		_, err = tx.ExecContext(ctx, "SET statement_timeout = 100")
+		return err
+	})
+	if !errors.Is(err, ErrProxyIncompatible) {
+		t.Errorf("RunInTx: actual err = %v, expected = %s", err, ErrProxyIncompatible)
+	}
+
+	if actual := db.Metrics().Errors[ErrorTypeProxyIncompatible]; actual != 3 {
+		t.Errorf("actual errors of %s = %d, expected = 3", ErrorTypeProxyIncompatible, actual)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestNewFromConfigProxyTransactionPooling(t *testing.T) {
+	primaryDSN, replicaDSN := uniqueDSN("proxy-primary"), uniqueDSN("proxy-replica1")
+	for _, dsn := range []string{primaryDSN, replicaDSN} {
+		_, mock, err := sqlmock.NewWithDSN(dsn)
+		if err != nil {
+			t.Fatalf("error %s when creating mock databasen", err)
+		}
+		mock.ExpectClose()
+	}
+	db, err := NewFromConfig(Config{
+		Driver:                     "sqlmock",
+		PrimaryDSN:                 primaryDSN,
+		ReplicaDSNs:                []string{replicaDSN},
+		DisableReplicaAutoFailover: true,
+		ProxyTransactionPooling:    true,
+	})
+	if err != nil {
+		t.Fatalf("error %s when NewFromConfig", err)
+	}
+	defer db.Close()
+	primary, replicas := db.Targets()
+	if primary.Proxy != ProxyTransactionPooling || replicas[0].Proxy != ProxyTransactionPooling {
+		t.Errorf("actual primary = %+v, replicas = %+v, expected proxy of transaction pooling", primary, replicas)
+	}
+}
@@ -0,0 +1,113 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// QueryBudgetError is returned when a statement is run with ctx of `WithQueryBudget()` beyond its budget,
+// and reported by `EventQueryBudgetExceeded`. `errors.Is(err, ErrQueryBudgetExceeded)` holds for it.
+type QueryBudgetError struct {
+	// Budget is the budget of the context, and Statements is the number of statements run with it
+	// including the one over budget
+	Budget     int
+	Statements int
+
+	// Method, StatementID & Query describe the statement over budget
+	Method      string
+	StatementID string
+	Query       string
+}
+
+func (e *QueryBudgetError) Error() string {
+	return fmt.Sprintf("%s: statement %d of budget %d by %s, stmt_id: %s", ErrQueryBudgetExceeded, e.Statements, e.Budget, e.Method, e.StatementID)
+}
+
+// Unwrap returns `ErrQueryBudgetExceeded`, so that `errors.Is(err, ErrQueryBudgetExceeded)` holds
+func (e *QueryBudgetError) Unwrap() error {
+	return ErrQueryBudgetExceeded
+}
+
+// queryBudgetKey is the context key for queryBudget of `WithQueryBudget()`
+type queryBudgetKey struct{}
+
+// queryBudgetExceededKey is the context key for `*QueryBudgetError` of a statement over budget
+type queryBudgetExceededKey struct{}
+
+// queryBudget counts statements run with a context of `WithQueryBudget()`
+type queryBudget struct {
+	// count is the number of statements, accessed atomically
+	count uint64
+	max   uint64
+}
+
+// WithQueryBudget return a copy of ctx where at most n statements are run through DB, e.g. for a request
+// to catch N+1 query regressions. Statements beyond n fail with `*QueryBudgetError` before they are sent,
+// unless `SetQueryBudgetAuditOnly()` is enabled. Each statement (including those of `Tx`, `Stmt` and `Cursor`)
+// counts once whatever its attempts, while `Begin()` / `BeginTx()` and commits do not count.
+// Contexts derived from ctx share the budget, until another `WithQueryBudget()` starts a new one.
+// Non-positive n means no budget.
+func WithQueryBudget(ctx context.Context, n int) context.Context {
+	if n <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, queryBudgetKey{}, &queryBudget{max: uint64(n)})
+}
+
+// QueryBudgetFromContext returns the budget set by `WithQueryBudget()` and the number of statements run with it;
+// otherwise returns 0 & 0
+func QueryBudgetFromContext(ctx context.Context) (int, int) {
+	b, ok := ctx.Value(queryBudgetKey{}).(*queryBudget)
+	if !ok {
+		return 0, 0
+	}
+	return int(b.max), int(atomic.LoadUint64(&b.count))
+}
+
+// SetQueryBudgetAuditOnly sets whether statements beyond `WithQueryBudget()` are only reported, for rollout.
+// Statements over budget are counted in `RoutingMetrics.QueryBudgetsExceeded` and the first one of each context
+// is reported by `EventQueryBudgetExceeded` either way, but run as usual in audit-only mode. Default to false.
+func (db *DB) SetQueryBudgetAuditOnly(auditOnly bool) {
+	db.configMutex.Lock()
+	db.budgetAuditOnly = auditOnly
+	db.configMutex.Unlock()
+}
+
+// queryBudgetAudit returns true if `SetQueryBudgetAuditOnly()` is enabled
+func (db *DB) queryBudgetAudit() bool {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.budgetAuditOnly
+}
+
+// takeQueryBudget counts the statement of info in the budget of ctx, if any,
+// and returns ctx with `*QueryBudgetError` for `runStatement()` if it is over budget and not audit-only
+func (db *DB) takeQueryBudget(ctx context.Context, info StatementInfo) context.Context {
+	b, ok := ctx.Value(queryBudgetKey{}).(*queryBudget)
+	if !ok {
+		return ctx
+	}
+	n := atomic.AddUint64(&b.count, 1)
+	if n <= b.max {
+		return ctx
+	}
+	err := &QueryBudgetError{Budget: int(b.max), Statements: int(n), Method: info.Method, StatementID: info.ID, Query: info.Query}
+	atomic.AddUint64(&db.metrics.queryBudgetsExceeded, 1)
+	if n == b.max+1 {
+		db.emit(Event{Type: EventQueryBudgetExceeded, Err: err})
+	}
+	if db.queryBudgetAudit() {
+		db.debugf(DebugEvent, "[%s] stmt_id: %s, audit: %s", info.Method, info.ID, err)
+		return ctx
+	}
+	return context.WithValue(ctx, queryBudgetExceededKey{}, err)
+}
+
+// queryBudgetExceeded returns `*QueryBudgetError` of the statement of ctx if it is over budget, nil otherwise
+func queryBudgetExceeded(ctx context.Context) error {
+	if err, ok := ctx.Value(queryBudgetExceededKey{}).(*QueryBudgetError); ok {
+		return err
+	}
+	return nil
+}
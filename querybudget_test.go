@@ -0,0 +1,84 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWithQueryBudget(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+	events := make(chan Event, 10)
+	db.OnEvent(func(e Event) {
+		if e.Type == EventQueryBudgetExceeded {
+			events <- e
+		}
+	})
+
+	query := fmt.Sprintf(selectQueryTmpl, "*")
+	r0.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	p.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "(.+)")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx := WithQueryBudget(context.Background(), 2)
+	if _, err := db.QueryContext(ctx, query); err != nil {
+		t.Errorf("error %s when QueryContext", err)
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(deleteQuueryTmpl, "1")); err != nil {
+		t.Errorf("error %s when ExecContext", err)
+	}
+
+	// statements beyond the budget fail before sent
+	_, err = db.QueryContext(ctx, query)
+	var budgetErr *QueryBudgetError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, ErrQueryBudgetExceeded) {
+		t.Fatalf("actual err: %v, expected: %s", err, ErrQueryBudgetExceeded)
+	}
+	if budgetErr.Budget != 2 || budgetErr.Statements != 3 || budgetErr.Method != "QueryContext" {
+		t.Errorf("actual budget: %d, statements: %d, method: %s, expected: 2, 3, QueryContext",
+			budgetErr.Budget, budgetErr.Statements, budgetErr.Method)
+	}
+	var id int
+	if err := db.QueryRowContext(ctx, query).Scan(&id); !errors.Is(err, ErrQueryBudgetExceeded) {
+		t.Errorf("actual err of Scan: %v, expected: %s", err, ErrQueryBudgetExceeded)
+	}
+	if budget, used := QueryBudgetFromContext(ctx); budget != 2 || used != 4 {
+		t.Errorf("actual budget: %d, used: %d, expected: 2, 4", budget, used)
+	}
+	if actual := len(events); actual != 1 {
+		t.Errorf("actual events: %d, expected: 1 for the first statement over budget", actual)
+	}
+	if actual := db.Metrics().QueryBudgetsExceeded; actual != 2 {
+		t.Errorf("actual statements over budget: %d, expected: 2", actual)
+	}
+
+	// statements over budget run as usual in audit-only mode
+	db.SetQueryBudgetAuditOnly(true)
+	r0.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	if _, err := db.QueryContext(ctx, query); err != nil {
+		t.Errorf("error %s when QueryContext in audit-only mode", err)
+	}
+	if actual := db.Metrics().QueryBudgetsExceeded; actual != 3 {
+		t.Errorf("actual statements over budget: %d, expected: 3", actual)
+	}
+
+	if budget, used := QueryBudgetFromContext(context.Background()); budget != 0 || used != 0 {
+		t.Errorf("actual budget: %d, used: %d, expected: 0, 0 without budget", budget, used)
+	}
+	for _, m := range []*mydbMock{p, r0} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
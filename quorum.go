@@ -0,0 +1,96 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"math"
+)
+
+// QuorumPolicy is the minimum number of healthy read replicas, and what happens below it.
+// A single surviving read replica silently absorbing all reads is a common hidden failure mode.
+type QuorumPolicy struct {
+	// MinReplicas is the minimum number of healthy read replicas
+	MinReplicas int
+
+	// MinFraction is the minimum fraction of healthy read replicas among (not drained) read replicas, e.g. 0.5.
+	// The larger of MinReplicas and MinFraction applies.
+	MinFraction float64
+
+	// FailReadiness makes `Ready()` return `ErrBelowQuorum` while below quorum
+	FailReadiness bool
+
+	// SpillToPrimary routes reads to primary DB while below quorum
+	SpillToPrimary bool
+}
+
+// required returns number of healthy read replicas required among total read replicas
+func (p *QuorumPolicy) required(total int) int {
+	required := int(math.Ceil(p.MinFraction * float64(total)))
+	if p.MinReplicas > required {
+		required = p.MinReplicas
+	}
+	return required
+}
+
+// SetQuorumPolicy sets the QuorumPolicy, and evaluates the quorum with current health of read replicas.
+// `EventQuorumLost` / `EventQuorumRegained` are emitted when the quorum is lost / regained.
+// Passing nil disables the quorum, which is the default.
+func (db *DB) SetQuorumPolicy(p *QuorumPolicy) {
+	db.configMutex.Lock()
+	db.quorumPolicy = p
+	db.configMutex.Unlock()
+	db.updateQuorum()
+}
+
+// replicaQuorumPolicy returns current QuorumPolicy, nil if not set
+func (db *DB) replicaQuorumPolicy() *QuorumPolicy {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.quorumPolicy
+}
+
+// updateQuorum evaluates the quorum with current health of read replicas, emitting events on change
+func (db *DB) updateQuorum() {
+	below := false
+	healthy, total := db.healthyReplicas()
+	if policy := db.replicaQuorumPolicy(); policy != nil {
+		below = healthy < policy.required(total)
+	}
+
+	db.countMutex.Lock()
+	changed := below != db.belowQuorum
+	db.belowQuorum = below
+	db.countMutex.Unlock()
+	if !changed {
+		return
+	}
+	if below {
+		db.emit(Event{Type: EventQuorumLost, Err: ErrBelowQuorum})
+	} else {
+		db.emit(Event{Type: EventQuorumRegained})
+	}
+	db.debugf(DebugEvent, "[updateQuorum] below quorum: %t, healthy replicas: %d of %d", below, healthy, total)
+}
+
+// isBelowQuorum returns true if healthy read replicas are below the quorum
+func (db *DB) isBelowQuorum() bool {
+	db.countMutex.RLock()
+	defer db.countMutex.RUnlock()
+	return db.belowQuorum
+}
+
+// spillToPrimary returns true if reads should be routed to primary DB as below the quorum
+func (db *DB) spillToPrimary(ctx context.Context) bool {
+	policy := db.replicaQuorumPolicy()
+	return policy != nil && policy.SpillToPrimary && db.isBelowQuorum() && db.fallbackToPrimary(ctx)
+}
+
+// Ready returns `ErrBelowQuorum` if healthy read replicas are below the quorum
+// and `QuorumPolicy.FailReadiness` is true, otherwise nil. It does not check health by itself,
+// but uses results of the latest health checks, so that it is cheap enough for readiness probes.
+func (db *DB) Ready() error {
+	policy := db.replicaQuorumPolicy()
+	if policy != nil && policy.FailReadiness && db.isBelowQuorum() {
+		return ErrBelowQuorum
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestQuorumPolicyRequired(t *testing.T) {
+	tests := []struct {
+		policy   QuorumPolicy
+		total    int
+		expected int
+	}{
+		{QuorumPolicy{MinReplicas: 2}, 3, 2},
+		{QuorumPolicy{MinFraction: 0.5}, 3, 2},
+		{QuorumPolicy{MinFraction: 0.5}, 4, 2},
+		{QuorumPolicy{MinReplicas: 3, MinFraction: 0.5}, 4, 3},
+		{QuorumPolicy{}, 4, 0},
+	}
+
+	for _, test := range tests {
+		if actual := test.policy.required(test.total); actual != test.expected {
+			t.Errorf("actual = %d, expected = %d, policy = %+v, total = %d", actual, test.expected, test.policy, test.total)
+		}
+	}
+}
+
+func TestQuorumPolicy(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	var events []EventType
+	db.OnEvent(func(e Event) {
+		events = append(events, e.Type)
+	})
+	db.SetQuorumPolicy(&QuorumPolicy{MinReplicas: 2, FailReadiness: true, SpillToPrimary: true})
+	if err = db.Ready(); err != nil {
+		t.Errorf("error %s when Ready", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db.refreshUnavailableReplicas()
+	if err = db.Ready(); err != ErrBelowQuorum {
+		t.Errorf("actual err = %v, expected = %s", err, ErrBelowQuorum)
+	}
+	p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	if _, err = db.Query(fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when Query", err)
+	}
+	if actual := db.Metrics(); actual.ReadsPrimary != 1 || actual.Fallbacks != 1 {
+		t.Errorf("actual metrics = %+v, expected 1 read spilled to primary", actual)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db.refreshUnavailableReplicas()
+	if err = db.Ready(); err != nil {
+		t.Errorf("error %s when Ready", err)
+	}
+
+	expected := []EventType{EventReplicaDown, EventQuorumLost, EventReplicaUp, EventQuorumRegained}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("actual events = %v, expected = %v", events, expected)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,73 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"math/rand"
+	"time"
+)
+
+// defaultRampUpInitialWeight is the default share of traffic at the start of ramp-up
+const defaultRampUpInitialWeight = 0.1
+
+// RampUpPolicy ramps traffic share of a read replica becoming healthy again
+// (`EventReplicaUp` / `EventReplicaReady`) from `InitialWeight` to full weight linearly over `Window`,
+// instead of instantly rejoining the rotation with cold caches.
+type RampUpPolicy struct {
+	// Window is the duration to reach full weight
+	Window time.Duration
+
+	// InitialWeight is the share (0.0 ~ 1.0) of traffic the read replica gets at the start of ramp-up. Default to 0.1.
+	InitialWeight float64
+}
+
+// weight returns share of traffic elapsed after start of ramp-up
+func (p *RampUpPolicy) weight(elapsed time.Duration) float64 {
+	if elapsed >= p.Window {
+		return 1
+	}
+	return p.InitialWeight + (1-p.InitialWeight)*float64(elapsed)/float64(p.Window)
+}
+
+// SetRampUpPolicy sets the RampUpPolicy of read replicas becoming healthy again.
+// Passing nil makes them get full traffic at once, which is the default.
+func (db *DB) SetRampUpPolicy(p *RampUpPolicy) {
+	if p != nil && (p.InitialWeight <= 0 || p.InitialWeight > 1) {
+		copied := *p
+		copied.InitialWeight = defaultRampUpInitialWeight
+		p = &copied
+	}
+	db.configMutex.Lock()
+	db.rampUpPolicy = p
+	db.configMutex.Unlock()
+}
+
+// replicaRampUpPolicy returns current RampUpPolicy, nil if not set
+func (db *DB) replicaRampUpPolicy() *RampUpPolicy {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.rampUpPolicy
+}
+
+// startRampUp starts ramp-up of r at now, caller must hold countMutex
+func (db *DB) startRampUp(r *sql.DB, now time.Time) {
+	db.rampingSince[r] = now
+}
+
+// rampUpWeight returns share of traffic of r by policy, 1 if r is not in ramp-up. Caller must hold countMutex.
+func (db *DB) rampUpWeight(policy *RampUpPolicy, r *sql.DB) float64 {
+	if policy == nil {
+		return 1
+	}
+	since, ok := db.rampingSince[r]
+	if !ok {
+		return 1
+	}
+	return policy.weight(time.Since(since))
+}
+
+// throttled returns true if r should be skipped for this read by chance of its current weight,
+// which is reduced by rampUp while in ramp-up and by health while flapping. Caller must hold countMutex.
+func (db *DB) throttled(rampUp *RampUpPolicy, health *HealthWeightPolicy, r *sql.DB) bool {
+	weight := db.rampUpWeight(rampUp, r) * db.healthWeight(health, r)
+	return weight < 1 && rand.Float64() >= weight
+}
@@ -0,0 +1,95 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRampUpPolicyWeight(t *testing.T) {
+	p := &RampUpPolicy{Window: 10 * time.Second, InitialWeight: 0.1}
+	tests := []struct {
+		elapsed  time.Duration
+		expected float64
+	}{
+		{0, 0.1},
+		{5 * time.Second, 0.55},
+		{10 * time.Second, 1},
+		{time.Minute, 1},
+	}
+
+	for _, test := range tests {
+		if actual := p.weight(test.elapsed); actual < test.expected-1e-9 || actual > test.expected+1e-9 {
+			t.Errorf("elapsed %s: actual = %f, expected = %f", test.elapsed, actual, test.expected)
+		}
+	}
+}
+
+func TestRampUp(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	db.SetRampUpPolicy(&RampUpPolicy{Window: time.Hour, InitialWeight: 1e-9})
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db.refreshUnavailableReplicas()
+
+	for _, balancer := range []Balancer{nil, &RoundRobinBalancer{}} {
+		db.SetBalancer(balancer)
+		for i := 0; i < 4; i++ {
+			_, target, err := db.SelectReplica(context.Background())
+			if err != nil {
+				t.Fatalf("error %s when SelectReplica", err)
+			}
+			if target.Index != 0 {
+				t.Errorf("actual = %+v, expected replica 0 as replica 1 is in ramp-up, balancer: %T", target, balancer)
+			}
+		}
+
+		// replica in ramp-up serves reads if no other replica is available
+		_, target, err := db.SelectReplica(WithExcludeReplicas(context.Background(), "replica-0"))
+		if err != nil {
+			t.Fatalf("error %s when SelectReplica", err)
+		}
+		if target.Index != 1 {
+			t.Errorf("actual = %+v, expected replica 1, balancer: %T", target, balancer)
+		}
+	}
+	if actual := db.Metrics().Failovers; actual != 0 {
+		t.Errorf("actual failovers: %d, expected: 0", actual)
+	}
+
+	// full weight after the window
+	db.countMutex.Lock()
+	db.rampingSince[r2.db] = time.Now().Add(-time.Hour)
+	db.countMutex.Unlock()
+	db.SetBalancer(nil)
+	selected := map[int]int{}
+	for i := 0; i < 4; i++ {
+		_, target, err := db.SelectReplica(context.Background())
+		if err != nil {
+			t.Fatalf("error %s when SelectReplica", err)
+		}
+		selected[target.Index]++
+	}
+	if selected[0] != 2 || selected[1] != 2 {
+		t.Errorf("actual selected = %v, expected evenly distributed", selected)
+	}
+}
@@ -0,0 +1,275 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OperationReadBudget is the operation of errors of `ReadBudget.Coordinator`
+const OperationReadBudget = "read_budget"
+
+// Defaults of `ReadBudget`
+const (
+	defaultReadBudgetTimeout  = 50 * time.Millisecond
+	defaultRedisBudgetPrefix  = "gosqlrwdb:read_budget:"
+	readBudgetBatchesPerQuota = 100
+)
+
+// ReadBudget limits reads of each read replica to `QPS` per second, collectively across all processes sharing
+// `Coordinator`, as limits of each process are meaningless when hundreds of them read from the same read replicas.
+// Reads are counted by `TargetInfo.Name` of read replicas, which must be the same in all processes,
+// in windows of one second by the clock of each process, so clocks should be in sync.
+// Read replicas over budget are skipped like evicted ones, and reads fail with `ErrNoReplicaAvailable`
+// (subject to `FallbackPolicy`) if all of them are over budget. Reads bypassing auto failover
+// (e.g. by `WithExactReplicaOrder()`) are not limited.
+//
+// Processes reserve reads from Coordinator in batches of `Batch`, so that Coordinator is called
+// once per batch rather than per read; reads reserved but not done in a window are lost for the fleet.
+// Other reads of the read replica wait for a reservation in flight, which is not cancelled as its caller gives up,
+// and callers giving up take no budget.
+//
+// Zero values of `Batch` and `Timeout` mean defaults.
+type ReadBudget struct {
+	// QPS is the maximum number of reads per second of each read replica, must be positive
+	QPS int
+
+	// Coordinator counts reads of the fleet, nil to count reads of this process only
+	Coordinator BudgetCoordinator
+
+	// Batch is the number of reads reserved from Coordinator at once. Default to 1% of QPS, at least 1.
+	Batch int
+
+	// Timeout is the timeout of calls of Coordinator. Default to 50ms.
+	Timeout time.Duration
+
+	// FallbackQPS is the limit of reads per second of each read replica by this process alone while Coordinator fails,
+	// zero to allow reads without limit then. Errors are recorded with `OperationReadBudget` for `LastErrors()`.
+	FallbackQPS int
+}
+
+// BudgetCoordinator counts reads shared by processes, e.g. on Redis by `RedisBudgetCoordinator`
+type BudgetCoordinator interface {
+	// Reserve adds n to the count of key in the window of one second starting at window,
+	// and returns the count after adding. Counts of past windows may be dropped.
+	Reserve(ctx context.Context, key string, window time.Time, n int) (int64, error)
+}
+
+// RedisEvalFunc runs a Lua script on Redis and returns its result, e.g. by go-redis:
+//
+//	func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return client.Eval(ctx, script, keys, args...).Result()
+//	}
+type RedisEvalFunc func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+
+// redisReserveScript increments the counter of a window, expiring it soon after the window
+const redisReserveScript = `local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if v == tonumber(ARGV[1]) then redis.call('PEXPIRE', KEYS[1], ARGV[2]) end
+return v`
+
+// RedisBudgetCoordinator is the reference BudgetCoordinator on Redis, counting each window by a key of its own,
+// which works on Redis Cluster as well. Redis is reached by `Eval` of any client.
+type RedisBudgetCoordinator struct {
+	Eval RedisEvalFunc
+
+	// KeyPrefix is the prefix of keys. Default to `gosqlrwdb:read_budget:`.
+	KeyPrefix string
+}
+
+// Reserve increments the counter of key and window on Redis by n
+func (c RedisBudgetCoordinator) Reserve(ctx context.Context, key string, window time.Time, n int) (int64, error) {
+	prefix := c.KeyPrefix
+	if prefix == "" {
+		prefix = defaultRedisBudgetPrefix
+	}
+	redisKey := prefix + key + ":" + strconv.FormatInt(window.Unix(), 10)
+	v, err := c.Eval(ctx, redisReserveScript, []string{redisKey}, n, int64(2*time.Second/time.Millisecond))
+	if err != nil {
+		return 0, err
+	}
+	count, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected result of Redis: %v", v)
+	}
+	return count, nil
+}
+
+// localBudgetCoordinator is a BudgetCoordinator of this process, keeping counts of the latest window of each key
+type localBudgetCoordinator struct {
+	mu     sync.Mutex
+	counts map[string]localBudgetCount
+}
+
+type localBudgetCount struct {
+	window time.Time
+	count  int64
+}
+
+func (c *localBudgetCoordinator) Reserve(ctx context.Context, key string, window time.Time, n int) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = map[string]localBudgetCount{}
+	}
+	cnt := c.counts[key]
+	if !cnt.window.Equal(window) {
+		cnt = localBudgetCount{window: window}
+	}
+	cnt.count += int64(n)
+	c.counts[key] = cnt
+	return cnt.count, nil
+}
+
+// readBudget is a ReadBudget with reads reserved by each read replica
+type readBudget struct {
+	budget   ReadBudget
+	fallback *localBudgetCoordinator
+	states   []readBudgetState
+}
+
+// readBudgetState is reads reserved for a read replica in the current window
+type readBudgetState struct {
+	mu        sync.Mutex
+	window    time.Time
+	reserved  int
+	exhausted bool
+
+	// refill is closed when the reservation in flight completes, nil if none
+	refill chan struct{}
+}
+
+// SetReadBudget limits reads of each read replica by b, replacing the current budget.
+// Passing nil removes the limit, which is the default.
+// It returns an error wrapping `ErrInvalidConfig` if `QPS` is not positive.
+func (db *DB) SetReadBudget(b *ReadBudget) error {
+	var rb *readBudget
+	if b != nil {
+		copied := *b
+		if copied.QPS <= 0 {
+			return fmt.Errorf("%w: read budget QPS %d is not positive", ErrInvalidConfig, copied.QPS)
+		}
+		if copied.Batch <= 0 {
+			copied.Batch = copied.QPS / readBudgetBatchesPerQuota
+			if copied.Batch < 1 {
+				copied.Batch = 1
+			}
+		}
+		if copied.Timeout <= 0 {
+			copied.Timeout = defaultReadBudgetTimeout
+		}
+		rb = &readBudget{budget: copied, fallback: &localBudgetCoordinator{}, states: make([]readBudgetState, len(db.readreplicas))}
+		if copied.Coordinator == nil {
+			rb.budget.Coordinator = rb.fallback
+		}
+	}
+	db.configMutex.Lock()
+	db.readBudget = rb
+	db.configMutex.Unlock()
+	return nil
+}
+
+// replicaReadBudget returns current readBudget, nil if not set
+func (db *DB) replicaReadBudget() *readBudget {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.readBudget
+}
+
+// takeReadBudget takes a read of r from b, returning false if r is over budget or ctx is done.
+// Reads of r wait for a reservation in flight without holding the lock of r, rather than reserving by themselves.
+func (db *DB) takeReadBudget(ctx context.Context, b *readBudget, r *sql.DB) bool {
+	info := db.targetInfo(r)
+	state := &b.states[info.Index]
+	for {
+		if ctx.Err() != nil {
+			return false
+		}
+		window := time.Now().Truncate(time.Second)
+		state.mu.Lock()
+		if !state.window.Equal(window) {
+			state.window, state.reserved, state.exhausted = window, 0, false
+		}
+		if state.reserved > 0 {
+			state.reserved--
+			state.mu.Unlock()
+			return true
+		}
+		if state.exhausted {
+			state.mu.Unlock()
+			return false
+		}
+		if refill := state.refill; refill != nil {
+			state.mu.Unlock()
+			select {
+			case <-refill:
+				continue
+			case <-ctx.Done():
+				return false
+			}
+		}
+		refill := make(chan struct{})
+		state.refill = refill
+		state.mu.Unlock()
+
+		// reserved for all reads of r, not failing as the caller gives up
+		reserved := db.reserveReadBudget(detach(ctx), b, info, window)
+		state.mu.Lock()
+		state.refill = nil
+		if state.window.Equal(window) {
+			state.reserved += reserved
+			state.exhausted = reserved < b.budget.Batch
+		}
+		state.mu.Unlock()
+		close(refill)
+		if reserved == 0 {
+			db.debugf(DebugRouting, "[takeReadBudget] replica: %s over budget", info.Name)
+		}
+	}
+}
+
+// reserveReadBudget reserves a batch of reads of the read replica of info in window, returning the number granted
+func (db *DB) reserveReadBudget(ctx context.Context, b *readBudget, info TargetInfo, window time.Time) int {
+	n, limit := b.budget.Batch, b.budget.QPS
+	rctx, cancel := context.WithTimeout(ctx, b.budget.Timeout)
+	count, err := b.budget.Coordinator.Reserve(rctx, info.Name, window, n)
+	cancel()
+	if err != nil {
+		db.debugf(DebugError, "[reserveReadBudget] replica: %s err: %s", info.Name, err)
+		db.recordError(info, OperationReadBudget, "", err)
+		if b.budget.FallbackQPS <= 0 {
+			return n
+		}
+		count, _ = b.fallback.Reserve(ctx, info.Name, window, n)
+		limit = b.budget.FallbackQPS
+	}
+	granted := n - int(count-int64(limit))
+	switch {
+	case granted > n:
+		return n
+	case granted < 0:
+		return 0
+	}
+	return granted
+}
+
+// overBudgetSkips returns err with skips of read replicas in overBudget reported by `SkipReasonOverBudget`
+func overBudgetSkips(err error, states map[*sql.DB]*replicaState, overBudget map[*sql.DB]struct{}) error {
+	var noReplica *NoReplicaAvailableError
+	if len(overBudget) == 0 || !errors.As(err, &noReplica) {
+		return err
+	}
+	indexes := make(map[int]struct{}, len(overBudget))
+	for r := range overBudget {
+		indexes[states[r].index] = empty
+	}
+	for i, skip := range noReplica.Replicas {
+		if _, ok := indexes[skip.Target.Index]; ok && skip.Reason == SkipReasonExcluded {
+			noReplica.Replicas[i].Reason = SkipReasonOverBudget
+		}
+	}
+	return err
+}
@@ -0,0 +1,261 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+// budgetCoordinatorMock is a BudgetCoordinator counting all windows together, so that tests do not depend on the clock
+type budgetCoordinatorMock struct {
+	mu      sync.Mutex
+	counts  map[string]int64
+	batches []int
+	err     error
+
+	// entered is notified of each call, which waits for block to be closed, if not nil
+	entered chan struct{}
+	block   chan struct{}
+	ctxErrs []error
+}
+
+func (m *budgetCoordinatorMock) Reserve(ctx context.Context, key string, window time.Time, n int) (int64, error) {
+	if m.block != nil {
+		m.entered <- struct{}{}
+		<-m.block
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ctxErrs = append(m.ctxErrs, ctx.Err())
+	if m.err != nil {
+		return 0, m.err
+	}
+	if m.counts == nil {
+		m.counts = map[string]int64{}
+	}
+	m.counts[key] += int64(n)
+	m.batches = append(m.batches, n)
+	return m.counts[key], nil
+}
+
+func TestSetReadBudget(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+
+	if err := db.SetReadBudget(&ReadBudget{}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrInvalidConfig)
+	}
+	coordinator := &budgetCoordinatorMock{}
+	if err := db.SetReadBudget(&ReadBudget{QPS: 2, Coordinator: coordinator}); err != nil {
+		t.Fatalf("error %s when SetReadBudget", err)
+	}
+	// reads of budget (2 each), of exact replica order, while Coordinator fails, and without budget in Round-Robin
+	for _, r := range []*mydbMock{r0, r1, r0, r1, r0, r1, r0} {
+		r.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	}
+	for i := 0; i < 4; i++ {
+		rows, err := db.Query(fmt.Sprintf(selectQueryTmpl, "*"))
+		if err != nil {
+			t.Fatalf("error %s when Query %d", err, i)
+		}
+		rows.Close()
+	}
+	_, err = db.Query(fmt.Sprintf(selectQueryTmpl, "*"))
+	var noReplica *NoReplicaAvailableError
+	if !errors.Is(err, ErrNoReplicaAvailable) || !errors.As(err, &noReplica) {
+		t.Fatalf("actual err: %v, expected: %s", err, ErrNoReplicaAvailable)
+	}
+	for _, skip := range noReplica.Replicas {
+		if skip.Reason != SkipReasonOverBudget {
+			t.Errorf("actual reason: %s, expected: %s", skip.Reason, SkipReasonOverBudget)
+		}
+	}
+
+	// reads of exact replica order are not limited
+	rows, err := db.QueryContext(WithExactReplicaOrder(context.Background()), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+
+	// reads are allowed while Coordinator fails without FallbackQPS
+	coordinator.err = errors.New("redis is down")
+	if err := db.SetReadBudget(&ReadBudget{QPS: 2, Coordinator: coordinator}); err != nil {
+		t.Fatalf("error %s when SetReadBudget", err)
+	}
+	rows, err = db.Query(fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when Query", err)
+	}
+	rows.Close()
+	_, replicas := db.Targets()
+	if errs := db.LastErrors(replicas[1], 1); len(errs) != 1 || errs[0].Operation != OperationReadBudget {
+		t.Errorf("actual errors: %v, expected: an error of %s", errs, OperationReadBudget)
+	}
+
+	db.SetReadBudget(nil)
+	rows, err = db.Query(fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when Query", err)
+	}
+	rows.Close()
+
+	for _, m := range []*mydbMock{r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+// waitForSecondStart sleeps until the next second if the current one is about to end,
+// so that reads taken in a row fall in the same window of the budget
+func waitForSecondStart() {
+	if now := time.Now(); now.Sub(now.Truncate(time.Second)) > 800*time.Millisecond {
+		time.Sleep(time.Second - now.Sub(now.Truncate(time.Second)))
+	}
+}
+
+func TestReadBudgetBatch(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+
+	tests := []struct {
+		budget   ReadBudget
+		taken    int
+		batches  []int
+		errorful bool
+	}{
+		{ReadBudget{QPS: 10, Batch: 4}, 10, []int{4, 4, 4}, false},
+		{ReadBudget{QPS: 3}, 3, []int{1, 1, 1, 1}, false},
+		{ReadBudget{QPS: 10, Batch: 4, FallbackQPS: 5}, 5, nil, true},
+	}
+	for i, test := range tests {
+		coordinator := &budgetCoordinatorMock{}
+		if test.errorful {
+			coordinator.err = errors.New("redis is down")
+		}
+		test.budget.Coordinator = coordinator
+		if err := db.SetReadBudget(&test.budget); err != nil {
+			t.Fatalf("error %s when SetReadBudget", err)
+		}
+		taken := 0
+		waitForSecondStart()
+		for j := 0; j < 20; j++ {
+			if db.takeReadBudget(context.Background(), db.replicaReadBudget(), db.readreplicas[0]) {
+				taken++
+			}
+		}
+		if taken != test.taken {
+			t.Errorf("actual taken: %d, expected: %d of test %d", taken, test.taken, i)
+		}
+		if !reflect.DeepEqual(coordinator.batches, test.batches) {
+			t.Errorf("actual batches: %v, expected: %v of test %d", coordinator.batches, test.batches, i)
+		}
+	}
+}
+
+func TestReadBudgetRefill(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+	coordinator := &budgetCoordinatorMock{entered: make(chan struct{}, 1), block: make(chan struct{})}
+	if err := db.SetReadBudget(&ReadBudget{QPS: 100, Batch: 2, Coordinator: coordinator}); err != nil {
+		t.Fatalf("error %s when SetReadBudget", err)
+	}
+	budget := db.replicaReadBudget()
+
+	// cancelled callers take no budget
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if db.takeReadBudget(cancelled, budget, r0.db) {
+		t.Errorf("actual budget taken, expected: none by a cancelled caller")
+	}
+
+	// a read waits for the reservation in flight of another one, which completes as its caller gives up,
+	// within a window of one second
+	waitForSecondStart()
+	ctx, cancel := context.WithCancel(context.Background())
+	taken := make(chan bool, 2)
+	go func() { taken <- db.takeReadBudget(ctx, budget, r0.db) }()
+	<-coordinator.entered
+	go func() { taken <- db.takeReadBudget(context.Background(), budget, r0.db) }()
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	close(coordinator.block)
+	results := map[bool]int{}
+	for i := 0; i < 2; i++ {
+		results[<-taken]++
+	}
+	if results[true] != 1 || results[false] != 1 {
+		t.Errorf("actual results: %v, expected: one taken and one given up", results)
+	}
+	if !reflect.DeepEqual(coordinator.batches, []int{2}) || !reflect.DeepEqual(coordinator.ctxErrs, []error{nil}) {
+		t.Errorf("actual batches: %v, ctx errors: %v, expected: [2] reserved once, [<nil>]", coordinator.batches, coordinator.ctxErrs)
+	}
+	if err := r0.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRedisBudgetCoordinator(t *testing.T) {
+	window := time.Unix(1700000000, 0)
+	var keys []string
+	var args []interface{}
+	c := RedisBudgetCoordinator{Eval: func(ctx context.Context, script string, k []string, a ...interface{}) (interface{}, error) {
+		keys, args = k, a
+		return int64(7), nil
+	}}
+	count, err := c.Reserve(context.Background(), "replica-0", window, 5)
+	if err != nil {
+		t.Fatalf("error %s when Reserve", err)
+	}
+	if count != 7 {
+		t.Errorf("actual count: %d, expected: 7", count)
+	}
+	if expected := []string{"gosqlrwdb:read_budget:replica-0:1700000000"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("actual keys: %v, expected: %v", keys, expected)
+	}
+	if expected := []interface{}{5, int64(2000)}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("actual args: %v, expected: %v", args, expected)
+	}
+
+	c.Eval = func(ctx context.Context, script string, k []string, a ...interface{}) (interface{}, error) {
+		return "OK", nil
+	}
+	if _, err := c.Reserve(context.Background(), "replica-0", window, 5); err == nil {
+		t.Errorf("actual no error, expected an error of unexpected result")
+	}
+}
@@ -0,0 +1,44 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+)
+
+// readerEndpoint returns the read replica of `TargetInfo.ReaderEndpoint` for a read excluding read replicas
+// in exclude, nil if none is set or it is skipped. It is skipped if drained or in exclude, and unless
+// bypassAutoFailover, if unavailable, not ready, evicted or excluded by `ExcludeReplica()`.
+func (db *DB) readerEndpoint(exclude map[*sql.DB]struct{}, bypassAutoFailover bool) *sql.DB {
+	r := db.readerEndpointReplica()
+	if r == nil {
+		return nil
+	}
+	if _, excluded := exclude[r]; excluded {
+		return nil
+	}
+	db.countMutex.RLock()
+	_, drained := db.drainedReplicas[r]
+	_, unavailable := db.unavailableReplicas[r]
+	ready := db.ready(r)
+	db.countMutex.RUnlock()
+	if drained {
+		return nil
+	}
+	if !bypassAutoFailover && ((db.needHeartbeat && (unavailable || !ready)) || db.evicted(r)) {
+		db.debugf(DebugEvent, "[readerEndpoint] reader endpoint skipped, unavailable: %t, ready: %t", unavailable, ready)
+		return nil
+	}
+	db.debugf(DebugRouting, "[readerEndpoint] replica idx: %d", db.replicaStates[r].index)
+	return r
+}
+
+// readerEndpointReplica returns the read replica of `TargetInfo.ReaderEndpoint`, nil if none is set
+func (db *DB) readerEndpointReplica() *sql.DB {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	for i, t := range db.replicaTargets {
+		if t.ReaderEndpoint {
+			return db.readreplicas[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReaderEndpoint(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+	if err := db.SetTargetInfo(TargetInfo{Role: RoleReplica, Index: 1, Name: "reader", ReaderEndpoint: true}); err != nil {
+		t.Fatalf("error %s when SetTargetInfo", err)
+	}
+	for _, info := range []TargetInfo{
+		{Role: RoleReplica, Index: 0, Name: "replica-0", ReaderEndpoint: true},
+		{Role: RolePrimary, Name: "primary", ReaderEndpoint: true},
+	} {
+		if err := db.SetTargetInfo(info); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("actual err: %v, expected: %s for %+v", err, ErrInvalidConfig, info)
+		}
+	}
+	query := fmt.Sprintf(selectQueryTmpl, "*")
+	expected := fmt.Sprintf(selectQueryTmpl, "(.+)")
+
+	// reads pass through to the reader endpoint, by Round-Robin or by Balancer
+	for i := 0; i < 4; i++ {
+		if i == 2 {
+			db.SetBalancer(&RoundRobinBalancer{})
+		}
+		r1.mock.ExpectQuery(expected).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+		if _, err := db.QueryContext(context.Background(), query); err != nil {
+			t.Errorf("error %s when QueryContext", err)
+		}
+	}
+	if actual := db.SimulateRoute(context.Background(), query); actual.Target.Name != "reader" ||
+		actual.Reasons[len(actual.Reasons)-1] != "passed through to reader endpoint" {
+		t.Errorf("actual decision: %s, expected: passed through to reader", actual)
+	}
+
+	// reads fail over to other read replicas while the reader endpoint is skipped
+	if err := db.ExcludeReplica("reader", time.Minute); err != nil {
+		t.Fatalf("error %s when ExcludeReplica", err)
+	}
+	r0.mock.ExpectQuery(expected).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	if _, err := db.QueryContext(context.Background(), query); err != nil {
+		t.Errorf("error %s when QueryContext", err)
+	}
+
+	// and to primary DB by FallbackPolicy
+	db.SetFallbackPolicy(&FallbackPolicy{Actions: map[ErrorClass]FallbackAction{ErrorClassNoReplicaAvailable: FallbackRetryPrimary}})
+	if err := db.ExcludeReplica("replica-0", time.Minute); err != nil {
+		t.Fatalf("error %s when ExcludeReplica", err)
+	}
+	p.mock.ExpectQuery(expected).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	if _, err := db.QueryContext(context.Background(), query); err != nil {
+		t.Errorf("error %s when QueryContext", err)
+	}
+
+	// reads excluded by staleness skip the reader endpoint as well
+	for _, name := range []string{"reader", "replica-0"} {
+		if err := db.ExcludeReplica(name, 0); err != nil {
+			t.Fatalf("error %s when ExcludeReplica", err)
+		}
+	}
+	atomic.StoreInt64(&db.replicaStates[r1.db].lag, int64(time.Minute))
+	ctx := WithDirective(context.Background(), RoutingDirective{MaxStaleness: time.Second})
+	if actual := db.SimulateRoute(ctx, query).Target.Name; actual != "replica-0" {
+		t.Errorf("actual target: %s, expected: replica-0 as the reader endpoint is stale", actual)
+	}
+
+	metrics := db.Metrics()
+	if expectedReads := []uint64{1, 4}; !reflect.DeepEqual(metrics.ReadsReplica, expectedReads) || metrics.ReadsPrimary != 1 {
+		t.Errorf("actual reads: %v & %d, expected: %v & 1", metrics.ReadsReplica, metrics.ReadsPrimary, expectedReads)
+	}
+	for _, m := range []*mydbMock{p, r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
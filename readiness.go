@@ -0,0 +1,89 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// defaultReadinessTimeout is the default timeout of each `ReadinessCheck`
+const defaultReadinessTimeout = time.Second
+
+// ReadinessCheck is a heavier check than the liveness ping of health checks, e.g. replication lag
+// or buffer cache warmness by a custom query. Reads are routed only to ready read replicas,
+// but connections to read replicas which are alive but not ready are kept as they are.
+type ReadinessCheck struct {
+	// Check returns nil if r is ready to serve reads
+	Check func(ctx context.Context, r *sql.DB) error
+
+	// Timeout is the timeout of each Check. Default to 1s.
+	Timeout time.Duration
+}
+
+// SetReadinessCheck sets the ReadinessCheck run on alive read replicas by each health check,
+// and runs it at once so that read replicas not ready yet (e.g. freshly provisioned ones) get no reads.
+// `EventReplicaNotReady` / `EventReplicaReady` are emitted when a read replica becomes not ready / ready.
+// Passing nil makes all alive read replicas ready, which is the default.
+// It does nothing if health checks are disabled by `DisableReplicaAutoFailover`.
+func (db *DB) SetReadinessCheck(c *ReadinessCheck) {
+	if c != nil && c.Timeout <= 0 {
+		copied := *c
+		copied.Timeout = defaultReadinessTimeout
+		c = &copied
+	}
+	db.configMutex.Lock()
+	db.readinessCheck = c
+	db.configMutex.Unlock()
+	if db.needHeartbeat {
+		db.refreshUnavailableReplicas()
+	}
+}
+
+// replicaReadinessCheck returns current ReadinessCheck, nil if not set
+func (db *DB) replicaReadinessCheck() *ReadinessCheck {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.readinessCheck
+}
+
+// checkReadiness runs ReadinessCheck on replicas not in failing with ctx,
+// and returns errors of read replicas not ready
+func (db *DB) checkReadiness(ctx context.Context, replicas []*sql.DB, failing map[*sql.DB]error) map[*sql.DB]error {
+	notReady := map[*sql.DB]error{}
+	c := db.replicaReadinessCheck()
+	if c == nil {
+		return notReady
+	}
+	for _, r := range replicas {
+		if _, fails := failing[r]; fails {
+			continue
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, c.Timeout)
+		if !db.probingLag() {
+			checkCtx = context.WithValue(checkCtx, lagRecorderKey{}, db.replicaStates[r])
+		}
+		if err := c.Check(checkCtx, r); err != nil {
+			db.debugf(DebugEvent, "[checkReadiness] replica idx: %d not ready, err: %s", db.replicaStates[r].index, err)
+			notReady[r] = err
+		}
+		cancel()
+	}
+	return notReady
+}
+
+// ready returns true if r passed the last ReadinessCheck, caller must hold countMutex
+func (db *DB) ready(r *sql.DB) bool {
+	_, notReady := db.notReadyReplicas[r]
+	return !notReady
+}
+
+// lagRecorderKey is the context key for the replicaState recording replication lag measured by `ReadinessCheck`
+type lagRecorderKey struct{}
+
+// recordLag records lag of the read replica checked with ctx, if ctx is of a health check
+func recordLag(ctx context.Context, lag time.Duration) {
+	if state, ok := ctx.Value(lagRecorderKey{}).(*replicaState); ok {
+		atomic.StoreInt64(&state.lag, int64(lag))
+	}
+}
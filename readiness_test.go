@@ -0,0 +1,86 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+func TestReadinessCheck(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	var events []Event
+	db.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+	errCold := fmt.Errorf("cache is cold")
+	cold := map[*sql.DB]bool{r2.db: true}
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db.SetReadinessCheck(&ReadinessCheck{Check: func(ctx context.Context, r *sql.DB) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("actual ctx without deadline, expected deadline of Timeout")
+		}
+		if cold[r] {
+			return errCold
+		}
+		return nil
+	}})
+	if len(events) != 1 || events[0].Type != EventReplicaNotReady || events[0].Target.Index != 1 || events[0].Err != errCold {
+		t.Errorf("actual events = %+v, expected %s of replica 1", events, EventReplicaNotReady)
+	}
+	if healthy, total := db.healthyReplicas(); healthy != 1 || total != 2 {
+		t.Errorf("actual healthy replicas: %d of %d, expected: 1 of 2", healthy, total)
+	}
+
+	// not ready replica gets no reads, with or without Balancer
+	for _, balancer := range []Balancer{nil, &RoundRobinBalancer{}} {
+		db.SetBalancer(balancer)
+		for i := 0; i < 3; i++ {
+			_, target, err := db.SelectReplica(context.Background())
+			if err != nil {
+				t.Fatalf("error %s when SelectReplica", err)
+			}
+			if target.Index != 0 {
+				t.Errorf("actual = %+v, expected replica 0, balancer: %T", target, balancer)
+			}
+		}
+	}
+
+	events = nil
+	cold[r2.db] = false
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	db.refreshUnavailableReplicas()
+	if len(events) != 1 || events[0].Type != EventReplicaReady || events[0].Target.Index != 1 {
+		t.Errorf("actual events = %+v, expected %s of replica 1", events, EventReplicaReady)
+	}
+	if healthy, _ := db.healthyReplicas(); healthy != 2 {
+		t.Errorf("actual healthy replicas: %d, expected: 2", healthy)
+	}
+
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
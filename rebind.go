@@ -0,0 +1,72 @@
+package gosqlrwdb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// BindType is the placeholder style of a SQL dialect
+type BindType int
+
+const (
+	// BindQuestion is `?` placeholder style of MySQL, SQLite etc. Queries are dispatched as is.
+	BindQuestion BindType = iota
+
+	// BindDollar is `$1` placeholder style of Postgres
+	BindDollar
+
+	// BindColon is `:arg1` placeholder style of Oracle
+	BindColon
+
+	// BindAt is `@p1` placeholder style of SQL Server
+	BindAt
+)
+
+// Rebind converts `?` placeholders in query to placeholders of bindType, like sqlx.Rebind.
+// `?` in comments, literals and quoted identifiers is left as is.
+func Rebind(bindType BindType, query string) string {
+	var prefix string
+	switch bindType {
+	case BindDollar:
+		prefix = "$"
+	case BindColon:
+		prefix = ":arg"
+	case BindAt:
+		prefix = "@p"
+	default:
+		return query
+	}
+	questions, _, _ := placeholders(query)
+	if len(questions) == 0 {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + len(questions)*(len(prefix)+1))
+	last := 0
+	for n, i := range questions {
+		b.WriteString(query[last:i])
+		b.WriteString(prefix)
+		b.WriteString(strconv.Itoa(n + 1))
+		last = i + 1
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+// SetBindType sets placeholder style of primary DB & read replicas.
+// Queries written with `?` placeholders are rebound to bindType by `Rebind()` before dispatch,
+// so that mixed-driver codebases can route through one wrapper. Default is `BindQuestion` (no rebinding).
+func (db *DB) SetBindType(bindType BindType) {
+	db.configMutex.Lock()
+	db.bindType = bindType
+	db.configMutex.Unlock()
+}
+
+// rebind returns query rebound to placeholder style set by `SetBindType()`
+func (db *DB) rebind(query string) string {
+	db.configMutex.RLock()
+	bindType := db.bindType
+	db.configMutex.RUnlock()
+	return Rebind(bindType, query)
+}
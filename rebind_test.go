@@ -0,0 +1,66 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		bindType BindType
+		query    string
+		expected string
+	}{
+		{BindQuestion, "select * from mytable where a = ? and b = ?", "select * from mytable where a = ? and b = ?"},
+		{BindDollar, "select * from mytable where a = ? and b = ?", "select * from mytable where a = $1 and b = $2"},
+		{BindColon, "select * from mytable where a = ? and b = ?", "select * from mytable where a = :arg1 and b = :arg2"},
+		{BindAt, "select * from mytable where a = ? and b = ?", "select * from mytable where a = @p1 and b = @p2"},
+		{BindDollar, "select '?', \"?\" from mytable /* ? */ where a = ? -- ?", "select '?', \"?\" from mytable /* ? */ where a = $1 -- ?"},
+		{BindDollar, "insert into mytable values (?,?)", "insert into mytable values ($1,$2)"},
+		{BindDollar, "select 1", "select 1"},
+	}
+
+	for _, test := range tests {
+		if actual := Rebind(test.bindType, test.query); actual != test.expected {
+			t.Errorf("actual = %q, expected = %q", actual, test.expected)
+		}
+	}
+}
+
+func TestSetBindType(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	db.SetBindType(BindDollar)
+
+	r1.mock.ExpectQuery(regexp.QuoteMeta("select * from mytable where id = $1")).
+		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	p.mock.ExpectExec(regexp.QuoteMeta("delete from mytable where id = $1")).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rows, err := db.QueryContext(context.Background(), "select * from mytable where id = ?", 1)
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+	if _, err = db.ExecContext(context.Background(), "delete from mytable where id = ?", 1); err != nil {
+		t.Errorf("error %s when ExecContext", err)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
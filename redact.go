@@ -0,0 +1,310 @@
+package gosqlrwdb
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RedactedArg replaces args redacted by `ArgRedactor` without `Hash`
+const RedactedArg = "[redacted]"
+
+// Redactor redacts args of statements before they reach hooks, `QueryCapture` and other observability of DB,
+// so that personal data never leaks through them. Statements are always run with args as they are.
+type Redactor interface {
+	// Redact returns args of query to be observed. Args must not be modified in place.
+	Redact(query string, args []interface{}) []interface{}
+}
+
+// RedactorFunc is a Redactor of a function
+type RedactorFunc func(query string, args []interface{}) []interface{}
+
+// Redact calls f
+func (f RedactorFunc) Redact(query string, args []interface{}) []interface{} {
+	return f(query, args)
+}
+
+// ArgRedactor is a Redactor of args selected by position or by the column they are compared with or assigned to.
+// Columns are taken from SQL heuristically, e.g. `email` of `email = ?`, `u.email IN (?, ?)`, `SET email = ?`
+// and `INSERT INTO users (email) VALUES (?)`, and from names of `sql.NamedArg` args.
+type ArgRedactor struct {
+	// All redacts all args
+	All bool
+
+	// Indexes are indexes (from 0) of args redacted in all statements
+	Indexes []int
+
+	// Columns are names of columns whose args are redacted, matched case-insensitively as substrings of names,
+	// e.g. `password` redacts args of `password_hash`
+	Columns []string
+
+	// Hash replaces redacted args by `sha256:` followed by a short hex hash of Salt and the value,
+	// so that equal values can be correlated, instead of `RedactedArg`
+	Hash bool
+	Salt string
+}
+
+// Redact returns args with ones selected by r replaced
+func (r ArgRedactor) Redact(query string, args []interface{}) []interface{} {
+	if len(args) == 0 {
+		return args
+	}
+	var positional map[int]string
+	var named map[string]string
+	if !r.All && len(r.Columns) > 0 {
+		positional, named = argColumns(query)
+	}
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		n, isNamed := arg.(sql.NamedArg)
+		redact := r.All || containsInt(r.Indexes, i)
+		if !redact && len(r.Columns) > 0 {
+			if isNamed {
+				redact = r.matchColumn(n.Name) || r.matchColumn(named[toLowerASCII(n.Name)])
+			} else {
+				redact = r.matchColumn(positional[i])
+			}
+		}
+		switch {
+		case !redact:
+			redacted[i] = arg
+		case isNamed:
+			redacted[i] = sql.Named(n.Name, r.replacement(n.Value))
+		default:
+			redacted[i] = r.replacement(arg)
+		}
+	}
+	return redacted
+}
+
+// matchColumn returns true if column is one of `Columns`
+func (r ArgRedactor) matchColumn(column string) bool {
+	if column == "" {
+		return false
+	}
+	column = toLowerASCII(column)
+	for _, c := range r.Columns {
+		if strings.Contains(column, toLowerASCII(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+// replacement returns what a redacted value is replaced by
+func (r ArgRedactor) replacement(value interface{}) interface{} {
+	if !r.Hash {
+		return RedactedArg
+	}
+	sum := sha256.Sum256([]byte(r.Salt + fmt.Sprintf("%v", value)))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// SetRedactor sets the Redactor of args of statements passed to hooks and `QueryCapture`.
+// Passing nil observes args as they are, which is the default.
+// Errors and debug output of DB never contain args.
+func (db *DB) SetRedactor(r Redactor) {
+	db.configMutex.Lock()
+	db.redactor = r
+	db.configMutex.Unlock()
+}
+
+// redactArgs returns args of query redacted by the Redactor if set
+func (db *DB) redactArgs(query string, args []interface{}) []interface{} {
+	db.configMutex.RLock()
+	r := db.redactor
+	db.configMutex.RUnlock()
+	if r == nil || len(args) == 0 {
+		return args
+	}
+	return r.Redact(query, args)
+}
+
+// redacting returns true if a Redactor is set
+func (db *DB) redacting() bool {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.redactor != nil
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// argColumns returns lower-cased names of columns of placeholders in query, by index of positional args
+// (`?` in order or n-1 of `$n`) and by name of named placeholders (`:name` / `@name`)
+func argColumns(query string) (positional map[int]string, named map[string]string) {
+	positional, named = map[int]string{}, map[string]string{}
+	tokens := argTokens(query)
+	inserted := insertedColumns(tokens)
+	question := 0
+	for i, token := range tokens {
+		if !isPlaceholderToken(token) {
+			continue
+		}
+		column, ok := inserted[i]
+		if !ok {
+			column = comparedColumn(tokens, i)
+		}
+		switch token[0] {
+		case '?':
+			positional[question] = column
+			question++
+		case '$':
+			if n, err := strconv.Atoi(token[1:]); err == nil && column != "" {
+				positional[n-1] = column
+			}
+		default:
+			named[token[1:]] = column
+		}
+	}
+	return positional, named
+}
+
+// comparedColumn returns the column compared with or assigned to the placeholder of tokens[i],
+// e.g. `email` of `u.email = ?`, `email NOT IN (?, ?)` or `email LIKE ?`; "" if none
+func comparedColumn(tokens []string, i int) string {
+	operator := false
+	for j := i - 1; j >= 0; j-- {
+		switch t := tokens[j]; {
+		case t == "(" || t == "," || t == "not" || isPlaceholderToken(t):
+		case t == "and" && j >= 2 && isPlaceholderToken(tokens[j-1]) && tokens[j-2] == "between":
+			// the upper bound of `BETWEEN ? AND ?`
+		case isOperatorToken(t) || t == "in" || t == "like" || t == "ilike" || t == "between":
+			operator = true
+		case t == ")" || t == "." || t == "'":
+			return ""
+		default:
+			if operator {
+				return t
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// insertedColumns returns columns of placeholders in `VALUES` of `INSERT INTO t (a, b) VALUES (?, ?), (?, ?)`
+// by index of tokens
+func insertedColumns(tokens []string) map[int]string {
+	columns := map[int]string{}
+	for i, token := range tokens {
+		if token != "values" || i == 0 || tokens[i-1] != ")" {
+			continue
+		}
+		// column list before VALUES
+		var names []string
+		j := i - 2
+		for ; j >= 0 && tokens[j] != "("; j-- {
+			if tokens[j] != "," && tokens[j] != "." && (j+1 == i-1 || tokens[j+1] == ",") {
+				names = append([]string{tokens[j]}, names...)
+			}
+		}
+		if j < 0 {
+			continue
+		}
+		// tuples after VALUES
+		depth, k := 0, 0
+		for j = i + 1; j < len(tokens); j++ {
+			switch t := tokens[j]; {
+			case t == "(":
+				depth++
+				if depth == 1 {
+					k = 0
+				}
+			case t == ")":
+				depth--
+			case t == "," && depth == 1:
+				k++
+			case depth == 1 && isPlaceholderToken(t) && k < len(names):
+				columns[j] = names[k]
+			case depth == 0 && t != ",":
+				j = len(tokens)
+			}
+		}
+	}
+	return columns
+}
+
+// argTokens returns lower-cased words of query with quoted identifiers unquoted, placeholders as `?`, `$n` or
+// `:name` (for `@name` as well), runs of `=<>!` as operators, `.`, `,`, `(` and `)` as tokens of their own,
+// and `'` for each literal. Comments are skipped.
+func argTokens(query string) []string {
+	var tokens []string
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			i = skipLineComment(query, i+2)
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			i = skipBlockComment(query, i+2)
+		case c == '\'':
+			tokens = append(tokens, "'")
+			i = skipQuoted(query, i+1, c)
+		case c == '"' || c == '`':
+			end := skipQuoted(query, i+1, c)
+			tokens = append(tokens, toLowerASCII(strings.Trim(query[i:end], string(c))))
+			i = end
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			start := i
+			for i++; i < len(query) && query[i] >= '0' && query[i] <= '9'; i++ {
+			}
+			tokens = append(tokens, query[start:i])
+		case c == '$':
+			end := skipDollarQuoted(query, i)
+			if end > i+1 {
+				tokens = append(tokens, "'")
+			}
+			i = end
+		case c == '?':
+			tokens = append(tokens, "?")
+			i++
+		case (c == ':' || c == '@') && i+1 < len(query) && query[i+1] == c:
+			// Postgres type cast or MySQL system variable, skipped with its name,
+			// so that the column of `id::text = ?` is `id`
+			for i += 2; i < len(query) && isWordByte(query[i]); i++ {
+			}
+		case (c == ':' || c == '@') && isNamedPlaceholder(query, i):
+			end := skipNamedPlaceholder(query, i)
+			tokens = append(tokens, ":"+toLowerASCII(query[i+1:end]))
+			i = end
+		case isWordByte(c):
+			start := i
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			tokens = append(tokens, toLowerASCII(query[start:i]))
+		case c == '=' || c == '<' || c == '>' || c == '!':
+			start := i
+			for i < len(query) && strings.IndexByte("=<>!", query[i]) >= 0 {
+				i++
+			}
+			tokens = append(tokens, query[start:i])
+		case c == '.' || c == ',' || c == '(' || c == ')':
+			tokens = append(tokens, query[i:i+1])
+			i++
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// isPlaceholderToken returns true if token of `argTokens()` is a placeholder
+func isPlaceholderToken(token string) bool {
+	return token == "?" || (len(token) > 1 && (token[0] == '$' || token[0] == ':'))
+}
+
+// isOperatorToken returns true if token of `argTokens()` is a comparison operator
+func isOperatorToken(token string) bool {
+	return strings.IndexByte("=<>!", token[0]) >= 0
+}
@@ -0,0 +1,102 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestArgColumns(t *testing.T) {
+	tests := []struct {
+		query      string
+		positional map[int]string
+		named      map[string]string
+	}{
+		{"SELECT * FROM users u WHERE u.email = ? AND age > ? LIMIT ?", map[int]string{0: "email", 1: "age", 2: ""}, map[string]string{}},
+		{"SELECT * FROM users WHERE name NOT IN (?, ?) AND created BETWEEN ? AND ?", map[int]string{0: "name", 1: "name", 2: "created", 3: "created"}, map[string]string{}},
+		{"SELECT * FROM users WHERE lower(email) = ? OR phone LIKE ? -- memo = ?", map[int]string{0: "", 1: "phone"}, map[string]string{}},
+		{`INSERT INTO users ("Email", u.phone, age) VALUES (?, lower(?), 1), (?, ?, ?)`, map[int]string{0: "email", 1: "", 2: "email", 3: "phone", 4: "age"}, map[string]string{}},
+		{"UPDATE users SET email = $2, age = 'x' WHERE id = $1", map[int]string{0: "id", 1: "email"}, map[string]string{}},
+		{"SELECT * FROM users WHERE email = :mail AND id::text = @id", map[int]string{}, map[string]string{"mail": "email", "id": "id"}},
+	}
+	for _, test := range tests {
+		positional, named := argColumns(test.query)
+		if !reflect.DeepEqual(positional, test.positional) || !reflect.DeepEqual(named, test.named) {
+			t.Errorf("actual = %v, %v, expected = %v, %v of %q", positional, named, test.positional, test.named, test.query)
+		}
+	}
+}
+
+func TestArgRedactor(t *testing.T) {
+	query := "SELECT * FROM users WHERE email = ? AND age > ? AND id = ?"
+	args := []interface{}{"a@example.com", 20, 3}
+	tests := []struct {
+		redactor ArgRedactor
+		expected []interface{}
+	}{
+		{ArgRedactor{}, args},
+		{ArgRedactor{All: true}, []interface{}{RedactedArg, RedactedArg, RedactedArg}},
+		{ArgRedactor{Indexes: []int{2}}, []interface{}{"a@example.com", 20, RedactedArg}},
+		{ArgRedactor{Columns: []string{"EMAIL"}}, []interface{}{RedactedArg, 20, 3}},
+	}
+	for _, test := range tests {
+		if actual := test.redactor.Redact(query, args); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("actual = %v, expected = %v of %+v", actual, test.expected, test.redactor)
+		}
+	}
+	if args[0] != "a@example.com" {
+		t.Errorf("actual args = %v, expected unmodified", args)
+	}
+
+	hashed := ArgRedactor{Columns: []string{"mail"}, Hash: true, Salt: "s"}.Redact(
+		"SELECT * FROM users WHERE email = :email OR backup = @backup",
+		[]interface{}{sql.Named("email", "a@example.com"), sql.Named("backup", "a@example.com")})
+	first, ok := hashed[0].(sql.NamedArg)
+	if !ok || first.Name != "email" || !strings.HasPrefix(first.Value.(string), "sha256:") || len(first.Value.(string)) != 23 {
+		t.Fatalf("actual = %v, expected hashed named arg", hashed)
+	}
+	if second := hashed[1].(sql.NamedArg); second.Value != "a@example.com" {
+		t.Errorf("actual = %v, expected arg of column backup as it is", second)
+	}
+	if other := (ArgRedactor{All: true, Hash: true, Salt: "t"}).Redact("", []interface{}{"a@example.com"}); other[0] == first.Value {
+		t.Errorf("actual same hash %v of another salt", other[0])
+	}
+}
+
+func TestSetRedactor(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	h := &recordingHook{}
+	db.AddHook(h)
+	db.SetRedactor(ArgRedactor{Columns: []string{"email"}})
+	if err = db.SetQueryCapture(&QueryCapture{Digests: []string{"UPDATE users SET email = ? WHERE id = ?"}}); err != nil {
+		t.Fatalf("error %s when SetQueryCapture", err)
+	}
+
+	p.mock.ExpectExec("UPDATE users").WithArgs("a@example.com", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err = db.ExecContext(context.Background(), "UPDATE users SET email = ? WHERE id = ?", "a@example.com", 1); err != nil {
+		t.Fatalf("error %s when ExecContext", err)
+	}
+	expected := []interface{}{RedactedArg, 1}
+	if len(h.before) != 1 || !reflect.DeepEqual(h.before[0].Args, expected) || !reflect.DeepEqual(h.after[0].Args, expected) {
+		t.Errorf("actual hooked = %+v, expected args %v", h.before, expected)
+	}
+	if captured := db.CapturedStatements(); len(captured) != 1 || !reflect.DeepEqual(captured[0].Args, expected) {
+		t.Errorf("actual captured = %+v, expected args %v", captured, expected)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
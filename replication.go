@@ -0,0 +1,89 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Replication is how a read replica replicates primary DB
+type Replication int
+
+const (
+	// ReplicationPhysical replicates all of primary DB, e.g. streaming replication or binlog replication.
+	// It is the default.
+	ReplicationPhysical Replication = iota
+
+	// ReplicationLogical replicates some tables only, e.g. a logical standby or a subscription of a publication,
+	// which may miss other tables, objects and DDL. Reads of tables not in `TargetInfo.ReplicatedTables`
+	// are never routed to the read replica.
+	ReplicationLogical
+)
+
+func (r Replication) String() string {
+	switch r {
+	case ReplicationPhysical:
+		return "physical"
+	case ReplicationLogical:
+		return "logical"
+	default:
+		return "unknown"
+	}
+}
+
+// SetReplicatedTables sets tables replicated by the read replica of `ReplicationLogical` named replica,
+// e.g. tables of the publication it subscribes. Names are matched like `SetPrimaryTables()`.
+// Reads of other tables are never routed to the read replica, while reads without tables (e.g. `SELECT 1`) are.
+// Calling it without tables means the read replica replicates no table, which is the default.
+// It returns an error wrapping `ErrInvalidConfig` if no read replica is named replica.
+func (db *DB) SetReplicatedTables(replica string, tables ...string) error {
+	set := make(map[string]struct{}, len(tables))
+	for _, t := range tables {
+		set[toLowerASCII(t)] = empty
+	}
+	db.configMutex.Lock()
+	defer db.configMutex.Unlock()
+	for i, t := range db.replicaTargets {
+		if t.Name != replica {
+			continue
+		}
+		if db.replicatedTables == nil {
+			db.replicatedTables = map[int]map[string]struct{}{}
+		}
+		db.replicatedTables[i] = set
+		return nil
+	}
+	return fmt.Errorf("%w: no replica named %q", ErrInvalidConfig, replica)
+}
+
+// hasLogicalReplicas returns true if any read replica is of `ReplicationLogical`
+func (db *DB) hasLogicalReplicas() bool {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	for _, t := range db.replicaTargets {
+		if t.Replication == ReplicationLogical {
+			return true
+		}
+	}
+	return false
+}
+
+// replicates returns true if the read replica of index replicates all of tables taken by `queryTables()`.
+// It must be called with configMutex held.
+func (db *DB) replicates(index int, tables []string) bool {
+	if db.replicaTargets[index].Replication != ReplicationLogical {
+		return true
+	}
+	replicated := db.replicatedTables[index]
+	for _, table := range tables {
+		if _, ok := replicated[table]; ok {
+			continue
+		}
+		if i := strings.LastIndexByte(table, '.'); i >= 0 {
+			if _, ok := replicated[table[i+1:]]; ok {
+				continue
+			}
+		}
+		return false
+	}
+	return true
+}
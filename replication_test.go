@@ -0,0 +1,80 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReplicationString(t *testing.T) {
+	tests := []struct {
+		replication Replication
+		expected    string
+	}{
+		{ReplicationPhysical, "physical"},
+		{ReplicationLogical, "logical"},
+		{Replication(9), "unknown"},
+	}
+
+	for _, test := range tests {
+		if actual := test.replication.String(); actual != test.expected {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+}
+
+func TestSetReplicatedTables(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	if err = db.SetTargetInfo(TargetInfo{Role: RoleReplica, Index: 1, Name: "logical", Replication: ReplicationLogical}); err != nil {
+		t.Fatalf("error %s when SetTargetInfo", err)
+	}
+	if err = db.SetReplicatedTables("unknown", "orders"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrInvalidConfig)
+	}
+	if err = db.SetReplicatedTables("logical", "Orders"); err != nil {
+		t.Fatalf("error %s when SetReplicatedTables", err)
+	}
+
+	tests := []struct {
+		query   string
+		logical bool
+	}{
+		{"SELECT * FROM users", false},
+		{"SELECT * FROM orders o JOIN users u ON o.user_id = u.id", false},
+		{"SELECT * FROM public.orders", true},
+		{"SELECT 1", true},
+	}
+	for _, test := range tests {
+		logicalReads := 0
+		for i := 0; i < 4; i++ {
+			r1.mock.ExpectQuery("SELECT (.+)").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+			r2.mock.ExpectQuery("SELECT (.+)").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+			rows, err := db.QueryRowsContext(context.Background(), test.query)
+			if err != nil {
+				t.Fatalf("error %s when QueryRowsContext of %q", err, test.query)
+			}
+			if rows.Target().Index == 1 {
+				logicalReads++
+			}
+			rows.Close()
+		}
+		if (logicalReads > 0) != test.logical {
+			t.Errorf("actual reads on logical replica: %d, expected any: %t of %q", logicalReads, test.logical, test.query)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Result is the `sql.Result` returned by `Exec()` and `ExecContext()`,
+// exposing routing context of the execution so that callers and middlewares can log write outcomes:
+//
+//	res, err := db.ExecContext(ctx, query, args...)
+//	if r, ok := res.(*mydb.Result); ok {
+//		log.Printf("target: %s, attempts: %d, duration: %s", r.Target.Role, r.Attempts, r.Duration)
+//	}
+type Result struct {
+	sql.Result
+
+	// Target is the DB the execution was routed to
+	Target TargetInfo
+
+	// Attempts is the number of attempts of the execution
+	Attempts int
+
+	// Duration is the time taken by the execution including all attempts
+	Duration time.Duration
+
+	// Batch is the number of inserts combined into the execution by `SetInsertBatching()`, 0 if not combined
+	Batch int
+}
+
+// newResult returns res wrapped in `*Result`, or nil if res is nil
+func newResult(res sql.Result, target TargetInfo, attempts int, start time.Time) sql.Result {
+	if res == nil {
+		return nil
+	}
+	return &Result{
+		Result:   res,
+		Target:   target,
+		Attempts: attempts,
+		Duration: time.Since(start),
+	}
+}
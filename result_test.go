@@ -0,0 +1,61 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestExecResult(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	p.mock.ExpectExec(fmt.Sprintf(insertQueryTmpl, "")).WillReturnResult(sqlmock.NewResult(2, 1))
+	res, err := db.ExecContext(context.Background(), fmt.Sprintf(insertQueryTmpl, "values (?, ?)"), 2, "2")
+	if err != nil {
+		t.Fatalf("error %s when ExecContext", err)
+	}
+	r, ok := res.(*Result)
+	if !ok {
+		t.Fatalf("actual result type = %T, expected = *Result", res)
+	}
+	if r.Target != (TargetInfo{Role: RolePrimary, Name: "primary", Weight: 1}) || r.Attempts != 1 || r.Duration <= 0 {
+		t.Errorf("actual result = %+v", r)
+	}
+	if n, _ := r.RowsAffected(); n != 1 {
+		t.Errorf("actual rows affected = %d, expected = 1", n)
+	}
+	if id, _ := r.LastInsertId(); id != 2 {
+		t.Errorf("actual last insert id = %d, expected = 2", id)
+	}
+
+	// retried on a stale connection
+	p.mock.ExpectExec(fmt.Sprintf(insertQueryTmpl, "")).WillReturnError(sql.ErrConnDone)
+	p.mock.ExpectExec(fmt.Sprintf(insertQueryTmpl, "")).WillReturnResult(sqlmock.NewResult(3, 1))
+	if res, err = db.Exec(fmt.Sprintf(insertQueryTmpl, "values (?, ?)"), 3, "3"); err != nil {
+		t.Fatalf("error %s when Exec", err)
+	}
+	if actual := res.(*Result).Attempts; actual != 2 {
+		t.Errorf("actual attempts = %d, expected = 2", actual)
+	}
+
+	p.mock.ExpectExec(fmt.Sprintf(insertQueryTmpl, "")).WillReturnError(fmt.Errorf("driver error"))
+	if res, err = db.Exec(fmt.Sprintf(insertQueryTmpl, "values (?, ?)"), 2, "2"); err == nil || res != nil {
+		t.Errorf("actual result = %v, err = %v, expected nil result and error", res, err)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
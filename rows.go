@@ -0,0 +1,103 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Rows wraps `*sql.Rows` returned by `QueryRows()` and `QueryRowsContext()`.
+// It has the same methods as `*sql.Rows`, records number of rows read and time-to-close
+// of the target in `RoutingMetrics.RowsPrimary` / `RoutingMetrics.RowsReplica`,
+// and exposes the target it was routed to.
+//
+// As read latency observed by `QueryContext()` is measured to the first byte only,
+// Rows reveals slow row streaming from specific read replicas.
+type Rows struct {
+	*sql.Rows
+
+	db        *DB
+	target    TargetInfo
+	start     time.Time
+	count     uint64
+	closeOnce sync.Once
+}
+
+// Target returns the DB the query was routed to
+func (rs *Rows) Target() TargetInfo {
+	return rs.target
+}
+
+// Next is `sql.Rows.Next()` counting rows read
+func (rs *Rows) Next() bool {
+	if rs.Rows.Next() {
+		rs.count++
+		return true
+	}
+	// rows are closed automatically by sql.Rows when there is no more row
+	rs.record()
+	return false
+}
+
+// Close is `sql.Rows.Close()` recording number of rows read and time-to-close
+func (rs *Rows) Close() error {
+	err := rs.Rows.Close()
+	rs.record()
+	return err
+}
+
+// record records statistics of rs once
+func (rs *Rows) record() {
+	rs.closeOnce.Do(func() {
+		rs.db.untrackRows(rs)
+		rs.db.metrics.countRows(rs.target, rs.count, time.Since(rs.start))
+	})
+}
+
+// QueryRows is `Query()` returning `*Rows`
+func (db *DB) QueryRows(query string, args ...interface{}) (*Rows, error) {
+	return db.QueryRowsContext(context.Background(), query, args...)
+}
+
+// QueryRowsContext is `QueryContext()` returning `*Rows`
+func (db *DB) QueryRowsContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	cluster, err := db.partitionCluster(ctx, query)
+	if err != nil {
+		db.debugf(DebugError, "[QueryRowsContext] partition err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if cluster != nil {
+		return cluster.QueryRowsContext(ctx, query, args...)
+	}
+	start := time.Now()
+	rows, tgtdb, err := db.queryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	rs := &Rows{Rows: rows, db: db, target: db.targetInfo(tgtdb), start: start}
+	db.trackRows(rs, query)
+	return rs, nil
+}
+
+// QueryEach runs the query like `QueryContext()` and calls fn for each row, with scan which is `Rows.Scan()` of the row.
+// Iteration stops at the first error returned by fn, which is returned as it is.
+// Rows are always closed before it returns, so that connections of read replicas are not leaked,
+// and the error of iteration (i.e. `Rows.Err()`) is returned if any.
+func (db *DB) QueryEach(ctx context.Context, query string, args []interface{}, fn func(scan func(dest ...interface{}) error) error) error {
+	rows, err := db.QueryRowsContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows.Scan); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return rows.Close()
+}
@@ -0,0 +1,133 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestQueryRowsContext(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).
+		WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1).AddRow(2).AddRow(3))
+	rows, err := db.QueryRowsContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryRowsContext", err)
+	}
+	if actual := rows.Target(); actual != (TargetInfo{Role: RoleReplica, Index: 0, Name: "replica-0", Weight: 1}) {
+		t.Errorf("actual target = %+v, expected replica 0", actual)
+	}
+	var sum int
+	for rows.Next() {
+		var v int
+		if err = rows.Scan(&v); err != nil {
+			t.Fatalf("error %s when Scan", err)
+		}
+		sum += v
+	}
+	rows.Close()
+	if sum != 6 {
+		t.Errorf("actual sum = %d, expected = 6", sum)
+	}
+
+	// closed before reading all rows
+	p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).
+		WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1).AddRow(2))
+	rows, err = db.QueryRowsContext(WithPrimary(context.Background()), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryRowsContext", err)
+	}
+	rows.Next()
+	rows.Close()
+
+	m := db.Metrics()
+	if actual := m.RowsReplica[0]; actual.Count != 1 || actual.Rows != 3 || actual.TimeToClose <= 0 {
+		t.Errorf("actual replica 0 rows metrics = %+v", actual)
+	}
+	if actual := m.RowsReplica[1]; actual.Count != 0 {
+		t.Errorf("actual replica 1 rows metrics = %+v", actual)
+	}
+	if actual := m.RowsPrimary; actual.Count != 1 || actual.Rows != 1 {
+		t.Errorf("actual primary rows metrics = %+v", actual)
+	}
+
+	db.ResetMetrics()
+	if actual := db.Metrics().RowsReplica[0]; actual != (RowsMetrics{}) {
+		t.Errorf("actual replica 0 rows metrics = %+v after ResetMetrics", actual)
+	}
+	if _, err = db.QueryRows(fmt.Sprintf(deleteQuueryTmpl, "")); err != ErrNotQuerySQL {
+		t.Errorf("actual err = %v, expected = %s", err, ErrNotQuerySQL)
+	}
+}
+
+func TestQueryEach(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	errStop := errors.New("stop")
+	errRow := errors.New("row error")
+	tests := []struct {
+		rows        *sqlmock.Rows
+		stopAt      int
+		expectedSum int
+		expectedErr error
+	}{
+		{sqlmock.NewRows([]string{"column1"}).AddRow(1).AddRow(2).AddRow(3), 0, 6, nil},
+		{sqlmock.NewRows([]string{"column1"}).AddRow(1).AddRow(2).AddRow(3), 2, 3, errStop},
+		{sqlmock.NewRows([]string{"column1"}).AddRow(1).AddRow(2).RowError(1, errRow), 0, 1, errRow},
+	}
+	for i, test := range tests {
+		r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(test.rows).RowsWillBeClosed()
+		sum, n := 0, 0
+		err := db.QueryEach(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"), nil, func(scan func(dest ...interface{}) error) error {
+			var v int
+			if err := scan(&v); err != nil {
+				return err
+			}
+			sum += v
+			if n++; n == test.stopAt {
+				return errStop
+			}
+			return nil
+		})
+		if err != test.expectedErr {
+			t.Errorf("%d: actual err = %v, expected = %v", i, err, test.expectedErr)
+		}
+		if sum != test.expectedSum {
+			t.Errorf("%d: actual sum = %d, expected = %d", i, sum, test.expectedSum)
+		}
+		if err := r1.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%d: there were unfulfilled expectations: %s", i, err)
+		}
+	}
+
+	if err := db.QueryEach(context.Background(), fmt.Sprintf(deleteQuueryTmpl, ""), nil, nil); err != ErrNotQuerySQL {
+		t.Errorf("actual err = %v, expected = %s", err, ErrNotQuerySQL)
+	}
+}
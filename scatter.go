@@ -0,0 +1,131 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// TargetRows is the result of `ScatterQuery()` on a read replica
+type TargetRows struct {
+	Target TargetInfo
+
+	// Rows is the result of the query, nil if Err is not nil. It must be closed by the caller.
+	Rows *Rows
+
+	Err error
+}
+
+// ScatterQuery runs the same read on every healthy read replica concurrently, and returns results of each,
+// ordered by index of read replicas. It is useful for consistency checks, cache warms and administrative inspection.
+//
+// Read replicas unavailable, not ready, evicted, drained or excluded by `WithExcludeReplicas()` are skipped.
+// The returned error combines errors of all read replicas; results are returned even if some fail,
+// so `Rows` of succeeded ones must still be closed.
+// `ErrNoReplicaAvailable` is returned if there is no healthy read replica.
+func (db *DB) ScatterQuery(ctx context.Context, query string, args ...interface{}) ([]TargetRows, error) {
+	err := checkNotInTx(ctx, "ScatterQuery")
+	if err == nil {
+		err = db.checkDirectives(ctx, "ScatterQuery", query, false)
+	}
+	if err == nil {
+		err = db.validateQueryContext(ctx, query, args...)
+	}
+	if forcePrimary, _ := checkExplain(query); err == nil && forcePrimary {
+		// EXPLAIN ANALYZE of writes is never run on read replicas
+		err = ErrNotQuerySQL
+	}
+	if err != nil {
+		db.debugf(DebugError, "[ScatterQuery] validate err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if !DoValidateNew && len(db.readreplicas) == 0 {
+		return nil, ErrNotProvidedReplicas
+	}
+	ctx = db.withQueryTables(ctx, query)
+	query = db.rebind(query)
+	replicas := db.healthyReplicaList(ctx)
+	if len(replicas) == 0 {
+		err = db.noReplicaAvailable(db.excludedReplicas(ctx), false)
+		db.metrics.countError(err)
+		return nil, err
+	}
+
+	results := make([]TargetRows, len(replicas))
+	var wg sync.WaitGroup
+	for i, r := range replicas {
+		wg.Add(1)
+		go func(i int, r *sql.DB) {
+			defer wg.Done()
+			results[i] = db.scatterQuery(ctx, r, query, args)
+		}(i, r)
+	}
+	wg.Wait()
+
+	var errs error
+	for _, result := range results {
+		errs = multierr.Append(errs, result.Err)
+	}
+	return results, errs
+}
+
+// scatterQuery runs query on read replica r for `ScatterQuery()`
+func (db *DB) scatterQuery(ctx context.Context, r *sql.DB, query string, args []interface{}) TargetRows {
+	ctx, stmt := db.beginStatement(ctx, "ScatterQuery", query, args)
+	db.countRead(r)
+	state := db.replicaStates[r]
+	atomic.AddInt64(&state.inflight, 1)
+	defer atomic.AddInt64(&state.inflight, -1)
+
+	start := time.Now()
+	var rows *sql.Rows
+	err := db.runStatement(ctx, stmt, r, func(query string) error {
+		var err error
+		rows, err = r.QueryContext(ctx, query, args...)
+		return err
+	})
+	db.observe(ctx, r, start, err)
+	target := db.targetInfo(r)
+	if err != nil {
+		db.metrics.countError(err)
+		return TargetRows{Target: target, Err: err}
+	}
+	return TargetRows{Target: target, Rows: &Rows{Rows: rows, db: db, target: target, start: start}}
+}
+
+// healthyReplicaList returns read replicas passing the last health check (including `ReadinessCheck`),
+// not evicted, not drained and not excluded by `WithExcludeReplicas()` in ctx
+func (db *DB) healthyReplicaList(ctx context.Context) []*sql.DB {
+	if db.single {
+		return db.readreplicas
+	}
+	exclude := db.excludedReplicas(ctx)
+	replicas := make([]*sql.DB, 0, len(db.readreplicas))
+	db.countMutex.RLock()
+	for _, r := range db.readreplicas {
+		if _, drained := db.drainedReplicas[r]; drained {
+			continue
+		}
+		if _, excluded := exclude[r]; excluded {
+			continue
+		}
+		if _, unavailable := db.unavailableReplicas[r]; db.needHeartbeat && (unavailable || !db.ready(r)) {
+			continue
+		}
+		replicas = append(replicas, r)
+	}
+	db.countMutex.RUnlock()
+
+	healthy := replicas[:0]
+	for _, r := range replicas {
+		if !db.evicted(r) {
+			healthy = append(healthy, r)
+		}
+	}
+	return healthy
+}
@@ -0,0 +1,73 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestScatterQuery(t *testing.T) {
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r3, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	p.mock.ExpectPing()
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	r3.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	db := New(p.db, r1.db, r2.db, r3.db)
+	defer db.Close()
+
+	if _, err = db.ScatterQuery(context.Background(), "delete from mytable"); err != ErrNotQuerySQL {
+		t.Errorf("actual err: %v, expected: %s", err, ErrNotQuerySQL)
+	}
+
+	errQuery := fmt.Errorf("table not found")
+	r1.mock.ExpectQuery("^select count\\(\\*\\) from mytable$").WillReturnRows(r1.mock.NewRows([]string{"count"}).AddRow(3))
+	r2.mock.ExpectQuery("^select count\\(\\*\\) from mytable$").WillReturnError(errQuery)
+	results, err := db.ScatterQuery(context.Background(), "select count(*) from mytable")
+	if err == nil || len(results) != 2 {
+		t.Fatalf("actual results = %+v, err = %v, expected 2 results and err", results, err)
+	}
+	if results[0].Target.Index != 0 || results[0].Err != nil || results[0].Rows == nil {
+		t.Errorf("actual result = %+v, expected rows of replica 0", results[0])
+	} else {
+		var count int
+		for results[0].Rows.Next() {
+			results[0].Rows.Scan(&count)
+		}
+		results[0].Rows.Close()
+		if count != 3 {
+			t.Errorf("actual count: %d, expected: 3", count)
+		}
+	}
+	if results[1].Target.Index != 1 || results[1].Err != errQuery || results[1].Rows != nil {
+		t.Errorf("actual result = %+v, expected err of replica 1", results[1])
+	}
+
+	if _, err = db.ScatterQuery(WithExcludeReplicas(context.Background(), "replica-0", "replica-1"), "select 1"); !errors.Is(err, ErrNoReplicaAvailable) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrNoReplicaAvailable)
+	}
+
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,99 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"strings"
+)
+
+// SetSchemaGroups sets the group (see `TargetInfo.Group`) of read replicas of each database or schema,
+// for a cluster hosting logical databases replicated to different read replicas,
+// e.g. `{"analytics": "olap", "app": "oltp"}` routes reads of `analytics.events` to read replicas in group `olap`.
+// Schemas are taken from qualified table names of reads (any qualifier of `catalog.schema.table` matches),
+// and from `WithSchema()` for unqualified ones and reads without tables. Names are matched case-insensitively.
+// Read replicas of other groups are skipped as excluded, so that no read replica serves reads of schemas of different groups.
+// Reads of schemas without group are routed as usual. Calling it with nil removes all groups, which is the default.
+func (db *DB) SetSchemaGroups(groups map[string]string) {
+	var lowered map[string]string
+	if len(groups) > 0 {
+		lowered = make(map[string]string, len(groups))
+		for schema, group := range groups {
+			lowered[toLowerASCII(schema)] = group
+		}
+	}
+	db.configMutex.Lock()
+	db.schemaGroups = lowered
+	db.configMutex.Unlock()
+}
+
+// withQueryTables returns ctx with tables read by query where routing depends on them, i.e. for read replicas
+// of `ReplicationLogical` and for groups of schemas by `SetSchemaGroups()`; otherwise ctx as it is
+func (db *DB) withQueryTables(ctx context.Context, query string) context.Context {
+	db.configMutex.RLock()
+	schemaGroups := db.schemaGroups
+	db.configMutex.RUnlock()
+	logical := db.hasLogicalReplicas()
+	if !logical && len(schemaGroups) == 0 {
+		return ctx
+	}
+	tables := queryTables(query)
+	var groups []string
+	if len(schemaGroups) > 0 {
+		groups = tableGroups(schemaGroups, tables, toLowerASCII(SchemaFromContext(ctx)))
+	}
+	if (!logical || len(tables) == 0) && len(groups) == 0 {
+		return ctx
+	}
+	return withDirective(ctx, func(d *RoutingDirective) {
+		if logical {
+			d.tables = tables
+		}
+		d.schemaGroups = groups
+	})
+}
+
+// routesByTables returns true if routing of reads depends on their tables by `withQueryTables()`
+func (db *DB) routesByTables() bool {
+	db.configMutex.RLock()
+	hasSchemaGroups := len(db.schemaGroups) > 0
+	db.configMutex.RUnlock()
+	return hasSchemaGroups || db.hasLogicalReplicas()
+}
+
+// tableGroups returns distinct groups of schemas of tables by schemaGroups,
+// where unqualified tables and queries without tables are of schema
+func tableGroups(schemaGroups map[string]string, tables []string, schema string) []string {
+	var groups []string
+	add := func(s string) bool {
+		g, ok := schemaGroups[s]
+		if ok && !contains(groups, g) {
+			groups = append(groups, g)
+		}
+		return ok
+	}
+	if len(tables) == 0 {
+		add(schema)
+	}
+	for _, table := range tables {
+		parts := strings.Split(table, ".")
+		if len(parts) == 1 {
+			add(schema)
+			continue
+		}
+		for _, qualifier := range parts[:len(parts)-1] {
+			if add(qualifier) {
+				break
+			}
+		}
+	}
+	return groups
+}
+
+// servesGroups returns true if a read replica of group can serve reads of schemas of all of groups
+func servesGroups(group string, groups []string) bool {
+	for _, g := range groups {
+		if g != group {
+			return false
+		}
+	}
+	return true
+}
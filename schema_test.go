@@ -0,0 +1,98 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTableGroups(t *testing.T) {
+	groups := map[string]string{"analytics": "olap", "app": "oltp", "main": "oltp"}
+	tests := []struct {
+		tables   []string
+		schema   string
+		expected []string
+	}{
+		{nil, "", nil},
+		{nil, "analytics", []string{"olap"}},
+		{[]string{"users"}, "", nil},
+		{[]string{"users"}, "app", []string{"oltp"}},
+		{[]string{"analytics.events", "users"}, "", []string{"olap"}},
+		{[]string{"analytics.events", "app.users", "main.orders"}, "", []string{"olap", "oltp"}},
+		{[]string{"analytics.dbo.events"}, "", []string{"olap"}},
+		{[]string{"billing.invoices"}, "app", nil},
+	}
+	for _, test := range tests {
+		if actual := tableGroups(groups, test.tables, test.schema); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("actual = %v, expected = %v of %v in schema %q", actual, test.expected, test.tables, test.schema)
+		}
+	}
+}
+
+func TestSetSchemaGroups(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db, r2.db)
+	defer db.Close()
+	for i, group := range []string{"oltp", "olap"} {
+		if err = db.SetTargetInfo(TargetInfo{Role: RoleReplica, Index: i, Name: group, Group: group}); err != nil {
+			t.Fatalf("error %s when SetTargetInfo", err)
+		}
+	}
+	db.SetSchemaGroups(map[string]string{"Analytics": "olap", "app": "oltp"})
+
+	background := context.Background()
+	tests := []struct {
+		ctx      context.Context
+		query    string
+		expected TargetInfo
+	}{
+		{background, "SELECT * FROM analytics.events", TargetInfo{Role: RoleReplica, Index: 1}},
+		{background, "SELECT * FROM App.users u JOIN orders o ON o.user_id = u.id", TargetInfo{Role: RoleReplica, Index: 0}},
+		{WithSchema(background, "analytics"), "SELECT * FROM events", TargetInfo{Role: RoleReplica, Index: 1}},
+		{WithSchema(background, "app"), "SELECT 1", TargetInfo{Role: RoleReplica, Index: 0}},
+		{WithSchema(background, "app"), "SELECT * FROM analytics.events", TargetInfo{Role: RoleReplica, Index: 1}},
+		{background, "SELECT * FROM analytics.events e JOIN app.users u ON e.user_id = u.id", TargetInfo{Role: RolePrimary}},
+	}
+	for _, test := range tests {
+		for i := 0; i < 3; i++ {
+			for _, m := range []*mydbMock{p, r0, r1, r2} {
+				m.mock.ExpectQuery("SELECT (.+)").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+			}
+			rows, err := db.QueryRowsContext(test.ctx, test.query)
+			if test.expected.Role == RolePrimary {
+				if err == nil {
+					t.Errorf("actual %+v, expected: %s of %q", rows.Target(), ErrNoReplicaAvailable, test.query)
+					rows.Close()
+				} else if !errors.Is(err, ErrNoReplicaAvailable) {
+					t.Errorf("actual err: %v, expected: %s of %q", err, ErrNoReplicaAvailable, test.query)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("error %s when QueryRowsContext of %q", err, test.query)
+			}
+			if actual := rows.Target(); actual.Role != test.expected.Role || actual.Index != test.expected.Index {
+				t.Errorf("actual target = %+v, expected = %+v of %q", actual, test.expected, test.query)
+			}
+			rows.Close()
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// RouteDecision is where a statement would be routed, returned by `SimulateRoute()`
+type RouteDecision struct {
+	// Read is true if the statement is routed as a read
+	Read bool
+
+	// Cluster is the DB of the cluster the statement is delegated to by `PartitionRouter`, nil if none
+	Cluster *DB
+
+	// Target is the target the statement would be sent to first, zero value if Err is set
+	Target TargetInfo
+
+	// Reasons explain the decision step by step
+	Reasons []string
+
+	// Err is the error the statement would fail with before being sent to any target
+	Err error
+}
+
+// String returns the decision in one line, e.g. `target=replica-0 read=true: classified as a read; next in round-robin`
+func (d RouteDecision) String() string {
+	target := d.Target.Name
+	if d.Err != nil {
+		target = "none"
+	}
+	s := fmt.Sprintf("target=%s read=%t: %s", target, d.Read, strings.Join(d.Reasons, "; "))
+	if d.Err != nil {
+		s += fmt.Sprintf(" (err: %s)", d.Err)
+	}
+	return s
+}
+
+func (d *RouteDecision) because(format string, args ...interface{}) {
+	d.Reasons = append(d.Reasons, fmt.Sprintf(format, args...))
+}
+
+// SimulateRoute returns where query run by `QueryContext()` (or `ExecContext()` for writes) with ctx would be routed,
+// running classification, directives, pinned tables, policies, health and balancing without executing anything,
+// metrics or audits, e.g. in tests, CLIs and debugging sessions.
+// Decisions by chance or by load (`RuntimeConfig.ReadPercentage`, `SpilloverPolicy`, `ReadBudget`, ramp-up and
+// health weights) are reported in Reasons but not taken, and queries not explained by `CostGuard` yet are taken as allowed.
+// Round-Robin selection reports the next read replica without advancing.
+func (db *DB) SimulateRoute(ctx context.Context, query string) RouteDecision {
+	var d RouteDecision
+	cluster, err := db.partitionCluster(ctx, query)
+	if err != nil {
+		d.Err = err
+		d.because("partition routing failed")
+		return d
+	}
+	if cluster != nil {
+		delegated := cluster.SimulateRoute(ctx, query)
+		if delegated.Cluster == nil {
+			delegated.Cluster = cluster
+		}
+		delegated.Reasons = append([]string{"routed to another cluster by PartitionRouter"}, delegated.Reasons...)
+		return delegated
+	}
+	if d.Err = checkNotInTx(ctx, "SimulateRoute"); d.Err != nil {
+		return d
+	}
+	forcePrimary, err := checkExplain(query)
+	if err != nil {
+		d.Err = err
+		return d
+	}
+	d.Read = !forcePrimary && (db.isQuery(query) || UseReplicaFromContext(ctx))
+	if d.Err = db.checkDirectives(ctx, "SimulateRoute", query, !d.Read); d.Err != nil {
+		return d
+	}
+	if !d.Read {
+		if forcePrimary {
+			d.because("EXPLAIN ANALYZE of a write runs on primary DB")
+		} else {
+			d.because("classified as a write")
+		}
+		db.simulateWrite(&d)
+		return d
+	}
+	if UseReplicaFromContext(ctx) && !db.isQuery(query) {
+		d.because("read replicas forced by RoutingDirective for a statement not classified as a read")
+	} else {
+		d.because("classified as a read")
+	}
+	db.simulateRead(db.withQueryTables(db.withPinnedTables(ctx, query), query), query, &d)
+	return d
+}
+
+// simulateWrite decides the target of a write like `primaryWritable()` without waiting
+func (db *DB) simulateWrite(d *RouteDecision) {
+	if db.PrimaryInMaintenance() {
+		d.Err = ErrPrimaryInMaintenance
+		return
+	}
+	if !DoValidateNew && db.master == nil {
+		d.Err = ErrNotProvidedPrimary
+		return
+	}
+	if down, _ := db.primaryWriteHealth(); down != nil {
+		policy := db.unhealthyPrimaryPolicy()
+		if policy == nil {
+			policy = &defaultPrimaryPolicy
+		}
+		switch policy.Writes {
+		case PrimaryWriteFailFast:
+			d.Err = down
+			return
+		case PrimaryWriteQueue:
+			d.because("primary DB is down, the write is queued until it recovers by PrimaryPolicy")
+		}
+	}
+	d.Target = db.targetInfo(db.master)
+}
+
+// simulateRead decides the target of a read like `queryContext()` and `readReplica()` without side effects
+func (db *DB) simulateRead(ctx context.Context, query string, d *RouteDecision) {
+	directive := DirectiveFromContext(ctx)
+	if directive.pinned {
+		d.because("reads a table pinned to primary DB by SetPrimaryTables()")
+	} else if directive.ForcePrimary {
+		d.because("primary DB forced by RoutingDirective")
+	}
+	if c := db.queryCostGuard(); c != nil && !directive.ForcePrimary {
+		if verdict, ok := c.verdict(queryDigest(query)); ok && verdict.exceeded {
+			if c.guard.Action != CostGuardPrimary {
+				d.Err = fmt.Errorf("%w: estimated cost %g and rows %g exceed limits",
+					ErrQueryTooExpensive, verdict.cost.Cost, verdict.cost.Rows)
+				return
+			}
+			d.because("estimated cost exceeds CostGuard limits")
+			directive.ForcePrimary = true
+		}
+	}
+	if directive.ForcePrimary {
+		switch {
+		case db.PrimaryInMaintenance():
+			d.because("primary DB is in maintenance mode, falls back to read replicas")
+		case db.redirectPrimaryReads():
+			d.because("primary DB is down, redirected to read replicas by PrimaryPolicy")
+		default:
+			db.simulatePrimaryRead(d)
+			return
+		}
+	}
+
+	bypassAutoFailover := ExactReplicaOrderFromContext(ctx)
+	if !bypassAutoFailover && db.primaryAvailable() && !db.flag(FlagReplicaReads, true) {
+		d.because("replica reads are switched off by %s", FlagReplicaReads)
+		db.simulatePrimaryRead(d)
+		return
+	}
+	fallback := db.primaryAvailable() && db.flag(FlagPrimaryFallback, true)
+	if policy := db.replicaQuorumPolicy(); policy != nil && policy.SpillToPrimary && db.isBelowQuorum() && fallback {
+		d.because("healthy read replicas are below QuorumPolicy")
+		db.simulatePrimaryRead(d)
+		return
+	}
+	if !bypassAutoFailover {
+		if percentage := db.replicaReadPercentage(); percentage < 100 && db.primaryAvailable() && !db.shiftReads() {
+			d.because("%d%% of reads go to read replicas by RuntimeConfig.ReadPercentage, others to primary DB", percentage)
+		}
+		if db.replicaSpilloverPolicy() != nil && db.primaryAvailable() {
+			d.because("reads may spill to primary DB by SpilloverPolicy while read replicas are saturated")
+		}
+		if db.replicaReadBudget() != nil {
+			d.because("read replicas over ReadBudget in the current second are skipped")
+		}
+	}
+
+	tgtdb, reasons, err := db.simulateReplica(ctx, bypassAutoFailover)
+	d.Reasons = append(d.Reasons, reasons...)
+	if err != nil {
+		policy := db.replicaFallbackPolicy()
+		if policy == nil || db.decide(policy, err) != FallbackRetryPrimary || !fallback {
+			d.Err = err
+			return
+		}
+		d.because("falls back to primary DB by FallbackPolicy as %s", err)
+		tgtdb = db.master
+	}
+	d.Target = db.targetInfo(tgtdb)
+}
+
+// simulatePrimaryRead decides primary DB as the target of a read
+func (db *DB) simulatePrimaryRead(d *RouteDecision) {
+	if !DoValidateNew && db.master == nil {
+		d.Err = ErrNotProvidedPrimary
+		return
+	}
+	d.Target = db.targetInfo(db.master)
+}
+
+// simulateReplica returns the read replica `selectReplica()` would return, without advancing Round-Robin,
+// with reasons of skipped read replicas and of the selection
+func (db *DB) simulateReplica(ctx context.Context, bypassAutoFailover bool) (*sql.DB, []string, error) {
+	if !DoValidateNew && len(db.readreplicas) == 0 {
+		return nil, nil, ErrNotProvidedReplicas
+	}
+	if db.single {
+		return db.readreplicas[0], nil, nil
+	}
+	var reasons []string
+	err := db.noReplicaAvailable(db.excludedReplicas(ctx), bypassAutoFailover)
+	skipped := map[int]struct{}{}
+	for _, s := range err.(*NoReplicaAvailableError).Replicas {
+		skipped[s.Target.Index] = empty
+		reasons = append(reasons, "skipped "+s.String())
+	}
+	if len(skipped) == len(db.readreplicas) {
+		return nil, reasons, err
+	}
+	if r := db.readerEndpointReplica(); r != nil {
+		if _, ok := skipped[db.replicaStates[r].index]; !ok {
+			return r, append(reasons, "passed through to reader endpoint"), nil
+		}
+	}
+
+	if b := db.replicaBalancer(); b != nil && !bypassAutoFailover {
+		candidates := make([]ReplicaCandidate, 0, len(db.readreplicas))
+		for i, r := range db.readreplicas {
+			if _, ok := skipped[i]; !ok {
+				latency, queueWait := db.replicaStates[r].load(r)
+				candidates = append(candidates, ReplicaCandidate{Target: db.targetInfo(r), Latency: latency, QueueWait: queueWait})
+			}
+		}
+		selected := candidates[db.balance(ctx, b, candidates)]
+		return db.readreplicas[selected.Target.Index], append(reasons, "selected by Balancer"), nil
+	}
+	db.countMutex.RLock()
+	count := db.count
+	db.countMutex.RUnlock()
+	for try := 1; ; try++ {
+		idx := (count + try) % len(db.readreplicas)
+		if _, ok := skipped[idx]; !ok {
+			return db.readreplicas[idx], append(reasons, "next in round-robin"), nil
+		}
+	}
+}
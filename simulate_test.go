@@ -0,0 +1,91 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSimulateRoute(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+	db.SetPrimaryTables("sessions")
+
+	background := context.Background()
+	selectQuery := fmt.Sprintf(selectQueryTmpl, "*")
+	tests := []struct {
+		ctx    context.Context
+		query  string
+		read   bool
+		target string
+		err    error
+	}{
+		{background, fmt.Sprintf(deleteQuueryTmpl, ""), false, "primary", nil},
+		{background, selectQuery, true, "replica-0", nil},
+		{WithPrimary(background), selectQuery, true, "primary", nil},
+		{background, "SELECT * FROM sessions", true, "primary", nil},
+		{WithExcludeReplicas(background, "replica-0"), selectQuery, true, "replica-1", nil},
+		{WithExcludeReplicas(background, "replica-0", "replica-1"), selectQuery, true, "", ErrNoReplicaAvailable},
+	}
+	for i, test := range tests {
+		for try := 0; try < 2; try++ {
+			d := db.SimulateRoute(test.ctx, test.query)
+			if d.Read != test.read {
+				t.Errorf("actual read: %t, expected: %t of test %d", d.Read, test.read, i)
+			}
+			if !errors.Is(d.Err, test.err) {
+				t.Errorf("actual err: %v, expected: %v of test %d", d.Err, test.err, i)
+			}
+			if test.err == nil && d.Target.Name != test.target {
+				t.Errorf("actual target: %s, expected: %s of test %d (%s)", d.Target.Name, test.target, i, d)
+			}
+			if len(d.Reasons) == 0 {
+				t.Errorf("actual no reasons, expected some of test %d", i)
+			}
+		}
+	}
+
+	d := db.SimulateRoute(WithExcludeReplicas(background, "replica-0"), selectQuery)
+	if actual, expected := d.String(), "target=replica-1 read=true: classified as a read; skipped replica-0 excluded; next in round-robin"; actual != expected {
+		t.Errorf("actual: %s, expected: %s", actual, expected)
+	}
+
+	db.SetFlagProvider(FlagProviderFunc(func(name string, defaultValue bool) bool { return name != FlagReplicaReads }))
+	if d := db.SimulateRoute(background, selectQuery); d.Target.Name != "primary" {
+		t.Errorf("actual target: %s, expected: primary with %s off", d.Target.Name, FlagReplicaReads)
+	}
+	db.SetFlagProvider(nil)
+
+	if actual := db.Metrics(); actual.ReadsPrimary != 0 || actual.ReadsReplica[0] != 0 || actual.ReadsReplica[1] != 0 || actual.Writes != 0 {
+		t.Errorf("actual metrics: %+v, expected: no reads and writes by simulation", actual)
+	}
+
+	// the simulated read replica is the one actually used next
+	r0.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	rows, err := db.Query(selectQuery)
+	if err != nil {
+		t.Fatalf("error %s when Query", err)
+	}
+	rows.Close()
+
+	for _, m := range []*mydbMock{p, r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// NewSingle returns new instance of DB whose primary DB and only read replica are the same handle,
+// e.g. a SQLite DB in local development, so that applications use the same API as with `New()`
+// without branching between environments.
+// Routing features are no-ops: reads and writes all go to handle, no health checks run,
+// read replica selection (`SetBalancer()`, `WithExcludeReplicas()` ...) never fails over,
+// and `DrainReplica()` neither drains nor closes handle.
+// Classification still applies, so `Query()` of writes fails as with `New()`.
+// `Close()` closes handle once.
+// In case of not providing handle and `DoValidateNew` is true(default is false), it will panic.
+func NewSingle(handle *sql.DB) *DB {
+	if DoValidateNew && handle == nil {
+		debug("[NewSingle] err: %s", ErrNotProvidedPrimary)
+		panic(ErrNotProvidedPrimary)
+	}
+	db := newDB(context.Background(), handle, []*sql.DB{handle}, false)
+	db.single = true
+	return db
+}
+
+// IsSingle returns true if db is created by `NewSingle()`
+func (db *DB) IsSingle() bool {
+	return db.single
+}
@@ -0,0 +1,58 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNewSingle(t *testing.T) {
+	var err error
+	s, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := NewSingle(s.db)
+	if !db.IsSingle() {
+		t.Errorf("actual IsSingle: false, expected: true")
+	}
+
+	// routing features never fail over nor exclude the only handle
+	db.SetBalancer(&RoundRobinBalancer{})
+	ctx := WithExcludeReplicas(context.Background(), "replica-0")
+	s.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	s.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	s.mock.ExpectExec("^delete from mytable$").WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err = db.QueryContext(ctx, fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when QueryContext", err)
+	}
+	if _, err = db.QueryContext(WithPrimary(ctx), fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when QueryContext on primary", err)
+	}
+	if _, err = db.Exec("delete from mytable"); err != nil {
+		t.Errorf("error %s when Exec", err)
+	}
+	if _, err = db.Query("delete from mytable"); !errors.Is(err, ErrNotQuerySQL) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrNotQuerySQL)
+	}
+	s.mock.ExpectQuery("^select 1$").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	results, err := db.ScatterQuery(context.Background(), "select 1")
+	if err != nil || len(results) != 1 {
+		t.Errorf("actual scatter results: %d, err: %v, expected: 1 result", len(results), err)
+	}
+	for _, r := range results {
+		r.Rows.Close()
+	}
+
+	// no health checks run, handle is closed once
+	s.mock.ExpectClose()
+	if err = db.Close(); err != nil {
+		t.Errorf("error %s when Close", err)
+	}
+	if err = s.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
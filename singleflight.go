@@ -0,0 +1,177 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// flightResult is the result of a read coalesced by `WithSingleflight()`, read into memory to be shared
+type flightResult struct {
+	tgtdb   *sql.DB
+	columns []string
+	values  [][]driver.Value
+}
+
+// flightKey returns the key of identical reads of query with args routed by the directive of ctx,
+// false if any of args is not converted to a plain value by `driver.DefaultParameterConverter` (e.g. `sql.NamedArg`)
+func flightKey(ctx context.Context, query string, args []interface{}) (string, bool) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return "", false
+		}
+		values[i] = v
+	}
+	// fields not routing reads
+	d := DirectiveFromContext(ctx)
+	d.StatementID, d.TxOptions, d.Singleflight = "", nil, false
+	return fmt.Sprintf("%q %#v %#v", query, values, d), true
+}
+
+// withoutSingleflight returns a copy of ctx not coalescing reads
+func withoutSingleflight(ctx context.Context) context.Context {
+	return withDirective(ctx, func(d *RoutingDirective) { d.Singleflight = false })
+}
+
+// flight runs the read of query on read replicas, or waits for the identical read of key running on them to share its result.
+// The result is shared by reads started while it runs, so the read fails for all of them if ctx of the running one is done.
+func (db *DB) flight(ctx context.Context, key string, query string, args []interface{}) (*flightResult, error) {
+	ch := db.flights.DoChan(key, func() (interface{}, error) {
+		rows, tgtdb, err := db.queryContext(withoutSingleflight(ctx), query, args...)
+		if err != nil {
+			return nil, err
+		}
+		return readFlightResult(tgtdb, rows, 0)
+	})
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		if r.Shared {
+			db.debugf(DebugRouting, "[flight] shared result of query: %s", query)
+		}
+		return r.Val.(*flightResult), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// readFlightResult reads rows into memory, up to limit rows if positive, and closes them
+func readFlightResult(tgtdb *sql.DB, rows *sql.Rows, limit int) (*flightResult, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &flightResult{tgtdb: tgtdb, columns: columns}
+	for (limit <= 0 || len(result.values) < limit) && rows.Next() {
+		values := make([]driver.Value, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result.values = append(result.values, values)
+	}
+	return result, rows.Err()
+}
+
+// singleflightQuery is `queryContext()` coalescing identical concurrent reads
+func (db *DB) singleflightQuery(ctx context.Context, query string, args []interface{}) (*sql.Rows, *sql.DB, error) {
+	key, ok := flightKey(ctx, query, args)
+	if !ok {
+		db.debugf(DebugRouting, "[singleflightQuery] not coalesced as args are not plain values, query: %s", query)
+		return db.queryContext(withoutSingleflight(ctx), query, args...)
+	}
+	result, err := db.flight(ctx, key, query, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := memDB.QueryContext(ctx, "", result)
+	return rows, result.tgtdb, err
+}
+
+// singleflightQueryRow is `QueryRowContext()` coalescing identical concurrent reads,
+// deferring errors to `Scan()` of the returned `*sql.Row`
+func (db *DB) singleflightQueryRow(ctx context.Context, query string, args []interface{}) (*sql.Row, *sql.DB) {
+	key, ok := flightKey(ctx, query, args)
+	if !ok {
+		db.debugf(DebugRouting, "[singleflightQueryRow] not coalesced as args are not plain values, query: %s", query)
+		return db.queryRowContext(withoutSingleflight(ctx), query, args...)
+	}
+	result, err := db.flight(ctx, key, query, args)
+	if err != nil {
+		return errRow(err), nil
+	}
+	return memDB.QueryRowContext(ctx, "", result), result.tgtdb
+}
+
+// memDB serves shared results or errors as `*sql.Rows` or `*sql.Row`, each queried with a `*flightResult` (or an error) as the arg
+var memDB = sql.OpenDB(flightConnector{})
+
+// errRow returns `*sql.Row` whose `Scan()` returns err
+func errRow(err error) *sql.Row {
+	return memDB.QueryRowContext(context.Background(), "", err)
+}
+
+var errFlightUnsupported = errors.New("gosqlrwdb: only queries of shared results are supported")
+
+type flightConnector struct{}
+
+func (flightConnector) Connect(context.Context) (driver.Conn, error) { return flightConn{}, nil }
+
+func (flightConnector) Driver() driver.Driver { return flightDriver{} }
+
+type flightDriver struct{}
+
+func (flightDriver) Open(string) (driver.Conn, error) { return flightConn{}, nil }
+
+type flightConn struct{}
+
+func (flightConn) Prepare(string) (driver.Stmt, error) { return nil, errFlightUnsupported }
+
+func (flightConn) Close() error { return nil }
+
+func (flightConn) Begin() (driver.Tx, error) { return nil, errFlightUnsupported }
+
+// CheckNamedValue accepts `*flightResult` and errors as they are
+func (flightConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (flightConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) == 1 {
+		switch v := args[0].Value.(type) {
+		case *flightResult:
+			return &flightRows{result: v}, nil
+		case error:
+			return nil, v
+		}
+	}
+	return nil, errFlightUnsupported
+}
+
+// flightRows iterates rows of a shared result
+type flightRows struct {
+	result *flightResult
+	next   int
+}
+
+func (rs *flightRows) Columns() []string { return rs.result.columns }
+
+func (rs *flightRows) Close() error { return nil }
+
+func (rs *flightRows) Next(dest []driver.Value) error {
+	if rs.next >= len(rs.result.values) {
+		return io.EOF
+	}
+	copy(dest, rs.result.values[rs.next])
+	rs.next++
+	return nil
+}
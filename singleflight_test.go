@@ -0,0 +1,115 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSingleflight(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	r1.mock.MatchExpectationsInOrder(false)
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WithArgs(1).WillDelayFor(50 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "foo").AddRow(2, []byte("bar")))
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WithArgs(2).WillDelayFor(50 * time.Millisecond).
+		WillReturnError(sql.ErrNoRows)
+
+	ctx := WithSingleflight(context.Background())
+	query := fmt.Sprintf(selectQueryTmpl, "id, name") + " where id > ?"
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rows, err := db.QueryContext(ctx, query, 1)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer rows.Close()
+			var names []string
+			for rows.Next() {
+				var id int
+				var name string
+				if err := rows.Scan(&id, &name); err != nil {
+					errs <- err
+					return
+				}
+				names = append(names, name)
+			}
+			if len(names) != 2 || names[0] != "foo" || names[1] != "bar" {
+				errs <- fmt.Errorf("actual names = %v, expected = [foo bar]", names)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			var id int
+			if err := db.QueryRowContext(ctx, query, 2).Scan(&id); err != sql.ErrNoRows {
+				errs <- fmt.Errorf("actual err = %v, expected = %s", err, sql.ErrNoRows)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if err := r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+type flightValuer string
+
+func (v flightValuer) Value() (driver.Value, error) { return "valuer:" + string(v), nil }
+
+func TestFlightKey(t *testing.T) {
+	query := "select * from mytable where id = ?"
+	ctx := WithSingleflight(context.Background())
+	one, other := 1, 1
+	key, _ := flightKey(ctx, query, []interface{}{1})
+	tests := []struct {
+		ctx   context.Context
+		args  []interface{}
+		same  bool
+		plain bool
+	}{
+		{WithStatementID(ctx, "stmt-1"), []interface{}{int64(1)}, true, true},
+		{ctx, []interface{}{&one}, true, true},
+		{ctx, []interface{}{&other}, true, true},
+		{ctx, []interface{}{2}, false, true},
+		{WithPrimary(ctx), []interface{}{1}, false, true},
+		{WithExcludeReplicas(ctx, "replica-0"), []interface{}{1}, false, true},
+		{WithRoutingKey(ctx, "tenant-1"), []interface{}{1}, false, true},
+		{WithSchema(ctx, "app"), []interface{}{1}, false, true},
+		{withDirective(ctx, func(d *RoutingDirective) { d.MaxStaleness = time.Second }), []interface{}{1}, false, true},
+		{ctx, []interface{}{flightValuer("1")}, false, true},
+		{ctx, []interface{}{sql.Named("id", 1)}, false, false},
+	}
+	for i, test := range tests {
+		actual, plain := flightKey(test.ctx, query, test.args)
+		if plain != test.plain || (plain && (actual == key) != test.same) {
+			t.Errorf("actual key: %s, plain: %t, expected same: %t, plain: %t of test %d", actual, plain, test.same, test.plain, i)
+		}
+	}
+	if valuer, _ := flightKey(ctx, query, []interface{}{flightValuer("1")}); valuer != fmt.Sprintf("%q %#v %#v", query, []driver.Value{"valuer:1"}, DirectiveFromContext(withoutSingleflight(ctx))) {
+		t.Errorf("actual key: %s, expected: keyed by the value of driver.Valuer", valuer)
+	}
+}
@@ -0,0 +1,251 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSLOWindow            = time.Minute
+	defaultSLOMinRequests       = 20
+	defaultSLOLatencyPercentile = 0.99
+	defaultSLORecoveryWindow    = 30 * time.Second
+)
+
+// SLO is the service level objective every read replica must meet on real traffic.
+// A read replica breaching it is evicted from routing until `RecoveryWindow` elapses.
+//
+// Zero values of `Window`, `MinRequests`, `LatencyPercentile` and `RecoveryWindow` mean defaults;
+// zero values of `MaxErrorRate` and `MaxLatency` disable the corresponding check.
+type SLO struct {
+	// Window is the rolling window used to calculate error rate and latency. Default to 1m.
+	Window time.Duration
+
+	// MinRequests is the minimum number of requests in `Window` before the SLO is evaluated. Default to 20.
+	MinRequests int
+
+	// MaxErrorRate is the maximum error rate (0.0 ~ 1.0) allowed in `Window`.
+	MaxErrorRate float64
+
+	// LatencyPercentile is the percentile (0.0 ~ 1.0) compared with `MaxLatency`. Default to 0.99.
+	LatencyPercentile float64
+
+	// MaxLatency is the maximum latency allowed at `LatencyPercentile`, taken from the recent latency
+	// histogram of the read replica (see `LatencySnapshot()`), which covers the last 30s ~ 1m regardless of `Window`.
+	MaxLatency time.Duration
+
+	// RecoveryWindow is how long an evicted read replica stays out of routing. Default to 30s.
+	RecoveryWindow time.Duration
+}
+
+// withDefaults returns a copy of slo with zero values replaced by defaults
+func (slo SLO) withDefaults() SLO {
+	if slo.Window <= 0 {
+		slo.Window = defaultSLOWindow
+	}
+	if slo.MinRequests <= 0 {
+		slo.MinRequests = defaultSLOMinRequests
+	}
+	if slo.LatencyPercentile <= 0 || slo.LatencyPercentile > 1 {
+		slo.LatencyPercentile = defaultSLOLatencyPercentile
+	}
+	if slo.RecoveryWindow <= 0 {
+		slo.RecoveryWindow = defaultSLORecoveryWindow
+	}
+	return slo
+}
+
+// sloCounter counts requests and failures of the recent SLO window in two generations of half the window each,
+// the older one dropped as a new one starts like rollingHistogram, accessed atomically
+type sloCounter struct {
+	epochs   [2]int64
+	requests [2]uint64
+	failures [2]uint64
+}
+
+// sloEpoch returns the epoch of the generation of now for window
+func sloEpoch(now time.Time, window time.Duration) int64 {
+	half := int64(window / 2)
+	if half <= 0 {
+		half = 1
+	}
+	return now.UnixNano() / half
+}
+
+// add counts a request, failed or not
+func (c *sloCounter) add(failed bool, now time.Time, window time.Duration) {
+	epoch := sloEpoch(now, window)
+	gen := epoch & 1
+	if old := atomic.LoadInt64(&c.epochs[gen]); old != epoch && atomic.CompareAndSwapInt64(&c.epochs[gen], old, epoch) {
+		atomic.StoreUint64(&c.requests[gen], 0)
+		atomic.StoreUint64(&c.failures[gen], 0)
+	}
+	atomic.AddUint64(&c.requests[gen], 1)
+	if failed {
+		atomic.AddUint64(&c.failures[gen], 1)
+	}
+}
+
+// counts returns numbers of requests and failures of the recent window
+func (c *sloCounter) counts(now time.Time, window time.Duration) (uint64, uint64) {
+	epoch := sloEpoch(now, window)
+	var requests, failures uint64
+	for gen := range c.epochs {
+		if e := atomic.LoadInt64(&c.epochs[gen]); e == epoch || e == epoch-1 {
+			requests += atomic.LoadUint64(&c.requests[gen])
+			failures += atomic.LoadUint64(&c.failures[gen])
+		}
+	}
+	return requests, failures
+}
+
+// reset drops all counts
+func (c *sloCounter) reset() {
+	for gen := range c.epochs {
+		atomic.StoreInt64(&c.epochs[gen], 0)
+		atomic.StoreUint64(&c.requests[gen], 0)
+		atomic.StoreUint64(&c.failures[gen], 0)
+	}
+}
+
+// replicaState holds the traffic statistics of one read replica
+type replicaState struct {
+	// inflight is the number of reads in progress, accessed atomically
+	inflight int64
+
+	// lastRead is when the last read was routed in Unix nanoseconds, accessed atomically
+	lastRead int64
+
+	// lag is the replication lag measured by the last `DialectReadinessCheck` in nanoseconds,
+	// negative if unknown, accessed atomically
+	lag int64
+
+	index        int
+	mu           sync.Mutex
+	evictedUntil time.Time
+
+	// excludedUntil is when the exclusion by `ExcludeReplica()` ends, guarded by mu
+	excludedUntil time.Time
+
+	// sloCounts counts outcomes of recent reads for the SLO
+	sloCounts sloCounter
+
+	// latency is the latency histograms of the read replica in metrics of DB
+	latency *targetLatency
+
+	// fields for queue wait calculated from `sql.DBStats`
+	waitCount    int64
+	waitDuration time.Duration
+	queueWait    time.Duration
+	queueWaitAt  time.Time
+
+	// errors are recent errors for `LastErrors()`
+	errors *errorRing
+
+	// probes are results of recent health checks as bits (1 for success, newest at the lowest bit)
+	// and probeCount is the number of them, for `HealthWeightPolicy`, guarded by countMutex of DB
+	probes     uint64
+	probeCount int
+
+	// downSince & notReadySince are when the read replica became unavailable & not ready,
+	// for `NoReplicaAvailableError`, guarded by countMutex of DB
+	downSince     time.Time
+	notReadySince time.Time
+}
+
+func newReplicaState(index int) *replicaState {
+	return &replicaState{index: index, errors: &errorRing{}, lastRead: time.Now().UnixNano(), lag: -1}
+}
+
+// resetSLO drops outcomes and recent latencies of reads for the SLO, so that they do not evict the read replica again
+func (s *replicaState) resetSLO() {
+	s.sloCounts.reset()
+	if s.latency != nil {
+		s.latency.reads.resetRecent()
+	}
+}
+
+// SetReplicaSLO sets the SLO read replicas must meet on real traffic.
+// Read replicas breaching it are evicted from routing and restored after `RecoveryWindow`.
+// Passing nil disables SLO based eviction.
+func (db *DB) SetReplicaSLO(slo *SLO) {
+	db.configMutex.Lock()
+	defer db.configMutex.Unlock()
+	if slo == nil {
+		db.slo = nil
+		return
+	}
+	s := slo.withDefaults()
+	db.slo = &s
+}
+
+// replicaSLO returns current SLO, nil if not set
+func (db *DB) replicaSLO() *SLO {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.slo
+}
+
+// observe records the outcome of a request to r started at start,
+// and evicts r if it breaches the SLO. It takes no lock unless r is evicted.
+func (db *DB) observe(ctx context.Context, r *sql.DB, start time.Time, err error) {
+	// errors caused by the caller giving up, or rejected before sent, are not the replica's fault
+	rejected := errors.Is(err, ErrProxyIncompatible) || errors.Is(err, ErrQueryBudgetExceeded)
+	if !rejected {
+		db.recordLatency(r, false, time.Since(start))
+	}
+	state, ok := db.replicaStates[r]
+	if !ok {
+		return
+	}
+	slo := db.replicaSLO()
+	if slo == nil {
+		return
+	}
+	now := time.Now()
+	failed := err != nil && ctx.Err() == nil && !rejected
+	state.sloCounts.add(failed, now, slo.Window)
+	if db.healthChecksPaused() {
+		return
+	}
+	n, failures := state.sloCounts.counts(now, slo.Window)
+	if n < uint64(slo.MinRequests) {
+		return
+	}
+	errorRate := float64(failures) / float64(n)
+	var latency time.Duration
+	if slo.MaxLatency > 0 {
+		latency = state.latency.reads.percentile(now, slo.LatencyPercentile)
+	}
+	breachErrorRate := slo.MaxErrorRate > 0 && errorRate > slo.MaxErrorRate
+	breachLatency := slo.MaxLatency > 0 && latency > slo.MaxLatency
+	if !breachErrorRate && !breachLatency {
+		return
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if now.Before(state.evictedUntil) {
+		// evicted by a concurrent request
+		return
+	}
+	db.debugf(DebugEvent, "[observe] evict replica, requests: %d, error rate: %.3f, latency: %s", n, errorRate, latency)
+	state.evictedUntil = now.Add(slo.RecoveryWindow)
+	// start over after recovery so that stale outcomes do not evict it again
+	state.resetSLO()
+}
+
+// evicted returns true if r is evicted for breaching the SLO, or excluded by `ExcludeReplica()`
+func (db *DB) evicted(r *sql.DB) bool {
+	state, ok := db.replicaStates[r]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return now.Before(state.evictedUntil) || now.Before(state.excludedUntil)
+}
@@ -0,0 +1,136 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSLOWithDefaults(t *testing.T) {
+	actual := SLO{MaxErrorRate: 0.5}.withDefaults()
+	expected := SLO{
+		Window:            defaultSLOWindow,
+		MinRequests:       defaultSLOMinRequests,
+		MaxErrorRate:      0.5,
+		LatencyPercentile: defaultSLOLatencyPercentile,
+		RecoveryWindow:    defaultSLORecoveryWindow,
+	}
+	if actual != expected {
+		t.Errorf("actual = %+v, expected = %+v", actual, expected)
+	}
+}
+
+func TestSLOCounter(t *testing.T) {
+	var c sloCounter
+	window := time.Minute
+	start := time.Unix(0, 0).Add(10 * window)
+	tests := []struct {
+		at       time.Duration
+		failed   bool
+		requests uint64
+		failures uint64
+	}{
+		{0, true, 1, 1},
+		{time.Second, false, 2, 1},
+		// the previous generation still counts
+		{window / 2, false, 3, 1},
+		// the first generation is dropped
+		{window, true, 2, 1},
+		// both generations are dropped
+		{3 * window, false, 1, 0},
+	}
+	for _, test := range tests {
+		now := start.Add(test.at)
+		c.add(test.failed, now, window)
+		if requests, failures := c.counts(now, window); requests != test.requests || failures != test.failures {
+			t.Errorf("actual requests: %d, failures: %d, expected: %d, %d at %s", requests, failures, test.requests, test.failures, test.at)
+		}
+	}
+	c.reset()
+	if requests, _ := c.counts(start.Add(3*window), window); requests != 0 {
+		t.Errorf("actual requests after reset: %d, expected: 0", requests)
+	}
+}
+
+func TestReplicaSLOEvictionAndRecovery(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	db.SetReplicaSLO(&SLO{MinRequests: 2, MaxErrorRate: 0.5, RecoveryWindow: 100 * time.Millisecond})
+
+	query := fmt.Sprintf(selectQueryTmpl, "*")
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(fmt.Errorf("replica error"))
+	r2.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(fmt.Errorf("replica error"))
+	for i := 0; i < 3; i++ {
+		db.Query(query)
+	}
+	if !db.evicted(r1.db) {
+		t.Errorf("replica 1 should be evicted")
+	}
+	if db.evicted(r2.db) {
+		t.Errorf("replica 2 should not be evicted")
+	}
+	testReplicaIndexMatch(t, db, 1)
+	testReplicaIndexMatch(t, db, 1)
+
+	time.Sleep(150 * time.Millisecond)
+	if db.evicted(r1.db) {
+		t.Errorf("replica 1 should be restored after recovery window")
+	}
+
+	db.SetReplicaSLO(nil)
+	if db.replicaSLO() != nil {
+		t.Errorf("SLO should be disabled")
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReplicaSLOLatency(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	db.SetReplicaSLO(&SLO{MinRequests: 2, MaxLatency: 100 * time.Millisecond})
+
+	db.observe(context.Background(), r1.db, time.Now().Add(-time.Second), nil)
+	if db.evicted(r1.db) {
+		t.Errorf("replica 1 should not be evicted below MinRequests")
+	}
+	db.observe(context.Background(), r1.db, time.Now().Add(-time.Second), nil)
+	if !db.evicted(r1.db) {
+		t.Errorf("replica 1 should be evicted by latency")
+	}
+	if latency := db.replicaStates[r1.db].latency.reads.percentile(time.Now(), 0.99); latency != 0 {
+		t.Errorf("actual recent latency: %s, expected: 0 after eviction", latency)
+	}
+	if actual := db.LatencySnapshot()[1].Reads.Count; actual != 2 {
+		t.Errorf("actual reads in snapshot: %d, expected: 2", actual)
+	}
+}
@@ -0,0 +1,138 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+)
+
+const (
+	defaultSpilloverThreshold        = 0.9
+	defaultSpilloverMaxPercentage    = 10
+	defaultSpilloverPrimaryThreshold = 0.7
+)
+
+// SpilloverPolicy spills reads to primary DB while all read replicas are saturated and primary DB has headroom,
+// so that capacity of primary DB is not wasted during replica-side hotspots.
+//
+// Utilization of a target is the highest of: connections in use of `SetMaxOpenConns()`,
+// slots in use of any workload of `WorkloadPolicy`, and 1 if reads waited for a connection recently.
+// The percentage of spilled reads grows linearly from 0 at `Threshold` to `MaxPercentage`
+// as the least utilized read replica gets fully utilized.
+// Spilled reads are counted in `RoutingMetrics.Spillovers`.
+//
+// Zero values mean defaults.
+type SpilloverPolicy struct {
+	// Threshold is the utilization (0.0 ~ 1.0) above which a read replica is saturated. Default to 0.9.
+	Threshold float64
+
+	// MaxPercentage is the maximum percentage (1 ~ 100) of reads spilled to primary DB. Default to 10.
+	MaxPercentage int
+
+	// PrimaryThreshold is the utilization (0.0 ~ 1.0) of primary DB below which it has headroom. Default to 0.7.
+	PrimaryThreshold float64
+}
+
+// withDefaults returns a copy of p with zero values replaced by defaults
+func (p SpilloverPolicy) withDefaults() SpilloverPolicy {
+	if p.Threshold == 0 {
+		p.Threshold = defaultSpilloverThreshold
+	}
+	if p.MaxPercentage == 0 {
+		p.MaxPercentage = defaultSpilloverMaxPercentage
+	}
+	if p.PrimaryThreshold == 0 {
+		p.PrimaryThreshold = defaultSpilloverPrimaryThreshold
+	}
+	return p
+}
+
+// SetSpilloverPolicy sets the SpilloverPolicy of reads on read replicas.
+// Passing nil disables spillover, which is the default.
+// It returns an error wrapping `ErrInvalidConfig` if thresholds are out of 0.0 ~ 1.0 or `MaxPercentage` is out of 0 ~ 100.
+func (db *DB) SetSpilloverPolicy(p *SpilloverPolicy) error {
+	if p != nil {
+		copied := p.withDefaults()
+		if copied.Threshold < 0 || copied.Threshold > 1 || copied.PrimaryThreshold < 0 || copied.PrimaryThreshold > 1 {
+			return fmt.Errorf("%w: spillover thresholds %f and %f are out of 0.0 ~ 1.0", ErrInvalidConfig, copied.Threshold, copied.PrimaryThreshold)
+		}
+		if copied.MaxPercentage < 0 || copied.MaxPercentage > 100 {
+			return fmt.Errorf("%w: spillover percentage %d is out of 0 ~ 100", ErrInvalidConfig, copied.MaxPercentage)
+		}
+		p = &copied
+	}
+	db.configMutex.Lock()
+	db.spilloverPolicy = p
+	db.configMutex.Unlock()
+	return nil
+}
+
+// replicaSpilloverPolicy returns current SpilloverPolicy, nil if not set
+func (db *DB) replicaSpilloverPolicy() *SpilloverPolicy {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.spilloverPolicy
+}
+
+// spillover returns true if this read should be spilled to primary DB by `SpilloverPolicy`
+func (db *DB) spillover(ctx context.Context) bool {
+	policy := db.replicaSpilloverPolicy()
+	if policy == nil || !db.primaryAvailable() {
+		return false
+	}
+	replicas := db.healthyReplicaList(ctx)
+	if len(replicas) == 0 {
+		// nothing to relieve, `FallbackPolicy` decides
+		return false
+	}
+	least := 1.0
+	for _, r := range replicas {
+		if u := db.utilization(r); u < least {
+			least = u
+		}
+	}
+	if least < policy.Threshold || db.utilization(db.master) >= policy.PrimaryThreshold {
+		return false
+	}
+	percentage := float64(policy.MaxPercentage)
+	if policy.Threshold < 1 {
+		percentage *= (least - policy.Threshold) / (1 - policy.Threshold)
+	}
+	return rand.Float64()*100 < percentage && db.fallbackToPrimary(ctx)
+}
+
+// utilization returns utilization (0.0 ~ 1.0) of tgtdb, see `SpilloverPolicy`
+func (db *DB) utilization(tgtdb *sql.DB) float64 {
+	u := 0.0
+	stats := tgtdb.Stats()
+	if stats.MaxOpenConnections > 0 {
+		u = float64(db.inUse(tgtdb)) / float64(stats.MaxOpenConnections)
+	}
+	if state, ok := db.replicaStates[tgtdb]; ok {
+		if _, queueWait := state.load(tgtdb); queueWait > 0 {
+			return 1
+		}
+	}
+
+	db.configMutex.RLock()
+	limiter := db.workloadLimiter
+	db.configMutex.RUnlock()
+	if limiter != nil {
+		for _, sem := range limiter.slots[tgtdb] {
+			if s := float64(len(sem)) / float64(cap(sem)); s > u {
+				u = s
+			}
+		}
+	}
+	if u > 1 {
+		return 1
+	}
+	return u
+}
+
+// countSpillover increments counter of reads spilled to primary DB by `SpilloverPolicy`
+func (db *DB) countSpillover() {
+	atomic.AddUint64(&db.metrics.spillovers, 1)
+}
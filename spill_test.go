@@ -0,0 +1,99 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetSpilloverPolicy(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	tests := []struct {
+		policy *SpilloverPolicy
+		valid  bool
+	}{
+		{nil, true},
+		{&SpilloverPolicy{}, true},
+		{&SpilloverPolicy{Threshold: 1.5}, false},
+		{&SpilloverPolicy{PrimaryThreshold: -0.1}, false},
+		{&SpilloverPolicy{MaxPercentage: 101}, false},
+	}
+	for _, test := range tests {
+		if err = db.SetSpilloverPolicy(test.policy); (err == nil) != test.valid || (err != nil && !errors.Is(err, ErrInvalidConfig)) {
+			t.Errorf("actual err: %v, expected valid: %t for %+v", err, test.valid, test.policy)
+		}
+	}
+	if err = db.SetSpilloverPolicy(&SpilloverPolicy{}); err != nil {
+		t.Fatalf("error %s when SetSpilloverPolicy", err)
+	}
+	expected := SpilloverPolicy{Threshold: 0.9, MaxPercentage: 10, PrimaryThreshold: 0.7}
+	if actual := db.replicaSpilloverPolicy(); *actual != expected {
+		t.Errorf("actual policy: %+v, expected: %+v", *actual, expected)
+	}
+}
+
+func TestSpillover(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	r1.db.SetMaxOpenConns(1)
+	if err = db.SetSpilloverPolicy(&SpilloverPolicy{Threshold: 0.5, MaxPercentage: 100}); err != nil {
+		t.Fatalf("error %s when SetSpilloverPolicy", err)
+	}
+
+	// the only connection of r1 is in use by open rows
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	held, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	if actual := db.utilization(r1.db); actual != 1 {
+		t.Errorf("actual utilization: %f, expected: 1", actual)
+	}
+
+	p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	rows, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+	held.Close()
+
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	rows, err = db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+
+	metrics := db.Metrics()
+	if metrics.Spillovers != 1 || metrics.ReadsPrimary != 1 || metrics.ReadsReplica[0] != 2 {
+		t.Errorf("actual metrics: %+v, expected 1 read spilled to primary", metrics)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,96 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// staleConnMessages are messages of stale connection errors returned by drivers without wrapping
+// `driver.ErrBadConn`, e.g. `mysql.ErrInvalidConn` or errors of lib/pq on a connection closed by the server
+var staleConnMessages = []string{
+	"invalid connection",
+	"server closed the connection unexpectedly",
+	"broken pipe",
+	"connection reset by peer",
+}
+
+// IsStaleConnError returns true if err tells the connection was closed or recycled, e.g. by a proxy or a managed database,
+// so that the statement is worth retrying on another connection of the same target
+func IsStaleConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch {
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return true
+	}
+	msg := err.Error()
+	for _, m := range staleConnMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// staleConnDialect is a Dialect telling stale connection errors by error codes of the driver
+type staleConnDialect interface {
+	IsStaleConn(err error) bool
+}
+
+func (postgresDialect) IsStaleConn(err error) bool {
+	var e interface{ SQLState() string }
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.SQLState() {
+	case "57P01", "08003", "08006": // admin_shutdown, connection_does_not_exist, connection_failure
+		return true
+	}
+	return false
+}
+
+func (mysqlDialect) IsStaleConn(err error) bool {
+	number, ok := errorCode(err, "Number")
+	return ok && (number == 2006 || number == 2013) // server has gone away, lost connection
+}
+
+// SetStaleConnRetry sets whether a statement failed by a stale connection error (see `IsStaleConnError()`)
+// is retried once on another connection of the same target, before `FallbackPolicy` applies.
+// Writes are retried only for `driver.ErrBadConn` and `sql.ErrConnDone`, which are returned before the statement is sent.
+// It is enabled by default. `QueryRow()` and `QueryRowContext()` are not retried, as their errors are deferred to `Scan()`.
+// Calls with ctx of `WithNoRetry()` or `WithMaxAttempts()` are retried only within their attempts.
+func (db *DB) SetStaleConnRetry(enabled bool) {
+	db.configMutex.Lock()
+	db.noStaleConnRetry = !enabled
+	db.configMutex.Unlock()
+}
+
+// isStaleConn returns true if err is a stale connection error, by `IsStaleConnError()` or Dialect
+func (db *DB) isStaleConn(err error) bool {
+	if IsStaleConnError(err) {
+		return true
+	}
+	d, ok := db.sqlDialect().(staleConnDialect)
+	return ok && d.IsStaleConn(err)
+}
+
+// retryStale returns true if the statement of info failed by err should be retried on a fresh connection
+func (db *DB) retryStale(info StatementInfo, err error) bool {
+	if !db.isStaleConn(err) {
+		return false
+	}
+	if info.Query != "" && !db.isQuery(info.Query) && !errors.Is(err, driver.ErrBadConn) && !errors.Is(err, sql.ErrConnDone) {
+		// the write may have been applied before the connection broke
+		return false
+	}
+	atomic.AddUint64(&db.metrics.staleConnRetries, 1)
+	return true
+}
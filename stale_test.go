@@ -0,0 +1,107 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"syscall"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestIsStaleConnError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{driver.ErrBadConn, true},
+		{sql.ErrConnDone, true},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{fmt.Errorf("write: %w", syscall.EPIPE), true},
+		{errors.New("invalid connection"), true},
+		{errors.New("pq: server closed the connection unexpectedly"), true},
+		{sql.ErrNoRows, false},
+		{errors.New("syntax error"), false},
+	}
+	for _, test := range tests {
+		if actual := IsStaleConnError(test.err); actual != test.expected {
+			t.Errorf("IsStaleConnError(%v): actual %t, expected %t", test.err, actual, test.expected)
+		}
+	}
+}
+
+func TestStaleConnRetry(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	tests := []struct {
+		dialect       Dialect
+		mock          *mydbMock
+		query         string
+		err           error
+		disabled      bool
+		expectedRetry bool
+	}{
+		{nil, r1, fmt.Sprintf(selectQueryTmpl, "*"), io.ErrUnexpectedEOF, false, true},
+		{nil, r1, fmt.Sprintf(selectQueryTmpl, "*"), io.ErrUnexpectedEOF, true, false},
+		{nil, r1, fmt.Sprintf(selectQueryTmpl, "*"), errors.New("syntax error"), false, false},
+		{PostgresDialect, r1, fmt.Sprintf(selectQueryTmpl, "*"), &pqError{"57P01"}, false, true},
+		{MySQLDialect, r1, fmt.Sprintf(selectQueryTmpl, "*"), &mysqlError{2013}, false, true},
+		{nil, p, fmt.Sprintf(deleteQuueryTmpl, ""), io.ErrUnexpectedEOF, false, false},
+		{nil, p, fmt.Sprintf(deleteQuueryTmpl, ""), sql.ErrConnDone, false, true},
+	}
+	for i, test := range tests {
+		db.SetDialect(test.dialect)
+		db.SetStaleConnRetry(!test.disabled)
+		db.ResetMetrics()
+		isQuery := test.mock == r1
+		if isQuery {
+			test.mock.mock.ExpectQuery(regexp.QuoteMeta(test.query)).WillReturnError(test.err)
+		} else {
+			test.mock.mock.ExpectExec(regexp.QuoteMeta(test.query)).WillReturnError(test.err)
+		}
+		if test.expectedRetry {
+			if isQuery {
+				test.mock.mock.ExpectQuery(regexp.QuoteMeta(test.query)).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+			} else {
+				test.mock.mock.ExpectExec(regexp.QuoteMeta(test.query)).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+		}
+
+		if isQuery {
+			var rows *sql.Rows
+			rows, err = db.Query(test.query)
+			if rows != nil {
+				rows.Close()
+			}
+		} else {
+			_, err = db.Exec(test.query)
+		}
+		if actual := err == nil; actual != test.expectedRetry {
+			t.Errorf("%d: actual err = %v, expected retry %t", i, err, test.expectedRetry)
+		}
+		expectedRetries := uint64(0)
+		if test.expectedRetry {
+			expectedRetries = 1
+		}
+		if actual := db.Metrics().StaleConnRetries; actual != expectedRetries {
+			t.Errorf("%d: actual stale conn retries = %d, expected = %d", i, actual, expectedRetries)
+		}
+		if err := test.mock.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%d: there were unfulfilled expectations: %s", i, err)
+		}
+	}
+}
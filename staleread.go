@@ -0,0 +1,139 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// writeTracker remembers keys of recent writes for `SetStaleReadRetry()`,
+// swept by writes once a window so that keys older than the window are dropped
+type writeTracker struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	writes    map[writeKey]time.Time
+	lastSweep time.Time
+}
+
+// writeKey identifies the context of a write: its session token set by `WithSessionToken()` if any,
+// otherwise its Done channel, which is shared by contexts derived by values (e.g. `context.WithValue()`)
+type writeKey struct {
+	token string
+	done  <-chan struct{}
+}
+
+// writeKeyOf returns the writeKey of ctx, false if ctx can't be told from others,
+// e.g. `context.Background()` without session token which is never cancelled
+func writeKeyOf(ctx context.Context) (writeKey, bool) {
+	if token := SessionTokenFromContext(ctx); token != "" {
+		return writeKey{token: token}, true
+	}
+	done := ctx.Done()
+	return writeKey{done: done}, done != nil
+}
+
+// SetStaleReadRetry retries single-row reads by `QueryRowContext()` (and `QueryRowTarget()`) once on primary DB,
+// if they select no rows on a read replica and the same ctx was passed to a write (`ExecContext()`, `BeginTx()` or
+// `RunInTx()` not read-only, `ExecContext()` of `PrepareStmt()`, `WithPrimaryConn()`) within window,
+// as the row may just not be replicated yet. No caller changes are needed: contexts are the same if they are
+// cancelled together, e.g. the context of an HTTP request and ones derived from it by `context.WithValue()`
+// or helpers such as `WithStatementID()`, but not ones derived by `context.WithTimeout()`, and uncancellable
+// contexts such as `context.Background()` are never tracked. Contexts with a session token set by `WithSessionToken()`
+// are the same if their tokens are, e.g. to follow writes across requests of a user.
+// Retried reads are counted in `RoutingMetrics.StaleReadsAvoided`.
+// Reads after writes are run on read replicas eagerly, so errors of the statement are returned by `Scan()` as usual.
+// Non-positive window disables retries, which is the default.
+func (db *DB) SetStaleReadRetry(window time.Duration) {
+	var tracker *writeTracker
+	if window > 0 {
+		tracker = &writeTracker{window: window, writes: map[writeKey]time.Time{}}
+	}
+	db.configMutex.Lock()
+	db.writeTracker = tracker
+	db.configMutex.Unlock()
+}
+
+// staleReadTracker returns current writeTracker, nil if not set
+func (db *DB) staleReadTracker() *writeTracker {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.writeTracker
+}
+
+// markWrite remembers a write with ctx, if `SetStaleReadRetry()` is enabled
+func (db *DB) markWrite(ctx context.Context) {
+	t := db.staleReadTracker()
+	if t == nil {
+		return
+	}
+	key, ok := writeKeyOf(ctx)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.lastSweep) >= t.window {
+		for key, at := range t.writes {
+			if now.Sub(at) >= t.window {
+				delete(t.writes, key)
+			}
+		}
+		t.lastSweep = now
+	}
+	t.writes[key] = now
+}
+
+// wroteRecently returns true if a write with ctx is remembered within the window of `SetStaleReadRetry()`
+func (db *DB) wroteRecently(ctx context.Context) bool {
+	t := db.staleReadTracker()
+	if t == nil {
+		return false
+	}
+	key, ok := writeKeyOf(ctx)
+	if !ok {
+		return false
+	}
+	t.mu.Lock()
+	at, ok := t.writes[key]
+	t.mu.Unlock()
+	return ok && time.Since(at) < t.window
+}
+
+// queryRowAfterWrite is `QueryRowContext()` on read replica tgtdb after a write of the same context,
+// reading the row eagerly to retry on primary DB if there is none
+func (db *DB) queryRowAfterWrite(ctx context.Context, stmt StatementInfo, tgtdb *sql.DB, args []interface{}) (*sql.Row, *sql.DB) {
+	var rows *sql.Rows
+	err := db.runStatement(ctx, stmt, tgtdb, func(query string) error {
+		var err error
+		rows, err = tgtdb.QueryContext(ctx, query, args...)
+		return err
+	})
+	var result *flightResult
+	if err == nil {
+		result, err = readFlightResult(tgtdb, rows, 1)
+	}
+	if err != nil {
+		db.metrics.countError(err)
+		return errRow(err), tgtdb
+	}
+	if len(result.values) > 0 || db.PrimaryInMaintenance() || db.master == nil {
+		return memDB.QueryRowContext(ctx, "", result), tgtdb
+	}
+
+	db.debugf(DebugRouting, "[QueryRowContext] no rows on replica: %s after write, retry on primary", db.targetInfo(tgtdb).Name)
+	atomic.AddUint64(&db.metrics.staleReadsAvoided, 1)
+	db.countRead(db.master)
+	var row *sql.Row
+	if err := db.runStatement(ctx, stmt, db.master, func(query string) error {
+		row = db.master.QueryRowContext(ctx, query, args...)
+		return nil
+	}); err != nil {
+		db.metrics.countError(err)
+		return errRow(err), db.master
+	}
+	return row, db.master
+}
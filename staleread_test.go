@@ -0,0 +1,159 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetStaleReadRetry(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+	db.SetStaleReadRetry(time.Minute)
+	selectQuery := fmt.Sprintf(selectQueryTmpl, "id")
+	ctx, cancel := context.WithCancel(WithSessionToken(context.Background(), "user-1"))
+	defer cancel()
+
+	p.mock.ExpectExec("insert into mytable").WillReturnResult(sqlmock.NewResult(1, 1))
+	if _, err := db.ExecContext(ctx, "insert into mytable (id) values (1)"); err != nil {
+		t.Fatalf("error %s when ExecContext", err)
+	}
+
+	tests := []struct {
+		ctx      context.Context
+		replica  *sqlmock.Rows
+		primary  *sqlmock.Rows
+		expected int
+		err      error
+	}{
+		// not replicated yet, retried on primary DB
+		{ctx, sqlmock.NewRows([]string{"id"}), sqlmock.NewRows([]string{"id"}).AddRow(1), 1, nil},
+		// replicated
+		{ctx, sqlmock.NewRows([]string{"id"}).AddRow(2), nil, 2, nil},
+		// not found on primary DB either
+		{ctx, sqlmock.NewRows([]string{"id"}), sqlmock.NewRows([]string{"id"}), 0, sql.ErrNoRows},
+		// contexts of the same session
+		{WithStatementID(ctx, "derived"), sqlmock.NewRows([]string{"id"}), sqlmock.NewRows([]string{"id"}).AddRow(3), 3, nil},
+		{WithSessionToken(context.Background(), "user-1"), sqlmock.NewRows([]string{"id"}), sqlmock.NewRows([]string{"id"}).AddRow(4), 4, nil},
+		// other sessions
+		{context.Background(), sqlmock.NewRows([]string{"id"}), nil, 0, sql.ErrNoRows},
+		{WithSessionToken(ctx, "user-2"), sqlmock.NewRows([]string{"id"}), nil, 0, sql.ErrNoRows},
+	}
+	for i, test := range tests {
+		r0.mock.ExpectQuery(selectQuery).WillReturnRows(test.replica)
+		if test.primary != nil {
+			p.mock.ExpectQuery(selectQuery).WillReturnRows(test.primary)
+		}
+		var id int
+		if err := db.QueryRowContext(test.ctx, selectQuery).Scan(&id); err != test.err || id != test.expected {
+			t.Errorf("actual id: %d, err: %v, expected: %d, %v of test %d", id, err, test.expected, test.err, i)
+		}
+	}
+	if actual := db.Metrics().StaleReadsAvoided; actual != 4 {
+		t.Errorf("actual stale reads avoided: %d, expected: 4", actual)
+	}
+	if token := SessionTokenFromContext(ctx); token != "user-1" {
+		t.Errorf("actual session token: %s, expected: user-1", token)
+	}
+
+	db.SetStaleReadRetry(0)
+	r0.mock.ExpectQuery(selectQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	var id int
+	if err := db.QueryRowContext(ctx, selectQuery).Scan(&id); err != sql.ErrNoRows {
+		t.Errorf("actual err: %v, expected: %s when disabled", err, sql.ErrNoRows)
+	}
+
+	for _, m := range []*mydbMock{p, r0} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestStaleReadRetryWithoutSessionToken(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db)
+	defer db.Close()
+	db.SetStaleReadRetry(time.Minute)
+	selectQuery := fmt.Sprintf(selectQueryTmpl, "id")
+	// e.g. the context of an HTTP request
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p.mock.ExpectExec("insert into mytable").WillReturnResult(sqlmock.NewResult(1, 1))
+	if _, err := db.ExecContext(ctx, "insert into mytable (id) values (1)"); err != nil {
+		t.Fatalf("error %s when ExecContext", err)
+	}
+	timeout, cancelTimeout := context.WithTimeout(ctx, time.Minute)
+	defer cancelTimeout()
+
+	tests := []struct {
+		ctx     context.Context
+		retried bool
+	}{
+		{ctx, true},
+		{WithStatementID(ctx, "derived"), true},
+		{context.WithValue(ctx, directiveKey{}, RoutingDirective{Workload: "batch"}), true},
+		{timeout, false},
+		{context.Background(), false},
+	}
+	for i, test := range tests {
+		r0.mock.ExpectQuery(selectQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		expected, expectedErr := 0, sql.ErrNoRows
+		if test.retried {
+			p.mock.ExpectQuery(selectQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			expected, expectedErr = 1, nil
+		}
+		var id int
+		if err := db.QueryRowContext(test.ctx, selectQuery).Scan(&id); err != expectedErr || id != expected {
+			t.Errorf("actual id: %d, err: %v, expected: %d, %v of test %d", id, err, expected, expectedErr, i)
+		}
+	}
+	for _, m := range []*mydbMock{p, r0} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestWriteTrackerSweep(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, p.db)
+	defer db.Close()
+	db.SetStaleReadRetry(time.Millisecond)
+	db.markWrite(context.Background())
+	db.markWrite(WithSessionToken(context.Background(), "user-1"))
+	time.Sleep(2 * time.Millisecond)
+	db.markWrite(WithSessionToken(context.Background(), "user-2"))
+
+	tracker := db.staleReadTracker()
+	tracker.mu.Lock()
+	_, old := tracker.writes[writeKey{token: "user-1"}]
+	n := len(tracker.writes)
+	tracker.mu.Unlock()
+	if old || n != 1 {
+		t.Errorf("actual writes: %d, user-1 remembered: %t, expected: only user-2", n, old)
+	}
+}
@@ -0,0 +1,227 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// StatementInfo describes a statement sent to a target, passed to `Hook`
+type StatementInfo struct {
+	// ID is the statement ID, shared by all attempts of a logical statement,
+	// taken from ctx created by `WithStatementID()` or generated otherwise
+	ID string
+
+	// Method is the name of the called method of DB, e.g. `QueryContext`,
+	// prefixed by `Tx.` or `Stmt.` for methods of `*Tx` and `*Stmt`, e.g. `Tx.ExecContext`
+	Method string
+
+	// TxID is the ID of the transaction of `RunInTx()` the statement runs in, empty outside transactions
+	TxID string
+
+	Query string
+	Args  []interface{}
+
+	// Target is the DB the statement is sent to
+	Target TargetInfo
+
+	// Duration & Err are the result of the statement, only set for `Hook.AfterStatement()`
+	Duration time.Duration
+	Err      error
+}
+
+// Hook observes statements sent to primary DB & read replicas.
+// Hooks are called synchronously for each attempt of a statement, so they should return quickly.
+type Hook interface {
+	// BeforeStatement is called before the statement is sent to the target
+	BeforeStatement(ctx context.Context, info StatementInfo)
+
+	// AfterStatement is called after the statement returned
+	AfterStatement(ctx context.Context, info StatementInfo)
+}
+
+// StatementIDOptions decides where statement IDs are propagated other than hooks and debug output
+type StatementIDOptions struct {
+	// Comment prepends `/* stmt_id=<ID> */` to SQL sent to DB, so that database server logs can be correlated.
+	// SQL of prepared statements is not commented, as they outlive the statement.
+	Comment bool
+
+	// WrapErrors wraps errors returned by primary DB & read replicas in `*StatementError`
+	WrapErrors bool
+}
+
+// StatementError is an error returned by a statement, wrapped when `StatementIDOptions.WrapErrors` is true
+type StatementError struct {
+	ID     string
+	Target TargetInfo
+	Err    error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("stmt_id=%s target=%s: %s", e.ID, e.Target.Name, e.Err)
+}
+
+// Unwrap returns the error returned by the statement
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// statementIDPrefix is random per process, so that generated statement IDs are unique across processes
+var statementIDPrefix = func() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}()
+
+var statementIDCount uint64
+
+// newStatementID returns a new statement ID unique in the process
+func newStatementID() string {
+	return statementIDPrefix + "-" + strconv.FormatUint(atomic.AddUint64(&statementIDCount, 1), 36)
+}
+
+// AddHook adds h to hooks called for each statement
+func (db *DB) AddHook(h Hook) {
+	db.configMutex.Lock()
+	db.hooks = append(db.hooks, h)
+	db.configMutex.Unlock()
+}
+
+// SetStatementIDOptions sets StatementIDOptions, zero value (hooks & debug output only) by default
+func (db *DB) SetStatementIDOptions(o StatementIDOptions) {
+	db.configMutex.Lock()
+	db.statementIDOptions = o
+	db.configMutex.Unlock()
+}
+
+// beginStatement returns ctx with statement ID and StatementInfo of a logical statement routed by DB,
+// auditing routing overrides in ctx
+func (db *DB) beginStatement(ctx context.Context, method, query string, args []interface{}) (context.Context, StatementInfo) {
+	ctx, info := db.newStatement(ctx, method, query, args)
+	db.auditOverrides(ctx, info)
+	return ctx, info
+}
+
+// newStatement returns ctx with statement ID and StatementInfo of a logical statement
+func (db *DB) newStatement(ctx context.Context, method, query string, args []interface{}) (context.Context, StatementInfo) {
+	id := StatementIDFromContext(ctx)
+	if id == "" {
+		id = newStatementID()
+		ctx = WithStatementID(ctx, id)
+	}
+	if n := MaxAttemptsFromContext(ctx); n > 0 {
+		ctx = context.WithValue(ctx, attemptsKey{}, &attempts{max: uint64(n)})
+	}
+	info := StatementInfo{ID: id, Method: method, Query: query, Args: args}
+	if query != "" {
+		ctx = db.takeQueryBudget(ctx, info)
+	}
+	return ctx, info
+}
+
+// attemptsKey is the context key for attempts of a statement limited by `WithMaxAttempts()`
+type attemptsKey struct{}
+
+// attempts counts attempts of a statement limited by `WithMaxAttempts()`
+type attempts struct {
+	// count is the number of attempts made, accessed atomically
+	count uint64
+	max   uint64
+}
+
+// countAttempt counts an attempt of the statement of ctx
+func countAttempt(ctx context.Context) {
+	if a, ok := ctx.Value(attemptsKey{}).(*attempts); ok {
+		atomic.AddUint64(&a.count, 1)
+	}
+}
+
+// retryAllowed returns false if the statement of ctx has already been attempted as many times as `WithMaxAttempts()`
+func retryAllowed(ctx context.Context) bool {
+	a, ok := ctx.Value(attemptsKey{}).(*attempts)
+	return !ok || atomic.LoadUint64(&a.count) < a.max
+}
+
+// runStatement runs an attempt of the statement of info on tgtdb, calling hooks around it.
+// run receives SQL to send, with the statement ID comment if enabled and rewritten by `QueryInjector` of the target if set.
+// It fails if the statement is beyond `WithQueryBudget()` of ctx, and waits for a slot of the workload of ctx
+// by `WorkloadPolicy` first,
+// and retries once on the same target by a stale connection error, see `SetStaleConnRetry()`,
+// unless attempts are limited by `WithMaxAttempts()`.
+// Statements in a transaction are neither limited nor retried, as they run on the connection of the transaction.
+func (db *DB) runStatement(ctx context.Context, info StatementInfo, tgtdb *sql.DB, run func(query string) error) error {
+	if err := queryBudgetExceeded(ctx); err != nil {
+		db.debugf(DebugError, "[%s] stmt_id: %s, err: %s", info.Method, info.ID, err)
+		return err
+	}
+	inTx := info.TxID != ""
+	if !inTx {
+		release, err := db.acquireWorkload(ctx, tgtdb)
+		if err != nil {
+			db.debugf(DebugError, "[%s] stmt_id: %s, err: %s", info.Method, info.ID, err)
+			return err
+		}
+		defer release()
+	}
+
+	db.configMutex.RLock()
+	hooks := db.hooks
+	opts := db.statementIDOptions
+	staleConnRetry := !db.noStaleConnRetry
+	injectors := db.queryInjectors
+	transportHint := db.transportHint
+	db.configMutex.RUnlock()
+
+	info.Target = db.targetInfo(tgtdb)
+	if err := checkProxyCompat(info, inTx); err != nil {
+		db.debugf(DebugError, "[%s] stmt_id: %s, err: %s", info.Method, info.ID, err)
+		return err
+	}
+	query := info.Query
+	if opts.Comment && query != "" {
+		// IDs are generated or given by the caller; `*/` must not terminate the comment early
+		query = "/* stmt_id=" + strings.Replace(info.ID, "*/", "", -1) + " */ " + query
+	}
+	if inject := injectors[info.Target.Name]; inject != nil && query != "" {
+		query = inject(query)
+	}
+	if transportHint != nil && query != "" {
+		query = transportHint(info, query)
+	}
+	// hooks and capture observe redacted args, while run has args as they are
+	info.Args = db.redactArgs(info.Query, info.Args)
+	for _, h := range hooks {
+		h.BeforeStatement(ctx, info)
+	}
+	start := time.Now()
+	countAttempt(ctx)
+	err := run(query)
+	if err != nil && !inTx && staleConnRetry && ctx.Err() == nil && retryAllowed(ctx) && db.retryStale(info, err) {
+		db.recordError(info.Target, info.Method, info.ID, err)
+		db.debugf(DebugEvent, "[%s] stmt_id: %s, target: %+v, retry on stale connection, err: %s", info.Method, info.ID, info.Target, err)
+		countAttempt(ctx)
+		err = run(query)
+	}
+	info.Duration = time.Since(start)
+	info.Err = err
+	for _, h := range hooks {
+		h.AfterStatement(ctx, info)
+	}
+	db.captureStatement(info)
+	if err != nil {
+		db.recordError(info.Target, info.Method, info.ID, err)
+		db.debugf(DebugError, "[%s] stmt_id: %s, target: %+v, err: %s", info.Method, info.ID, info.Target, err)
+		if opts.WrapErrors {
+			return &StatementError{ID: info.ID, Target: info.Target, Err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+type recordingHook struct {
+	before []StatementInfo
+	after  []StatementInfo
+}
+
+func (h *recordingHook) BeforeStatement(ctx context.Context, info StatementInfo) {
+	h.before = append(h.before, info)
+}
+
+func (h *recordingHook) AfterStatement(ctx context.Context, info StatementInfo) {
+	if StatementIDFromContext(ctx) != info.ID {
+		panic("statement ID of ctx does not match")
+	}
+	h.after = append(h.after, info)
+}
+
+func TestNewStatementID(t *testing.T) {
+	id1, id2 := newStatementID(), newStatementID()
+	if id1 == id2 || !strings.HasPrefix(id1, statementIDPrefix+"-") {
+		t.Errorf("actual ids = %s, %s, expected unique ids with prefix %s", id1, id2, statementIDPrefix)
+	}
+}
+
+func TestHook(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	db.SetFallbackPolicy(&FallbackPolicy{Actions: map[ErrorClass]FallbackAction{ErrorClassOther: FallbackRetryReplica}})
+	h := &recordingHook{}
+	db.AddHook(h)
+
+	query := fmt.Sprintf(selectQueryTmpl, "*")
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(fmt.Errorf("replica error"))
+	r2.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	if _, err = db.QueryContext(WithStatementID(context.Background(), "my-id"), query); err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	p.mock.ExpectExec(fmt.Sprintf(deleteQuueryTmpl, "")).WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err = db.Exec(fmt.Sprintf(deleteQuueryTmpl, "")); err != nil {
+		t.Fatalf("error %s when Exec", err)
+	}
+
+	if len(h.before) != 3 || len(h.after) != 3 {
+		t.Fatalf("actual hook calls = %d, %d, expected = 3, 3", len(h.before), len(h.after))
+	}
+	expected := []StatementInfo{
+		{ID: "my-id", Method: "QueryContext", Query: query, Target: TargetInfo{Role: RoleReplica, Index: 0, Name: "replica-0", Weight: 1}},
+		{ID: "my-id", Method: "QueryContext", Query: query, Target: TargetInfo{Role: RoleReplica, Index: 1, Name: "replica-1", Weight: 1}},
+		{ID: h.after[2].ID, Method: "Exec", Query: fmt.Sprintf(deleteQuueryTmpl, ""), Target: TargetInfo{Role: RolePrimary, Name: "primary", Weight: 1}},
+	}
+	for i, e := range expected {
+		a := h.after[i]
+		if a.ID != e.ID || a.Method != e.Method || a.Query != e.Query || a.Target != e.Target {
+			t.Errorf("actual = %+v, expected = %+v", a, e)
+		}
+		if b := h.before[i]; b.ID != a.ID || b.Target != a.Target || b.Err != nil || b.Duration != 0 {
+			t.Errorf("actual before = %+v, expected to match after = %+v", b, a)
+		}
+	}
+	if h.after[0].Err == nil || h.after[1].Err != nil {
+		t.Errorf("actual errs = %v, %v, expected = replica error, nil", h.after[0].Err, h.after[1].Err)
+	}
+	if h.after[2].ID == "" || h.after[2].ID == "my-id" {
+		t.Errorf("actual generated id = %q", h.after[2].ID)
+	}
+}
+
+func TestStatementIDOptions(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	db.SetStatementIDOptions(StatementIDOptions{Comment: true, WrapErrors: true})
+
+	errDriver := fmt.Errorf("driver error")
+	ctx := WithStatementID(context.Background(), "my-id")
+	r1.mock.ExpectQuery(regexp.QuoteMeta("/* stmt_id=my-id */ select * from mytable")).WillReturnError(errDriver)
+	_, err = db.QueryContext(ctx, fmt.Sprintf(selectQueryTmpl, "*"))
+	var se *StatementError
+	if !errors.As(err, &se) || se.ID != "my-id" || se.Target != (TargetInfo{Role: RoleReplica, Name: "replica-0", Weight: 1}) || !errors.Is(err, errDriver) {
+		t.Errorf("actual err = %v, expected *StatementError wrapping %s", err, errDriver)
+	}
+
+	p.mock.ExpectPrepare("^delete from mytable$").WillReturnError(errDriver)
+	if _, err = db.PrepareContext(ctx, fmt.Sprintf(deleteQuueryTmpl, "")); !errors.As(err, &se) {
+		t.Errorf("actual err = %v, expected *StatementError", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
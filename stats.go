@@ -0,0 +1,151 @@
+package gosqlrwdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StatsReport is a compact summary of a `DB` reported periodically by `StatsReporter`.
+// Counters are increases since the previous report, counted from zero if reset by `ResetMetrics()` in between.
+type StatsReport struct {
+	// Time is when the report is made, Period is the time since the previous report
+	Time   time.Time
+	Period time.Duration
+
+	// ReadsPrimary, ReadsReplica & Writes are the routing mix, see `RoutingMetrics`
+	ReadsPrimary uint64
+	ReadsReplica uint64
+	Writes       uint64
+
+	// Failovers & Fallbacks are reads routed to another DB than selected, see `RoutingMetrics`
+	Failovers uint64
+	Fallbacks uint64
+
+	// Errors is the number of errors by type, see `ErrorType*` for keys. Types without errors are omitted.
+	Errors map[string]uint64
+
+	// PrimaryHealthy is true if primary DB passed the last health check or is in maintenance mode
+	PrimaryHealthy bool
+
+	// HealthyReplicas & Replicas are numbers of read replicas passing the last health check and of all, excluding drained ones
+	HealthyReplicas int
+	Replicas        int
+
+	// PrimaryInUse & PrimaryOpen are connections in use and open of primary DB,
+	// ReplicasInUse & ReplicasOpen are those summed over read replicas.
+	// Connections in use exclude dedicated ones of `WithDedicatedConn()`, which are DedicatedConns of all targets.
+	PrimaryInUse   int
+	PrimaryOpen    int
+	ReplicasInUse  int
+	ReplicasOpen   int
+	DedicatedConns int
+}
+
+// String returns the report in one line of `key=value` pairs, e.g.
+// `reads=primary:3,replica:120 writes=15 failovers=1 fallbacks=0 errors=driver:2 health=primary:up,replicas:2/3 conns=primary:2/10,replicas:5/20`
+func (r StatsReport) String() string {
+	primary := "up"
+	if !r.PrimaryHealthy {
+		primary = "down"
+	}
+	errorCounts := "0"
+	if len(r.Errors) > 0 {
+		types := make([]string, 0, len(r.Errors))
+		for t, n := range r.Errors {
+			types = append(types, fmt.Sprintf("%s:%d", t, n))
+		}
+		sort.Strings(types)
+		errorCounts = strings.Join(types, ",")
+	}
+	return fmt.Sprintf("reads=primary:%d,replica:%d writes=%d failovers=%d fallbacks=%d errors=%s health=primary:%s,replicas:%d/%d conns=primary:%d/%d,replicas:%d/%d",
+		r.ReadsPrimary, r.ReadsReplica, r.Writes, r.Failovers, r.Fallbacks, errorCounts,
+		primary, r.HealthyReplicas, r.Replicas, r.PrimaryInUse, r.PrimaryOpen, r.ReplicasInUse, r.ReplicasOpen)
+}
+
+// StatsReporter reports `StatsReport` every `Interval`, as poor-man's observability without metrics infrastructure
+type StatsReporter struct {
+	// Interval is the interval of reports, must be positive
+	Interval time.Duration
+
+	// Report is called with each report. If nil, the report is printed in one line by `DebugConfig.Printf`
+	// of `SetDebug()` regardless of `DebugConfig.Level`, or by `fmt.Printf` if `SetDebug()` is not called.
+	Report func(StatsReport)
+}
+
+// SetStatsReporter starts reporting statistics by r in background, replacing the current reporter.
+// Passing nil or r with non-positive `Interval` stops reporting, which is the default.
+func (db *DB) SetStatsReporter(r *StatsReporter) {
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+	if db.statsReporter != nil {
+		db.statsReporter.Stop()
+		db.statsReporter = nil
+	}
+	if r == nil || r.Interval <= 0 || db.closed {
+		return
+	}
+	report := r.Report
+	if report == nil {
+		report = db.printStats
+	}
+	previous := db.Metrics()
+	at := time.Now()
+	db.statsReporter = startHeartbeater(r.Interval, func() {
+		current := db.Metrics()
+		now := time.Now()
+		report(db.statsReport(previous, current, now.Sub(at), now))
+		previous, at = current, now
+	})
+}
+
+// statsReport returns StatsReport of counters from previous to current metrics in period until now
+func (db *DB) statsReport(previous, current RoutingMetrics, period time.Duration, now time.Time) StatsReport {
+	r := StatsReport{
+		Time:         now,
+		Period:       period,
+		ReadsPrimary: delta(previous.ReadsPrimary, current.ReadsPrimary),
+		Writes:       delta(previous.Writes, current.Writes),
+		Failovers:    delta(previous.Failovers, current.Failovers),
+		Fallbacks:    delta(previous.Fallbacks, current.Fallbacks),
+		Errors:       map[string]uint64{},
+	}
+	for i, n := range current.ReadsReplica {
+		r.ReadsReplica += delta(previous.ReadsReplica[i], n)
+	}
+	for t, n := range current.Errors {
+		if d := delta(previous.Errors[t], n); d > 0 {
+			r.Errors[t] = d
+		}
+	}
+	r.PrimaryHealthy, _ = db.healthy()
+	r.HealthyReplicas, r.Replicas = db.healthyReplicas()
+	if db.master != nil {
+		r.PrimaryInUse, r.PrimaryOpen = db.inUse(db.master), db.master.Stats().OpenConnections
+		r.DedicatedConns += db.dedicated(db.master)
+	}
+	for _, replica := range db.readreplicas {
+		r.ReplicasInUse += db.inUse(replica)
+		r.ReplicasOpen += replica.Stats().OpenConnections
+		r.DedicatedConns += db.dedicated(replica)
+	}
+	return r
+}
+
+// delta returns the increase of a counter from previous to current, current itself if it was reset in between
+func delta(previous, current uint64) uint64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// printStats prints r in one line by `DebugConfig.Printf`, or `fmt.Printf` if `SetDebug()` is not called
+func (db *DB) printStats(r StatsReport) {
+	if c, _ := db.debugConfig.Load().(*DebugConfig); c != nil {
+		c.Printf("[mydb] [stats] %s\n", r)
+		return
+	}
+	fmt.Printf("[mydb] [stats] %s\n", r)
+}
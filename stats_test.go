@@ -0,0 +1,95 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestStatsReportString(t *testing.T) {
+	r := StatsReport{
+		ReadsPrimary:    3,
+		ReadsReplica:    120,
+		Writes:          15,
+		Failovers:       1,
+		Errors:          map[string]uint64{ErrorTypeDriver: 2, ErrorTypeCanceled: 1},
+		HealthyReplicas: 2,
+		Replicas:        3,
+		PrimaryInUse:    2,
+		PrimaryOpen:     10,
+		ReplicasInUse:   5,
+		ReplicasOpen:    20,
+	}
+	expected := "reads=primary:3,replica:120 writes=15 failovers=1 fallbacks=0 errors=canceled:1,driver:2 " +
+		"health=primary:down,replicas:2/3 conns=primary:2/10,replicas:5/20"
+	if actual := r.String(); actual != expected {
+		t.Errorf("actual = %s, expected = %s", actual, expected)
+	}
+}
+
+func TestSetStatsReporter(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	// reads before the reporter starts are not reported
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	rows, err := db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+
+	reports := make(chan StatsReport, 10)
+	db.SetStatsReporter(&StatsReporter{Interval: 20 * time.Millisecond, Report: func(r StatsReport) {
+		select {
+		case reports <- r:
+		default:
+		}
+	}})
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnError(fmt.Errorf("syntax error"))
+	db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*"))
+	p.mock.ExpectExec("delete from mytable").WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err = db.Exec(fmt.Sprintf(deleteQuueryTmpl, "where column1 = 1")); err != nil {
+		t.Fatalf("error %s when Exec", err)
+	}
+
+	// reports are summed up, as statements may be split across reports
+	actual := StatsReport{Errors: map[string]uint64{}}
+	timeout := time.After(time.Second)
+	for actual.Writes == 0 {
+		select {
+		case r := <-reports:
+			actual.ReadsReplica += r.ReadsReplica
+			actual.Writes += r.Writes
+			actual.Errors[ErrorTypeDriver] += r.Errors[ErrorTypeDriver]
+			actual.Replicas, actual.Period = r.Replicas, r.Period
+		case <-timeout:
+			t.Fatalf("actual report: %+v, expected reported every interval", actual)
+		}
+	}
+	db.SetStatsReporter(nil)
+	if actual.ReadsReplica != 1 || actual.Writes != 1 || actual.Errors[ErrorTypeDriver] != 1 || actual.Replicas != 1 || actual.Period <= 0 {
+		t.Errorf("actual report: %+v, expected 1 read, 1 write and 1 error since started", actual)
+	}
+
+	var lines []string
+	db.SetDebug(DebugConfig{Level: DebugOff, Printf: func(format string, a ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}})
+	db.printStats(actual)
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "[mydb] [stats] reads=primary:0,replica:1 writes=1") {
+		t.Errorf("actual lines: %q, expected printed regardless of debug level", lines)
+	}
+}
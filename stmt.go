@@ -0,0 +1,296 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errStmtClosed is the error of executions of a closed Stmt, as of `*sql.Stmt`
+var errStmtClosed = errors.New("sql: statement is closed")
+
+// Stmt is a prepared statement of `Tx` or of `DB` by `PrepareStmt()`, whose statements are observed by hooks
+// added by `AddHook()` the same way as statements of `DB`, with `StatementInfo.TxID` of the transaction if any
+type Stmt struct {
+	*sql.Stmt
+	db    *DB
+	query string
+	tgtdb *sql.DB
+	txID  string
+
+	// routed holds statements prepared on each target for executions routed by their context,
+	// nil for statements of Tx, which always run on tgtdb
+	routed *routedStmts
+}
+
+// routedStmts are statements of a query prepared on each target on demand
+type routedStmts struct {
+	mu     sync.Mutex
+	stmts  map[*sql.DB]*sql.Stmt
+	closed bool
+}
+
+// PrepareStmt creates a prepared statement for later queries or executions like `PrepareContext()`,
+// whose executions are routed by their own context rather than ctx: routing directives (e.g. `WithPrimary()`),
+// tables pinned to primary DB, health and deadlines are taken at each execution, and the statement is prepared
+// on each target at its first execution there. It is first prepared on the target routed by ctx, so that
+// invalid statements fail here. Executions failing by broken connections (`ErrorClassConnection`) close the
+// statement of the target and are retried, preparing it again on another read replica (or on the same primary DB
+// only for `driver.ErrBadConn` and `sql.ErrConnDone`), so that the statement is never pinned to a dead target. `Exec()` and `ExecContext()` run on primary DB
+// as `ExecContext()` of DB does, and others are routed as `QueryContext()` of DB is. The cluster of `PartitionRouter` is decided by ctx.
+// The caller must call the statement's Close method when the statement is no longer needed.
+func (db *DB) PrepareStmt(ctx context.Context, query string) (*Stmt, error) {
+	cluster, err := db.partitionCluster(ctx, query)
+	if err != nil {
+		db.debugf(DebugError, "[PrepareStmt] partition err: %s", err)
+		db.metrics.countError(err)
+		return nil, err
+	}
+	if cluster != nil {
+		return cluster.PrepareStmt(ctx, query)
+	}
+	stmt, tgtdb, err := db.prepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{
+		Stmt:   stmt,
+		db:     db,
+		query:  db.rebind(query),
+		tgtdb:  tgtdb,
+		routed: &routedStmts{stmts: map[*sql.DB]*sql.Stmt{tgtdb: stmt}},
+	}, nil
+}
+
+// newStmt returns Stmt of stmt prepared for query on tgtdb, in the transaction of txID if not empty
+func (db *DB) newStmt(stmt *sql.Stmt, query string, tgtdb *sql.DB, txID string) *Stmt {
+	return &Stmt{Stmt: stmt, db: db, query: query, tgtdb: tgtdb, txID: txID}
+}
+
+// statement returns ctx with statement ID and StatementInfo of an execution of s
+func (s *Stmt) statement(ctx context.Context, method string, args []interface{}) (context.Context, StatementInfo) {
+	ctx, info := s.db.newStatement(ctx, "Stmt."+method, s.query, args)
+	info.TxID = s.txID
+	return ctx, info
+}
+
+// run runs the execution of s by run with the statement of its target: tgtdb for statements of Tx,
+// otherwise the target routed by ctx as a write on primary DB or as a read
+func (s *Stmt) run(ctx context.Context, method string, args []interface{}, write bool, run func(ctx context.Context, stmt *sql.Stmt) error) error {
+	if s.routed == nil {
+		ctx, info := s.statement(ctx, method, args)
+		return s.db.runStatement(ctx, info, s.tgtdb, func(string) error { return run(ctx, s.Stmt) })
+	}
+	if write {
+		s.db.markWrite(ctx)
+	}
+	err := s.route(ctx, method, args, write, run)
+	if err != nil {
+		s.db.debugf(DebugError, "[Stmt.%s] err: %s", method, err)
+	}
+	s.db.metrics.countError(err)
+	return err
+}
+
+// route runs run with the statement prepared on the target routed by ctx
+func (s *Stmt) route(ctx context.Context, method string, args []interface{}, write bool, run func(ctx context.Context, stmt *sql.Stmt) error) error {
+	db := s.db
+	if err := checkNotInTx(ctx, "Stmt."+method); err != nil {
+		return err
+	}
+	if err := db.checkDirectives(ctx, "Stmt."+method, s.query, write); err != nil {
+		return err
+	}
+	if !write {
+		ctx = db.withQueryTables(db.withPinnedTables(ctx, s.query), s.query)
+	}
+	ctx, info := db.beginStatement(ctx, "Stmt."+method, s.query, args)
+	runOn := func(tgtdb *sql.DB) error {
+		stmt, err := s.routed.prepare(ctx, tgtdb, s.query)
+		if err != nil {
+			return err
+		}
+		return db.runStatement(ctx, info, tgtdb, func(string) error { return run(ctx, stmt) })
+	}
+
+	if write {
+		if err := db.primaryWritable(ctx); err != nil {
+			return err
+		}
+		db.countWrite()
+		start := time.Now()
+		err := runOn(db.master)
+		if err != nil && s.dropBroken(ctx, method, db.master, err, true) {
+			err = runOn(db.master)
+		}
+		db.observeWrite(start)
+		return err
+	}
+	usePrimary := UsePrimaryFromContext(ctx)
+	if usePrimary && !db.PrimaryInMaintenance() && !db.redirectPrimaryReads() {
+		if !DoValidateNew && db.master == nil {
+			return ErrNotProvidedPrimary
+		}
+		db.countRead(db.master)
+		err := runOn(db.master)
+		if err != nil && s.dropBroken(ctx, method, db.master, err, true) {
+			err = runOn(db.master)
+		}
+		return err
+	}
+	if usePrimary {
+		db.countFallback()
+	}
+	for failovers := 0; ; failovers++ {
+		var target *sql.DB
+		err := db.readReplica(ctx, ExactReplicaOrderFromContext(ctx), func(tgtdb *sql.DB) error {
+			target = tgtdb
+			return runOn(tgtdb)
+		})
+		if err == nil || target == nil || failovers >= len(db.readreplicas) || !s.dropBroken(ctx, method, target, err, false) {
+			return err
+		}
+		if target != db.master {
+			// re-prepared on another target, routed as usual
+			name := db.targetInfo(target).Name
+			ctx = withDirective(ctx, func(d *RoutingDirective) {
+				d.ExcludeReplicas = append(d.ExcludeReplicas[:len(d.ExcludeReplicas):len(d.ExcludeReplicas)], name)
+			})
+			db.countFailover()
+		}
+	}
+}
+
+// dropBroken closes the statement prepared on tgtdb if err shows connections to tgtdb are broken,
+// so that it is prepared again on the target of the next attempt, and returns true if the execution can be retried.
+// Executions on primary DB are retried only for `driver.ErrBadConn` and `sql.ErrConnDone`, which are returned
+// before the statement is sent, as others of `ErrorClassConnection` (e.g. a read timeout) may follow a write applied.
+func (s *Stmt) dropBroken(ctx context.Context, method string, tgtdb *sql.DB, err error, primary bool) bool {
+	if ctx.Err() != nil || !retryAllowed(ctx) || ClassifyError(err) != ErrorClassConnection {
+		return false
+	}
+	if primary && !errors.Is(err, driver.ErrBadConn) && !errors.Is(err, sql.ErrConnDone) {
+		return false
+	}
+	s.db.debugf(DebugEvent, "[Stmt.%s] re-prepare, target: %s err: %s", method, s.db.targetInfo(tgtdb).Name, err)
+	s.routed.mu.Lock()
+	stmt := s.routed.stmts[tgtdb]
+	delete(s.routed.stmts, tgtdb)
+	s.routed.mu.Unlock()
+	if stmt != nil {
+		stmt.Close()
+	}
+	return true
+}
+
+// prepare returns the statement of query prepared on tgtdb, preparing it if not yet
+func (r *routedStmts) prepare(ctx context.Context, tgtdb *sql.DB, query string) (*sql.Stmt, error) {
+	r.mu.Lock()
+	stmt, closed := r.stmts[tgtdb], r.closed
+	r.mu.Unlock()
+	if closed {
+		return nil, errStmtClosed
+	}
+	if stmt != nil {
+		return stmt, nil
+	}
+	// prepared without the lock, so that a slow target does not block executions on others
+	stmt, err := tgtdb.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prepared := r.stmts[tgtdb]; prepared != nil || r.closed {
+		stmt.Close()
+		if r.closed {
+			return nil, errStmtClosed
+		}
+		return prepared, nil
+	}
+	r.stmts[tgtdb] = stmt
+	return stmt, nil
+}
+
+// Close closes the statement, on all targets it is prepared on for statements of `PrepareStmt()`
+func (s *Stmt) Close() error {
+	if s.routed == nil {
+		return s.Stmt.Close()
+	}
+	s.routed.mu.Lock()
+	defer s.routed.mu.Unlock()
+	s.routed.closed = true
+	var err error
+	for tgtdb, stmt := range s.routed.stmts {
+		if cerr := stmt.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.routed.stmts, tgtdb)
+	}
+	return err
+}
+
+// Exec executes the prepared statement with the given arguments
+func (s *Stmt) Exec(args ...interface{}) (sql.Result, error) {
+	return s.exec(context.Background(), "Exec", args)
+}
+
+// ExecContext executes the prepared statement with the given arguments
+func (s *Stmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	return s.exec(ctx, "ExecContext", args)
+}
+
+func (s *Stmt) exec(ctx context.Context, method string, args []interface{}) (sql.Result, error) {
+	var res sql.Result
+	err := s.run(ctx, method, args, true, func(ctx context.Context, stmt *sql.Stmt) error {
+		var err error
+		res, err = stmt.ExecContext(ctx, args...)
+		return err
+	})
+	return res, err
+}
+
+// Query executes the prepared query statement with the given arguments
+func (s *Stmt) Query(args ...interface{}) (*sql.Rows, error) {
+	return s.queryRows(context.Background(), "Query", args)
+}
+
+// QueryContext executes the prepared query statement with the given arguments
+func (s *Stmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	return s.queryRows(ctx, "QueryContext", args)
+}
+
+func (s *Stmt) queryRows(ctx context.Context, method string, args []interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := s.run(ctx, method, args, false, func(ctx context.Context, stmt *sql.Stmt) error {
+		var err error
+		rows, err = stmt.QueryContext(ctx, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRow executes the prepared query statement expected to return at most one row with the given arguments
+func (s *Stmt) QueryRow(args ...interface{}) *sql.Row {
+	return s.queryRow(context.Background(), "QueryRow", args)
+}
+
+// QueryRowContext executes the prepared query statement expected to return at most one row with the given arguments
+func (s *Stmt) QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row {
+	return s.queryRow(ctx, "QueryRowContext", args)
+}
+
+func (s *Stmt) queryRow(ctx context.Context, method string, args []interface{}) *sql.Row {
+	var row *sql.Row
+	err := s.run(ctx, method, args, false, func(ctx context.Context, stmt *sql.Stmt) error {
+		row = stmt.QueryRowContext(ctx, args...)
+		return nil
+	})
+	if row == nil {
+		return failRow(ctx, err)
+	}
+	return row
+}
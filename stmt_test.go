@@ -0,0 +1,158 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPrepareStmt(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	query := "select id from mytable where id = ?"
+	replicaPrepare := r1.mock.ExpectPrepare("select id from mytable").WillBeClosed()
+	replicaPrepare.ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	stmt, err := db.PrepareStmt(context.Background(), query)
+	if err != nil {
+		t.Fatalf("error %s when PrepareStmt", err)
+	}
+	if stmt.Stmt == nil {
+		t.Errorf("actual nil statement, expected the statement prepared on read replica")
+	}
+
+	// a read replica as prepared
+	rows, err := stmt.QueryContext(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+
+	// primary DB by the context of the execution, prepared there at first
+	primaryPrepare := p.mock.ExpectPrepare("select id from mytable").WillBeClosed()
+	primaryPrepare.ExpectQuery().WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	primaryPrepare.ExpectQuery().WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	primaryPrepare.ExpectExec().WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+	var id int
+	if err := stmt.QueryRowContext(WithPrimary(context.Background()), 2).Scan(&id); err != nil || id != 2 {
+		t.Errorf("actual id: %d, err: %v, expected: 2 from primary DB", id, err)
+	}
+	rows, err = stmt.QueryContext(WithPrimary(context.Background()), 3)
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	rows.Close()
+	if _, err := stmt.ExecContext(context.Background(), 4); err != nil {
+		t.Errorf("error %s when ExecContext", err)
+	}
+
+	// deadlines of the execution
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	if _, err := stmt.QueryContext(ctx, 5); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("actual err: %v, expected: %s", err, context.DeadlineExceeded)
+	}
+
+	if err := stmt.Close(); err != nil {
+		t.Errorf("error %s when Close", err)
+	}
+	if _, err := stmt.Query(6); err == nil {
+		t.Errorf("actual no error, expected an error of closed statement")
+	}
+	for _, m := range []*mydbMock{p, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestPrepareStmtReprepare(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r0, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r0.db, r1.db)
+	defer db.Close()
+
+	connErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection refused")}
+	// prepared on replica-0, executed on replica-1 first, which is dead
+	r0.mock.ExpectPrepare("select id from mytable").WillBeClosed().
+		ExpectQuery().WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	r1.mock.ExpectPrepare("select id from mytable").WillBeClosed().
+		ExpectQuery().WithArgs(1).WillReturnError(connErr)
+	stmt, err := db.PrepareStmt(context.Background(), "select id from mytable where id = ?")
+	if err != nil {
+		t.Fatalf("error %s when PrepareStmt", err)
+	}
+	var id int
+	rows, err := stmt.QueryContext(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("error %s when QueryContext", err)
+	}
+	for rows.Next() {
+		rows.Scan(&id)
+	}
+	rows.Close()
+	if id != 1 {
+		t.Errorf("actual id: %d, expected: 1 from replica-0", id)
+	}
+	if actual := db.Metrics().Failovers; actual != 1 {
+		t.Errorf("actual failovers: %d, expected: 1", actual)
+	}
+
+	// not retried without retries allowed, prepared on replica-1 and executed on replica-0
+	r1.mock.ExpectPrepare("select id from mytable").WillBeClosed()
+	r0.mock.ExpectPrepare("select id from mytable").WillBeClosed().
+		ExpectQuery().WithArgs(2).WillReturnError(connErr)
+	if err := stmt.Close(); err != nil {
+		t.Errorf("error %s when Close", err)
+	}
+	stmt, err = db.PrepareStmt(context.Background(), "select id from mytable where id = ?")
+	if err != nil {
+		t.Fatalf("error %s when PrepareStmt", err)
+	}
+	if _, err := stmt.QueryContext(WithNoRetry(context.Background()), 2); !errors.Is(err, connErr) {
+		t.Errorf("actual err: %v, expected: %s", err, connErr)
+	}
+	stmt.Close()
+
+	// writes failing after sent are run exactly once
+	resetErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	p.mock.ExpectPrepare("update mytable").WillBeClosed().
+		ExpectExec().WithArgs(1).WillReturnError(resetErr)
+	stmt, err = db.PrepareStmt(context.Background(), "update mytable set name = 'a' where id = ?")
+	if err != nil {
+		t.Fatalf("error %s when PrepareStmt", err)
+	}
+	if _, err := stmt.ExecContext(context.Background(), 1); !errors.Is(err, resetErr) {
+		t.Errorf("actual err: %v, expected: %s", err, resetErr)
+	}
+	stmt.Close()
+
+	for _, m := range []*mydbMock{p, r0, r1} {
+		if err := m.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
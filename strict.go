@@ -0,0 +1,77 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetStrictDirectives sets whether `RoutingDirective` in context is checked for conflicts, to catch wiring bugs
+// in large codebases. In strict mode, methods with context fail with `*ConflictingDirectivesError` when:
+//   - both `ForcePrimary` and `ForceReplica` are set, e.g. by `WithPrimary()` and `WithReplica()`
+//   - `ForceReplica` is set for a write (`ExecContext()` / `BeginTx()`) or a query of tables set by `SetPrimaryTables()`
+//   - no read replica is in `Group`, or all read replicas in `Group` are named in `ExcludeReplicas`
+//
+// Otherwise, which is the default, conflicts are resolved silently, e.g. `WithPrimary()` takes precedence.
+func (db *DB) SetStrictDirectives(enabled bool) {
+	db.configMutex.Lock()
+	db.strictDirectives = enabled
+	db.configMutex.Unlock()
+}
+
+// strictDirectivesEnabled returns true if strict mode of `SetStrictDirectives()` is enabled
+func (db *DB) strictDirectivesEnabled() bool {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.strictDirectives
+}
+
+// checkDirectives returns `*ConflictingDirectivesError` if RoutingDirective in ctx of method conflicts in strict mode.
+// query is the statement of method ("" if none), and write is true if method always uses primary DB.
+func (db *DB) checkDirectives(ctx context.Context, method, query string, write bool) error {
+	if !db.strictDirectivesEnabled() {
+		return nil
+	}
+	d := DirectiveFromContext(ctx)
+	var reason string
+	switch {
+	case d.ForcePrimary && d.ForceReplica:
+		reason = "both primary DB and read replicas are forced"
+	case d.ForceReplica && write:
+		reason = "read replicas are forced for a write"
+	case d.ForceReplica && query != "" && db.pinnedToPrimary(query):
+		reason = "read replicas are forced for tables pinned to primary DB"
+	default:
+		reason = db.groupConflict(d)
+	}
+	if reason == "" {
+		return nil
+	}
+	return &ConflictingDirectivesError{Method: method, Directive: d, Reason: reason}
+}
+
+// groupConflict returns the reason why no read replica of `Group` of d can be used by names, "" if any can
+func (db *DB) groupConflict(d RoutingDirective) string {
+	if d.Group == "" {
+		return ""
+	}
+	excluded := make(map[string]struct{}, len(d.ExcludeReplicas))
+	for _, n := range d.ExcludeReplicas {
+		excluded[n] = empty
+	}
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	members := 0
+	for _, t := range db.replicaTargets {
+		if t.Group != d.Group {
+			continue
+		}
+		members++
+		if _, ok := excluded[t.Name]; !ok {
+			return ""
+		}
+	}
+	if members == 0 {
+		return fmt.Sprintf("no read replica is in group %q", d.Group)
+	}
+	return fmt.Sprintf("all read replicas in group %q are excluded", d.Group)
+}
@@ -0,0 +1,83 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSetStrictDirectives(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+	if err = db.SetTargetInfo(TargetInfo{Role: RoleReplica, Index: 1, Name: "replica-1", Group: "analytics"}); err != nil {
+		t.Fatalf("error %s when SetTargetInfo", err)
+	}
+	db.SetPrimaryTables("sessions")
+
+	background := context.Background()
+	tests := []struct {
+		ctx      context.Context
+		query    string
+		conflict bool
+	}{
+		{WithPrimary(background), fmt.Sprintf(selectQueryTmpl, "*"), false},
+		{WithPrimary(WithReplica(background)), fmt.Sprintf(selectQueryTmpl, "*"), true},
+		{WithReplica(background), "SELECT * FROM sessions", true},
+		{WithDirective(background, RoutingDirective{Group: "analytics"}), fmt.Sprintf(selectQueryTmpl, "*"), false},
+		{WithDirective(background, RoutingDirective{Group: "analytics", ExcludeReplicas: []string{"replica-1"}}), fmt.Sprintf(selectQueryTmpl, "*"), true},
+		{WithDirective(background, RoutingDirective{Group: "reporting"}), fmt.Sprintf(selectQueryTmpl, "*"), true},
+	}
+	for i, test := range tests {
+		for _, strict := range []bool{false, true} {
+			db.SetStrictDirectives(strict)
+			if !strict || !test.conflict {
+				p.mock.ExpectQuery("(.+)").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+				r1.mock.ExpectQuery("(.+)").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+				r2.mock.ExpectQuery("(.+)").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+			}
+			rows, err := db.QueryContext(test.ctx, test.query)
+			var conflictErr *ConflictingDirectivesError
+			if strict && test.conflict {
+				if !errors.Is(err, ErrConflictingDirectives) || !errors.As(err, &conflictErr) || conflictErr.Method != "QueryContext" {
+					t.Errorf("actual err: %v, expected: %s of test %d", err, ErrConflictingDirectives, i)
+				}
+				continue
+			}
+			if err != nil && !errors.Is(err, ErrNoReplicaAvailable) {
+				t.Errorf("error %s when QueryContext of test %d, strict: %t", err, i, strict)
+			}
+			if rows != nil {
+				rows.Close()
+			}
+		}
+	}
+
+	db.SetStrictDirectives(true)
+	if _, err = db.ExecContext(WithReplica(background), fmt.Sprintf(deleteQuueryTmpl, "")); !errors.Is(err, ErrConflictingDirectives) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrConflictingDirectives)
+	}
+	if _, err = db.BeginTx(WithReplica(background), nil); !errors.Is(err, ErrConflictingDirectives) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrConflictingDirectives)
+	}
+	if _, _, err = db.SelectReplica(WithDirective(background, RoutingDirective{Group: "reporting"})); !errors.Is(err, ErrConflictingDirectives) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrConflictingDirectives)
+	}
+	if actual := db.Metrics().Errors[ErrorTypeConflictingDirectives]; actual != 7 {
+		t.Errorf("actual %s errors: %d, expected: 7", ErrorTypeConflictingDirectives, actual)
+	}
+}
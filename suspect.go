@@ -0,0 +1,50 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SetFailoverGracePeriod sets the grace period before a read replica failing health checks becomes unavailable.
+//
+// With a positive d, a read replica failing a health check is first suspected (`EventReplicaSuspect`)
+// and keeps serving reads. It becomes unavailable (`EventReplicaDown`) at the first health check
+// still failing after d, or as soon as a read on it fails with a connection error.
+// Passing a health check again clears the suspicion (`EventReplicaSuspectCleared`).
+//
+// Zero, the default, makes read replicas unavailable at the first failed health check.
+func (db *DB) SetFailoverGracePeriod(d time.Duration) {
+	db.configMutex.Lock()
+	db.failoverGracePeriod = d
+	db.configMutex.Unlock()
+}
+
+// replicaFailoverGracePeriod returns current grace period set by `SetFailoverGracePeriod()`
+func (db *DB) replicaFailoverGracePeriod() time.Duration {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.failoverGracePeriod
+}
+
+// confirmSuspect makes r unavailable at once if r is suspected and err of a read on r is a connection error.
+// Errors caused by the caller giving up do not confirm anything.
+func (db *DB) confirmSuspect(ctx context.Context, r *sql.DB, err error) {
+	if err == nil || ctx.Err() != nil || ClassifyError(err) != ErrorClassConnection || db.healthChecksPaused() {
+		return
+	}
+	db.countMutex.Lock()
+	since, suspected := db.suspectReplicas[r]
+	if suspected {
+		delete(db.suspectReplicas, r)
+		db.unavailableReplicas[r] = empty
+		db.replicaStates[r].downSince = since
+	}
+	db.countMutex.Unlock()
+	if !suspected {
+		return
+	}
+	db.debugf(DebugEvent, "[confirmSuspect] replica idx: %d, err: %s", db.replicaStates[r].index, err)
+	db.emit(Event{Type: EventReplicaDown, Target: db.targetInfo(r), Err: err})
+	db.updateQuorum()
+}
@@ -0,0 +1,255 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Role is the role of a DB handled by `DB`
+type Role int
+
+const (
+	// RolePrimary is the role of primary DB
+	RolePrimary Role = iota
+
+	// RoleReplica is the role of read replica DB
+	RoleReplica
+)
+
+// String returns name of the role
+func (r Role) String() string {
+	switch r {
+	case RolePrimary:
+		return "primary"
+	case RoleReplica:
+		return "replica"
+	default:
+		return "unknown"
+	}
+}
+
+// TargetInfo describes which DB handles a request.
+// It is passed to hooks, events, balancers and `*Rows`, and wrapped in errors,
+// so that "which DB handled this" is known everywhere in the same shape.
+type TargetInfo struct {
+	// Role is the role of the DB
+	Role Role
+
+	// Index is the index of read replica as passed to `New()`, always 0 for primary DB
+	Index int
+
+	// Name is the name of the DB, `primary` for primary DB and `replica-<Index>` for read replicas by default.
+	// Names of read replicas are unique.
+	Name string
+
+	// Zone is the availability zone (or any locality) of the DB, empty if unknown
+	Zone string
+
+	// Weight is the relative share of reads of the read replica used by `WeightedBalancer`. Default to 1.
+	Weight int
+
+	// Proxy is the features avoided as a connection pooling proxy is in front of the DB, none by default
+	Proxy ProxyCompat
+
+	// Group is the group of the read replica (e.g. `analytics`) read only by `RoutingDirective.Group`, none by default
+	Group string
+
+	// Replication is how the read replica replicates primary DB, `ReplicationPhysical` by default.
+	// Reads of tables not set by `SetReplicatedTables()` are not routed to a read replica of `ReplicationLogical`.
+	Replication Replication
+
+	// ReaderEndpoint is true if the read replica is a load-balanced reader endpoint (e.g. reader DNS or a proxy)
+	// balancing over instances of its own, false by default. Reads routed to read replicas pass through to it,
+	// not balanced by `Balancer`, Round-Robin, `RampUpPolicy` or `HealthWeightPolicy`, while health checks,
+	// the SLO, staleness (e.g. `RoutingDirective.MaxStaleness`) and metrics still apply to it.
+	// While it is skipped, reads fail over to other read replicas if any, and to primary DB by `FallbackPolicy`.
+	ReaderEndpoint bool
+}
+
+// defaultTargets returns TargetInfo of primary DB and n read replicas used until `SetTargetInfo()` is called
+func defaultTargets(n int) (TargetInfo, []TargetInfo) {
+	replicas := make([]TargetInfo, n)
+	for i := range replicas {
+		replicas[i] = TargetInfo{Role: RoleReplica, Index: i, Name: fmt.Sprintf("replica-%d", i), Weight: 1}
+	}
+	return TargetInfo{Role: RolePrimary, Name: "primary", Weight: 1}, replicas
+}
+
+// targetInfo returns TargetInfo of tgtdb
+func (db *DB) targetInfo(tgtdb *sql.DB) TargetInfo {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	if state, ok := db.replicaStates[tgtdb]; ok {
+		return db.replicaTargets[state.index]
+	}
+	return db.primaryTarget
+}
+
+// Targets returns TargetInfo of primary DB and read replicas in order as passed to `New()`
+func (db *DB) Targets() (TargetInfo, []TargetInfo) {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	return db.primaryTarget, append([]TargetInfo(nil), db.replicaTargets...)
+}
+
+// SetTargetInfo sets `Name`, `Zone`, `Weight`, `Proxy`, `Group`, `Replication` and `ReaderEndpoint`
+// of the DB identified by `Role` and `Index` of info. Zero `Weight` means the default, 1.
+// It returns an error wrapping `ErrInvalidConfig` if the DB does not exist, `Name` is empty,
+// `Name` of a read replica is used by another one, `Weight` is negative,
+// or `ReaderEndpoint` is set for primary DB or for a read replica while another one is the reader endpoint.
+func (db *DB) SetTargetInfo(info TargetInfo) error {
+	if info.Name == "" || info.Weight < 0 {
+		return fmt.Errorf("%w: target name %q is empty or weight %d is negative", ErrInvalidConfig, info.Name, info.Weight)
+	}
+	if info.Weight == 0 {
+		info.Weight = 1
+	}
+	db.configMutex.Lock()
+	defer db.configMutex.Unlock()
+	switch {
+	case info.Role == RolePrimary && info.Index == 0:
+		if info.ReaderEndpoint {
+			return fmt.Errorf("%w: primary cannot be a reader endpoint", ErrInvalidConfig)
+		}
+		db.primaryTarget = info
+		return nil
+	case info.Role == RoleReplica && info.Index >= 0 && info.Index < len(db.replicaTargets):
+		for i, t := range db.replicaTargets {
+			if i != info.Index && t.Name == info.Name {
+				return fmt.Errorf("%w: replica name %q is duplicated", ErrInvalidConfig, info.Name)
+			}
+			if i != info.Index && t.ReaderEndpoint && info.ReaderEndpoint {
+				return fmt.Errorf("%w: %s is already the reader endpoint", ErrInvalidConfig, t.Name)
+			}
+		}
+		db.replicaTargets[info.Index] = info
+		return nil
+	default:
+		return fmt.Errorf("%w: no %s of index %d", ErrInvalidConfig, info.Role, info.Index)
+	}
+}
+
+// SetReplicaNames names read replicas in order as passed to `New()`, so that they can be referred by name,
+// e.g. by `WithExcludeReplicas()`. Names default to `replica-0`, `replica-1` and so on.
+// It returns an error wrapping `ErrInvalidConfig` if names are not as many as read replicas,
+// or any name is empty or duplicated.
+func (db *DB) SetReplicaNames(names ...string) error {
+	if len(names) != len(db.readreplicas) {
+		return fmt.Errorf("%w: %d names for %d read replicas", ErrInvalidConfig, len(names), len(db.readreplicas))
+	}
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, ok := seen[name]; ok || name == "" {
+			return fmt.Errorf("%w: replica name %q is empty or duplicated", ErrInvalidConfig, name)
+		}
+		seen[name] = empty
+	}
+	db.configMutex.Lock()
+	for i, name := range names {
+		db.replicaTargets[i].Name = name
+	}
+	db.configMutex.Unlock()
+	return nil
+}
+
+// ReplicaNames returns names of read replicas in order as passed to `New()`
+func (db *DB) ReplicaNames() []string {
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	names := make([]string, len(db.replicaTargets))
+	for i, t := range db.replicaTargets {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// excludedReplicas returns read replicas excluded by `RoutingDirective` in ctx, nil if none:
+// ones named in `ExcludeReplicas`, out of `Group`, lagging more than `MaxStaleness`,
+// or of `ReplicationLogical` not replicating tables of the query. Unknown names are ignored.
+func (db *DB) excludedReplicas(ctx context.Context) map[*sql.DB]struct{} {
+	d := DirectiveFromContext(ctx)
+	if len(d.ExcludeReplicas) == 0 && d.Group == "" && d.MaxStaleness <= 0 && len(d.tables) == 0 && len(d.schemaGroups) == 0 {
+		return nil
+	}
+	exclude := map[*sql.DB]struct{}{}
+	db.configMutex.RLock()
+	defer db.configMutex.RUnlock()
+	for i, t := range db.replicaTargets {
+		r := db.readreplicas[i]
+		if (d.Group != "" && t.Group != d.Group) || !db.replicates(i, d.tables) || !servesGroups(t.Group, d.schemaGroups) {
+			exclude[r] = empty
+		}
+		if lag := atomic.LoadInt64(&db.replicaStates[r].lag); d.MaxStaleness > 0 && lag > int64(d.MaxStaleness) {
+			exclude[r] = empty
+		}
+		for _, n := range d.ExcludeReplicas {
+			if n == t.Name {
+				exclude[r] = empty
+			}
+		}
+	}
+	return exclude
+}
+
+// noReplicaAvailable returns `*NoReplicaAvailableError` describing why each read replica is skipped
+// for a read excluding read replicas in exclude. Health of read replicas is not considered if bypassAutoFailover.
+func (db *DB) noReplicaAvailable(exclude map[*sql.DB]struct{}, bypassAutoFailover bool) error {
+	_, targets := db.Targets()
+	health := db.needHeartbeat && !bypassAutoFailover
+	skips := make([]ReplicaSkip, 0, len(db.readreplicas))
+	db.countMutex.RLock()
+	for i, r := range db.readreplicas {
+		state := db.replicaStates[r]
+		skip := ReplicaSkip{Target: targets[i], Lag: time.Duration(atomic.LoadInt64(&state.lag))}
+		_, drained := db.drainedReplicas[r]
+		_, excluded := exclude[r]
+		_, unavailable := db.unavailableReplicas[r]
+		excludedUntil, outOfRotation := db.excludedUntil(r)
+		switch {
+		case drained:
+			skip.Reason = SkipReasonDrained
+		case excluded:
+			skip.Reason = SkipReasonExcluded
+		case health && unavailable:
+			skip.Reason, skip.Since, skip.Err = SkipReasonUnavailable, state.downSince, state.errors.lastOf(OperationHealthCheck)
+		case health && !db.ready(r):
+			skip.Reason, skip.Since, skip.Err = SkipReasonNotReady, state.notReadySince, state.errors.lastOf(OperationReadinessCheck)
+		case !bypassAutoFailover && outOfRotation:
+			skip.Reason, skip.Until = SkipReasonOutOfRotation, excludedUntil
+		case !bypassAutoFailover && db.evicted(r):
+			state.mu.Lock()
+			skip.Reason, skip.Until = SkipReasonEvicted, state.evictedUntil
+			state.mu.Unlock()
+		default:
+			continue
+		}
+		skips = append(skips, skip)
+	}
+	db.countMutex.RUnlock()
+	return &NoReplicaAvailableError{Replicas: skips}
+}
+
+// SelectReplica returns one of the read replicas selected the same way as `QueryContext()`,
+// so that operations not covered by DB (driver-specific extensions, etc.)
+// still benefit from auto failover and balancing.
+//
+// In case that `ctx` is created from `mydb.WithExactReplicaOrder(ctx)`,
+// read replica is selected ignoring auto failover.
+func (db *DB) SelectReplica(ctx context.Context) (*sql.DB, TargetInfo, error) {
+	if err := db.checkDirectives(ctx, "SelectReplica", "", false); err != nil {
+		db.debugf(DebugError, "[SelectReplica] err: %s", err)
+		db.metrics.countError(err)
+		return nil, TargetInfo{}, err
+	}
+	tgtdb, err := db.selectReplica(ctx, ExactReplicaOrderFromContext(ctx))
+	if err != nil {
+		db.debugf(DebugError, "[SelectReplica] selectReplica err: %s", err)
+		db.metrics.countError(err)
+		return nil, TargetInfo{}, err
+	}
+	db.countRead(tgtdb)
+	return tgtdb, db.targetInfo(tgtdb), nil
+}
@@ -0,0 +1,334 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRoleString(t *testing.T) {
+	tests := []struct {
+		role     Role
+		expected string
+	}{
+		{RolePrimary, "primary"},
+		{RoleReplica, "replica"},
+		{Role(-1), "unknown"},
+	}
+
+	for _, test := range tests {
+		if actual := test.role.String(); actual != test.expected {
+			t.Errorf("actual = %s, expected = %s", actual, test.expected)
+		}
+	}
+}
+
+func TestSelectReplica(t *testing.T) {
+	var err error
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing().WillReturnError(fmt.Errorf("Not available"))
+	r2.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	tests := []struct {
+		ctx      context.Context
+		expected TargetInfo
+	}{
+		{context.Background(), TargetInfo{Role: RoleReplica, Index: 1, Name: "replica-1", Weight: 1}},
+		{context.Background(), TargetInfo{Role: RoleReplica, Index: 1, Name: "replica-1", Weight: 1}},
+		{WithExactReplicaOrder(context.Background()), TargetInfo{Role: RoleReplica, Index: 0, Name: "replica-0", Weight: 1}},
+	}
+
+	for _, test := range tests {
+		r, actual, err := db.SelectReplica(test.ctx)
+		if err != nil {
+			t.Fatalf("error %s when SelectReplica", err)
+		}
+		if actual != test.expected {
+			t.Errorf("actual = %+v, expected = %+v", actual, test.expected)
+		}
+		if r != db.readreplicas[actual.Index] {
+			t.Errorf("returned DB does not match target index %d", actual.Index)
+		}
+	}
+}
+
+func TestSelectReplicaNotProvided(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db)
+	defer db.Close()
+
+	if _, _, err = db.SelectReplica(context.Background()); err != ErrNotProvidedReplicas {
+		t.Errorf("actual err: %v, expected: %s", err, ErrNotProvidedReplicas)
+	}
+}
+
+func TestSetReplicaNames(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	if actual, expected := db.ReplicaNames(), []string{"replica-0", "replica-1"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual = %v, expected = %v", actual, expected)
+	}
+
+	invalids := [][]string{{"a"}, {"a", "b", "c"}, {"a", "a"}, {"a", ""}}
+	for _, names := range invalids {
+		if err = db.SetReplicaNames(names...); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("actual err: %v, expected: %s, names: %v", err, ErrInvalidConfig, names)
+		}
+	}
+	if err = db.SetReplicaNames("main", "analytics"); err != nil {
+		t.Fatalf("error %s when SetReplicaNames", err)
+	}
+	if actual, expected := db.ReplicaNames(), []string{"main", "analytics"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual = %v, expected = %v", actual, expected)
+	}
+}
+
+func TestSelectReplicaExcluded(t *testing.T) {
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r3, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	r3.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db, r3.db)
+	defer db.Close()
+	if err = db.SetReplicaNames("main", "analytics", "backup"); err != nil {
+		t.Fatalf("error %s when SetReplicaNames", err)
+	}
+
+	ctx := WithExcludeReplicas(context.Background(), "analytics", "unknown")
+	for _, balancer := range []Balancer{nil, &RoundRobinBalancer{}} {
+		db.SetBalancer(balancer)
+		for i := 0; i < 4; i++ {
+			_, actual, err := db.SelectReplica(ctx)
+			if err != nil {
+				t.Fatalf("error %s when SelectReplica", err)
+			}
+			if actual.Index == 1 {
+				t.Errorf("actual = %+v, expected excluded replica not selected, balancer: %T", actual, balancer)
+			}
+		}
+		if _, _, err = db.SelectReplica(WithExcludeReplicas(ctx, "main", "backup")); !errors.Is(err, ErrNoReplicaAvailable) {
+			t.Errorf("actual err: %v, expected: %s, balancer: %T", err, ErrNoReplicaAvailable, balancer)
+		}
+	}
+	if actual := db.Metrics().Failovers; actual != 0 {
+		t.Errorf("actual failovers: %d, expected: 0", actual)
+	}
+}
+
+func TestSelectReplicaDirective(t *testing.T) {
+	p, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r3, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+
+	r1.mock.ExpectPing()
+	r2.mock.ExpectPing()
+	r3.mock.ExpectPing()
+	db := New(p.db, r1.db, r2.db, r3.db)
+	defer db.Close()
+	for i, group := range []string{"", "analytics", "analytics"} {
+		if err = db.SetTargetInfo(TargetInfo{Role: RoleReplica, Index: i, Name: fmt.Sprintf("replica-%d", i), Group: group}); err != nil {
+			t.Fatalf("error %s when SetTargetInfo", err)
+		}
+	}
+	atomic.StoreInt64(&db.replicaStates[r2.db].lag, int64(time.Minute))
+	atomic.StoreInt64(&db.replicaStates[r3.db].lag, int64(time.Second))
+
+	tests := []struct {
+		directive RoutingDirective
+		expected  map[int]bool
+	}{
+		{RoutingDirective{}, map[int]bool{0: true, 1: true, 2: true}},
+		{RoutingDirective{Group: "analytics"}, map[int]bool{1: true, 2: true}},
+		{RoutingDirective{MaxStaleness: 10 * time.Second}, map[int]bool{0: true, 2: true}},
+		{RoutingDirective{Group: "analytics", MaxStaleness: 10 * time.Second}, map[int]bool{2: true}},
+		{RoutingDirective{Group: "analytics", MaxStaleness: 10 * time.Second, ExcludeReplicas: []string{"replica-2"}}, nil},
+		{RoutingDirective{Group: "reporting"}, nil},
+	}
+	for i, test := range tests {
+		ctx := WithDirective(context.Background(), test.directive)
+		for j := 0; j < 6; j++ {
+			_, actual, err := db.SelectReplica(ctx)
+			if test.expected == nil {
+				if !errors.Is(err, ErrNoReplicaAvailable) {
+					t.Errorf("actual err: %v, expected: %s of test %d", err, ErrNoReplicaAvailable, i)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("error %s when SelectReplica of test %d", err, i)
+			}
+			if !test.expected[actual.Index] {
+				t.Errorf("actual = %+v, expected one of %v of test %d", actual, test.expected, i)
+			}
+		}
+	}
+}
+
+func TestSetTargetInfo(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	tests := []struct {
+		info    TargetInfo
+		invalid bool
+	}{
+		{TargetInfo{Role: RolePrimary, Name: "main", Zone: "zone-a"}, false},
+		{TargetInfo{Role: RoleReplica, Index: 1, Name: "analytics", Zone: "zone-b", Weight: 3}, false},
+		{TargetInfo{Role: RoleReplica, Index: 0, Name: "analytics"}, true},
+		{TargetInfo{Role: RoleReplica, Index: 2, Name: "other"}, true},
+		{TargetInfo{Role: RolePrimary, Index: 1, Name: "other"}, true},
+		{TargetInfo{Role: RoleReplica, Index: 0, Name: ""}, true},
+		{TargetInfo{Role: RoleReplica, Index: 0, Name: "other", Weight: -1}, true},
+	}
+	for _, test := range tests {
+		if err = db.SetTargetInfo(test.info); errors.Is(err, ErrInvalidConfig) != test.invalid {
+			t.Errorf("actual err: %v, expected invalid: %t, info: %+v", err, test.invalid, test.info)
+		}
+	}
+
+	primary, replicas := db.Targets()
+	expectedPrimary := TargetInfo{Role: RolePrimary, Name: "main", Zone: "zone-a", Weight: 1}
+	expectedReplicas := []TargetInfo{
+		{Role: RoleReplica, Index: 0, Name: "replica-0", Weight: 1},
+		{Role: RoleReplica, Index: 1, Name: "analytics", Zone: "zone-b", Weight: 3},
+	}
+	if primary != expectedPrimary || !reflect.DeepEqual(replicas, expectedReplicas) {
+		t.Errorf("actual = %+v, %+v, expected = %+v, %+v", primary, replicas, expectedPrimary, expectedReplicas)
+	}
+	if actual := db.targetInfo(r2.db); actual != expectedReplicas[1] {
+		t.Errorf("actual = %+v, expected = %+v", actual, expectedReplicas[1])
+	}
+}
+
+func TestNoReplicaAvailableError(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock(true)
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r3, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1.mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+	r1.mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+	db := New(p.db, r1.db, r2.db, r3.db)
+	defer db.Close()
+	db.SetReadinessCheck(&ReadinessCheck{Check: func(ctx context.Context, r *sql.DB) error {
+		if r == r2.db {
+			return fmt.Errorf("%w: replication lag 1m0s exceeds 5s", ErrNotReady)
+		}
+		return nil
+	}})
+
+	_, err = db.QueryContext(WithExcludeReplicas(context.Background(), "replica-2"), fmt.Sprintf(selectQueryTmpl, "*"))
+	if !errors.Is(err, ErrNoReplicaAvailable) {
+		t.Fatalf("actual err: %v, expected: %s", err, ErrNoReplicaAvailable)
+	}
+	var noReplica *NoReplicaAvailableError
+	if !errors.As(err, &noReplica) {
+		t.Fatalf("actual err: %T, expected: *NoReplicaAvailableError", err)
+	}
+	expected := []string{SkipReasonUnavailable, SkipReasonNotReady, SkipReasonExcluded}
+	if len(noReplica.Replicas) != len(expected) {
+		t.Fatalf("actual skipped replicas: %+v, expected: %v", noReplica.Replicas, expected)
+	}
+	for i, skip := range noReplica.Replicas {
+		if skip.Target.Index != i || skip.Reason != expected[i] {
+			t.Errorf("actual skip: %+v, expected replica-%d %s", skip, i, expected[i])
+		}
+		if hasCause := skip.Reason != SkipReasonExcluded; (skip.Err != nil) != hasCause || skip.Since.IsZero() == hasCause {
+			t.Errorf("actual skip: %+v, expected error and since only for unavailable or not ready", skip)
+		}
+	}
+	if !errors.Is(noReplica.Replicas[1].Err, ErrNotReady) {
+		t.Errorf("actual err: %v, expected: %s", noReplica.Replicas[1].Err, ErrNotReady)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
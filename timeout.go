@@ -0,0 +1,162 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// StatementTimeoutDialect is a Dialect which can bound statements of a session by a server-side timeout
+type StatementTimeoutDialect interface {
+	Dialect
+
+	// StatementTimeoutSQL returns SQL setting the statement timeout of the session to timeout, 0 to disable it
+	StatementTimeoutSQL(timeout time.Duration) string
+}
+
+// StatementTimeoutSQL returns `SET statement_timeout` of timeout
+func (postgresDialect) StatementTimeoutSQL(timeout time.Duration) string {
+	return fmt.Sprintf("SET statement_timeout = %d", timeout.Milliseconds())
+}
+
+// StatementTimeoutSQL returns `SET max_execution_time` of timeout, which applies to read-only SELECT only
+func (mysqlDialect) StatementTimeoutSQL(timeout time.Duration) string {
+	return fmt.Sprintf("SET SESSION max_execution_time = %d", timeout.Milliseconds())
+}
+
+// NewStatementTimeoutConnector returns a connector wrapping c, whose connections set the remaining time
+// until the deadline of ctx as the server-side statement timeout before each query or execution,
+// so that statements of cancelled or timed-out requests do not keep running on the server.
+// The timeout is disabled again before statements without deadline. Open DB by `sql.OpenDB()` with it:
+//
+//	replica := sql.OpenDB(gosqlrwdb.NewStatementTimeoutConnector(connector, gosqlrwdb.PostgresDialect))
+//
+// c is returned as it is if d does not implement `StatementTimeoutDialect`.
+// Statements prepared by `Prepare()` are not bounded.
+// It does not work behind transaction-pooling proxies, see `ProxyCompat`.
+func NewStatementTimeoutConnector(c driver.Connector, d Dialect) driver.Connector {
+	td, ok := d.(StatementTimeoutDialect)
+	if !ok {
+		return c
+	}
+	return &timeoutConnector{Connector: c, dialect: td}
+}
+
+type timeoutConnector struct {
+	driver.Connector
+	dialect StatementTimeoutDialect
+}
+
+func (c *timeoutConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutConn{Conn: conn, dialect: c.dialect}, nil
+}
+
+// timeoutConn is a connection setting statement timeout by deadline of ctx
+type timeoutConn struct {
+	driver.Conn
+	dialect StatementTimeoutDialect
+
+	// timeoutSet is true if the statement timeout of the session is set
+	timeoutSet bool
+}
+
+// minStatementTimeout is the shortest statement timeout, as 0 disables it
+const minStatementTimeout = time.Millisecond
+
+// setTimeout sets the statement timeout of the session by the deadline of ctx
+func (c *timeoutConn) setTimeout(ctx context.Context) error {
+	deadline, ok := ctx.Deadline()
+	if !ok && !c.timeoutSet {
+		return nil
+	}
+	var timeout time.Duration
+	if ok {
+		if timeout = time.Until(deadline); timeout < minStatementTimeout {
+			timeout = minStatementTimeout
+		}
+	}
+	if err := c.exec(ctx, c.dialect.StatementTimeoutSQL(timeout)); err != nil {
+		return err
+	}
+	c.timeoutSet = ok
+	return nil
+}
+
+// exec executes query without args on the connection
+func (c *timeoutConn) exec(ctx context.Context, query string) error {
+	if execer, ok := c.Conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil) // nolint: staticcheck
+	return err
+}
+
+func (c *timeoutConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.setTimeout(ctx); err != nil {
+		return nil, err
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *timeoutConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.setTimeout(ctx); err != nil {
+		return nil, err
+	}
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *timeoutConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *timeoutConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() // nolint: staticcheck
+}
+
+func (c *timeoutConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *timeoutConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *timeoutConn) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,66 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.driver }
+
+func TestNewStatementTimeoutConnector(t *testing.T) {
+	tests := []struct {
+		dialect     Dialect
+		expectedSQL string
+	}{
+		{PostgresDialect, "SET statement_timeout = "},
+		{MySQLDialect, "SET SESSION max_execution_time = "},
+		{SQLServerDialect, ""},
+		{SQLiteDialect, ""},
+	}
+	for _, test := range tests {
+		dsn := "timeout_" + test.dialect.Name()
+		mockdb, mock, err := sqlmock.NewWithDSN(dsn)
+		if err != nil {
+			t.Fatalf("error %s when creating mock databasen", err)
+		}
+		db := sql.OpenDB(NewStatementTimeoutConnector(dsnConnector{dsn, mockdb.Driver()}, test.dialect))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if test.expectedSQL != "" {
+			mock.ExpectExec(test.expectedSQL + "[1-9][0-9]*").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+		if test.expectedSQL != "" {
+			mock.ExpectExec(test.expectedSQL + "0").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec("UPDATE mytable").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE mytable").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var n int
+		if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&n); err != nil {
+			t.Errorf("%s: actual %v, expected nil", test.dialect.Name(), err)
+		}
+		cancel()
+		for i := 0; i < 2; i++ {
+			if _, err := db.ExecContext(context.Background(), "UPDATE mytable SET a = 1"); err != nil {
+				t.Errorf("%s: actual %v, expected nil", test.dialect.Name(), err)
+			}
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: there were unfulfilled expectations: %s", test.dialect.Name(), err)
+		}
+		db.Close()
+		mockdb.Close()
+	}
+}
@@ -0,0 +1,124 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultTokenRefreshInterval is the interval of refreshing tokens of `Config.TokenSource` by default,
+// shorter than the lifetime of AWS RDS IAM auth tokens (15 minutes)
+const DefaultTokenRefreshInterval = 10 * time.Minute
+
+// TokenSource provides short-lived tokens used as passwords of DSNs, for managed authentication
+// such as AWS RDS IAM auth or GCP Cloud SQL IAM database auth. dsn is the DSN of the target without token,
+// e.g. to build the token for its endpoint and user. For AWS RDS with go-sql-driver:
+//
+//	gosqlrwdb.TokenSourceFunc(func(ctx context.Context, dsn string) (string, error) {
+//		cfg, err := mysql.ParseDSN(dsn)
+//		if err != nil {
+//			return "", err
+//		}
+//		return auth.BuildAuthToken(ctx, cfg.Addr, region, cfg.User, awsCfg.Credentials)
+//	})
+//
+// or for GCP Cloud SQL, the access token of `google.DefaultTokenSource(ctx, scope)`.
+type TokenSource interface {
+	// Token returns the current token for dsn
+	Token(ctx context.Context, dsn string) (string, error)
+}
+
+// TokenSourceFunc is a TokenSource of a function
+type TokenSourceFunc func(ctx context.Context, dsn string) (string, error)
+
+// Token calls f
+func (f TokenSourceFunc) Token(ctx context.Context, dsn string) (string, error) {
+	return f(ctx, dsn)
+}
+
+// TokenConnectorFactory returns a ConnectorFactory for `OpenRotating()`, connecting by the driver of driverName
+// to dsn with the password set to a token of ts by `PasswordDSN()`, so that each rotation fetches a new token:
+//
+//	replica, err := gosqlrwdb.OpenRotating(ctx, gosqlrwdb.TokenConnectorFactory("mysql", dsn, tokenSource))
+//
+// It returns the error of ts, `PasswordDSN()` or the driver.
+func TokenConnectorFactory(driverName, dsn string, ts TokenSource) ConnectorFactory {
+	return func(ctx context.Context) (driver.Connector, error) {
+		token, err := ts.Token(ctx, dsn)
+		if err != nil {
+			return nil, err
+		}
+		tokenDSN, err := PasswordDSN(dsn, token)
+		if err != nil {
+			return nil, err
+		}
+		return openConnector(driverName, tokenDSN)
+	}
+}
+
+// keyValueDSN matches DSNs of `key=value` pairs, e.g. `host=localhost user=app` of libpq
+var keyValueDSN = regexp.MustCompile(`^\s*[A-Za-z_]+\s*=`)
+
+// PasswordDSN returns dsn with the password set to password, replacing the current one. DSNs are of the forms:
+//   - URL, e.g. `postgres://user@host/db` or `sqlserver://user@host`
+//   - `key=value` pairs of libpq, e.g. `host=host user=user`, where password is appended as the last key wins
+//   - go-sql-driver/mysql, e.g. `user@tcp(host)/db?tls=true`
+//
+// It returns an error wrapping `ErrInvalidConfig` if dsn is of none of them or has no user.
+func PasswordDSN(dsn, password string) (string, error) {
+	switch {
+	case strings.Contains(dsn, "://"):
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		if u.User == nil {
+			return "", fmt.Errorf("%w: no user in DSN", ErrInvalidConfig)
+		}
+		u.User = url.UserPassword(u.User.Username(), password)
+		return u.String(), nil
+	case keyValueDSN.MatchString(dsn):
+		quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password)
+		return fmt.Sprintf("%s password='%s'", strings.TrimRight(dsn, " "), quoted), nil
+	case strings.Contains(dsn, "@"):
+		at := strings.LastIndex(dsn, "@")
+		user := dsn[:at]
+		if i := strings.Index(user, ":"); i >= 0 {
+			user = user[:i]
+		}
+		if user == "" {
+			return "", fmt.Errorf("%w: no user in DSN", ErrInvalidConfig)
+		}
+		return user + ":" + password + dsn[at:], nil
+	}
+	return "", fmt.Errorf("%w: unknown form of DSN", ErrInvalidConfig)
+}
+
+// openConnector returns a connector to dsn by the driver registered as driverName
+func openConnector(driverName, dsn string) (driver.Connector, error) {
+	// sql.Open() connects nothing but looks up the driver
+	db, err := sql.Open(driverName, "")
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+	if dc, ok := d.(driver.DriverContext); ok {
+		return dc.OpenConnector(dsn)
+	}
+	return driverConnector{dsn: dsn, driver: d}, nil
+}
+
+// driverConnector is a connector of a driver without `driver.DriverContext`, as `sql.Open()` makes
+type driverConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c driverConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c driverConnector) Driver() driver.Driver                        { return c.driver }
@@ -0,0 +1,216 @@
+package gosqlrwdb
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// States of DBs in `Topology`
+const (
+	// TopologyStateAvailable means the DB serves requests as usual
+	TopologyStateAvailable = "available"
+
+	// TopologyStateMaintenance means primary DB is in maintenance mode and requests are not checked against its health
+	TopologyStateMaintenance = "maintenance"
+
+	// TopologyStateDrill means primary DB is treated as down for writes by `StartDrill()`
+	TopologyStateDrill = "drill"
+
+	// TopologyStateDown means primary DB failed the last health check
+	TopologyStateDown = "down"
+
+	// TopologyStateDrained means the read replica is drained by `DrainReplica()`
+	TopologyStateDrained = "drained"
+
+	// TopologyStateUnavailable means the read replica failed health checks and gets no reads
+	TopologyStateUnavailable = "unavailable"
+
+	// TopologyStateNotReady means the read replica is alive but failed the last `ReadinessCheck`
+	TopologyStateNotReady = "not_ready"
+
+	// TopologyStateEvicted means the read replica is evicted for breaching the `SLO`
+	TopologyStateEvicted = "evicted"
+
+	// TopologyStateOutOfRotation means the read replica is excluded by `ExcludeReplica()` for a while
+	TopologyStateOutOfRotation = "out_of_rotation"
+
+	// TopologyStateSuspect means the read replica failed a health check within the failover grace period
+	TopologyStateSuspect = "suspect"
+
+	// TopologyStateRamping means the read replica gets a reduced share of reads by `RampUpPolicy` or `HealthWeightPolicy`
+	TopologyStateRamping = "ramping"
+)
+
+// TopologyNode describes a DB in `Topology`
+type TopologyNode struct {
+	// Role is `primary` or `replica`
+	Role string `json:"role"`
+
+	// Index is the index of read replica as passed to `New()`, always 0 for primary DB
+	Index int `json:"index"`
+
+	// Name is the name of the DB set by `SetTargetInfo()` or `SetReplicaNames()`
+	Name string `json:"name"`
+
+	// Zone is the zone of the DB, empty if unknown
+	Zone string `json:"zone,omitempty"`
+
+	// Weight is the configured relative share of reads of the read replica
+	Weight int `json:"weight"`
+
+	// State is one of `TopologyState*` constants
+	State string `json:"state"`
+
+	// TrafficWeight is the share of reads currently let through for the read replica in [0, 1],
+	// reduced by `RampUpPolicy` and `HealthWeightPolicy`. Always 1 for primary DB.
+	TrafficWeight float64 `json:"traffic_weight"`
+
+	// Lag is the replication lag measured by the last `DialectReadinessCheck`, negative if unknown
+	Lag time.Duration `json:"lag"`
+}
+
+// Topology is what `DB` currently believes about the cluster, for dashboards and support tooling.
+// It is a snapshot, encodable as JSON, and renderable as Graphviz by `DOT()`.
+type Topology struct {
+	// Primary is the primary DB
+	Primary TopologyNode `json:"primary"`
+
+	// Replicas are read replicas in order as passed to `New()`
+	Replicas []TopologyNode `json:"replicas"`
+
+	// Zones are names of read replicas grouped by zone, read replicas of unknown zone grouped by empty string
+	Zones map[string][]string `json:"zones"`
+}
+
+// Topology returns a snapshot of targets, roles, zones, weights, health and lag as currently known by db
+func (db *DB) Topology() Topology {
+	primary, replicas := db.Targets()
+	rampUp, health := db.replicaRampUpPolicy(), db.replicaHealthWeightPolicy()
+	inDrill := db.InDrill()
+
+	t := Topology{
+		Primary:  TopologyNode{Role: primary.Role.String(), Name: primary.Name, Zone: primary.Zone, Weight: primary.Weight, TrafficWeight: 1, Lag: -1},
+		Replicas: make([]TopologyNode, len(replicas)),
+		Zones:    map[string][]string{},
+	}
+
+	db.countMutex.RLock()
+	defer db.countMutex.RUnlock()
+	switch {
+	case db.PrimaryInMaintenance():
+		t.Primary.State = TopologyStateMaintenance
+	case inDrill:
+		t.Primary.State = TopologyStateDrill
+	case db.primaryDown != nil:
+		t.Primary.State = TopologyStateDown
+	default:
+		t.Primary.State = TopologyStateAvailable
+	}
+	for i, info := range replicas {
+		r := db.readreplicas[i]
+		node := TopologyNode{
+			Role:          info.Role.String(),
+			Index:         info.Index,
+			Name:          info.Name,
+			Zone:          info.Zone,
+			Weight:        info.Weight,
+			TrafficWeight: db.rampUpWeight(rampUp, r) * db.healthWeight(health, r),
+			Lag:           time.Duration(atomic.LoadInt64(&db.replicaStates[r].lag)),
+		}
+		node.State = db.topologyState(r, node.TrafficWeight)
+		t.Replicas[i] = node
+		t.Zones[info.Zone] = append(t.Zones[info.Zone], info.Name)
+	}
+	return t
+}
+
+// topologyState returns the state of read replica r of trafficWeight, caller must hold countMutex
+func (db *DB) topologyState(r *sql.DB, trafficWeight float64) string {
+	if _, drained := db.drainedReplicas[r]; drained {
+		return TopologyStateDrained
+	}
+	if _, unavailable := db.unavailableReplicas[r]; unavailable {
+		return TopologyStateUnavailable
+	}
+	if !db.ready(r) {
+		return TopologyStateNotReady
+	}
+	if _, excluded := db.excludedUntil(r); excluded {
+		return TopologyStateOutOfRotation
+	}
+	if db.evicted(r) {
+		return TopologyStateEvicted
+	}
+	if _, suspected := db.suspectReplicas[r]; suspected {
+		return TopologyStateSuspect
+	}
+	if trafficWeight < 1 {
+		return TopologyStateRamping
+	}
+	return TopologyStateAvailable
+}
+
+// DOT renders t in Graphviz DOT language: primary DB points to read replicas, which are clustered by zone
+// and colored by state
+func (t Topology) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph topology {\n")
+	b.WriteString("  node [shape=box, style=filled];\n")
+	fmt.Fprintf(&b, "  %s;\n", t.Primary.dotNode())
+
+	zones := make([]string, 0, len(t.Zones))
+	for zone := range t.Zones {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	for i, zone := range zones {
+		indent := "  "
+		if zone != "" {
+			fmt.Fprintf(&b, "  subgraph cluster_%d {\n    label=%q;\n", i, zone)
+			indent = "    "
+		}
+		for _, n := range t.Replicas {
+			if n.Zone == zone {
+				fmt.Fprintf(&b, "%s%s;\n", indent, n.dotNode())
+			}
+		}
+		if zone != "" {
+			b.WriteString("  }\n")
+		}
+	}
+	for _, n := range t.Replicas {
+		fmt.Fprintf(&b, "  %q -> %q;\n", t.Primary.Name, n.Name)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotNode returns the node statement of n in DOT language
+func (n TopologyNode) dotNode() string {
+	label := fmt.Sprintf("%s\n%s\nweight: %d", n.Name, n.State, n.Weight)
+	if n.Role == RoleReplica.String() && n.TrafficWeight < 1 {
+		label += fmt.Sprintf(" (%.0f%%)", n.TrafficWeight*100)
+	}
+	if n.Lag >= 0 {
+		label += fmt.Sprintf("\nlag: %s", n.Lag)
+	}
+	return fmt.Sprintf("%q [label=%q, fillcolor=%q]", n.Name, label, topologyColors[n.State])
+}
+
+// topologyColors are fill colors of states in `Topology.DOT()`
+var topologyColors = map[string]string{
+	TopologyStateAvailable:   "palegreen",
+	TopologyStateMaintenance: "lightblue",
+	TopologyStateDrill:       "orange",
+	TopologyStateDown:        "tomato",
+	TopologyStateDrained:     "lightgrey",
+	TopologyStateUnavailable: "tomato",
+	TopologyStateNotReady:    "khaki",
+	TopologyStateEvicted:     "orange",
+	TopologyStateSuspect:     "gold",
+	TopologyStateRamping:     "lightyellow",
+}
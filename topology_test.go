@@ -0,0 +1,89 @@
+package gosqlrwdb
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTopology(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r2, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db, r2.db)
+	defer db.Close()
+
+	if err = db.SetTargetInfo(TargetInfo{Role: RoleReplica, Index: 0, Name: "r1", Zone: "zone-a", Weight: 2}); err != nil {
+		t.Fatalf("error %s when SetTargetInfo", err)
+	}
+	if err = db.SetTargetInfo(TargetInfo{Role: RoleReplica, Index: 1, Name: "r2", Zone: "zone-b"}); err != nil {
+		t.Fatalf("error %s when SetTargetInfo", err)
+	}
+	r1.mock.ExpectQuery("pg_is_in_recovery").WillReturnRows(sqlmock.NewRows([]string{"ro"}).AddRow(true))
+	r1.mock.ExpectQuery("pg_last_xact_replay_timestamp").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(2))
+	r2.mock.ExpectQuery("pg_is_in_recovery").WillReturnRows(sqlmock.NewRows([]string{"ro"}).AddRow(true))
+	r2.mock.ExpectQuery("pg_last_xact_replay_timestamp").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(10))
+	db.SetReadinessCheck(DialectReadinessCheck(PostgresDialect, 5*time.Second))
+
+	topology := db.Topology()
+	expected := []TopologyNode{
+		{Role: "replica", Index: 0, Name: "r1", Zone: "zone-a", Weight: 2, State: TopologyStateAvailable, TrafficWeight: 1, Lag: 2 * time.Second},
+		{Role: "replica", Index: 1, Name: "r2", Zone: "zone-b", Weight: 1, State: TopologyStateNotReady, TrafficWeight: 1, Lag: 10 * time.Second},
+	}
+	if actual := topology.Primary; actual.Name != "primary" || actual.State != TopologyStateAvailable || actual.Lag >= 0 {
+		t.Errorf("actual primary = %+v, expected available primary of unknown lag", actual)
+	}
+	if len(topology.Replicas) != len(expected) {
+		t.Fatalf("actual replicas = %d, expected = %d", len(topology.Replicas), len(expected))
+	}
+	for i, actual := range topology.Replicas {
+		if actual != expected[i] {
+			t.Errorf("actual replica = %+v, expected = %+v", actual, expected[i])
+		}
+	}
+	if actual := topology.Zones["zone-a"]; len(actual) != 1 || actual[0] != "r1" {
+		t.Errorf("actual zone-a = %v, expected = [r1]", actual)
+	}
+
+	db.StartDrill()
+	if actual := db.Topology().Primary.State; actual != TopologyStateDrill {
+		t.Errorf("actual primary state = %s, expected = %s", actual, TopologyStateDrill)
+	}
+	db.StopDrill()
+
+	if _, err = json.Marshal(topology); err != nil {
+		t.Errorf("error %s when encoding topology as JSON", err)
+	}
+	dot := topology.DOT()
+	for _, expected := range []string{
+		"digraph topology {",
+		`subgraph cluster_0 {`,
+		`label="zone-a"`,
+		`"r2" [label="r2\nnot_ready\nweight: 1\nlag: 10s", fillcolor="khaki"]`,
+		`"primary" -> "r1";`,
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Errorf("actual DOT = %s, expected to contain %s", dot, expected)
+		}
+	}
+
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r2.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,25 @@
+package gosqlrwdb
+
+// TransportHintEncoder translates the routing decision for a statement into directives of a downstream proxy,
+// for deployments where a proxy (e.g. ProxySQL or Vitess) in front of the DBs makes the final hop decision.
+// It returns query as sent to the target of info, e.g. with a comment matched by query rules of the proxy.
+// `info.Target.Role` is the decision, after fallbacks and failovers of the statement.
+type TransportHintEncoder func(info StatementInfo, query string) string
+
+// SetTransportHintEncoder sets the TransportHintEncoder applied to SQL sent to primary DB & read replicas,
+// after `StatementIDOptions.Comment` and `QueryInjector`, so that the hint leads the query.
+// SQL of prepared statements is not encoded, as they outlive the decision. Passing nil removes it.
+func (db *DB) SetTransportHintEncoder(f TransportHintEncoder) {
+	db.configMutex.Lock()
+	defer db.configMutex.Unlock()
+	db.transportHint = f
+}
+
+// RouteComment returns a TransportHintEncoder prepending `/* key=primary */` or `/* key=replica */` to SQL
+// by the role of the target, e.g. for ProxySQL query rules matching it by `match_pattern` to set
+// `destination_hostgroup`, when all the DBs passed to `New()` connect to the proxy.
+func RouteComment(key string) TransportHintEncoder {
+	return func(info StatementInfo, query string) string {
+		return "/* " + key + "=" + info.Target.Role.String() + " */ " + query
+	}
+}
@@ -0,0 +1,62 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTransportHintEncoder(t *testing.T) {
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	db.SetTransportHintEncoder(RouteComment("route"))
+	db.SetQueryInjector("primary", HintComment("SeqScan(mytable)"))
+
+	query := fmt.Sprintf(selectQueryTmpl, "*")
+	del := fmt.Sprintf(deleteQuueryTmpl, "")
+	r1.mock.ExpectQuery(regexp.QuoteMeta("/* route=replica */ " + query)).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	p.mock.ExpectQuery(regexp.QuoteMeta("/* route=primary */ /*+ SeqScan(mytable) */ " + query)).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+	p.mock.ExpectExec(regexp.QuoteMeta("/* route=primary */ /*+ SeqScan(mytable) */ " + del)).WillReturnResult(sqlmock.NewResult(0, 1))
+	r1.mock.ExpectQuery(regexp.QuoteMeta(query)).WillReturnRows(sqlmock.NewRows([]string{"column1"}))
+
+	tests := []struct {
+		ctx   context.Context
+		write bool
+	}{
+		{context.Background(), false},
+		{WithPrimary(context.Background()), false},
+		{context.Background(), true},
+	}
+	for _, test := range tests {
+		if test.write {
+			if _, err := db.ExecContext(test.ctx, del); err != nil {
+				t.Errorf("error %s when ExecContext", err)
+			}
+			continue
+		}
+		if _, err := db.QueryContext(test.ctx, query); err != nil {
+			t.Errorf("error %s when QueryContext", err)
+		}
+	}
+
+	db.SetTransportHintEncoder(nil)
+	if _, err := db.QueryContext(context.Background(), query); err != nil {
+		t.Errorf("error %s when QueryContext", err)
+	}
+	for _, mock := range []*mydbMock{p, r1} {
+		if err := mock.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
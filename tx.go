@@ -0,0 +1,191 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Tx is a transaction begun by `RunInTx()`. All statements of Tx, including SELECTs,
+// run on the connection of the transaction on primary DB, so that reads see writes of the transaction.
+// Statements of Tx and of `*Stmt` prepared by it are observed by hooks added by `AddHook()`
+// with `StatementInfo.TxID` of the transaction.
+type Tx struct {
+	*sql.Tx
+	db     *DB
+	id     string
+	target TargetInfo
+}
+
+// Target returns TargetInfo of the DB the transaction runs on
+func (tx *Tx) Target() TargetInfo {
+	return tx.target
+}
+
+// ID returns the ID of the transaction, unique in the process, passed to hooks as `StatementInfo.TxID`
+func (tx *Tx) ID() string {
+	return tx.id
+}
+
+// statement returns ctx with statement ID and StatementInfo of a statement of tx
+func (tx *Tx) statement(ctx context.Context, method, query string, args []interface{}) (context.Context, StatementInfo) {
+	ctx, info := tx.db.newStatement(ctx, "Tx."+method, query, args)
+	info.TxID = tx.id
+	return ctx, info
+}
+
+// Exec executes a query that doesn't return rows in the transaction, e.g. an INSERT and UPDATE
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.exec(context.Background(), "Exec", query, args)
+}
+
+// ExecContext executes a query that doesn't return rows in the transaction, e.g. an INSERT and UPDATE
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.exec(ctx, "ExecContext", query, args)
+}
+
+func (tx *Tx) exec(ctx context.Context, method, query string, args []interface{}) (sql.Result, error) {
+	ctx, info := tx.statement(ctx, method, query, args)
+	var res sql.Result
+	err := tx.db.runStatement(ctx, info, tx.db.master, func(query string) error {
+		var err error
+		res, err = tx.Tx.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
+
+// Query executes a query that returns rows in the transaction, typically a SELECT
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.query(context.Background(), "Query", query, args)
+}
+
+// QueryContext executes a query that returns rows in the transaction, typically a SELECT
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.query(ctx, "QueryContext", query, args)
+}
+
+func (tx *Tx) query(ctx context.Context, method, query string, args []interface{}) (*sql.Rows, error) {
+	ctx, info := tx.statement(ctx, method, query, args)
+	var rows *sql.Rows
+	err := tx.db.runStatement(ctx, info, tx.db.master, func(query string) error {
+		var err error
+		rows, err = tx.Tx.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRow executes a query that is expected to return at most one row in the transaction
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.queryRow(context.Background(), "QueryRow", query, args)
+}
+
+// QueryRowContext executes a query that is expected to return at most one row in the transaction
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.queryRow(ctx, "QueryRowContext", query, args)
+}
+
+func (tx *Tx) queryRow(ctx context.Context, method, query string, args []interface{}) *sql.Row {
+	ctx, info := tx.statement(ctx, method, query, args)
+	var row *sql.Row
+	tx.db.runStatement(ctx, info, tx.db.master, func(query string) error {
+		row = tx.Tx.QueryRowContext(ctx, query, args...)
+		return nil
+	})
+	return row
+}
+
+// Prepare creates a prepared statement for use within the transaction
+func (tx *Tx) Prepare(query string) (*Stmt, error) {
+	return tx.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext creates a prepared statement for use within the transaction.
+// Statements run by the returned `*Stmt` are observed by hooks with the ID of the transaction.
+func (tx *Tx) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
+	// prepared statements outlive the statement ID, so that it is not commented in SQL
+	ctx, info := tx.statement(ctx, "PrepareContext", query, nil)
+	var stmt *sql.Stmt
+	err := tx.db.runStatement(ctx, info, tx.db.master, func(string) error {
+		var err error
+		stmt, err = tx.Tx.PrepareContext(ctx, query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx.db.newStmt(stmt, query, tx.db.master, tx.id), nil
+}
+
+// Stmt returns a transaction-specific prepared statement from an existing statement
+func (tx *Tx) Stmt(stmt *Stmt) *Stmt {
+	return tx.StmtContext(context.Background(), stmt)
+}
+
+// StmtContext returns a transaction-specific prepared statement from an existing statement.
+// Statements of `PrepareStmt()` are prepared on primary DB first if not yet.
+func (tx *Tx) StmtContext(ctx context.Context, stmt *Stmt) *Stmt {
+	prepared := stmt.Stmt
+	if stmt.routed != nil {
+		var err error
+		if prepared, err = stmt.routed.prepare(ctx, tx.db.master, stmt.query); err != nil {
+			// the statement of tx fails on execution unless the original statement is of primary DB
+			prepared = stmt.Stmt
+		}
+	}
+	return tx.db.newStmt(tx.Tx.StmtContext(ctx, prepared), stmt.query, tx.db.master, tx.id)
+}
+
+// RunInTx runs fn in a transaction begun by `BeginTx()` with opts, committing it if fn returns nil
+// and rolling it back otherwise (or if fn panics, in which case the panic is propagated).
+//
+// ctx passed to fn is marked as inside the transaction: methods of db called with it (or a context derived from it)
+// return `ErrCalledInTx` (`QueryRowContext()` panics with it), as reads and writes outside tx
+// would not see or be part of the transaction. Use tx inside fn instead.
+func (db *DB) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context, tx *Tx) error) (err error) {
+	cluster, err := db.partitionCluster(ctx, "")
+	if err != nil {
+		db.debugf(DebugError, "[RunInTx] partition err: %s", err)
+		db.metrics.countError(err)
+		return err
+	}
+	if cluster != nil {
+		return cluster.RunInTx(ctx, opts, fn)
+	}
+	sqlTx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	tx := &Tx{Tx: sqlTx, db: db, id: newStatementID(), target: db.targetInfo(db.master)}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err = fn(context.WithValue(ctx, ContextInTxKey, emptyContextValue), tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			db.debugf(DebugError, "[RunInTx] rollback err: %s", rbErr)
+		}
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		db.debugf(DebugError, "[RunInTx] commit err: %s", err)
+		db.metrics.countError(err)
+	}
+	return err
+}
+
+// InTxFromContext returns true if ctx is passed by `RunInTx()` to its closure (or derived from it); otherwise returns false
+func InTxFromContext(ctx context.Context) bool {
+	return ctx.Value(ContextInTxKey) != nil
+}
+
+// checkNotInTx returns an error wrapping `ErrCalledInTx` if method of DB is called with ctx inside `RunInTx()`
+func checkNotInTx(ctx context.Context, method string) error {
+	if InTxFromContext(ctx) {
+		return fmt.Errorf("%w: %s", ErrCalledInTx, method)
+	}
+	return nil
+}
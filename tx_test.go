@@ -0,0 +1,137 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRunInTx(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	// reads & writes of the transaction run on primary DB, and it is committed
+	p.mock.ExpectBegin()
+	p.mock.ExpectExec("^insert into mytable values \\(1\\)$").WillReturnResult(sqlmock.NewResult(1, 1))
+	p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	p.mock.ExpectCommit()
+	err = db.RunInTx(context.Background(), nil, func(ctx context.Context, tx *Tx) error {
+		if actual := tx.Target(); actual != db.targetInfo(p.db) {
+			t.Errorf("actual target = %+v, expected primary", actual)
+		}
+		if _, err := tx.ExecContext(ctx, "insert into mytable values (1)"); err != nil {
+			return err
+		}
+		var v int
+		return tx.QueryRowContext(ctx, fmt.Sprintf(selectQueryTmpl, "*")).Scan(&v)
+	})
+	if err != nil {
+		t.Errorf("error %s when RunInTx", err)
+	}
+
+	// methods of DB are rejected inside the closure, and it is rolled back
+	p.mock.ExpectBegin()
+	p.mock.ExpectRollback()
+	err = db.RunInTx(context.Background(), nil, func(ctx context.Context, tx *Tx) error {
+		if _, err := db.QueryContext(ctx, fmt.Sprintf(selectQueryTmpl, "*")); !errors.Is(err, ErrCalledInTx) {
+			t.Errorf("QueryContext: actual err = %v, expected = %s", err, ErrCalledInTx)
+		}
+		if _, err := db.ExecContext(WithPrimary(ctx), "delete from mytable"); !errors.Is(err, ErrCalledInTx) {
+			t.Errorf("ExecContext: actual err = %v, expected = %s", err, ErrCalledInTx)
+		}
+		if _, err := db.BeginTx(ctx, nil); !errors.Is(err, ErrCalledInTx) {
+			t.Errorf("BeginTx: actual err = %v, expected = %s", err, ErrCalledInTx)
+		}
+		return db.RunInTx(ctx, nil, func(context.Context, *Tx) error { return nil })
+	})
+	if !errors.Is(err, ErrCalledInTx) {
+		t.Errorf("actual err = %v, expected = %s", err, ErrCalledInTx)
+	}
+	if actual := db.Metrics().Errors[ErrorTypeCalledInTx]; actual != 4 {
+		t.Errorf("actual errors: %d, expected: 4", actual)
+	}
+
+	// rolled back on panic
+	p.mock.ExpectBegin()
+	p.mock.ExpectRollback()
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("The code did not panic but should panic as the closure panics")
+			}
+		}()
+		db.RunInTx(context.Background(), nil, func(context.Context, *Tx) error { panic("boom") })
+	}()
+
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestTxHooks(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+	hook := &recordingHook{}
+	db.AddHook(hook)
+
+	p.mock.ExpectBegin()
+	p.mock.ExpectExec("^insert into mytable values \\(1\\)$").WillReturnResult(sqlmock.NewResult(1, 1))
+	p.mock.ExpectPrepare(fmt.Sprintf(selectQueryTmpl, "(.+)"))
+	p.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	p.mock.ExpectCommit()
+	var txID string
+	err = db.RunInTx(context.Background(), nil, func(ctx context.Context, tx *Tx) error {
+		txID = tx.ID()
+		if _, err := tx.ExecContext(ctx, "insert into mytable values (1)"); err != nil {
+			return err
+		}
+		stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(selectQueryTmpl, "*"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		var v int
+		return stmt.QueryRowContext(ctx).Scan(&v)
+	})
+	if err != nil {
+		t.Errorf("error %s when RunInTx", err)
+	}
+
+	// statements after BeginTx are in the transaction
+	expected := []string{"Tx.ExecContext", "Tx.PrepareContext", "Stmt.QueryRowContext"}
+	if len(hook.after) != len(expected)+1 || hook.after[0].Method != "BeginTx" {
+		t.Fatalf("actual statements: %+v, expected: BeginTx & %v", hook.after, expected)
+	}
+	for i, info := range hook.after[1:] {
+		if info.Method != expected[i] || info.TxID == "" || info.TxID != txID || info.Target.Role != RolePrimary {
+			t.Errorf("actual statement: %+v, expected %s in transaction %s", info, expected[i], txID)
+		}
+	}
+	if err = p.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,7 +1,9 @@
 package gosqlrwdb
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 )
 
 // validateNew returns an error if the invocation of `New()` is invalid
@@ -12,18 +14,151 @@ func validateNew(master *sql.DB, readreplicas ...*sql.DB) error {
 	if len(readreplicas) == 0 {
 		return ErrNotProvidedReplicas
 	}
-	for _, r := range readreplicas {
+	for i, r := range readreplicas {
 		if r == nil {
-			return ErrNotProvidedReplicas
+			return fmt.Errorf("%w: replica-%d is nil", ErrNotProvidedReplicas, i)
 		}
 	}
+	if duplicates := findDuplicates(master, readreplicas); len(duplicates) > 0 {
+		return duplicates[0].err
+	}
 	return nil
 }
 
 // validateQuery returns an error if the invocation of `Query()` is invalid
 func validateQuery(query string, args ...interface{}) error {
-	if !IsQuerySqlFunc(query) {
+	return validateQueryBy(IsQuerySqlFunc, DoValidateParamCount, query, args...)
+}
+
+// validateQuery returns an error if the invocation of `Query()` is invalid, classifying query by Dialect if set
+func (db *DB) validateQuery(query string, args ...interface{}) error {
+	return validateQueryBy(db.isQuery, db.doValidateParamCount(), query, args...)
+}
+
+// validateQueryContext returns an error if the invocation of `QueryContext()` is invalid,
+// taking query as a read if ctx is created by `WithReplica()`
+func (db *DB) validateQueryContext(ctx context.Context, query string, args ...interface{}) error {
+	isQuery := db.isQuery
+	if UseReplicaFromContext(ctx) {
+		isQuery = func(string) bool { return true }
+	}
+	return validateQueryBy(isQuery, db.doValidateParamCount(), query, args...)
+}
+
+// validateQueryBy returns an error if the invocation of `Query()` is invalid, classifying query by isQuery
+// and validating number of placeholders if doValidateParamCount
+func validateQueryBy(isQuery func(query string) bool, doValidateParamCount bool, query string, args ...interface{}) error {
+	forcePrimary, err := checkExplain(query)
+	if err != nil {
+		return err
+	}
+	if !forcePrimary && !isQuery(query) {
 		return ErrNotQuerySQL
 	}
+	if doValidateParamCount {
+		if err := validateParamCount(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateParamCount returns `*ParamCountError` if placeholders in query do not match args:
+// number of positional placeholders (`?` or `$n`) must match number of positional args, and
+// names of named placeholders (`:name` or `@name`) must match names of `sql.NamedArg` args.
+// Names are only validated if any `sql.NamedArg` is passed, as `:name` may be driver specific syntax otherwise.
+func validateParamCount(query string, args ...interface{}) error {
+	var named []string
+	for _, arg := range args {
+		if n, ok := arg.(sql.NamedArg); ok {
+			named = append(named, n.Name)
+		}
+	}
+	questions, numbered, names := placeholders(query)
+	expected := len(questions)
+	if numbered > 0 {
+		expected = numbered
+	}
+	actual := len(args) - len(named)
+
+	var missing, unused []string
+	if len(named) > 0 {
+		missing = difference(names, named)
+		unused = difference(named, names)
+	}
+	if expected != actual || len(missing) > 0 || len(unused) > 0 {
+		return &ParamCountError{Query: query, Expected: expected, Actual: actual, MissingNames: missing, UnusedNames: unused}
+	}
 	return nil
 }
+
+// difference returns names in a but not in b
+func difference(a, b []string) []string {
+	var diff []string
+	for _, name := range a {
+		if !contains(b, name) {
+			diff = append(diff, name)
+		}
+	}
+	return diff
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholders returns offsets of `?` placeholders, the largest n of `$n` placeholders
+// and distinct names of `:name` / `@name` placeholders in query,
+// ignoring ones in comments, literals and quoted identifiers
+func placeholders(query string) (questions []int, numbered int, names []string) {
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == '-' && i+2 < len(query) && query[i+1] == '-' && isSpace(query[i+2]):
+			i = skipLineComment(query, i+2)
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			i = skipBlockComment(query, i+2)
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(query, i+1, c)
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			n := 0
+			for i++; i < len(query) && query[i] >= '0' && query[i] <= '9'; i++ {
+				n = n*10 + int(query[i]-'0')
+			}
+			if n > numbered {
+				numbered = n
+			}
+		case c == '$':
+			i = skipDollarQuoted(query, i)
+		case c == '?':
+			questions = append(questions, i)
+			i++
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			// Postgres type cast
+			i += 2
+		case c == '@' && i+1 < len(query) && query[i+1] == '@':
+			// MySQL system variable
+			i += 2
+		case (c == ':' || c == '@') && isNamedPlaceholder(query, i):
+			end := skipNamedPlaceholder(query, i)
+			if name := query[i+1 : end]; !contains(names, name) {
+				names = append(names, name)
+			}
+			i = end
+		case isWordByte(c):
+			// skip whole word, so that `$` or `?` in identifiers are not placeholders
+			for i < len(query) && (isWordByte(query[i]) || query[i] == '$') {
+				i++
+			}
+		default:
+			i++
+		}
+	}
+	return questions, numbered, names
+}
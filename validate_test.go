@@ -2,6 +2,8 @@ package gosqlrwdb
 
 import (
 	"database/sql"
+	"errors"
+	"reflect"
 	"testing"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
@@ -32,6 +34,43 @@ func TestValidateNew(t *testing.T) {
 			t.Errorf("actual = %v, expected = %v", actual, test.expected)
 		}
 	}
+
+	actual := validateNew(pdb, rdb, nil)
+	if !errors.Is(actual, ErrNotProvidedReplicas) || actual.Error() != "No replica DB is not provided: replica-1 is nil" {
+		t.Errorf("actual = %v, expected error of replica-1", actual)
+	}
+}
+
+func TestValidateNewDuplicateHandle(t *testing.T) {
+	pdb, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	rdb, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	primary, replicas := defaultTargets(3)
+	tests := []struct {
+		master       *sql.DB
+		readreplicas []*sql.DB
+		expected     *DuplicateHandleError
+	}{
+		{pdb, []*sql.DB{pdb}, &DuplicateHandleError{Target: primary, Duplicate: replicas[0]}},
+		{pdb, []*sql.DB{rdb, pdb}, &DuplicateHandleError{Target: primary, Duplicate: replicas[1]}},
+		{pdb, []*sql.DB{rdb, rdb}, &DuplicateHandleError{Target: replicas[0], Duplicate: replicas[1]}},
+	}
+
+	for _, test := range tests {
+		actual := validateNew(test.master, test.readreplicas...)
+		var dup *DuplicateHandleError
+		if !errors.As(actual, &dup) || !reflect.DeepEqual(dup, test.expected) || !errors.Is(actual, ErrDuplicateHandle) {
+			t.Errorf("actual = %v, expected = %v", actual, test.expected)
+		}
+	}
+	if actual := validateNew(pdb, rdb, rdb).Error(); actual != "Same DB handle is passed more than once: replica-1 is the same as replica-0" {
+		t.Errorf("actual = %s, expected message naming replica-1 and replica-0", actual)
+	}
 }
 
 func TestValidateQuery(t *testing.T) {
@@ -51,3 +90,56 @@ func TestValidateQuery(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateQueryParamCount(t *testing.T) {
+	DoValidateParamCount = true
+	defer func() { DoValidateParamCount = false }()
+
+	tests := []struct {
+		query    string
+		args     []interface{}
+		expected error
+	}{
+		{"select * from mytable where id = ?", []interface{}{1}, nil},
+		{"select * from mytable where id = ? and name = ?", []interface{}{1}, &ParamCountError{Expected: 2, Actual: 1}},
+		{"select * from mytable where id = $1 or parent_id = $1 and name = $2", []interface{}{1, "a"}, nil},
+		{"select * from mytable where id = $2", []interface{}{1}, &ParamCountError{Expected: 2, Actual: 1}},
+		{"select '?', \"?\", `?` from mytable -- ?\n/* ? */", []interface{}{}, nil},
+		{"select $tag$ ? $tag$ from mytable where id = ?", []interface{}{1}, nil},
+		{"select id$1 from mytable", []interface{}{}, nil},
+		{"select * from mytable where id = ?", []interface{}{}, &ParamCountError{Expected: 1, Actual: 0}},
+		{"select * from mytable where id = @id", []interface{}{sql.Named("id", 1)}, nil},
+		{"select * from mytable where id = :id or parent_id = :id and name = ?", []interface{}{sql.Named("id", 1), "a"}, nil},
+		{"select * from mytable where id = :id and name = :name", []interface{}{sql.Named("id", 1)},
+			&ParamCountError{MissingNames: []string{"name"}}},
+		{"select * from mytable where id = :id", []interface{}{sql.Named("id", 1), sql.Named("name", "a")},
+			&ParamCountError{UnusedNames: []string{"name"}}},
+		{"select id::text, @@version from mytable where id = :id", []interface{}{sql.Named("id", 1)}, nil},
+		{"select ':name' from mytable", []interface{}{sql.Named("name", "a")}, &ParamCountError{UnusedNames: []string{"name"}}},
+		{"delete from mytable where id = ?", []interface{}{}, ErrNotQuerySQL},
+	}
+
+	for _, test := range tests {
+		actual := validateQuery(test.query, test.args...)
+		if expected, ok := test.expected.(*ParamCountError); ok {
+			var pe *ParamCountError
+			if !errors.As(actual, &pe) || pe.Expected != expected.Expected || pe.Actual != expected.Actual || pe.Query != test.query ||
+				!reflect.DeepEqual(pe.MissingNames, expected.MissingNames) || !reflect.DeepEqual(pe.UnusedNames, expected.UnusedNames) {
+				t.Errorf("actual = %v, expected = %v, query = %q", actual, expected, test.query)
+			}
+			if !errors.Is(actual, ErrParamCountMismatch) {
+				t.Errorf("actual = %v, expected to wrap %v", actual, ErrParamCountMismatch)
+			}
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("actual = %v, expected = %v, query = %q", actual, test.expected, test.query)
+		}
+	}
+}
+
+func TestValidateQueryParamCountDisabled(t *testing.T) {
+	if actual := validateQuery("select * from mytable where id = ?"); actual != nil {
+		t.Errorf("actual = %v, expected = nil", actual)
+	}
+}
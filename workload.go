@@ -0,0 +1,112 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// WorkloadPolicy partitions the capacity of each target (primary DB and each read replica) into pools per workload,
+// e.g. 70% for `web` and 30% for `batch`, so that one workload cannot starve another even on the same target.
+// Set the workload of statements by `WithWorkload()`.
+//
+// The limit applies to running statements: `*sql.Rows` being iterated after `Query()` returned are not counted.
+type WorkloadPolicy struct {
+	// Capacity is the number of concurrent statements on each target shared by all workloads
+	Capacity int
+
+	// Shares is the share (0.0 ~ 1.0) of Capacity of each workload by name. Each workload gets at least 1 slot.
+	Shares map[string]float64
+
+	// DefaultWorkload is the workload of statements without `WithWorkload()` or with a workload not in Shares.
+	// Such statements are not limited if it is not in Shares.
+	DefaultWorkload string
+
+	// MaxWait is the longest time to wait for a slot before failing with `ErrWorkloadLimit`.
+	// Statements wait until their ctx is done if zero.
+	MaxWait time.Duration
+}
+
+// workloadLimiter holds slots of each workload on each target
+type workloadLimiter struct {
+	policy WorkloadPolicy
+	slots  map[*sql.DB]map[string]chan struct{}
+}
+
+// SetWorkloadPolicy sets the WorkloadPolicy of all targets, replacing the current one.
+// Statements running when it is replaced are counted against the replaced one.
+// Passing nil removes the limits, which is the default.
+// It returns an error wrapping `ErrInvalidConfig` if Capacity is not positive or a share is out of 0.0 ~ 1.0.
+func (db *DB) SetWorkloadPolicy(p *WorkloadPolicy) error {
+	var limiter *workloadLimiter
+	if p != nil {
+		if p.Capacity <= 0 {
+			return fmt.Errorf("%w: workload capacity %d is not positive", ErrInvalidConfig, p.Capacity)
+		}
+		sizes := make(map[string]int, len(p.Shares))
+		for name, share := range p.Shares {
+			if share <= 0 || share > 1 {
+				return fmt.Errorf("%w: share %f of workload %q is out of 0.0 ~ 1.0", ErrInvalidConfig, share, name)
+			}
+			sizes[name] = int(share * float64(p.Capacity))
+			if sizes[name] < 1 {
+				sizes[name] = 1
+			}
+		}
+		limiter = &workloadLimiter{policy: *p, slots: map[*sql.DB]map[string]chan struct{}{}}
+		for _, target := range append([]*sql.DB{db.master}, db.readreplicas...) {
+			if _, ok := limiter.slots[target]; ok {
+				// the same handle as primary DB and read replica by `NewSingle()`
+				continue
+			}
+			limiter.slots[target] = make(map[string]chan struct{}, len(sizes))
+			for name, size := range sizes {
+				limiter.slots[target][name] = make(chan struct{}, size)
+			}
+		}
+	}
+	db.configMutex.Lock()
+	db.workloadLimiter = limiter
+	db.configMutex.Unlock()
+	return nil
+}
+
+// acquireWorkload waits for a slot of the workload of ctx on tgtdb, returning the function to release it.
+// It returns an error wrapping `ErrWorkloadLimit` if no slot is available before ctx is done or `MaxWait` elapses.
+func (db *DB) acquireWorkload(ctx context.Context, tgtdb *sql.DB) (func(), error) {
+	db.configMutex.RLock()
+	limiter := db.workloadLimiter
+	db.configMutex.RUnlock()
+	if limiter == nil {
+		return func() {}, nil
+	}
+	workload := WorkloadFromContext(ctx)
+	sem, ok := limiter.slots[tgtdb][workload]
+	if !ok {
+		workload = limiter.policy.DefaultWorkload
+		if sem, ok = limiter.slots[tgtdb][workload]; !ok {
+			return func() {}, nil
+		}
+	}
+	release := func() { <-sem }
+	select {
+	case sem <- empty:
+		return release, nil
+	default:
+	}
+
+	var timeout <-chan time.Time
+	if limiter.policy.MaxWait > 0 {
+		timer := time.NewTimer(limiter.policy.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case sem <- empty:
+		return release, nil
+	case <-timeout:
+	case <-ctx.Done():
+	}
+	return nil, fmt.Errorf("%w: workload %q on %s", ErrWorkloadLimit, workload, db.targetInfo(tgtdb).Name)
+}
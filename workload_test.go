@@ -0,0 +1,83 @@
+package gosqlrwdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWorkloadPolicy(t *testing.T) {
+	var err error
+	p, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	r1, err := newMydbMock()
+	if err != nil {
+		t.Fatalf("error %s when creating mock databasen", err)
+	}
+	db := New(p.db, r1.db)
+	defer db.Close()
+
+	invalid := []*WorkloadPolicy{
+		{Capacity: 0},
+		{Capacity: 10, Shares: map[string]float64{"web": 1.5}},
+	}
+	for _, policy := range invalid {
+		if err = db.SetWorkloadPolicy(policy); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("actual err: %v, expected: %s, policy: %+v", err, ErrInvalidConfig, policy)
+		}
+	}
+	err = db.SetWorkloadPolicy(&WorkloadPolicy{
+		Capacity:        10,
+		Shares:          map[string]float64{"web": 0.7, "batch": 0.05},
+		DefaultWorkload: "web",
+		MaxWait:         10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("error %s when SetWorkloadPolicy", err)
+	}
+	if actual := cap(db.workloadLimiter.slots[r1.db]["web"]); actual != 7 {
+		t.Errorf("actual web slots: %d, expected: 7", actual)
+	}
+
+	// batch gets at least 1 slot, which is in use
+	batch := WithWorkload(context.Background(), "batch")
+	release, err := db.acquireWorkload(batch, r1.db)
+	if err != nil {
+		t.Fatalf("error %s when acquireWorkload", err)
+	}
+	if _, err = db.QueryContext(batch, fmt.Sprintf(selectQueryTmpl, "*")); !errors.Is(err, ErrWorkloadLimit) {
+		t.Errorf("actual err: %v, expected: %s", err, ErrWorkloadLimit)
+	}
+	if actual := db.Metrics().Errors[ErrorTypeWorkloadLimit]; actual != 1 {
+		t.Errorf("actual errors: %d, expected: 1", actual)
+	}
+
+	// other workloads are not starved, and statements without workload are of the default one
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	if _, err = db.QueryContext(WithWorkload(context.Background(), "web"), fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when QueryContext of web", err)
+	}
+	if _, err = db.QueryContext(context.Background(), fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when QueryContext without workload", err)
+	}
+	if actual := len(db.workloadLimiter.slots[r1.db]["web"]); actual != 0 {
+		t.Errorf("actual web slots in use: %d, expected: 0", actual)
+	}
+
+	// the slot is available again once released
+	release()
+	r1.mock.ExpectQuery(fmt.Sprintf(selectQueryTmpl, "(.+)")).WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+	if _, err = db.QueryContext(batch, fmt.Sprintf(selectQueryTmpl, "*")); err != nil {
+		t.Errorf("error %s when QueryContext of batch", err)
+	}
+	if err = r1.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}